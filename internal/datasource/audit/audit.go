@@ -0,0 +1,163 @@
+// Package audit records who ran which queries and commands against which data sources,
+// and reports usage and slow queries from the recorded events.
+package audit
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Event records one query or command.
+type Event struct {
+	Time  time.Time `json:"time"`
+	User  string    `json:"user,omitempty"`
+	Roles []string  `json:"roles,omitempty"`
+	// Method is the RPC that ran the request, such as "ExecuteQuery".
+	Method string `json:"method"`
+	// Connector is empty for federated queries, which name their connectors in the query.
+	Connector string `json:"connector,omitempty"`
+	// Query is the normalized query: the JSON encoding of the parsed query, whether it was
+	// given as JSON or as query text, with parameters bound. Commands are recorded as given.
+	Query    string        `json:"query"`
+	Args     []string      `json:"args,omitempty"`
+	DryRun   bool          `json:"dry_run,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+	// Rows is the number of rows returned by a query, or affected by a command.
+	Rows int64 `json:"rows"`
+	// Bytes is the size of the encoded rows returned.
+	Bytes int64  `json:"bytes"`
+	Error string `json:"error,omitempty"`
+}
+
+// Sink stores audit events.
+type Sink interface {
+	Write(ctx context.Context, event Event) error
+	Close() error
+}
+
+// Reader is implemented by sinks whose events can be read back.
+type Reader interface {
+	// Events returns the events that match the filter, oldest first.
+	Events(ctx context.Context, filter Filter) ([]Event, error)
+}
+
+// Filter selects audit events. Zero fields match every event.
+type Filter struct {
+	// Since and Until bound the event time; Until is exclusive.
+	Since time.Time
+	Until time.Time
+	User  string
+	// Connector selects the events of one connector.
+	Connector string
+	// MinDuration selects events that took at least this long.
+	MinDuration time.Duration
+}
+
+// Match reports whether an event passes the filter.
+func (f Filter) Match(e Event) bool {
+	switch {
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	case f.User != "" && e.User != f.User:
+		return false
+	case f.Connector != "" && e.Connector != f.Connector:
+		return false
+	case f.MinDuration > 0 && e.Duration < f.MinDuration:
+		return false
+	}
+	return true
+}
+
+// Identity is the caller of a request.
+type Identity struct {
+	User  string
+	Roles []string
+	// Attributes are the caller's claims, such as a region, for access policies. They are
+	// not recorded in events.
+	Attributes map[string]interface{}
+}
+
+// IdentityFunc returns the caller of the request that ctx belongs to.
+type IdentityFunc func(ctx context.Context) Identity
+
+// userClaims are the claims that name a user, in order of preference.
+var userClaims = []string{"sub", "email", "username", "user_id", "api_key"}
+
+// ClaimsIdentity returns an IdentityFunc that reads the caller from token claims, such as
+// those the auth interceptor stores in the request context. The user is the first of the
+// sub, email, username, user_id and api_key claims that is set, and the roles are the
+// "roles" claim, a list, or the "role" claim, a string. All claims are the attributes.
+//
+// Example:
+//
+//	identity := audit.ClaimsIdentity(func(ctx context.Context) (map[string]interface{}, bool) {
+//	    return interceptor.GetUserClaims(ctx)
+//	})
+func ClaimsIdentity(claims func(ctx context.Context) (map[string]interface{}, bool)) IdentityFunc {
+	return func(ctx context.Context) Identity {
+		c, ok := claims(ctx)
+		if !ok {
+			return Identity{}
+		}
+		id := Identity{Attributes: c}
+		for _, name := range userClaims {
+			if s, ok := c[name].(string); ok && s != "" {
+				id.User = s
+				break
+			}
+		}
+		switch roles := c["roles"].(type) {
+		case []string:
+			id.Roles = roles
+		case []interface{}:
+			for _, r := range roles {
+				if s, ok := r.(string); ok {
+					id.Roles = append(id.Roles, s)
+				}
+			}
+		}
+		if role, ok := c["role"].(string); ok && role != "" && len(id.Roles) == 0 {
+			id.Roles = []string{role}
+		}
+		return id
+	}
+}
+
+// Logger records events to a sink.
+type Logger struct {
+	sink Sink
+	now  func() time.Time
+}
+
+// NewLogger returns a logger that writes to sink.
+func NewLogger(sink Sink) *Logger {
+	return &Logger{sink: sink, now: time.Now}
+}
+
+// Start begins the event of a request by a caller, with its time set.
+func (l *Logger) Start(caller Identity, method string) *Event {
+	return &Event{Time: l.now().UTC(), User: caller.User, Roles: caller.Roles, Method: method}
+}
+
+// Finish sets the duration of an event begun with Start, and writes it. A request is not
+// failed because it could not be audited, so write errors are logged.
+func (l *Logger) Finish(ctx context.Context, event *Event) {
+	event.Duration = l.now().Sub(event.Time)
+	if err := l.sink.Write(ctx, *event); err != nil {
+		log.Printf("Error writing audit event: %v", err)
+	}
+}
+
+// Reader returns the logger's sink if its events can be read back.
+func (l *Logger) Reader() (Reader, bool) {
+	r, ok := l.sink.(Reader)
+	return r, ok
+}
+
+// Close closes the sink.
+func (l *Logger) Close() error {
+	return l.sink.Close()
+}
@@ -0,0 +1,150 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type claimsKey struct{}
+
+func withClaims(claims map[string]interface{}) context.Context {
+	return context.WithValue(context.Background(), claimsKey{}, claims)
+}
+
+var testIdentity = ClaimsIdentity(func(ctx context.Context) (map[string]interface{}, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(map[string]interface{})
+	return claims, ok
+})
+
+func TestClaimsIdentity(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		expect Identity
+	}{
+		{"No claims", context.Background(), Identity{}},
+		{"Subject and roles", withClaims(map[string]interface{}{"sub": "alice", "email": "alice@example.com", "roles": []interface{}{"analyst", "admin"}}), Identity{User: "alice", Roles: []string{"analyst", "admin"}}},
+		{"Email and role", withClaims(map[string]interface{}{"email": "bob@example.com", "role": "support"}), Identity{User: "bob@example.com", Roles: []string{"support"}}},
+		{"API key", withClaims(map[string]interface{}{"api_key": "key-1"}), Identity{User: "key-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := testIdentity(tt.ctx)
+			id.Attributes = nil
+			assert.Equal(t, tt.expect, id)
+		})
+	}
+
+	id := testIdentity(withClaims(map[string]interface{}{"sub": "carol", "region": "west"}))
+	assert.Equal(t, "west", id.Attributes["region"])
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(NewJSONSink(&buf))
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	logger.now = func() time.Time { return start }
+
+	ctx := withClaims(map[string]interface{}{"sub": "alice", "role": "analyst"})
+	event := logger.Start(testIdentity(ctx), "ExecuteQuery")
+	event.Connector = "shop"
+	event.Query = `{"collection":"orders","type":"SELECT"}`
+	event.Rows, event.Bytes = 2, 40
+	logger.now = func() time.Time { return start.Add(150 * time.Millisecond) }
+	logger.Finish(ctx, event)
+
+	var written Event
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &written))
+	assert.Equal(t, Event{
+		Time:      start,
+		User:      "alice",
+		Roles:     []string{"analyst"},
+		Method:    "ExecuteQuery",
+		Connector: "shop",
+		Query:     `{"collection":"orders","type":"SELECT"}`,
+		Duration:  150 * time.Millisecond,
+		Rows:      2,
+		Bytes:     40,
+	}, written)
+
+	_, ok := logger.Reader()
+	assert.False(t, ok)
+}
+
+func testEvents() []Event {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return []Event{
+		{Time: start, User: "alice", Method: "ExecuteQuery", Connector: "shop", Query: "q1", Duration: 20 * time.Millisecond, Rows: 10, Bytes: 100},
+		{Time: start.Add(time.Minute), User: "bob", Roles: []string{"support"}, Method: "ExecuteCommand", Connector: "shop", Query: "DELETE FROM carts", Args: []string{"1"}, Duration: 2 * time.Second, Rows: 1},
+		{Time: start.Add(2 * time.Minute), User: "alice", Method: "ExecuteQuery", Connector: "metrics", Query: "q2", Duration: 500 * time.Millisecond, Error: "timeout"},
+		{Time: start.Add(3 * time.Minute), User: "alice", Method: "ExecuteQuery", Connector: "shop", Query: "q3", DryRun: true, Duration: 5 * time.Millisecond},
+	}
+}
+
+func TestSinks(t *testing.T) {
+	dir := t.TempDir()
+	fileSink, err := NewFileSink(filepath.Join(dir, "audit", "audit.jsonl"))
+	require.NoError(t, err)
+	sqliteSink, err := NewSQLiteSink(filepath.Join(dir, "audit", "audit.db"))
+	require.NoError(t, err)
+
+	sinks := map[string]interface {
+		Sink
+		Reader
+	}{"file": fileSink, "sqlite": sqliteSink}
+
+	for name, sink := range sinks {
+		t.Run(name, func(t *testing.T) {
+			defer sink.Close()
+			ctx := context.Background()
+			events := testEvents()
+			for _, event := range events {
+				require.NoError(t, sink.Write(ctx, event))
+			}
+
+			all, err := sink.Events(ctx, Filter{})
+			require.NoError(t, err)
+			assert.Equal(t, events, all)
+
+			filtered, err := sink.Events(ctx, Filter{Since: events[1].Time, Until: events[3].Time, User: "alice"})
+			require.NoError(t, err)
+			assert.Equal(t, events[2:3], filtered)
+
+			shop, err := sink.Events(ctx, Filter{Connector: "shop", MinDuration: 10 * time.Millisecond})
+			require.NoError(t, err)
+			assert.Equal(t, events[:2], shop)
+
+			usage, err := UsageStats(ctx, sink, Filter{}, ByUser)
+			require.NoError(t, err)
+			assert.Equal(t, []Usage{
+				{Key: "alice", Queries: 3, Errors: 1, Rows: 10, Bytes: 100, TotalDuration: 525 * time.Millisecond, AvgDuration: 175 * time.Millisecond, MaxDuration: 500 * time.Millisecond},
+				{Key: "bob", Queries: 1, Rows: 1, TotalDuration: 2 * time.Second, AvgDuration: 2 * time.Second, MaxDuration: 2 * time.Second},
+			}, usage)
+
+			usage, err = UsageStats(ctx, sink, Filter{}, ByConnector)
+			require.NoError(t, err)
+			require.Len(t, usage, 2)
+			assert.Equal(t, "shop", usage[0].Key)
+			assert.Equal(t, int64(3), usage[0].Queries)
+
+			slow, err := SlowQueries(ctx, sink, Filter{}, 10*time.Millisecond, 2)
+			require.NoError(t, err)
+			assert.Equal(t, []Event{events[1], events[2]}, slow)
+		})
+	}
+
+	// Events written before the sink was reopened are read back.
+	reopened, err := NewSQLiteSink(filepath.Join(dir, "audit", "audit.db"))
+	require.NoError(t, err)
+	defer reopened.Close()
+	all, err := reopened.Events(context.Background(), Filter{})
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+}
@@ -0,0 +1,256 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/common/errors"
+
+	_ "modernc.org/sqlite"
+)
+
+// JSONSink writes each event as a line of JSON, such as to stdout for a log collector.
+type JSONSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONSink returns a sink that writes events to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{encoder: json.NewEncoder(w)}
+}
+
+func (s *JSONSink) Write(ctx context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.encoder.Encode(event); err != nil {
+		return errors.NewError(errors.ErrorTypeExecution, "failed to write audit event", err)
+	}
+	return nil
+}
+
+func (s *JSONSink) Close() error {
+	return nil
+}
+
+// FileSink appends events as lines of JSON to a file, and reads them back by scanning it.
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens the audit file at path for appending, creating it and its directory
+// if needed.
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "failed to create audit directory", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeFileConnection, "failed to open audit file", err)
+	}
+	return &FileSink{path: path, file: file}, nil
+}
+
+func (s *FileSink) Write(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeExecution, "failed to encode audit event", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return errors.NewError(errors.ErrorTypeFileConnection, "failed to write audit event", err)
+	}
+	return nil
+}
+
+// Events scans the audit file for the events that match the filter.
+func (s *FileSink) Events(ctx context.Context, filter Filter) ([]Event, error) {
+	// Only the lines written before the scan starts are read, so that a partly written line
+	// is never read and writes need not wait for the scan.
+	s.mu.Lock()
+	info, err := s.file.Stat()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeFileConnection, "failed to read audit file", err)
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeFileConnection, "failed to open audit file", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(io.LimitReader(file, info.Size()))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "failed to parse audit file", err)
+		}
+		if filter.Match(event) {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeFileConnection, "failed to read audit file", err)
+	}
+	return events, nil
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// SQLiteSink stores events in the audit_events table of a SQLite database, and reads them
+// back with indexed queries.
+type SQLiteSink struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS audit_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time_ns INTEGER NOT NULL,
+	user TEXT NOT NULL,
+	roles TEXT NOT NULL,
+	method TEXT NOT NULL,
+	connector TEXT NOT NULL,
+	query TEXT NOT NULL,
+	args TEXT NOT NULL,
+	dry_run INTEGER NOT NULL,
+	duration_ns INTEGER NOT NULL,
+	rows INTEGER NOT NULL,
+	bytes INTEGER NOT NULL,
+	error TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_events_time ON audit_events (time_ns);
+CREATE INDEX IF NOT EXISTS audit_events_user ON audit_events (user, time_ns);
+CREATE INDEX IF NOT EXISTS audit_events_connector ON audit_events (connector, time_ns);
+`
+
+// NewSQLiteSink opens the SQLite database at path, creating it and the audit_events table
+// if needed.
+func NewSQLiteSink(path string) (*SQLiteSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "failed to create audit directory", err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, "failed to open audit database", err)
+	}
+	// SQLite allows one writer at a time.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, "failed to create audit table", err)
+	}
+	return &SQLiteSink{db: db}, nil
+}
+
+func (s *SQLiteSink) Write(ctx context.Context, event Event) error {
+	roles, err := json.Marshal(event.Roles)
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeExecution, "failed to encode audit event", err)
+	}
+	args, err := json.Marshal(event.Args)
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeExecution, "failed to encode audit event", err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO audit_events (time_ns, user, roles, method, connector, query, args, dry_run, duration_ns, rows, bytes, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.Time.UnixNano(), event.User, string(roles), event.Method, event.Connector, event.Query, string(args),
+		event.DryRun, int64(event.Duration), event.Rows, event.Bytes, event.Error)
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeQuery, "failed to write audit event", err)
+	}
+	return nil
+}
+
+// Events selects the events that match the filter.
+func (s *SQLiteSink) Events(ctx context.Context, filter Filter) ([]Event, error) {
+	var where []string
+	var params []interface{}
+	if !filter.Since.IsZero() {
+		where = append(where, "time_ns >= ?")
+		params = append(params, filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "time_ns < ?")
+		params = append(params, filter.Until.UnixNano())
+	}
+	if filter.User != "" {
+		where = append(where, "user = ?")
+		params = append(params, filter.User)
+	}
+	if filter.Connector != "" {
+		where = append(where, "connector = ?")
+		params = append(params, filter.Connector)
+	}
+	if filter.MinDuration > 0 {
+		where = append(where, "duration_ns >= ?")
+		params = append(params, int64(filter.MinDuration))
+	}
+
+	stmt := `SELECT time_ns, user, roles, method, connector, query, args, dry_run, duration_ns, rows, bytes, error FROM audit_events`
+	if len(where) > 0 {
+		stmt += " WHERE " + strings.Join(where, " AND ")
+	}
+	stmt += " ORDER BY time_ns, id"
+
+	rows, err := s.db.QueryContext(ctx, stmt, params...)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to read audit events", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var timeNs, duration int64
+		var roles, args string
+		err := rows.Scan(&timeNs, &event.User, &roles, &event.Method, &event.Connector, &event.Query, &args,
+			&event.DryRun, &duration, &event.Rows, &event.Bytes, &event.Error)
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeQuery, "failed to read audit event", err)
+		}
+		event.Time = time.Unix(0, timeNs).UTC()
+		event.Duration = time.Duration(duration)
+		if err := json.Unmarshal([]byte(roles), &event.Roles); err != nil {
+			return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "failed to decode audit event", err)
+		}
+		if err := json.Unmarshal([]byte(args), &event.Args); err != nil {
+			return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "failed to decode audit event", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to read audit events", err)
+	}
+	return events, nil
+}
+
+func (s *SQLiteSink) Close() error {
+	return s.db.Close()
+}
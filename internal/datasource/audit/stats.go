@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// GroupBy names the field usage is grouped by.
+type GroupBy string
+
+const (
+	ByConnector GroupBy = "connector"
+	ByUser      GroupBy = "user"
+)
+
+// Usage sums the events of one connector or user.
+type Usage struct {
+	// Key is the connector or user the events belong to.
+	Key           string        `json:"key"`
+	Queries       int64         `json:"queries"`
+	Errors        int64         `json:"errors"`
+	Rows          int64         `json:"rows"`
+	Bytes         int64         `json:"bytes"`
+	TotalDuration time.Duration `json:"total_duration_ns"`
+	AvgDuration   time.Duration `json:"avg_duration_ns"`
+	MaxDuration   time.Duration `json:"max_duration_ns"`
+}
+
+// UsageStats sums the events that match the filter per connector or per user, busiest first.
+func UsageStats(ctx context.Context, r Reader, filter Filter, groupBy GroupBy) ([]Usage, error) {
+	events, err := r.Events(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]*Usage)
+	var stats []*Usage
+	for _, event := range events {
+		key := event.Connector
+		if groupBy == ByUser {
+			key = event.User
+		}
+		u, ok := byKey[key]
+		if !ok {
+			u = &Usage{Key: key}
+			byKey[key] = u
+			stats = append(stats, u)
+		}
+		u.Queries++
+		if event.Error != "" {
+			u.Errors++
+		}
+		u.Rows += event.Rows
+		u.Bytes += event.Bytes
+		u.TotalDuration += event.Duration
+		if event.Duration > u.MaxDuration {
+			u.MaxDuration = event.Duration
+		}
+	}
+
+	result := make([]Usage, 0, len(stats))
+	for _, u := range stats {
+		u.AvgDuration = u.TotalDuration / time.Duration(u.Queries)
+		result = append(result, *u)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Queries != result[j].Queries {
+			return result[i].Queries > result[j].Queries
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
+
+// SlowQueries returns the events that match the filter and took at least threshold, slowest
+// first. A positive limit caps the number of events returned.
+func SlowQueries(ctx context.Context, r Reader, filter Filter, threshold time.Duration, limit int) ([]Event, error) {
+	if threshold > filter.MinDuration {
+		filter.MinDuration = threshold
+	}
+	events, err := r.Events(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Duration > events[j].Duration
+	})
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
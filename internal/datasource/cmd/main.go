@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
 
 	"google.golang.org/grpc"
 
@@ -11,12 +12,55 @@ import (
 
 	"google.golang.org/grpc/reflection"
 
+	"datasource/audit"
 	"datasource/grpc/server"
 	manager "datasource/managers"
+	"datasource/managers/query"
 )
 
 type ServerConfig struct {
 	Port int
+	// SavedQueriesPath is the file that holds saved queries. Saved queries are kept in
+	// memory if it is empty.
+	SavedQueriesPath string
+	// AuditSink is where queries and commands are audited: "file" for a JSON lines file,
+	// "sqlite" for a SQLite database, or "stdout". Nothing is audited if it is empty.
+	AuditSink string
+	// AuditPath is the file or database of the file and sqlite audit sinks.
+	AuditPath string
+	// PoliciesPath is the JSON file that holds the access policies of each connector.
+	// Connectors have no policies if it is empty.
+	PoliciesPath string
+	// JWTSecret, when set, verifies the bearer token that every request must then carry, and
+	// the token's claims name the caller for the audit log and policies. Without it, requests
+	// are not authenticated and every caller is anonymous.
+	JWTSecret string
+}
+
+// openAuditLog opens the audit sink of config, or returns nil if auditing is disabled.
+func openAuditLog(config ServerConfig) (*audit.Logger, error) {
+	var sink audit.Sink
+	switch config.AuditSink {
+	case "":
+		return nil, nil
+	case "stdout":
+		sink = audit.NewJSONSink(os.Stdout)
+	case "file":
+		fileSink, err := audit.NewFileSink(config.AuditPath)
+		if err != nil {
+			return nil, err
+		}
+		sink = fileSink
+	case "sqlite":
+		sqliteSink, err := audit.NewSQLiteSink(config.AuditPath)
+		if err != nil {
+			return nil, err
+		}
+		sink = sqliteSink
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q", config.AuditSink)
+	}
+	return audit.NewLogger(sink), nil
 }
 
 func SetupAndServe(config ServerConfig) error {
@@ -26,11 +70,42 @@ func SetupAndServe(config ServerConfig) error {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
 
+	savedQueries, err := query.NewSavedQueryCatalog(config.SavedQueriesPath)
+	if err != nil {
+		return fmt.Errorf("failed to open saved queries: %v", err)
+	}
+
+	auditLog, err := openAuditLog(config)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	if auditLog != nil {
+		defer auditLog.Close()
+	}
+
+	policies, err := query.LoadPolicySet(config.PoliciesPath)
+	if err != nil {
+		return fmt.Errorf("failed to load policies: %v", err)
+	}
+
+	options := server.Options{
+		SavedQueries: savedQueries,
+		Audit:        auditLog,
+		Policies:     policies,
+	}
+	var serverOptions []grpc.ServerOption
+	if config.JWTSecret != "" {
+		serverOptions = append(serverOptions, grpc.UnaryInterceptor(server.AuthInterceptor([]byte(config.JWTSecret))))
+		options.Identity = audit.ClaimsIdentity(server.Claims)
+	} else {
+		log.Printf("DATASOURCE_JWT_SECRET is not set: requests are not authenticated")
+	}
+
 	connManager := manager.NewConnectorManager()
-	server := server.NewDataSourceServer(connManager)
+	dataSource := server.NewDataSourceServer(connManager, options)
 
-	s := grpc.NewServer()
-	pb.RegisterDataSourceServiceServer(s, server)
+	s := grpc.NewServer(serverOptions...)
+	pb.RegisterDataSourceServiceServer(s, dataSource)
 
 	// Register reflection service on gRPC server.
 	reflection.Register(s)
@@ -45,7 +120,11 @@ func SetupAndServe(config ServerConfig) error {
 
 func main() {
 	config := ServerConfig{
-		Port: 50051,
+		Port:             50051,
+		SavedQueriesPath: "data/saved-queries.json",
+		AuditSink:        "file",
+		AuditPath:        "data/audit.jsonl",
+		JWTSecret:        os.Getenv("DATASOURCE_JWT_SECRET"),
 	}
 
 	if err := SetupAndServe(config); err != nil {
@@ -2,35 +2,36 @@
 package connectors
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"pkg/common/errors"
 	"pkg/common/retry"
-
-	"github.com/gorilla/websocket"
 )
 
-// APIConnector implements the Connector interface for API data sources.
+// APIConnector implements the Connector and Streamer interfaces for API data sources.
 // It supports both RESTful HTTP APIs and WebSocket connections, as well as periodic polling.
 type APIConnector struct {
-	client            *http.Client
-	config            *Config
-	baseURL           string
-	wsConn            *websocket.Conn
-	wsBuffer          chan []byte
-	pollingTicker     *time.Ticker
-	stopPolling       chan struct{}
-	wsLock            sync.Mutex
-	reconnectBackoff  time.Duration
-	maxReconnectWait  time.Duration
-	stopReadWebSocket chan struct{}
+	client           *http.Client
+	config           *Config
+	baseURL          string
+	ws               *wsClient
+	poller           *apiPoller
+	pollerMu         sync.Mutex
+	reconnectBackoff time.Duration
+	maxReconnectWait time.Duration
+	auth             apiAuthenticator
+	secrets          []string
 }
 
 // NewAPIConnector creates a new APIConnector with the given configuration.
@@ -39,8 +40,19 @@ type APIConnector struct {
 //   - BaseURL: The base URL for the API
 //   - TimeoutSeconds: Timeout for HTTP requests and WebSocket connection
 //   - IsWebSocket: Set to true for WebSocket connections
-//   - WebSocketBufferSize: Buffer size for WebSocket messages
-//   - PollingIntervalSeconds: Interval for periodic polling (if > 0)
+//   - WebSocketBufferSize: Buffer size for WebSocket subscriptions
+//   - Options["ws_*"]: WebSocket subscription and heartbeat settings, described by connectWebSocket
+//   - PollingIntervalSeconds: Interval for periodic polling (if > 0), whose results are
+//     available through Subscribe, PollHistory and PollStats
+//   - Options["poll_interval"]: A polling interval such as "500ms", overriding PollingIntervalSeconds
+//   - Options["poll_path"]: The endpoint to poll, relative to BaseURL
+//   - Options["poll_key"]: The field identifying records in diff subscriptions
+//   - Options["poll_history"]: The number of snapshots to keep, 10 by default
+//   - Options["records_path"]: A JSON path selecting the records in responses, such as "$.data.items"
+//   - Options["header.<Name>"]: A header sent with every request, such as Options["header.Accept-Language"]
+//   - Options["pagination"]: The pagination strategy, configured with the options described by APIPagination
+//   - Options["auth"]: The authentication scheme: bearer, api_key, basic, oauth2 or hmac, configured
+//     with the options described by newAPIAuthenticator
 //
 // Example:
 //
@@ -49,6 +61,13 @@ type APIConnector struct {
 //	    TimeoutSeconds:         30,
 //	    IsWebSocket:            false,
 //	    PollingIntervalSeconds: 60,
+//	    Options: map[string]interface{}{
+//	        "auth":                 "oauth2",
+//	        "oauth2_token_url":     "https://auth.example.com/oauth/token",
+//	        "oauth2_client_id":     "reporting",
+//	        "oauth2_client_secret": os.Getenv("API_CLIENT_SECRET"),
+//	        "oauth2_scopes":        "read:orders read:customers",
+//	    },
 //	}
 //	connector := NewAPIConnector(config)
 func NewAPIConnector(config *Config) *APIConnector {
@@ -57,12 +76,9 @@ func NewAPIConnector(config *Config) *APIConnector {
 		client: &http.Client{
 			Timeout: time.Duration(config.TimeoutSeconds) * time.Second,
 		},
-		baseURL:           config.BaseURL,
-		wsBuffer:          make(chan []byte, config.WebSocketBufferSize),
-		stopPolling:       make(chan struct{}),
-		reconnectBackoff:  time.Second,
-		maxReconnectWait:  2 * time.Minute,
-		stopReadWebSocket: make(chan struct{}),
+		baseURL:          config.BaseURL,
+		reconnectBackoff: time.Second,
+		maxReconnectWait: 2 * time.Minute,
 	}
 }
 
@@ -82,12 +98,23 @@ func (c *APIConnector) Connect(ctx context.Context) error {
 		return errors.NewError(errors.ErrorTypeConfiguration, "base URL is required for API connector", nil)
 	}
 
+	auth, secrets, err := newAPIAuthenticator(c.config, c.client)
+	if err != nil {
+		return err
+	}
+	c.auth = auth
+	c.secrets = append(secrets, c.config.Password)
+
 	if c.config.IsWebSocket {
 		return c.connectWebSocket(ctx)
 	}
 
-	if c.config.PollingIntervalSeconds > 0 {
-		c.startPolling(ctx)
+	interval, err := c.config.pollInterval()
+	if err != nil {
+		return err
+	}
+	if interval > 0 {
+		return c.startPolling(ctx, interval)
 	}
 
 	return nil
@@ -104,28 +131,69 @@ func (c *APIConnector) Connect(ctx context.Context) error {
 //	    log.Printf("Error closing connector: %v", err)
 //	}
 func (c *APIConnector) Close(ctx context.Context) error {
-	if c.wsConn != nil {
-		c.stopReadWebSocket <- struct{}{}
-		err := c.wsConn.Close()
-		c.wsConn = nil
-		return err
+	c.pollerMu.Lock()
+	p := c.poller
+	c.poller = nil
+	c.pollerMu.Unlock()
+	if p != nil {
+		p.stop()
 	}
 
-	if c.pollingTicker != nil {
-		c.stopPolling <- struct{}{}
-		c.pollingTicker.Stop()
+	if c.ws != nil {
+		err := c.ws.close()
+		c.ws = nil
+		return err
 	}
 
 	return nil
 }
 
+// Subscribe starts a subscription. For WebSocket connections, it delivers the records of
+// incoming messages, as described by WebSocketSubscribeOptions; the topic is sent in the
+// subscribe message and, with the ws_topic_path option, selects the messages delivered.
+// Otherwise it delivers the results of polling, which requires a polling interval: the topic
+// is APIPollSnapshots to receive every poll's records, or APIPollChanges to receive the
+// records added, removed and changed between polls, and args may include an
+// APIPollSubscribeOptions.
+//
+// Example:
+//
+//	sub, err := connector.Subscribe(ctx, APIPollChanges, APIPollSubscribeOptions{KeyField: "id"})
+//	if err != nil {
+//	    return err
+//	}
+//	defer sub.Close()
+//	for ev := range sub.Events() {
+//	    fmt.Printf("%s: %v\n", ev.Data[APIChangeColumn], ev.Data["id"])
+//	}
+//
+//	trades, err := wsConnector.Subscribe(ctx, "trades.BTC-USD", WebSocketSubscribeOptions{
+//	    SubscribeMessage: `{"op": "subscribe", "channel": "{{topic}}"}`,
+//	    Match:            map[string]interface{}{"$.type": "trade"},
+//	    RecordsPath:      "$.data",
+//	})
+func (c *APIConnector) Subscribe(ctx context.Context, topic string, args ...interface{}) (Subscription, error) {
+	if c.config.IsWebSocket {
+		return c.subscribeWebSocket(ctx, topic, args)
+	}
+	return c.subscribePolling(ctx, topic, args)
+}
+
 // Query executes a request to the API and returns the results.
-// For WebSocket connections, it returns the latest message from the WebSocket.
-// For HTTP connections, it sends a GET request to the specified endpoint.
+// For WebSocket connections, it waits for the next message and returns its records.
+// For HTTP connections, it sends a request to the specified endpoint, a GET unless an
+// APIRequestOptions argument sets another method.
 //
 // The query parameter is appended to the base URL for HTTP requests.
 // For WebSocket connections, the query parameter is ignored.
 //
+// HTTP arguments may be an APIRequestOptions, and a map[string]interface{} of query
+// parameters. The response may be an array of records, or an object from which the records
+// are selected with the RecordsPath option or the records_path config option, such as
+// "$.data.items". An object without a records path is returned as a single row.
+// Paginated responses are followed to the last page, or the max_pages and max_rows caps;
+// see Stream to read the pages as they arrive.
+//
 // Example:
 //
 //	ctx := context.Background()
@@ -142,153 +210,342 @@ func (c *APIConnector) Query(ctx context.Context, query string, args ...interfac
 		return c.queryWebSocket(ctx)
 	}
 
-	return c.queryHTTP(ctx, query)
+	req, err := newAPIRequest(http.MethodGet, args)
+	if err != nil {
+		return nil, err
+	}
+	return c.queryHTTP(ctx, query, req)
 }
 
-// connectWebSocket establishes a WebSocket connection to the API.
-func (c *APIConnector) connectWebSocket(ctx context.Context) error {
-	dialer := websocket.Dialer{
-		HandshakeTimeout: time.Duration(c.config.TimeoutSeconds) * time.Second,
+// queryHTTP sends a request to the API, following the pages of the response, and returns
+// the records.
+func (c *APIConnector) queryHTTP(ctx context.Context, query string, req APIRequestOptions) ([]map[string]interface{}, error) {
+	it, err := c.streamHTTP(query, req)
+	if err != nil {
+		return nil, err
 	}
+	return readAllRows(ctx, it)
+}
 
-	conn, _, err := dialer.DialContext(ctx, c.baseURL, nil)
+// fetchRecords sends one request and returns the decoded response, the records in it and
+// the response headers.
+func (c *APIConnector) fetchRecords(ctx context.Context, target *url.URL, req APIRequestOptions) (interface{}, []map[string]interface{}, http.Header, error) {
+	body, header, err := c.doURL(ctx, target, req, errors.ErrorTypeQuery)
 	if err != nil {
-		return errors.NewError(errors.ErrorTypeAPIConnection, "failed to connect to WebSocket", err)
+		return nil, nil, nil, err
 	}
 
-	c.wsConn = conn
-	return nil
+	var result interface{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, nil, nil, errors.NewError(errors.ErrorTypeQuery, "failed to unmarshal response", err)
+		}
+	}
+	rows, err := c.records(result, req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return result, rows, header, nil
 }
 
-// readWebSocket continuously reads messages from the WebSocket connection
-// and sends them to the wsBuffer channel.
-func (c *APIConnector) readWebSocket() {
-	defer func() {
-		close(c.wsBuffer)
-		close(c.stopReadWebSocket)
-	}()
+// records selects the records from a decoded response.
+func (c *APIConnector) records(result interface{}, req APIRequestOptions) ([]map[string]interface{}, error) {
+	recordsPath := req.RecordsPath
+	if recordsPath == "" {
+		recordsPath, _ = c.config.option("records_path")
+	}
+	if recordsPath == "" {
+		return jsonRecords(result), nil
+	}
 
-	for {
-		_, message, err := c.wsConn.ReadMessage()
-		if err != nil {
-			select {
-			case <-c.stopReadWebSocket:
-				return
-			default:
-				log.Printf("WebSocket read error: %v", err)
-				if err := c.reconnectWebSocket(); err != nil {
-					log.Printf("Failed to reconnect WebSocket: %v", err)
-					return
-				}
-				continue
-			}
-		}
-		c.wsBuffer <- message
+	path, err := parseJSONPath(recordsPath)
+	if err != nil {
+		return nil, err
+	}
+	selected, ok := path.Select(result)
+	if !ok {
+		return nil, errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("records path %s not found in response", recordsPath), nil)
 	}
+	return jsonRecords(selected), nil
 }
 
-// reconnectWebSocket attempts to reconnect the WebSocket with exponential backoff
-func (c *APIConnector) reconnectWebSocket() error {
-	c.wsLock.Lock()
-	defer c.wsLock.Unlock()
-
-	backoff := c.reconnectBackoff
-	for {
-		log.Printf("Attempting to reconnect WebSocket in %v", backoff)
-		time.Sleep(backoff)
+// doHTTP sends a request with retries and returns the body of the successful response.
+func (c *APIConnector) doHTTP(ctx context.Context, path string, req APIRequestOptions, errType errors.ErrorType) ([]byte, http.Header, error) {
+	target, err := c.requestURL(path, req.Params)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.doURL(ctx, target, req, errType)
+}
 
-		if err := c.connectWebSocket(context.Background()); err == nil {
-			log.Println("Successfully reconnected WebSocket")
-			c.reconnectBackoff = time.Second // Reset backoff on successful connection
-			return nil
+// requestURL resolves path against the base URL and adds the query parameters.
+func (c *APIConnector) requestURL(path string, params map[string]interface{}) (*url.URL, error) {
+	target, err := url.Parse(c.baseURL + path)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "invalid request URL", err)
+	}
+	if len(params) > 0 {
+		values := target.Query()
+		for _, k := range sortedParamKeys(params) {
+			for _, v := range paramValues(params[k]) {
+				values.Add(k, v)
+			}
 		}
+		target.RawQuery = values.Encode()
+	}
+	return target, nil
+}
 
-		backoff *= 2
-		if backoff > c.maxReconnectWait {
-			backoff = c.maxReconnectWait
+// doURL sends a request to target with retries and returns the body of the successful
+// response. Failed attempts are mapped to error types by apiStatusError, so that only server
+// errors, rate limiting and network failures are retried; errType is used for other failures.
+func (c *APIConnector) doURL(ctx context.Context, target *url.URL, req APIRequestOptions, errType errors.ErrorType) ([]byte, http.Header, error) {
+	var err error
+	var payload []byte
+	if req.Body != nil {
+		if payload, err = json.Marshal(req.Body); err != nil {
+			return nil, nil, errors.NewError(errType, "failed to marshal request body", err)
 		}
 	}
-}
 
-// queryWebSocket returns the latest message received from the WebSocket connection.
-func (c *APIConnector) queryWebSocket(ctx context.Context) ([]map[string]interface{}, error) {
-	select {
-	case message := <-c.wsBuffer:
-		var result []map[string]interface{}
-		err := json.Unmarshal(message, &result)
+	var body []byte
+	var header http.Header
+	err = retry.Retry(ctx, func() error {
+		data, resp, err := c.send(ctx, req, target, payload, errType)
+		if err == nil && resp.StatusCode == http.StatusUnauthorized {
+			// A cached token may have been revoked before it expired, so fetch a new one and
+			// try once more before giving up.
+			if invalidator, ok := c.auth.(apiTokenInvalidator); ok {
+				invalidator.invalidate()
+				data, resp, err = c.send(ctx, req, target, payload, errType)
+			}
+		}
 		if err != nil {
-			return nil, errors.NewError(errors.ErrorTypeQuery, "failed to unmarshal WebSocket message", err)
+			return err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return apiStatusError(resp, []byte(c.redact(string(data))), errType)
 		}
-		return result, nil
-	case <-ctx.Done():
-		return nil, errors.NewError(errors.ErrorTypeQuery, "context cancelled while waiting for WebSocket message", ctx.Err())
+		body, header = data, resp.Header
+		return nil
+	}, apiRetryConfig())
+	if err != nil {
+		return nil, nil, err
 	}
+	return body, header, nil
 }
 
-// queryHTTP sends an HTTP GET request to the API and returns the results.
-// It uses the custom retry mechanism to handle transient errors.
-func (c *APIConnector) queryHTTP(ctx context.Context, query string) ([]map[string]interface{}, error) {
-	url := fmt.Sprintf("%s%s", c.baseURL, query)
-
-	var result []map[string]interface{}
-	err := retry.Retry(ctx, func() error {
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-		if err != nil {
-			return errors.NewError(errors.ErrorTypeQuery, "failed to create request", err)
+// send makes a single attempt at a request and returns the body and response, whatever the
+// status.
+func (c *APIConnector) send(ctx context.Context, req APIRequestOptions, target *url.URL, payload []byte, errType errors.ErrorType) ([]byte, *http.Response, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, target.String(), reader)
+	if err != nil {
+		return nil, nil, errors.NewError(errType, "failed to create request", err)
+	}
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	for k, v := range c.config.Options {
+		if name, ok := strings.CutPrefix(k, "header."); ok {
+			httpReq.Header.Set(name, fmt.Sprintf("%v", v))
 		}
-
-		resp, err := c.client.Do(req)
-		if err != nil {
-			return errors.NewError(errors.ErrorTypeQuery, "failed to execute request", err)
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	if c.auth != nil {
+		if err := c.auth.authenticate(ctx, httpReq, payload); err != nil {
+			return nil, nil, err
 		}
-		defer resp.Body.Close()
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			return errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("API returned non-OK status: %d", resp.StatusCode), nil)
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
 		}
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return errors.NewError(errors.ErrorTypeQuery, "failed to read response body", err)
+		// Transport errors quote the URL, which may carry an API key.
+		if urlErr, ok := err.(*url.Error); ok {
+			urlErr.URL = c.redact(urlErr.URL)
 		}
+		return nil, nil, errors.NewError(errors.ErrorTypeAPIConnection, "failed to execute request", err)
+	}
+	defer resp.Body.Close()
 
-		err = json.Unmarshal(body, &result)
-		if err != nil {
-			return errors.NewError(errors.ErrorTypeQuery, "failed to unmarshal response", err)
-		}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.NewError(errors.ErrorTypeAPIConnection, "failed to read response body", err)
+	}
+	return data, resp, nil
+}
 
-		return nil
-	}, retry.DefaultConfig())
+// redact removes the connector's secrets from s.
+func (c *APIConnector) redact(s string) string {
+	return redactSecrets(s, c.secrets)
+}
 
-	if err != nil {
-		return nil, err
+// apiRetryConfig returns the retry configuration for HTTP requests. It also retries
+// rate-limited requests, which apiStatusError reports as exhausted resources.
+func apiRetryConfig() *retry.Config {
+	config := retry.DefaultConfig()
+	config.RetryableErrors = append(config.RetryableErrors, func(err error) bool {
+		return errors.IsErrorType(err, errors.ErrorTypeResourceExhausted)
+	})
+	return config
+}
+
+// apiStatusError maps an unsuccessful response to an error type:
+//   - 400 and 422: ErrorTypeValidation
+//   - 401 and 403: ErrorTypePermission
+//   - 404 and 410: ErrorTypeNotFound
+//   - 408 and 504: ErrorTypeTimeout
+//   - 429: ErrorTypeResourceExhausted, carrying the Retry-After delay
+//   - other 5xx: ErrorTypeAPIConnection, carrying the Retry-After delay if there is one
+//   - other statuses: errType
+//
+// Only timeouts, exhausted resources and connection errors are retried.
+func apiStatusError(resp *http.Response, body []byte, errType errors.ErrorType) error {
+	switch code := resp.StatusCode; {
+	case code == http.StatusBadRequest || code == http.StatusUnprocessableEntity:
+		errType = errors.ErrorTypeValidation
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		errType = errors.ErrorTypePermission
+	case code == http.StatusNotFound || code == http.StatusGone:
+		errType = errors.ErrorTypeNotFound
+	case code == http.StatusRequestTimeout || code == http.StatusGatewayTimeout:
+		errType = errors.ErrorTypeTimeout
+	case code == http.StatusTooManyRequests:
+		errType = errors.ErrorTypeResourceExhausted
+	case code >= 500:
+		errType = errors.ErrorTypeAPIConnection
+	}
+
+	message := fmt.Sprintf("API returned status %d", resp.StatusCode)
+	if detail := strings.TrimSpace(string(body)); detail != "" {
+		if len(detail) > 200 {
+			detail = detail[:200] + "..."
+		}
+		message += ": " + detail
+	}
+	err := errors.NewError(errType, message, nil)
+	if after, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		errors.AddErrorContext(err, retry.RetryAfterContextKey, after.String())
 	}
+	return err
+}
 
-	return result, nil
+// parseRetryAfter parses a Retry-After header, which holds either a number of seconds or an
+// HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
 }
 
-// startPolling begins a periodic polling routine that calls the API at regular intervals.
-func (c *APIConnector) startPolling(ctx context.Context) {
-	c.pollingTicker = time.NewTicker(time.Duration(c.config.PollingIntervalSeconds) * time.Second)
-
-	go func() {
-		for {
-			select {
-			case <-c.pollingTicker.C:
-				_, err := c.queryHTTP(ctx, "")
-				if err != nil {
-					log.Printf("Polling error: %v", err)
-				}
-			case <-c.stopPolling:
-				return
+// APIRequestOptions configures an HTTP request made by APIConnector.
+type APIRequestOptions struct {
+	// Method is the HTTP method. Defaults to GET for Query and POST for Execute.
+	Method string
+	// Headers are added to the request, after the headers set with "header." config options.
+	Headers map[string]string
+	// Params are added to the query string. Slice values add the parameter once per element.
+	Params map[string]interface{}
+	// Body is encoded as the JSON request body.
+	Body interface{}
+	// RecordsPath selects the records in the response, overriding the records_path config option.
+	RecordsPath string
+	// Pagination overrides the connector's pagination options for Query and Stream.
+	Pagination *APIPagination
+}
+
+// newAPIRequest builds the request options from the arguments of Query or Execute. An
+// APIRequestOptions is used as given, a map[string]interface{} sets the query parameters of
+// GET, HEAD and DELETE requests and the body of others, and any other value is the body.
+func newAPIRequest(defaultMethod string, args []interface{}) (APIRequestOptions, error) {
+	var req APIRequestOptions
+	var extra []interface{}
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case APIRequestOptions:
+			req = v
+		case *APIRequestOptions:
+			req = *v
+		default:
+			extra = append(extra, arg)
+		}
+	}
+	if req.Method == "" {
+		req.Method = defaultMethod
+	}
+	req.Method = strings.ToUpper(req.Method)
+
+	for _, arg := range extra {
+		params, isMap := arg.(map[string]interface{})
+		switch {
+		case isMap && (req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodDelete):
+			if req.Params == nil {
+				req.Params = map[string]interface{}{}
+			}
+			for k, v := range params {
+				req.Params[k] = v
 			}
+		case req.Body != nil:
+			return req, errors.NewError(errors.ErrorTypeValidation, "only one request body can be given", nil)
+		default:
+			req.Body = arg
 		}
-	}()
+	}
+	return req, nil
 }
 
-// Execute sends a POST request to the API and returns the number of affected items.
+// paramValues formats a query parameter value; slices yield one value per element.
+func paramValues(v interface{}) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, e := range v {
+			values[i] = fmt.Sprintf("%v", e)
+		}
+		return values
+	default:
+		return []string{fmt.Sprintf("%v", v)}
+	}
+}
+
+func sortedParamKeys(params map[string]interface{}) []string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Execute sends a request to the API and returns the number of affected items.
 // It uses the custom retry mechanism to handle transient errors.
 //
+// The request is a POST unless an APIRequestOptions argument sets another method, and any
+// other argument is encoded as the JSON body. The count is the response's "affectedItems"
+// field if it has one, the number of records in the response if it is an array or the
+// records path selects one, and 1 otherwise.
+//
 // Example:
 //
 //	ctx := context.Background()
@@ -298,47 +555,39 @@ func (c *APIConnector) startPolling(ctx context.Context) {
 //	} else {
 //	    fmt.Printf("Created %d user(s)\n", affected)
 //	}
+//
+//	_, err = connector.Execute(ctx, "/users/42", APIRequestOptions{Method: "PATCH", Body: changes})
 func (c *APIConnector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
-	url := fmt.Sprintf("%s%s", c.baseURL, command)
-
-	var result struct {
-		AffectedItems int64 `json:"affectedItems"`
+	req, err := newAPIRequest(http.MethodPost, args)
+	if err != nil {
+		return 0, err
 	}
 
-	err := retry.Retry(ctx, func() error {
-		req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
-		if err != nil {
-			return errors.NewError(errors.ErrorTypeExecution, "failed to create request", err)
-		}
-
-		resp, err := c.client.Do(req)
-		if err != nil {
-			return errors.NewError(errors.ErrorTypeExecution, "failed to execute request", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return errors.NewError(errors.ErrorTypeExecution, fmt.Sprintf("API returned non-OK status: %d", resp.StatusCode), nil)
-		}
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return errors.NewError(errors.ErrorTypeExecution, "failed to read response body", err)
-		}
+	body, _, err := c.doHTTP(ctx, command, req, errors.ErrorTypeExecution)
+	if err != nil {
+		return 0, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return 1, nil
+	}
 
-		err = json.Unmarshal(body, &result)
-		if err != nil {
-			return errors.NewError(errors.ErrorTypeExecution, "failed to unmarshal response", err)
+	var result interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, errors.NewError(errors.ErrorTypeExecution, "failed to unmarshal response", err)
+	}
+	if obj, ok := result.(map[string]interface{}); ok {
+		if n, ok := obj["affectedItems"].(float64); ok {
+			return int64(n), nil
 		}
-
-		return nil
-	}, retry.DefaultConfig())
-
+	}
+	rows, err := c.records(result, req)
 	if err != nil {
 		return 0, err
 	}
-
-	return result.AffectedItems, nil
+	if _, isArray := result.([]interface{}); isArray || len(rows) != 1 {
+		return int64(len(rows)), nil
+	}
+	return 1, nil
 }
 
 // Ping checks if the API is accessible.
@@ -356,13 +605,13 @@ func (c *APIConnector) Execute(ctx context.Context, command string, args ...inte
 //	}
 func (c *APIConnector) Ping(ctx context.Context) error {
 	if c.config.IsWebSocket {
-		if c.wsConn == nil {
+		if c.ws == nil {
 			return errors.NewError(errors.ErrorTypeAPIConnection, "WebSocket connection not established", nil)
 		}
 		return nil
 	}
 
-	_, err := c.queryHTTP(ctx, "/ping")
+	_, _, err := c.doHTTP(ctx, "/ping", APIRequestOptions{Method: http.MethodGet}, errors.ErrorTypeAPIConnection)
 	return err
 }
 
@@ -0,0 +1,398 @@
+package connectors
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/common/errors"
+)
+
+// Authentication schemes for APIConnector, selected with the "auth" option.
+const (
+	APIAuthNone   = "none"
+	APIAuthBearer = "bearer"
+	APIAuthAPIKey = "api_key"
+	APIAuthBasic  = "basic"
+	APIAuthOAuth2 = "oauth2"
+	APIAuthHMAC   = "hmac"
+)
+
+const (
+	defaultAPIKeyHeader        = "X-API-Key"
+	defaultHMACHeader          = "X-Signature"
+	defaultHMACTimestampHeader = "X-Timestamp"
+	defaultHMACKeyIDHeader     = "X-Key-Id"
+	// oauth2ExpiryLeeway is how long before its expiry a cached token is replaced, so that a
+	// token does not expire between being attached to a request and the request arriving.
+	oauth2ExpiryLeeway = 30 * time.Second
+	redactedSecret     = "[REDACTED]"
+)
+
+// apiAuthenticator adds credentials to the requests of an APIConnector.
+type apiAuthenticator interface {
+	// authenticate adds credentials to req, whose encoded body is body.
+	authenticate(ctx context.Context, req *http.Request, body []byte) error
+}
+
+// apiTokenInvalidator is implemented by authenticators that cache credentials, so that a
+// request rejected with 401 can be retried once with fresh ones.
+type apiTokenInvalidator interface {
+	invalidate()
+}
+
+// newAPIAuthenticator builds the authenticator selected by the "auth" option, and returns the
+// secrets it uses so that they can be redacted. It returns a nil authenticator when the
+// option is unset or "none". The options of each scheme are:
+//   - bearer: auth_token, or Password if unset
+//   - api_key: api_key, or Password if unset; api_key_header names the header, which defaults
+//     to X-API-Key, and api_key_param sends the key as that query parameter instead
+//   - basic: Username and Password
+//   - oauth2: oauth2_token_url, oauth2_client_id (or Username), oauth2_client_secret (or
+//     Password), oauth2_scopes, a space or comma separated list, and oauth2_client_auth, which
+//     is "header" to send the client credentials with HTTP basic auth (the default) or "body"
+//     to send them in the form
+//   - hmac: hmac_secret (or Password), hmac_key_id (or Username), hmac_algorithm, which is
+//     sha256 (the default) or sha512, and hmac_header, which defaults to X-Signature
+func newAPIAuthenticator(config *Config, client *http.Client) (apiAuthenticator, []string, error) {
+	scheme, _ := config.option("auth")
+	secret := func(key string) string {
+		if v, ok := config.option(key); ok {
+			return v
+		}
+		return config.Password
+	}
+	required := func(name, value string) error {
+		if value == "" {
+			return errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("%s auth requires %s", scheme, name), nil)
+		}
+		return nil
+	}
+
+	switch strings.ToLower(scheme) {
+	case "", APIAuthNone:
+		return nil, nil, nil
+
+	case APIAuthBearer:
+		token := secret("auth_token")
+		if err := required("auth_token", token); err != nil {
+			return nil, nil, err
+		}
+		return &bearerAuth{token: token}, []string{token}, nil
+
+	case APIAuthAPIKey:
+		key := secret("api_key")
+		if err := required("api_key", key); err != nil {
+			return nil, nil, err
+		}
+		auth := &apiKeyAuth{key: key, header: defaultAPIKeyHeader}
+		if param, ok := config.option("api_key_param"); ok {
+			auth.param = param
+		} else if header, ok := config.option("api_key_header"); ok {
+			auth.header = header
+		}
+		return auth, []string{key}, nil
+
+	case APIAuthBasic:
+		if err := required("a username", config.Username); err != nil {
+			return nil, nil, err
+		}
+		return &basicAuth{username: config.Username, password: config.Password}, []string{config.Password}, nil
+
+	case APIAuthOAuth2:
+		tokenURL, _ := config.option("oauth2_token_url")
+		clientID, ok := config.option("oauth2_client_id")
+		if !ok {
+			clientID = config.Username
+		}
+		clientSecret := secret("oauth2_client_secret")
+		for _, opt := range [][2]string{{"oauth2_token_url", tokenURL}, {"oauth2_client_id", clientID}, {"oauth2_client_secret", clientSecret}} {
+			if err := required(opt[0], opt[1]); err != nil {
+				return nil, nil, err
+			}
+		}
+		auth := &oauth2Auth{
+			client:       client,
+			tokenURL:     tokenURL,
+			clientID:     clientID,
+			clientSecret: clientSecret,
+			now:          time.Now,
+		}
+		if scopes, ok := config.option("oauth2_scopes"); ok {
+			auth.scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+		}
+		switch style, _ := config.option("oauth2_client_auth"); style {
+		case "", "header":
+		case "body":
+			auth.credentialsInBody = true
+		default:
+			return nil, nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("unsupported oauth2_client_auth %q", style), nil)
+		}
+		return auth, []string{clientSecret}, nil
+
+	case APIAuthHMAC:
+		key := secret("hmac_secret")
+		if err := required("hmac_secret", key); err != nil {
+			return nil, nil, err
+		}
+		auth := &hmacAuth{secret: []byte(key), header: defaultHMACHeader, now: time.Now}
+		if keyID, ok := config.option("hmac_key_id"); ok {
+			auth.keyID = keyID
+		} else {
+			auth.keyID = config.Username
+		}
+		if header, ok := config.option("hmac_header"); ok {
+			auth.header = header
+		}
+		switch algorithm, _ := config.option("hmac_algorithm"); strings.ToLower(algorithm) {
+		case "", "sha256":
+			auth.hash = sha256.New
+		case "sha512":
+			auth.hash = sha512.New
+		default:
+			return nil, nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("unsupported hmac_algorithm %q", algorithm), nil)
+		}
+		return auth, []string{key}, nil
+
+	default:
+		return nil, nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("unsupported auth scheme %q", scheme), nil)
+	}
+}
+
+// bearerAuth sends a static token in the Authorization header.
+type bearerAuth struct {
+	token string
+}
+
+func (a *bearerAuth) authenticate(ctx context.Context, req *http.Request, body []byte) error {
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+// apiKeyAuth sends a key in a header, or in a query parameter if param is set.
+type apiKeyAuth struct {
+	key    string
+	header string
+	param  string
+}
+
+func (a *apiKeyAuth) authenticate(ctx context.Context, req *http.Request, body []byte) error {
+	if a.param == "" {
+		req.Header.Set(a.header, a.key)
+		return nil
+	}
+	params := req.URL.Query()
+	params.Set(a.param, a.key)
+	req.URL.RawQuery = params.Encode()
+	return nil
+}
+
+// basicAuth sends HTTP basic credentials.
+type basicAuth struct {
+	username string
+	password string
+}
+
+func (a *basicAuth) authenticate(ctx context.Context, req *http.Request, body []byte) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+// oauth2Auth obtains access tokens with the OAuth2 client credentials grant and caches them
+// until shortly before they expire. When the token response includes a refresh token, it is
+// used to renew the access token, falling back to the client credentials grant if the
+// refresh is rejected.
+type oauth2Auth struct {
+	client            *http.Client
+	tokenURL          string
+	clientID          string
+	clientSecret      string
+	scopes            []string
+	credentialsInBody bool
+	now               func() time.Time
+
+	mu           sync.Mutex
+	accessToken  string
+	tokenType    string
+	refreshToken string
+	expiry       time.Time
+}
+
+// oauth2Token is a token endpoint response, as described in RFC 6749 section 5.1.
+type oauth2Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (a *oauth2Auth) authenticate(ctx context.Context, req *http.Request, body []byte) error {
+	token, tokenType, err := a.token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", tokenType+" "+token)
+	return nil
+}
+
+// token returns a cached access token, fetching a new one if there is none or it is about
+// to expire.
+func (a *oauth2Auth) token(ctx context.Context) (string, string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.accessToken != "" && (a.expiry.IsZero() || a.now().Before(a.expiry)) {
+		return a.accessToken, a.tokenType, nil
+	}
+
+	var token *oauth2Token
+	var err error
+	if a.refreshToken != "" {
+		token, err = a.requestToken(ctx, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {a.refreshToken}})
+		if err != nil && !errors.IsErrorType(err, errors.ErrorTypePermission) {
+			return "", "", err
+		}
+	}
+	if token == nil {
+		form := url.Values{"grant_type": {"client_credentials"}}
+		if len(a.scopes) > 0 {
+			form.Set("scope", strings.Join(a.scopes, " "))
+		}
+		if token, err = a.requestToken(ctx, form); err != nil {
+			return "", "", err
+		}
+	}
+
+	a.accessToken = token.AccessToken
+	a.tokenType = "Bearer"
+	// Token types are case-insensitive, but some servers only accept the canonical "Bearer".
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		a.tokenType = token.TokenType
+	}
+	if token.RefreshToken != "" {
+		a.refreshToken = token.RefreshToken
+	}
+	a.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		a.expiry = a.now().Add(time.Duration(token.ExpiresIn)*time.Second - oauth2ExpiryLeeway)
+	}
+	return a.accessToken, a.tokenType, nil
+}
+
+// requestToken posts a token request. A rejected request is reported as ErrorTypePermission,
+// and an unreachable or failing endpoint as ErrorTypeAPIConnection so that it is retried.
+func (a *oauth2Auth) requestToken(ctx context.Context, form url.Values) (*oauth2Token, error) {
+	if a.credentialsInBody {
+		form.Set("client_id", a.clientID)
+		form.Set("client_secret", a.clientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "invalid oauth2_token_url", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !a.credentialsInBody {
+		req.SetBasicAuth(url.QueryEscape(a.clientID), url.QueryEscape(a.clientSecret))
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeAPIConnection, "failed to request OAuth2 token", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeAPIConnection, "failed to read OAuth2 token response", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		// The error code, such as invalid_client, explains the rejection without revealing secrets.
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(data, &failure)
+		return nil, errors.NewError(errors.ErrorTypePermission, fmt.Sprintf("OAuth2 token request rejected with status %d %s", resp.StatusCode, failure.Error), nil)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, errors.NewError(errors.ErrorTypeAPIConnection, fmt.Sprintf("OAuth2 token request failed with status %d", resp.StatusCode), nil)
+	}
+
+	var token oauth2Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeAPIConnection, "failed to decode OAuth2 token response", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.NewError(errors.ErrorTypePermission, "OAuth2 token response has no access_token", nil)
+	}
+	return &token, nil
+}
+
+// invalidate discards the cached access token, so the next request fetches a new one.
+func (a *oauth2Auth) invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.accessToken = ""
+}
+
+// hmacAuth signs requests with an HMAC of the method, the path and query, a timestamp and
+// the hex SHA-256 of the body, joined by newlines:
+//
+//	POST
+//	/v1/orders?status=open
+//	1714521600
+//	<hex sha256 of the body>
+//
+// The hex signature is sent in the configured header, the Unix timestamp in X-Timestamp,
+// and the key ID, if there is one, in X-Key-Id.
+type hmacAuth struct {
+	keyID  string
+	secret []byte
+	header string
+	hash   func() hash.Hash
+	now    func() time.Time
+}
+
+func (a *hmacAuth) authenticate(ctx context.Context, req *http.Request, body []byte) error {
+	timestamp := strconv.FormatInt(a.now().Unix(), 10)
+	req.Header.Set(defaultHMACTimestampHeader, timestamp)
+	if a.keyID != "" {
+		req.Header.Set(defaultHMACKeyIDHeader, a.keyID)
+	}
+	req.Header.Set(a.header, a.sign(req.Method, req.URL.RequestURI(), timestamp, body))
+	return nil
+}
+
+func (a *hmacAuth) sign(method, uri, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(a.hash, a.secret)
+	mac.Write([]byte(strings.Join([]string{method, uri, timestamp, hex.EncodeToString(bodyHash[:])}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// redactSecrets replaces every occurrence of the secrets in s, in plain or URL-encoded form,
+// with a placeholder, so that errors and log lines can be shown safely.
+func redactSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, secret, redactedSecret)
+		if escaped := url.QueryEscape(secret); escaped != secret {
+			s = strings.ReplaceAll(s, escaped, redactedSecret)
+		}
+	}
+	return s
+}
@@ -0,0 +1,298 @@
+package connectors
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOAuthServer issues numbered access tokens for the client credentials and refresh token
+// grants, and counts the requests for each.
+type fakeOAuthServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	issued    int
+	grants    []string
+	expiresIn int
+	refresh   bool
+	scopes    []string
+	reject    bool
+}
+
+func newFakeOAuthServer(t *testing.T) *fakeOAuthServer {
+	f := &fakeOAuthServer{expiresIn: 3600}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		require.NoError(t, r.ParseForm())
+		clientID, secret, ok := r.BasicAuth()
+		if !ok {
+			clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+		grant := r.PostForm.Get("grant_type")
+		f.grants = append(f.grants, grant)
+		if f.reject || clientID != "reporting" || secret != "s3cret" || (grant == "refresh_token" && r.PostForm.Get("refresh_token") == "revoked") {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": "invalid_client"}`)
+			return
+		}
+		f.scopes = strings.Fields(r.PostForm.Get("scope"))
+		f.issued++
+		refresh := ""
+		if f.refresh {
+			refresh = fmt.Sprintf(`, "refresh_token": "refresh-%d"`, f.issued)
+		}
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "bearer", "expires_in": %d%s}`, f.issued, f.expiresIn, refresh)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeOAuthServer) grantLog() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.grants...)
+}
+
+// authEcho answers every request with the credentials it carried.
+func authEcho(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	user, pass, _ := r.BasicAuth()
+	fmt.Fprintf(w, `{"authorization": %q, "api_key": %q, "key_param": %q, "user": %q, "pass": %q, "signature": %q, "timestamp": %q, "key_id": %q, "uri": %q, "body": %q}`,
+		r.Header.Get("Authorization"), r.Header.Get("X-API-Key"), r.URL.Query().Get("key"), user, pass,
+		r.Header.Get("X-Signature"), r.Header.Get("X-Timestamp"), r.Header.Get("X-Key-Id"), r.URL.RequestURI(), body)
+}
+
+func TestAPIConnectorStaticAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected map[string]interface{}
+	}{
+		{
+			name:     "bearer",
+			config:   Config{Options: map[string]interface{}{"auth": "bearer", "auth_token": "t0ken"}},
+			expected: map[string]interface{}{"authorization": "Bearer t0ken"},
+		},
+		{
+			name:     "bearer from password",
+			config:   Config{Password: "pw-token", Options: map[string]interface{}{"auth": "bearer"}},
+			expected: map[string]interface{}{"authorization": "Bearer pw-token"},
+		},
+		{
+			name:     "api key header",
+			config:   Config{Options: map[string]interface{}{"auth": "api_key", "api_key": "k3y"}},
+			expected: map[string]interface{}{"api_key": "k3y", "key_param": ""},
+		},
+		{
+			name:     "api key param",
+			config:   Config{Options: map[string]interface{}{"auth": "api_key", "api_key": "k3y", "api_key_param": "key"}},
+			expected: map[string]interface{}{"api_key": "", "key_param": "k3y", "uri": "/items?key=k3y&page=2"},
+		},
+		{
+			name:     "basic",
+			config:   Config{Username: "ada", Password: "lovelace", Options: map[string]interface{}{"auth": "basic"}},
+			expected: map[string]interface{}{"user": "ada", "pass": "lovelace"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(authEcho))
+			defer server.Close()
+			config := tt.config
+			config.BaseURL = server.URL
+			connector := NewAPIConnector(&config)
+			require.NoError(t, connector.Connect(context.Background()))
+
+			rows, err := connector.Query(context.Background(), "/items", map[string]interface{}{"page": 2})
+			require.NoError(t, err)
+			require.Len(t, rows, 1)
+			for k, v := range tt.expected {
+				assert.Equal(t, v, rows[0][k], k)
+			}
+		})
+	}
+}
+
+func TestAPIConnectorAuthConfigErrors(t *testing.T) {
+	for _, options := range []map[string]interface{}{
+		{"auth": "kerberos"},
+		{"auth": "bearer"},
+		{"auth": "basic"},
+		{"auth": "oauth2", "oauth2_client_id": "id", "oauth2_client_secret": "secret"},
+		{"auth": "hmac", "hmac_secret": "s", "hmac_algorithm": "md5"},
+	} {
+		connector := NewAPIConnector(&Config{BaseURL: "http://localhost", Options: options})
+		err := connector.Connect(context.Background())
+		assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration), "%v: %v", options, err)
+	}
+}
+
+func TestAPIConnectorHMACAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(authEcho))
+	defer server.Close()
+	connector := NewAPIConnector(&Config{BaseURL: server.URL, Username: "key-1", Options: map[string]interface{}{
+		"auth":        "hmac",
+		"hmac_secret": "signing-secret",
+	}})
+	require.NoError(t, connector.Connect(context.Background()))
+	connector.auth.(*hmacAuth).now = func() time.Time { return time.Unix(1714521600, 0) }
+
+	rows, err := connector.Query(context.Background(), "/orders", APIRequestOptions{
+		Method: http.MethodPost,
+		Params: map[string]interface{}{"status": "open"},
+		Body:   map[string]interface{}{"id": 7},
+	})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+
+	bodyHash := sha256.Sum256([]byte(`{"id":7}`))
+	mac := hmac.New(sha256.New, []byte("signing-secret"))
+	mac.Write([]byte("POST\n/orders?status=open\n1714521600\n" + hex.EncodeToString(bodyHash[:])))
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), rows[0]["signature"])
+	assert.Equal(t, "1714521600", rows[0]["timestamp"])
+	assert.Equal(t, "key-1", rows[0]["key_id"])
+}
+
+func TestAPIConnectorOAuth2(t *testing.T) {
+	oauth := newFakeOAuthServer(t)
+	var revoked atomic.Value
+	revoked.Store("")
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer token-") || auth == "Bearer "+revoked.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `[{"token": %q}]`, strings.TrimPrefix(auth, "Bearer "))
+	}))
+	defer api.Close()
+
+	connector := NewAPIConnector(&Config{BaseURL: api.URL, Options: map[string]interface{}{
+		"auth":                 "oauth2",
+		"oauth2_token_url":     oauth.URL,
+		"oauth2_client_id":     "reporting",
+		"oauth2_client_secret": "s3cret",
+		"oauth2_scopes":        "read:orders, read:customers",
+	}})
+	require.NoError(t, connector.Connect(context.Background()))
+	auth := connector.auth.(*oauth2Auth)
+	now := time.Now()
+	auth.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	query := func() string {
+		t.Helper()
+		rows, err := connector.Query(ctx, "/orders")
+		require.NoError(t, err)
+		require.Len(t, rows, 1)
+		return rows[0]["token"].(string)
+	}
+
+	// The token is cached across requests.
+	assert.Equal(t, "token-1", query())
+	assert.Equal(t, "token-1", query())
+	assert.Equal(t, []string{"client_credentials"}, oauth.grantLog())
+	assert.Equal(t, []string{"read:orders", "read:customers"}, oauth.scopes)
+
+	// It is replaced shortly before it expires.
+	now = now.Add(time.Hour - oauth2ExpiryLeeway + time.Second)
+	assert.Equal(t, "token-2", query())
+
+	// A token revoked early is replaced once the API rejects it.
+	revoked.Store("token-2")
+	assert.Equal(t, "token-3", query())
+	assert.Len(t, oauth.grantLog(), 3)
+
+	// Rejected client credentials are not retried.
+	oauth.mu.Lock()
+	oauth.reject = true
+	oauth.mu.Unlock()
+	auth.invalidate()
+	_, err := connector.Query(ctx, "/orders")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypePermission), "got %v", err)
+	assert.Contains(t, err.Error(), "invalid_client")
+	assert.NotContains(t, err.Error(), "s3cret")
+	assert.Len(t, oauth.grantLog(), 4)
+}
+
+func TestAPIConnectorOAuth2Refresh(t *testing.T) {
+	oauth := newFakeOAuthServer(t)
+	oauth.refresh = true
+	api := httptest.NewServer(http.HandlerFunc(authEcho))
+	defer api.Close()
+
+	connector := NewAPIConnector(&Config{BaseURL: api.URL, Username: "reporting", Password: "s3cret", Options: map[string]interface{}{
+		"auth":               "oauth2",
+		"oauth2_token_url":   oauth.URL,
+		"oauth2_client_auth": "body",
+	}})
+	require.NoError(t, connector.Connect(context.Background()))
+	auth := connector.auth.(*oauth2Auth)
+	now := time.Now()
+	auth.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := connector.Query(ctx, "/orders")
+	require.NoError(t, err)
+	now = now.Add(2 * time.Hour)
+	rows, err := connector.Query(ctx, "/orders")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token-2", rows[0]["authorization"])
+	assert.Equal(t, []string{"client_credentials", "refresh_token"}, oauth.grantLog())
+
+	// A rejected refresh token falls back to the client credentials grant.
+	auth.refreshToken = "revoked"
+	now = now.Add(2 * time.Hour)
+	rows, err = connector.Query(ctx, "/orders")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token-3", rows[0]["authorization"])
+	assert.Equal(t, []string{"client_credentials", "refresh_token", "refresh_token", "client_credentials"}, oauth.grantLog())
+}
+
+func TestAPIConnectorRedactsSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Some APIs echo the request in their errors.
+		http.Error(w, "bad key "+r.URL.Query().Get("key"), http.StatusForbidden)
+	}))
+	config := &Config{BaseURL: server.URL, Password: "hunter2", Options: map[string]interface{}{
+		"auth":          "api_key",
+		"api_key":       "k3y/with+chars",
+		"api_key_param": "key",
+		"tls_key_file":  "/etc/client.key",
+	}}
+	connector := NewAPIConnector(config)
+	require.NoError(t, connector.Connect(context.Background()))
+
+	_, err := connector.Query(context.Background(), "/items")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "k3y")
+	assert.Contains(t, err.Error(), redactedSecret)
+
+	// Transport errors quote the URL, including the key.
+	server.Close()
+	_, err = connector.Query(context.Background(), "/items")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "k3y")
+
+	formatted := fmt.Sprintf("%v %s", config, *config)
+	assert.NotContains(t, formatted, "hunter2")
+	assert.NotContains(t, formatted, "k3y")
+	assert.Contains(t, formatted, "/etc/client.key")
+	assert.Equal(t, "hunter2", config.Password, "formatting does not modify the config")
+}
@@ -0,0 +1,380 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"pkg/common/errors"
+)
+
+// Pagination strategies for APIConnector, selected with the "pagination" option or
+// APIPagination.Strategy.
+const (
+	// APIPaginationNone fetches a single response.
+	APIPaginationNone = "none"
+	// APIPaginationPage requests numbered pages until one comes back short or empty.
+	APIPaginationPage = "page"
+	// APIPaginationOffset requests pages by offset until one comes back short or empty.
+	APIPaginationOffset = "offset"
+	// APIPaginationCursor passes the cursor found in each response to the next request,
+	// until the response has none.
+	APIPaginationCursor = "cursor"
+	// APIPaginationLink follows the rel="next" URL of the Link header.
+	APIPaginationLink = "link"
+	// APIPaginationNextURL follows a next page URL found in the response body.
+	APIPaginationNextURL = "next_url"
+)
+
+// APIPagination describes how an API returns its results in pages. The defaults come from
+// the connector's config options, named after the fields: pagination, page_param,
+// page_size_param, page_size, start_page, offset_param, cursor_param, cursor_path,
+// next_url_path, max_pages and max_rows.
+type APIPagination struct {
+	// Strategy is one of the APIPagination constants. It defaults to APIPaginationNone.
+	Strategy string
+	// PageParam is the page number parameter of APIPaginationPage. Defaults to "page".
+	PageParam string
+	// StartPage is the number of the first page. Defaults to 1.
+	StartPage int
+	// OffsetParam is the offset parameter of APIPaginationOffset. Defaults to "offset".
+	OffsetParam string
+	// CursorParam is the parameter that passes the cursor. Defaults to "cursor".
+	CursorParam string
+	// CursorPath selects the next cursor in a response, such as "$.meta.next_cursor".
+	CursorPath string
+	// NextURLPath selects the next page URL in a response, such as "$.links.next".
+	NextURLPath string
+	// PageSize, if set, is sent in PageSizeParam, and a page with fewer records is the last.
+	PageSize int
+	// PageSizeParam is the page size parameter. Defaults to "limit" for APIPaginationOffset and
+	// APIPaginationCursor, and "page_size" otherwise.
+	PageSizeParam string
+	// MaxPages caps the number of pages fetched. Zero means no limit.
+	MaxPages int
+	// MaxRows caps the number of records returned. Zero means no limit.
+	MaxRows int
+}
+
+// apiPagination returns the pagination configured by the connector's options, overridden
+// by the non-zero fields of override.
+func (c *APIConnector) apiPagination(override *APIPagination) (APIPagination, error) {
+	var p APIPagination
+	p.Strategy, _ = c.config.option("pagination")
+	p.PageParam, _ = c.config.option("page_param")
+	p.OffsetParam, _ = c.config.option("offset_param")
+	p.CursorParam, _ = c.config.option("cursor_param")
+	p.CursorPath, _ = c.config.option("cursor_path")
+	p.NextURLPath, _ = c.config.option("next_url_path")
+	p.PageSizeParam, _ = c.config.option("page_size_param")
+	for _, f := range []struct {
+		key string
+		dst *int
+	}{{"page_size", &p.PageSize}, {"start_page", &p.StartPage}, {"max_pages", &p.MaxPages}, {"max_rows", &p.MaxRows}} {
+		n, err := c.config.intOption(f.key, 0)
+		if err != nil {
+			return p, err
+		}
+		*f.dst = n
+	}
+
+	if o := override; o != nil {
+		for _, f := range []struct{ dst, src *string }{
+			{&p.Strategy, &o.Strategy}, {&p.PageParam, &o.PageParam}, {&p.OffsetParam, &o.OffsetParam},
+			{&p.CursorParam, &o.CursorParam}, {&p.CursorPath, &o.CursorPath}, {&p.NextURLPath, &o.NextURLPath},
+			{&p.PageSizeParam, &o.PageSizeParam},
+		} {
+			if *f.src != "" {
+				*f.dst = *f.src
+			}
+		}
+		for _, f := range []struct{ dst, src *int }{
+			{&p.PageSize, &o.PageSize}, {&p.StartPage, &o.StartPage}, {&p.MaxPages, &o.MaxPages}, {&p.MaxRows, &o.MaxRows},
+		} {
+			if *f.src != 0 {
+				*f.dst = *f.src
+			}
+		}
+	}
+
+	p.Strategy = strings.ToLower(p.Strategy)
+	if p.Strategy == "" {
+		p.Strategy = APIPaginationNone
+	}
+	p.PageParam = orDefault(p.PageParam, "page")
+	p.OffsetParam = orDefault(p.OffsetParam, "offset")
+	p.CursorParam = orDefault(p.CursorParam, "cursor")
+	if p.StartPage == 0 {
+		p.StartPage = 1
+	}
+	if p.Strategy == APIPaginationOffset || p.Strategy == APIPaginationCursor {
+		p.PageSizeParam = orDefault(p.PageSizeParam, "limit")
+	} else {
+		p.PageSizeParam = orDefault(p.PageSizeParam, "page_size")
+	}
+
+	invalid := func(format string, args ...interface{}) (APIPagination, error) {
+		return p, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf(format, args...), nil)
+	}
+	switch p.Strategy {
+	case APIPaginationNone, APIPaginationPage, APIPaginationOffset, APIPaginationLink:
+	case APIPaginationCursor:
+		if p.CursorPath == "" {
+			return invalid("cursor pagination requires cursor_path")
+		}
+	case APIPaginationNextURL:
+		if p.NextURLPath == "" {
+			return invalid("next_url pagination requires next_url_path")
+		}
+	default:
+		return invalid("unsupported pagination strategy %q", p.Strategy)
+	}
+	if p.PageSize < 0 || p.MaxPages < 0 || p.MaxRows < 0 {
+		return invalid("page_size, max_pages and max_rows cannot be negative")
+	}
+	return p, nil
+}
+
+// Stream sends a request to the API and returns an iterator over its records, one block per
+// page. The arguments are the same as for Query, and the pages are followed as described by
+// the connector's pagination options, or by an APIPagination in the APIRequestOptions.
+//
+// Example:
+//
+//	it, err := connector.Stream(ctx, "/orders", APIRequestOptions{
+//	    Pagination: &APIPagination{Strategy: APIPaginationCursor, CursorPath: "$.meta.next", MaxRows: 10000},
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	defer it.Close()
+//	for {
+//	    rows, err := it.Next(ctx)
+//	    if err == io.EOF {
+//	        break
+//	    }
+//	    if err != nil {
+//	        return err
+//	    }
+//	    process(rows)
+//	}
+func (c *APIConnector) Stream(ctx context.Context, query string, args ...interface{}) (RowIterator, error) {
+	if c.config.IsWebSocket {
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, "streaming is not supported for WebSocket connections", nil)
+	}
+
+	req, err := newAPIRequest(http.MethodGet, args)
+	if err != nil {
+		return nil, err
+	}
+	return c.streamHTTP(query, req)
+}
+
+// streamHTTP returns an iterator over the pages of a request.
+func (c *APIConnector) streamHTTP(query string, req APIRequestOptions) (RowIterator, error) {
+	paging, err := c.apiPagination(req.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	target, err := c.requestURL(query, req.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	it := &apiPageIterator{connector: c, req: req, paging: paging, next: target, page: paging.StartPage}
+	it.setPageParams(target)
+	return it, nil
+}
+
+// apiPageIterator fetches the pages of a request as they are read.
+type apiPageIterator struct {
+	connector *APIConnector
+	req       APIRequestOptions
+	paging    APIPagination
+	// next is the URL of the next page, or nil after the last page.
+	next   *url.URL
+	page   int
+	offset int
+	pages  int
+	rows   int
+}
+
+func (it *apiPageIterator) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	for it.next != nil {
+		if it.paging.MaxPages > 0 && it.pages >= it.paging.MaxPages {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		current := it.next
+		result, rows, header, err := it.connector.fetchRecords(ctx, current, it.req)
+		if err != nil {
+			return nil, err
+		}
+		it.pages++
+		if err := it.advance(current, result, rows, header); err != nil {
+			return nil, err
+		}
+
+		if it.paging.MaxRows > 0 && it.rows+len(rows) >= it.paging.MaxRows {
+			rows = rows[:it.paging.MaxRows-it.rows]
+			it.next = nil
+		}
+		it.rows += len(rows)
+		if len(rows) > 0 {
+			return rows, nil
+		}
+	}
+	it.next = nil
+	return nil, io.EOF
+}
+
+// advance sets the URL of the page after current, or nil if current is the last.
+func (it *apiPageIterator) advance(current *url.URL, result interface{}, rows []map[string]interface{}, header http.Header) error {
+	p := it.paging
+	lastPage := len(rows) == 0 || (p.PageSize > 0 && len(rows) < p.PageSize)
+
+	switch p.Strategy {
+	case APIPaginationPage, APIPaginationOffset:
+		if lastPage {
+			it.next = nil
+			return nil
+		}
+		it.page++
+		it.offset += len(rows)
+		next := *current
+		it.setPageParams(&next)
+		it.next = &next
+
+	case APIPaginationCursor:
+		cursor, err := it.selectString(result, p.CursorPath)
+		if err != nil || cursor == "" || len(rows) == 0 {
+			it.next = nil
+			return err
+		}
+		next := *current
+		params := next.Query()
+		if params.Get(p.CursorParam) == cursor {
+			// A cursor that does not move would fetch the same page forever.
+			it.next = nil
+			return nil
+		}
+		params.Set(p.CursorParam, cursor)
+		next.RawQuery = params.Encode()
+		it.next = &next
+
+	case APIPaginationLink:
+		return it.follow(current, parseLinkNext(header.Values("Link")))
+
+	case APIPaginationNextURL:
+		link, err := it.selectString(result, p.NextURLPath)
+		if err != nil {
+			return err
+		}
+		return it.follow(current, link)
+
+	default:
+		it.next = nil
+	}
+	return nil
+}
+
+// setPageParams sets the page, offset and size parameters on target. It is not called for
+// the pages after the first of the link strategies, whose URLs carry their own parameters.
+func (it *apiPageIterator) setPageParams(target *url.URL) {
+	p := it.paging
+	params := target.Query()
+	switch p.Strategy {
+	case APIPaginationPage:
+		params.Set(p.PageParam, strconv.Itoa(it.page))
+	case APIPaginationOffset:
+		params.Set(p.OffsetParam, strconv.Itoa(it.offset))
+	}
+	if p.PageSize > 0 && params.Get(p.PageSizeParam) == "" {
+		params.Set(p.PageSizeParam, strconv.Itoa(p.PageSize))
+	}
+	target.RawQuery = params.Encode()
+}
+
+// follow sets the next page to link, resolved against the current page. Links to another
+// host are refused, since they would receive the connector's credentials.
+func (it *apiPageIterator) follow(current *url.URL, link string) error {
+	if link == "" {
+		it.next = nil
+		return nil
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("invalid next page URL %q", link), err)
+	}
+	next := current.ResolveReference(ref)
+	if next.Scheme != current.Scheme || next.Host != current.Host {
+		return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("next page URL %s is not on %s", it.connector.redact(next.Redacted()), current.Host), nil)
+	}
+	if *next == *current {
+		it.next = nil
+		return nil
+	}
+	it.next = next
+	return nil
+}
+
+// selectString returns the string or number at path in a response, or "" if it is missing
+// or null.
+func (it *apiPageIterator) selectString(result interface{}, path string) (string, error) {
+	selector, err := parseJSONPath(path)
+	if err != nil {
+		return "", err
+	}
+	v, ok := selector.Select(result)
+	if !ok {
+		return "", nil
+	}
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("%s in the response is a %T, not a string", path, v), nil)
+	}
+}
+
+func (it *apiPageIterator) Close() error {
+	it.next = nil
+	return nil
+}
+
+// parseLinkNext returns the target of the rel="next" link in Link header values, as
+// described in RFC 8288, or "" if there is none.
+func parseLinkNext(values []string) string {
+	for _, value := range values {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				name, rel, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+					continue
+				}
+				for _, r := range strings.Fields(strings.Trim(strings.TrimSpace(rel), `"`)) {
+					if strings.EqualFold(r, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
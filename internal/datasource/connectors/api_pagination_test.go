@@ -0,0 +1,251 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pagedAPI serves 25 items under each pagination style, and records the request URIs.
+type pagedAPI struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+}
+
+const pagedItems = 25
+
+func newPagedAPI(t *testing.T) *pagedAPI {
+	api := &pagedAPI{}
+	items := func(from, to int) []map[string]interface{} {
+		if to > pagedItems {
+			to = pagedItems
+		}
+		rows := []map[string]interface{}{}
+		for i := from; i < to; i++ {
+			rows = append(rows, map[string]interface{}{"id": i})
+		}
+		return rows
+	}
+	intParam := func(r *http.Request, name string, def int) int {
+		if n, err := strconv.Atoi(r.URL.Query().Get(name)); err == nil {
+			return n
+		}
+		return def
+	}
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		json.NewEncoder(w).Encode(v)
+	}
+
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		api.requests = append(api.requests, r.URL.RequestURI())
+		api.mu.Unlock()
+
+		switch r.URL.Path {
+		case "/pages":
+			size := intParam(r, "page_size", 10)
+			page := intParam(r, "page", 1)
+			writeJSON(w, items((page-1)*size, page*size))
+		case "/offsets":
+			offset, limit := intParam(r, "offset", 0), intParam(r, "limit", 10)
+			writeJSON(w, map[string]interface{}{"data": items(offset, offset+limit)})
+		case "/cursors":
+			from := intParam(r, "after", 0)
+			body := map[string]interface{}{"items": items(from, from+10), "meta": map[string]interface{}{"next": nil}}
+			if from+10 < pagedItems {
+				body["meta"] = map[string]interface{}{"next": from + 10}
+			}
+			writeJSON(w, body)
+		case "/links":
+			from := intParam(r, "from", 0)
+			if from+10 < pagedItems {
+				w.Header().Add("Link", fmt.Sprintf(`</links?from=%d>; rel="next", </links?from=20>; rel="last"`, from+10))
+			}
+			writeJSON(w, items(from, from+10))
+		case "/next":
+			from := intParam(r, "from", 0)
+			body := map[string]interface{}{"results": items(from, from+10)}
+			if from+10 < pagedItems {
+				body["next"] = fmt.Sprintf("%s/next?from=%d", api.URL, from+10)
+			}
+			writeJSON(w, body)
+		case "/elsewhere":
+			writeJSON(w, map[string]interface{}{"results": items(0, 10), "next": "https://example.com/next?from=10"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+func (api *pagedAPI) requestLog() []string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return append([]string(nil), api.requests...)
+}
+
+func ids(rows []map[string]interface{}) []int {
+	out := make([]int, len(rows))
+	for i, row := range rows {
+		out[i] = int(row["id"].(float64))
+	}
+	return out
+}
+
+func TestAPIConnectorPagination(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		options  map[string]interface{}
+		requests []string
+	}{
+		{
+			name:     "page",
+			path:     "/pages",
+			options:  map[string]interface{}{"pagination": "page", "page_size": 10},
+			requests: []string{"/pages?page=1&page_size=10", "/pages?page=2&page_size=10", "/pages?page=3&page_size=10"},
+		},
+		{
+			name:     "offset",
+			path:     "/offsets",
+			options:  map[string]interface{}{"pagination": "offset", "page_size": 10, "records_path": "$.data"},
+			requests: []string{"/offsets?limit=10&offset=0", "/offsets?limit=10&offset=10", "/offsets?limit=10&offset=20"},
+		},
+		{
+			name:     "cursor",
+			path:     "/cursors",
+			options:  map[string]interface{}{"pagination": "cursor", "cursor_param": "after", "cursor_path": "$.meta.next", "records_path": "items"},
+			requests: []string{"/cursors", "/cursors?after=10", "/cursors?after=20"},
+		},
+		{
+			name:     "link",
+			path:     "/links",
+			options:  map[string]interface{}{"pagination": "link"},
+			requests: []string{"/links", "/links?from=10", "/links?from=20"},
+		},
+		{
+			name:     "next url",
+			path:     "/next",
+			options:  map[string]interface{}{"pagination": "next_url", "next_url_path": "$.next", "records_path": "$.results"},
+			requests: []string{"/next", "/next?from=10", "/next?from=20"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newPagedAPI(t)
+			connector := NewAPIConnector(&Config{BaseURL: api.URL, Options: tt.options})
+			require.NoError(t, connector.Connect(context.Background()))
+
+			rows, err := connector.Query(context.Background(), tt.path)
+			require.NoError(t, err)
+			require.Len(t, rows, pagedItems)
+			assert.Equal(t, 0, ids(rows)[0])
+			assert.Equal(t, pagedItems-1, ids(rows)[pagedItems-1])
+			assert.Equal(t, tt.requests, api.requestLog())
+		})
+	}
+}
+
+func TestAPIConnectorStreamPages(t *testing.T) {
+	api := newPagedAPI(t)
+	connector := NewAPIConnector(&Config{BaseURL: api.URL, Options: map[string]interface{}{"pagination": "link"}})
+	require.NoError(t, connector.Connect(context.Background()))
+	ctx := context.Background()
+
+	it, err := connector.Stream(ctx, "/links")
+	require.NoError(t, err)
+	defer it.Close()
+
+	// Pages are fetched as they are read.
+	block, err := it.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, ids(block))
+	assert.Len(t, api.requestLog(), 1)
+
+	var sizes []int
+	for {
+		block, err := it.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		sizes = append(sizes, len(block))
+	}
+	assert.Equal(t, []int{10, 5}, sizes)
+	_, err = it.Next(ctx)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestAPIConnectorPaginationCaps(t *testing.T) {
+	api := newPagedAPI(t)
+	connector := NewAPIConnector(&Config{BaseURL: api.URL, Options: map[string]interface{}{"pagination": "page", "page_size": 10, "max_pages": 2}})
+	require.NoError(t, connector.Connect(context.Background()))
+	ctx := context.Background()
+
+	rows, err := connector.Query(ctx, "/pages")
+	require.NoError(t, err)
+	assert.Len(t, rows, 20)
+	assert.Len(t, api.requestLog(), 2)
+
+	// Per-request pagination overrides the connector options.
+	rows, err = connector.Query(ctx, "/pages", APIRequestOptions{Pagination: &APIPagination{PageSize: 4, MaxRows: 6}})
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, ids(rows))
+	assert.Equal(t, []string{"/pages?page=1&page_size=4", "/pages?page=2&page_size=4"}, api.requestLog()[2:])
+}
+
+func TestAPIConnectorPaginationErrors(t *testing.T) {
+	api := newPagedAPI(t)
+	ctx := context.Background()
+
+	for _, options := range []map[string]interface{}{
+		{"pagination": "scroll"},
+		{"pagination": "cursor"},
+		{"pagination": "next_url"},
+		{"pagination": "page", "max_rows": -1},
+		{"pagination": "page", "page_size": "ten"},
+	} {
+		connector := NewAPIConnector(&Config{BaseURL: api.URL, Options: options})
+		require.NoError(t, connector.Connect(ctx))
+		_, err := connector.Query(ctx, "/pages")
+		assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration), "%v: %v", options, err)
+	}
+
+	// Next page links to another host would leak credentials, so they are refused.
+	connector := NewAPIConnector(&Config{BaseURL: api.URL, Options: map[string]interface{}{
+		"pagination": "next_url", "next_url_path": "$.next", "records_path": "$.results",
+	}})
+	require.NoError(t, connector.Connect(ctx))
+	_, err := connector.Query(ctx, "/elsewhere")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation), "got %v", err)
+}
+
+func TestParseLinkNext(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{nil, ""},
+		{[]string{`<https://api.example.com/items?page=2>; rel="next"`}, "https://api.example.com/items?page=2"},
+		{[]string{`</items?page=1>; rel="prev", </items?page=3>; rel="next"`}, "/items?page=3"},
+		{[]string{`</items?page=9>; rel=last`, `</items?page=3>; title="more"; REL="next last"`}, "/items?page=3"},
+		{[]string{`</items?page=1>; rel="prev"`}, ""},
+		{[]string{`garbage; rel="next"`}, ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseLinkNext(tt.values), "%v", tt.values)
+	}
+}
@@ -0,0 +1,389 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"pkg/common/errors"
+)
+
+// Topics of APIConnector subscriptions to polled results.
+const (
+	// APIPollSnapshots delivers one event per poll, whose Data holds the polled records in
+	// "records" and their number in "count".
+	APIPollSnapshots = "snapshot"
+	// APIPollChanges delivers one event per record that was added, removed or changed since
+	// the previous poll, identified by a key field. The event's Data is the record with the
+	// kind of change in "_change" and, for changed records, the previous record in "_before".
+	APIPollChanges = "diff"
+)
+
+// Change kinds in the "_change" column of APIPollChanges events.
+const (
+	APIChangeAdded   = "added"
+	APIChangeRemoved = "removed"
+	APIChangeChanged = "changed"
+)
+
+const (
+	APIChangeColumn = "_change"
+	APIBeforeColumn = "_before"
+
+	defaultPollHistory = 10
+)
+
+// APIPollSnapshot is the result of a successful poll.
+type APIPollSnapshot struct {
+	// Seq numbers the successful polls from 1.
+	Seq int64
+	// Time is when the poll completed.
+	Time time.Time
+	// Records holds the polled records.
+	Records []map[string]interface{}
+}
+
+// APIPollStats describes the health of an APIConnector's polling.
+type APIPollStats struct {
+	// Polls is the number of polls made, and Errors the number that failed.
+	Polls  int64
+	Errors int64
+	// ConsecutiveErrors is the number of polls that have failed since the last success.
+	ConsecutiveErrors int64
+	// LastPoll and LastSuccess are when the last poll and the last successful poll completed.
+	LastPoll    time.Time
+	LastSuccess time.Time
+	// LastError is the error of the last failed poll, with secrets redacted.
+	LastError string
+	// LastDuration is how long the last poll took.
+	LastDuration time.Duration
+	// Lag is how long after its scheduled time the last poll completed. It grows when polls
+	// take longer than the interval.
+	Lag time.Duration
+}
+
+// APIPollSubscribeOptions configures a subscription to polled results.
+type APIPollSubscribeOptions struct {
+	// KeyField identifies records across polls for APIPollChanges. Defaults to the poll_key option.
+	KeyField string
+	// BufferSize is the capacity of the Events channel.
+	BufferSize int
+}
+
+// apiPoller polls an endpoint on a ticker, keeps the latest snapshots and hands them to
+// subscribers.
+type apiPoller struct {
+	connector  *APIConnector
+	path       string
+	interval   time.Duration
+	maxHistory int
+	cancel     context.CancelFunc
+	done       chan struct{}
+
+	mu          sync.Mutex
+	seq         int64
+	history     []APIPollSnapshot
+	stats       APIPollStats
+	subscribers map[*apiPollSubscriber]struct{}
+}
+
+// apiPollSubscriber receives the latest snapshot. A subscriber that falls behind skips to the
+// newest snapshot instead of holding up the poller; diffs are taken against the last snapshot
+// it saw, so no change is lost.
+type apiPollSubscriber struct {
+	latest chan APIPollSnapshot
+}
+
+// pollInterval returns the polling interval: the poll_interval option, a duration such as
+// "500ms", or PollingIntervalSeconds.
+func (c *Config) pollInterval() (time.Duration, error) {
+	if s, ok := c.option("poll_interval"); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return 0, errors.NewError(errors.ErrorTypeConfiguration, "option poll_interval must be a positive duration", err)
+		}
+		return d, nil
+	}
+	return time.Duration(c.PollingIntervalSeconds) * time.Second, nil
+}
+
+// startPolling begins a routine that polls the poll_path endpoint immediately and then at
+// every interval, until the connector is closed. At most poll_history snapshots are kept.
+func (c *APIConnector) startPolling(ctx context.Context, interval time.Duration) error {
+	maxHistory, err := c.config.intOption("poll_history", defaultPollHistory)
+	if err != nil {
+		return err
+	}
+	path, _ := c.config.option("poll_path")
+
+	// Polling outlives the context Connect was called with, and stops when the connector closes.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	p := &apiPoller{
+		connector:   c,
+		path:        path,
+		interval:    interval,
+		maxHistory:  maxHistory,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		subscribers: map[*apiPollSubscriber]struct{}{},
+	}
+	c.pollerMu.Lock()
+	c.poller = p
+	c.pollerMu.Unlock()
+	go p.run(ctx)
+	return nil
+}
+
+// currentPoller returns the connector's poller, or nil if it does not poll or was closed.
+func (c *APIConnector) currentPoller() *apiPoller {
+	c.pollerMu.Lock()
+	defer c.pollerMu.Unlock()
+	return c.poller
+}
+
+func (p *apiPoller) run(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.poll(ctx, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case scheduled := <-ticker.C:
+			p.poll(ctx, scheduled)
+		}
+	}
+}
+
+// poll fetches the records once, and records and publishes the result.
+func (p *apiPoller) poll(ctx context.Context, scheduled time.Time) {
+	start := time.Now()
+	rows, err := p.connector.queryHTTP(ctx, p.path, APIRequestOptions{Method: http.MethodGet})
+	end := time.Now()
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.stats.Polls++
+	p.stats.LastPoll = end
+	p.stats.LastDuration = end.Sub(start)
+	p.stats.Lag = end.Sub(scheduled)
+	if err != nil {
+		p.stats.Errors++
+		p.stats.ConsecutiveErrors++
+		p.stats.LastError = p.connector.redact(err.Error())
+		p.mu.Unlock()
+		log.Printf("Polling error: %s", p.connector.redact(err.Error()))
+		return
+	}
+
+	p.stats.ConsecutiveErrors = 0
+	p.stats.LastSuccess = end
+	p.seq++
+	snapshot := APIPollSnapshot{Seq: p.seq, Time: end, Records: rows}
+	p.history = append(p.history, snapshot)
+	if len(p.history) > p.maxHistory {
+		p.history = append([]APIPollSnapshot(nil), p.history[len(p.history)-p.maxHistory:]...)
+	}
+	subscribers := make([]*apiPollSubscriber, 0, len(p.subscribers))
+	for s := range p.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	p.mu.Unlock()
+
+	for _, s := range subscribers {
+		s.deliver(snapshot)
+	}
+}
+
+// deliver replaces any snapshot the subscriber has not yet taken. Only the poller calls it.
+func (s *apiPollSubscriber) deliver(snapshot APIPollSnapshot) {
+	select {
+	case <-s.latest:
+	default:
+	}
+	s.latest <- snapshot
+}
+
+// stop ends polling and waits for the routine to exit.
+func (p *apiPoller) stop() {
+	p.cancel()
+	<-p.done
+}
+
+// PollHistory returns the retained snapshots, oldest first. It returns nil if the connector
+// does not poll.
+func (c *APIConnector) PollHistory() []APIPollSnapshot {
+	p := c.currentPoller()
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]APIPollSnapshot(nil), p.history...)
+}
+
+// PollStats returns the polling metrics. It returns the zero value if the connector does not poll.
+func (c *APIConnector) PollStats() APIPollStats {
+	p := c.currentPoller()
+	if p == nil {
+		return APIPollStats{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// subscribePolling starts a subscription to the polled results. A snapshot subscription first
+// receives the latest snapshot, if there is one, and a diff subscription reports changes
+// against it.
+func (c *APIConnector) subscribePolling(ctx context.Context, topic string, args []interface{}) (Subscription, error) {
+	p := c.currentPoller()
+	if p == nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "polling subscriptions require a polling interval", nil)
+	}
+
+	var opts APIPollSubscribeOptions
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case APIPollSubscribeOptions:
+			opts = v
+		case *APIPollSubscribeOptions:
+			opts = *v
+		default:
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("invalid subscribe option type %T", arg), nil)
+		}
+	}
+	if opts.KeyField == "" {
+		opts.KeyField, _ = c.config.option("poll_key")
+	}
+	switch topic {
+	case "", APIPollSnapshots:
+		topic = APIPollSnapshots
+	case APIPollChanges:
+		if opts.KeyField == "" {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "diff subscriptions require a key field", nil)
+		}
+	default:
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("unsupported polling topic %q", topic), nil)
+	}
+
+	sub, subCtx := newSubscription(ctx, opts.BufferSize)
+	s := &apiPollSubscriber{latest: make(chan APIPollSnapshot, 1)}
+	p.mu.Lock()
+	var previous *APIPollSnapshot
+	if n := len(p.history); n > 0 {
+		previous = &p.history[n-1]
+		if topic == APIPollSnapshots {
+			s.latest <- *previous
+		}
+	}
+	p.subscribers[s] = struct{}{}
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			delete(p.subscribers, s)
+			p.mu.Unlock()
+		}()
+
+		source := c.baseURL + p.path
+		for {
+			var snapshot APIPollSnapshot
+			select {
+			case <-subCtx.Done():
+				sub.finish(subCtx, nil)
+				return
+			case <-p.done:
+				sub.finish(subCtx, nil)
+				return
+			case snapshot = <-s.latest:
+			}
+
+			offset := strconv.FormatInt(snapshot.Seq, 10)
+			if topic == APIPollSnapshots {
+				ev := Event{Source: source, Data: map[string]interface{}{"records": snapshot.Records, "count": len(snapshot.Records)}, Offset: offset, Time: snapshot.Time}
+				if !sub.send(subCtx, ev) {
+					sub.finish(subCtx, nil)
+					return
+				}
+				continue
+			}
+
+			var before []map[string]interface{}
+			if previous != nil {
+				before = previous.Records
+			}
+			for _, change := range diffRecords(before, snapshot.Records, opts.KeyField) {
+				if !sub.send(subCtx, Event{Source: source, Data: change, Offset: offset, Time: snapshot.Time}) {
+					sub.finish(subCtx, nil)
+					return
+				}
+			}
+			previous = &snapshot
+		}
+	}()
+	return sub, nil
+}
+
+// diffRecords compares two snapshots by key field and returns a row for every added, changed
+// and removed record, in that order. Records without the key field are ignored.
+func diffRecords(before, after []map[string]interface{}, keyField string) []map[string]interface{} {
+	index := func(rows []map[string]interface{}) ([]string, map[string]map[string]interface{}) {
+		keys := make([]string, 0, len(rows))
+		byKey := make(map[string]map[string]interface{}, len(rows))
+		for _, row := range rows {
+			v, ok := row[keyField]
+			if !ok || v == nil {
+				continue
+			}
+			key := fmt.Sprintf("%v", v)
+			if _, dup := byKey[key]; !dup {
+				keys = append(keys, key)
+			}
+			byKey[key] = row
+		}
+		return keys, byKey
+	}
+	beforeKeys, beforeRows := index(before)
+	afterKeys, afterRows := index(after)
+
+	change := func(row map[string]interface{}, kind string) map[string]interface{} {
+		out := make(map[string]interface{}, len(row)+2)
+		for k, v := range row {
+			out[k] = v
+		}
+		out[APIChangeColumn] = kind
+		return out
+	}
+
+	var changes []map[string]interface{}
+	for _, key := range afterKeys {
+		row := afterRows[key]
+		old, existed := beforeRows[key]
+		switch {
+		case !existed:
+			changes = append(changes, change(row, APIChangeAdded))
+		case !reflect.DeepEqual(old, row):
+			c := change(row, APIChangeChanged)
+			c[APIBeforeColumn] = old
+			changes = append(changes, c)
+		}
+	}
+	for _, key := range beforeKeys {
+		if _, ok := afterRows[key]; !ok {
+			changes = append(changes, change(beforeRows[key], APIChangeRemoved))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,211 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pollableAPI serves a list of records that tests can replace, or an error status.
+type pollableAPI struct {
+	*httptest.Server
+	mu      sync.Mutex
+	records []map[string]interface{}
+	status  int
+}
+
+func newPollableAPI(t *testing.T, records ...map[string]interface{}) *pollableAPI {
+	api := &pollableAPI{records: records}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		if api.status != 0 {
+			w.WriteHeader(api.status)
+			return
+		}
+		json.NewEncoder(w).Encode(api.records)
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+func (api *pollableAPI) set(status int, records ...map[string]interface{}) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.status = status
+	api.records = records
+}
+
+func newPollingConnector(t *testing.T, api *pollableAPI, options map[string]interface{}) *APIConnector {
+	t.Helper()
+	opts := map[string]interface{}{"poll_interval": "20ms", "poll_path": "/items"}
+	for k, v := range options {
+		opts[k] = v
+	}
+	connector := NewAPIConnector(&Config{BaseURL: api.URL, Options: opts})
+	require.NoError(t, connector.Connect(context.Background()))
+	t.Cleanup(func() { connector.Close(context.Background()) })
+	return connector
+}
+
+func TestAPIConnectorPollSnapshots(t *testing.T) {
+	api := newPollableAPI(t, map[string]interface{}{"id": 1})
+	connector := newPollingConnector(t, api, map[string]interface{}{"poll_history": 3})
+
+	sub, err := connector.Subscribe(context.Background(), APIPollSnapshots)
+	require.NoError(t, err)
+	defer sub.Close()
+
+	ev := nextEvent(t, sub)
+	assert.Equal(t, api.URL+"/items", ev.Source)
+	assert.Equal(t, 1, ev.Data["count"])
+	assert.Equal(t, []map[string]interface{}{{"id": 1.0}}, ev.Data["records"])
+
+	api.set(0, map[string]interface{}{"id": 1}, map[string]interface{}{"id": 2})
+	require.Eventually(t, func() bool {
+		return nextEvent(t, sub).Data["count"] == 2
+	}, 2*time.Second, time.Millisecond)
+
+	require.Eventually(t, func() bool { return len(connector.PollHistory()) == 3 }, 2*time.Second, 5*time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	history := connector.PollHistory()
+	assert.Len(t, history, 3, "history is bounded")
+	assert.Equal(t, history[0].Seq+2, history[2].Seq)
+	assert.Len(t, history[2].Records, 2)
+}
+
+func TestAPIConnectorPollChanges(t *testing.T) {
+	api := newPollableAPI(t,
+		map[string]interface{}{"id": 1, "name": "a"},
+		map[string]interface{}{"id": 2, "name": "b"},
+	)
+	connector := newPollingConnector(t, api, map[string]interface{}{"poll_key": "id"})
+	require.Eventually(t, func() bool { return len(connector.PollHistory()) > 0 }, 2*time.Second, 5*time.Millisecond)
+
+	sub, err := connector.Subscribe(context.Background(), APIPollChanges)
+	require.NoError(t, err)
+	defer sub.Close()
+
+	api.set(0,
+		map[string]interface{}{"id": 2, "name": "B"},
+		map[string]interface{}{"id": 3, "name": "c"},
+	)
+	changes := map[string]map[string]interface{}{}
+	for len(changes) < 3 {
+		ev := nextEvent(t, sub)
+		changes[ev.Data[APIChangeColumn].(string)] = ev.Data
+	}
+	assert.Equal(t, 3.0, changes[APIChangeAdded]["id"])
+	assert.Equal(t, 1.0, changes[APIChangeRemoved]["id"])
+	assert.Equal(t, "B", changes[APIChangeChanged]["name"])
+	assert.Equal(t, map[string]interface{}{"id": 2.0, "name": "b"}, changes[APIChangeChanged][APIBeforeColumn])
+
+	// Polls without changes deliver nothing.
+	select {
+	case ev := <-sub.Events():
+		t.Fatalf("unexpected event %v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestAPIConnectorPollStats(t *testing.T) {
+	api := newPollableAPI(t)
+	api.set(http.StatusInternalServerError)
+	connector := newPollingConnector(t, api, map[string]interface{}{"poll_interval": "10ms"})
+
+	require.Eventually(t, func() bool { return connector.PollStats().Errors > 0 }, 10*time.Second, 10*time.Millisecond)
+	stats := connector.PollStats()
+	assert.Equal(t, stats.Errors, stats.ConsecutiveErrors)
+	assert.Contains(t, stats.LastError, "500")
+	assert.True(t, stats.LastSuccess.IsZero())
+	assert.Positive(t, stats.Lag)
+
+	api.set(0, map[string]interface{}{"id": 1})
+	require.Eventually(t, func() bool { return !connector.PollStats().LastSuccess.IsZero() }, 10*time.Second, 10*time.Millisecond)
+	assert.Zero(t, connector.PollStats().ConsecutiveErrors)
+}
+
+func TestAPIConnectorPollClose(t *testing.T) {
+	api := newPollableAPI(t, map[string]interface{}{"id": 1})
+	connector := newPollingConnector(t, api, nil)
+	sub, err := connector.Subscribe(context.Background(), APIPollSnapshots)
+	require.NoError(t, err)
+
+	// Close used to block forever on an unbuffered stop channel.
+	closed := make(chan error, 1)
+	go func() { closed <- connector.Close(context.Background()) }()
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+
+	for range sub.Events() {
+	}
+	assert.NoError(t, sub.Err())
+	assert.Nil(t, connector.PollHistory())
+}
+
+func TestAPIConnectorPollSubscribeErrors(t *testing.T) {
+	api := newPollableAPI(t)
+	ctx := context.Background()
+
+	connector := NewAPIConnector(&Config{BaseURL: api.URL})
+	require.NoError(t, connector.Connect(ctx))
+	_, err := connector.Subscribe(ctx, APIPollSnapshots)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+
+	connector = newPollingConnector(t, api, nil)
+	_, err = connector.Subscribe(ctx, APIPollChanges)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration), "diff requires a key")
+	_, err = connector.Subscribe(ctx, "everything")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	_, err = connector.Subscribe(ctx, APIPollSnapshots, "id")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+
+	for _, interval := range []string{"often", "0s", "-1s"} {
+		err = NewAPIConnector(&Config{BaseURL: api.URL, Options: map[string]interface{}{"poll_interval": interval}}).Connect(ctx)
+		assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration), interval)
+	}
+}
+
+func TestAPIConnectorPollCloseWhileReading(t *testing.T) {
+	api := newPollableAPI(t)
+	connector := newPollingConnector(t, api, map[string]interface{}{"poll_interval": "5ms"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			connector.PollStats()
+			connector.PollHistory()
+		}
+	}()
+	require.NoError(t, connector.Close(context.Background()))
+	<-done
+	assert.Equal(t, APIPollStats{}, connector.PollStats())
+}
+
+func TestDiffRecords(t *testing.T) {
+	before := []map[string]interface{}{{"id": 1, "v": "a"}, {"id": 2, "v": "b"}, {"v": "no key"}}
+	after := []map[string]interface{}{{"id": 2, "v": "b"}, {"id": 1, "v": "A"}, {"id": 4}}
+	assert.Equal(t, []map[string]interface{}{
+		{"id": 1, "v": "A", APIChangeColumn: APIChangeChanged, APIBeforeColumn: map[string]interface{}{"id": 1, "v": "a"}},
+		{"id": 4, APIChangeColumn: APIChangeAdded},
+	}, diffRecords(before, after, "id"))
+
+	assert.Equal(t, []map[string]interface{}{
+		{"id": 1, "v": "a", APIChangeColumn: APIChangeRemoved},
+		{"id": 2, "v": "b", APIChangeColumn: APIChangeRemoved},
+	}, diffRecords(before, nil, "id"))
+}
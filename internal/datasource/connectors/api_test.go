@@ -0,0 +1,170 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAPIConnector(t *testing.T, handler http.HandlerFunc, options map[string]interface{}) *APIConnector {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	connector := NewAPIConnector(&Config{BaseURL: server.URL, TimeoutSeconds: 5, Options: options})
+	require.NoError(t, connector.Connect(context.Background()))
+	return connector
+}
+
+func TestAPIConnectorQueryRequest(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	connector := newTestAPIConnector(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"data": {"items": [{"id": 1}, {"id": 2}]}, "total": 2}`))
+	}, map[string]interface{}{"header.X-Tenant": "acme", "records_path": "$.data.items"})
+	ctx := context.Background()
+
+	rows, err := connector.Query(ctx, "/users?active=true", map[string]interface{}{"tag": []string{"a", "b"}, "limit": 10})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"id": 1.0}, {"id": 2.0}}, rows)
+	assert.Equal(t, http.MethodGet, got.Method)
+	assert.Equal(t, "/users", got.URL.Path)
+	assert.Equal(t, "true", got.URL.Query().Get("active"))
+	assert.Equal(t, []string{"a", "b"}, got.URL.Query()["tag"])
+	assert.Equal(t, "10", got.URL.Query().Get("limit"))
+	assert.Equal(t, "acme", got.Header.Get("X-Tenant"))
+	assert.Empty(t, gotBody)
+
+	rows, err = connector.Query(ctx, "/search", APIRequestOptions{
+		Method:      "post",
+		Headers:     map[string]string{"X-Tenant": "other"},
+		Body:        map[string]interface{}{"q": "smith"},
+		RecordsPath: "$",
+	})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, 2.0, rows[0]["total"])
+	assert.Equal(t, http.MethodPost, got.Method)
+	assert.Equal(t, "other", got.Header.Get("X-Tenant"))
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"q": "smith"}`, string(gotBody))
+
+	_, err = connector.Query(ctx, "/users", APIRequestOptions{RecordsPath: "$.results"})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeQuery))
+}
+
+func TestAPIConnectorExecute(t *testing.T) {
+	var method string
+	var body map[string]interface{}
+	connector := newTestAPIConnector(t, func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		body = nil
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/users/create":
+			w.Write([]byte(`{"affectedItems": 1}`))
+		case "/users/bulk":
+			w.Write([]byte(`[{"id": 1}, {"id": 2}, {"id": 3}]`))
+		case "/users/42":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}, nil)
+	ctx := context.Background()
+
+	n, err := connector.Execute(ctx, "/users/create", map[string]interface{}{"name": "Ada"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, map[string]interface{}{"name": "Ada"}, body)
+
+	n, err = connector.Execute(ctx, "/users/bulk", []map[string]interface{}{{"name": "a"}, {"name": "b"}, {"name": "c"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	n, err = connector.Execute(ctx, "/users/42", &APIRequestOptions{Method: http.MethodPatch, Body: map[string]interface{}{"name": "Grace"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, http.MethodPatch, method)
+	assert.Equal(t, map[string]interface{}{"name": "Grace"}, body)
+
+	_, err = connector.Execute(ctx, "/users/create", "a", "b")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation))
+}
+
+func TestAPIConnectorStatusErrors(t *testing.T) {
+	tests := []struct {
+		status   int
+		want     errors.ErrorType
+		attempts int32
+	}{
+		{http.StatusBadRequest, errors.ErrorTypeValidation, 1},
+		{http.StatusUnauthorized, errors.ErrorTypePermission, 1},
+		{http.StatusForbidden, errors.ErrorTypePermission, 1},
+		{http.StatusNotFound, errors.ErrorTypeNotFound, 1},
+		{http.StatusConflict, errors.ErrorTypeQuery, 1},
+		{http.StatusInternalServerError, errors.ErrorTypeAPIConnection, 5},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			var attempts int32
+			connector := newTestAPIConnector(t, func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				http.Error(w, "nope", tt.status)
+			}, nil)
+			_, err := connector.Query(context.Background(), "/items")
+			require.Error(t, err)
+			// Retried errors are wrapped once the attempts run out, so match the whole chain.
+			assert.ErrorIs(t, err, &errors.Error{Type: tt.want})
+			assert.Contains(t, err.Error(), "nope")
+			assert.Equal(t, tt.attempts, atomic.LoadInt32(&attempts))
+		})
+	}
+}
+
+func TestAPIConnectorRetryAfter(t *testing.T) {
+	var attempts int32
+	var first, second time.Time
+	connector := newTestAPIConnector(t, func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&attempts, 1) {
+		case 1:
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			second = time.Now()
+			w.Write([]byte(`[{"id": 1}]`))
+		}
+	}, nil)
+
+	rows, err := connector.Query(context.Background(), "/items")
+	require.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	assert.GreaterOrEqual(t, second.Sub(first), 900*time.Millisecond)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	d, ok := parseRetryAfter("3")
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+
+	d, ok = parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.InDelta(t, time.Minute, d, float64(2*time.Second))
+
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("")
+	assert.False(t, ok)
+}
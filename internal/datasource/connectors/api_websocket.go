@@ -0,0 +1,596 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketSubscribeOptions configures a subscription to a WebSocket API.
+type WebSocketSubscribeOptions struct {
+	// SubscribeMessage is sent when the first subscription to the topic starts, and again
+	// after every reconnect. A string is sent as is and other values are encoded as JSON;
+	// "{{topic}}" in either is replaced by the topic. Defaults to the ws_subscribe_message option.
+	SubscribeMessage interface{}
+	// UnsubscribeMessage is sent when the last subscription to the topic is closed. Defaults
+	// to the ws_unsubscribe_message option.
+	UnsubscribeMessage interface{}
+	// Match lists JSON paths and the values they must have for a message to be delivered,
+	// such as {"$.type": "trade"}. Values are compared in their string form.
+	Match map[string]interface{}
+	// RecordsPath selects the records in each message, each of which is delivered as an event.
+	// Defaults to the records_path option; without one, the whole message is a record.
+	RecordsPath string
+	// BufferSize is the capacity of the Events channel. Defaults to WebSocketBufferSize.
+	BufferSize int
+}
+
+// WebSocketMessageColumn holds the text of messages that are not JSON.
+const WebSocketMessageColumn = "message"
+
+// wsClient keeps a WebSocket connection open, reconnecting when it drops, and delivers
+// every message to each of its consumers. Consumers receive messages in order and do not
+// compete for them; a consumer that falls behind its buffer holds up the others until it
+// catches up or is closed.
+type wsClient struct {
+	connector    *APIConnector
+	topicPath    jsonPath
+	pingInterval time.Duration
+	pingMessage  []byte
+	cancel       context.CancelFunc
+	done         chan struct{}
+
+	// writeMu serializes writes, since a connection supports one writer at a time.
+	writeMu sync.Mutex
+
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	seq       int64
+	consumers map[*wsConsumer]struct{}
+	topics    map[string]*wsTopic
+}
+
+// wsTopic counts the subscriptions to a topic and holds the messages that start and stop it.
+type wsTopic struct {
+	refs        int
+	subscribe   []byte
+	unsubscribe []byte
+}
+
+// wsConsumer receives the records of matching messages through handle, which returns false
+// once the consumer wants no more. The reader holds mu while delivering, so that a consumer
+// is not finished in the middle of a delivery.
+type wsConsumer struct {
+	topic       string
+	match       map[string]jsonPath
+	values      map[string]string
+	recordsPath jsonPath
+	handle      func(records []map[string]interface{}, seq int64) bool
+	mu          sync.Mutex
+}
+
+// connectWebSocket dials the API and starts the routine that reads messages, sends heartbeats
+// and reconnects. The options are:
+//   - ws_subscribe_message, ws_unsubscribe_message: The default messages that start and stop a topic
+//   - ws_topic_path: A JSON path to the topic of a message, used to deliver messages to the
+//     subscriptions to their topic only
+//   - ws_ping_interval: How often to send a heartbeat, such as "30s". The connection is
+//     considered dead if nothing arrives for two intervals
+//   - ws_ping_message: A text heartbeat to send instead of a WebSocket ping frame, such as {"op":"ping"}
+func (c *APIConnector) connectWebSocket(ctx context.Context) error {
+	ws := &wsClient{
+		connector: c,
+		done:      make(chan struct{}),
+		consumers: map[*wsConsumer]struct{}{},
+		topics:    map[string]*wsTopic{},
+	}
+	if s, ok := c.config.option("ws_topic_path"); ok {
+		path, err := parseJSONPath(s)
+		if err != nil {
+			return err
+		}
+		ws.topicPath = path
+	}
+	if s, ok := c.config.option("ws_ping_interval"); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return errors.NewError(errors.ErrorTypeConfiguration, "option ws_ping_interval must be a positive duration", err)
+		}
+		ws.pingInterval = d
+	}
+	if s, ok := c.config.option("ws_ping_message"); ok {
+		ws.pingMessage = []byte(s)
+	}
+
+	conn, err := ws.dial(ctx)
+	if err != nil {
+		return err
+	}
+	ws.conn = conn
+
+	// The connection outlives the context Connect was called with, and closes with the connector.
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	ws.cancel = cancel
+	c.ws = ws
+	go ws.run(runCtx, conn)
+	return nil
+}
+
+// dial opens a connection. The handshake is an HTTP request, so it carries the same
+// credentials as other requests.
+func (ws *wsClient) dial(ctx context.Context) (*websocket.Conn, error) {
+	c := ws.connector
+	dialer := websocket.Dialer{
+		HandshakeTimeout: time.Duration(c.config.TimeoutSeconds) * time.Second,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL, nil)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "invalid WebSocket URL", err)
+	}
+	if c.auth != nil {
+		if err := c.auth.authenticate(ctx, req, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, _, err := dialer.DialContext(ctx, req.URL.String(), req.Header)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeAPIConnection, "failed to connect to WebSocket", err)
+	}
+	return conn, nil
+}
+
+// run reads messages and hands them to the consumers until ctx is cancelled, reconnecting
+// with exponential backoff whenever the connection fails.
+func (ws *wsClient) run(ctx context.Context, conn *websocket.Conn) {
+	defer close(ws.done)
+	c := ws.connector
+
+	for {
+		stopHeartbeat := ws.startHeartbeat(ctx, conn)
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("WebSocket read error: %s", c.redact(err.Error()))
+				}
+				break
+			}
+			ws.extendDeadline(conn)
+			ws.dispatch(ctx, message)
+		}
+		stopHeartbeat()
+		conn.Close()
+
+		if conn = ws.reconnect(ctx); conn == nil {
+			return
+		}
+	}
+}
+
+// reconnect dials until it succeeds or ctx is cancelled, and restarts the active topics on
+// the new connection. It returns nil if ctx is cancelled.
+func (ws *wsClient) reconnect(ctx context.Context) *websocket.Conn {
+	c := ws.connector
+	ws.mu.Lock()
+	ws.conn = nil
+	ws.mu.Unlock()
+
+	backoff := c.reconnectBackoff
+	for {
+		log.Printf("Attempting to reconnect WebSocket in %v", backoff)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+
+		conn, err := ws.dial(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("Failed to reconnect WebSocket: %s", c.redact(err.Error()))
+			backoff *= 2
+			if backoff > c.maxReconnectWait {
+				backoff = c.maxReconnectWait
+			}
+			continue
+		}
+		log.Println("Successfully reconnected WebSocket")
+
+		ws.mu.Lock()
+		if ctx.Err() != nil {
+			// The connector closed while dialing.
+			ws.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		ws.conn = conn
+		topics := make([]string, 0, len(ws.topics))
+		for topic := range ws.topics {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+		var messages [][]byte
+		for _, topic := range topics {
+			if t := ws.topics[topic]; t.subscribe != nil {
+				messages = append(messages, t.subscribe)
+			}
+		}
+		ws.mu.Unlock()
+		for _, message := range messages {
+			if err := ws.write(conn, websocket.TextMessage, message); err != nil {
+				log.Printf("Failed to resubscribe WebSocket: %s", c.redact(err.Error()))
+			}
+		}
+		return conn
+	}
+}
+
+// startHeartbeat sends a ping every interval while the connection is in use, and returns a
+// function that stops it.
+func (ws *wsClient) startHeartbeat(ctx context.Context, conn *websocket.Conn) func() {
+	if ws.pingInterval <= 0 {
+		return func() {}
+	}
+	ws.extendDeadline(conn)
+	conn.SetPongHandler(func(string) error {
+		ws.extendDeadline(conn)
+		return nil
+	})
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ws.pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				var err error
+				if ws.pingMessage != nil {
+					err = ws.write(conn, websocket.TextMessage, ws.pingMessage)
+				} else {
+					err = ws.write(conn, websocket.PingMessage, nil)
+				}
+				if err != nil {
+					// The reader notices the broken connection and reconnects.
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// extendDeadline gives the server two heartbeat intervals to send something.
+func (ws *wsClient) extendDeadline(conn *websocket.Conn) {
+	if ws.pingInterval > 0 {
+		conn.SetReadDeadline(time.Now().Add(2 * ws.pingInterval))
+	}
+}
+
+func (ws *wsClient) write(conn *websocket.Conn, messageType int, data []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if timeout := ws.connector.config.TimeoutSeconds; timeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(time.Duration(timeout) * time.Second))
+	}
+	return conn.WriteMessage(messageType, data)
+}
+
+// send writes a message on the current connection. Messages sent while reconnecting are
+// dropped; topic messages are sent again once the connection is back.
+func (ws *wsClient) send(message []byte) error {
+	ws.mu.Lock()
+	conn := ws.conn
+	ws.mu.Unlock()
+	if conn == nil {
+		return errors.NewError(errors.ErrorTypeAPIConnection, "WebSocket is reconnecting", nil)
+	}
+	if err := ws.write(conn, websocket.TextMessage, message); err != nil {
+		return errors.NewError(errors.ErrorTypeAPIConnection, "failed to send WebSocket message", err)
+	}
+	return nil
+}
+
+// dispatch decodes a message and hands its records to every consumer it matches.
+func (ws *wsClient) dispatch(ctx context.Context, message []byte) {
+	var decoded interface{}
+	if err := json.Unmarshal(message, &decoded); err != nil {
+		decoded = map[string]interface{}{WebSocketMessageColumn: string(message)}
+	}
+
+	var topic string
+	if ws.topicPath != nil {
+		if v, ok := ws.topicPath.Select(decoded); ok {
+			topic = fmt.Sprintf("%v", v)
+		}
+	}
+
+	ws.mu.Lock()
+	ws.seq++
+	seq := ws.seq
+	consumers := make([]*wsConsumer, 0, len(ws.consumers))
+	for consumer := range ws.consumers {
+		consumers = append(consumers, consumer)
+	}
+	ws.mu.Unlock()
+
+	for _, consumer := range consumers {
+		if ctx.Err() != nil {
+			return
+		}
+		if ws.topicPath != nil && consumer.topic != "" && consumer.topic != topic {
+			continue
+		}
+		if !consumer.matches(decoded) {
+			continue
+		}
+		records := decoded
+		if consumer.recordsPath != nil {
+			selected, ok := consumer.recordsPath.Select(decoded)
+			if !ok {
+				continue
+			}
+			records = selected
+		}
+
+		consumer.mu.Lock()
+		delivered := consumer.handle(jsonRecords(records), seq)
+		consumer.mu.Unlock()
+		if !delivered {
+			ws.removeConsumer(consumer)
+		}
+	}
+}
+
+func (consumer *wsConsumer) matches(message interface{}) bool {
+	for key, path := range consumer.match {
+		v, ok := path.Select(message)
+		if !ok || fmt.Sprintf("%v", v) != consumer.values[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// addConsumer registers a consumer and, if it is the first for its topic, sends the
+// subscribe message.
+func (ws *wsClient) addConsumer(consumer *wsConsumer, subscribe, unsubscribe []byte) error {
+	ws.mu.Lock()
+	ws.consumers[consumer] = struct{}{}
+	if consumer.topic == "" {
+		ws.mu.Unlock()
+		return nil
+	}
+	t, ok := ws.topics[consumer.topic]
+	if !ok {
+		t = &wsTopic{subscribe: subscribe, unsubscribe: unsubscribe}
+		ws.topics[consumer.topic] = t
+	}
+	t.refs++
+	first := t.refs == 1
+	ws.mu.Unlock()
+
+	if first && subscribe != nil {
+		if err := ws.send(subscribe); err != nil {
+			ws.removeConsumer(consumer)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeConsumer unregisters a consumer and, if it was the last for its topic, sends the
+// unsubscribe message. It may be called more than once.
+func (ws *wsClient) removeConsumer(consumer *wsConsumer) {
+	ws.mu.Lock()
+	if _, ok := ws.consumers[consumer]; !ok {
+		ws.mu.Unlock()
+		return
+	}
+	delete(ws.consumers, consumer)
+	var unsubscribe []byte
+	if t, ok := ws.topics[consumer.topic]; ok && consumer.topic != "" {
+		t.refs--
+		if t.refs == 0 {
+			delete(ws.topics, consumer.topic)
+			unsubscribe = t.unsubscribe
+		}
+	}
+	ws.mu.Unlock()
+
+	if unsubscribe != nil {
+		if err := ws.send(unsubscribe); err != nil {
+			log.Printf("Failed to unsubscribe WebSocket: %s", ws.connector.redact(err.Error()))
+		}
+	}
+}
+
+// close stops the connection and waits for the reader to exit.
+func (ws *wsClient) close() error {
+	ws.cancel()
+	ws.mu.Lock()
+	conn := ws.conn
+	ws.mu.Unlock()
+	var err error
+	if conn != nil {
+		ws.write(conn, websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		err = conn.Close()
+	}
+	<-ws.done
+	return err
+}
+
+// newWebSocketConsumer builds a consumer for a topic from subscribe options.
+func (c *APIConnector) newWebSocketConsumer(topic string, opts WebSocketSubscribeOptions) (*wsConsumer, error) {
+	consumer := &wsConsumer{topic: topic, match: map[string]jsonPath{}, values: map[string]string{}}
+	for key, value := range opts.Match {
+		path, err := parseJSONPath(key)
+		if err != nil {
+			return nil, err
+		}
+		consumer.match[key] = path
+		consumer.values[key] = fmt.Sprintf("%v", value)
+	}
+	recordsPath := opts.RecordsPath
+	if recordsPath == "" {
+		recordsPath, _ = c.config.option("records_path")
+	}
+	if recordsPath != "" {
+		path, err := parseJSONPath(recordsPath)
+		if err != nil {
+			return nil, err
+		}
+		consumer.recordsPath = path
+	}
+	return consumer, nil
+}
+
+// topicMessage renders a subscribe or unsubscribe message for topic, from the given value
+// or the option if it is nil. It returns nil if there is no message.
+func (c *APIConnector) topicMessage(topic string, message interface{}, option string) ([]byte, error) {
+	if message == nil {
+		s, ok := c.config.option(option)
+		if !ok {
+			return nil, nil
+		}
+		message = s
+	}
+
+	var text string
+	switch m := message.(type) {
+	case string:
+		text = m
+	case []byte:
+		text = string(m)
+	default:
+		data, err := json.Marshal(m)
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "failed to encode WebSocket message", err)
+		}
+		text = string(data)
+	}
+	// The topic is escaped so that it can sit inside a JSON string in the template.
+	escaped, _ := json.Marshal(topic)
+	return []byte(strings.ReplaceAll(text, "{{topic}}", string(escaped[1:len(escaped)-1]))), nil
+}
+
+// subscribeWebSocket starts a subscription to the messages of a WebSocket API.
+func (c *APIConnector) subscribeWebSocket(ctx context.Context, topic string, args []interface{}) (Subscription, error) {
+	ws := c.ws
+	if ws == nil {
+		return nil, errors.NewError(errors.ErrorTypeAPIConnection, "WebSocket connection not established", nil)
+	}
+
+	var opts WebSocketSubscribeOptions
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case WebSocketSubscribeOptions:
+			opts = v
+		case *WebSocketSubscribeOptions:
+			opts = *v
+		default:
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("invalid subscribe option type %T", arg), nil)
+		}
+	}
+	if opts.BufferSize == 0 {
+		opts.BufferSize = c.config.WebSocketBufferSize
+	}
+
+	consumer, err := c.newWebSocketConsumer(topic, opts)
+	if err != nil {
+		return nil, err
+	}
+	subscribe, err := c.topicMessage(topic, opts.SubscribeMessage, "ws_subscribe_message")
+	if err != nil {
+		return nil, err
+	}
+	unsubscribe, err := c.topicMessage(topic, opts.UnsubscribeMessage, "ws_unsubscribe_message")
+	if err != nil {
+		return nil, err
+	}
+	if topic == "" {
+		// A subscription without a topic receives every message and starts nothing.
+		subscribe, unsubscribe = nil, nil
+	}
+
+	source := c.baseURL
+	if topic != "" {
+		source = topic
+	}
+	sub, subCtx := newSubscription(ctx, opts.BufferSize)
+	consumer.handle = func(records []map[string]interface{}, seq int64) bool {
+		now := time.Now()
+		for _, record := range records {
+			if !sub.send(subCtx, Event{Source: source, Data: record, Offset: strconv.FormatInt(seq, 10), Time: now}) {
+				return false
+			}
+		}
+		return true
+	}
+	if err := ws.addConsumer(consumer, subscribe, unsubscribe); err != nil {
+		sub.finish(subCtx, nil)
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-subCtx.Done():
+		case <-ws.done:
+		}
+		ws.removeConsumer(consumer)
+		consumer.mu.Lock()
+		defer consumer.mu.Unlock()
+		sub.finish(subCtx, nil)
+	}()
+	return sub, nil
+}
+
+// queryWebSocket waits for the next message and returns its records.
+func (c *APIConnector) queryWebSocket(ctx context.Context) ([]map[string]interface{}, error) {
+	ws := c.ws
+	if ws == nil {
+		return nil, errors.NewError(errors.ErrorTypeAPIConnection, "WebSocket connection not established", nil)
+	}
+	consumer, err := c.newWebSocketConsumer("", WebSocketSubscribeOptions{})
+	if err != nil {
+		return nil, err
+	}
+	result := make(chan []map[string]interface{}, 1)
+	consumer.handle = func(records []map[string]interface{}, seq int64) bool {
+		select {
+		case result <- records:
+		default:
+		}
+		return false
+	}
+	ws.addConsumer(consumer, nil, nil)
+	defer ws.removeConsumer(consumer)
+
+	select {
+	case records := <-result:
+		return records, nil
+	case <-ws.done:
+		return nil, errors.NewError(errors.ErrorTypeAPIConnection, "WebSocket connection closed", nil)
+	case <-ctx.Done():
+		return nil, errors.NewError(errors.ErrorTypeQuery, "context cancelled while waiting for WebSocket message", ctx.Err())
+	}
+}
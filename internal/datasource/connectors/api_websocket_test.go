@@ -0,0 +1,217 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWebSocketServer accepts WebSocket connections, records the messages clients send, and
+// broadcasts messages to the connected clients.
+type fakeWebSocketServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	conns    []*websocket.Conn
+	received []string
+	pings    int
+	headers  []http.Header
+}
+
+func newFakeWebSocketServer(t *testing.T) *fakeWebSocketServer {
+	f := &fakeWebSocketServer{}
+	upgrader := websocket.Upgrader{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.SetPingHandler(func(data string) error {
+			f.mu.Lock()
+			f.pings++
+			f.mu.Unlock()
+			return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		})
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.headers = append(f.headers, r.Header)
+		f.mu.Unlock()
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.received = append(f.received, string(message))
+			f.mu.Unlock()
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeWebSocketServer) url() string {
+	return "ws" + strings.TrimPrefix(f.URL, "http")
+}
+
+// waitFor waits until cond holds for the server state.
+func (f *fakeWebSocketServer) waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return cond()
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func (f *fakeWebSocketServer) broadcast(t *testing.T, message string) {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	require.NotEmpty(t, f.conns)
+	require.NoError(t, f.conns[len(f.conns)-1].WriteMessage(websocket.TextMessage, []byte(message)))
+}
+
+// drop closes the current connection, as a server restart would.
+func (f *fakeWebSocketServer) drop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.conns[len(f.conns)-1].Close()
+}
+
+func newWebSocketConnector(t *testing.T, server *fakeWebSocketServer, options map[string]interface{}) *APIConnector {
+	t.Helper()
+	connector := NewAPIConnector(&Config{BaseURL: server.url(), IsWebSocket: true, TimeoutSeconds: 5, WebSocketBufferSize: 10, Options: options})
+	connector.reconnectBackoff = 10 * time.Millisecond
+	require.NoError(t, connector.Connect(context.Background()))
+	t.Cleanup(func() { connector.Close(context.Background()) })
+	server.waitFor(t, func() bool { return len(server.conns) == 1 })
+	return connector
+}
+
+func TestAPIConnectorWebSocketSubscribe(t *testing.T) {
+	server := newFakeWebSocketServer(t)
+	connector := newWebSocketConnector(t, server, map[string]interface{}{
+		"ws_subscribe_message":   `{"op": "subscribe", "channel": "{{topic}}"}`,
+		"ws_unsubscribe_message": `{"op": "unsubscribe", "channel": "{{topic}}"}`,
+		"ws_topic_path":          "$.channel",
+		"auth":                   "bearer",
+		"auth_token":             "t0ken",
+	})
+	ctx := context.Background()
+	assert.Equal(t, "Bearer t0ken", server.headers[0].Get("Authorization"))
+
+	trades, err := connector.Subscribe(ctx, "trades", WebSocketSubscribeOptions{
+		Match:       map[string]interface{}{"$.type": "update"},
+		RecordsPath: "$.data",
+	})
+	require.NoError(t, err)
+	quotes, err := connector.Subscribe(ctx, "quotes")
+	require.NoError(t, err)
+	server.waitFor(t, func() bool { return len(server.received) == 2 })
+	assert.Equal(t, []string{`{"op": "subscribe", "channel": "trades"}`, `{"op": "subscribe", "channel": "quotes"}`}, server.received)
+
+	server.broadcast(t, `{"channel": "trades", "type": "snapshot", "data": [{"id": 0}]}`)
+	server.broadcast(t, `{"channel": "trades", "type": "update", "data": [{"id": 1}, {"id": 2}]}`)
+	server.broadcast(t, `{"channel": "quotes", "bid": 10}`)
+
+	ev := nextEvent(t, trades)
+	assert.Equal(t, "trades", ev.Source)
+	assert.Equal(t, map[string]interface{}{"id": 1.0}, ev.Data)
+	assert.Equal(t, map[string]interface{}{"id": 2.0}, nextEvent(t, trades).Data)
+	assert.Equal(t, 10.0, nextEvent(t, quotes).Data["bid"])
+
+	// Closing the last subscription to a topic unsubscribes from it.
+	require.NoError(t, quotes.Close())
+	server.waitFor(t, func() bool { return len(server.received) == 3 })
+	assert.Equal(t, `{"op": "unsubscribe", "channel": "quotes"}`, server.received[2])
+
+	// Active topics are subscribed again after a reconnect.
+	server.drop()
+	server.waitFor(t, func() bool { return len(server.conns) == 2 && len(server.received) == 4 })
+	assert.Equal(t, `{"op": "subscribe", "channel": "trades"}`, server.received[3])
+	server.broadcast(t, `{"channel": "trades", "type": "update", "data": [{"id": 3}]}`)
+	assert.Equal(t, map[string]interface{}{"id": 3.0}, nextEvent(t, trades).Data)
+}
+
+func TestAPIConnectorWebSocketFanOut(t *testing.T) {
+	server := newFakeWebSocketServer(t)
+	connector := newWebSocketConnector(t, server, nil)
+	ctx := context.Background()
+
+	var subs []Subscription
+	for i := 0; i < 3; i++ {
+		sub, err := connector.Subscribe(ctx, "")
+		require.NoError(t, err)
+		defer sub.Close()
+		subs = append(subs, sub)
+	}
+
+	for i := 0; i < 5; i++ {
+		server.broadcast(t, fmt.Sprintf(`{"n": %d}`, i))
+	}
+	server.broadcast(t, "plain text")
+	for _, sub := range subs {
+		for i := 0; i < 5; i++ {
+			ev := nextEvent(t, sub)
+			assert.Equal(t, float64(i), ev.Data["n"], "every consumer receives every message in order")
+		}
+		assert.Equal(t, "plain text", nextEvent(t, sub).Data[WebSocketMessageColumn])
+	}
+
+	// Query returns the records of the next message.
+	result := make(chan []map[string]interface{}, 1)
+	go func() {
+		rows, err := connector.Query(ctx, "")
+		assert.NoError(t, err)
+		result <- rows
+	}()
+	require.Eventually(t, func() bool {
+		connector.ws.mu.Lock()
+		defer connector.ws.mu.Unlock()
+		return len(connector.ws.consumers) == 4
+	}, 5*time.Second, 5*time.Millisecond)
+	server.broadcast(t, `[{"id": 1}, {"id": 2}]`)
+	assert.Equal(t, []map[string]interface{}{{"id": 1.0}, {"id": 2.0}}, <-result)
+}
+
+func TestAPIConnectorWebSocketHeartbeat(t *testing.T) {
+	server := newFakeWebSocketServer(t)
+	newWebSocketConnector(t, server, map[string]interface{}{"ws_ping_interval": "20ms"})
+	server.waitFor(t, func() bool { return server.pings >= 2 })
+
+	server = newFakeWebSocketServer(t)
+	newWebSocketConnector(t, server, map[string]interface{}{"ws_ping_interval": "20ms", "ws_ping_message": `{"op": "ping"}`})
+	server.waitFor(t, func() bool { return len(server.received) >= 2 })
+	assert.Equal(t, `{"op": "ping"}`, server.received[0])
+}
+
+func TestAPIConnectorWebSocketClose(t *testing.T) {
+	server := newFakeWebSocketServer(t)
+	connector := newWebSocketConnector(t, server, nil)
+	ctx := context.Background()
+
+	sub, err := connector.Subscribe(ctx, "")
+	require.NoError(t, err)
+	require.NoError(t, connector.Close(ctx))
+	for range sub.Events() {
+	}
+	assert.NoError(t, sub.Err())
+
+	_, err = connector.Subscribe(ctx, "")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeAPIConnection))
+	assert.True(t, errors.IsErrorType(connector.Ping(ctx), errors.ErrorTypeAPIConnection))
+
+	err = NewAPIConnector(&Config{BaseURL: server.url(), IsWebSocket: true, Options: map[string]interface{}{"ws_ping_interval": "sometimes"}}).Connect(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+}
@@ -0,0 +1,474 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/common/errors"
+	"pkg/common/retry"
+
+	"github.com/gocql/gocql"
+)
+
+// defaultCassandraPort is the CQL native protocol port.
+const defaultCassandraPort = 9042
+
+// CassandraPage requests a single page of results from CassandraConnector.QueryPage.
+type CassandraPage struct {
+	// Size is the maximum number of rows in the page. Defaults to the connector's page size.
+	Size int
+	// State is the paging state returned with the previous page, or nil for the first page.
+	State []byte
+}
+
+// CassandraTable describes the primary key and secondary indexes of a table, which
+// decide whether a query can be served without ALLOW FILTERING.
+type CassandraTable struct {
+	Keyspace          string
+	Name              string
+	PartitionKey      []string
+	ClusteringColumns []string
+	Columns           []string
+	Indexed           []string
+}
+
+// CassandraConnector implements the Connector interface for Apache Cassandra and
+// compatible databases such as ScyllaDB.
+type CassandraConnector struct {
+	session        cqlSession
+	config         *Config
+	consistency    gocql.Consistency
+	pageSize       int
+	allowFiltering bool
+
+	// newSession opens a session; tests replace it with an in-memory double.
+	newSession func(cluster *gocql.ClusterConfig) (cqlSession, error)
+}
+
+// NewCassandraConnector creates a new CassandraConnector with the given configuration.
+//
+// The config parameter should include:
+//   - Host: A comma-separated list of contact points
+//   - Port: The native protocol port. Defaults to 9042.
+//   - Username: The username, if the cluster uses password authentication
+//   - Password: The password
+//   - Database: The keyspace
+//   - TimeoutSeconds: Timeout for each request
+//   - Options["consistency"]: The consistency level, such as "local_quorum". Defaults to "quorum".
+//   - Options["page_size"]: The number of rows fetched per page. Defaults to 5000.
+//   - Options["allow_filtering"]: Set to "true" to let translated queries use ALLOW FILTERING
+//
+// Example:
+//
+//	config := &Config{
+//	    Host:     "cass-1.internal,cass-2.internal",
+//	    Database: "telemetry",
+//	    Options:  map[string]interface{}{"consistency": "local_quorum"},
+//	}
+//	connector := NewCassandraConnector(config)
+func NewCassandraConnector(config *Config) *CassandraConnector {
+	return &CassandraConnector{
+		config:     config,
+		newSession: newGocqlSession,
+	}
+}
+
+// Connect opens a session to the cluster.
+func (c *CassandraConnector) Connect(ctx context.Context) error {
+	var hosts []string
+	for _, host := range strings.Split(c.config.Host, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) == 0 {
+		return errors.NewError(errors.ErrorTypeConfiguration, "at least one contact point is required for Cassandra connector", nil)
+	}
+
+	consistency := gocql.Quorum
+	if s, ok := c.config.option("consistency"); ok {
+		var err error
+		if consistency, err = gocql.ParseConsistencyWrapper(s); err != nil {
+			return errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("invalid consistency level %s", s), err)
+		}
+	}
+	pageSize, err := c.config.intOption("page_size", 5000)
+	if err != nil {
+		return err
+	}
+	allowFiltering, err := c.config.boolOption("allow_filtering")
+	if err != nil {
+		return err
+	}
+
+	cluster := gocql.NewCluster(hosts...)
+	cluster.Port = defaultCassandraPort
+	if c.config.Port > 0 {
+		cluster.Port = c.config.Port
+	}
+	cluster.Keyspace = c.config.Database
+	cluster.Consistency = consistency
+	cluster.PageSize = pageSize
+	if c.config.TimeoutSeconds > 0 {
+		cluster.Timeout = time.Duration(c.config.TimeoutSeconds) * time.Second
+		cluster.ConnectTimeout = cluster.Timeout
+	}
+	if c.config.Username != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: c.config.Username,
+			Password: c.config.Password,
+		}
+	}
+
+	var session cqlSession
+	err = retry.Retry(ctx, func() error {
+		var err error
+		session, err = c.newSession(cluster)
+		if err != nil {
+			return errors.NewError(errors.ErrorTypeConnection, "failed to connect to Cassandra", err)
+		}
+		return nil
+	}, retry.DefaultConfig())
+	if err != nil {
+		return err
+	}
+
+	c.session = session
+	c.consistency = consistency
+	c.pageSize = pageSize
+	c.allowFiltering = allowFiltering
+	return nil
+}
+
+// Close closes the session.
+func (c *CassandraConnector) Close(ctx context.Context) error {
+	if c.session == nil {
+		return errors.NewError(errors.ErrorTypeConnection, "connection already closed", nil)
+	}
+	c.session.Close()
+	c.session = nil
+	return nil
+}
+
+// Query executes a CQL statement with bind values and returns every row, fetching
+// further pages as needed. Values are converted for transport: uuid and timeuuid become
+// their string form, maps become map[string]interface{} with string keys, and lists and
+// sets become []interface{}.
+//
+// Example:
+//
+//	ctx := context.Background()
+//	rows, err := connector.Query(ctx, "SELECT * FROM readings WHERE sensor_id = ? AND day = ?", sensorID, "2024-05-01")
+//	if err != nil {
+//	    log.Printf("Query failed: %v", err)
+//	}
+func (c *CassandraConnector) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	if c.session == nil {
+		return nil, errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+
+	iter := c.session.Iter(ctx, query, args, cqlOptions{Consistency: c.consistency, PageSize: c.pageSize})
+	rows, err := scanCQLRows(iter, -1)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to execute query", err)
+	}
+	return rows, nil
+}
+
+// QueryPage executes a CQL statement and returns a single page of rows with the paging
+// state for the next page. The returned state is nil after the last page.
+//
+// Example:
+//
+//	page := CassandraPage{Size: 100}
+//	for {
+//	    rows, next, err := connector.QueryPage(ctx, "SELECT * FROM events", page)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    process(rows)
+//	    if next == nil {
+//	        break
+//	    }
+//	    page.State = next
+//	}
+func (c *CassandraConnector) QueryPage(ctx context.Context, query string, page CassandraPage, args ...interface{}) ([]map[string]interface{}, []byte, error) {
+	if c.session == nil {
+		return nil, nil, errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+	if page.Size <= 0 {
+		page.Size = c.pageSize
+	}
+
+	iter := c.session.Iter(ctx, query, args, cqlOptions{Consistency: c.consistency, PageSize: page.Size, PageState: page.State})
+	next := iter.PageState()
+	rows, err := scanCQLRows(iter, page.Size)
+	if err != nil {
+		return nil, nil, errors.NewError(errors.ErrorTypeQuery, "failed to execute query", err)
+	}
+	if len(next) == 0 {
+		next = nil
+	}
+	return rows, next, nil
+}
+
+// Execute executes a CQL statement that does not return rows. Cassandra does not report
+// how many rows a write touched, so the returned count is always zero.
+//
+// Example:
+//
+//	ctx := context.Background()
+//	_, err := connector.Execute(ctx, "INSERT INTO readings (sensor_id, day, ts, value) VALUES (?, ?, ?, ?)", sensorID, day, ts, 21.5)
+//	if err != nil {
+//	    log.Printf("Insert failed: %v", err)
+//	}
+func (c *CassandraConnector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
+	if c.session == nil {
+		return 0, errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+	if err := c.session.Exec(ctx, command, args, cqlOptions{Consistency: c.consistency}); err != nil {
+		return 0, errors.NewError(errors.ErrorTypeExecution, "failed to execute command", err)
+	}
+	return 0, nil
+}
+
+// Ping checks that the cluster responds to a query.
+func (c *CassandraConnector) Ping(ctx context.Context) error {
+	if c.session == nil {
+		return errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+	iter := c.session.Iter(ctx, "SELECT release_version FROM system.local", nil, cqlOptions{Consistency: gocql.One})
+	if _, err := scanCQLRows(iter, -1); err != nil {
+		return errors.NewError(errors.ErrorTypeConnection, "failed to ping Cassandra", err)
+	}
+	return nil
+}
+
+// Transaction starts a logged batch. Cassandra has no transactions, but a logged batch
+// applies all of its writes or none of them. Statements are sent when the batch is committed.
+func (c *CassandraConnector) Transaction(ctx context.Context) (TransactionConnector, error) {
+	if c.session == nil {
+		return nil, errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+	return &CassandraBatchConnector{connector: c}, nil
+}
+
+// AllowFiltering reports whether translated queries may use ALLOW FILTERING.
+func (c *CassandraConnector) AllowFiltering() bool {
+	return c.allowFiltering
+}
+
+// Table returns the key layout of a table, given as "table" in the connector's keyspace
+// or as "keyspace.table".
+func (c *CassandraConnector) Table(ctx context.Context, name string) (*CassandraTable, error) {
+	if c.session == nil {
+		return nil, errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+
+	keyspace, table := c.config.Database, name
+	if ks, t, ok := strings.Cut(name, "."); ok {
+		keyspace, table = ks, t
+	}
+
+	meta, err := c.session.KeyspaceMetadata(keyspace)
+	if err != nil {
+		if err == gocql.ErrKeyspaceDoesNotExist {
+			return nil, errors.NewError(errors.ErrorTypeNotFound, fmt.Sprintf("keyspace %s does not exist", keyspace), err)
+		}
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to read keyspace metadata", err)
+	}
+	tableMeta, ok := meta.Tables[table]
+	if !ok {
+		return nil, errors.NewError(errors.ErrorTypeNotFound, fmt.Sprintf("table %s.%s does not exist", keyspace, table), nil)
+	}
+
+	result := &CassandraTable{Keyspace: keyspace, Name: table}
+	for _, col := range tableMeta.PartitionKey {
+		result.PartitionKey = append(result.PartitionKey, col.Name)
+	}
+	for _, col := range tableMeta.ClusteringColumns {
+		result.ClusteringColumns = append(result.ClusteringColumns, col.Name)
+	}
+	for name := range tableMeta.Columns {
+		result.Columns = append(result.Columns, name)
+	}
+	sort.Strings(result.Columns)
+
+	// Secondary indexes live in system_schema.indexes since Cassandra 3.0.
+	iter := c.session.Iter(ctx, "SELECT options FROM system_schema.indexes WHERE keyspace_name = ? AND table_name = ?",
+		[]interface{}{keyspace, table}, cqlOptions{Consistency: gocql.One})
+	indexes, err := scanCQLRows(iter, -1)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to read secondary indexes", err)
+	}
+	for _, index := range indexes {
+		options, _ := index["options"].(map[string]interface{})
+		if target, ok := options["target"].(string); ok {
+			result.Indexed = append(result.Indexed, strings.Trim(target, `"`))
+		}
+	}
+
+	return result, nil
+}
+
+// CassandraBatchConnector collects writes into a logged batch.
+type CassandraBatchConnector struct {
+	connector  *CassandraConnector
+	mu         sync.Mutex
+	statements []cqlStatement
+	done       bool
+}
+
+// Query is not supported inside a batch.
+func (b *CassandraBatchConnector) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	return nil, errors.NewError(errors.ErrorTypeUnsupported, "queries are not supported inside a Cassandra batch", nil)
+}
+
+// Execute adds a statement to the batch.
+func (b *CassandraBatchConnector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return 0, errors.NewError(errors.ErrorTypeTransaction, "batch already committed or rolled back", nil)
+	}
+	b.statements = append(b.statements, cqlStatement{Statement: command, Values: args})
+	return 0, nil
+}
+
+// Commit sends the batch.
+func (b *CassandraBatchConnector) Commit(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return errors.NewError(errors.ErrorTypeTransaction, "batch already committed or rolled back", nil)
+	}
+	b.done = true
+	if len(b.statements) == 0 {
+		return nil
+	}
+	if b.connector.session == nil {
+		return errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+	if err := b.connector.session.ExecBatch(ctx, b.statements, cqlOptions{Consistency: b.connector.consistency}); err != nil {
+		return errors.NewError(errors.ErrorTypeTransaction, "failed to execute batch", err)
+	}
+	return nil
+}
+
+// Rollback discards the batch.
+func (b *CassandraBatchConnector) Rollback(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return errors.NewError(errors.ErrorTypeTransaction, "batch already committed or rolled back", nil)
+	}
+	b.done = true
+	b.statements = nil
+	return nil
+}
+
+// cqlOptions are the per-request settings passed to a cqlSession.
+type cqlOptions struct {
+	Consistency gocql.Consistency
+	PageSize    int
+	PageState   []byte
+}
+
+// cqlStatement is a statement with its bind values.
+type cqlStatement struct {
+	Statement string
+	Values    []interface{}
+}
+
+// cqlSession is the part of a gocql session used by the connector.
+type cqlSession interface {
+	Iter(ctx context.Context, stmt string, values []interface{}, opts cqlOptions) cqlIter
+	Exec(ctx context.Context, stmt string, values []interface{}, opts cqlOptions) error
+	ExecBatch(ctx context.Context, statements []cqlStatement, opts cqlOptions) error
+	KeyspaceMetadata(keyspace string) (*gocql.KeyspaceMetadata, error)
+	Close()
+}
+
+// cqlIter is the part of a gocql iterator used by the connector.
+type cqlIter interface {
+	MapScan(m map[string]interface{}) bool
+	PageState() []byte
+	Close() error
+}
+
+// gocqlSession adapts *gocql.Session to cqlSession.
+type gocqlSession struct {
+	session *gocql.Session
+}
+
+func newGocqlSession(cluster *gocql.ClusterConfig) (cqlSession, error) {
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+	return &gocqlSession{session: session}, nil
+}
+
+func (s *gocqlSession) Iter(ctx context.Context, stmt string, values []interface{}, opts cqlOptions) cqlIter {
+	q := s.session.Query(stmt, values...).WithContext(ctx).Consistency(opts.Consistency)
+	if opts.PageSize > 0 {
+		q = q.PageSize(opts.PageSize)
+	}
+	if opts.PageState != nil {
+		q = q.PageState(opts.PageState)
+	}
+	return q.Iter()
+}
+
+func (s *gocqlSession) Exec(ctx context.Context, stmt string, values []interface{}, opts cqlOptions) error {
+	return s.session.Query(stmt, values...).WithContext(ctx).Consistency(opts.Consistency).Exec()
+}
+
+func (s *gocqlSession) ExecBatch(ctx context.Context, statements []cqlStatement, opts cqlOptions) error {
+	batch := s.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.SetConsistency(opts.Consistency)
+	for _, st := range statements {
+		batch.Query(st.Statement, st.Values...)
+	}
+	return s.session.ExecuteBatch(batch)
+}
+
+func (s *gocqlSession) KeyspaceMetadata(keyspace string) (*gocql.KeyspaceMetadata, error) {
+	return s.session.KeyspaceMetadata(keyspace)
+}
+
+func (s *gocqlSession) Close() {
+	s.session.Close()
+}
+
+// scanCQLRows reads up to limit rows from iter, or every row if limit is negative, and closes it.
+func scanCQLRows(iter cqlIter, limit int) ([]map[string]interface{}, error) {
+	rows := []map[string]interface{}{}
+	for limit < 0 || len(rows) < limit {
+		row := map[string]interface{}{}
+		if !iter.MapScan(row) {
+			break
+		}
+		for k, v := range row {
+			row[k] = cqlValue(v)
+		}
+		rows = append(rows, row)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// cqlValue converts a value scanned by gocql into a plain value. Durations, which have
+// no single text form, become their months, days and nanoseconds.
+func cqlValue(v interface{}) interface{} {
+	if d, ok := v.(gocql.Duration); ok {
+		return map[string]interface{}{"months": d.Months, "days": d.Days, "nanoseconds": d.Nanoseconds}
+	}
+	return plainValue(v)
+}
@@ -0,0 +1,279 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/inf.v0"
+)
+
+// fakeCQLSession is an in-memory stand-in for a Cassandra session. Queries return the
+// rows registered for their exact statement text, and writes are recorded.
+type fakeCQLSession struct {
+	mu        sync.Mutex
+	results   map[string][]map[string]interface{}
+	keyspaces map[string]*gocql.KeyspaceMetadata
+	execs     []cqlStatement
+	batches   [][]cqlStatement
+	options   []cqlOptions
+	execErr   error
+	closed    bool
+}
+
+func newFakeCQLSession() *fakeCQLSession {
+	return &fakeCQLSession{
+		results: map[string][]map[string]interface{}{
+			"SELECT release_version FROM system.local": {{"release_version": "4.1.3"}},
+		},
+		keyspaces: map[string]*gocql.KeyspaceMetadata{},
+	}
+}
+
+func (s *fakeCQLSession) Iter(ctx context.Context, stmt string, values []interface{}, opts cqlOptions) cqlIter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.options = append(s.options, opts)
+
+	rows, ok := s.results[stmt]
+	if !ok {
+		return &fakeCQLIter{err: fmt.Errorf("unexpected statement: %s", stmt)}
+	}
+
+	start := 0
+	if opts.PageState != nil {
+		start, _ = strconv.Atoi(string(opts.PageState))
+	}
+	iter := &fakeCQLIter{rows: rows[start:]}
+	if opts.PageSize > 0 && start+opts.PageSize < len(rows) {
+		iter.state = []byte(strconv.Itoa(start + opts.PageSize))
+	}
+	return iter
+}
+
+func (s *fakeCQLSession) Exec(ctx context.Context, stmt string, values []interface{}, opts cqlOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.execs = append(s.execs, cqlStatement{Statement: stmt, Values: values})
+	return s.execErr
+}
+
+func (s *fakeCQLSession) ExecBatch(ctx context.Context, statements []cqlStatement, opts cqlOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, statements)
+	return s.execErr
+}
+
+func (s *fakeCQLSession) KeyspaceMetadata(keyspace string) (*gocql.KeyspaceMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta, ok := s.keyspaces[keyspace]
+	if !ok {
+		return nil, gocql.ErrKeyspaceDoesNotExist
+	}
+	return meta, nil
+}
+
+func (s *fakeCQLSession) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+}
+
+// fakeCQLIter yields rows the way gocql does, copying each row into the caller's map.
+type fakeCQLIter struct {
+	rows  []map[string]interface{}
+	state []byte
+	err   error
+}
+
+func (it *fakeCQLIter) MapScan(m map[string]interface{}) bool {
+	if it.err != nil || len(it.rows) == 0 {
+		return false
+	}
+	for k, v := range it.rows[0] {
+		m[k] = v
+	}
+	it.rows = it.rows[1:]
+	return true
+}
+
+func (it *fakeCQLIter) PageState() []byte { return it.state }
+
+func (it *fakeCQLIter) Close() error { return it.err }
+
+func newTestCassandraConnector(t *testing.T, session *fakeCQLSession, options map[string]interface{}) *CassandraConnector {
+	t.Helper()
+	connector := NewCassandraConnector(&Config{Host: "cass-1, cass-2", Database: "telemetry", Options: options})
+	connector.newSession = func(cluster *gocql.ClusterConfig) (cqlSession, error) {
+		return session, nil
+	}
+	require.NoError(t, connector.Connect(context.Background()))
+	return connector
+}
+
+func TestCassandraConnectorConnect(t *testing.T) {
+	var cluster *gocql.ClusterConfig
+	session := newFakeCQLSession()
+	connector := NewCassandraConnector(&Config{
+		Host:     "cass-1, cass-2",
+		Port:     9043,
+		Username: "app",
+		Password: "secret",
+		Database: "telemetry",
+		Options:  map[string]interface{}{"consistency": "local_quorum", "page_size": "50", "allow_filtering": "true"},
+	})
+	connector.newSession = func(c *gocql.ClusterConfig) (cqlSession, error) {
+		cluster = c
+		return session, nil
+	}
+	require.NoError(t, connector.Connect(context.Background()))
+
+	assert.Equal(t, []string{"cass-1", "cass-2"}, cluster.Hosts)
+	assert.Equal(t, 9043, cluster.Port)
+	assert.Equal(t, "telemetry", cluster.Keyspace)
+	assert.Equal(t, gocql.LocalQuorum, cluster.Consistency)
+	assert.Equal(t, gocql.PasswordAuthenticator{Username: "app", Password: "secret"}, cluster.Authenticator)
+	assert.True(t, connector.AllowFiltering())
+	assert.NoError(t, connector.Ping(context.Background()))
+
+	require.NoError(t, connector.Close(context.Background()))
+	assert.True(t, session.closed)
+
+	for _, config := range []*Config{
+		{Host: ""},
+		{Host: "cass-1", Options: map[string]interface{}{"consistency": "most"}},
+		{Host: "cass-1", Options: map[string]interface{}{"page_size": "many"}},
+	} {
+		err := NewCassandraConnector(config).Connect(context.Background())
+		assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration), "%+v: %v", config, err)
+	}
+}
+
+func TestCassandraConnectorQuery(t *testing.T) {
+	ctx := context.Background()
+	session := newFakeCQLSession()
+	id := gocql.TimeUUID()
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	session.results["SELECT * FROM readings"] = []map[string]interface{}{
+		{
+			"id":      id,
+			"ts":      ts,
+			"tags":    []string{"eu", "prod"},
+			"counts":  map[string]int{"errors": 2},
+			"by_uuid": map[gocql.UUID]string{id: "self"},
+			"amount":  inf.NewDec(1250, 2),
+			"window":  gocql.Duration{Days: 1},
+			"note":    (*string)(nil),
+		},
+		{"id": gocql.UUID{}}, {"id": gocql.UUID{}},
+	}
+	connector := newTestCassandraConnector(t, session, nil)
+
+	rows, err := connector.Query(ctx, "SELECT * FROM readings")
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, map[string]interface{}{
+		"id":      id.String(),
+		"ts":      ts,
+		"tags":    []interface{}{"eu", "prod"},
+		"counts":  map[string]interface{}{"errors": 2},
+		"by_uuid": map[string]interface{}{id.String(): "self"},
+		"amount":  "12.50",
+		"window":  map[string]interface{}{"months": int32(0), "days": int32(1), "nanoseconds": int64(0)},
+		"note":    nil,
+	}, rows[0])
+	assert.Equal(t, gocql.Quorum, session.options[len(session.options)-1].Consistency)
+
+	rows, next, err := connector.QueryPage(ctx, "SELECT * FROM readings", CassandraPage{Size: 2})
+	require.NoError(t, err)
+	assert.Len(t, rows, 2)
+	require.NotNil(t, next)
+
+	rows, next, err = connector.QueryPage(ctx, "SELECT * FROM readings", CassandraPage{Size: 2, State: next})
+	require.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Nil(t, next)
+
+	_, err = connector.Query(ctx, "SELECT * FROM missing")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeQuery))
+}
+
+func TestCassandraConnectorTable(t *testing.T) {
+	ctx := context.Background()
+	session := newFakeCQLSession()
+	session.keyspaces["telemetry"] = &gocql.KeyspaceMetadata{
+		Name: "telemetry",
+		Tables: map[string]*gocql.TableMetadata{
+			"readings": {
+				PartitionKey:      []*gocql.ColumnMetadata{{Name: "sensor_id"}, {Name: "day"}},
+				ClusteringColumns: []*gocql.ColumnMetadata{{Name: "ts"}},
+				Columns: map[string]*gocql.ColumnMetadata{
+					"sensor_id": {}, "day": {}, "ts": {}, "value": {}, "site": {},
+				},
+			},
+		},
+	}
+	session.results["SELECT options FROM system_schema.indexes WHERE keyspace_name = ? AND table_name = ?"] = []map[string]interface{}{
+		{"options": map[string]string{"target": "site"}},
+	}
+	connector := newTestCassandraConnector(t, session, nil)
+
+	table, err := connector.Table(ctx, "readings")
+	require.NoError(t, err)
+	assert.Equal(t, &CassandraTable{
+		Keyspace:          "telemetry",
+		Name:              "readings",
+		PartitionKey:      []string{"sensor_id", "day"},
+		ClusteringColumns: []string{"ts"},
+		Columns:           []string{"day", "sensor_id", "site", "ts", "value"},
+		Indexed:           []string{"site"},
+	}, table)
+
+	_, err = connector.Table(ctx, "telemetry.missing")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+	_, err = connector.Table(ctx, "other.readings")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+}
+
+func TestCassandraConnectorBatch(t *testing.T) {
+	ctx := context.Background()
+	session := newFakeCQLSession()
+	connector := newTestCassandraConnector(t, session, nil)
+
+	_, err := connector.Execute(ctx, "DELETE FROM readings WHERE sensor_id = ?", "s1")
+	require.NoError(t, err)
+	assert.Len(t, session.execs, 1)
+
+	tx, err := connector.Transaction(ctx)
+	require.NoError(t, err)
+	_, err = tx.Execute(ctx, "INSERT INTO readings (sensor_id, value) VALUES (?, ?)", "s1", 1.5)
+	require.NoError(t, err)
+	_, err = tx.Execute(ctx, "INSERT INTO readings (sensor_id, value) VALUES (?, ?)", "s2", 2.5)
+	require.NoError(t, err)
+	assert.Empty(t, session.batches, "statements are sent on commit")
+
+	require.NoError(t, tx.Commit(ctx))
+	require.Len(t, session.batches, 1)
+	assert.Len(t, session.batches[0], 2)
+	assert.Error(t, tx.Commit(ctx))
+
+	_, err = tx.Execute(ctx, "INSERT INTO readings (sensor_id) VALUES (?)", "s3")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeTransaction))
+
+	tx, err = connector.Transaction(ctx)
+	require.NoError(t, err)
+	_, err = tx.Execute(ctx, "INSERT INTO readings (sensor_id) VALUES (?)", "s3")
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback(ctx))
+	assert.Len(t, session.batches, 1)
+}
@@ -0,0 +1,122 @@
+package connectors
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"pkg/common/errors"
+)
+
+// checkpointStore persists stream positions, such as file offsets, keyed by name.
+// Positions are kept in a single JSON file that is replaced atomically on every save.
+// A store without a directory keeps positions in memory only.
+type checkpointStore struct {
+	path string
+	mu   sync.Mutex
+	data map[string]json.RawMessage
+}
+
+// newCheckpointStore opens the checkpoint file name in dir, creating dir if needed.
+// An empty dir returns an in-memory store.
+func newCheckpointStore(dir, name string) (*checkpointStore, error) {
+	store := &checkpointStore{data: make(map[string]json.RawMessage)}
+	if dir == "" {
+		return store, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "failed to create state directory", err)
+	}
+	store.path = filepath.Join(dir, name)
+
+	data, err := os.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeFileConnection, "failed to read checkpoint file", err)
+	}
+	if err := json.Unmarshal(data, &store.data); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "failed to parse checkpoint file", err)
+	}
+
+	return store, nil
+}
+
+// Load decodes the checkpoint stored under key into v and reports whether one existed.
+func (s *checkpointStore) Load(key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, ok := s.data[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, errors.NewError(errors.ErrorTypeDataIntegrity, "failed to decode checkpoint", err)
+	}
+	return true, nil
+}
+
+// Save stores v under key and writes the checkpoint file.
+func (s *checkpointStore) Save(key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeDataIntegrity, "failed to encode checkpoint", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[key] = raw
+	return s.write()
+}
+
+// Delete removes the checkpoint stored under key and writes the checkpoint file.
+func (s *checkpointStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data[key]; !ok {
+		return nil
+	}
+	delete(s.data, key)
+	return s.write()
+}
+
+// write replaces the checkpoint file with the stored checkpoints. The caller holds s.mu.
+func (s *checkpointStore) write() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.data)
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeDataIntegrity, "failed to encode checkpoints", err)
+	}
+
+	// A temporary file of its own keeps stores of other processes sharing the directory
+	// from renaming a file this one is still writing.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeFileConnection, "failed to create checkpoint file", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.NewError(errors.ErrorTypeFileConnection, "failed to write checkpoint file", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return errors.NewError(errors.ErrorTypeFileConnection, "failed to replace checkpoint file", err)
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/common/errors"
+	"pkg/common/retry"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+const (
+	// defaultClickHousePort is the native protocol port.
+	defaultClickHousePort = 9000
+	// defaultClickHouseBlockSize is the number of rows returned by each RowIterator.Next call.
+	defaultClickHouseBlockSize = 10000
+)
+
+// ClickHouseConnector implements the Connector and Streamer interfaces for ClickHouse.
+// It uses the native protocol, so results are read block by block and inserts are sent
+// as columnar batches.
+type ClickHouseConnector struct {
+	conn      driver.Conn
+	config    *Config
+	blockSize int
+
+	// open opens a connection; tests replace it with an in-memory double.
+	open func(options *clickhouse.Options) (driver.Conn, error)
+}
+
+// NewClickHouseConnector creates a new ClickHouseConnector with the given configuration.
+//
+// The config parameter should include:
+//   - Host: A comma-separated list of servers; a server may include its own port
+//   - Port: The native protocol port. Defaults to 9000.
+//   - Username: The username
+//   - Password: The password
+//   - Database: The default database
+//   - TimeoutSeconds: Timeout for dialing and reading
+//   - MaxOpenConns, MaxIdleConns, ConnMaxLifetimeSeconds: Connection pool settings
+//   - Options["block_size"]: The number of rows per streamed block. Defaults to 10000.
+//
+// Example:
+//
+//	config := &Config{
+//	    Host:     "clickhouse.internal",
+//	    Username: "default",
+//	    Database: "analytics",
+//	}
+//	connector := NewClickHouseConnector(config)
+func NewClickHouseConnector(config *Config) *ClickHouseConnector {
+	return &ClickHouseConnector{
+		config: config,
+		open:   clickhouse.Open,
+	}
+}
+
+// Connect opens the connection pool and verifies that the server can be reached.
+func (c *ClickHouseConnector) Connect(ctx context.Context) error {
+	port := defaultClickHousePort
+	if c.config.Port > 0 {
+		port = c.config.Port
+	}
+	var addrs []string
+	for _, host := range strings.Split(c.config.Host, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		addrs = append(addrs, host)
+	}
+	if len(addrs) == 0 {
+		return errors.NewError(errors.ErrorTypeConfiguration, "host is required for ClickHouse connector", nil)
+	}
+
+	blockSize, err := c.config.intOption("block_size", defaultClickHouseBlockSize)
+	if err != nil {
+		return err
+	}
+	if blockSize <= 0 {
+		return errors.NewError(errors.ErrorTypeConfiguration, "option block_size must be positive", nil)
+	}
+
+	options := &clickhouse.Options{
+		Addr: addrs,
+		Auth: clickhouse.Auth{
+			Database: c.config.Database,
+			Username: c.config.Username,
+			Password: c.config.Password,
+		},
+		MaxOpenConns:    c.config.MaxOpenConns,
+		MaxIdleConns:    c.config.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(c.config.ConnMaxLifetimeSeconds) * time.Second,
+	}
+	if c.config.TimeoutSeconds > 0 {
+		options.DialTimeout = time.Duration(c.config.TimeoutSeconds) * time.Second
+		options.ReadTimeout = options.DialTimeout
+	}
+
+	var conn driver.Conn
+	err = retry.Retry(ctx, func() error {
+		var err error
+		conn, err = c.open(options)
+		if err != nil {
+			return errors.NewError(errors.ErrorTypeConfiguration, "invalid ClickHouse options", err)
+		}
+		if err := conn.Ping(ctx); err != nil {
+			conn.Close()
+			return wrapClickHouseError(err, errors.ErrorTypeDatabaseConnection, "failed to connect to ClickHouse")
+		}
+		return nil
+	}, retry.DefaultConfig())
+	if err != nil {
+		return err
+	}
+
+	c.conn = conn
+	c.blockSize = blockSize
+	return nil
+}
+
+// Close closes the connection pool.
+func (c *ClickHouseConnector) Close(ctx context.Context) error {
+	if c.conn == nil {
+		return errors.NewError(errors.ErrorTypeDatabaseConnection, "connection already closed", nil)
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Query executes a query and returns every row. Use Stream for results that are too large
+// to hold in memory.
+func (c *ClickHouseConnector) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	it, err := c.Stream(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return readAllRows(ctx, it)
+}
+
+// Stream executes a query and returns an iterator that yields its rows in blocks of the
+// configured block size. The server sends results in native blocks, so only the current
+// block is held in memory.
+//
+// Example:
+//
+//	it, err := connector.Stream(ctx, "SELECT * FROM events WHERE day = ?", day)
+//	if err != nil {
+//	    return err
+//	}
+//	defer it.Close()
+//	for {
+//	    rows, err := it.Next(ctx)
+//	    if err == io.EOF {
+//	        break
+//	    }
+//	    if err != nil {
+//	        return err
+//	    }
+//	    process(rows)
+//	}
+func (c *ClickHouseConnector) Stream(ctx context.Context, query string, args ...interface{}) (RowIterator, error) {
+	if c.conn == nil {
+		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+	}
+
+	rows, err := c.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, wrapClickHouseError(err, errors.ErrorTypeQuery, "failed to execute query")
+	}
+
+	columns := rows.ColumnTypes()
+	it := &clickHouseRows{rows: rows, blockSize: c.blockSize, names: make([]string, len(columns)), types: make([]reflect.Type, len(columns))}
+	for i, col := range columns {
+		it.names[i] = col.Name()
+		it.types[i] = col.ScanType()
+	}
+	return it, nil
+}
+
+// Execute executes a statement that does not return rows, such as DDL or ALTER TABLE.
+// ClickHouse does not report affected rows, so the returned count is always zero.
+// Use InsertBatch to insert rows.
+func (c *ClickHouseConnector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
+	if c.conn == nil {
+		return 0, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+	}
+	if err := c.conn.Exec(ctx, command, args...); err != nil {
+		return 0, wrapClickHouseError(err, errors.ErrorTypeExecution, "failed to execute command")
+	}
+	return 0, nil
+}
+
+// InsertBatch inserts rows into a table as a single columnar batch. The inserted columns are
+// the union of the rows' keys; a row without one of them inserts the column's default.
+//
+// Example:
+//
+//	rows := []map[string]interface{}{
+//	    {"ts": time.Now(), "event": "click", "user_id": uint64(42)},
+//	    {"ts": time.Now(), "event": "view", "user_id": uint64(7)},
+//	}
+//	n, err := connector.InsertBatch(ctx, "events", rows)
+func (c *ClickHouseConnector) InsertBatch(ctx context.Context, table string, rows []map[string]interface{}) (int64, error) {
+	if c.conn == nil {
+		return 0, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	seen := map[string]bool{}
+	var columns []string
+	for _, row := range rows {
+		for k := range row {
+			if !seen[k] {
+				seen[k] = true
+				columns = append(columns, k)
+			}
+		}
+	}
+	sort.Strings(columns)
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = clickhouseIdent(col)
+	}
+	parts := strings.Split(table, ".")
+	for i, part := range parts {
+		parts[i] = clickhouseIdent(part)
+	}
+
+	batch, err := c.conn.PrepareBatch(ctx, fmt.Sprintf("INSERT INTO %s (%s)", strings.Join(parts, "."), strings.Join(quoted, ", ")))
+	if err != nil {
+		return 0, wrapClickHouseError(err, errors.ErrorTypeExecution, "failed to prepare batch")
+	}
+
+	for _, row := range rows {
+		values := make([]interface{}, len(columns))
+		for i, col := range columns {
+			values[i] = row[col]
+		}
+		if err := batch.Append(values...); err != nil {
+			batch.Abort()
+			return 0, errors.NewError(errors.ErrorTypeExecution, "failed to append row to batch", err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return 0, wrapClickHouseError(err, errors.ErrorTypeExecution, "failed to send batch")
+	}
+	return int64(len(rows)), nil
+}
+
+// Ping checks that the server is reachable.
+func (c *ClickHouseConnector) Ping(ctx context.Context) error {
+	if c.conn == nil {
+		return errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+	}
+	if err := c.conn.Ping(ctx); err != nil {
+		return wrapClickHouseError(err, errors.ErrorTypeDatabaseConnection, "failed to ping ClickHouse")
+	}
+	return nil
+}
+
+// Transaction is not supported, as ClickHouse has no multi-statement transactions.
+func (c *ClickHouseConnector) Transaction(ctx context.Context) (TransactionConnector, error) {
+	return nil, errors.NewError(errors.ErrorTypeUnsupported, "transactions are not supported for ClickHouse connector", nil)
+}
+
+// clickHouseRows adapts driver.Rows to RowIterator.
+type clickHouseRows struct {
+	rows      driver.Rows
+	blockSize int
+	names     []string
+	types     []reflect.Type
+	closed    bool
+}
+
+func (it *clickHouseRows) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	if it.closed {
+		return nil, io.EOF
+	}
+
+	block := make([]map[string]interface{}, 0, it.blockSize)
+	for len(block) < it.blockSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !it.rows.Next() {
+			break
+		}
+
+		dest := make([]interface{}, len(it.types))
+		for i, t := range it.types {
+			dest[i] = reflect.New(t).Interface()
+		}
+		if err := it.rows.Scan(dest...); err != nil {
+			return nil, errors.NewError(errors.ErrorTypeQuery, "failed to scan row", err)
+		}
+
+		row := make(map[string]interface{}, len(dest))
+		for i, name := range it.names {
+			row[name] = plainValue(reflect.ValueOf(dest[i]).Elem().Interface())
+		}
+		block = append(block, row)
+	}
+
+	if len(block) < it.blockSize {
+		if err := it.rows.Err(); err != nil {
+			return nil, wrapClickHouseError(err, errors.ErrorTypeQuery, "error during row iteration")
+		}
+		it.Close()
+		if len(block) == 0 {
+			return nil, io.EOF
+		}
+	}
+	return block, nil
+}
+
+func (it *clickHouseRows) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	return it.rows.Close()
+}
+
+// wrapClickHouseError maps server exceptions to DataVinci error types.
+func wrapClickHouseError(err error, errType errors.ErrorType, message string) error {
+	if exception, ok := err.(*clickhouse.Exception); ok {
+		switch exception.Code {
+		case 60, 81: // UNKNOWN_TABLE, UNKNOWN_DATABASE
+			errType = errors.ErrorTypeNotFound
+		case 192, 193, 194, 497, 516: // UNKNOWN_USER, WRONG_PASSWORD, REQUIRED_PASSWORD, ACCESS_DENIED, AUTHENTICATION_FAILED
+			errType = errors.ErrorTypePermission
+		}
+	}
+	return errors.NewError(errType, message, err)
+}
+
+// clickhousePlainName matches the names that statements use as written.
+var clickhousePlainName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// clickhouseIdent returns a plain name as is, and quotes any other with backticks, so that a
+// name cannot change the statement it is written in.
+func clickhouseIdent(name string) string {
+	if clickhousePlainName.MatchString(name) {
+		return name
+	}
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
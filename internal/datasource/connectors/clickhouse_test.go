@@ -0,0 +1,301 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClickHouse is an in-memory stand-in for a ClickHouse connection. Queries return
+// the table registered for their exact text, and batches are recorded when sent.
+type fakeClickHouse struct {
+	driver.Conn
+	tables  map[string]fakeClickHouseTable
+	batches []*fakeClickHouseBatch
+	execs   []string
+	pingErr error
+	closed  bool
+}
+
+type fakeClickHouseTable struct {
+	columns []fakeColumnType
+	rows    [][]interface{}
+}
+
+func (f *fakeClickHouse) Query(ctx context.Context, query string, args ...interface{}) (driver.Rows, error) {
+	table, ok := f.tables[query]
+	if !ok {
+		return nil, &clickhouse.Exception{Code: 60, Name: "DB::Exception", Message: "Table doesn't exist"}
+	}
+	return &fakeClickHouseRows{table: table, index: -1}, nil
+}
+
+func (f *fakeClickHouse) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	batch := &fakeClickHouseBatch{query: query}
+	f.batches = append(f.batches, batch)
+	return batch, nil
+}
+
+func (f *fakeClickHouse) Exec(ctx context.Context, query string, args ...interface{}) error {
+	f.execs = append(f.execs, query)
+	return nil
+}
+
+func (f *fakeClickHouse) Ping(ctx context.Context) error { return f.pingErr }
+
+func (f *fakeClickHouse) Close() error {
+	f.closed = true
+	return nil
+}
+
+type fakeColumnType struct {
+	name     string
+	scanType reflect.Type
+}
+
+func (c fakeColumnType) Name() string             { return c.name }
+func (c fakeColumnType) Nullable() bool           { return c.scanType.Kind() == reflect.Ptr }
+func (c fakeColumnType) ScanType() reflect.Type   { return c.scanType }
+func (c fakeColumnType) DatabaseTypeName() string { return c.scanType.String() }
+
+type fakeClickHouseRows struct {
+	driver.Rows
+	table  fakeClickHouseTable
+	index  int
+	closed bool
+}
+
+func (r *fakeClickHouseRows) Next() bool {
+	r.index++
+	return r.index < len(r.table.rows)
+}
+
+func (r *fakeClickHouseRows) Scan(dest ...interface{}) error {
+	for i, v := range r.table.rows[r.index] {
+		target := reflect.ValueOf(dest[i]).Elem()
+		if v == nil {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+		target.Set(reflect.ValueOf(v))
+	}
+	return nil
+}
+
+func (r *fakeClickHouseRows) ColumnTypes() []driver.ColumnType {
+	types := make([]driver.ColumnType, len(r.table.columns))
+	for i, c := range r.table.columns {
+		types[i] = c
+	}
+	return types
+}
+
+func (r *fakeClickHouseRows) Err() error { return nil }
+
+func (r *fakeClickHouseRows) Close() error {
+	r.closed = true
+	return nil
+}
+
+type fakeClickHouseBatch struct {
+	driver.Batch
+	query   string
+	rows    [][]interface{}
+	sent    bool
+	aborted bool
+}
+
+func (b *fakeClickHouseBatch) Append(v ...interface{}) error {
+	b.rows = append(b.rows, v)
+	return nil
+}
+
+func (b *fakeClickHouseBatch) Send() error {
+	b.sent = true
+	return nil
+}
+
+func (b *fakeClickHouseBatch) Abort() error {
+	b.aborted = true
+	return nil
+}
+
+func newTestClickHouseConnector(t *testing.T, fake *fakeClickHouse, options map[string]interface{}) *ClickHouseConnector {
+	t.Helper()
+	connector := NewClickHouseConnector(&Config{Host: "ch-1, ch-2:9440", Database: "analytics", Options: options})
+	connector.open = func(opts *clickhouse.Options) (driver.Conn, error) {
+		return fake, nil
+	}
+	require.NoError(t, connector.Connect(context.Background()))
+	return connector
+}
+
+func eventsTable(n int) fakeClickHouseTable {
+	name := "note"
+	table := fakeClickHouseTable{columns: []fakeColumnType{
+		{"id", reflect.TypeOf(uint64(0))},
+		{"ts", reflect.TypeOf(time.Time{})},
+		{"tags", reflect.TypeOf([]string{})},
+		{"attrs", reflect.TypeOf(map[string]uint64{})},
+		{"note", reflect.TypeOf(&name)},
+	}}
+	for i := 1; i <= n; i++ {
+		var note *string
+		if i%2 == 0 {
+			note = &name
+		}
+		table.rows = append(table.rows, []interface{}{
+			uint64(i),
+			time.Date(2024, 5, 1, 0, 0, i, 0, time.UTC),
+			[]string{"a", "b"},
+			map[string]uint64{"clicks": uint64(i)},
+			note,
+		})
+	}
+	return table
+}
+
+func TestClickHouseConnectorConnect(t *testing.T) {
+	var options *clickhouse.Options
+	fake := &fakeClickHouse{}
+	connector := NewClickHouseConnector(&Config{Host: "ch-1, ch-2:9440", Username: "default", Password: "secret", Database: "analytics"})
+	connector.open = func(opts *clickhouse.Options) (driver.Conn, error) {
+		options = opts
+		return fake, nil
+	}
+	require.NoError(t, connector.Connect(context.Background()))
+	assert.Equal(t, []string{"ch-1:9000", "ch-2:9440"}, options.Addr)
+	assert.Equal(t, clickhouse.Auth{Database: "analytics", Username: "default", Password: "secret"}, options.Auth)
+
+	require.NoError(t, connector.Close(context.Background()))
+	assert.True(t, fake.closed)
+
+	fake = &fakeClickHouse{pingErr: &clickhouse.Exception{Code: 516, Message: "Authentication failed"}}
+	connector = NewClickHouseConnector(&Config{Host: "ch-1"})
+	connector.open = func(opts *clickhouse.Options) (driver.Conn, error) { return fake, nil }
+	err := connector.Connect(context.Background())
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypePermission))
+
+	err = NewClickHouseConnector(&Config{Host: "ch-1", Options: map[string]interface{}{"block_size": "0"}}).Connect(context.Background())
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+}
+
+func TestClickHouseConnectorQuery(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeClickHouse{tables: map[string]fakeClickHouseTable{"SELECT * FROM events": eventsTable(3)}}
+	connector := newTestClickHouseConnector(t, fake, nil)
+
+	rows, err := connector.Query(ctx, "SELECT * FROM events")
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, map[string]interface{}{
+		"id":    uint64(1),
+		"ts":    time.Date(2024, 5, 1, 0, 0, 1, 0, time.UTC),
+		"tags":  []interface{}{"a", "b"},
+		"attrs": map[string]interface{}{"clicks": uint64(1)},
+		"note":  nil,
+	}, rows[0])
+	assert.Equal(t, "note", rows[1]["note"])
+
+	_, err = connector.Query(ctx, "SELECT * FROM missing")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+}
+
+func TestClickHouseConnectorStream(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeClickHouse{tables: map[string]fakeClickHouseTable{"SELECT * FROM events": eventsTable(5)}}
+	connector := newTestClickHouseConnector(t, fake, map[string]interface{}{"block_size": 2})
+
+	it, err := connector.Stream(ctx, "SELECT * FROM events")
+	require.NoError(t, err)
+	defer it.Close()
+
+	var sizes []int
+	for {
+		block, err := it.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		sizes = append(sizes, len(block))
+	}
+	assert.Equal(t, []int{2, 2, 1}, sizes)
+
+	_, err = it.Next(ctx)
+	assert.Equal(t, io.EOF, err)
+	assert.NoError(t, it.Close())
+
+	// A cancelled context stops the stream between rows.
+	it, err = connector.Stream(ctx, "SELECT * FROM events")
+	require.NoError(t, err)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = it.Next(cancelled)
+	assert.ErrorIs(t, err, context.Canceled)
+	require.NoError(t, it.Close())
+}
+
+func TestClickHouseConnectorInsertBatch(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeClickHouse{}
+	connector := newTestClickHouseConnector(t, fake, nil)
+
+	n, err := connector.InsertBatch(ctx, "events", []map[string]interface{}{
+		{"id": 1, "kind": "click"},
+		{"id": 2, "value": 1.5},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	require.Len(t, fake.batches, 1)
+	batch := fake.batches[0]
+	assert.Equal(t, "INSERT INTO events (id, kind, value)", batch.query)
+	assert.Equal(t, [][]interface{}{{1, "click", nil}, {2, nil, 1.5}}, batch.rows)
+	assert.True(t, batch.sent)
+
+	_, err = connector.InsertBatch(ctx, "db.events; DROP TABLE x", []map[string]interface{}{{"a b": 1, "c`d": 2}})
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT INTO db.`events; DROP TABLE x` (`a b`, `c``d`)", fake.batches[1].query)
+	fake.batches = fake.batches[:1]
+
+	n, err = connector.InsertBatch(ctx, "events", nil)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Len(t, fake.batches, 1, "empty inserts send nothing")
+
+	_, err = connector.Execute(ctx, "OPTIMIZE TABLE events FINAL")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"OPTIMIZE TABLE events FINAL"}, fake.execs)
+
+	_, err = connector.Transaction(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+}
+
+func TestPlainValue(t *testing.T) {
+	s := "x"
+	tests := []struct {
+		in   interface{}
+		want interface{}
+	}{
+		{nil, nil},
+		{(*string)(nil), nil},
+		{&s, "x"},
+		{[]byte("raw"), []byte("raw")},
+		{[]int{1, 2}, []interface{}{1, 2}},
+		{map[int]string{1: "a"}, map[string]interface{}{"1": "a"}},
+		{fmt.Stringer(time.Second), "1s"},
+		{int64(7), int64(7)},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, plainValue(tt.in), "%#v", tt.in)
+	}
+}
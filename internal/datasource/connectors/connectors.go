@@ -2,6 +2,14 @@ package connectors
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"pkg/common/errors"
 )
 
 // Connector is the interface that wraps the basic methods for a data connector.
@@ -74,8 +82,129 @@ type Config struct {
 	WebSocketBufferSize int
 	// TimeoutSeconds is the timeout for the HTTP client.
 	TimeoutSeconds int
-	// BaseURL is the base URL for the API.
+	// BaseURL is the base URL for the API, or the endpoint of an S3-compatible object store.
 	BaseURL string
+	// Region is the region of an S3-compatible object store.
+	Region string
 	// BasePath is the base path for the file connector.
 	BasePath string
+	// StatePath is the directory where streaming connectors persist their positions,
+	// such as file offsets, so subscriptions can resume after a restart.
+	StatePath string
+}
+
+// String formats the configuration with the password and secret options redacted, so that a
+// configuration can be logged safely.
+func (c Config) String() string {
+	redacted := c
+	if redacted.Password != "" {
+		redacted.Password = redactedSecret
+	}
+	if len(c.Options) > 0 {
+		redacted.Options = make(map[string]interface{}, len(c.Options))
+		for k, v := range c.Options {
+			if isSecretOption(k) {
+				v = redactedSecret
+			}
+			redacted.Options[k] = v
+		}
+	}
+	// The conversion drops the String method, so formatting does not recurse.
+	type plainConfig Config
+	return fmt.Sprintf("%+v", plainConfig(redacted))
+}
+
+// isSecretOption reports whether an option holds a credential, such as auth_token, api_key,
+// hmac_secret or sentinel_password.
+func isSecretOption(key string) bool {
+	key = strings.ToLower(key)
+	if strings.HasPrefix(key, "header.") {
+		name := strings.TrimPrefix(key, "header.")
+		return name == "authorization" || strings.Contains(name, "key") || strings.Contains(name, "token")
+	}
+	return key == "api_key" || key == "token" || strings.HasSuffix(key, "_token") ||
+		strings.HasSuffix(key, "password") || strings.HasSuffix(key, "secret")
+}
+
+// option returns a connector-specific option as a string, and whether it is set.
+// Options arrive as strings over gRPC but may hold typed values when set in code.
+func (c *Config) option(key string) (string, bool) {
+	v, ok := c.Options[key]
+	if !ok || v == nil {
+		return "", false
+	}
+	return fmt.Sprintf("%v", v), true
+}
+
+// intOption returns a connector-specific integer option, or def if it is not set.
+func (c *Config) intOption(key string, def int) (int, error) {
+	s, ok := c.option(key)
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("option %s must be an integer", key), err)
+	}
+	return n, nil
+}
+
+// boolOption returns a connector-specific boolean option, which is false if it is not set.
+func (c *Config) boolOption(key string) (bool, error) {
+	s, ok := c.option(key)
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("option %s must be a boolean", key), err)
+	}
+	return b, nil
+}
+
+// tlsConfig builds a TLS configuration from the connector-specific options, or returns nil if
+// the "tls" option is not enabled. The options are:
+//   - tls: Enables TLS
+//   - tls_ca_file: A PEM file of CA certificates to verify the server with, instead of the system pool
+//   - tls_cert_file, tls_key_file: A PEM client certificate and key, for servers that require one
+//   - tls_server_name: The name to verify the server certificate against, if it differs from the host
+//   - tls_insecure_skip_verify: Disables verification of the server certificate
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	enabled, err := c.boolOption("tls")
+	if err != nil || !enabled {
+		return nil, err
+	}
+	insecure, err := c.boolOption("tls_insecure_skip_verify")
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecure}
+	config.ServerName, _ = c.option("tls_server_name")
+
+	if caFile, ok := c.option("tls_ca_file"); ok {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "failed to read TLS CA file", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "TLS CA file contains no certificates", nil)
+		}
+	}
+
+	certFile, hasCert := c.option("tls_cert_file")
+	keyFile, hasKey := c.option("tls_key_file")
+	if hasCert != hasKey {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "options tls_cert_file and tls_key_file must be set together", nil)
+	}
+	if hasCert {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "failed to load TLS client certificate", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
 }
@@ -0,0 +1,527 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"pkg/common/errors"
+	"pkg/common/retry"
+)
+
+const (
+	// defaultElasticsearchURL is used when no BaseURL is configured.
+	defaultElasticsearchURL = "http://localhost:9200"
+	// defaultElasticsearchPageSize is the number of hits fetched per request when paginating.
+	defaultElasticsearchPageSize = 1000
+	// defaultScrollKeepAlive is how long a scroll context is kept between pages.
+	defaultScrollKeepAlive = time.Minute
+)
+
+// ElasticsearchSearchOptions configures how Query pages through large results.
+type ElasticsearchSearchOptions struct {
+	// PageSize is the number of hits fetched per request. Defaults to 1000.
+	PageSize int
+	// ScrollKeepAlive is how long the scroll context is kept between pages. Defaults to one minute.
+	ScrollKeepAlive time.Duration
+}
+
+// ElasticsearchConnector implements the Connector interface for Elasticsearch and OpenSearch.
+// It speaks the REST API shared by both, so no client library is required.
+type ElasticsearchConnector struct {
+	client  *http.Client
+	config  *Config
+	baseURL string
+}
+
+// NewElasticsearchConnector creates a new ElasticsearchConnector with the given configuration.
+//
+// The config parameter should include:
+//   - BaseURL: The URL of the cluster. Defaults to "http://localhost:9200".
+//   - Username: The username for basic authentication, if the cluster requires it
+//   - Password: The password for basic authentication
+//   - TimeoutSeconds: Timeout for each HTTP request
+//
+// Example:
+//
+//	config := &Config{
+//	    BaseURL:        "https://search.example.com:9200",
+//	    Username:       "elastic",
+//	    Password:       "changeme",
+//	    TimeoutSeconds: 30,
+//	}
+//	connector := NewElasticsearchConnector(config)
+func NewElasticsearchConnector(config *Config) *ElasticsearchConnector {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultElasticsearchURL
+	}
+	return &ElasticsearchConnector{
+		config:  config,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Connect creates the HTTP client and verifies that the cluster can be reached.
+func (c *ElasticsearchConnector) Connect(ctx context.Context) error {
+	if _, err := url.Parse(c.baseURL); err != nil {
+		return errors.NewError(errors.ErrorTypeConfiguration, "invalid Elasticsearch URL", err)
+	}
+
+	c.client = &http.Client{Timeout: time.Duration(c.config.TimeoutSeconds) * time.Second}
+	err := retry.Retry(ctx, func() error {
+		return c.Ping(ctx)
+	}, retry.DefaultConfig())
+	if err != nil {
+		c.client = nil
+		return err
+	}
+
+	return nil
+}
+
+// Close releases the HTTP client.
+func (c *ElasticsearchConnector) Close(ctx context.Context) error {
+	if c.client == nil {
+		return errors.NewError(errors.ErrorTypeConnection, "connection already closed", nil)
+	}
+	c.client.CloseIdleConnections()
+	c.client = nil
+	return nil
+}
+
+// Query runs a search request, given as search DSL, against the index in args[0] and
+// returns the hits as rows. Each row is the document's _source with its _id, _index and,
+// when scored, _score. An empty index searches every index, and an optional
+// ElasticsearchSearchOptions argument follows the index.
+//
+// When the request contains aggregations, the aggregation results are returned instead
+// of hits, one row per innermost bucket. A row holds the key of each enclosing bucket
+// aggregation under the aggregation's name, the bucket's doc_count, and the value of
+// every metric aggregation under its name.
+//
+// Requests without a size return every matching hit, and requests with a size larger
+// than the page size are fetched in pages: with search_after when the request is sorted,
+// and with the scroll API otherwise. Requests that set from are sent as a single search.
+//
+// Example:
+//
+//	ctx := context.Background()
+//	rows, err := connector.Query(ctx, `{"query": {"term": {"status": "error"}}, "sort": [{"@timestamp": "desc"}, {"event.id": "asc"}]}`, "logs-*")
+//	if err != nil {
+//	    log.Printf("Search failed: %v", err)
+//	}
+func (c *ElasticsearchConnector) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	if c.client == nil {
+		return nil, errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+
+	var index string
+	opts := ElasticsearchSearchOptions{PageSize: defaultElasticsearchPageSize, ScrollKeepAlive: defaultScrollKeepAlive}
+	if len(args) > 0 {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, errors.NewError(errors.ErrorTypeQuery, "index name must be a string", nil)
+		}
+		index = s
+	}
+	if len(args) > 1 {
+		switch v := args[1].(type) {
+		case ElasticsearchSearchOptions:
+			opts = v
+		case *ElasticsearchSearchOptions:
+			opts = *v
+		default:
+			return nil, errors.NewError(errors.ErrorTypeQuery, "invalid Elasticsearch search options", nil)
+		}
+		if opts.PageSize <= 0 {
+			opts.PageSize = defaultElasticsearchPageSize
+		}
+		if opts.ScrollKeepAlive <= 0 {
+			opts.ScrollKeepAlive = defaultScrollKeepAlive
+		}
+	}
+
+	body := map[string]interface{}{}
+	if strings.TrimSpace(query) != "" {
+		if err := json.Unmarshal([]byte(query), &body); err != nil {
+			return nil, errors.NewError(errors.ErrorTypeQuery, "invalid search request", err)
+		}
+	}
+
+	searchPath := "/_search"
+	if index != "" {
+		searchPath = "/" + url.PathEscape(index) + "/_search"
+	}
+
+	_, hasAggs := body["aggs"]
+	_, hasAggregations := body["aggregations"]
+	_, hasFrom := body["from"]
+	limit, hasSize, err := searchSize(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasAggs || hasAggregations || hasFrom || (hasSize && limit <= opts.PageSize) {
+		var resp searchResponse
+		if err := c.do(ctx, http.MethodPost, searchPath, body, &resp); err != nil {
+			return nil, err
+		}
+		if resp.Aggregations != nil {
+			return flattenAggregations(resp.Aggregations), nil
+		}
+		return hitRows(resp.Hits.Hits), nil
+	}
+
+	if !hasSize {
+		limit = -1
+	}
+	if _, sorted := body["sort"]; sorted {
+		return c.searchAfter(ctx, searchPath, body, limit, opts)
+	}
+	return c.scroll(ctx, searchPath, body, limit, opts)
+}
+
+// Execute is not supported for the Elasticsearch connector.
+func (c *ElasticsearchConnector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
+	return 0, errors.NewError(errors.ErrorTypeUnsupported, "execute operation is not supported for Elasticsearch connector", nil)
+}
+
+// Ping checks that the cluster is reachable and the credentials are accepted.
+func (c *ElasticsearchConnector) Ping(ctx context.Context) error {
+	if c.client == nil {
+		return errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+	return c.request(ctx, http.MethodGet, "/", nil, nil)
+}
+
+// Transaction is not supported for the Elasticsearch connector.
+func (c *ElasticsearchConnector) Transaction(ctx context.Context) (TransactionConnector, error) {
+	return nil, errors.NewError(errors.ErrorTypeUnsupported, "transactions are not supported for Elasticsearch connector", nil)
+}
+
+// searchResponse is the part of a search response that the connector reads.
+type searchResponse struct {
+	ScrollID string `json:"_scroll_id"`
+	Hits     struct {
+		Hits []searchHit `json:"hits"`
+	} `json:"hits"`
+	Aggregations map[string]interface{} `json:"aggregations"`
+}
+
+type searchHit struct {
+	Index  string                 `json:"_index"`
+	ID     string                 `json:"_id"`
+	Score  *float64               `json:"_score"`
+	Source map[string]interface{} `json:"_source"`
+	Sort   []interface{}          `json:"sort"`
+}
+
+// searchAfter pages through a sorted search by passing the sort values of the last hit.
+// A limit below zero fetches every hit.
+func (c *ElasticsearchConnector) searchAfter(ctx context.Context, searchPath string, body map[string]interface{}, limit int, opts ElasticsearchSearchOptions) ([]map[string]interface{}, error) {
+	results := []map[string]interface{}{}
+	for limit < 0 || len(results) < limit {
+		size := opts.PageSize
+		if limit >= 0 && limit-len(results) < size {
+			size = limit - len(results)
+		}
+		body["size"] = size
+
+		var resp searchResponse
+		if err := c.do(ctx, http.MethodPost, searchPath, body, &resp); err != nil {
+			return nil, err
+		}
+		hits := resp.Hits.Hits
+		results = append(results, hitRows(hits)...)
+		if len(hits) < size {
+			break
+		}
+
+		last := hits[len(hits)-1].Sort
+		if len(last) == 0 {
+			return nil, errors.NewError(errors.ErrorTypeQuery, "search_after pagination requires sort values in hits", nil)
+		}
+		body["search_after"] = last
+	}
+	return results, nil
+}
+
+// scroll pages through an unsorted search with the scroll API and clears the scroll
+// context when done. A limit below zero fetches every hit.
+func (c *ElasticsearchConnector) scroll(ctx context.Context, searchPath string, body map[string]interface{}, limit int, opts ElasticsearchSearchOptions) ([]map[string]interface{}, error) {
+	keepAlive := opts.ScrollKeepAlive.String()
+	body["size"] = opts.PageSize
+
+	var resp searchResponse
+	if err := c.do(ctx, http.MethodPost, searchPath+"?scroll="+url.QueryEscape(keepAlive), body, &resp); err != nil {
+		return nil, err
+	}
+
+	scrollID := resp.ScrollID
+	defer func() {
+		if scrollID == "" {
+			return
+		}
+		// Clear the scroll even if the query was cancelled, so the cluster can free it.
+		clear := map[string]interface{}{"scroll_id": []string{scrollID}}
+		_ = c.request(context.WithoutCancel(ctx), http.MethodDelete, "/_search/scroll", clear, nil)
+	}()
+
+	results := []map[string]interface{}{}
+	for {
+		results = append(results, hitRows(resp.Hits.Hits)...)
+		if limit >= 0 && len(results) >= limit {
+			return results[:limit], nil
+		}
+		if len(resp.Hits.Hits) == 0 || resp.ScrollID == "" {
+			return results, nil
+		}
+
+		next := map[string]interface{}{"scroll": keepAlive, "scroll_id": resp.ScrollID}
+		resp = searchResponse{}
+		if err := c.do(ctx, http.MethodPost, "/_search/scroll", next, &resp); err != nil {
+			return nil, err
+		}
+		if resp.ScrollID != "" {
+			scrollID = resp.ScrollID
+		}
+	}
+}
+
+// do sends a request, retrying connection errors and server overload.
+func (c *ElasticsearchConnector) do(ctx context.Context, method, path string, body, out interface{}) error {
+	return retry.Retry(ctx, func() error {
+		return c.request(ctx, method, path, body, out)
+	}, retry.DefaultConfig())
+}
+
+// request sends a single JSON request and decodes the response into out.
+func (c *ElasticsearchConnector) request(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return errors.NewError(errors.ErrorTypeQuery, "failed to marshal request body", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeQuery, "failed to create request", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeConnection, "failed to reach Elasticsearch", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeConnection, "failed to read response body", err)
+	}
+	if resp.StatusCode >= 300 {
+		return elasticsearchError(resp.StatusCode, data)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return errors.NewError(errors.ErrorTypeQuery, "failed to decode response", err)
+		}
+	}
+	return nil
+}
+
+// elasticsearchError maps an error response to a DataVinci error, keeping the
+// cluster's error type and reason in the message.
+func elasticsearchError(status int, body []byte) error {
+	var payload struct {
+		Error struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	message := fmt.Sprintf("Elasticsearch returned status %d", status)
+	if json.Unmarshal(body, &payload) == nil && payload.Error.Type != "" {
+		message = fmt.Sprintf("%s: %s: %s", message, payload.Error.Type, payload.Error.Reason)
+	}
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return errors.NewError(errors.ErrorTypePermission, message, nil)
+	case status == http.StatusNotFound:
+		return errors.NewError(errors.ErrorTypeNotFound, message, nil)
+	case status == http.StatusTooManyRequests || status >= 500:
+		return errors.NewError(errors.ErrorTypeConnection, message, nil)
+	default:
+		return errors.NewError(errors.ErrorTypeQuery, message, nil)
+	}
+}
+
+// searchSize returns the size of a search request, if it sets one.
+func searchSize(body map[string]interface{}) (int, bool, error) {
+	v, ok := body["size"]
+	if !ok {
+		return 0, false, nil
+	}
+	n, ok := v.(float64)
+	if !ok || n < 0 || n != float64(int(n)) {
+		return 0, false, errors.NewError(errors.ErrorTypeQuery, "size must be a non-negative integer", nil)
+	}
+	return int(n), true, nil
+}
+
+// hitRows converts search hits to rows.
+func hitRows(hits []searchHit) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(hits))
+	for _, hit := range hits {
+		row := make(map[string]interface{}, len(hit.Source)+3)
+		for k, v := range hit.Source {
+			row[k] = v
+		}
+		row["_id"] = hit.ID
+		row["_index"] = hit.Index
+		if hit.Score != nil {
+			row["_score"] = *hit.Score
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// flattenAggregations converts an aggregation response to rows.
+func flattenAggregations(aggs map[string]interface{}) []map[string]interface{} {
+	return flattenAggregationLevel(map[string]interface{}{}, aggs)
+}
+
+// flattenAggregationLevel expands the aggregations of one level into rows that extend prefix.
+// Metric values are added to every row of the level; each bucket aggregation multiplies the
+// rows by its buckets, and nested aggregations are expanded recursively.
+func flattenAggregationLevel(prefix, aggs map[string]interface{}) []map[string]interface{} {
+	names := make([]string, 0, len(aggs))
+	for name := range aggs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	row := copyRow(prefix)
+	var nested []string
+	for _, name := range names {
+		agg, ok := aggs[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch {
+		case agg["buckets"] != nil:
+			nested = append(nested, name)
+		case hasKey(agg, "value"):
+			row[name] = agg["value"]
+		case hasKey(agg, "doc_count"):
+			// A single-bucket aggregation such as filter: its count is the value
+			// unless it holds nested aggregations.
+			if len(subAggregations(agg)) > 0 {
+				nested = append(nested, name)
+			} else {
+				row[name] = agg["doc_count"]
+			}
+		default:
+			// Multi-value metrics such as stats are kept as objects.
+			row[name] = agg
+		}
+	}
+
+	rows := []map[string]interface{}{row}
+	for _, name := range nested {
+		agg := aggs[name].(map[string]interface{})
+		var expanded []map[string]interface{}
+		for _, base := range rows {
+			if agg["buckets"] == nil {
+				expanded = append(expanded, flattenAggregationLevel(base, subAggregations(agg))...)
+				continue
+			}
+			for _, bucket := range aggregationBuckets(agg["buckets"]) {
+				bucketRow := copyRow(base)
+				key := bucket["key"]
+				if s, ok := bucket["key_as_string"]; ok {
+					key = s
+				}
+				bucketRow[name] = key
+				bucketRow["doc_count"] = bucket["doc_count"]
+				expanded = append(expanded, flattenAggregationLevel(bucketRow, subAggregations(bucket))...)
+			}
+		}
+		rows = expanded
+	}
+	if rows == nil {
+		return []map[string]interface{}{}
+	}
+	return rows
+}
+
+// aggregationBuckets returns the buckets of a bucket aggregation, which are a list
+// for most aggregations and an object keyed by bucket name for keyed ones.
+func aggregationBuckets(v interface{}) []map[string]interface{} {
+	var buckets []map[string]interface{}
+	switch b := v.(type) {
+	case []interface{}:
+		for _, item := range b {
+			if bucket, ok := item.(map[string]interface{}); ok {
+				buckets = append(buckets, bucket)
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(b))
+		for k := range b {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if bucket, ok := b[k].(map[string]interface{}); ok {
+				bucket = copyRow(bucket)
+				bucket["key"] = k
+				buckets = append(buckets, bucket)
+			}
+		}
+	}
+	return buckets
+}
+
+// subAggregations returns the nested aggregation results of a bucket.
+func subAggregations(bucket map[string]interface{}) map[string]interface{} {
+	sub := map[string]interface{}{}
+	for k, v := range bucket {
+		if _, ok := v.(map[string]interface{}); ok && k != "key" {
+			sub[k] = v
+		}
+	}
+	return sub
+}
+
+func hasKey(m map[string]interface{}, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+func copyRow(row map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,232 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeElasticsearch is a minimal stand-in for a search cluster holding one index of
+// documents with ids "1" to "n". It serves search with from/size, search_after on the
+// id, the scroll API, and returns a canned response for aggregation requests.
+type fakeElasticsearch struct {
+	mu       sync.Mutex
+	docs     int
+	requests []map[string]interface{}
+	scrolls  map[string]int
+	cleared  []string
+	aggs     map[string]interface{}
+}
+
+func newFakeElasticsearch(t *testing.T, docs int) (*fakeElasticsearch, *httptest.Server) {
+	t.Helper()
+	fake := &fakeElasticsearch{docs: docs, scrolls: map[string]int{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeElasticsearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if user, pass, _ := r.BasicAuth(); user != "elastic" || pass != "secret" {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"error": map[string]interface{}{"type": "security_exception", "reason": "missing authentication credentials"},
+		})
+		return
+	}
+
+	var body map[string]interface{}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"version": map[string]interface{}{"number": "8.13.0"}})
+	case r.URL.Path == "/missing/_search":
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": map[string]interface{}{"type": "index_not_found_exception", "reason": "no such index [missing]"},
+		})
+	case r.URL.Path == "/orders/_search":
+		f.requests = append(f.requests, body)
+		f.search(w, r, body)
+	case r.URL.Path == "/_search/scroll" && r.Method == http.MethodPost:
+		f.requests = append(f.requests, body)
+		id := body["scroll_id"].(string)
+		start, ok := f.scrolls[id]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": map[string]interface{}{"type": "search_context_missing_exception"}})
+			return
+		}
+		page := f.hits(start, 2)
+		f.scrolls[id] = start + len(page)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"_scroll_id": id, "hits": map[string]interface{}{"hits": page}})
+	case r.URL.Path == "/_search/scroll" && r.Method == http.MethodDelete:
+		for _, id := range body["scroll_id"].([]interface{}) {
+			f.cleared = append(f.cleared, id.(string))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"succeeded": true})
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": map[string]interface{}{"type": "illegal_argument_exception"}})
+	}
+}
+
+func (f *fakeElasticsearch) search(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+	if _, ok := body["aggs"]; ok {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"hits": map[string]interface{}{"hits": []interface{}{}}, "aggregations": f.aggs})
+		return
+	}
+
+	size := 10
+	if s, ok := body["size"].(float64); ok {
+		size = int(s)
+	}
+	start := 0
+	if from, ok := body["from"].(float64); ok {
+		start = int(from)
+	}
+	if after, ok := body["search_after"].([]interface{}); ok {
+		start = int(after[0].(float64))
+	}
+
+	page := f.hits(start, size)
+	resp := map[string]interface{}{"hits": map[string]interface{}{"hits": page}}
+	if r.URL.Query().Get("scroll") != "" {
+		id := fmt.Sprintf("scroll-%d", len(f.scrolls))
+		f.scrolls[id] = len(page)
+		resp["_scroll_id"] = id
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// hits returns up to size documents starting after the first start documents.
+func (f *fakeElasticsearch) hits(start, size int) []interface{} {
+	hits := []interface{}{}
+	for n := start + 1; n <= f.docs && len(hits) < size; n++ {
+		hits = append(hits, map[string]interface{}{
+			"_index":  "orders",
+			"_id":     fmt.Sprint(n),
+			"_score":  nil,
+			"_source": map[string]interface{}{"n": n},
+			"sort":    []interface{}{n},
+		})
+	}
+	return hits
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func newTestElasticsearchConnector(t *testing.T, docs int) (*ElasticsearchConnector, *fakeElasticsearch) {
+	t.Helper()
+	fake, server := newFakeElasticsearch(t, docs)
+	connector := NewElasticsearchConnector(&Config{BaseURL: server.URL, Username: "elastic", Password: "secret"})
+	require.NoError(t, connector.Connect(context.Background()))
+	return connector, fake
+}
+
+func TestElasticsearchConnectorSearch(t *testing.T) {
+	ctx := context.Background()
+	opts := ElasticsearchSearchOptions{PageSize: 2}
+
+	t.Run("SinglePage", func(t *testing.T) {
+		connector, fake := newTestElasticsearchConnector(t, 5)
+		rows, err := connector.Query(ctx, `{"size": 2, "from": 1}`, "orders", opts)
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+		assert.Equal(t, "2", rows[0]["_id"])
+		assert.Equal(t, "orders", rows[0]["_index"])
+		assert.Equal(t, float64(2), rows[0]["n"])
+		assert.NotContains(t, rows[0], "_score")
+		assert.Len(t, fake.requests, 1)
+	})
+
+	t.Run("SearchAfter", func(t *testing.T) {
+		connector, fake := newTestElasticsearchConnector(t, 5)
+		rows, err := connector.Query(ctx, `{"size": 4, "sort": [{"n": "asc"}]}`, "orders", opts)
+		require.NoError(t, err)
+		require.Len(t, rows, 4)
+		assert.Equal(t, "4", rows[3]["_id"])
+		require.Len(t, fake.requests, 2)
+		assert.Equal(t, []interface{}{float64(2)}, fake.requests[1]["search_after"])
+
+		rows, err = connector.Query(ctx, `{"sort": [{"n": "asc"}]}`, "orders", opts)
+		require.NoError(t, err)
+		assert.Len(t, rows, 5, "requests without a size return every hit")
+	})
+
+	t.Run("Scroll", func(t *testing.T) {
+		connector, fake := newTestElasticsearchConnector(t, 5)
+		rows, err := connector.Query(ctx, `{"query": {"match_all": {}}}`, "orders", opts)
+		require.NoError(t, err)
+		require.Len(t, rows, 5)
+		assert.Equal(t, "5", rows[4]["_id"])
+		assert.Equal(t, []string{"scroll-0"}, fake.cleared)
+
+		rows, err = connector.Query(ctx, `{"size": 3}`, "orders", opts)
+		require.NoError(t, err)
+		assert.Len(t, rows, 3)
+		assert.Equal(t, []string{"scroll-0", "scroll-1"}, fake.cleared)
+	})
+}
+
+func TestElasticsearchConnectorAggregations(t *testing.T) {
+	connector, fake := newTestElasticsearchConnector(t, 0)
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"region": {"buckets": [
+			{"key": "eu", "doc_count": 3, "sum_amount": {"value": 30}, "count": {"doc_count": 3},
+			 "status": {"buckets": [{"key": "paid", "doc_count": 2}, {"key": "open", "doc_count": 1}]}},
+			{"key": "us", "doc_count": 1, "sum_amount": {"value": 5}, "count": {"doc_count": 1},
+			 "status": {"buckets": [{"key": "paid", "doc_count": 1}]}}
+		]},
+		"max_amount": {"value": 20},
+		"by_day": {"buckets": {"2024-01-01": {"doc_count": 4}}}
+	}`), &fake.aggs))
+
+	rows, err := connector.Query(context.Background(), `{"size": 0, "aggs": {}}`, "orders")
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, map[string]interface{}{
+		"by_day": "2024-01-01", "region": "eu", "status": "paid", "doc_count": float64(2),
+		"sum_amount": float64(30), "count": float64(3), "max_amount": float64(20),
+	}, rows[0])
+	assert.Equal(t, "open", rows[1]["status"])
+	assert.Equal(t, "us", rows[2]["region"])
+	assert.Equal(t, float64(5), rows[2]["sum_amount"])
+}
+
+func TestElasticsearchConnectorErrors(t *testing.T) {
+	ctx := context.Background()
+	_, server := newFakeElasticsearch(t, 1)
+
+	connector := NewElasticsearchConnector(&Config{BaseURL: server.URL, Username: "elastic", Password: "wrong"})
+	err := connector.Connect(ctx)
+	require.Error(t, err)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypePermission))
+	assert.True(t, strings.Contains(err.Error(), "security_exception"))
+
+	connector, _ = newTestElasticsearchConnector(t, 1)
+	_, err = connector.Query(ctx, `{}`, "missing")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+
+	_, err = connector.Query(ctx, `{"size": "ten"}`, "orders")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeQuery))
+
+	_, err = connector.Query(ctx, `not json`, "orders")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeQuery))
+}
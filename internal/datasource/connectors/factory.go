@@ -15,8 +15,22 @@ func ConnectorFactory(config *Config) (Connector, error) {
 		return NewMongoConnector(config), nil
 	case "api":
 		return NewAPIConnector(config), nil
+	case "graphql":
+		return NewGraphQLConnector(config), nil
 	case "file":
 		return NewFileConnector(config), nil
+	case "s3":
+		return NewS3Connector(config), nil
+	case "elasticsearch", "opensearch":
+		return NewElasticsearchConnector(config), nil
+	case "cassandra":
+		return NewCassandraConnector(config), nil
+	case "clickhouse":
+		return NewClickHouseConnector(config), nil
+	case "kafka":
+		return NewKafkaConnector(config), nil
+	case "prometheus":
+		return NewPrometheusConnector(config), nil
 	default:
 		return nil, fmt.Errorf("unsupported connector type: %s", config.Type)
 	}
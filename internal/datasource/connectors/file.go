@@ -2,21 +2,44 @@
 package connectors
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"pkg/common/errors"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// File write commands accepted by FileConnector.Execute.
+const (
+	// FileCommandInsert adds rows to a file, creating it if it does not exist.
+	FileCommandInsert = "insert"
+	// FileCommandAppend adds rows to an existing file.
+	FileCommandAppend = "append"
+	// FileCommandOverwrite replaces the contents of a file with the given rows.
+	FileCommandOverwrite = "overwrite"
 )
 
 // FileConnector implements the Connector interface for file-based data sources.
-// It supports reading data from JSON and CSV files.
+// It supports reading and writing JSON, NDJSON and CSV files, and reading Parquet files.
 type FileConnector struct {
 	config   *Config
 	basePath string
+
+	// offsets holds the positions of tail subscriptions, once one has started.
+	offsets   *checkpointStore
+	offsetsMu sync.Mutex
 }
 
 // NewFileConnector creates a new FileConnector with the given configuration.
@@ -69,7 +92,7 @@ func (c *FileConnector) Close(ctx context.Context) error {
 
 // Query reads data from a file and returns the results.
 // The query parameter is treated as a relative file path from the base path.
-// It supports JSON and CSV file formats.
+// It supports JSON, NDJSON (.ndjson, .jsonl), CSV and Parquet file formats.
 //
 // Example:
 //
@@ -83,23 +106,51 @@ func (c *FileConnector) Close(ctx context.Context) error {
 //	    }
 //	}
 func (c *FileConnector) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
-	filePath := filepath.Join(c.basePath, query)
-	ext := filepath.Ext(filePath)
-
-	switch ext {
-	case ".json":
-		return c.readJSONFile(filePath)
-	case ".csv":
-		return c.readCSVFile(filePath)
-	default:
-		return nil, errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("unsupported file type: %s", ext), nil)
+	filePath, err := c.resolvePath(query)
+	if err != nil {
+		return nil, err
 	}
+	return readFile(filePath)
 }
 
-// Execute is not supported for file connector.
-// It always returns an error indicating that the operation is not supported.
+// Execute writes rows to a file under the base path and returns the number of rows written.
+// The command is one of FileCommandInsert, FileCommandAppend or FileCommandOverwrite,
+// args[0] is the relative file path and args[1] holds the rows, either as a single
+// map[string]interface{} or as a []map[string]interface{}.
+//
+// Writes go to a temporary file in the same directory which is then renamed over the
+// target, so readers never observe a partially written file. Concurrent writers to the
+// same file are serialized with an exclusive lock on a sidecar lock file.
+//
+// Example:
+//
+//	ctx := context.Background()
+//	rows := []map[string]interface{}{{"id": 1, "name": "Ada"}}
+//	written, err := connector.Execute(ctx, FileCommandAppend, "users.ndjson", rows)
+//	if err != nil {
+//	    log.Printf("Write failed: %v", err)
+//	}
 func (c *FileConnector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
-	return 0, errors.NewError(errors.ErrorTypeUnsupported, "execute operation is not supported for file connector", nil)
+	op, err := c.parseWriteOp(command, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	unlock, err := lockFile(ctx, op.path)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	rows, err := applyWriteOps(op.path, []fileWriteOp{op})
+	if err != nil {
+		return 0, err
+	}
+	if err := commitFiles(map[string][]map[string]interface{}{op.path: rows}); err != nil {
+		return 0, err
+	}
+
+	return int64(len(op.rows)), nil
 }
 
 // Ping checks if the base path is accessible.
@@ -122,21 +173,372 @@ func (c *FileConnector) Ping(ctx context.Context) error {
 	return nil
 }
 
-// Transaction is not supported for file connector.
-// It always returns an error indicating that transactions are not supported.
+// Transaction starts a new file transaction and returns a TransactionConnector.
+// Writes executed within the transaction are staged in memory and only reach the
+// files on Commit. Queries within the transaction see the staged writes.
 func (c *FileConnector) Transaction(ctx context.Context) (TransactionConnector, error) {
-	return nil, errors.NewError(errors.ErrorTypeUnsupported, "transactions are not supported for file connector", nil)
+	return &FileTransactionConnector{connector: c, staged: make(map[string][]fileWriteOp)}, nil
+}
+
+// Path returns the absolute path of a file under the base path, as Query and Execute
+// resolve it.
+func (c *FileConnector) Path(name string) (string, error) {
+	return c.resolvePath(name)
+}
+
+// resolvePath joins a relative path onto the base path and ensures the result
+// does not escape the base directory.
+func (c *FileConnector) resolvePath(name string) (string, error) {
+	base, err := filepath.Abs(c.basePath)
+	if err != nil {
+		return "", errors.NewError(errors.ErrorTypeFileConnection, "failed to resolve base path", err)
+	}
+	filePath := filepath.Join(base, name)
+	if filePath != base && !strings.HasPrefix(filePath, base+string(filepath.Separator)) {
+		return "", errors.NewError(errors.ErrorTypePermission, fmt.Sprintf("path %q is outside the base path", name), nil)
+	}
+	return filePath, nil
+}
+
+// fileWriteOp is a single staged or immediate write against one file.
+type fileWriteOp struct {
+	command string
+	path    string
+	rows    []map[string]interface{}
+}
+
+// parseWriteOp validates the arguments of an Execute call.
+func (c *FileConnector) parseWriteOp(command string, args ...interface{}) (fileWriteOp, error) {
+	switch command {
+	case FileCommandInsert, FileCommandAppend, FileCommandOverwrite:
+	default:
+		return fileWriteOp{}, errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("unsupported file command: %s", command), nil)
+	}
+
+	if len(args) < 2 {
+		return fileWriteOp{}, errors.NewError(errors.ErrorTypeExecution, "missing file path or rows", nil)
+	}
+	name, ok := args[0].(string)
+	if !ok || name == "" {
+		return fileWriteOp{}, errors.NewError(errors.ErrorTypeExecution, "invalid file path", nil)
+	}
+
+	filePath, err := c.resolvePath(name)
+	if err != nil {
+		return fileWriteOp{}, err
+	}
+	format, err := fileFormatOf(filePath)
+	if err != nil {
+		return fileWriteOp{}, err
+	}
+	if format == fileFormatParquet {
+		return fileWriteOp{}, errors.NewError(errors.ErrorTypeUnsupported, "writing Parquet files is not supported", nil)
+	}
+
+	var rows []map[string]interface{}
+	switch v := args[1].(type) {
+	case map[string]interface{}:
+		rows = []map[string]interface{}{v}
+	case []map[string]interface{}:
+		rows = v
+	default:
+		return fileWriteOp{}, errors.NewError(errors.ErrorTypeExecution, "invalid rows format", nil)
+	}
+
+	return fileWriteOp{command: command, path: filePath, rows: rows}, nil
+}
+
+// applyWriteOps reads the current contents of a file and applies the given writes,
+// returning the rows the file should hold afterwards.
+func applyWriteOps(filePath string, ops []fileWriteOp) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	_, err := os.Stat(filePath)
+	exists := err == nil
+	if exists {
+		if rows, err = readFile(filePath); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errors.NewError(errors.ErrorTypeFileConnection, "failed to access file", err)
+	}
+
+	for _, op := range ops {
+		switch op.command {
+		case FileCommandAppend:
+			if !exists {
+				return nil, errors.NewError(errors.ErrorTypeNotFound, fmt.Sprintf("file %s does not exist", filepath.Base(filePath)), nil)
+			}
+			rows = append(rows, op.rows...)
+		case FileCommandInsert:
+			rows = append(rows, op.rows...)
+		case FileCommandOverwrite:
+			rows = append([]map[string]interface{}(nil), op.rows...)
+		}
+		exists = true
+	}
+
+	return rows, nil
+}
+
+// lockPollInterval is how often lockFile retries a lock held by another writer.
+const lockPollInterval = 10 * time.Millisecond
+
+// lockFile takes an exclusive lock on a sidecar lock file next to filePath, waiting for
+// other writers until ctx is done. The data file itself cannot be locked because writes
+// replace it by rename. The returned function releases the lock.
+func lockFile(ctx context.Context, filePath string) (func() error, error) {
+	lockPath := filepath.Join(filepath.Dir(filePath), "."+filepath.Base(filePath)+".lock")
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeFileConnection, "failed to open lock file", err)
+	}
+
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, errors.NewError(errors.ErrorTypeFileConnection, "failed to lock file", err)
+		}
+		if locked {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, errors.NewError(errors.ErrorTypeTimeout, "timed out waiting for file lock", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	return func() error {
+		defer file.Close()
+		return unlockFile(file)
+	}, nil
+}
+
+// commitFiles writes every file to a temporary sibling and then renames them into
+// place. If any temporary file cannot be written, none of the targets are touched.
+// Each file is replaced atomically, but a commit of several files is not: if a rename
+// fails, the files already replaced are restored from hard-linked backups, and a crash
+// part way through the renames leaves the files replaced so far.
+func commitFiles(files map[string][]map[string]interface{}) error {
+	paths := make([]string, 0, len(files))
+	for filePath := range files {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	temps := make(map[string]string, len(files))
+	backups := make(map[string]string, len(files))
+	cleanup := func() {
+		for _, tmp := range temps {
+			os.Remove(tmp)
+		}
+		for _, backup := range backups {
+			os.Remove(backup)
+		}
+	}
+	defer cleanup()
+
+	for _, filePath := range paths {
+		tmp, err := writeTempFile(filePath, files[filePath])
+		if err != nil {
+			return err
+		}
+		temps[filePath] = tmp
+	}
+
+	// Keep the current contents of every existing target, to restore them if a later
+	// rename fails.
+	if len(paths) > 1 {
+		for _, filePath := range paths {
+			backup := temps[filePath] + ".bak"
+			err := os.Link(filePath, backup)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return errors.NewError(errors.ErrorTypeExecution, "failed to back up file", err)
+			}
+			backups[filePath] = backup
+		}
+	}
+
+	var replaced []string
+	for _, filePath := range paths {
+		if err := os.Rename(temps[filePath], filePath); err != nil {
+			for _, done := range replaced {
+				if backup, ok := backups[done]; ok {
+					os.Rename(backup, done)
+				} else {
+					os.Remove(done)
+				}
+			}
+			return errors.NewError(errors.ErrorTypeExecution, "failed to replace file", err)
+		}
+		delete(temps, filePath)
+		replaced = append(replaced, filePath)
+	}
+
+	return nil
+}
+
+// writeTempFile encodes rows in the format of filePath into a synced temporary
+// file in the same directory and returns its path.
+func writeTempFile(filePath string, rows []map[string]interface{}) (string, error) {
+	format, err := fileFormatOf(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	var headers []string
+	if format == fileFormatCSV {
+		headers = csvHeaders(filePath, rows)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return "", errors.NewError(errors.ErrorTypeExecution, "failed to create temporary file", err)
+	}
+
+	// CreateTemp makes the file 0600; the rename would give the target that mode, so keep
+	// the mode of the file being replaced.
+	mode := os.FileMode(0o644)
+	if info, statErr := os.Stat(filePath); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", errors.NewError(errors.ErrorTypeExecution, "failed to set temporary file mode", err)
+	}
+
+	w := bufio.NewWriter(tmp)
+	switch format {
+	case fileFormatJSON:
+		err = encodeJSON(w, rows)
+	case fileFormatNDJSON:
+		err = encodeNDJSON(w, rows)
+	case fileFormatCSV:
+		err = encodeCSV(w, headers, rows)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", errors.NewError(errors.ErrorTypeExecution, "failed to write temporary file", err)
+	}
+
+	return tmp.Name(), nil
+}
+
+// csvHeaders keeps the column order of an existing CSV file and adds any new
+// columns from rows in sorted order.
+func csvHeaders(filePath string, rows []map[string]interface{}) []string {
+	var headers []string
+	if file, err := os.Open(filePath); err == nil {
+		headers, _ = csv.NewReader(file).Read()
+		file.Close()
+	}
+
+	seen := make(map[string]bool, len(headers))
+	for _, h := range headers {
+		seen[h] = true
+	}
+	var extra []string
+	for _, row := range rows {
+		for k := range row {
+			if !seen[k] {
+				seen[k] = true
+				extra = append(extra, k)
+			}
+		}
+	}
+	sort.Strings(extra)
+
+	return append(headers, extra...)
+}
+
+// fileFormat identifies the encoding of a data file.
+type fileFormat string
+
+const (
+	fileFormatJSON    fileFormat = "json"
+	fileFormatNDJSON  fileFormat = "ndjson"
+	fileFormatCSV     fileFormat = "csv"
+	fileFormatParquet fileFormat = "parquet"
+)
+
+// fileFormatOf returns the format of a file based on its extension.
+func fileFormatOf(filePath string) (fileFormat, error) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	switch ext {
+	case ".json":
+		return fileFormatJSON, nil
+	case ".ndjson", ".jsonl":
+		return fileFormatNDJSON, nil
+	case ".csv":
+		return fileFormatCSV, nil
+	case ".parquet":
+		return fileFormatParquet, nil
+	default:
+		return "", errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("unsupported file type: %s", ext), nil)
+	}
 }
 
-// readJSONFile reads and parses a JSON file, returning the data as a slice of maps.
-// It's used internally by the Query method for JSON files.
-func (c *FileConnector) readJSONFile(filePath string) ([]map[string]interface{}, error) {
-	data, err := os.ReadFile(filePath)
+// readFile opens a data file and decodes it according to its extension.
+func readFile(filePath string) ([]map[string]interface{}, error) {
+	format, err := fileFormatOf(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("failed to open %s file", strings.ToUpper(string(format))), err)
+	}
+	defer file.Close()
+
+	return decodeRows(format, file)
+}
+
+// decodeRows parses rows of the given format from r.
+// It is shared by every connector that reads data files.
+func decodeRows(format fileFormat, r io.Reader) ([]map[string]interface{}, error) {
+	switch format {
+	case fileFormatJSON:
+		return decodeJSON(r)
+	case fileFormatNDJSON:
+		return decodeNDJSON(r)
+	case fileFormatCSV:
+		return decodeCSV(r)
+	case fileFormatParquet:
+		return decodeParquet(r)
+	default:
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("unsupported file type: %s", format), nil)
+	}
+}
+
+// decodeJSON parses a JSON array of objects.
+func decodeJSON(r io.Reader) ([]map[string]interface{}, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
 		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to read JSON file", err)
 	}
 
 	var result []map[string]interface{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return result, nil
+	}
 	err = json.Unmarshal(data, &result)
 	if err != nil {
 		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to unmarshal JSON data", err)
@@ -145,17 +547,36 @@ func (c *FileConnector) readJSONFile(filePath string) ([]map[string]interface{},
 	return result, nil
 }
 
-// readCSVFile reads and parses a CSV file, returning the data as a slice of maps.
-// It's used internally by the Query method for CSV files.
-// The first row of the CSV file is expected to contain headers.
-func (c *FileConnector) readCSVFile(filePath string) ([]map[string]interface{}, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to open CSV file", err)
+// decodeNDJSON parses newline-delimited JSON objects, skipping blank lines.
+func decodeNDJSON(r io.Reader) ([]map[string]interface{}, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var result []map[string]interface{}
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var row map[string]interface{}
+		if err := json.Unmarshal(text, &row); err != nil {
+			return nil, errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("failed to unmarshal NDJSON line %d", line), err)
+		}
+		result = append(result, row)
 	}
-	defer file.Close()
+	if err := scanner.Err(); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to read NDJSON data", err)
+	}
+
+	return result, nil
+}
 
-	reader := csv.NewReader(file)
+// decodeCSV parses CSV data, returning the data as a slice of maps.
+// The first row of the CSV data is expected to contain headers.
+func decodeCSV(r io.Reader) ([]map[string]interface{}, error) {
+	reader := csv.NewReader(r)
 	records, err := reader.ReadAll()
 	if err != nil {
 		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to read CSV data", err)
@@ -178,3 +599,174 @@ func (c *FileConnector) readCSVFile(filePath string) ([]map[string]interface{},
 
 	return result, nil
 }
+
+// decodeParquet reads every row of a Parquet file.
+// Parquet needs random access to its footer, so the data is buffered in memory.
+func decodeParquet(r io.Reader) ([]map[string]interface{}, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to read Parquet file", err)
+	}
+
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to open Parquet data", err)
+	}
+
+	reader := parquet.NewGenericReader[map[string]interface{}](file, file.Schema())
+	defer reader.Close()
+
+	rows := make([]map[string]interface{}, file.NumRows())
+	for i := range rows {
+		rows[i] = make(map[string]interface{})
+	}
+	n, err := reader.Read(rows)
+	if err != nil && err != io.EOF {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to decode Parquet data", err)
+	}
+	return rows[:n], nil
+}
+
+// encodeJSON writes rows as an indented JSON array.
+func encodeJSON(w io.Writer, rows []map[string]interface{}) error {
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rows)
+}
+
+// encodeNDJSON writes one JSON object per line.
+func encodeNDJSON(w io.Writer, rows []map[string]interface{}) error {
+	encoder := json.NewEncoder(w)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeCSV writes a header row followed by one record per row.
+// Missing and nil values are written as empty fields.
+func encodeCSV(w io.Writer, headers []string, rows []map[string]interface{}) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(headers); err != nil {
+		return err
+	}
+
+	record := make([]string, len(headers))
+	for _, row := range rows {
+		for i, h := range headers {
+			if v, ok := row[h]; ok && v != nil {
+				record[i] = fmt.Sprintf("%v", v)
+			} else {
+				record[i] = ""
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// FileTransactionConnector implements the TransactionConnector interface for files.
+type FileTransactionConnector struct {
+	connector *FileConnector
+	staged    map[string][]fileWriteOp
+	mu        sync.Mutex
+	done      bool
+}
+
+// Query reads a file within the transaction, including any writes staged against it.
+func (c *FileTransactionConnector) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	filePath, err := c.connector.resolvePath(query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	ops := c.staged[filePath]
+	c.mu.Unlock()
+
+	if len(ops) == 0 {
+		return readFile(filePath)
+	}
+	return applyWriteOps(filePath, ops)
+}
+
+// Execute stages a write within the transaction and returns the number of rows staged.
+// Nothing is written to disk until Commit.
+func (c *FileTransactionConnector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
+	op, err := c.connector.parseWriteOp(command, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.done {
+		return 0, errors.NewError(errors.ErrorTypeTransaction, "transaction already finished", nil)
+	}
+	c.staged[op.path] = append(c.staged[op.path], op)
+	return int64(len(op.rows)), nil
+}
+
+// Commit locks every file touched by the transaction, applies the staged writes
+// against the current contents and renames the results into place.
+func (c *FileTransactionConnector) Commit(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.done {
+		return errors.NewError(errors.ErrorTypeTransaction, "transaction already finished", nil)
+	}
+	c.done = true
+
+	// Lock in a stable order so concurrent transactions cannot deadlock.
+	paths := make([]string, 0, len(c.staged))
+	for p := range c.staged {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		unlock, err := lockFile(ctx, p)
+		if err != nil {
+			return errors.NewError(errors.ErrorTypeTransaction, "failed to lock file", err)
+		}
+		defer unlock()
+	}
+
+	files := make(map[string][]map[string]interface{}, len(paths))
+	for _, p := range paths {
+		rows, err := applyWriteOps(p, c.staged[p])
+		if err != nil {
+			return errors.NewError(errors.ErrorTypeTransaction, "failed to apply staged writes", err)
+		}
+		files[p] = rows
+	}
+
+	if err := commitFiles(files); err != nil {
+		return errors.NewError(errors.ErrorTypeTransaction, "failed to commit transaction", err)
+	}
+	return nil
+}
+
+// Rollback discards all staged writes.
+func (c *FileTransactionConnector) Rollback(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.done {
+		return errors.NewError(errors.ErrorTypeTransaction, "transaction already finished", nil)
+	}
+	c.done = true
+	c.staged = nil
+	return nil
+}
@@ -0,0 +1,395 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"pkg/common/errors"
+)
+
+// fileCheckpointName is the file, inside Config.StatePath, that holds tail offsets.
+const fileCheckpointName = "file-offsets.json"
+
+// fingerprintSize is how many leading bytes of a file identify it across restarts.
+const fingerprintSize = 256
+
+// TailOptions configures a FileConnector subscription.
+type TailOptions struct {
+	// Format is the log line format. Defaults to LogFormatRaw.
+	Format LogFormat
+	// Pattern is the regular expression with named groups used by LogFormatRegex.
+	Pattern string
+	// FromBeginning starts reading at the beginning of the file when no saved offset exists.
+	// By default a new subscription only delivers lines written after it starts.
+	FromBeginning bool
+	// PollInterval is how often the file is checked for new data. Defaults to one second.
+	PollInterval time.Duration
+	// BufferSize is the capacity of the Events channel.
+	BufferSize int
+}
+
+// tailCheckpoint is the persisted position of a followed file.
+// The fingerprint of its first bytes detects when the file was replaced while
+// the connector was not running.
+type tailCheckpoint struct {
+	Offset         int64  `json:"offset"`
+	FingerprintLen int    `json:"fingerprint_len"`
+	Fingerprint    uint32 `json:"fingerprint"`
+}
+
+// Subscribe follows a growing log file and delivers each new line as an event.
+// The topic is a file path relative to the base path and args may hold a TailOptions.
+//
+// The subscription survives log rotation: when the file is renamed away and recreated
+// it finishes reading the old file and continues with the new one, and when the file is
+// truncated it starts again from the beginning. Offsets are saved under Config.StatePath,
+// or under the user's cache directory if no state path is set, so a new subscription to
+// the same file resumes where the previous one stopped.
+//
+// Example:
+//
+//	sub, err := connector.Subscribe(ctx, "access.log", TailOptions{Format: LogFormatCombined})
+//	if err != nil {
+//	    log.Fatalf("Failed to follow log: %v", err)
+//	}
+//	defer sub.Close()
+//	for event := range sub.Events() {
+//	    fmt.Printf("%s %v\n", event.Data["method"], event.Data["status"])
+//	}
+func (c *FileConnector) Subscribe(ctx context.Context, topic string, args ...interface{}) (Subscription, error) {
+	var opts TailOptions
+	if len(args) > 0 {
+		switch v := args[0].(type) {
+		case TailOptions:
+			opts = v
+		case *TailOptions:
+			opts = *v
+		default:
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "invalid tail options", nil)
+		}
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+
+	filePath, err := c.resolvePath(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	parser, err := newLogParser(opts.Format, opts.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := c.tailOffsets()
+	if err != nil {
+		return nil, err
+	}
+
+	sub, subCtx := newSubscription(ctx, opts.BufferSize)
+	t := &fileTailer{
+		source: topic,
+		path:   filePath,
+		parser: parser,
+		store:  store,
+		opts:   opts,
+		sub:    sub,
+	}
+	go t.run(subCtx)
+
+	return sub, nil
+}
+
+// tailOffsets returns the connector's tail offset store, opening it on first use. All
+// subscriptions share one store, so that they do not overwrite each other's offsets.
+func (c *FileConnector) tailOffsets() (*checkpointStore, error) {
+	c.offsetsMu.Lock()
+	defer c.offsetsMu.Unlock()
+	if c.offsets == nil {
+		stateDir := c.config.StatePath
+		if stateDir == "" {
+			stateDir = defaultTailStateDir(c.basePath)
+		}
+		store, err := newCheckpointStore(stateDir, fileCheckpointName)
+		if err != nil {
+			return nil, err
+		}
+		c.offsets = store
+	}
+	return c.offsets, nil
+}
+
+// defaultTailStateDir is where tail offsets are kept without a state path: a directory of
+// the user's cache, or of the temporary directory, named after the base path. It is kept
+// out of the base path, where the state file would be read as a data file.
+func defaultTailStateDir(basePath string) string {
+	root, err := os.UserCacheDir()
+	if err != nil {
+		root = os.TempDir()
+	}
+	if abs, err := filepath.Abs(basePath); err == nil {
+		basePath = abs
+	}
+	sum := sha256.Sum256([]byte(basePath))
+	return filepath.Join(root, "datasource", "file-tail", hex.EncodeToString(sum[:8]))
+}
+
+// fileTailer follows a single file for a subscription.
+type fileTailer struct {
+	source string
+	path   string
+	parser logParser
+	store  *checkpointStore
+	opts   TailOptions
+	sub    *subscription
+
+	file    *os.File
+	info    os.FileInfo
+	offset  int64  // end of the last delivered line
+	pending []byte // bytes read past offset that do not yet form a complete line
+	started bool   // whether the first file has been opened
+}
+
+// run polls the file until the subscription is closed.
+func (t *fileTailer) run(ctx context.Context) {
+	var err error
+	defer func() {
+		if t.file != nil {
+			t.file.Close()
+		}
+		t.sub.finish(ctx, err)
+	}()
+
+	ticker := time.NewTicker(t.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err = t.poll(ctx); err != nil || ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// poll reads any new lines and then checks whether the file was rotated or truncated.
+func (t *fileTailer) poll(ctx context.Context) error {
+	if t.file == nil {
+		opened, err := t.open()
+		if err != nil || !opened {
+			return err
+		}
+	}
+
+	if err := t.readLines(ctx); err != nil {
+		return err
+	}
+
+	current, err := os.Stat(t.path)
+	switch {
+	case os.IsNotExist(err):
+		// Renamed away and not yet recreated; keep draining the old file.
+		return nil
+	case err != nil:
+		return errors.NewError(errors.ErrorTypeFileConnection, "failed to stat followed file", err)
+	case !os.SameFile(t.info, current):
+		// Rotated: the old file was fully read above, so flush any unterminated
+		// final line and switch to the new file from its beginning.
+		if len(t.pending) > 0 {
+			t.offset += int64(len(t.pending))
+			if !t.emit(ctx, string(t.pending)) {
+				return nil
+			}
+			t.pending = nil
+		}
+		t.file.Close()
+		t.file = nil
+		if _, err := t.open(); err != nil {
+			return err
+		}
+		return t.readLines(ctx)
+	case current.Size() < t.offset+int64(len(t.pending)):
+		// Truncated in place.
+		t.offset = 0
+		t.pending = nil
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return errors.NewError(errors.ErrorTypeFileConnection, "failed to rewind truncated file", err)
+		}
+		return t.readLines(ctx)
+	}
+
+	return nil
+}
+
+// open opens the followed file and positions it. It reports false if the file does not exist yet.
+// The first file opened by a subscription resumes from its checkpoint; files opened after a
+// rotation are always read from the beginning.
+func (t *fileTailer) open() (bool, error) {
+	file, err := os.Open(t.path)
+	if os.IsNotExist(err) {
+		// A file that appears after the subscription started is read from its beginning.
+		t.started = true
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.NewError(errors.ErrorTypeFileConnection, "failed to open followed file", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return false, errors.NewError(errors.ErrorTypeFileConnection, "failed to stat followed file", err)
+	}
+
+	var offset int64
+	if !t.started {
+		offset, err = t.initialOffset(file, info)
+		if err != nil {
+			file.Close()
+			return false, err
+		}
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return false, errors.NewError(errors.ErrorTypeFileConnection, "failed to seek followed file", err)
+	}
+
+	t.file = file
+	t.info = info
+	t.offset = offset
+	t.pending = nil
+	t.started = true
+	return true, nil
+}
+
+// initialOffset decides where a new subscription starts reading.
+func (t *fileTailer) initialOffset(file *os.File, info os.FileInfo) (int64, error) {
+	var cp tailCheckpoint
+	found, err := t.store.Load(t.path, &cp)
+	if err != nil {
+		return 0, err
+	}
+
+	if found {
+		if cp.Offset <= info.Size() && fingerprint(file, cp.FingerprintLen) == cp.Fingerprint {
+			return cp.Offset, nil
+		}
+		// The file was replaced or truncated while we were not running.
+		return 0, nil
+	}
+
+	if t.opts.FromBeginning {
+		return 0, nil
+	}
+	return info.Size(), nil
+}
+
+// readLines reads to the end of the file and delivers every complete line.
+func (t *fileTailer) readLines(ctx context.Context) error {
+	buf := make([]byte, 32*1024)
+	delivered := false
+
+	for {
+		n, err := t.file.Read(buf)
+		if n > 0 {
+			t.pending = append(t.pending, buf[:n]...)
+			for {
+				idx := bytes.IndexByte(t.pending, '\n')
+				if idx < 0 {
+					break
+				}
+				line := t.pending[:idx]
+				t.offset += int64(idx + 1)
+				t.pending = t.pending[idx+1:]
+				line = bytes.TrimSuffix(line, []byte("\r"))
+				if len(bytes.TrimSpace(line)) == 0 {
+					continue
+				}
+				if !t.emit(ctx, string(line)) {
+					return nil
+				}
+				delivered = true
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.NewError(errors.ErrorTypeFileConnection, "failed to read followed file", err)
+		}
+	}
+
+	if delivered {
+		t.saveCheckpoint()
+	}
+	return nil
+}
+
+// emit parses a line and delivers it. Lines that fail to parse are delivered
+// with the raw line in "message" and the reason in "parse_error".
+func (t *fileTailer) emit(ctx context.Context, line string) bool {
+	row, err := t.parser(line)
+	if err != nil {
+		row = map[string]interface{}{"message": line, "parse_error": err.Error()}
+	}
+
+	return t.sub.send(ctx, Event{
+		Source: t.source,
+		Data:   row,
+		Offset: strconv.FormatInt(t.offset, 10),
+		Time:   eventTime(row),
+	})
+}
+
+// saveCheckpoint persists the current offset. Failures are logged rather than
+// ending the subscription, at the cost of re-reading lines after a restart.
+func (t *fileTailer) saveCheckpoint() {
+	n := fingerprintSize
+	if t.offset < int64(n) {
+		n = int(t.offset)
+	}
+	cp := tailCheckpoint{
+		Offset:         t.offset,
+		FingerprintLen: n,
+		Fingerprint:    fingerprint(t.file, n),
+	}
+	if err := t.store.Save(t.path, cp); err != nil {
+		log.Printf("Failed to save offset for %s: %v", t.source, err)
+	}
+}
+
+// fingerprint returns the checksum of the first n bytes of file.
+func fingerprint(file *os.File, n int) uint32 {
+	buf := make([]byte, n)
+	read, _ := file.ReadAt(buf, 0)
+	return crc32.ChecksumIEEE(buf[:read])
+}
+
+// eventTime returns the first timestamp column of a parsed row, or the current time.
+func eventTime(row map[string]interface{}) time.Time {
+	for _, field := range []string{"timestamp", "time_local", "time", "@timestamp"} {
+		switch v := row[field].(type) {
+		case time.Time:
+			return v
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Now()
+}
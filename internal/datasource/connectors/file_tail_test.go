@@ -0,0 +1,330 @@
+package connectors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogParsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  LogFormat
+		pattern string
+		line    string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:   "Raw",
+			format: LogFormatRaw,
+			line:   "hello world",
+			want:   map[string]interface{}{"message": "hello world"},
+		},
+		{
+			name:   "JSON",
+			format: LogFormatJSON,
+			line:   `{"level":"info","msg":"started"}`,
+			want:   map[string]interface{}{"level": "info", "msg": "started"},
+		},
+		{
+			name:    "Invalid JSON",
+			format:  LogFormatJSON,
+			line:    `not json`,
+			wantErr: true,
+		},
+		{
+			name:   "Combined",
+			format: LogFormatCombined,
+			line:   `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`,
+			want: map[string]interface{}{
+				"remote_addr":     "127.0.0.1",
+				"ident":           nil,
+				"remote_user":     "frank",
+				"time_local":      time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+				"request":         "GET /apache_pb.gif HTTP/1.0",
+				"method":          "GET",
+				"path":            "/apache_pb.gif",
+				"protocol":        "HTTP/1.0",
+				"status":          int64(200),
+				"body_bytes_sent": int64(2326),
+				"referer":         "http://www.example.com/start.html",
+				"user_agent":      "Mozilla/4.08",
+			},
+		},
+		{
+			name:   "Common",
+			format: LogFormatCombined,
+			line:   `10.0.0.1 - - [10/Oct/2000:13:55:36 +0000] "POST /login HTTP/1.1" 401 -`,
+			want: map[string]interface{}{
+				"remote_addr":     "10.0.0.1",
+				"ident":           nil,
+				"remote_user":     nil,
+				"time_local":      time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", 0)),
+				"request":         "POST /login HTTP/1.1",
+				"method":          "POST",
+				"path":            "/login",
+				"protocol":        "HTTP/1.1",
+				"status":          int64(401),
+				"body_bytes_sent": nil,
+				"referer":         nil,
+				"user_agent":      nil,
+			},
+		},
+		{
+			name:   "Syslog RFC 5424",
+			format: LogFormatSyslog,
+			line:   `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3"] An application event`,
+			want: map[string]interface{}{
+				"priority":        165,
+				"facility":        20,
+				"severity":        "notice",
+				"timestamp":       time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				"hostname":        "mymachine.example.com",
+				"app_name":        "evntslog",
+				"proc_id":         nil,
+				"msg_id":          "ID47",
+				"structured_data": `[exampleSDID@32473 iut="3"]`,
+				"message":         "An application event",
+			},
+		},
+		{
+			name:    "Not syslog",
+			format:  LogFormatSyslog,
+			line:    "plain text",
+			wantErr: true,
+		},
+		{
+			name:    "Regex",
+			format:  LogFormatRegex,
+			pattern: `^(?P<level>[A-Z]+) (?P<message>.*)$`,
+			line:    "WARN disk almost full",
+			want:    map[string]interface{}{"level": "WARN", "message": "disk almost full"},
+		},
+		{
+			name:    "Regex no match",
+			format:  LogFormatRegex,
+			pattern: `^(?P<level>[A-Z]+):`,
+			line:    "warn: lowercase",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := newLogParser(tt.format, tt.pattern)
+			require.NoError(t, err)
+
+			row, err := parser(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			for k, v := range tt.want {
+				if want, ok := v.(time.Time); ok {
+					assert.True(t, want.Equal(row[k].(time.Time)), "field %s: got %v", k, row[k])
+					continue
+				}
+				assert.Equal(t, v, row[k], "field %s", k)
+			}
+		})
+	}
+}
+
+func TestSyslog3164(t *testing.T) {
+	parser, err := newLogParser(LogFormatSyslog, "")
+	require.NoError(t, err)
+
+	row, err := parser(`<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8`)
+	require.NoError(t, err)
+	assert.Equal(t, 4, row["facility"])
+	assert.Equal(t, "crit", row["severity"])
+	assert.Equal(t, "mymachine", row["hostname"])
+	assert.Equal(t, "su", row["app_name"])
+	assert.Equal(t, "123", row["proc_id"])
+	assert.Equal(t, "'su root' failed for lonvick on /dev/pts/8", row["message"])
+
+	ts, err := parseSyslog3164Time("Dec 31 23:59:59", time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 2023, ts.Year(), "timestamps in the future roll back to the previous year")
+}
+
+func TestLogParserConfiguration(t *testing.T) {
+	_, err := newLogParser(LogFormatRegex, `(unclosed`)
+	assert.Error(t, err)
+
+	_, err = newLogParser(LogFormatRegex, `^\d+$`)
+	assert.Error(t, err, "patterns without named groups are rejected")
+
+	_, err = newLogParser("xml", "")
+	assert.Error(t, err)
+}
+
+// nextEvent waits for the next event on sub.
+func nextEvent(t *testing.T, sub Subscription) Event {
+	t.Helper()
+	select {
+	case event, ok := <-sub.Events():
+		require.True(t, ok, "subscription ended: %v", sub.Err())
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+func appendLines(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	defer file.Close()
+	for _, line := range lines {
+		_, err := file.WriteString(line + "\n")
+		require.NoError(t, err)
+	}
+}
+
+func TestFileConnectorSubscribe(t *testing.T) {
+	// Offsets are kept under the user's cache directory without a state path.
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	ctx := context.Background()
+	opts := TailOptions{Format: LogFormatJSON, PollInterval: 10 * time.Millisecond}
+
+	t.Run("FollowsNewLines", func(t *testing.T) {
+		connector, dir := newTestFileConnector(t)
+		path := filepath.Join(dir, "app.log")
+		appendLines(t, path, `{"n":0}`)
+
+		sub, err := connector.Subscribe(ctx, "app.log", opts)
+		require.NoError(t, err)
+		defer sub.Close()
+
+		// Existing content is skipped unless FromBeginning is set.
+		time.Sleep(50 * time.Millisecond)
+		appendLines(t, path, `{"n":1}`, `not json`)
+
+		event := nextEvent(t, sub)
+		assert.Equal(t, float64(1), event.Data["n"])
+		assert.Equal(t, "app.log", event.Source)
+
+		event = nextEvent(t, sub)
+		assert.Equal(t, "not json", event.Data["message"])
+		assert.Contains(t, event.Data, "parse_error")
+	})
+
+	t.Run("HandlesRotationAndTruncation", func(t *testing.T) {
+		connector, dir := newTestFileConnector(t)
+		path := filepath.Join(dir, "app.log")
+
+		opts := opts
+		opts.FromBeginning = true
+		sub, err := connector.Subscribe(ctx, "app.log", opts)
+		require.NoError(t, err)
+		defer sub.Close()
+
+		appendLines(t, path, `{"n":1}`)
+		assert.Equal(t, float64(1), nextEvent(t, sub).Data["n"])
+
+		// Rename rotation: the last line of the old file is still delivered.
+		appendLines(t, path, `{"n":2}`)
+		require.NoError(t, os.Rename(path, path+".1"))
+		appendLines(t, path, `{"n":3}`)
+		assert.Equal(t, float64(2), nextEvent(t, sub).Data["n"])
+		assert.Equal(t, float64(3), nextEvent(t, sub).Data["n"])
+
+		// Copy-truncate rotation.
+		require.NoError(t, os.Truncate(path, 0))
+		time.Sleep(50 * time.Millisecond)
+		appendLines(t, path, `{"n":4}`)
+		assert.Equal(t, float64(4), nextEvent(t, sub).Data["n"])
+	})
+
+	t.Run("ResumesFromSavedOffset", func(t *testing.T) {
+		connector, dir := newTestFileConnector(t)
+		path := filepath.Join(dir, "app.log")
+		appendLines(t, path, `{"n":1}`, `{"n":2}`)
+
+		opts := opts
+		opts.FromBeginning = true
+		sub, err := connector.Subscribe(ctx, "app.log", opts)
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), nextEvent(t, sub).Data["n"])
+		assert.Equal(t, float64(2), nextEvent(t, sub).Data["n"])
+		require.NoError(t, sub.Close())
+		assert.NoError(t, sub.Err())
+
+		appendLines(t, path, `{"n":3}`)
+
+		sub, err = connector.Subscribe(ctx, "app.log", opts)
+		require.NoError(t, err)
+		defer sub.Close()
+		assert.Equal(t, float64(3), nextEvent(t, sub).Data["n"])
+	})
+
+	t.Run("SharesOffsetsBetweenSubscriptions", func(t *testing.T) {
+		dir := t.TempDir()
+		stateDir := t.TempDir()
+		connector := NewFileConnector(&Config{BasePath: dir, StatePath: stateDir})
+		require.NoError(t, connector.Connect(ctx))
+
+		opts := opts
+		opts.FromBeginning = true
+		names := []string{"a.log", "b.log"}
+		subs := make([]Subscription, len(names))
+		for i, name := range names {
+			appendLines(t, filepath.Join(dir, name), `{"n":1}`)
+			sub, err := connector.Subscribe(ctx, name, opts)
+			require.NoError(t, err)
+			subs[i] = sub
+		}
+		for _, sub := range subs {
+			assert.Equal(t, float64(1), nextEvent(t, sub).Data["n"])
+			require.NoError(t, sub.Close())
+		}
+
+		// Both offsets survive, so each file resumes after its first line.
+		connector = NewFileConnector(&Config{BasePath: dir, StatePath: stateDir})
+		require.NoError(t, connector.Connect(ctx))
+		for _, name := range names {
+			appendLines(t, filepath.Join(dir, name), `{"n":2}`)
+			sub, err := connector.Subscribe(ctx, name, opts)
+			require.NoError(t, err)
+			assert.Equal(t, float64(2), nextEvent(t, sub).Data["n"], name)
+			require.NoError(t, sub.Close())
+		}
+	})
+
+	t.Run("KeepsDefaultStateOutOfBasePath", func(t *testing.T) {
+		connector, dir := newTestFileConnector(t)
+		appendLines(t, filepath.Join(dir, "app.log"), `{"n":1}`)
+
+		opts := opts
+		opts.FromBeginning = true
+		sub, err := connector.Subscribe(ctx, "app.log", opts)
+		require.NoError(t, err)
+		nextEvent(t, sub)
+		require.NoError(t, sub.Close())
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "app.log", entries[0].Name())
+		assert.FileExists(t, filepath.Join(defaultTailStateDir(dir), fileCheckpointName))
+	})
+
+	t.Run("RejectsInvalidOptions", func(t *testing.T) {
+		connector, _ := newTestFileConnector(t)
+
+		_, err := connector.Subscribe(ctx, "../outside.log", opts)
+		assert.Error(t, err)
+
+		_, err = connector.Subscribe(ctx, "app.log", "json")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,219 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFileConnector(t *testing.T) (*FileConnector, string) {
+	t.Helper()
+	dir := t.TempDir()
+	connector := NewFileConnector(&Config{BasePath: dir})
+	require.NoError(t, connector.Connect(context.Background()))
+	return connector, dir
+}
+
+func TestFileConnectorWriteFormats(t *testing.T) {
+	ctx := context.Background()
+
+	for _, name := range []string{"users.json", "users.ndjson", "users.jsonl", "users.csv"} {
+		t.Run(name, func(t *testing.T) {
+			connector, _ := newTestFileConnector(t)
+
+			n, err := connector.Execute(ctx, FileCommandInsert, name, []map[string]interface{}{
+				{"id": "1", "name": "Ada"},
+				{"id": "2", "name": "Grace"},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), n)
+
+			n, err = connector.Execute(ctx, FileCommandAppend, name, map[string]interface{}{"id": "3", "name": "Linus"})
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+
+			rows, err := connector.Query(ctx, name)
+			require.NoError(t, err)
+			require.Len(t, rows, 3)
+			assert.Equal(t, "Linus", rows[2]["name"])
+
+			_, err = connector.Execute(ctx, FileCommandOverwrite, name, []map[string]interface{}{{"id": "9", "name": "Barbara"}})
+			require.NoError(t, err)
+
+			rows, err = connector.Query(ctx, name)
+			require.NoError(t, err)
+			require.Len(t, rows, 1)
+			assert.Equal(t, "Barbara", rows[0]["name"])
+		})
+	}
+}
+
+func TestFileConnectorCSVAddsNewColumns(t *testing.T) {
+	ctx := context.Background()
+	connector, dir := newTestFileConnector(t)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "people.csv"), []byte("name,id\nAda,1\n"), 0o644))
+
+	_, err := connector.Execute(ctx, FileCommandAppend, "people.csv", map[string]interface{}{"id": 2, "name": "Grace", "city": "NYC"})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(dir, "people.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "name,id,city\nAda,1,\nGrace,2,NYC\n", string(data))
+}
+
+func TestFileConnectorWriteErrors(t *testing.T) {
+	ctx := context.Background()
+	connector, _ := newTestFileConnector(t)
+	rows := map[string]interface{}{"id": 1}
+
+	_, err := connector.Execute(ctx, FileCommandAppend, "missing.json", rows)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+
+	_, err = connector.Execute(ctx, FileCommandInsert, "../escape.json", rows)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypePermission))
+
+	_, err = connector.Execute(ctx, FileCommandInsert, "data.xml", rows)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+
+	_, err = connector.Execute(ctx, "truncate", "data.json", rows)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+
+	_, err = connector.Execute(ctx, FileCommandInsert, "data.json")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeExecution))
+}
+
+func TestFileConnectorConcurrentWriters(t *testing.T) {
+	ctx := context.Background()
+	connector, dir := newTestFileConnector(t)
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := connector.Execute(ctx, FileCommandInsert, "events.ndjson", map[string]interface{}{"n": i})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	rows, err := connector.Query(ctx, "events.ndjson")
+	require.NoError(t, err)
+	assert.Len(t, rows, writers)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), ".tmp", "temporary files should be cleaned up")
+	}
+}
+
+func TestFileConnectorKeepsFileMode(t *testing.T) {
+	ctx := context.Background()
+	connector, dir := newTestFileConnector(t)
+
+	path := filepath.Join(dir, "users.ndjson")
+	require.NoError(t, os.WriteFile(path, []byte(`{"id": 1}`+"\n"), 0o640))
+	require.NoError(t, os.Chmod(path, 0o640))
+	_, err := connector.Execute(ctx, FileCommandAppend, "users.ndjson", map[string]interface{}{"id": 2})
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+}
+
+func TestFileLockHonorsContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	unlock, err := lockFile(context.Background(), path)
+	require.NoError(t, err)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = lockFile(ctx, path)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeTimeout), "%v", err)
+}
+
+func TestFileTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Commit", func(t *testing.T) {
+		connector, dir := newTestFileConnector(t)
+
+		tx, err := connector.Transaction(ctx)
+		require.NoError(t, err)
+
+		_, err = tx.Execute(ctx, FileCommandInsert, "a.json", map[string]interface{}{"id": "a"})
+		require.NoError(t, err)
+		_, err = tx.Execute(ctx, FileCommandInsert, "b.csv", map[string]interface{}{"id": "b"})
+		require.NoError(t, err)
+
+		rows, err := tx.Query(ctx, "a.json")
+		require.NoError(t, err)
+		assert.Len(t, rows, 1, "staged writes should be visible inside the transaction")
+
+		_, err = os.Stat(filepath.Join(dir, "a.json"))
+		assert.True(t, os.IsNotExist(err), "staged writes should not reach disk before commit")
+
+		require.NoError(t, tx.Commit(ctx))
+
+		for _, name := range []string{"a.json", "b.csv"} {
+			rows, err := connector.Query(ctx, name)
+			require.NoError(t, err)
+			assert.Len(t, rows, 1, fmt.Sprintf("%s should be committed", name))
+		}
+
+		_, err = tx.Execute(ctx, FileCommandInsert, "a.json", map[string]interface{}{"id": "c"})
+		assert.True(t, errors.IsErrorType(err, errors.ErrorTypeTransaction))
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		connector, dir := newTestFileConnector(t)
+
+		tx, err := connector.Transaction(ctx)
+		require.NoError(t, err)
+
+		_, err = tx.Execute(ctx, FileCommandOverwrite, "a.json", map[string]interface{}{"id": "a"})
+		require.NoError(t, err)
+		require.NoError(t, tx.Rollback(ctx))
+
+		_, err = os.Stat(filepath.Join(dir, "a.json"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("FailedCommitLeavesFilesUntouched", func(t *testing.T) {
+		connector, dir := newTestFileConnector(t)
+
+		_, err := connector.Execute(ctx, FileCommandInsert, "a.json", map[string]interface{}{"id": "original"})
+		require.NoError(t, err)
+
+		tx, err := connector.Transaction(ctx)
+		require.NoError(t, err)
+		_, err = tx.Execute(ctx, FileCommandOverwrite, "a.json", map[string]interface{}{"id": "changed"})
+		require.NoError(t, err)
+		_, err = tx.Execute(ctx, FileCommandAppend, "missing.json", map[string]interface{}{"id": "x"})
+		require.NoError(t, err)
+
+		assert.Error(t, tx.Commit(ctx))
+
+		rows, err := connector.Query(ctx, "a.json")
+		require.NoError(t, err)
+		require.Len(t, rows, 1)
+		assert.Equal(t, "original", rows[0]["id"])
+
+		_, err = os.Stat(filepath.Join(dir, "missing.json"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,612 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"pkg/common/errors"
+)
+
+// defaultGraphQLCursorVariable is the variable that receives the Relay end cursor of the
+// previous page.
+const defaultGraphQLCursorVariable = "after"
+
+// GraphQLRequest configures a GraphQL query or mutation.
+type GraphQLRequest struct {
+	// Variables are sent with the document.
+	Variables map[string]interface{}
+	// OperationName selects an operation when the document defines several.
+	OperationName string
+	// RecordsPath selects the records in the response data, such as "viewer.repositories.nodes".
+	// Defaults to the records_path option. Without either, the records are the nodes of the
+	// Relay connection found by following single fields from the root, or the value of the
+	// only root field.
+	RecordsPath string
+	// ConnectionPath locates the Relay connection whose pageInfo drives pagination, such as
+	// "viewer.repositories". Defaults to the connection found from the root.
+	ConnectionPath string
+	// CursorVariable receives the end cursor of the previous page. The document must declare
+	// it, as in query($after: String). Defaults to the cursor_variable option, or "after".
+	CursorVariable string
+	// MaxPages and MaxRows cap pagination. They default to the max_pages and max_rows options.
+	MaxPages int
+	MaxRows  int
+	// KeepNested leaves nested objects in the records as maps, instead of flattening them
+	// into columns named by their path, such as "owner.login".
+	KeepNested bool
+}
+
+// GraphQLSchema describes a GraphQL schema, as returned by introspection.
+type GraphQLSchema struct {
+	QueryType        string
+	MutationType     string
+	SubscriptionType string
+	Types            []GraphQLType
+}
+
+// GraphQLType is a named type of a schema. Fields is set for objects and interfaces, and
+// InputFields for input objects.
+type GraphQLType struct {
+	Name        string
+	Kind        string
+	Description string
+	Fields      []GraphQLField
+	InputFields []GraphQLField
+	EnumValues  []string
+}
+
+// GraphQLField is a field or input field. Type is written as in the schema language, such
+// as "[Repository!]!".
+type GraphQLField struct {
+	Name        string
+	Type        string
+	Description string
+	Args        []GraphQLField
+}
+
+// Type returns the named type, or nil if the schema has none.
+func (s *GraphQLSchema) Type(name string) *GraphQLType {
+	for i := range s.Types {
+		if s.Types[i].Name == name {
+			return &s.Types[i]
+		}
+	}
+	return nil
+}
+
+// GraphQLConnector implements the Connector and Streamer interfaces for GraphQL APIs. It
+// shares the HTTP handling of APIConnector, including authentication, headers, retries and
+// the mapping of HTTP statuses to errors.
+type GraphQLConnector struct {
+	api    *APIConnector
+	config *Config
+}
+
+// NewGraphQLConnector creates a new GraphQLConnector with the given configuration.
+//
+// The config parameter should include:
+//   - BaseURL: The GraphQL endpoint
+//   - TimeoutSeconds: Timeout for each request
+//   - Options["records_path"]: The default path to the records in the response data
+//   - Options["cursor_variable"]: The variable that receives the Relay end cursor. Defaults to "after".
+//   - Options["max_pages"], Options["max_rows"]: Caps on pagination
+//   - Options["auth"], Options["header.<Name>"]: Authentication and headers, as for NewAPIConnector
+//
+// Example:
+//
+//	config := &Config{
+//	    BaseURL: "https://api.github.com/graphql",
+//	    Options: map[string]interface{}{"auth": "bearer", "auth_token": token},
+//	}
+//	connector := NewGraphQLConnector(config)
+func NewGraphQLConnector(config *Config) *GraphQLConnector {
+	apiConfig := *config
+	apiConfig.IsWebSocket = false
+	apiConfig.PollingIntervalSeconds = 0
+	return &GraphQLConnector{
+		api:    NewAPIConnector(&apiConfig),
+		config: config,
+	}
+}
+
+// Connect validates the configuration. GraphQL requests are independent, so no connection
+// is held open.
+func (c *GraphQLConnector) Connect(ctx context.Context) error {
+	if c.config.BaseURL == "" {
+		return errors.NewError(errors.ErrorTypeConfiguration, "endpoint URL is required for GraphQL connector", nil)
+	}
+	return c.api.Connect(ctx)
+}
+
+// Close releases the connector.
+func (c *GraphQLConnector) Close(ctx context.Context) error {
+	return c.api.Close(ctx)
+}
+
+// Query runs a GraphQL query and returns its records, following Relay pagination to the
+// last page or the configured caps. Arguments may be a GraphQLRequest, and a
+// map[string]interface{} of variables. Nested objects in the records are flattened into
+// columns such as "owner.login" unless KeepNested is set.
+//
+// Example:
+//
+//	rows, err := connector.Query(ctx, `
+//	    query($org: String!, $after: String) {
+//	        organization(login: $org) {
+//	            repositories(first: 100, after: $after) {
+//	                nodes { name stargazerCount owner { login } }
+//	                pageInfo { hasNextPage endCursor }
+//	            }
+//	        }
+//	    }`, map[string]interface{}{"org": "golang"})
+func (c *GraphQLConnector) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	it, err := c.Stream(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return readAllRows(ctx, it)
+}
+
+// Stream runs a GraphQL query and returns an iterator over its records, one block per page.
+func (c *GraphQLConnector) Stream(ctx context.Context, query string, args ...interface{}) (RowIterator, error) {
+	req, err := c.request(args)
+	if err != nil {
+		return nil, err
+	}
+
+	it := &graphQLPageIterator{connector: c, query: query, req: req, variables: map[string]interface{}{}}
+	for k, v := range req.Variables {
+		it.variables[k] = v
+	}
+	return it, nil
+}
+
+// Execute runs a GraphQL mutation. It returns the value of the only root field if that is a
+// number, such as a count of deleted items, the number of records selected by the records
+// path if one is set, and 1 otherwise.
+//
+// Example:
+//
+//	_, err := connector.Execute(ctx, `mutation($id: ID!) { closeIssue(input: {issueId: $id}) { issue { id } } }`,
+//	    map[string]interface{}{"id": issueID})
+func (c *GraphQLConnector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
+	req, err := c.request(args)
+	if err != nil {
+		return 0, err
+	}
+	data, err := c.do(ctx, command, req.OperationName, req.Variables, errors.ErrorTypeExecution)
+	if err != nil {
+		return 0, err
+	}
+
+	if req.RecordsPath != "" {
+		path, err := parseJSONPath(req.RecordsPath)
+		if err != nil {
+			return 0, err
+		}
+		if v, ok := path.Select(data); ok {
+			return int64(len(jsonRecords(v))), nil
+		}
+		return 0, nil
+	}
+	if root, ok := data.(map[string]interface{}); ok && len(root) == 1 {
+		for _, v := range root {
+			if n, ok := v.(float64); ok {
+				return int64(n), nil
+			}
+		}
+	}
+	return 1, nil
+}
+
+// Ping checks that the endpoint answers GraphQL requests.
+func (c *GraphQLConnector) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, "{ __typename }", "", nil, errors.ErrorTypeAPIConnection)
+	return err
+}
+
+// Transaction is not supported for GraphQL.
+func (c *GraphQLConnector) Transaction(ctx context.Context) (TransactionConnector, error) {
+	return nil, errors.NewError(errors.ErrorTypeUnsupported, "transactions are not supported for GraphQL connector", nil)
+}
+
+// graphQLIntrospectionQuery reads the types of a schema with their fields, arguments and
+// enum values. Type references are followed deep enough for types such as [[T!]!]!.
+const graphQLIntrospectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types {
+      kind name description
+      fields(includeDeprecated: true) { name description args { name description type { ...TypeRef } } type { ...TypeRef } }
+      inputFields { name description type { ...TypeRef } }
+      enumValues(includeDeprecated: true) { name }
+    }
+  }
+}
+fragment TypeRef on __Type {
+  kind name
+  ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } }
+}`
+
+// graphQLTypeRef is a type reference in an introspection result.
+type graphQLTypeRef struct {
+	Kind   string          `json:"kind"`
+	Name   string          `json:"name"`
+	OfType *graphQLTypeRef `json:"ofType"`
+}
+
+// String writes the reference as in the schema language.
+func (t *graphQLTypeRef) String() string {
+	if t == nil {
+		return ""
+	}
+	switch t.Kind {
+	case "NON_NULL":
+		return t.OfType.String() + "!"
+	case "LIST":
+		return "[" + t.OfType.String() + "]"
+	default:
+		return t.Name
+	}
+}
+
+type graphQLIntrospectionField struct {
+	Name        string                      `json:"name"`
+	Description string                      `json:"description"`
+	Type        *graphQLTypeRef             `json:"type"`
+	Args        []graphQLIntrospectionField `json:"args"`
+}
+
+func (f graphQLIntrospectionField) field() GraphQLField {
+	field := GraphQLField{Name: f.Name, Type: f.Type.String(), Description: f.Description}
+	for _, arg := range f.Args {
+		field.Args = append(field.Args, arg.field())
+	}
+	return field
+}
+
+// Schema introspects the schema of the endpoint. The built-in introspection types, whose
+// names start with "__", are left out, and types are sorted by name.
+func (c *GraphQLConnector) Schema(ctx context.Context) (*GraphQLSchema, error) {
+	data, err := c.do(ctx, graphQLIntrospectionQuery, "IntrospectionQuery", nil, errors.ErrorTypeQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to read introspection result", err)
+	}
+	type named struct {
+		Name string `json:"name"`
+	}
+	var result struct {
+		Schema struct {
+			QueryType        *named `json:"queryType"`
+			MutationType     *named `json:"mutationType"`
+			SubscriptionType *named `json:"subscriptionType"`
+			Types            []struct {
+				Kind        string                      `json:"kind"`
+				Name        string                      `json:"name"`
+				Description string                      `json:"description"`
+				Fields      []graphQLIntrospectionField `json:"fields"`
+				InputFields []graphQLIntrospectionField `json:"inputFields"`
+				EnumValues  []named                     `json:"enumValues"`
+			} `json:"types"`
+		} `json:"__schema"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to decode introspection result", err)
+	}
+	if result.Schema.QueryType == nil {
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, "introspection is disabled on this endpoint", nil)
+	}
+
+	schema := &GraphQLSchema{QueryType: result.Schema.QueryType.Name}
+	if t := result.Schema.MutationType; t != nil {
+		schema.MutationType = t.Name
+	}
+	if t := result.Schema.SubscriptionType; t != nil {
+		schema.SubscriptionType = t.Name
+	}
+	for _, t := range result.Schema.Types {
+		if strings.HasPrefix(t.Name, "__") {
+			continue
+		}
+		typ := GraphQLType{Name: t.Name, Kind: t.Kind, Description: t.Description}
+		for _, f := range t.Fields {
+			typ.Fields = append(typ.Fields, f.field())
+		}
+		for _, f := range t.InputFields {
+			typ.InputFields = append(typ.InputFields, f.field())
+		}
+		for _, v := range t.EnumValues {
+			typ.EnumValues = append(typ.EnumValues, v.Name)
+		}
+		schema.Types = append(schema.Types, typ)
+	}
+	sort.Slice(schema.Types, func(i, j int) bool { return schema.Types[i].Name < schema.Types[j].Name })
+	return schema, nil
+}
+
+// request builds the request options from the arguments of Query or Execute, filling in
+// the defaults from the config options.
+func (c *GraphQLConnector) request(args []interface{}) (GraphQLRequest, error) {
+	var req GraphQLRequest
+	var variables map[string]interface{}
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case GraphQLRequest:
+			req = v
+		case *GraphQLRequest:
+			req = *v
+		case map[string]interface{}:
+			variables = v
+		default:
+			return req, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("invalid GraphQL argument type %T", arg), nil)
+		}
+	}
+	if variables != nil {
+		merged := make(map[string]interface{}, len(req.Variables)+len(variables))
+		for k, v := range req.Variables {
+			merged[k] = v
+		}
+		for k, v := range variables {
+			merged[k] = v
+		}
+		req.Variables = merged
+	}
+
+	if req.RecordsPath == "" {
+		req.RecordsPath, _ = c.config.option("records_path")
+	}
+	if req.CursorVariable == "" {
+		req.CursorVariable, _ = c.config.option("cursor_variable")
+		req.CursorVariable = orDefault(req.CursorVariable, defaultGraphQLCursorVariable)
+	}
+	for _, f := range []struct {
+		key string
+		dst *int
+	}{{"max_pages", &req.MaxPages}, {"max_rows", &req.MaxRows}} {
+		if *f.dst != 0 {
+			continue
+		}
+		n, err := c.config.intOption(f.key, 0)
+		if err != nil {
+			return req, err
+		}
+		*f.dst = n
+	}
+	return req, nil
+}
+
+// graphQLError is an entry of the errors list of a GraphQL response.
+type graphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// do posts a document and returns the data of the response. A response with errors fails,
+// with the type taken from the code extension of the first error: UNAUTHENTICATED and
+// FORBIDDEN give ErrorTypePermission, BAD_USER_INPUT and GRAPHQL_VALIDATION_FAILED give
+// ErrorTypeValidation, and other codes give errType.
+func (c *GraphQLConnector) do(ctx context.Context, document, operationName string, variables map[string]interface{}, errType errors.ErrorType) (interface{}, error) {
+	body := map[string]interface{}{"query": document}
+	if operationName != "" {
+		body["operationName"] = operationName
+	}
+	if len(variables) > 0 {
+		body["variables"] = variables
+	}
+
+	data, _, err := c.api.doHTTP(ctx, "", APIRequestOptions{Method: http.MethodPost, Body: body}, errType)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data   interface{}    `json:"data"`
+		Errors []graphQLError `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, errors.NewError(errType, "failed to decode GraphQL response", err)
+	}
+	if len(resp.Errors) > 0 {
+		messages := make([]string, len(resp.Errors))
+		for i, e := range resp.Errors {
+			messages[i] = e.Message
+			if len(e.Path) > 0 {
+				parts := make([]string, len(e.Path))
+				for j, p := range e.Path {
+					parts[j] = fmt.Sprintf("%v", p)
+				}
+				messages[i] += " at " + strings.Join(parts, ".")
+			}
+		}
+		switch code, _ := resp.Errors[0].Extensions["code"].(string); code {
+		case "UNAUTHENTICATED", "FORBIDDEN":
+			errType = errors.ErrorTypePermission
+		case "BAD_USER_INPUT", "GRAPHQL_VALIDATION_FAILED", "GRAPHQL_PARSE_FAILED":
+			errType = errors.ErrorTypeValidation
+		}
+		return nil, errors.NewError(errType, "GraphQL request failed: "+strings.Join(messages, "; "), nil)
+	}
+	return resp.Data, nil
+}
+
+// graphQLPageIterator runs a query once per page of its Relay connection.
+type graphQLPageIterator struct {
+	connector *GraphQLConnector
+	query     string
+	req       GraphQLRequest
+	variables map[string]interface{}
+	pages     int
+	rows      int
+	done      bool
+}
+
+func (it *graphQLPageIterator) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	for !it.done {
+		if it.req.MaxPages > 0 && it.pages >= it.req.MaxPages {
+			break
+		}
+		data, err := it.connector.do(ctx, it.query, it.req.OperationName, it.variables, errors.ErrorTypeQuery)
+		if err != nil {
+			return nil, err
+		}
+		it.pages++
+
+		connection, err := it.connection(data)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := it.records(data, connection)
+		if err != nil {
+			return nil, err
+		}
+
+		it.done = true
+		if pageInfo, ok := connection["pageInfo"].(map[string]interface{}); ok {
+			cursor, _ := pageInfo["endCursor"].(string)
+			if hasNext, _ := pageInfo["hasNextPage"].(bool); hasNext && cursor != "" && cursor != it.variables[it.req.CursorVariable] {
+				it.variables[it.req.CursorVariable] = cursor
+				it.done = false
+			}
+		}
+
+		if it.req.MaxRows > 0 && it.rows+len(rows) >= it.req.MaxRows {
+			rows = rows[:it.req.MaxRows-it.rows]
+			it.done = true
+		}
+		it.rows += len(rows)
+		if len(rows) > 0 {
+			return rows, nil
+		}
+	}
+	it.done = true
+	return nil, io.EOF
+}
+
+func (it *graphQLPageIterator) Close() error {
+	it.done = true
+	return nil
+}
+
+// connection returns the Relay connection of a response, or nil if there is none.
+func (it *graphQLPageIterator) connection(data interface{}) (map[string]interface{}, error) {
+	if it.req.ConnectionPath != "" {
+		path, err := parseJSONPath(it.req.ConnectionPath)
+		if err != nil {
+			return nil, err
+		}
+		v, _ := path.Select(data)
+		connection, _ := v.(map[string]interface{})
+		return connection, nil
+	}
+
+	// Follow single fields from the root until reaching a connection.
+	v := data
+	for {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		if isGraphQLConnection(obj) {
+			return obj, nil
+		}
+		if len(obj) != 1 {
+			return nil, nil
+		}
+		for _, child := range obj {
+			v = child
+		}
+	}
+}
+
+func isGraphQLConnection(obj map[string]interface{}) bool {
+	_, edges := obj["edges"]
+	_, nodes := obj["nodes"]
+	_, pageInfo := obj["pageInfo"]
+	return pageInfo || (edges || nodes) && len(obj) <= 3
+}
+
+// records selects the records of a page and flattens them.
+func (it *graphQLPageIterator) records(data interface{}, connection map[string]interface{}) ([]map[string]interface{}, error) {
+	var selected interface{}
+	switch {
+	case it.req.RecordsPath != "":
+		path, err := parseJSONPath(it.req.RecordsPath)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := path.Select(data)
+		if !ok {
+			return nil, errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("records path %s not found in response", it.req.RecordsPath), nil)
+		}
+		selected = v
+	case connection != nil:
+		if nodes, ok := connection["nodes"]; ok {
+			selected = nodes
+		} else if edges, ok := connection["edges"].([]interface{}); ok {
+			nodes := make([]interface{}, 0, len(edges))
+			for _, edge := range edges {
+				if e, ok := edge.(map[string]interface{}); ok {
+					nodes = append(nodes, e["node"])
+				}
+			}
+			selected = nodes
+		}
+	default:
+		selected = data
+		if root, ok := data.(map[string]interface{}); ok && len(root) == 1 {
+			for _, v := range root {
+				selected = v
+			}
+		}
+	}
+
+	rows := jsonRecords(selected)
+	if !it.req.KeepNested {
+		for i, row := range rows {
+			rows[i] = flattenRecord(row)
+		}
+	}
+	return rows, nil
+}
+
+// flattenRecord moves the fields of nested objects into columns named by their path, such
+// as "owner.login". Lists are kept as they are.
+func flattenRecord(row map[string]interface{}) map[string]interface{} {
+	nested := false
+	for _, v := range row {
+		if _, ok := v.(map[string]interface{}); ok {
+			nested = true
+			break
+		}
+	}
+	if !nested {
+		return row
+	}
+
+	flat := make(map[string]interface{}, len(row))
+	var walk func(prefix string, obj map[string]interface{})
+	walk = func(prefix string, obj map[string]interface{}) {
+		for k, v := range obj {
+			if child, ok := v.(map[string]interface{}); ok && len(child) > 0 {
+				walk(prefix+k+".", child)
+				continue
+			}
+			flat[prefix+k] = v
+		}
+	}
+	walk("", row)
+	return flat
+}
@@ -0,0 +1,228 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// graphQLRequestBody is the body of a request received by a stub GraphQL server.
+type graphQLRequestBody struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// newGraphQLServer serves the response that handle returns for each request, and records
+// the requests.
+func newGraphQLServer(t *testing.T, handle func(req graphQLRequestBody) interface{}) (*httptest.Server, *[]graphQLRequestBody) {
+	var mu sync.Mutex
+	var requests []graphQLRequestBody
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequestBody
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(handle(req))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newTestGraphQLConnector(t *testing.T, url string, options map[string]interface{}) *GraphQLConnector {
+	t.Helper()
+	connector := NewGraphQLConnector(&Config{BaseURL: url, TimeoutSeconds: 5, Options: options})
+	require.NoError(t, connector.Connect(context.Background()))
+	t.Cleanup(func() { connector.Close(context.Background()) })
+	return connector
+}
+
+func TestGraphQLConnectorQuery(t *testing.T) {
+	server, requests := newGraphQLServer(t, func(req graphQLRequestBody) interface{} {
+		return map[string]interface{}{"data": map[string]interface{}{
+			"user": map[string]interface{}{
+				"login": req.Variables["login"],
+				"repositories": []interface{}{
+					map[string]interface{}{"name": "a", "owner": map[string]interface{}{"login": "x", "plan": map[string]interface{}{"name": "pro"}}, "topics": []interface{}{"go"}},
+					map[string]interface{}{"name": "b", "owner": map[string]interface{}{"login": "y"}},
+				},
+			},
+		}}
+	})
+	connector := newTestGraphQLConnector(t, server.URL, map[string]interface{}{"auth": "bearer", "auth_token": "t0ken"})
+	ctx := context.Background()
+
+	rows, err := connector.Query(ctx, `query($login: String!) { user(login: $login) { login repositories { name owner { login } } } }`,
+		map[string]interface{}{"login": "octocat"}, GraphQLRequest{RecordsPath: "user.repositories"})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"name": "a", "owner.login": "x", "owner.plan.name": "pro", "topics": []interface{}{"go"}},
+		{"name": "b", "owner.login": "y"},
+	}, rows)
+	assert.Equal(t, map[string]interface{}{"login": "octocat"}, (*requests)[0].Variables)
+
+	rows, err = connector.Query(ctx, `{ user { repositories { name } } }`, GraphQLRequest{RecordsPath: "$.user.repositories[*]", KeepNested: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"login": "x", "plan": map[string]interface{}{"name": "pro"}}, rows[0]["owner"])
+
+	// Without a records path, the only root field is the record.
+	rows, err = connector.Query(ctx, `{ user { login } }`)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Nil(t, rows[0]["login"])
+	assert.Equal(t, "x", rows[0]["repositories"].([]interface{})[0].(map[string]interface{})["owner"].(map[string]interface{})["login"])
+
+	_, err = connector.Query(ctx, `{ user { login } }`, GraphQLRequest{RecordsPath: "viewer"})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeQuery))
+	_, err = connector.Query(ctx, `{ user { login } }`, "login")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+}
+
+func TestGraphQLConnectorRelayPagination(t *testing.T) {
+	const total = 5
+	server, requests := newGraphQLServer(t, func(req graphQLRequestBody) interface{} {
+		start := 0
+		if after, ok := req.Variables["after"].(string); ok {
+			start, _ = strconv.Atoi(after)
+		}
+		var edges []interface{}
+		end := start
+		for ; end < total && end < start+2; end++ {
+			edges = append(edges, map[string]interface{}{"cursor": strconv.Itoa(end + 1), "node": map[string]interface{}{"id": end + 1}})
+		}
+		return map[string]interface{}{"data": map[string]interface{}{
+			"viewer": map[string]interface{}{"issues": map[string]interface{}{
+				"edges":    edges,
+				"pageInfo": map[string]interface{}{"hasNextPage": end < total, "endCursor": strconv.Itoa(end)},
+			}},
+		}}
+	})
+	connector := newTestGraphQLConnector(t, server.URL, nil)
+	ctx := context.Background()
+	query := `query($after: String) { viewer { issues(first: 2, after: $after) { edges { node { id } } pageInfo { hasNextPage endCursor } } } }`
+
+	rows, err := connector.Query(ctx, query)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"id": 1.0}, {"id": 2.0}, {"id": 3.0}, {"id": 4.0}, {"id": 5.0}}, rows)
+	require.Len(t, *requests, 3)
+	assert.Nil(t, (*requests)[0].Variables)
+	assert.Equal(t, "4", (*requests)[2].Variables["after"])
+
+	rows, err = connector.Query(ctx, query, GraphQLRequest{MaxRows: 3})
+	require.NoError(t, err)
+	assert.Len(t, rows, 3)
+
+	rows, err = connector.Query(ctx, query, GraphQLRequest{MaxPages: 1, RecordsPath: "viewer.issues.edges[*].cursor"})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"value": "1"}, {"value": "2"}}, rows)
+
+	it, err := connector.Stream(ctx, query)
+	require.NoError(t, err)
+	defer it.Close()
+	block, err := it.Next(ctx)
+	require.NoError(t, err)
+	assert.Len(t, block, 2, "one block per page")
+}
+
+func TestGraphQLConnectorErrors(t *testing.T) {
+	server, _ := newGraphQLServer(t, func(req graphQLRequestBody) interface{} {
+		switch req.Variables["case"] {
+		case "auth":
+			return map[string]interface{}{"errors": []interface{}{map[string]interface{}{"message": "not signed in", "extensions": map[string]interface{}{"code": "UNAUTHENTICATED"}}}}
+		case "input":
+			return map[string]interface{}{"errors": []interface{}{map[string]interface{}{"message": "bad id", "extensions": map[string]interface{}{"code": "BAD_USER_INPUT"}}}}
+		}
+		return map[string]interface{}{
+			"data":   map[string]interface{}{"user": nil},
+			"errors": []interface{}{map[string]interface{}{"message": "user not found", "path": []interface{}{"user", 0}}},
+		}
+	})
+	connector := newTestGraphQLConnector(t, server.URL, nil)
+	ctx := context.Background()
+
+	_, err := connector.Query(ctx, `{ user { id } }`)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeQuery))
+	assert.Contains(t, err.Error(), "user not found at user.0")
+
+	_, err = connector.Query(ctx, `{ user { id } }`, map[string]interface{}{"case": "auth"})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypePermission))
+	_, err = connector.Execute(ctx, `mutation { delete }`, map[string]interface{}{"case": "input"})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation))
+
+	_, err = connector.Transaction(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+	err = NewGraphQLConnector(&Config{}).Connect(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+}
+
+func TestGraphQLConnectorExecute(t *testing.T) {
+	server, requests := newGraphQLServer(t, func(req graphQLRequestBody) interface{} {
+		if req.OperationName == "Purge" {
+			return map[string]interface{}{"data": map[string]interface{}{"purge": 7}}
+		}
+		return map[string]interface{}{"data": map[string]interface{}{"__typename": "Mutation", "closeIssue": map[string]interface{}{"issue": map[string]interface{}{"id": "1"}}}}
+	})
+	connector := newTestGraphQLConnector(t, server.URL, nil)
+	ctx := context.Background()
+
+	n, err := connector.Execute(ctx, `mutation Purge { purge } mutation Other { other }`, GraphQLRequest{OperationName: "Purge"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+	assert.Equal(t, "Purge", (*requests)[0].OperationName)
+
+	n, err = connector.Execute(ctx, `mutation($id: ID!) { closeIssue(id: $id) { issue { id } } }`, map[string]interface{}{"id": "1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	require.NoError(t, connector.Ping(ctx))
+	assert.Equal(t, "{ __typename }", (*requests)[2].Query)
+}
+
+func TestGraphQLConnectorSchema(t *testing.T) {
+	typeRef := func(kind, name string, ofType interface{}) map[string]interface{} {
+		return map[string]interface{}{"kind": kind, "name": name, "ofType": ofType}
+	}
+	server, requests := newGraphQLServer(t, func(req graphQLRequestBody) interface{} {
+		return map[string]interface{}{"data": map[string]interface{}{"__schema": map[string]interface{}{
+			"queryType":    map[string]interface{}{"name": "Query"},
+			"mutationType": nil,
+			"types": []interface{}{
+				map[string]interface{}{"kind": "OBJECT", "name": "Query", "fields": []interface{}{
+					map[string]interface{}{
+						"name": "users",
+						"args": []interface{}{map[string]interface{}{"name": "first", "type": typeRef("SCALAR", "Int", nil)}},
+						"type": typeRef("NON_NULL", "", typeRef("LIST", "", typeRef("NON_NULL", "", typeRef("OBJECT", "User", nil)))),
+					},
+				}},
+				map[string]interface{}{"kind": "ENUM", "name": "Role", "enumValues": []interface{}{map[string]interface{}{"name": "ADMIN"}, map[string]interface{}{"name": "MEMBER"}}},
+				map[string]interface{}{"kind": "OBJECT", "name": "__Type"},
+			},
+		}}}
+	})
+	connector := newTestGraphQLConnector(t, server.URL, nil)
+
+	schema, err := connector.Schema(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "IntrospectionQuery", (*requests)[0].OperationName)
+	assert.Equal(t, "Query", schema.QueryType)
+	assert.Empty(t, schema.MutationType)
+	require.Len(t, schema.Types, 2, "introspection types are left out")
+	assert.Equal(t, "Query", schema.Types[0].Name)
+	assert.Equal(t, []GraphQLField{{Name: "users", Type: "[User!]!", Args: []GraphQLField{{Name: "first", Type: "Int"}}}}, schema.Type("Query").Fields)
+	assert.Equal(t, []string{"ADMIN", "MEMBER"}, schema.Type("Role").EnumValues)
+	assert.Nil(t, schema.Type("User"))
+}
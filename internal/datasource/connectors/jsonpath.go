@@ -0,0 +1,147 @@
+package connectors
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"pkg/common/errors"
+)
+
+// jsonPath is a parsed JSONPath-style selector over decoded JSON values. It supports the
+// subset needed to reach into API responses: dotted member names, array indexes, which may
+// be negative to count from the end, and [*] to select every element of an array, as in
+// "$.data.items", "results[0].rows" or "$.pages[*].entries".
+type jsonPath []jsonPathStep
+
+// jsonPathStep selects a member by name, an element by index, or every element.
+type jsonPathStep struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses a selector. The leading "$" is optional, and an empty path or "$"
+// selects the whole value.
+func parseJSONPath(path string) (jsonPath, error) {
+	invalid := func(reason string) error {
+		return errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("invalid JSON path %q: %s", path, reason), nil)
+	}
+
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	var steps jsonPath
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, invalid("empty member name")
+			}
+			steps = append(steps, jsonPathStep{name: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, invalid("unterminated [")
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, jsonPathStep{name: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, invalid(fmt.Sprintf("bad index %q", inner))
+				}
+				steps = append(steps, jsonPathStep{index: n, isIndex: true})
+			}
+		default:
+			if len(steps) > 0 {
+				return nil, invalid(fmt.Sprintf("unexpected %q", rest[0]))
+			}
+			// A path may start with a bare member name, as in "data.items".
+			rest = "." + rest
+		}
+	}
+	return steps, nil
+}
+
+// Select returns the value the path selects from v, and whether it exists. When the path
+// contains a wildcard, the result is a slice of every match, with matches that are arrays
+// flattened into it, so "$.pages[*].items" returns the items of every page.
+func (p jsonPath) Select(v interface{}) (interface{}, bool) {
+	for i, step := range p {
+		switch {
+		case step.wildcard:
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			var matches []interface{}
+			for _, elem := range list {
+				if m, ok := p[i+1:].Select(elem); ok {
+					if list, isList := m.([]interface{}); isList {
+						matches = append(matches, list...)
+					} else {
+						matches = append(matches, m)
+					}
+				}
+			}
+			return matches, true
+		case step.isIndex:
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			n := step.index
+			if n < 0 {
+				n += len(list)
+			}
+			if n < 0 || n >= len(list) {
+				return nil, false
+			}
+			v = list[n]
+		default:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[step.name]; !ok {
+				return nil, false
+			}
+		}
+	}
+	return v, true
+}
+
+// jsonRecords converts a decoded JSON value into rows: each object in an array becomes a row,
+// a single object becomes one row, and other values are returned in a "value" column.
+func jsonRecords(v interface{}) []map[string]interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		rows := make([]map[string]interface{}, 0, len(v))
+		for _, elem := range v {
+			rows = append(rows, jsonRecord(elem))
+		}
+		return rows
+	default:
+		return []map[string]interface{}{jsonRecord(v)}
+	}
+}
+
+func jsonRecord(v interface{}) map[string]interface{} {
+	if obj, ok := v.(map[string]interface{}); ok {
+		return obj
+	}
+	return map[string]interface{}{"value": v}
+}
@@ -0,0 +1,65 @@
+package connectors
+
+import (
+	"encoding/json"
+	"testing"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONPathSelect(t *testing.T) {
+	var doc interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"data": {"items": [{"id": 1}, {"id": 2}, {"id": 3}], "total": 3},
+		"pages": [{"entries": [{"id": "a"}]}, {"entries": [{"id": "b"}, {"id": "c"}]}],
+		"odd key": "x"
+	}`), &doc))
+
+	tests := []struct {
+		path  string
+		want  interface{}
+		found bool
+	}{
+		{"", doc, true},
+		{"$", doc, true},
+		{"$.data.total", 3.0, true},
+		{"data.total", 3.0, true},
+		{"$.data.items[0].id", 1.0, true},
+		{"$.data.items[-1].id", 3.0, true},
+		{"$.data.items[*].id", []interface{}{1.0, 2.0, 3.0}, true},
+		{"$.pages[*].entries", []interface{}{map[string]interface{}{"id": "a"}, map[string]interface{}{"id": "b"}, map[string]interface{}{"id": "c"}}, true},
+		{"$['odd key']", "x", true},
+		{"$.data.missing", nil, false},
+		{"$.data.items[5]", nil, false},
+		{"$.data.total.x", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path, err := parseJSONPath(tt.path)
+			require.NoError(t, err)
+			got, found := path.Select(doc)
+			assert.Equal(t, tt.found, found)
+			if tt.found {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	for _, path := range []string{"$.", "$.data[", "$.items[x]", "$..a"} {
+		_, err := parseJSONPath(path)
+		assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration), path)
+	}
+}
+
+func TestJSONRecords(t *testing.T) {
+	assert.Equal(t, []map[string]interface{}{{"id": 1.0}, {"value": "x"}},
+		jsonRecords([]interface{}{map[string]interface{}{"id": 1.0}, "x"}))
+	assert.Equal(t, []map[string]interface{}{{"id": 1.0}}, jsonRecords(map[string]interface{}{"id": 1.0}))
+	assert.Equal(t, []map[string]interface{}{{"value": 2.0}}, jsonRecords(2.0))
+	assert.Empty(t, jsonRecords(nil))
+}
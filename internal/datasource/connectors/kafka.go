@@ -0,0 +1,753 @@
+package connectors
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/IBM/sarama"
+)
+
+// Columns of the rows of Kafka messages. A value that decodes to an object contributes its
+// properties as columns; any other value is in the "value" column.
+const (
+	KafkaTopicColumn     = "_topic"
+	KafkaPartitionColumn = "_partition"
+	KafkaOffsetColumn    = "_offset"
+	KafkaTimestampColumn = "_timestamp"
+	KafkaKeyColumn       = "_key"
+	// KafkaHeadersColumn holds the message headers as a map[string]string, if there are any.
+	KafkaHeadersColumn = "_headers"
+	// KafkaErrorColumn holds why a value could not be decoded. The raw value is then in the
+	// "value" column, so that one bad message does not hide the others.
+	KafkaErrorColumn = "_error"
+	KafkaValueColumn = "value"
+)
+
+const (
+	defaultKafkaPort        = 9092
+	defaultKafkaMaxMessages = 1000
+	defaultKafkaReadTimeout = 5 * time.Second
+)
+
+// KafkaTopic describes a topic and its partitions.
+type KafkaTopic struct {
+	Name       string
+	Partitions []KafkaPartition
+}
+
+// KafkaPartition describes a partition of a topic. OldestOffset is the offset of the first
+// retained message, and NewestOffset the offset the next message will get.
+type KafkaPartition struct {
+	ID             int32
+	Leader         int32
+	Replicas       []int32
+	InSyncReplicas []int32
+	OldestOffset   int64
+	NewestOffset   int64
+}
+
+// KafkaReadOptions bounds a read of a topic. Reads cover each partition in turn, from the
+// start position to the end position or until Limit messages have been read.
+type KafkaReadOptions struct {
+	// Partitions limits the read to some partitions. Defaults to all of them.
+	Partitions []int32
+	// StartOffset is the first offset to read in each partition. A negative StartOffset
+	// counts back from the end of the partition, so -10 reads the last ten messages.
+	// Offsets before the oldest retained message start at that message.
+	StartOffset int64
+	// EndOffset is the offset to stop before. Defaults to the end of the partition when the
+	// read starts.
+	EndOffset int64
+	// StartTime, if set, starts each partition at its first message at or after that time,
+	// instead of at StartOffset.
+	StartTime time.Time
+	// EndTime, if set, stops each partition before its first message at or after that time,
+	// instead of at EndOffset.
+	EndTime time.Time
+	// Limit caps the number of messages read. Defaults to the max_messages option, or 1000.
+	Limit int
+}
+
+// KafkaSubscribeOptions configures a subscription to topics.
+type KafkaSubscribeOptions struct {
+	// Group is the consumer group to consume as. The partitions of the topics are shared out
+	// between the members of the group, and offsets are committed once events have been
+	// delivered on the Events channel. Defaults to the group option. Without a group, the
+	// subscription reads every partition that exists when it starts.
+	Group string
+	// Oldest starts at the oldest retained messages, rather than at new messages, where the
+	// group has no committed offset or when there is no group.
+	Oldest bool
+	// BufferSize is the capacity of the Events channel.
+	BufferSize int
+}
+
+// KafkaConnector implements the Connector and Subscriber interfaces for Apache Kafka.
+type KafkaConnector struct {
+	config       *Config
+	brokers      []string
+	saramaConfig *sarama.Config
+	client       sarama.Client
+	keyDecoder   *kafkaDecoder
+	valueDecoder *kafkaDecoder
+	readTimeout  time.Duration
+}
+
+// NewKafkaConnector creates a new KafkaConnector with the given configuration.
+//
+// The config parameter should include:
+//   - Host: One or more comma-separated brokers, as host or host:port
+//   - Port: The port of brokers given without one. Defaults to 9092.
+//   - Username, Password: Credentials for SASL/PLAIN authentication
+//   - TimeoutSeconds: Timeout for dialing and for each request
+//   - Options["value_format"]: "json" (the default), "avro", "protobuf", "string" or "bytes"
+//   - Options["schema_file"]: The .avsc schema for Avro, or the descriptor set for protobuf
+//   - Options["proto_message"]: The full name of the protobuf message type, such as "shop.Order"
+//   - Options["confluent_framing"]: Whether values carry the framing of Confluent Schema Registry serializers
+//   - Options["key_format"], Options["key_schema_file"], Options["key_proto_message"]: The same for keys. Keys are strings by default.
+//   - Options["group"]: The default consumer group of subscriptions
+//   - Options["max_messages"]: The default limit of reads. Defaults to 1000.
+//   - Options["read_timeout"]: How long a read waits for the next message of a partition. Defaults to "5s".
+//   - Options["kafka_version"]: The broker protocol version, such as "3.6.0"
+//   - Options["client_id"]: The client ID sent to brokers. Defaults to "datavinci".
+//   - Options["tls"] and related options: TLS settings, as for the other connectors
+//
+// Example:
+//
+//	config := &Config{
+//	    Host: "kafka-1:9092,kafka-2:9092",
+//	    Options: map[string]interface{}{"value_format": "avro", "schema_file": "/etc/schemas/order.avsc"},
+//	}
+//	connector := NewKafkaConnector(config)
+func NewKafkaConnector(config *Config) *KafkaConnector {
+	return &KafkaConnector{config: config}
+}
+
+// Connect connects to the cluster and loads its metadata.
+func (c *KafkaConnector) Connect(ctx context.Context) error {
+	port := c.config.Port
+	if port == 0 {
+		port = defaultKafkaPort
+	}
+	var brokers []string
+	for _, host := range strings.Split(c.config.Host, ",") {
+		if host = strings.TrimSpace(host); host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		brokers = append(brokers, host)
+	}
+	if len(brokers) == 0 {
+		return errors.NewError(errors.ErrorTypeConfiguration, "at least one broker is required for Kafka connector", nil)
+	}
+
+	if err := c.loadDecoders(); err != nil {
+		return err
+	}
+	cfg, err := c.buildSaramaConfig()
+	if err != nil {
+		return err
+	}
+
+	client, err := sarama.NewClient(brokers, cfg)
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeConnection, "failed to connect to Kafka", err)
+	}
+	c.brokers = brokers
+	c.saramaConfig = cfg
+	c.client = client
+	return nil
+}
+
+// loadDecoders builds the key and value decoders and reads the other read options.
+func (c *KafkaConnector) loadDecoders() error {
+	valueFormat, _ := c.config.option("value_format")
+	schemaFile, _ := c.config.option("schema_file")
+	message, _ := c.config.option("proto_message")
+	confluent, err := c.config.boolOption("confluent_framing")
+	if err != nil {
+		return err
+	}
+	if c.valueDecoder, err = newKafkaDecoder(orDefault(valueFormat, KafkaFormatJSON), schemaFile, message, confluent); err != nil {
+		return err
+	}
+
+	keyFormat, _ := c.config.option("key_format")
+	keySchemaFile, _ := c.config.option("key_schema_file")
+	keyMessage, _ := c.config.option("key_proto_message")
+	if c.keyDecoder, err = newKafkaDecoder(orDefault(keyFormat, KafkaFormatString), keySchemaFile, keyMessage, false); err != nil {
+		return err
+	}
+
+	c.readTimeout = defaultKafkaReadTimeout
+	if s, ok := c.config.option("read_timeout"); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return errors.NewError(errors.ErrorTypeConfiguration, "option read_timeout must be a positive duration", err)
+		}
+		c.readTimeout = d
+	}
+	return nil
+}
+
+// buildSaramaConfig builds the client configuration from the connector configuration.
+func (c *KafkaConnector) buildSaramaConfig() (*sarama.Config, error) {
+	cfg := sarama.NewConfig()
+	clientID, _ := c.config.option("client_id")
+	cfg.ClientID = orDefault(clientID, "datavinci")
+	cfg.Consumer.Return.Errors = true
+
+	if s, ok := c.config.option("kafka_version"); ok {
+		version, err := sarama.ParseKafkaVersion(s)
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("invalid Kafka version %s", s), err)
+		}
+		cfg.Version = version
+	}
+	if c.config.TimeoutSeconds > 0 {
+		timeout := time.Duration(c.config.TimeoutSeconds) * time.Second
+		cfg.Net.DialTimeout = timeout
+		cfg.Net.ReadTimeout = timeout
+		cfg.Net.WriteTimeout = timeout
+	}
+
+	tlsConfig, err := c.config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = tlsConfig
+	}
+	if c.config.Username != "" {
+		cfg.Net.SASL.Enable = true
+		cfg.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		cfg.Net.SASL.User = c.config.Username
+		cfg.Net.SASL.Password = c.config.Password
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "invalid Kafka configuration", err)
+	}
+	return cfg, nil
+}
+
+// Close closes the connection to the cluster.
+func (c *KafkaConnector) Close(ctx context.Context) error {
+	if c.client == nil {
+		return errors.NewError(errors.ErrorTypeConnection, "connection already closed", nil)
+	}
+	err := c.client.Close()
+	c.client = nil
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeConnection, "failed to close Kafka client", err)
+	}
+	return nil
+}
+
+// Query reads a bounded range of messages from a topic, named by query, and returns them as
+// rows. Arguments may be a KafkaReadOptions; without one, the read covers the first
+// max_messages messages of each partition in turn.
+//
+// Example:
+//
+//	rows, err := connector.Query(ctx, "orders", KafkaReadOptions{StartTime: time.Now().Add(-time.Hour), Limit: 500})
+func (c *KafkaConnector) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	if c.client == nil {
+		return nil, errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+
+	var opts KafkaReadOptions
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case KafkaReadOptions:
+			opts = v
+		case *KafkaReadOptions:
+			opts = *v
+		default:
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("invalid Kafka read option type %T", arg), nil)
+		}
+	}
+	if opts.Limit <= 0 {
+		limit, err := c.config.intOption("max_messages", defaultKafkaMaxMessages)
+		if err != nil {
+			return nil, err
+		}
+		opts.Limit = limit
+	}
+
+	partitions := opts.Partitions
+	if len(partitions) == 0 {
+		var err error
+		if partitions, err = c.client.Partitions(query); err != nil {
+			return nil, kafkaError(err, errors.ErrorTypeQuery, fmt.Sprintf("failed to list partitions of topic %s", query))
+		}
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(c.client)
+	if err != nil {
+		return nil, kafkaError(err, errors.ErrorTypeQuery, "failed to create Kafka consumer")
+	}
+	defer consumer.Close()
+
+	rows := []map[string]interface{}{}
+	for _, partition := range partitions {
+		if len(rows) >= opts.Limit {
+			break
+		}
+		start, end, err := c.readRange(query, partition, opts)
+		if err != nil {
+			return nil, err
+		}
+		if start >= end {
+			continue
+		}
+		if rows, err = c.readPartition(ctx, consumer, query, partition, start, end, rows, opts.Limit); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// readRange returns the offsets a read of a partition starts at and stops before.
+func (c *KafkaConnector) readRange(topic string, partition int32, opts KafkaReadOptions) (int64, int64, error) {
+	offset := func(at int64) (int64, error) {
+		off, err := c.client.GetOffset(topic, partition, at)
+		if err != nil {
+			return 0, kafkaError(err, errors.ErrorTypeQuery, fmt.Sprintf("failed to get offset of partition %d of topic %s", partition, topic))
+		}
+		return off, nil
+	}
+	oldest, err := offset(sarama.OffsetOldest)
+	if err != nil {
+		return 0, 0, err
+	}
+	newest, err := offset(sarama.OffsetNewest)
+	if err != nil {
+		return 0, 0, err
+	}
+	// byTime returns the offset of the first message at or after t, or the end of the
+	// partition if there is none.
+	byTime := func(t time.Time) (int64, error) {
+		off, err := offset(t.UnixMilli())
+		if err != nil || off < 0 {
+			return newest, err
+		}
+		return off, nil
+	}
+
+	start, end := opts.StartOffset, newest
+	switch {
+	case !opts.StartTime.IsZero():
+		if start, err = byTime(opts.StartTime); err != nil {
+			return 0, 0, err
+		}
+	case start < 0:
+		start += newest
+	}
+	switch {
+	case !opts.EndTime.IsZero():
+		if end, err = byTime(opts.EndTime); err != nil {
+			return 0, 0, err
+		}
+	case opts.EndOffset > 0 && opts.EndOffset < newest:
+		end = opts.EndOffset
+	}
+	if start < oldest {
+		start = oldest
+	}
+	return start, end, nil
+}
+
+// readPartition appends the messages of a partition from start up to end to rows, until
+// there are limit rows. It stops early if the partition has no message for the read timeout,
+// as happens when the last offsets are transaction markers.
+func (c *KafkaConnector) readPartition(ctx context.Context, consumer sarama.Consumer, topic string, partition int32, start, end int64, rows []map[string]interface{}, limit int) ([]map[string]interface{}, error) {
+	pc, err := consumer.ConsumePartition(topic, partition, start)
+	if err != nil {
+		return nil, kafkaError(err, errors.ErrorTypeQuery, fmt.Sprintf("failed to read partition %d of topic %s", partition, topic))
+	}
+	defer pc.Close()
+
+	idle := time.NewTimer(c.readTimeout)
+	defer idle.Stop()
+	for len(rows) < limit {
+		select {
+		case msg := <-pc.Messages():
+			if msg.Offset >= end {
+				return rows, nil
+			}
+			rows = append(rows, c.messageRow(msg))
+			if msg.Offset >= end-1 {
+				return rows, nil
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(c.readTimeout)
+		case err := <-pc.Errors():
+			return nil, kafkaError(err.Err, errors.ErrorTypeQuery, fmt.Sprintf("failed to read partition %d of topic %s", partition, topic))
+		case <-idle.C:
+			return rows, nil
+		case <-ctx.Done():
+			return nil, errors.NewError(errors.ErrorTypeTimeout, "Kafka read cancelled", ctx.Err())
+		}
+	}
+	return rows, nil
+}
+
+// messageRow converts a message to a row.
+func (c *KafkaConnector) messageRow(msg *sarama.ConsumerMessage) map[string]interface{} {
+	row := map[string]interface{}{
+		KafkaTopicColumn:     msg.Topic,
+		KafkaPartitionColumn: msg.Partition,
+		KafkaOffsetColumn:    msg.Offset,
+		KafkaTimestampColumn: msg.Timestamp,
+	}
+	if key, err := c.keyDecoder.decode(msg.Key); err != nil {
+		row[KafkaKeyColumn] = string(msg.Key)
+	} else {
+		row[KafkaKeyColumn] = key
+	}
+	if len(msg.Headers) > 0 {
+		headers := make(map[string]string, len(msg.Headers))
+		for _, h := range msg.Headers {
+			headers[string(h.Key)] = string(h.Value)
+		}
+		row[KafkaHeadersColumn] = headers
+	}
+
+	value, err := c.valueDecoder.decode(msg.Value)
+	if err != nil {
+		row[KafkaErrorColumn] = err.Error()
+		row[KafkaValueColumn] = msg.Value
+		return row
+	}
+	if obj, ok := value.(map[string]interface{}); ok {
+		for k, v := range obj {
+			if _, taken := row[k]; !taken {
+				row[k] = v
+			}
+		}
+		return row
+	}
+	row[KafkaValueColumn] = value
+	return row
+}
+
+// messageEvent converts a message to an event, whose Offset is "<partition>:<offset>".
+func (c *KafkaConnector) messageEvent(msg *sarama.ConsumerMessage) Event {
+	t := msg.Timestamp
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return Event{
+		Source: msg.Topic,
+		Data:   c.messageRow(msg),
+		Offset: fmt.Sprintf("%d:%d", msg.Partition, msg.Offset),
+		Time:   t,
+	}
+}
+
+// Execute is not supported, as the connector only reads topics.
+func (c *KafkaConnector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
+	return 0, errors.NewError(errors.ErrorTypeUnsupported, "commands are not supported for Kafka connector", nil)
+}
+
+// Ping refreshes the cluster metadata.
+func (c *KafkaConnector) Ping(ctx context.Context) error {
+	if c.client == nil {
+		return errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+	if err := c.client.RefreshMetadata(); err != nil {
+		return errors.NewError(errors.ErrorTypeConnection, "failed to ping Kafka", err)
+	}
+	return nil
+}
+
+// Transaction is not supported for Kafka.
+func (c *KafkaConnector) Transaction(ctx context.Context) (TransactionConnector, error) {
+	return nil, errors.NewError(errors.ErrorTypeUnsupported, "transactions are not supported for Kafka connector", nil)
+}
+
+// Topics returns the topics of the cluster sorted by name, with their partitions.
+func (c *KafkaConnector) Topics(ctx context.Context) ([]KafkaTopic, error) {
+	if c.client == nil {
+		return nil, errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+	if err := c.client.RefreshMetadata(); err != nil {
+		return nil, kafkaError(err, errors.ErrorTypeQuery, "failed to refresh Kafka metadata")
+	}
+	names, err := c.client.Topics()
+	if err != nil {
+		return nil, kafkaError(err, errors.ErrorTypeQuery, "failed to list Kafka topics")
+	}
+	sort.Strings(names)
+
+	topics := make([]KafkaTopic, 0, len(names))
+	for _, name := range names {
+		topic, err := c.topic(name)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, *topic)
+	}
+	return topics, nil
+}
+
+// Topic returns a topic with its partitions.
+func (c *KafkaConnector) Topic(ctx context.Context, name string) (*KafkaTopic, error) {
+	if c.client == nil {
+		return nil, errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+	if err := c.client.RefreshMetadata(name); err != nil {
+		return nil, kafkaError(err, errors.ErrorTypeQuery, fmt.Sprintf("failed to describe topic %s", name))
+	}
+	return c.topic(name)
+}
+
+func (c *KafkaConnector) topic(name string) (*KafkaTopic, error) {
+	fail := func(err error) (*KafkaTopic, error) {
+		return nil, kafkaError(err, errors.ErrorTypeQuery, fmt.Sprintf("failed to describe topic %s", name))
+	}
+	ids, err := c.client.Partitions(name)
+	if err != nil {
+		return fail(err)
+	}
+	topic := &KafkaTopic{Name: name, Partitions: make([]KafkaPartition, len(ids))}
+	for i, id := range ids {
+		p := KafkaPartition{ID: id, Leader: -1}
+		if leader, err := c.client.Leader(name, id); err == nil {
+			p.Leader = leader.ID()
+		}
+		if p.Replicas, err = c.client.Replicas(name, id); err != nil {
+			return fail(err)
+		}
+		if p.InSyncReplicas, err = c.client.InSyncReplicas(name, id); err != nil {
+			return fail(err)
+		}
+		if p.OldestOffset, err = c.client.GetOffset(name, id, sarama.OffsetOldest); err != nil {
+			return fail(err)
+		}
+		if p.NewestOffset, err = c.client.GetOffset(name, id, sarama.OffsetNewest); err != nil {
+			return fail(err)
+		}
+		topic.Partitions[i] = p
+	}
+	sort.Slice(topic.Partitions, func(i, j int) bool { return topic.Partitions[i].ID < topic.Partitions[j].ID })
+	return topic, nil
+}
+
+// Subscribe consumes one or more comma-separated topics and delivers each message as an
+// event, with the row Query would return as its data. Arguments may be a KafkaSubscribeOptions.
+//
+// Example:
+//
+//	sub, err := connector.Subscribe(ctx, "orders,refunds", KafkaSubscribeOptions{Group: "dashboard"})
+//	if err != nil {
+//	    log.Fatalf("Failed to subscribe: %v", err)
+//	}
+//	defer sub.Close()
+//	for event := range sub.Events() {
+//	    process(event.Data)
+//	}
+func (c *KafkaConnector) Subscribe(ctx context.Context, topic string, args ...interface{}) (Subscription, error) {
+	if c.client == nil {
+		return nil, errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+
+	var opts KafkaSubscribeOptions
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case KafkaSubscribeOptions:
+			opts = v
+		case *KafkaSubscribeOptions:
+			opts = *v
+		default:
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("invalid Kafka subscribe option type %T", arg), nil)
+		}
+	}
+	if opts.Group == "" {
+		opts.Group, _ = c.config.option("group")
+	}
+	var topics []string
+	for _, t := range strings.Split(topic, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			topics = append(topics, t)
+		}
+	}
+	if len(topics) == 0 {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "at least one topic is required", nil)
+	}
+
+	if opts.Group != "" {
+		return c.subscribeGroup(ctx, topics, opts)
+	}
+	return c.subscribePartitions(ctx, topics, opts)
+}
+
+// subscribeGroup consumes topics as a member of a consumer group. The group has its own
+// client, as sarama consumer groups cannot share one.
+func (c *KafkaConnector) subscribeGroup(ctx context.Context, topics []string, opts KafkaSubscribeOptions) (Subscription, error) {
+	cfg := *c.saramaConfig
+	cfg.Consumer.Return.Errors = false
+	cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	if opts.Oldest {
+		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	}
+	group, err := sarama.NewConsumerGroup(c.brokers, opts.Group, &cfg)
+	if err != nil {
+		return nil, kafkaError(err, errors.ErrorTypeConnection, fmt.Sprintf("failed to join consumer group %s", opts.Group))
+	}
+
+	sub, subCtx := newSubscription(ctx, opts.BufferSize)
+	handler := &kafkaGroupHandler{connector: c, sub: sub, ctx: subCtx}
+	go func() {
+		defer group.Close()
+		for {
+			// Consume returns when the group rebalances, and is called again to rejoin.
+			err := group.Consume(subCtx, topics, handler)
+			if subCtx.Err() != nil || stderrors.Is(err, sarama.ErrClosedConsumerGroup) {
+				sub.finish(subCtx, nil)
+				return
+			}
+			if err != nil {
+				sub.finish(subCtx, kafkaError(err, errors.ErrorTypeConnection, fmt.Sprintf("consumer group %s failed", opts.Group)))
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// kafkaGroupHandler delivers the messages of the claimed partitions, and marks each one for
+// committing once it has been delivered.
+type kafkaGroupHandler struct {
+	connector *KafkaConnector
+	sub       *subscription
+	ctx       context.Context
+}
+
+func (h *kafkaGroupHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (h *kafkaGroupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *kafkaGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if !h.sub.send(h.ctx, h.connector.messageEvent(msg)) {
+				return nil
+			}
+			session.MarkMessage(msg, "")
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// subscribePartitions consumes every partition of the topics without a consumer group.
+func (c *KafkaConnector) subscribePartitions(ctx context.Context, topics []string, opts KafkaSubscribeOptions) (Subscription, error) {
+	consumer, err := sarama.NewConsumerFromClient(c.client)
+	if err != nil {
+		return nil, kafkaError(err, errors.ErrorTypeConnection, "failed to create Kafka consumer")
+	}
+	initial := sarama.OffsetNewest
+	if opts.Oldest {
+		initial = sarama.OffsetOldest
+	}
+
+	var pcs []sarama.PartitionConsumer
+	closeAll := func() {
+		for _, pc := range pcs {
+			pc.AsyncClose()
+		}
+		consumer.Close()
+	}
+	for _, topic := range topics {
+		partitions, err := c.client.Partitions(topic)
+		if err != nil {
+			closeAll()
+			return nil, kafkaError(err, errors.ErrorTypeQuery, fmt.Sprintf("failed to list partitions of topic %s", topic))
+		}
+		for _, partition := range partitions {
+			pc, err := consumer.ConsumePartition(topic, partition, initial)
+			if err != nil {
+				closeAll()
+				return nil, kafkaError(err, errors.ErrorTypeQuery, fmt.Sprintf("failed to read partition %d of topic %s", partition, topic))
+			}
+			pcs = append(pcs, pc)
+		}
+	}
+
+	sub, subCtx := newSubscription(ctx, opts.BufferSize)
+	// The partition routines stop on their own context, so that they have all returned
+	// before the Events channel is closed.
+	readCtx, stop := context.WithCancel(subCtx)
+	failed := make(chan error, 1)
+	var wg sync.WaitGroup
+	for _, pc := range pcs {
+		wg.Add(1)
+		go func(pc sarama.PartitionConsumer) {
+			defer wg.Done()
+			for {
+				select {
+				case msg, ok := <-pc.Messages():
+					if !ok || !sub.send(readCtx, c.messageEvent(msg)) {
+						return
+					}
+				case err, ok := <-pc.Errors():
+					if !ok {
+						return
+					}
+					select {
+					case failed <- kafkaError(err.Err, errors.ErrorTypeConnection, fmt.Sprintf("failed to read partition %d of topic %s", err.Partition, err.Topic)):
+					default:
+					}
+					return
+				case <-readCtx.Done():
+					return
+				}
+			}
+		}(pc)
+	}
+	go func() {
+		var err error
+		select {
+		case <-subCtx.Done():
+		case err = <-failed:
+		}
+		stop()
+		wg.Wait()
+		closeAll()
+		sub.finish(subCtx, err)
+	}()
+	return sub, nil
+}
+
+// kafkaError wraps a client error, giving unknown topics and partitions ErrorTypeNotFound,
+// unreachable brokers ErrorTypeConnection and authorization failures ErrorTypePermission.
+func kafkaError(err error, errType errors.ErrorType, message string) error {
+	switch {
+	case stderrors.Is(err, sarama.ErrUnknownTopicOrPartition):
+		errType = errors.ErrorTypeNotFound
+	case stderrors.Is(err, sarama.ErrOutOfBrokers), stderrors.Is(err, sarama.ErrClosedClient):
+		errType = errors.ErrorTypeConnection
+	case stderrors.Is(err, sarama.ErrTopicAuthorizationFailed), stderrors.Is(err, sarama.ErrGroupAuthorizationFailed):
+		errType = errors.ErrorTypePermission
+	}
+	return errors.NewError(errType, message, err)
+}
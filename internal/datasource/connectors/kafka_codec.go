@@ -0,0 +1,276 @@
+package connectors
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"pkg/common/errors"
+
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Formats of Kafka message keys and values.
+const (
+	// KafkaFormatString decodes UTF-8 text.
+	KafkaFormatString = "string"
+	// KafkaFormatBytes keeps the raw bytes.
+	KafkaFormatBytes = "bytes"
+	// KafkaFormatJSON decodes JSON documents.
+	KafkaFormatJSON = "json"
+	// KafkaFormatAvro decodes Avro binary data with the writer schema in an .avsc file.
+	KafkaFormatAvro = "avro"
+	// KafkaFormatProtobuf decodes protobuf messages with a descriptor set file, as written by
+	// protoc --include_imports --descriptor_set_out.
+	KafkaFormatProtobuf = "protobuf"
+)
+
+// confluentMagicByte starts data framed by a Confluent Schema Registry serializer, and is
+// followed by a 4-byte schema ID.
+const confluentMagicByte = 0
+
+// kafkaDecoder decodes a message key or value.
+type kafkaDecoder struct {
+	format string
+	// confluent strips the Schema Registry framing before decoding.
+	confluent bool
+	avro      *goavro.Codec
+	// avroSchema is the parsed schema, used to unwrap union values.
+	avroSchema interface{}
+	message    protoreflect.MessageDescriptor
+}
+
+// newKafkaDecoder builds a decoder for one of the Kafka formats. Avro needs schemaFile, and
+// protobuf needs schemaFile and the full name of the message type.
+func newKafkaDecoder(format, schemaFile, messageName string, confluent bool) (*kafkaDecoder, error) {
+	d := &kafkaDecoder{format: format, confluent: confluent}
+	switch format {
+	case KafkaFormatString, KafkaFormatBytes, KafkaFormatJSON:
+		return d, nil
+	case KafkaFormatAvro, KafkaFormatProtobuf:
+	default:
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("unsupported Kafka format %q", format), nil)
+	}
+
+	if schemaFile == "" {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("%s format requires a schema file", format), nil)
+	}
+	schema, err := os.ReadFile(schemaFile)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "failed to read schema file", err)
+	}
+
+	if format == KafkaFormatAvro {
+		if d.avro, err = goavro.NewCodec(string(schema)); err != nil {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "invalid Avro schema", err)
+		}
+		if err := json.Unmarshal(schema, &d.avroSchema); err != nil {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "invalid Avro schema", err)
+		}
+		return d, nil
+	}
+
+	if messageName == "" {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "protobuf format requires a message type", nil)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(schema, &set); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "invalid protobuf descriptor set", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "invalid protobuf descriptor set", err)
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(messageName))
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("protobuf message type %s not found in descriptor set", messageName), err)
+	}
+	var ok bool
+	if d.message, ok = desc.(protoreflect.MessageDescriptor); !ok {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("%s is not a protobuf message type", messageName), nil)
+	}
+	return d, nil
+}
+
+// decode decodes data. Avro records and protobuf messages decode to maps as their JSON
+// forms would, so protobuf 64-bit integers are strings. Nil data decodes to nil.
+func (d *kafkaDecoder) decode(data []byte) (interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+	if d.confluent {
+		var err error
+		if data, err = d.unframe(data); err != nil {
+			return nil, err
+		}
+	}
+
+	switch d.format {
+	case KafkaFormatBytes:
+		return data, nil
+	case KafkaFormatJSON:
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "invalid JSON", err)
+		}
+		return v, nil
+	case KafkaFormatAvro:
+		native, rest, err := d.avro.NativeFromBinary(data)
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "invalid Avro data", err)
+		}
+		if len(rest) > 0 {
+			return nil, errors.NewError(errors.ErrorTypeDataIntegrity, fmt.Sprintf("%d trailing bytes after Avro data", len(rest)), nil)
+		}
+		return normalizeAvro(d.avroSchema, native, map[string]interface{}{}), nil
+	case KafkaFormatProtobuf:
+		msg := dynamicpb.NewMessage(d.message)
+		if err := proto.Unmarshal(data, msg); err != nil {
+			return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "invalid protobuf data", err)
+		}
+		text, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "failed to convert protobuf message", err)
+		}
+		var v interface{}
+		if err := json.Unmarshal(text, &v); err != nil {
+			return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "failed to convert protobuf message", err)
+		}
+		return v, nil
+	default:
+		return string(data), nil
+	}
+}
+
+// unframe strips the Confluent Schema Registry framing: the magic byte, the schema ID and,
+// for protobuf, the indexes of the message type in its file. The message type is always the
+// configured one, whatever the indexes say.
+func (d *kafkaDecoder) unframe(data []byte) ([]byte, error) {
+	if len(data) < 5 || data[0] != confluentMagicByte {
+		return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "missing Schema Registry framing", nil)
+	}
+	data = data[5:]
+	if d.format != KafkaFormatProtobuf {
+		return data, nil
+	}
+
+	count, n := protowire.ConsumeVarint(data)
+	if n < 0 {
+		return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "invalid protobuf message indexes", protowire.ParseError(n))
+	}
+	data = data[n:]
+	for i := int64(0); i < protowire.DecodeZigZag(count); i++ {
+		_, n := protowire.ConsumeVarint(data)
+		if n < 0 {
+			return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "invalid protobuf message indexes", protowire.ParseError(n))
+		}
+		data = data[n:]
+	}
+	return data, nil
+}
+
+// normalizeAvro converts a decoded Avro value to plain values, following its schema: union
+// values, which decode to single-entry maps keyed by the branch type, are replaced by the
+// branch value, ints are widened to int64 and floats to float64. named collects the named
+// types defined so far, which later parts of the schema may refer to by name.
+func normalizeAvro(schema, v interface{}, named map[string]interface{}) interface{} {
+	switch s := schema.(type) {
+	case string:
+		if def, ok := named[s]; ok {
+			return normalizeAvro(def, v, named)
+		}
+	case []interface{}:
+		branch, ok := v.(map[string]interface{})
+		if !ok || len(branch) != 1 {
+			return v
+		}
+		for name, value := range branch {
+			for _, b := range s {
+				// Named types inherit the namespace of the enclosing type, which the branch
+				// key includes.
+				if n := avroTypeName(b); n == name || strings.HasSuffix(name, "."+n) {
+					return normalizeAvro(b, value, named)
+				}
+			}
+			return normalizeAvro(name, value, named)
+		}
+	case map[string]interface{}:
+		if name := avroTypeName(s); name != "" {
+			named[name] = s
+			if ns, _ := s["namespace"].(string); ns != "" && !strings.Contains(name, ".") {
+				named[ns+"."+name] = s
+			}
+		}
+		switch s["type"] {
+		case "record", "error":
+			record, ok := v.(map[string]interface{})
+			fields, _ := s["fields"].([]interface{})
+			if !ok {
+				return v
+			}
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				if value, ok := record[name]; ok {
+					record[name] = normalizeAvro(field["type"], value, named)
+				}
+			}
+			return record
+		case "array":
+			if items, ok := v.([]interface{}); ok {
+				for i, item := range items {
+					items[i] = normalizeAvro(s["items"], item, named)
+				}
+			}
+			return v
+		case "map":
+			if values, ok := v.(map[string]interface{}); ok {
+				for k, value := range values {
+					values[k] = normalizeAvro(s["values"], value, named)
+				}
+			}
+			return v
+		case "enum", "fixed":
+			return v
+		default:
+			// A primitive type written as {"type": "long", "logicalType": ...}.
+			return normalizeAvro(s["type"], v, named)
+		}
+	}
+
+	switch v := v.(type) {
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+// avroTypeName returns the name that identifies a schema as a union branch: the name of a
+// named type, or the type of any other.
+func avroTypeName(schema interface{}) string {
+	switch s := schema.(type) {
+	case string:
+		return s
+	case map[string]interface{}:
+		if name, ok := s["name"].(string); ok {
+			if ns, _ := s["namespace"].(string); ns != "" && !strings.Contains(name, ".") {
+				return ns + "." + name
+			}
+			return name
+		}
+		t, _ := s["type"].(string)
+		return t
+	}
+	return ""
+}
@@ -0,0 +1,311 @@
+package connectors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/IBM/sarama"
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// newKafkaBroker starts a stand-in broker holding the "orders" topic, whose two partitions
+// hold the given JSON values from offset 0.
+func newKafkaBroker(t *testing.T, partition0, partition1 []string) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+
+	offsets := sarama.NewMockOffsetResponse(t)
+	fetch := sarama.NewMockFetchResponse(t, 10)
+	for p, values := range [][]string{partition0, partition1} {
+		partition := int32(p)
+		offsets.SetOffset("orders", partition, sarama.OffsetOldest, 0)
+		offsets.SetOffset("orders", partition, sarama.OffsetNewest, int64(len(values)))
+		for i, v := range values {
+			fetch.SetMessageWithKey("orders", partition, int64(i), sarama.StringEncoder("k"), sarama.StringEncoder(v))
+		}
+		fetch.SetHighWaterMark("orders", partition, int64(len(values)))
+	}
+	// The first message at or after 1700000000000 ms is at offset 2 of partition 0.
+	offsets.SetOffset("orders", 0, 1700000000000, 2)
+	offsets.SetOffset("orders", 1, 1700000000000, -1)
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("orders", 0, broker.BrokerID()).
+			SetLeader("orders", 1, broker.BrokerID()),
+		"OffsetRequest": offsets,
+		"FetchRequest":  fetch,
+	})
+	return broker
+}
+
+func newTestKafkaConnector(t *testing.T, broker *sarama.MockBroker, options map[string]interface{}) *KafkaConnector {
+	t.Helper()
+	opts := map[string]interface{}{"read_timeout": "200ms"}
+	for k, v := range options {
+		opts[k] = v
+	}
+	connector := NewKafkaConnector(&Config{Host: broker.Addr(), TimeoutSeconds: 5, Options: opts})
+	require.NoError(t, connector.Connect(context.Background()))
+	t.Cleanup(func() { connector.Close(context.Background()) })
+	return connector
+}
+
+func kafkaOffsets(rows []map[string]interface{}) [][2]int64 {
+	offsets := make([][2]int64, len(rows))
+	for i, row := range rows {
+		offsets[i] = [2]int64{int64(row[KafkaPartitionColumn].(int32)), row[KafkaOffsetColumn].(int64)}
+	}
+	return offsets
+}
+
+func TestKafkaConnectorQuery(t *testing.T) {
+	broker := newKafkaBroker(t,
+		[]string{`{"id": 1, "total": 9.5}`, `{"id": 2}`, `"text"`, `not json`},
+		[]string{`{"id": 10}`, `{"id": 11}`},
+	)
+	connector := newTestKafkaConnector(t, broker, nil)
+	ctx := context.Background()
+
+	rows, err := connector.Query(ctx, "orders")
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int64{{0, 0}, {0, 1}, {0, 2}, {0, 3}, {1, 0}, {1, 1}}, kafkaOffsets(rows))
+	assert.Equal(t, "orders", rows[0][KafkaTopicColumn])
+	assert.Equal(t, "k", rows[0][KafkaKeyColumn])
+	assert.Equal(t, 1.0, rows[0]["id"])
+	assert.Equal(t, 9.5, rows[0]["total"])
+	assert.Equal(t, "text", rows[2][KafkaValueColumn])
+	assert.Contains(t, rows[3][KafkaErrorColumn], "invalid JSON")
+	assert.Equal(t, []byte("not json"), rows[3][KafkaValueColumn])
+
+	rows, err = connector.Query(ctx, "orders", KafkaReadOptions{StartOffset: -1})
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int64{{0, 3}, {1, 1}}, kafkaOffsets(rows), "negative offsets count back from the end")
+
+	rows, err = connector.Query(ctx, "orders", &KafkaReadOptions{Partitions: []int32{0}, StartOffset: 1, EndOffset: 3})
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int64{{0, 1}, {0, 2}}, kafkaOffsets(rows))
+
+	rows, err = connector.Query(ctx, "orders", KafkaReadOptions{StartTime: time.UnixMilli(1700000000000)})
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int64{{0, 2}, {0, 3}}, kafkaOffsets(rows), "partitions without later messages are skipped")
+
+	rows, err = connector.Query(ctx, "orders", KafkaReadOptions{Limit: 3})
+	require.NoError(t, err)
+	assert.Len(t, rows, 3)
+
+	_, err = connector.Query(ctx, "orders", "latest")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	_, err = connector.Query(ctx, "payments")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+}
+
+func TestKafkaConnectorTopics(t *testing.T) {
+	broker := newKafkaBroker(t, []string{`{}`, `{}`}, nil)
+	connector := newTestKafkaConnector(t, broker, nil)
+	ctx := context.Background()
+
+	topics, err := connector.Topics(ctx)
+	require.NoError(t, err)
+	require.Len(t, topics, 1)
+	assert.Equal(t, "orders", topics[0].Name)
+	assert.Equal(t, []KafkaPartition{
+		{ID: 0, Leader: 1, Replicas: []int32{1}, InSyncReplicas: []int32{1}, OldestOffset: 0, NewestOffset: 2},
+		{ID: 1, Leader: 1, Replicas: []int32{1}, InSyncReplicas: []int32{1}, OldestOffset: 0, NewestOffset: 0},
+	}, topics[0].Partitions)
+
+	topic, err := connector.Topic(ctx, "orders")
+	require.NoError(t, err)
+	assert.Len(t, topic.Partitions, 2)
+
+	require.NoError(t, connector.Ping(ctx))
+	_, err = connector.Execute(ctx, "orders")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+}
+
+func TestKafkaConnectorSubscribe(t *testing.T) {
+	broker := newKafkaBroker(t, []string{`{"id": 1}`, `{"id": 2}`}, []string{`{"id": 3}`})
+	connector := newTestKafkaConnector(t, broker, nil)
+
+	sub, err := connector.Subscribe(context.Background(), "orders", KafkaSubscribeOptions{Oldest: true})
+	require.NoError(t, err)
+	seen := map[string]float64{}
+	for len(seen) < 3 {
+		ev := nextEvent(t, sub)
+		assert.Equal(t, "orders", ev.Source)
+		seen[ev.Offset] = ev.Data["id"].(float64)
+	}
+	assert.Equal(t, map[string]float64{"0:0": 1, "0:1": 2, "1:0": 3}, seen)
+	require.NoError(t, sub.Close())
+	assert.NoError(t, sub.Err())
+
+	_, err = connector.Subscribe(context.Background(), " , ")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	_, err = connector.Subscribe(context.Background(), "payments")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+}
+
+func TestKafkaConnectorSubscribeGroup(t *testing.T) {
+	broker := newKafkaBroker(t, []string{`{"id": 1}`, `{"id": 2}`}, nil)
+	assignment := &sarama.ConsumerGroupMemberAssignment{Topics: map[string][]int32{"orders": {0}}}
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("orders", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("orders", 0, sarama.OffsetOldest, 0).
+			SetOffset("orders", 0, sarama.OffsetNewest, 2),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 10).
+			SetMessage("orders", 0, 0, sarama.StringEncoder(`{"id": 1}`)).
+			SetMessage("orders", 0, 1, sarama.StringEncoder(`{"id": 2}`)).
+			SetHighWaterMark("orders", 0, 2),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "dashboard", broker),
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(t).
+			SetGroupProtocol(sarama.RangeBalanceStrategyName).
+			SetMemberId("member-1").
+			SetLeaderId("member-1").
+			SetMember("member-1", &sarama.ConsumerGroupMemberMetadata{Topics: []string{"orders"}}),
+		"SyncGroupRequest": sarama.NewMockSyncGroupResponse(t).SetMemberAssignment(assignment),
+		"HeartbeatRequest": sarama.NewMockHeartbeatResponse(t),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("dashboard", "orders", 0, 1, "", sarama.ErrNoError).
+			SetError(sarama.ErrNoError),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+		"LeaveGroupRequest":   sarama.NewMockLeaveGroupResponse(t),
+	})
+	connector := newTestKafkaConnector(t, broker, map[string]interface{}{"group": "dashboard"})
+
+	sub, err := connector.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+	ev := nextEvent(t, sub)
+	assert.Equal(t, "0:1", ev.Offset, "consumption resumes at the committed offset")
+	assert.Equal(t, 2.0, ev.Data["id"])
+	require.NoError(t, sub.Close())
+	assert.NoError(t, sub.Err())
+}
+
+func TestKafkaDecoders(t *testing.T) {
+	dir := t.TempDir()
+
+	// Avro
+	schema := `{"type": "record", "name": "Order", "namespace": "shop", "fields": [
+		{"name": "id", "type": "long"},
+		{"name": "note", "type": ["null", "string"], "default": null},
+		{"name": "items", "type": {"type": "array", "items": ["null", {"type": "record", "name": "Item", "fields": [
+			{"name": "sku", "type": "string"},
+			{"name": "qty", "type": "int"}
+		]}]}}
+	]}`
+	avroFile := filepath.Join(dir, "order.avsc")
+	require.NoError(t, os.WriteFile(avroFile, []byte(schema), 0o644))
+	codec, err := goavro.NewCodec(schema)
+	require.NoError(t, err)
+	data, err := codec.BinaryFromNative(nil, map[string]interface{}{
+		"id":    int64(7),
+		"note":  goavro.Union("string", "rush"),
+		"items": []interface{}{goavro.Union("shop.Item", map[string]interface{}{"sku": "A1", "qty": int32(2)}), nil},
+	})
+	require.NoError(t, err)
+
+	d, err := newKafkaDecoder(KafkaFormatAvro, avroFile, "", false)
+	require.NoError(t, err)
+	v, err := d.decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id":    int64(7),
+		"note":  "rush",
+		"items": []interface{}{map[string]interface{}{"sku": "A1", "qty": int64(2)}, nil},
+	}, v)
+
+	d, err = newKafkaDecoder(KafkaFormatAvro, avroFile, "", true)
+	require.NoError(t, err)
+	v, err = d.decode(append([]byte{0, 0, 0, 0, 42}, data...))
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), v.(map[string]interface{})["id"])
+	_, err = d.decode(data)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeDataIntegrity))
+
+	// Protobuf
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("order.proto"),
+		Package: proto.String("shop"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Order"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("order_id"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("customer"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		}},
+	}
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	require.NoError(t, err)
+	protoFile := filepath.Join(dir, "order.desc")
+	require.NoError(t, os.WriteFile(protoFile, set, 0o644))
+
+	fd, err := protodesc.NewFile(file, nil)
+	require.NoError(t, err)
+	msg := dynamicpb.NewMessage(fd.Messages().ByName("Order"))
+	msg.Set(fd.Messages().ByName("Order").Fields().ByName("order_id"), protoreflect.ValueOfInt32(5))
+	msg.Set(fd.Messages().ByName("Order").Fields().ByName("customer"), protoreflect.ValueOfString("ada"))
+	data, err = proto.Marshal(msg)
+	require.NoError(t, err)
+
+	d, err = newKafkaDecoder(KafkaFormatProtobuf, protoFile, "shop.Order", false)
+	require.NoError(t, err)
+	v, err = d.decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"order_id": 5.0, "customer": "ada"}, v)
+
+	d, err = newKafkaDecoder(KafkaFormatProtobuf, protoFile, "shop.Order", true)
+	require.NoError(t, err)
+	v, err = d.decode(append([]byte{0, 0, 0, 0, 1, 0}, data...))
+	require.NoError(t, err)
+	assert.Equal(t, "ada", v.(map[string]interface{})["customer"])
+
+	// Configuration errors
+	_, err = newKafkaDecoder(KafkaFormatProtobuf, protoFile, "shop.Refund", false)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	_, err = newKafkaDecoder(KafkaFormatProtobuf, protoFile, "", false)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	_, err = newKafkaDecoder(KafkaFormatAvro, "", "", false)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	_, err = newKafkaDecoder("xml", "", "", false)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+
+	d, err = newKafkaDecoder(KafkaFormatString, "", "", false)
+	require.NoError(t, err)
+	v, err = d.decode(nil)
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestKafkaConnectorConfig(t *testing.T) {
+	ctx := context.Background()
+	err := NewKafkaConnector(&Config{}).Connect(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	err = NewKafkaConnector(&Config{Host: "localhost", Options: map[string]interface{}{"kafka_version": "latest"}}).Connect(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	err = NewKafkaConnector(&Config{Host: "localhost", Options: map[string]interface{}{"value_format": "avro"}}).Connect(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+
+	connector := NewKafkaConnector(&Config{})
+	_, err = connector.Query(ctx, "orders")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConnection))
+	_, err = connector.Topics(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConnection))
+}
@@ -0,0 +1,208 @@
+package connectors
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/common/errors"
+)
+
+// LogFormat identifies how lines of a log file are parsed into rows.
+type LogFormat string
+
+const (
+	// LogFormatRaw returns each line unparsed in a "message" column.
+	LogFormatRaw LogFormat = "raw"
+	// LogFormatJSON parses each line as a JSON object.
+	LogFormatJSON LogFormat = "json"
+	// LogFormatCombined parses the Apache/Nginx combined access log format.
+	// Lines in the common log format, without referer and user agent, are accepted too.
+	LogFormatCombined LogFormat = "combined"
+	// LogFormatSyslog parses RFC 5424 and RFC 3164 syslog lines.
+	LogFormatSyslog LogFormat = "syslog"
+	// LogFormatRegex parses lines with a user-supplied regular expression.
+	// Every named group becomes a column.
+	LogFormatRegex LogFormat = "regex"
+)
+
+// logParser turns a single log line into a row.
+type logParser func(line string) (map[string]interface{}, error)
+
+var (
+	combinedLogPattern = regexp.MustCompile(`^(?P<remote_addr>\S+) (?P<ident>\S+) (?P<remote_user>\S+) \[(?P<time_local>[^\]]+)\] "(?P<request>(?:[^"\\]|\\.)*)" (?P<status>\d{3}|-) (?P<body_bytes_sent>\d+|-)(?: "(?P<referer>(?:[^"\\]|\\.)*)" "(?P<user_agent>(?:[^"\\]|\\.)*)")?`)
+	syslog5424Pattern  = regexp.MustCompile(`^<(?P<priority>\d{1,3})>1 (?P<timestamp>\S+) (?P<hostname>\S+) (?P<app_name>\S+) (?P<proc_id>\S+) (?P<msg_id>\S+) (?P<structured_data>-|(?:\[(?:[^\]\\]|\\.)*\])+)(?: (?P<message>.*))?$`)
+	syslog3164Pattern  = regexp.MustCompile(`^(?:<(?P<priority>\d{1,3})>)?(?P<timestamp>[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}) (?P<hostname>\S+) (?P<app_name>[^:\[\s]+)(?:\[(?P<proc_id>[^\]]+)\])?: ?(?P<message>.*)$`)
+)
+
+// syslogSeverities maps syslog severity codes to their keywords.
+var syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// newLogParser returns the parser for format. Pattern is only used by LogFormatRegex.
+func newLogParser(format LogFormat, pattern string) (logParser, error) {
+	switch format {
+	case "", LogFormatRaw:
+		return parseRawLine, nil
+	case LogFormatJSON:
+		return parseJSONLine, nil
+	case LogFormatCombined:
+		return parseCombinedLine, nil
+	case LogFormatSyslog:
+		return parseSyslogLine, nil
+	case LogFormatRegex:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "invalid log pattern", err)
+		}
+		if !hasNamedGroups(re) {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "log pattern must contain named groups", nil)
+		}
+		return func(line string) (map[string]interface{}, error) {
+			row, ok := matchNamedGroups(re, line)
+			if !ok {
+				return nil, errors.NewError(errors.ErrorTypeTransformation, "line does not match log pattern", nil)
+			}
+			return row, nil
+		}, nil
+	default:
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("unsupported log format: %s", format), nil)
+	}
+}
+
+// parseRawLine wraps the line in a "message" column.
+func parseRawLine(line string) (map[string]interface{}, error) {
+	return map[string]interface{}{"message": line}, nil
+}
+
+// parseJSONLine decodes a line holding a JSON object.
+func parseJSONLine(line string) (map[string]interface{}, error) {
+	var row map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &row); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeTransformation, "failed to unmarshal JSON log line", err)
+	}
+	return row, nil
+}
+
+// parseCombinedLine parses an access log line in the combined or common log format.
+func parseCombinedLine(line string) (map[string]interface{}, error) {
+	row, ok := matchNamedGroups(combinedLogPattern, line)
+	if !ok {
+		return nil, errors.NewError(errors.ErrorTypeTransformation, "line is not in combined log format", nil)
+	}
+
+	if ts, ok := row["time_local"].(string); ok {
+		if t, err := time.Parse("02/Jan/2006:15:04:05 -0700", ts); err == nil {
+			row["time_local"] = t
+		}
+	}
+	if request, ok := row["request"].(string); ok {
+		parts := strings.Fields(request)
+		if len(parts) >= 2 {
+			row["method"] = parts[0]
+			row["path"] = parts[1]
+		}
+		if len(parts) >= 3 {
+			row["protocol"] = parts[2]
+		}
+	}
+	for _, field := range []string{"status", "body_bytes_sent"} {
+		if s, ok := row[field].(string); ok {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				row[field] = n
+			}
+		}
+	}
+
+	return row, nil
+}
+
+// parseSyslogLine parses an RFC 5424 line, falling back to RFC 3164.
+func parseSyslogLine(line string) (map[string]interface{}, error) {
+	if row, ok := matchNamedGroups(syslog5424Pattern, line); ok {
+		if ts, ok := row["timestamp"].(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				row["timestamp"] = t
+			}
+		}
+		addSyslogPriority(row)
+		return row, nil
+	}
+
+	if row, ok := matchNamedGroups(syslog3164Pattern, line); ok {
+		if ts, ok := row["timestamp"].(string); ok {
+			if t, err := parseSyslog3164Time(ts, time.Now()); err == nil {
+				row["timestamp"] = t
+			}
+		}
+		addSyslogPriority(row)
+		return row, nil
+	}
+
+	return nil, errors.NewError(errors.ErrorTypeTransformation, "line is not in syslog format", nil)
+}
+
+// parseSyslog3164Time parses an RFC 3164 timestamp, which has no year.
+// The year is taken from now, or the previous year if that would put the
+// timestamp more than a day in the future.
+func parseSyslog3164Time(ts string, now time.Time) (time.Time, error) {
+	t, err := time.ParseInLocation(time.Stamp, ts, now.Location())
+	if err != nil {
+		return time.Time{}, err
+	}
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, nil
+}
+
+// addSyslogPriority replaces the priority column with numeric facility and severity columns.
+func addSyslogPriority(row map[string]interface{}) {
+	s, ok := row["priority"].(string)
+	if !ok {
+		return
+	}
+	pri, err := strconv.Atoi(s)
+	if err != nil {
+		return
+	}
+	row["priority"] = pri
+	row["facility"] = pri / 8
+	row["severity"] = syslogSeverities[pri%8]
+}
+
+// hasNamedGroups reports whether re has at least one named capture group.
+func hasNamedGroups(re *regexp.Regexp) bool {
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchNamedGroups matches line against re and returns its named groups as a row.
+// Groups that did not participate in the match, or that hold "-", are nil.
+func matchNamedGroups(re *regexp.Regexp, line string) (map[string]interface{}, bool) {
+	match := re.FindStringSubmatchIndex(line)
+	if match == nil {
+		return nil, false
+	}
+
+	row := make(map[string]interface{})
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		start, end := match[2*i], match[2*i+1]
+		if start < 0 || line[start:end] == "-" {
+			row[name] = nil
+			continue
+		}
+		row[name] = line[start:end]
+	}
+	return row, true
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"sync"
 
 	"pkg/common/errors"
 	"pkg/common/retry"
@@ -20,11 +21,20 @@ import (
 type MongoConnector struct {
 	client *mongo.Client
 	config *Config
+
+	// tokens holds the resume tokens of change stream subscriptions, once one has started.
+	tokens   *checkpointStore
+	tokensMu sync.Mutex
+
+	// watch opens a change stream; tests replace it with an in-memory double.
+	watch func(ctx context.Context, scope MongoWatchScope, topic string, pipeline []interface{}, opts *options.ChangeStreamOptions) (mongoChangeStream, error)
 }
 
 // NewMongoConnector creates a new MongoConnector with the given configuration.
 func NewMongoConnector(config *Config) *MongoConnector {
-	return &MongoConnector{config: config}
+	c := &MongoConnector{config: config}
+	c.watch = c.watchChanges
+	return c
 }
 
 // Connect establishes a connection to the MongoDB database.
@@ -120,6 +130,26 @@ func (c *MongoConnector) Query(ctx context.Context, query string, args ...interf
 	return results, nil
 }
 
+// Aggregate runs an aggregation pipeline on a collection and returns the resulting
+// documents. The pipeline is a list of stages, such as
+// []interface{}{bson.M{"$match": filter}, bson.M{"$limit": 10}}.
+func (c *MongoConnector) Aggregate(ctx context.Context, collection string, pipeline interface{}) ([]map[string]interface{}, error) {
+	if c.client == nil {
+		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+	}
+	cursor, err := c.client.Database(c.config.Database).Collection(collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to execute aggregation", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []map[string]interface{}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to decode aggregation results", err)
+	}
+	return results, nil
+}
+
 // Execute executes a command and returns the number of affected documents.
 func (c *MongoConnector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
 	if len(args) == 0 {
@@ -187,6 +217,31 @@ func (c *MongoConnector) Execute(ctx context.Context, command string, args ...in
 	return result, nil
 }
 
+// Explain returns the query planner's report for a find, update or delete command, such as
+// bson.D{{Key: "find", Value: "users"}, {Key: "filter", Value: filter}}, without running it.
+func (c *MongoConnector) Explain(ctx context.Context, command bson.D) (map[string]interface{}, error) {
+	if c.client == nil {
+		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+	}
+	raw, err := c.client.Database(c.config.Database).RunCommand(ctx, bson.D{
+		{Key: "explain", Value: command},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}).Raw()
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to explain command", err)
+	}
+	// The report is returned as relaxed extended JSON, so that it encodes like any other row.
+	data, err := bson.MarshalExtJSON(raw, false, false)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to decode explain result", err)
+	}
+	var plan map[string]interface{}
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to decode explain result", err)
+	}
+	return plan, nil
+}
+
 // Ping checks if the database connection is still alive.
 func (c *MongoConnector) Ping(ctx context.Context) error {
 	if c.client == nil {
@@ -0,0 +1,358 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pkg/common/errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoCheckpointName is the file, inside Config.StatePath, that holds change stream resume tokens.
+const mongoCheckpointName = "mongo-resume-tokens.json"
+
+// mongoChangeStreamHistoryLost is the server error code for a resume token that has fallen
+// off the oplog.
+const mongoChangeStreamHistoryLost = 286
+
+// MongoWatchScope selects which changes a MongoDB subscription receives.
+type MongoWatchScope string
+
+const (
+	// MongoWatchCollection watches the collection named by the topic.
+	MongoWatchCollection MongoWatchScope = "collection"
+	// MongoWatchDatabase watches every collection in the database named by the topic,
+	// or in the configured database if the topic is empty.
+	MongoWatchDatabase MongoWatchScope = "database"
+	// MongoWatchDeployment watches every database except admin, local and config.
+	MongoWatchDeployment MongoWatchScope = "deployment"
+)
+
+// Columns added to the rows of change events.
+const (
+	// MongoOperationColumn holds the operation type, such as "insert" or "update".
+	MongoOperationColumn = "_operation"
+	// MongoNamespaceColumn holds the changed collection as "database.collection".
+	MongoNamespaceColumn = "_namespace"
+	// MongoUpdatedFieldsColumn holds the fields set by an update, by dotted path.
+	MongoUpdatedFieldsColumn = "_updated_fields"
+	// MongoRemovedFieldsColumn holds the fields removed by an update.
+	MongoRemovedFieldsColumn = "_removed_fields"
+	// MongoBeforeColumn holds the document before the change, when pre-images are requested.
+	MongoBeforeColumn = "_before"
+)
+
+// MongoWatchOptions configures a MongoConnector subscription.
+type MongoWatchOptions struct {
+	// Scope selects a collection, a database or the whole deployment. Defaults to MongoWatchCollection.
+	Scope MongoWatchScope
+	// Pipeline holds aggregation stages, such as $match or $project, applied to change events
+	// on the server.
+	Pipeline []map[string]interface{}
+	// FullDocument controls whether updates include the current document: "updateLookup"
+	// fetches it, and "whenAvailable" or "required" use post-images. By default only
+	// inserts and replacements include it.
+	FullDocument string
+	// FullDocumentBeforeChange requests pre-images with "whenAvailable" or "required".
+	// The collection must have changeStreamPreAndPostImages enabled.
+	FullDocumentBeforeChange string
+	// ResumeKey names the persisted resume token. Defaults to the scope and topic, so it only
+	// needs to be set to keep the positions of several subscriptions to the same topic apart.
+	ResumeKey string
+	// BatchSize is the maximum number of events returned by each server round trip.
+	BatchSize int32
+	// MaxAwaitTime is how long the server waits for new events before replying.
+	MaxAwaitTime time.Duration
+	// BufferSize is the capacity of the Events channel.
+	BufferSize int
+}
+
+// mongoChangeStream is the part of *mongo.ChangeStream used by subscriptions, so that tests
+// can replace it.
+type mongoChangeStream interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	ResumeToken() bson.Raw
+	RemainingBatchLength() int
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// mongoChangeEvent is the part of a change event that is delivered.
+type mongoChangeEvent struct {
+	OperationType string `bson:"operationType"`
+	Namespace     struct {
+		DB   string `bson:"db"`
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey              bson.M              `bson:"documentKey"`
+	FullDocument             bson.M              `bson:"fullDocument"`
+	FullDocumentBeforeChange bson.M              `bson:"fullDocumentBeforeChange"`
+	ClusterTime              primitive.Timestamp `bson:"clusterTime"`
+	UpdateDescription        *struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+// Subscribe opens a change stream and delivers each change as an event. The topic is a
+// collection name, or a database name for MongoWatchDatabase, and args may hold a
+// MongoWatchOptions. Change streams require a replica set or a sharded cluster.
+//
+// The event data is the full document when it is available, and the document key otherwise,
+// with the operation type in "_operation" and the collection in "_namespace". Updates also
+// carry "_updated_fields" and "_removed_fields", and pre-images are in "_before".
+//
+// The resume token of the last delivered event is saved under Config.StatePath, or kept in
+// memory if no state path is set, and a new subscription with the same scope and topic
+// resumes after it, so that no changes are missed while it was stopped. The event Offset
+// holds the token's data.
+//
+// Example:
+//
+//	sub, err := connector.Subscribe(ctx, "orders", MongoWatchOptions{
+//	    Pipeline:     []map[string]interface{}{{"$match": map[string]interface{}{"operationType": "insert"}}},
+//	    FullDocument: "updateLookup",
+//	})
+//	if err != nil {
+//	    log.Fatalf("Failed to watch orders: %v", err)
+//	}
+//	defer sub.Close()
+//	for event := range sub.Events() {
+//	    fmt.Printf("%s %v\n", event.Data["_operation"], event.Data["_id"])
+//	}
+func (c *MongoConnector) Subscribe(ctx context.Context, topic string, args ...interface{}) (Subscription, error) {
+	var opts MongoWatchOptions
+	if len(args) > 0 {
+		switch v := args[0].(type) {
+		case MongoWatchOptions:
+			opts = v
+		case *MongoWatchOptions:
+			opts = *v
+		default:
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "invalid MongoDB watch options", nil)
+		}
+	}
+	if opts.Scope == "" {
+		opts.Scope = MongoWatchCollection
+	}
+
+	switch opts.Scope {
+	case MongoWatchCollection:
+		if topic == "" {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "a collection is required to watch a collection", nil)
+		}
+	case MongoWatchDatabase:
+		if topic == "" {
+			topic = c.config.Database
+		}
+	case MongoWatchDeployment:
+		topic = ""
+	default:
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("unknown watch scope %q", opts.Scope), nil)
+	}
+	if opts.ResumeKey == "" {
+		opts.ResumeKey = string(opts.Scope) + ":" + topic
+		if opts.Scope == MongoWatchCollection {
+			opts.ResumeKey = string(opts.Scope) + ":" + c.config.Database + "." + topic
+		}
+	}
+
+	store, err := c.resumeTokens()
+	if err != nil {
+		return nil, err
+	}
+
+	streamOpts := options.ChangeStream()
+	if opts.FullDocument != "" {
+		streamOpts.SetFullDocument(options.FullDocument(opts.FullDocument))
+	}
+	if opts.FullDocumentBeforeChange != "" {
+		streamOpts.SetFullDocumentBeforeChange(options.FullDocument(opts.FullDocumentBeforeChange))
+	}
+	if opts.BatchSize > 0 {
+		streamOpts.SetBatchSize(opts.BatchSize)
+	}
+	if opts.MaxAwaitTime > 0 {
+		streamOpts.SetMaxAwaitTime(opts.MaxAwaitTime)
+	}
+	var token []byte
+	found, err := store.Load(opts.ResumeKey, &token)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		streamOpts.SetResumeAfter(bson.Raw(token))
+	}
+
+	pipeline := make([]interface{}, len(opts.Pipeline))
+	for i, stage := range opts.Pipeline {
+		pipeline[i] = stage
+	}
+
+	stream, err := c.watch(ctx, opts.Scope, topic, pipeline, streamOpts)
+	if err != nil {
+		if errors.IsErrorType(err, errors.ErrorTypeDatabaseConnection) {
+			return nil, err
+		}
+		if serverErr, ok := err.(mongo.ServerError); ok && found && serverErr.HasErrorCode(mongoChangeStreamHistoryLost) {
+			return nil, errors.NewError(errors.ErrorTypeDataIntegrity,
+				fmt.Sprintf("resume token %s is no longer in the oplog; changes were missed", opts.ResumeKey), err)
+		}
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to open change stream", err)
+	}
+
+	sub, subCtx := newSubscription(ctx, opts.BufferSize)
+	go func() {
+		sub.finish(subCtx, consumeMongoChanges(subCtx, sub, stream, store, opts.ResumeKey))
+	}()
+	return sub, nil
+}
+
+// resumeTokens returns the connector's resume token store, opening it on first use. All
+// subscriptions share one store, so that they do not overwrite each other's tokens.
+func (c *MongoConnector) resumeTokens() (*checkpointStore, error) {
+	c.tokensMu.Lock()
+	defer c.tokensMu.Unlock()
+	if c.tokens == nil {
+		store, err := newCheckpointStore(c.config.StatePath, mongoCheckpointName)
+		if err != nil {
+			return nil, err
+		}
+		c.tokens = store
+	}
+	return c.tokens, nil
+}
+
+// watchChanges opens a change stream for a scope with the driver.
+func (c *MongoConnector) watchChanges(ctx context.Context, scope MongoWatchScope, topic string, pipeline []interface{}, opts *options.ChangeStreamOptions) (mongoChangeStream, error) {
+	if c.client == nil {
+		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+	}
+	switch scope {
+	case MongoWatchDeployment:
+		return c.client.Watch(ctx, pipeline, opts)
+	case MongoWatchDatabase:
+		return c.client.Database(topic).Watch(ctx, pipeline, opts)
+	default:
+		return c.client.Database(c.config.Database).Collection(topic).Watch(ctx, pipeline, opts)
+	}
+}
+
+// consumeMongoChanges delivers change events until ctx is done or the stream ends. The resume
+// token is saved after the last event of each batch has been delivered, and when stopping.
+func consumeMongoChanges(ctx context.Context, sub *subscription, stream mongoChangeStream, store *checkpointStore, key string) (err error) {
+	var unsaved bson.Raw
+	defer func() {
+		if unsaved != nil {
+			if saveErr := store.Save(key, []byte(unsaved)); err == nil {
+				err = saveErr
+			}
+		}
+		stream.Close(context.WithoutCancel(ctx))
+	}()
+
+	for stream.Next(ctx) {
+		var change mongoChangeEvent
+		if err := stream.Decode(&change); err != nil {
+			return errors.NewError(errors.ErrorTypeDataIntegrity, "failed to decode change event", err)
+		}
+		token := stream.ResumeToken()
+		if !sub.send(ctx, mongoChangeToEvent(change, token)) {
+			return nil
+		}
+
+		unsaved = token
+		if stream.RemainingBatchLength() == 0 {
+			if err := store.Save(key, []byte(token)); err != nil {
+				return err
+			}
+			unsaved = nil
+		}
+	}
+	if err := stream.Err(); err != nil && ctx.Err() == nil {
+		return errors.NewError(errors.ErrorTypeQuery, "change stream failed", err)
+	}
+	return nil
+}
+
+// mongoChangeToEvent converts a change event into an event.
+func mongoChangeToEvent(change mongoChangeEvent, token bson.Raw) Event {
+	doc := change.FullDocument
+	if doc == nil {
+		doc = change.DocumentKey
+	}
+	data := make(map[string]interface{}, len(doc)+5)
+	for k, v := range doc {
+		data[k] = mongoValue(v)
+	}
+
+	namespace := change.Namespace.DB
+	if change.Namespace.Coll != "" {
+		namespace += "." + change.Namespace.Coll
+	}
+	data[MongoOperationColumn] = change.OperationType
+	data[MongoNamespaceColumn] = namespace
+	if u := change.UpdateDescription; u != nil {
+		data[MongoUpdatedFieldsColumn] = mongoValue(u.UpdatedFields)
+		removed := make([]interface{}, len(u.RemovedFields))
+		for i, f := range u.RemovedFields {
+			removed[i] = f
+		}
+		data[MongoRemovedFieldsColumn] = removed
+	}
+	if change.FullDocumentBeforeChange != nil {
+		data[MongoBeforeColumn] = mongoValue(change.FullDocumentBeforeChange)
+	}
+
+	offset := token.String()
+	if tokenData, ok := token.Lookup("_data").StringValueOK(); ok {
+		offset = tokenData
+	}
+	eventTime := time.Now()
+	if change.ClusterTime.T > 0 {
+		eventTime = time.Unix(int64(change.ClusterTime.T), 0)
+	}
+	return Event{Source: namespace, Data: data, Offset: offset, Time: eventTime}
+}
+
+// mongoValue converts BSON values into plain Go values that encode naturally as JSON:
+// documents become maps, arrays become slices, ObjectIDs become hex strings and dates
+// become times.
+func mongoValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.M:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = mongoValue(val)
+		}
+		return m
+	case bson.D:
+		m := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			m[e.Key] = mongoValue(e.Value)
+		}
+		return m
+	case bson.A:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = mongoValue(val)
+		}
+		return s
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time().UTC()
+	case primitive.Timestamp:
+		return time.Unix(int64(v.T), 0).UTC()
+	case primitive.Decimal128:
+		return v.String()
+	default:
+		return v
+	}
+}
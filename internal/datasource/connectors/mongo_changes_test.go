@@ -0,0 +1,231 @@
+package connectors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fakeChangeStream replays change events in batches of batchSize, then blocks until the
+// context is done, like a change stream waiting for new changes. If ended is set, it ends
+// after the last event instead, failing with err if it is set.
+type fakeChangeStream struct {
+	events    []bson.M
+	batchSize int
+	ended     bool
+	err       error
+	index     int
+	closed    bool
+}
+
+func (s *fakeChangeStream) Next(ctx context.Context) bool {
+	if s.index < len(s.events) {
+		s.index++
+		return true
+	}
+	if s.ended {
+		return false
+	}
+	<-ctx.Done()
+	return false
+}
+
+func (s *fakeChangeStream) Decode(val interface{}) error {
+	raw, err := bson.Marshal(s.events[s.index-1])
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, val)
+}
+
+func (s *fakeChangeStream) ResumeToken() bson.Raw {
+	raw, _ := bson.Marshal(s.events[s.index-1]["_id"])
+	return raw
+}
+
+func (s *fakeChangeStream) RemainingBatchLength() int {
+	if s.batchSize == 0 {
+		return 0
+	}
+	return (s.batchSize - s.index%s.batchSize) % s.batchSize
+}
+
+func (s *fakeChangeStream) Err() error { return s.err }
+
+func (s *fakeChangeStream) Close(ctx context.Context) error {
+	s.closed = true
+	return nil
+}
+
+// watchCall records the arguments of a watch call.
+type watchCall struct {
+	scope    MongoWatchScope
+	topic    string
+	pipeline []interface{}
+	opts     *options.ChangeStreamOptions
+}
+
+func newTestMongoConnector(t *testing.T, stateDir string, streams ...*fakeChangeStream) (*MongoConnector, *[]watchCall) {
+	t.Helper()
+	connector := NewMongoConnector(&Config{Database: "shop", StatePath: stateDir})
+	var calls []watchCall
+	connector.watch = func(ctx context.Context, scope MongoWatchScope, topic string, pipeline []interface{}, opts *options.ChangeStreamOptions) (mongoChangeStream, error) {
+		calls = append(calls, watchCall{scope, topic, pipeline, opts})
+		require.NotEmpty(t, streams, "unexpected watch call")
+		stream := streams[0]
+		streams = streams[1:]
+		return stream, nil
+	}
+	return connector, &calls
+}
+
+func changeEvent(token, op string, doc bson.M) bson.M {
+	event := bson.M{
+		"_id":           bson.M{"_data": token},
+		"operationType": op,
+		"ns":            bson.M{"db": "shop", "coll": "orders"},
+		"documentKey":   bson.M{"_id": doc["_id"]},
+		"clusterTime":   primitive.Timestamp{T: 1700000000, I: 1},
+	}
+	if op != "delete" {
+		event["fullDocument"] = doc
+	}
+	return event
+}
+
+func TestMongoConnectorSubscribe(t *testing.T) {
+	ctx := context.Background()
+	id := primitive.NewObjectID()
+
+	update := changeEvent("82A2", "update", bson.M{"_id": id, "status": "paid", "items": bson.A{bson.M{"sku": "x"}}})
+	update["updateDescription"] = bson.M{"updatedFields": bson.M{"status": "paid"}, "removedFields": bson.A{"draft"}}
+	update["fullDocumentBeforeChange"] = bson.M{"_id": id, "status": "new"}
+
+	stream := &fakeChangeStream{events: []bson.M{
+		changeEvent("82A1", "insert", bson.M{"_id": id, "status": "new", "created": primitive.NewDateTimeFromTime(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))}),
+		update,
+		changeEvent("82A3", "delete", bson.M{"_id": id}),
+	}}
+	connector, calls := newTestMongoConnector(t, t.TempDir(), stream)
+
+	sub, err := connector.Subscribe(ctx, "orders", MongoWatchOptions{
+		Pipeline:                 []map[string]interface{}{{"$match": map[string]interface{}{"operationType": map[string]interface{}{"$ne": "drop"}}}},
+		FullDocument:             "updateLookup",
+		FullDocumentBeforeChange: "whenAvailable",
+	})
+	require.NoError(t, err)
+
+	event := nextEvent(t, sub)
+	assert.Equal(t, "shop.orders", event.Source)
+	assert.Equal(t, "82A1", event.Offset)
+	assert.Equal(t, time.Unix(1700000000, 0), event.Time)
+	assert.Equal(t, map[string]interface{}{
+		"_id":        id.Hex(),
+		"status":     "new",
+		"created":    time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		"_operation": "insert",
+		"_namespace": "shop.orders",
+	}, event.Data)
+
+	event = nextEvent(t, sub)
+	assert.Equal(t, "update", event.Data[MongoOperationColumn])
+	assert.Equal(t, []interface{}{map[string]interface{}{"sku": "x"}}, event.Data["items"])
+	assert.Equal(t, map[string]interface{}{"status": "paid"}, event.Data[MongoUpdatedFieldsColumn])
+	assert.Equal(t, []interface{}{"draft"}, event.Data[MongoRemovedFieldsColumn])
+	assert.Equal(t, map[string]interface{}{"_id": id.Hex(), "status": "new"}, event.Data[MongoBeforeColumn])
+
+	event = nextEvent(t, sub)
+	assert.Equal(t, map[string]interface{}{"_id": id.Hex(), "_operation": "delete", "_namespace": "shop.orders"}, event.Data)
+	require.NoError(t, sub.Close())
+	assert.True(t, stream.closed)
+
+	require.Len(t, *calls, 1)
+	call := (*calls)[0]
+	assert.Equal(t, MongoWatchCollection, call.scope)
+	assert.Equal(t, "orders", call.topic)
+	assert.Len(t, call.pipeline, 1)
+	assert.Equal(t, options.UpdateLookup, *call.opts.FullDocument)
+	assert.Equal(t, options.WhenAvailable, *call.opts.FullDocumentBeforeChange)
+	assert.Nil(t, call.opts.ResumeAfter)
+}
+
+func TestMongoConnectorSubscribeResumes(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	first := &fakeChangeStream{
+		events: []bson.M{
+			changeEvent("A1", "insert", bson.M{"_id": 1}),
+			changeEvent("A2", "insert", bson.M{"_id": 2}),
+			changeEvent("A3", "insert", bson.M{"_id": 3}),
+		},
+		batchSize: 2,
+	}
+	connector, calls := newTestMongoConnector(t, dir, first)
+
+	sub, err := connector.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		nextEvent(t, sub)
+	}
+	require.NoError(t, sub.Close())
+
+	// A new connector, as after a restart, resumes after the last delivered event.
+	second := &fakeChangeStream{events: []bson.M{changeEvent("A4", "insert", bson.M{"_id": 4})}}
+	connector, calls = newTestMongoConnector(t, dir, second)
+	sub, err = connector.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+	defer sub.Close()
+	assert.Equal(t, "A4", nextEvent(t, sub).Offset)
+
+	resumeAfter, ok := (*calls)[0].opts.ResumeAfter.(bson.Raw)
+	require.True(t, ok)
+	assert.Equal(t, "A3", resumeAfter.Lookup("_data").StringValue())
+
+	// Other topics keep their own position.
+	other := &fakeChangeStream{}
+	connector, calls = newTestMongoConnector(t, dir, other)
+	sub, err = connector.Subscribe(ctx, "", MongoWatchOptions{Scope: MongoWatchDatabase})
+	require.NoError(t, err)
+	defer sub.Close()
+	assert.Equal(t, "shop", (*calls)[0].topic)
+	assert.Nil(t, (*calls)[0].opts.ResumeAfter)
+}
+
+func TestMongoConnectorSubscribeEnds(t *testing.T) {
+	ctx := context.Background()
+
+	connector, _ := newTestMongoConnector(t, "", &fakeChangeStream{
+		events: []bson.M{changeEvent("B1", "invalidate", bson.M{})},
+		ended:  true,
+	})
+	sub, err := connector.Subscribe(ctx, "", MongoWatchOptions{Scope: MongoWatchDeployment})
+	require.NoError(t, err)
+	assert.Equal(t, "invalidate", nextEvent(t, sub).Data[MongoOperationColumn])
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	assert.NoError(t, sub.Err())
+
+	connector, _ = newTestMongoConnector(t, "", &fakeChangeStream{ended: true, err: mongo.CommandError{Code: 280, Message: "cursor killed"}})
+	sub, err = connector.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+	_, ok = <-sub.Events()
+	assert.False(t, ok)
+	assert.True(t, errors.IsErrorType(sub.Err(), errors.ErrorTypeQuery))
+
+	_, err = connector.Subscribe(ctx, "")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	_, err = connector.Subscribe(ctx, "orders", MongoWatchOptions{Scope: "cluster"})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+
+	_, err = NewMongoConnector(&Config{}).Subscribe(ctx, "orders")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeDatabaseConnection))
+}
@@ -0,0 +1,592 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// postgresCheckpointName is the file, inside Config.StatePath, that holds the confirmed
+// positions of replication slots.
+const postgresCheckpointName = "postgres-lsns.json"
+
+// defaultStandbyStatusInterval is how often the confirmed position is reported to the server
+// when no interval is configured.
+const defaultStandbyStatusInterval = 10 * time.Second
+
+// replicationSlotName matches the names PostgreSQL accepts for replication slots.
+var replicationSlotName = regexp.MustCompile(`^[a-z0-9_]{1,63}$`)
+
+// invalidSlotCharacters matches the characters replaced to derive a slot name from a
+// publication name.
+var invalidSlotCharacters = regexp.MustCompile(`[^a-z0-9_]`)
+
+// Columns added to the rows of replication events.
+const (
+	// PostgresOperationColumn holds the operation: "insert", "update", "delete" or "truncate".
+	PostgresOperationColumn = "_operation"
+	// PostgresTableColumn holds the changed table as "schema.table".
+	PostgresTableColumn = "_table"
+	// PostgresTransactionColumn holds the ID of the transaction that made the change.
+	PostgresTransactionColumn = "_xid"
+	// PostgresBeforeColumn holds the row before an update or a delete, when the server sends it.
+	PostgresBeforeColumn = "_before"
+)
+
+// PostgresReplicationOptions configures a SQLConnector subscription.
+type PostgresReplicationOptions struct {
+	// Publication names the publication whose tables are replicated. It is set from the topic.
+	Publication string
+	// Tables lists the tables, as "table" or "schema.table", of a publication to create if it
+	// does not exist. Without tables the publication must already exist.
+	Tables []string
+	// Slot names the replication slot, which is created with the pgoutput plugin if it does
+	// not exist. Defaults to "datavinci_" followed by the publication name.
+	Slot string
+	// TemporarySlot creates a slot that is dropped when the subscription ends. Changes made
+	// while no subscription is running are not kept, and positions are not resumed.
+	TemporarySlot bool
+	// StatusInterval is how often the confirmed position is reported to the server, which
+	// lets it recycle the WAL before it. Defaults to 10 seconds.
+	StatusInterval time.Duration
+	// BufferSize is the capacity of the Events channel.
+	BufferSize int
+}
+
+// pgReplicationStream is the part of a replication connection used by subscriptions, so that
+// tests can replace it.
+type pgReplicationStream interface {
+	ReceiveMessage(ctx context.Context) (pgproto3.BackendMessage, error)
+	SendStandbyStatus(ctx context.Context, confirmed pglogrepl.LSN) error
+	Close(ctx context.Context) error
+}
+
+// pgReplicationConn is a pgReplicationStream over a replication connection.
+type pgReplicationConn struct {
+	conn *pgconn.PgConn
+}
+
+func (c *pgReplicationConn) ReceiveMessage(ctx context.Context) (pgproto3.BackendMessage, error) {
+	return c.conn.ReceiveMessage(ctx)
+}
+
+func (c *pgReplicationConn) SendStandbyStatus(ctx context.Context, confirmed pglogrepl.LSN) error {
+	return pglogrepl.SendStandbyStatusUpdate(ctx, c.conn, pglogrepl.StandbyStatusUpdate{WALWritePosition: confirmed})
+}
+
+func (c *pgReplicationConn) Close(ctx context.Context) error {
+	return c.conn.Close(ctx)
+}
+
+// Subscribe streams the changes to the tables of a PostgreSQL publication through logical
+// replication, and delivers each inserted, updated or deleted row as an event. The topic
+// names the publication, and args may hold a PostgresReplicationOptions. The server must run
+// with wal_level=logical, and the user needs the REPLICATION attribute.
+//
+// The event data is the new row for inserts and updates, and the old row for deletes, with
+// the operation in "_operation", the table in "_table" and the transaction ID in "_xid".
+// Updates and deletes carry the old row in "_before" when the server sends it: the key
+// columns by default, or the whole row for tables with REPLICA IDENTITY FULL. Unchanged
+// TOASTed values are left out of updated rows unless the old row holds them. Values are
+// converted by column type, and those with no plain Go form, such as numerics, stay text.
+//
+// The position of each transaction is saved under Config.StatePath, or kept in memory if no
+// state path is set, once all its changes have been delivered, and is then confirmed to the
+// server. Between transactions, the end of the server's WAL is confirmed as keepalives
+// report it, so that an idle slot does not retain WAL. A new subscription with the same slot
+// resumes after the confirmed position. The event Offset holds the LSN of the change, and
+// the event Time the commit time.
+//
+// Example:
+//
+//	sub, err := connector.Subscribe(ctx, "orders_pub", PostgresReplicationOptions{
+//	    Tables: []string{"public.orders", "public.order_items"},
+//	})
+//	if err != nil {
+//	    log.Fatalf("Failed to replicate orders: %v", err)
+//	}
+//	defer sub.Close()
+//	for event := range sub.Events() {
+//	    fmt.Printf("%s %s %v\n", event.Data["_operation"], event.Data["_table"], event.Data["id"])
+//	}
+func (c *SQLConnector) Subscribe(ctx context.Context, topic string, args ...interface{}) (Subscription, error) {
+	if c.config.Driver != "postgres" {
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("subscriptions are not supported by the %s driver", c.config.Driver), nil)
+	}
+	var opts PostgresReplicationOptions
+	if len(args) > 0 {
+		switch v := args[0].(type) {
+		case PostgresReplicationOptions:
+			opts = v
+		case *PostgresReplicationOptions:
+			opts = *v
+		default:
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("invalid replication options type %T", args[0]), nil)
+		}
+	}
+	if topic != "" {
+		opts.Publication = topic
+	}
+	if opts.Publication == "" {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "a publication is required to replicate changes", nil)
+	}
+	if opts.Slot == "" {
+		opts.Slot = "datavinci_" + invalidSlotCharacters.ReplaceAllString(strings.ToLower(opts.Publication), "_")
+	}
+	if !replicationSlotName.MatchString(opts.Slot) {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("invalid replication slot name %q", opts.Slot), nil)
+	}
+	if opts.StatusInterval <= 0 {
+		opts.StatusInterval = defaultStandbyStatusInterval
+	}
+
+	store, err := c.replicationPositions()
+	if err != nil {
+		return nil, err
+	}
+	var start pglogrepl.LSN
+	if opts.TemporarySlot {
+		// Positions in a temporary slot mean nothing once it is dropped.
+		if store, err = newCheckpointStore("", postgresCheckpointName); err != nil {
+			return nil, err
+		}
+	} else {
+		var saved string
+		found, err := store.Load(opts.Slot, &saved)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			if start, err = pglogrepl.ParseLSN(saved); err != nil {
+				return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "invalid replication checkpoint", err)
+			}
+		}
+	}
+
+	stream, err := c.replicate(ctx, opts, start)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, subCtx := newSubscription(ctx, opts.BufferSize)
+	go func() {
+		sub.finish(subCtx, consumePostgresChanges(subCtx, sub, stream, store, opts.Slot, start, opts.StatusInterval))
+	}()
+	return sub, nil
+}
+
+// DropReplicationSlot drops a replication slot created by a subscription, so that the server
+// no longer keeps WAL for it, and forgets its saved position. The slot must not be in use.
+func (c *SQLConnector) DropReplicationSlot(ctx context.Context, slot string) error {
+	if c.config.Driver != "postgres" {
+		return errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("replication slots are not supported by the %s driver", c.config.Driver), nil)
+	}
+	if !replicationSlotName.MatchString(slot) {
+		return errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("invalid replication slot name %q", slot), nil)
+	}
+	conn, err := c.replicationConnect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if err := pglogrepl.DropReplicationSlot(ctx, conn, slot, pglogrepl.DropReplicationSlotOptions{}); err != nil {
+		return errors.NewError(errors.ErrorTypeQuery, "failed to drop replication slot", err)
+	}
+	store, err := c.replicationPositions()
+	if err != nil {
+		return err
+	}
+	return store.Delete(slot)
+}
+
+// replicationPositions returns the connector's replication position store, opening it on
+// first use.
+func (c *SQLConnector) replicationPositions() (*checkpointStore, error) {
+	c.lsnsMu.Lock()
+	defer c.lsnsMu.Unlock()
+	if c.lsns == nil {
+		store, err := newCheckpointStore(c.config.StatePath, postgresCheckpointName)
+		if err != nil {
+			return nil, err
+		}
+		c.lsns = store
+	}
+	return c.lsns, nil
+}
+
+// replicationConnect opens a replication connection to the configured database.
+func (c *SQLConnector) replicationConnect(ctx context.Context) (*pgconn.PgConn, error) {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.config.Username, c.config.Password),
+		Host:     net.JoinHostPort(c.config.Host, strconv.Itoa(c.config.Port)),
+		Path:     "/" + c.config.Database,
+		RawQuery: "sslmode=disable&replication=database",
+	}
+	conn, err := pgconn.Connect(ctx, dsn.String())
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, "failed to open replication connection", err)
+	}
+	return conn, nil
+}
+
+// startReplication prepares the publication and the slot, and starts streaming from start,
+// or from the slot's confirmed position if start is zero.
+func (c *SQLConnector) startReplication(ctx context.Context, opts PostgresReplicationOptions, start pglogrepl.LSN) (stream pgReplicationStream, err error) {
+	conn, err := c.replicationConnect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			conn.Close(context.WithoutCancel(ctx))
+		}
+	}()
+
+	found, err := replicationQueryRow(ctx, conn, "SELECT pubname FROM pg_publication WHERE pubname = "+quoteLiteral(opts.Publication))
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		if len(opts.Tables) == 0 {
+			return nil, errors.NewError(errors.ErrorTypeNotFound, fmt.Sprintf("publication %s does not exist", opts.Publication), nil)
+		}
+		tables := make([]string, len(opts.Tables))
+		for i, table := range opts.Tables {
+			parts := strings.Split(table, ".")
+			for j, part := range parts {
+				parts[j] = quoteIdentifier(part)
+			}
+			tables[i] = strings.Join(parts, ".")
+		}
+		create := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s", quoteIdentifier(opts.Publication), strings.Join(tables, ", "))
+		if _, err := conn.Exec(ctx, create).ReadAll(); err != nil {
+			return nil, errors.NewError(errors.ErrorTypeQuery, "failed to create publication", err)
+		}
+	}
+
+	plugin, err := replicationQueryRow(ctx, conn, "SELECT plugin FROM pg_replication_slots WHERE slot_name = "+quoteLiteral(opts.Slot))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case plugin == nil && start != 0:
+		return nil, errors.NewError(errors.ErrorTypeDataIntegrity,
+			fmt.Sprintf("replication slot %s no longer exists; changes since %s were missed", opts.Slot, start), nil)
+	case plugin == nil:
+		_, err := pglogrepl.CreateReplicationSlot(ctx, conn, opts.Slot, "pgoutput", pglogrepl.CreateReplicationSlotOptions{
+			Temporary:      opts.TemporarySlot,
+			SnapshotAction: "NOEXPORT_SNAPSHOT",
+			Mode:           pglogrepl.LogicalReplication,
+		})
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeQuery, "failed to create replication slot", err)
+		}
+	case *plugin != "pgoutput":
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("replication slot %s uses the %s plugin, not pgoutput", opts.Slot, *plugin), nil)
+	}
+
+	err = pglogrepl.StartReplication(ctx, conn, opts.Slot, start, pglogrepl.StartReplicationOptions{
+		PluginArgs: []string{"proto_version '1'", "publication_names " + quoteLiteral(opts.Publication)},
+	})
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to start replication", err)
+	}
+	return &pgReplicationConn{conn: conn}, nil
+}
+
+// replicationQueryRow runs a query on a replication connection and returns the first column
+// of its first row, or nil if it returned no rows.
+func replicationQueryRow(ctx context.Context, conn *pgconn.PgConn, query string) (*string, error) {
+	results, err := conn.Exec(ctx, query).ReadAll()
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to query replication state", err)
+	}
+	if len(results) == 0 || len(results[0].Rows) == 0 {
+		return nil, nil
+	}
+	value := string(results[0].Rows[0][0])
+	return &value, nil
+}
+
+// quoteIdentifier quotes a PostgreSQL identifier.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteLiteral quotes a PostgreSQL string literal.
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// consumePostgresChanges delivers replication events until ctx is done or the stream fails.
+// The end of each transaction is saved once its changes have been delivered, and the saved
+// position is reported to the server every interval, and whenever it asks for it.
+func consumePostgresChanges(ctx context.Context, sub *subscription, stream pgReplicationStream, store *checkpointStore, key string, confirmed pglogrepl.LSN, interval time.Duration) error {
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	decoder := newPgoutputDecoder()
+	nextStatus := time.Now().Add(interval)
+	for {
+		if !time.Now().Before(nextStatus) {
+			if err := stream.SendStandbyStatus(ctx, confirmed); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return errors.NewError(errors.ErrorTypeQuery, "failed to confirm replication position", err)
+			}
+			nextStatus = time.Now().Add(interval)
+		}
+
+		receiveCtx, cancel := context.WithDeadline(ctx, nextStatus)
+		msg, err := stream.ReceiveMessage(receiveCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if pgconn.Timeout(err) {
+				continue
+			}
+			return errors.NewError(errors.ErrorTypeQuery, "replication stream failed", err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.ErrorResponse:
+			return errors.NewError(errors.ErrorTypeQuery, "replication stream failed", pgconn.ErrorResponseToPgError(msg))
+		case *pgproto3.CopyData:
+			if len(msg.Data) == 0 {
+				continue
+			}
+			switch msg.Data[0] {
+			case pglogrepl.PrimaryKeepaliveMessageByteID:
+				keepalive, err := pglogrepl.ParsePrimaryKeepaliveMessage(msg.Data[1:])
+				if err != nil {
+					return errors.NewError(errors.ErrorTypeDataIntegrity, "invalid replication keepalive", err)
+				}
+				// Between transactions all WAL up to the server's end has been seen, so
+				// it is confirmed; otherwise an idle slot would hold WAL back forever.
+				if !decoder.inTransaction && keepalive.ServerWALEnd > confirmed {
+					if err := store.Save(key, keepalive.ServerWALEnd.String()); err != nil {
+						return err
+					}
+					confirmed = keepalive.ServerWALEnd
+				}
+				if keepalive.ReplyRequested {
+					nextStatus = time.Time{}
+				}
+			case pglogrepl.XLogDataByteID:
+				xld, err := pglogrepl.ParseXLogData(msg.Data[1:])
+				if err != nil {
+					return errors.NewError(errors.ErrorTypeDataIntegrity, "invalid replication data", err)
+				}
+				events, end, err := decoder.decode(xld.WALStart, xld.WALData)
+				if err != nil {
+					return err
+				}
+				for _, event := range events {
+					if !sub.send(ctx, event) {
+						return nil
+					}
+				}
+				if end != 0 {
+					if err := store.Save(key, end.String()); err != nil {
+						return err
+					}
+					confirmed = end
+				}
+			}
+		}
+	}
+}
+
+// pgoutputDecoder converts pgoutput messages into events. It tracks the relations described
+// by the server and the transaction being streamed.
+type pgoutputDecoder struct {
+	relations  map[uint32]*pglogrepl.RelationMessage
+	types      *pgtype.Map
+	xid        uint32
+	commitTime time.Time
+	// inTransaction is set between a transaction's begin and commit messages.
+	inTransaction bool
+}
+
+func newPgoutputDecoder() *pgoutputDecoder {
+	return &pgoutputDecoder{relations: make(map[uint32]*pglogrepl.RelationMessage), types: pgtype.NewMap()}
+}
+
+// decode decodes a pgoutput message written at lsn. It returns the events of row changes,
+// and the end of the transaction for commits.
+func (d *pgoutputDecoder) decode(lsn pglogrepl.LSN, data []byte) ([]Event, pglogrepl.LSN, error) {
+	msg, err := pglogrepl.Parse(data)
+	if err != nil {
+		return nil, 0, errors.NewError(errors.ErrorTypeDataIntegrity, "invalid pgoutput message", err)
+	}
+
+	switch msg := msg.(type) {
+	case *pglogrepl.RelationMessage:
+		d.relations[msg.RelationID] = msg
+	case *pglogrepl.BeginMessage:
+		d.xid, d.commitTime = msg.Xid, msg.CommitTime
+		d.inTransaction = true
+	case *pglogrepl.CommitMessage:
+		d.inTransaction = false
+		return nil, msg.TransactionEndLSN, nil
+	case *pglogrepl.InsertMessage:
+		rel, err := d.relation(msg.RelationID)
+		if err != nil {
+			return nil, 0, err
+		}
+		row, err := d.tuple(rel, msg.Tuple, false, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []Event{d.event(lsn, rel, "insert", row, nil)}, 0, nil
+	case *pglogrepl.UpdateMessage:
+		rel, err := d.relation(msg.RelationID)
+		if err != nil {
+			return nil, 0, err
+		}
+		before, err := d.tuple(rel, msg.OldTuple, msg.OldTupleType == pglogrepl.UpdateMessageTupleTypeKey, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		row, err := d.tuple(rel, msg.NewTuple, false, before)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []Event{d.event(lsn, rel, "update", row, before)}, 0, nil
+	case *pglogrepl.DeleteMessage:
+		rel, err := d.relation(msg.RelationID)
+		if err != nil {
+			return nil, 0, err
+		}
+		before, err := d.tuple(rel, msg.OldTuple, msg.OldTupleType == pglogrepl.DeleteMessageTupleTypeKey, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		row := make(map[string]interface{}, len(before))
+		for k, v := range before {
+			row[k] = v
+		}
+		return []Event{d.event(lsn, rel, "delete", row, before)}, 0, nil
+	case *pglogrepl.TruncateMessage:
+		events := make([]Event, 0, len(msg.RelationIDs))
+		for _, id := range msg.RelationIDs {
+			rel, err := d.relation(id)
+			if err != nil {
+				return nil, 0, err
+			}
+			events = append(events, d.event(lsn, rel, "truncate", map[string]interface{}{}, nil))
+		}
+		return events, 0, nil
+	}
+	return nil, 0, nil
+}
+
+func (d *pgoutputDecoder) relation(id uint32) (*pglogrepl.RelationMessage, error) {
+	rel, ok := d.relations[id]
+	if !ok {
+		return nil, errors.NewError(errors.ErrorTypeDataIntegrity, fmt.Sprintf("change to unknown relation %d", id), nil)
+	}
+	return rel, nil
+}
+
+// event builds the event of a row change.
+func (d *pgoutputDecoder) event(lsn pglogrepl.LSN, rel *pglogrepl.RelationMessage, operation string, row, before map[string]interface{}) Event {
+	table := rel.Namespace + "." + rel.RelationName
+	row[PostgresOperationColumn] = operation
+	row[PostgresTableColumn] = table
+	row[PostgresTransactionColumn] = int64(d.xid)
+	if before != nil {
+		row[PostgresBeforeColumn] = before
+	}
+	eventTime := d.commitTime
+	if eventTime.IsZero() {
+		eventTime = time.Now()
+	}
+	return Event{Source: table, Data: row, Offset: lsn.String(), Time: eventTime}
+}
+
+// tuple converts a tuple into a row. keyOnly keeps the replica identity columns only, and
+// unchanged TOASTed values are taken from old when it holds them. A nil tuple returns nil.
+func (d *pgoutputDecoder) tuple(rel *pglogrepl.RelationMessage, tuple *pglogrepl.TupleData, keyOnly bool, old map[string]interface{}) (map[string]interface{}, error) {
+	if tuple == nil {
+		return nil, nil
+	}
+	row := make(map[string]interface{}, len(tuple.Columns))
+	for i, col := range tuple.Columns {
+		if i >= len(rel.Columns) {
+			return nil, errors.NewError(errors.ErrorTypeDataIntegrity, fmt.Sprintf("tuple of %s.%s has more columns than its relation", rel.Namespace, rel.RelationName), nil)
+		}
+		column := rel.Columns[i]
+		// Flag 1 marks the columns of the replica identity.
+		if keyOnly && column.Flags&1 == 0 {
+			continue
+		}
+		switch col.DataType {
+		case pglogrepl.TupleDataTypeNull:
+			row[column.Name] = nil
+		case pglogrepl.TupleDataTypeToast:
+			if v, ok := old[column.Name]; ok {
+				row[column.Name] = v
+			}
+		case pglogrepl.TupleDataTypeText:
+			row[column.Name] = d.value(column.DataType, pgtype.TextFormatCode, col.Data)
+		case pglogrepl.TupleDataTypeBinary:
+			row[column.Name] = d.value(column.DataType, pgtype.BinaryFormatCode, col.Data)
+		}
+	}
+	return row, nil
+}
+
+// value decodes a column value by type. Values of unknown types, or that decode to no plain
+// Go value, are returned as text.
+func (d *pgoutputDecoder) value(oid uint32, format int16, data []byte) interface{} {
+	if t, ok := d.types.TypeForOID(oid); ok {
+		if v, err := t.Codec.DecodeValue(d.types, oid, format, data); err == nil {
+			if v, ok := postgresValue(v); ok {
+				return v
+			}
+		}
+	}
+	if format == pgtype.BinaryFormatCode {
+		return data
+	}
+	return string(data)
+}
+
+// postgresValue reports whether a decoded value is a plain Go value, converting UUIDs to
+// strings and converting the elements of arrays.
+func postgresValue(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case nil, bool, int16, int32, int64, float32, float64, string, []byte, time.Time, map[string]interface{}:
+		return v, true
+	case [16]byte:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", v[0:4], v[4:6], v[6:8], v[8:10], v[10:16]), true
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, e := range v {
+			value, ok := postgresValue(e)
+			if !ok {
+				return nil, false
+			}
+			values[i] = value
+		}
+		return values, true
+	}
+	return nil, false
+}
@@ -0,0 +1,328 @@
+package connectors
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReplicationStream replays backend messages, then blocks until the context is done,
+// like a replication connection waiting for new WAL. It records the confirmed positions.
+type fakeReplicationStream struct {
+	messages []pgproto3.BackendMessage
+	mu       sync.Mutex
+	statuses []pglogrepl.LSN
+	closed   bool
+}
+
+func (s *fakeReplicationStream) ReceiveMessage(ctx context.Context) (pgproto3.BackendMessage, error) {
+	s.mu.Lock()
+	if len(s.messages) > 0 {
+		msg := s.messages[0]
+		s.messages = s.messages[1:]
+		s.mu.Unlock()
+		return msg, nil
+	}
+	s.mu.Unlock()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s *fakeReplicationStream) SendStandbyStatus(ctx context.Context, confirmed pglogrepl.LSN) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses = append(s.statuses, confirmed)
+	return nil
+}
+
+func (s *fakeReplicationStream) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *fakeReplicationStream) confirmed() []pglogrepl.LSN {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]pglogrepl.LSN(nil), s.statuses...)
+}
+
+// pgoutput builds pgoutput messages as the server writes them.
+type pgoutput []byte
+
+func (b pgoutput) byte(v byte) pgoutput     { return append(b, v) }
+func (b pgoutput) uint16(v uint16) pgoutput { return binary.BigEndian.AppendUint16(b, v) }
+func (b pgoutput) uint32(v uint32) pgoutput { return binary.BigEndian.AppendUint32(b, v) }
+func (b pgoutput) uint64(v uint64) pgoutput { return binary.BigEndian.AppendUint64(b, v) }
+func (b pgoutput) string(v string) pgoutput { return append(append(b, v...), 0) }
+func (b pgoutput) time(t time.Time) pgoutput {
+	return b.uint64(uint64(t.Sub(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).Microseconds()))
+}
+
+// tuple appends tuple data: nil values are nulls, toast stands for an unchanged TOASTed
+// value, and strings are text values.
+func (b pgoutput) tuple(values ...interface{}) pgoutput {
+	b = b.uint16(uint16(len(values)))
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			b = b.byte('n')
+		case string:
+			b = append(b.byte('t').uint32(uint32(len(v))), v...)
+		default:
+			b = b.byte('u')
+		}
+	}
+	return b
+}
+
+var toast = struct{}{}
+
+type pgColumn struct {
+	name string
+	oid  uint32
+	key  bool
+}
+
+func pgRelation(id uint32, namespace, name string, columns ...pgColumn) pgoutput {
+	b := pgoutput{'R'}.uint32(id).string(namespace).string(name).byte('d').uint16(uint16(len(columns)))
+	for _, c := range columns {
+		var flags byte
+		if c.key {
+			flags = 1
+		}
+		b = b.byte(flags).string(c.name).uint32(c.oid).uint32(0xffffffff)
+	}
+	return b
+}
+
+func pgBegin(final uint64, commitTime time.Time, xid uint32) pgoutput {
+	return pgoutput{'B'}.uint64(final).time(commitTime).uint32(xid)
+}
+
+func pgCommit(commit, end uint64, commitTime time.Time) pgoutput {
+	return pgoutput{'C'}.byte(0).uint64(commit).uint64(end).time(commitTime)
+}
+
+// xlog wraps a pgoutput message in the XLogData copy message that carries it.
+func xlog(lsn uint64, msg pgoutput) *pgproto3.CopyData {
+	data := pgoutput{pglogrepl.XLogDataByteID}.uint64(lsn).uint64(lsn).uint64(0)
+	return &pgproto3.CopyData{Data: append(data, msg...)}
+}
+
+func keepalive(walEnd uint64, reply bool) *pgproto3.CopyData {
+	var flag byte
+	if reply {
+		flag = 1
+	}
+	return &pgproto3.CopyData{Data: pgoutput{pglogrepl.PrimaryKeepaliveMessageByteID}.uint64(walEnd).uint64(0).byte(flag)}
+}
+
+// replicateCall records the arguments of a replicate call.
+type replicateCall struct {
+	opts  PostgresReplicationOptions
+	start pglogrepl.LSN
+}
+
+func newTestReplicationConnector(t *testing.T, stateDir string, streams ...*fakeReplicationStream) (*SQLConnector, *[]replicateCall) {
+	t.Helper()
+	connector := NewSQLConnector(&Config{Driver: "postgres", Database: "shop", StatePath: stateDir})
+	var calls []replicateCall
+	connector.replicate = func(ctx context.Context, opts PostgresReplicationOptions, start pglogrepl.LSN) (pgReplicationStream, error) {
+		calls = append(calls, replicateCall{opts: opts, start: start})
+		require.NotEmpty(t, streams, "unexpected replicate call")
+		stream := streams[0]
+		streams = streams[1:]
+		return stream, nil
+	}
+	return connector, &calls
+}
+
+func TestSQLConnectorSubscribe(t *testing.T) {
+	commitTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	stream := &fakeReplicationStream{messages: []pgproto3.BackendMessage{
+		keepalive(0x100, false),
+		xlog(0x200, pgBegin(0x290, commitTime, 731)),
+		xlog(0x200, pgRelation(16384, "public", "orders",
+			pgColumn{name: "id", oid: pgtype.Int4OID, key: true},
+			pgColumn{name: "total", oid: pgtype.NumericOID},
+			pgColumn{name: "note", oid: pgtype.TextOID},
+			pgColumn{name: "placed_at", oid: pgtype.TimestamptzOID},
+		)),
+		xlog(0x210, pgoutput{'I'}.uint32(16384).byte('N').tuple("1", "9.99", "first", "2024-03-01 11:59:00+00")),
+		xlog(0x220, pgoutput{'U'}.uint32(16384).
+			byte('O').tuple("1", "9.99", "first", "2024-03-01 11:59:00+00").
+			byte('N').tuple("1", "12.50", toast, nil)),
+		xlog(0x230, pgoutput{'D'}.uint32(16384).byte('K').tuple("1", nil, nil, nil)),
+		xlog(0x290, pgCommit(0x290, 0x2a0, commitTime)),
+		keepalive(0x2a0, true),
+	}}
+	stateDir := t.TempDir()
+	connector, calls := newTestReplicationConnector(t, stateDir, stream)
+
+	sub, err := connector.Subscribe(context.Background(), "orders_pub", PostgresReplicationOptions{Tables: []string{"orders"}})
+	require.NoError(t, err)
+	require.Len(t, *calls, 1)
+	assert.Equal(t, "orders_pub", (*calls)[0].opts.Publication)
+	assert.Equal(t, "datavinci_orders_pub", (*calls)[0].opts.Slot)
+	assert.Equal(t, []string{"orders"}, (*calls)[0].opts.Tables)
+	assert.Zero(t, (*calls)[0].start)
+
+	placedAt := time.Date(2024, 3, 1, 11, 59, 0, 0, time.UTC)
+	insert := nextEvent(t, sub)
+	assert.Equal(t, "public.orders", insert.Source)
+	assert.Equal(t, "0/210", insert.Offset)
+	assert.Equal(t, commitTime, insert.Time.UTC())
+	assert.Equal(t, "insert", insert.Data[PostgresOperationColumn])
+	assert.Equal(t, "public.orders", insert.Data[PostgresTableColumn])
+	assert.Equal(t, int64(731), insert.Data[PostgresTransactionColumn])
+	assert.Equal(t, int32(1), insert.Data["id"])
+	assert.Equal(t, "9.99", insert.Data["total"])
+	assert.Equal(t, "first", insert.Data["note"])
+	assert.True(t, placedAt.Equal(insert.Data["placed_at"].(time.Time)))
+	assert.NotContains(t, insert.Data, PostgresBeforeColumn)
+
+	// The unchanged TOASTed note is taken from the old row.
+	update := nextEvent(t, sub)
+	assert.Equal(t, "update", update.Data[PostgresOperationColumn])
+	assert.Equal(t, "12.50", update.Data["total"])
+	assert.Equal(t, "first", update.Data["note"])
+	assert.Nil(t, update.Data["placed_at"])
+	before := update.Data[PostgresBeforeColumn].(map[string]interface{})
+	assert.Equal(t, "9.99", before["total"])
+	assert.Len(t, before, 4)
+
+	// A delete with the default replica identity carries the key only.
+	del := nextEvent(t, sub)
+	assert.Equal(t, "delete", del.Data[PostgresOperationColumn])
+	assert.Equal(t, int32(1), del.Data["id"])
+	assert.NotContains(t, del.Data, "total")
+	assert.Equal(t, map[string]interface{}{"id": int32(1)}, del.Data[PostgresBeforeColumn])
+
+	// The commit is saved, then confirmed when the server asks for a reply.
+	require.Eventually(t, func() bool {
+		statuses := stream.confirmed()
+		return len(statuses) > 0 && statuses[len(statuses)-1] == 0x2a0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, sub.Close())
+	assert.NoError(t, sub.Err())
+	assert.True(t, stream.closed)
+
+	// A new subscription, even from a new connector, resumes after the commit.
+	connector, calls = newTestReplicationConnector(t, stateDir, &fakeReplicationStream{})
+	sub, err = connector.Subscribe(context.Background(), "orders_pub")
+	require.NoError(t, err)
+	require.NoError(t, sub.Close())
+	assert.Equal(t, pglogrepl.LSN(0x2a0), (*calls)[0].start)
+
+	// Temporary slots start afresh.
+	connector, calls = newTestReplicationConnector(t, stateDir, &fakeReplicationStream{})
+	sub, err = connector.Subscribe(context.Background(), "orders_pub", &PostgresReplicationOptions{TemporarySlot: true})
+	require.NoError(t, err)
+	require.NoError(t, sub.Close())
+	assert.Zero(t, (*calls)[0].start)
+}
+
+func TestSQLConnectorSubscribeConfirmsIdleWAL(t *testing.T) {
+	stream := &fakeReplicationStream{messages: []pgproto3.BackendMessage{
+		keepalive(0x500, false),
+		xlog(0x600, pgBegin(0x690, time.Now(), 40)),
+		// WAL of other databases may pass while a transaction is streamed.
+		keepalive(0x700, true),
+	}}
+	stateDir := t.TempDir()
+	connector, _ := newTestReplicationConnector(t, stateDir, stream)
+	sub, err := connector.Subscribe(context.Background(), "pub")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		statuses := stream.confirmed()
+		return len(statuses) > 0 && statuses[len(statuses)-1] == 0x500
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, sub.Close())
+
+	connector, calls := newTestReplicationConnector(t, stateDir, &fakeReplicationStream{})
+	sub, err = connector.Subscribe(context.Background(), "pub")
+	require.NoError(t, err)
+	require.NoError(t, sub.Close())
+	assert.Equal(t, pglogrepl.LSN(0x500), (*calls)[0].start)
+}
+
+func TestSQLConnectorSubscribeTruncate(t *testing.T) {
+	stream := &fakeReplicationStream{messages: []pgproto3.BackendMessage{
+		xlog(0x300, pgBegin(0x390, time.Now(), 12)),
+		xlog(0x300, pgRelation(1, "public", "a", pgColumn{name: "id", oid: pgtype.Int8OID, key: true})),
+		xlog(0x300, pgRelation(2, "audit", "b", pgColumn{name: "id", oid: pgtype.Int8OID, key: true})),
+		xlog(0x310, pgoutput{'T'}.uint32(2).byte(0).uint32(1).uint32(2)),
+	}}
+	connector, _ := newTestReplicationConnector(t, "", stream)
+	sub, err := connector.Subscribe(context.Background(), "pub", PostgresReplicationOptions{Slot: "custom"})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	first, second := nextEvent(t, sub), nextEvent(t, sub)
+	assert.Equal(t, "truncate", first.Data[PostgresOperationColumn])
+	assert.Equal(t, "public.a", first.Data[PostgresTableColumn])
+	assert.Equal(t, "audit.b", second.Source)
+}
+
+func TestSQLConnectorSubscribeErrors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewSQLConnector(&Config{Driver: "mysql"}).Subscribe(ctx, "pub")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+
+	connector, _ := newTestReplicationConnector(t, "")
+	_, err = connector.Subscribe(ctx, "")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	_, err = connector.Subscribe(ctx, "pub", PostgresReplicationOptions{Slot: "Bad-Slot"})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	_, err = connector.Subscribe(ctx, "pub", "slot")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+
+	// Changes to relations the server has not described cannot be decoded.
+	connector, _ = newTestReplicationConnector(t, "", &fakeReplicationStream{messages: []pgproto3.BackendMessage{
+		xlog(0x10, pgoutput{'I'}.uint32(99).byte('N').tuple("1")),
+	}})
+	sub, err := connector.Subscribe(ctx, "pub")
+	require.NoError(t, err)
+	for range sub.Events() {
+	}
+	assert.True(t, errors.IsErrorType(sub.Err(), errors.ErrorTypeDataIntegrity))
+
+	connector, _ = newTestReplicationConnector(t, "", &fakeReplicationStream{messages: []pgproto3.BackendMessage{
+		&pgproto3.ErrorResponse{Severity: "ERROR", Code: "58P01", Message: "requested WAL segment has already been removed"},
+	}})
+	sub, err = connector.Subscribe(ctx, "pub")
+	require.NoError(t, err)
+	for range sub.Events() {
+	}
+	assert.True(t, errors.IsErrorType(sub.Err(), errors.ErrorTypeQuery))
+	assert.Contains(t, sub.Err().Error(), "already been removed")
+}
+
+func TestPgoutputDecoderValues(t *testing.T) {
+	d := newPgoutputDecoder()
+	assert.Equal(t, true, d.value(pgtype.BoolOID, pgtype.TextFormatCode, []byte("t")))
+	assert.Equal(t, int64(42), d.value(pgtype.Int8OID, pgtype.TextFormatCode, []byte("42")))
+	assert.Equal(t, 1.5, d.value(pgtype.Float8OID, pgtype.TextFormatCode, []byte("1.5")))
+	assert.Equal(t, "123.450", d.value(pgtype.NumericOID, pgtype.TextFormatCode, []byte("123.450")))
+	assert.Equal(t, "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11",
+		d.value(pgtype.UUIDOID, pgtype.TextFormatCode, []byte("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11")))
+	assert.Equal(t, map[string]interface{}{"a": []interface{}{1.0}},
+		d.value(pgtype.JSONBOID, pgtype.TextFormatCode, []byte(`{"a": [1]}`)))
+	assert.Equal(t, []interface{}{int32(1), int32(2)}, d.value(pgtype.Int4ArrayOID, pgtype.TextFormatCode, []byte("{1,2}")))
+	// Unknown types, such as enums, stay text.
+	assert.Equal(t, "shipped", d.value(90000, pgtype.TextFormatCode, []byte("shipped")))
+}
@@ -0,0 +1,401 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"pkg/common/errors"
+)
+
+// Columns of the rows returned by PrometheusConnector queries. Each label of a series is a
+// column too; a label that is itself named "timestamp" or "value" becomes "label_timestamp"
+// or "label_value".
+const (
+	// PrometheusTimestampColumn holds the time of a sample, as an RFC 3339 string in UTC.
+	PrometheusTimestampColumn = "timestamp"
+	// PrometheusValueColumn holds the value of a sample as a float64, or the value of a
+	// string result as a string.
+	PrometheusValueColumn = "value"
+)
+
+// maxPrometheusPoints is the number of points per series that the default step of a range
+// query aims for.
+const maxPrometheusPoints = 250
+
+// PrometheusQueryOptions configures a PromQL query. A query with a Start is a range query;
+// any other query is an instant query.
+type PrometheusQueryOptions struct {
+	// Time is the evaluation time of an instant query. Defaults to the server's current time.
+	Time time.Time
+	// Start and End bound a range query. End defaults to now.
+	Start time.Time
+	End   time.Time
+	// Step is the resolution of a range query. Defaults to the step option, or to the range
+	// divided into 250 steps, rounded up to a whole second.
+	Step time.Duration
+	// Timeout bounds the evaluation on the server. Defaults to the query_timeout option.
+	Timeout time.Duration
+}
+
+// PrometheusMetric describes a metric, with the metadata the server reports for it.
+type PrometheusMetric struct {
+	Name string
+	// Type is the metric type, such as "counter" or "histogram", if known.
+	Type string
+	Help string
+	Unit string
+}
+
+// PrometheusConnector implements the Connector interface for the Prometheus HTTP API, and
+// for compatible APIs such as those of Thanos, Cortex, Mimir and VictoriaMetrics. It shares
+// the HTTP handling of APIConnector, including authentication, headers, retries and the
+// mapping of HTTP statuses to errors.
+type PrometheusConnector struct {
+	api    *APIConnector
+	config *Config
+	now    func() time.Time
+}
+
+// NewPrometheusConnector creates a new PrometheusConnector with the given configuration.
+//
+// The config parameter should include:
+//   - BaseURL: The URL of the server, such as "http://localhost:9090"
+//   - TimeoutSeconds: Timeout for each request
+//   - Options["step"]: The default step of range queries, such as "1m"
+//   - Options["query_timeout"]: The default evaluation timeout, such as "30s"
+//   - Options["auth"], Options["header.<Name>"]: Authentication and headers, as for NewAPIConnector
+//
+// Example:
+//
+//	config := &Config{
+//	    BaseURL: "http://prometheus:9090",
+//	    Options: map[string]interface{}{"step": "1m"},
+//	}
+//	connector := NewPrometheusConnector(config)
+func NewPrometheusConnector(config *Config) *PrometheusConnector {
+	apiConfig := *config
+	apiConfig.IsWebSocket = false
+	apiConfig.PollingIntervalSeconds = 0
+	return &PrometheusConnector{
+		api:    NewAPIConnector(&apiConfig),
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// Connect validates the configuration. Requests are independent, so no connection is held open.
+func (c *PrometheusConnector) Connect(ctx context.Context) error {
+	if c.config.BaseURL == "" {
+		return errors.NewError(errors.ErrorTypeConfiguration, "base URL is required for Prometheus connector", nil)
+	}
+	for _, key := range []string{"step", "query_timeout"} {
+		if _, err := c.durationOption(key); err != nil {
+			return err
+		}
+	}
+	return c.api.Connect(ctx)
+}
+
+// Close releases the connector.
+func (c *PrometheusConnector) Close(ctx context.Context) error {
+	return c.api.Close(ctx)
+}
+
+// Query runs a PromQL query and returns one row per sample, with the time in
+// PrometheusTimestampColumn, the value in PrometheusValueColumn and the labels of the series
+// as columns. Range queries return the samples of each series in turn. Arguments may be a
+// PrometheusQueryOptions.
+//
+// Example:
+//
+//	rows, err := connector.Query(ctx, `sum by (job) (rate(http_requests_total[5m]))`,
+//	    PrometheusQueryOptions{Start: time.Now().Add(-time.Hour), Step: time.Minute})
+func (c *PrometheusConnector) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	var opts PrometheusQueryOptions
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case PrometheusQueryOptions:
+			opts = v
+		case *PrometheusQueryOptions:
+			opts = *v
+		default:
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("invalid Prometheus query option type %T", arg), nil)
+		}
+	}
+
+	params := map[string]interface{}{"query": query}
+	if opts.Timeout == 0 {
+		d, err := c.durationOption("query_timeout")
+		if err != nil {
+			return nil, err
+		}
+		opts.Timeout = d
+	}
+	if opts.Timeout > 0 {
+		params["timeout"] = opts.Timeout.String()
+	}
+
+	path := "/api/v1/query"
+	if opts.Start.IsZero() {
+		if !opts.Time.IsZero() {
+			params["time"] = prometheusTime(opts.Time)
+		}
+	} else {
+		path = "/api/v1/query_range"
+		if opts.End.IsZero() {
+			opts.End = c.now()
+		}
+		if !opts.End.After(opts.Start) {
+			return nil, errors.NewError(errors.ErrorTypeValidation, "range query end must be after its start", nil)
+		}
+		if opts.Step == 0 {
+			d, err := c.durationOption("step")
+			if err != nil {
+				return nil, err
+			}
+			opts.Step = d
+		}
+		if opts.Step <= 0 {
+			opts.Step = opts.End.Sub(opts.Start) / maxPrometheusPoints
+			opts.Step = (opts.Step + time.Second - 1).Truncate(time.Second)
+		}
+		params["start"] = prometheusTime(opts.Start)
+		params["end"] = prometheusTime(opts.End)
+		params["step"] = strconv.FormatFloat(opts.Step.Seconds(), 'f', -1, 64)
+	}
+
+	var result struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	}
+	if err := c.get(ctx, path, params, errors.ErrorTypeQuery, &result); err != nil {
+		return nil, err
+	}
+	return prometheusRows(result.ResultType, result.Result)
+}
+
+// Execute is not supported, as the Prometheus query API is read-only.
+func (c *PrometheusConnector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
+	return 0, errors.NewError(errors.ErrorTypeUnsupported, "commands are not supported for Prometheus connector", nil)
+}
+
+// Ping checks that the server evaluates queries.
+func (c *PrometheusConnector) Ping(ctx context.Context) error {
+	var result interface{}
+	return c.get(ctx, "/api/v1/query", map[string]interface{}{"query": "1"}, errors.ErrorTypeAPIConnection, &result)
+}
+
+// Transaction is not supported for Prometheus.
+func (c *PrometheusConnector) Transaction(ctx context.Context) (TransactionConnector, error) {
+	return nil, errors.NewError(errors.ErrorTypeUnsupported, "transactions are not supported for Prometheus connector", nil)
+}
+
+// Labels returns the sorted names of the labels of the stored series.
+func (c *PrometheusConnector) Labels(ctx context.Context) ([]string, error) {
+	var labels []string
+	if err := c.get(ctx, "/api/v1/labels", nil, errors.ErrorTypeQuery, &labels); err != nil {
+		return nil, err
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+// LabelValues returns the sorted values of a label. The values of "__name__" are the metric names.
+func (c *PrometheusConnector) LabelValues(ctx context.Context, label string) ([]string, error) {
+	var values []string
+	if err := c.get(ctx, "/api/v1/label/"+url.PathEscape(label)+"/values", nil, errors.ErrorTypeQuery, &values); err != nil {
+		return nil, err
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+// Metrics returns the metrics of the stored series sorted by name, with the metadata of
+// those the server has metadata for.
+func (c *PrometheusConnector) Metrics(ctx context.Context) ([]PrometheusMetric, error) {
+	names, err := c.LabelValues(ctx, "__name__")
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata map[string][]struct {
+		Type string `json:"type"`
+		Help string `json:"help"`
+		Unit string `json:"unit"`
+	}
+	if err := c.get(ctx, "/api/v1/metadata", nil, errors.ErrorTypeQuery, &metadata); err != nil {
+		// Metadata is optional; some compatible servers do not offer it.
+		if !errors.IsErrorType(err, errors.ErrorTypeNotFound) {
+			return nil, err
+		}
+	}
+
+	metrics := make([]PrometheusMetric, len(names))
+	for i, name := range names {
+		metrics[i] = PrometheusMetric{Name: name}
+		if m := metadata[name]; len(m) > 0 {
+			metrics[i].Type, metrics[i].Help, metrics[i].Unit = m[0].Type, m[0].Help, m[0].Unit
+		}
+	}
+	return metrics, nil
+}
+
+// Series returns the label sets of the series that match any of the selectors, such as
+// `up{job="node"}`.
+func (c *PrometheusConnector) Series(ctx context.Context, matchers ...string) ([]map[string]string, error) {
+	if len(matchers) == 0 {
+		return nil, errors.NewError(errors.ErrorTypeValidation, "at least one series selector is required", nil)
+	}
+	var series []map[string]string
+	if err := c.get(ctx, "/api/v1/series", map[string]interface{}{"match[]": matchers}, errors.ErrorTypeQuery, &series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// get calls an API endpoint and decodes the data of its response into out. Failures the
+// server reports in the response body, with the error types of the Prometheus API, keep the
+// error type of their HTTP status.
+func (c *PrometheusConnector) get(ctx context.Context, path string, params map[string]interface{}, errType errors.ErrorType, out interface{}) error {
+	body, _, err := c.api.doHTTP(ctx, path, APIRequestOptions{Method: http.MethodGet, Params: params}, errType)
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Status    string          `json:"status"`
+		Data      json.RawMessage `json:"data"`
+		ErrorType string          `json:"errorType"`
+		Error     string          `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return errors.NewError(errType, "failed to decode Prometheus response", err)
+	}
+	if resp.Status != "success" {
+		return errors.NewError(errType, fmt.Sprintf("Prometheus request failed: %s: %s", resp.ErrorType, resp.Error), nil)
+	}
+	if err := json.Unmarshal(resp.Data, out); err != nil {
+		return errors.NewError(errType, "failed to decode Prometheus response data", err)
+	}
+	return nil
+}
+
+// durationOption reads an option holding a duration such as "30s". It returns 0 if the
+// option is not set.
+func (c *PrometheusConnector) durationOption(key string) (time.Duration, error) {
+	s, ok := c.config.option(key)
+	if !ok {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("option %s must be a positive duration", key), err)
+	}
+	return d, nil
+}
+
+// prometheusTime formats a time as Unix seconds, as the API accepts.
+func prometheusTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+}
+
+// prometheusSample is a [<unix seconds>, "<value>"] pair.
+type prometheusSample [2]interface{}
+
+// row converts the sample to a row with the given labels.
+func (s prometheusSample) row(labels map[string]string, numeric bool) (map[string]interface{}, error) {
+	seconds, ok := s[0].(float64)
+	if !ok {
+		return nil, errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("invalid sample time %v", s[0]), nil)
+	}
+	text, ok := s[1].(string)
+	if !ok {
+		return nil, errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("invalid sample value %v", s[1]), nil)
+	}
+
+	row := make(map[string]interface{}, len(labels)+2)
+	for name, value := range labels {
+		if name == PrometheusTimestampColumn || name == PrometheusValueColumn {
+			name = "label_" + name
+		}
+		row[name] = value
+	}
+	sec, frac := math.Modf(seconds)
+	row[PrometheusTimestampColumn] = time.Unix(int64(sec), int64(math.Round(frac*1000))*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano)
+	if !numeric {
+		row[PrometheusValueColumn] = text
+		return row, nil
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("invalid sample value %q", text), err)
+	}
+	row[PrometheusValueColumn] = value
+	return row, nil
+}
+
+// prometheusRows converts a query result of any result type to rows.
+func prometheusRows(resultType string, raw json.RawMessage) ([]map[string]interface{}, error) {
+	decode := func(v interface{}) error {
+		if err := json.Unmarshal(raw, v); err != nil {
+			return errors.NewError(errors.ErrorTypeQuery, "failed to decode "+resultType+" result", err)
+		}
+		return nil
+	}
+
+	rows := []map[string]interface{}{}
+	switch resultType {
+	case "matrix":
+		var series []struct {
+			Metric map[string]string  `json:"metric"`
+			Values []prometheusSample `json:"values"`
+		}
+		if err := decode(&series); err != nil {
+			return nil, err
+		}
+		for _, s := range series {
+			for _, sample := range s.Values {
+				row, err := sample.row(s.Metric, true)
+				if err != nil {
+					return nil, err
+				}
+				rows = append(rows, row)
+			}
+		}
+	case "vector":
+		var samples []struct {
+			Metric map[string]string `json:"metric"`
+			Value  prometheusSample  `json:"value"`
+		}
+		if err := decode(&samples); err != nil {
+			return nil, err
+		}
+		for _, s := range samples {
+			row, err := s.Value.row(s.Metric, true)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+	case "scalar", "string":
+		var sample prometheusSample
+		if err := decode(&sample); err != nil {
+			return nil, err
+		}
+		row, err := sample.row(nil, resultType == "scalar")
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	default:
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("unsupported Prometheus result type %q", resultType), nil)
+	}
+	return rows, nil
+}
@@ -0,0 +1,188 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPrometheusServer serves canned API responses by path, and records the query of each request.
+func newPrometheusServer(t *testing.T, responses map[string]string) (*httptest.Server, *[]url.Values) {
+	var mu sync.Mutex
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("query") == "bad(" {
+			w.WriteHeader(http.StatusBadRequest)
+			body = `{"status": "error", "errorType": "bad_data", "error": "unexpected end of input"}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &queries
+}
+
+func newTestPrometheusConnector(t *testing.T, url string, options map[string]interface{}) *PrometheusConnector {
+	t.Helper()
+	connector := NewPrometheusConnector(&Config{BaseURL: url, TimeoutSeconds: 5, Options: options})
+	require.NoError(t, connector.Connect(context.Background()))
+	t.Cleanup(func() { connector.Close(context.Background()) })
+	return connector
+}
+
+func TestPrometheusConnectorRangeQuery(t *testing.T) {
+	server, queries := newPrometheusServer(t, map[string]string{
+		"/api/v1/query_range": `{"status": "success", "data": {"resultType": "matrix", "result": [
+			{"metric": {"job": "api", "value": "x"}, "values": [[1700000000, "1.5"], [1700000060.5, "2"]]},
+			{"metric": {"job": "db"}, "values": [[1700000000, "NaN"]]}
+		]}}`,
+	})
+	connector := newTestPrometheusConnector(t, server.URL, map[string]interface{}{"query_timeout": "10s"})
+	ctx := context.Background()
+
+	start := time.Unix(1700000000, 0)
+	rows, err := connector.Query(ctx, `rate(requests_total[5m])`, PrometheusQueryOptions{Start: start, End: start.Add(time.Hour), Step: time.Minute})
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, map[string]interface{}{"job": "api", "label_value": "x", "timestamp": "2023-11-14T22:13:20Z", "value": 1.5}, rows[0])
+	assert.Equal(t, "2023-11-14T22:14:20.5Z", rows[1]["timestamp"])
+	assert.Equal(t, "db", rows[2]["job"])
+	assert.True(t, math.IsNaN(rows[2]["value"].(float64)))
+
+	q := (*queries)[0]
+	assert.Equal(t, "rate(requests_total[5m])", q.Get("query"))
+	assert.Equal(t, "1700000000", q.Get("start"))
+	assert.Equal(t, "1700003600", q.Get("end"))
+	assert.Equal(t, "60", q.Get("step"))
+	assert.Equal(t, "10s", q.Get("timeout"))
+
+	// The step defaults to a fraction of the range, and the end to now.
+	connector.now = func() time.Time { return start.Add(24 * time.Hour) }
+	_, err = connector.Query(ctx, "up", &PrometheusQueryOptions{Start: start})
+	require.NoError(t, err)
+	assert.Equal(t, "346", (*queries)[1].Get("step"))
+	assert.Equal(t, "1700086400", (*queries)[1].Get("end"))
+
+	_, err = connector.Query(ctx, "up", PrometheusQueryOptions{Start: start, End: start})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation))
+}
+
+func TestPrometheusConnectorInstantQuery(t *testing.T) {
+	server, queries := newPrometheusServer(t, map[string]string{
+		"/api/v1/query": `{"status": "success", "data": {"resultType": "vector", "result": [
+			{"metric": {"__name__": "up", "instance": "a:9100"}, "value": [1700000000.123, "1"]}
+		]}}`,
+	})
+	connector := newTestPrometheusConnector(t, server.URL, nil)
+	ctx := context.Background()
+
+	rows, err := connector.Query(ctx, "up", PrometheusQueryOptions{Time: time.UnixMilli(1700000000123)})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"__name__": "up", "instance": "a:9100", "timestamp": "2023-11-14T22:13:20.123Z", "value": 1.0},
+	}, rows)
+	assert.Equal(t, "1700000000.123", (*queries)[0].Get("time"))
+	assert.Empty(t, (*queries)[0].Get("timeout"))
+
+	// Rows are in the shape TimeSeriesProcessor reads: an RFC 3339 time and a float64 measure.
+	_, err = time.Parse(time.RFC3339, rows[0][PrometheusTimestampColumn].(string))
+	assert.NoError(t, err)
+	assert.IsType(t, float64(0), rows[0][PrometheusValueColumn])
+
+	_, err = connector.Query(ctx, "bad(")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation))
+	assert.Contains(t, err.Error(), "unexpected end of input")
+
+	_, err = connector.Query(ctx, "up", "now")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	_, err = connector.Execute(ctx, "up")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+	require.NoError(t, connector.Ping(ctx))
+}
+
+func TestPrometheusRows(t *testing.T) {
+	rows, err := prometheusRows("scalar", []byte(`[1700000000, "42"]`))
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"timestamp": "2023-11-14T22:13:20Z", "value": 42.0}}, rows)
+
+	rows, err = prometheusRows("string", []byte(`[1700000000, "hello"]`))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", rows[0]["value"])
+
+	rows, err = prometheusRows("vector", []byte(`[]`))
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+
+	_, err = prometheusRows("vector", []byte(`[{"metric": {}, "value": [1700000000, "many"]}]`))
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeQuery))
+	_, err = prometheusRows("histogram", []byte(`[]`))
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+}
+
+func TestPrometheusConnectorDiscovery(t *testing.T) {
+	server, queries := newPrometheusServer(t, map[string]string{
+		"/api/v1/labels":                `{"status": "success", "data": ["job", "__name__", "instance"]}`,
+		"/api/v1/label/__name__/values": `{"status": "success", "data": ["up", "http_requests_total"]}`,
+		"/api/v1/label/job/values":      `{"status": "success", "data": ["node", "api"]}`,
+		"/api/v1/metadata":              `{"status": "success", "data": {"http_requests_total": [{"type": "counter", "help": "Requests served.", "unit": ""}]}}`,
+		"/api/v1/series":                `{"status": "success", "data": [{"__name__": "up", "job": "node"}]}`,
+	})
+	connector := newTestPrometheusConnector(t, server.URL, nil)
+	ctx := context.Background()
+
+	labels, err := connector.Labels(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"__name__", "instance", "job"}, labels)
+
+	values, err := connector.LabelValues(ctx, "job")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api", "node"}, values)
+
+	metrics, err := connector.Metrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []PrometheusMetric{
+		{Name: "http_requests_total", Type: "counter", Help: "Requests served."},
+		{Name: "up"},
+	}, metrics)
+
+	series, err := connector.Series(ctx, `up`, `{job="api"}`)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{{"__name__": "up", "job": "node"}}, series)
+	assert.Equal(t, []string{`up`, `{job="api"}`}, (*queries)[len(*queries)-1]["match[]"])
+
+	_, err = connector.Series(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation))
+	_, err = connector.LabelValues(ctx, "instance")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+}
+
+func TestPrometheusConnectorConfig(t *testing.T) {
+	ctx := context.Background()
+	err := NewPrometheusConnector(&Config{}).Connect(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+	err = NewPrometheusConnector(&Config{BaseURL: "http://localhost:9090", Options: map[string]interface{}{"step": "often"}}).Connect(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+
+	connector, err := ConnectorFactory(&Config{Type: "prometheus", BaseURL: "http://localhost:9090"})
+	require.NoError(t, err)
+	assert.IsType(t, &PrometheusConnector{}, connector)
+}
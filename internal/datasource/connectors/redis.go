@@ -2,7 +2,13 @@ package connectors
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	"pkg/common/errors"
 	"pkg/common/retry"
@@ -10,37 +16,215 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
-// RedisConnector implements the Connector interface for Redis.
+// Key types, as reported by the TYPE command.
+const (
+	RedisTypeNone   = "none"
+	RedisTypeString = "string"
+	RedisTypeHash   = "hash"
+	RedisTypeList   = "list"
+	RedisTypeSet    = "set"
+	RedisTypeZSet   = "zset"
+	RedisTypeStream = "stream"
+	RedisTypeJSON   = "ReJSON-RL"
+)
+
+// RedisKeyColumn is the column holding the key that each row returned by Query was read from.
+const RedisKeyColumn = "_key"
+
+// defaultRedisScanCount is the COUNT hint passed to SCAN when none is configured.
+const defaultRedisScanCount = 100
+
+// RedisQueryOptions controls how RedisConnector.Query reads keys.
+type RedisQueryOptions struct {
+	// Offset and Count select a range of list elements or sorted set members. Offset may be
+	// negative to count from the end, and a zero Count reads to the end.
+	Offset int64
+	Count  int64
+	// Min and Max select sorted set members by score, such as "(1.5" or "+inf". When either
+	// is set, Offset and Count apply to the members within the score range. For streams they
+	// are the first and last entry IDs, and Count limits the number of entries.
+	Min string
+	Max string
+	// Reverse reads sorted sets from the highest score, and streams from the newest entry.
+	Reverse bool
+	// Path is the RedisJSON path read from JSON keys. Defaults to "$".
+	Path string
+	// ScanCount is the SCAN COUNT hint used for key patterns. Defaults to the scan_count option.
+	ScanCount int64
+	// Type restricts a key pattern to keys of one type, such as RedisTypeHash.
+	Type string
+	// MaxKeys caps the number of keys read for a key pattern. Zero means no limit.
+	MaxKeys int
+}
+
+// IsRedisPattern reports whether a key contains glob characters, so that it is read with SCAN.
+func IsRedisPattern(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
+
+// Redis deployment modes, selected with the "mode" option.
+const (
+	// RedisModeStandalone connects to a single server.
+	RedisModeStandalone = "standalone"
+	// RedisModeSentinel discovers the master through Sentinel and follows failovers.
+	RedisModeSentinel = "sentinel"
+	// RedisModeCluster connects to a Redis Cluster through its seed nodes.
+	RedisModeCluster = "cluster"
+)
+
+const (
+	// defaultRedisPort is the default port of Redis servers and cluster nodes.
+	defaultRedisPort = 6379
+	// defaultSentinelPort is the default port of Sentinel servers.
+	defaultSentinelPort = 26379
+)
+
+// RedisConnector implements the Connector interface for Redis. It supports standalone servers,
+// Sentinel-managed replication and Redis Cluster.
 type RedisConnector struct {
-	client *redis.Client
-	config *Config
+	client    redis.UniversalClient
+	config    *Config
+	scanCount int64
 }
 
 // NewRedisConnector creates a new RedisConnector with the given configuration.
+//
+// The config parameter should include:
+//   - Host: The server, or a comma-separated list of Sentinel servers or cluster seed nodes.
+//     Each may include its own port.
+//   - Port: The port for hosts without one. Defaults to 6379, or 26379 for Sentinel.
+//   - Username: The ACL username, if the server uses ACLs
+//   - Password: The password, if the server requires one
+//   - RedisDB: The database number. Redis Cluster only has database 0.
+//   - Options["mode"]: "standalone" (the default), "sentinel" or "cluster"
+//   - Options["master_name"]: The name of the master monitored by Sentinel. Required for Sentinel.
+//   - Options["sentinel_username"], Options["sentinel_password"]: Credentials for the Sentinel servers
+//   - Options["tls"] and the other TLS options: See Config.tlsConfig
+//   - Options["scan_count"]: The COUNT hint for SCAN when reading key patterns. Defaults to 100.
+//
+// Example:
+//
+//	config := &Config{
+//	    Host:     "sentinel-1:26379,sentinel-2:26379,sentinel-3:26379",
+//	    Username: "dashboard",
+//	    Password: "secret",
+//	    Options: map[string]interface{}{
+//	        "mode":        "sentinel",
+//	        "master_name": "mymaster",
+//	        "tls":         true,
+//	    },
+//	}
+//	connector := NewRedisConnector(config)
 func NewRedisConnector(config *Config) *RedisConnector {
 	return &RedisConnector{config: config}
 }
 
 // Connect establishes a connection to the Redis database.
 func (c *RedisConnector) Connect(ctx context.Context) error {
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", c.config.Host, c.config.Port),
-		Password: c.config.Password,
-		DB:       c.config.RedisDB, // Redis uses integer for database selection
-	})
+	scanCount, err := c.config.intOption("scan_count", defaultRedisScanCount)
+	if err != nil {
+		return err
+	}
+	if scanCount <= 0 {
+		return errors.NewError(errors.ErrorTypeConfiguration, "option scan_count must be positive", nil)
+	}
+
+	client, err := c.newClient()
+	if err != nil {
+		return err
+	}
 
-	err := retry.Retry(ctx, func() error {
+	err = retry.Retry(ctx, func() error {
 		return client.Ping(ctx).Err()
 	}, retry.DefaultConfig())
 
 	if err != nil {
+		client.Close()
 		return errors.NewError(errors.ErrorTypeDatabaseConnection, "failed to connect to Redis", err)
 	}
 
 	c.client = client
+	c.scanCount = int64(scanCount)
 	return nil
 }
 
+// newClient creates the client for the configured mode.
+func (c *RedisConnector) newClient() (redis.UniversalClient, error) {
+	mode := RedisModeStandalone
+	if m, ok := c.config.option("mode"); ok {
+		mode = m
+	}
+	tlsConfig, err := c.config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	port := defaultRedisPort
+	if mode == RedisModeSentinel {
+		port = defaultSentinelPort
+	}
+	if c.config.Port > 0 {
+		port = c.config.Port
+	}
+	var addrs []string
+	for _, host := range strings.Split(c.config.Host, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		addrs = append(addrs, host)
+	}
+	if len(addrs) == 0 {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "host is required for Redis connector", nil)
+	}
+
+	switch mode {
+	case RedisModeStandalone:
+		if len(addrs) > 1 {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "standalone mode takes a single host; use sentinel or cluster mode for several", nil)
+		}
+		return redis.NewClient(&redis.Options{
+			Addr:      addrs[0],
+			Username:  c.config.Username,
+			Password:  c.config.Password,
+			DB:        c.config.RedisDB, // Redis uses integer for database selection
+			TLSConfig: tlsConfig,
+		}), nil
+	case RedisModeSentinel:
+		masterName, ok := c.config.option("master_name")
+		if !ok {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "option master_name is required in sentinel mode", nil)
+		}
+		sentinelUsername, _ := c.config.option("sentinel_username")
+		sentinelPassword, _ := c.config.option("sentinel_password")
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       masterName,
+			SentinelAddrs:    addrs,
+			SentinelUsername: sentinelUsername,
+			SentinelPassword: sentinelPassword,
+			Username:         c.config.Username,
+			Password:         c.config.Password,
+			DB:               c.config.RedisDB,
+			TLSConfig:        tlsConfig,
+		}), nil
+	case RedisModeCluster:
+		if c.config.RedisDB != 0 {
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "Redis Cluster only supports database 0", nil)
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     addrs,
+			Username:  c.config.Username,
+			Password:  c.config.Password,
+			TLSConfig: tlsConfig,
+		}), nil
+	default:
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("unknown Redis mode %q", mode), nil)
+	}
+}
+
 // Close closes the connection to the Redis database.
 func (c *RedisConnector) Close(ctx context.Context) error {
 	if c.client == nil {
@@ -49,37 +233,397 @@ func (c *RedisConnector) Close(ctx context.Context) error {
 	return c.client.Close()
 }
 
-// Query executes a query and returns the results as a slice of maps.
-// For Redis, this is implemented as a key lookup.
+// Query reads a key, or every key matching a glob pattern, and returns its contents as rows.
+// Patterns are matched with SCAN, so reading them does not block the server.
+//
+// The rows depend on the type of each key, and every row includes the key in the "_key" column:
+//   - string: one row with the value in "value"
+//   - hash: one row with a column per field
+//   - list: one row per element, with "index" and "value"
+//   - set: one row per member, in "member"
+//   - zset: one row per member, with "member" and "score", in score order
+//   - stream: one row per entry, with a column per field and the entry ID in "_id"
+//   - ReJSON-RL: one row per value matched by the JSON path; objects become a row with a
+//     column per property, and other values are returned in "value"
+//
+// An optional RedisQueryOptions argument selects ranges, the JSON path and SCAN settings.
+// A missing key returns no rows.
+//
+// Example:
+//
+//	rows, err := connector.Query(ctx, "leaderboard:*", RedisQueryOptions{Count: 10, Reverse: true})
 func (c *RedisConnector) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
 	if c.client == nil {
 		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
 	}
 
-	val, err := c.client.Get(ctx, query).Result()
+	var opts RedisQueryOptions
+	for _, arg := range args {
+		if o, ok := arg.(RedisQueryOptions); ok {
+			opts = o
+		}
+	}
+
+	keys := []string{query}
+	if IsRedisPattern(query) {
+		var err error
+		keys, err = c.Keys(ctx, query, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var rows []map[string]interface{}
+	for _, key := range keys {
+		keyRows, err := c.readKey(ctx, key, opts)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, keyRows...)
+	}
+	return rows, nil
+}
+
+// Keys returns the keys matching a glob pattern. It iterates with SCAN, using opts.ScanCount
+// as the COUNT hint and opts.Type to only return keys of one type, and stops after
+// opts.MaxKeys keys if it is set. In cluster mode every master is scanned. The keys are
+// returned in sorted order.
+func (c *RedisConnector) Keys(ctx context.Context, pattern string, opts RedisQueryOptions) ([]string, error) {
+	if c.client == nil {
+		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+	}
+
+	count := opts.ScanCount
+	if count <= 0 {
+		count = c.scanCount
+	}
+
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	var keys []string
+	// add records a batch of keys and reports whether scanning should go on.
+	add := func(batch []string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		// SCAN may return a key more than once while the keyspace is being rehashed.
+		for _, key := range batch {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		return opts.MaxKeys <= 0 || len(keys) < opts.MaxKeys
+	}
+
+	var err error
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scanNode(ctx, node, pattern, count, opts.Type, add)
+		})
+	} else {
+		err = scanNode(ctx, c.client, pattern, count, opts.Type, add)
+	}
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to scan keys", err)
+	}
+
+	sort.Strings(keys)
+	if opts.MaxKeys > 0 && len(keys) > opts.MaxKeys {
+		keys = keys[:opts.MaxKeys]
+	}
+	return keys, nil
+}
+
+// scanNode iterates over the keys of one server with SCAN, passing each batch to add until
+// the iteration ends or add returns false.
+func scanNode(ctx context.Context, node redis.Cmdable, pattern string, count int64, keyType string, add func([]string) bool) error {
+	var cursor uint64
+	for {
+		var batch []string
+		var err error
+		if keyType != "" {
+			batch, cursor, err = node.ScanType(ctx, cursor, pattern, count, keyType).Result()
+		} else {
+			batch, cursor, err = node.Scan(ctx, cursor, pattern, count).Result()
+		}
+		if err != nil {
+			return err
+		}
+		if !add(batch) || cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// Type returns the type of a key, such as "hash" or "ReJSON-RL", or "none" if it does not exist.
+func (c *RedisConnector) Type(ctx context.Context, key string) (string, error) {
+	if c.client == nil {
+		return "", errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+	}
+	keyType, err := c.client.Type(ctx, key).Result()
+	if err != nil {
+		return "", errors.NewError(errors.ErrorTypeQuery, "failed to get key type", err)
+	}
+	return keyType, nil
+}
+
+// readKey returns the rows for a single key.
+func (c *RedisConnector) readKey(ctx context.Context, key string, opts RedisQueryOptions) ([]map[string]interface{}, error) {
+	keyType, err := c.Type(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	wrap := func(err error) error {
+		return errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("failed to read %s key %s", keyType, key), err)
+	}
+	start, stop := opts.Offset, int64(-1)
+	if opts.Count > 0 {
+		stop = opts.Offset + opts.Count - 1
+		// A range counted from the end stops at the last element at the latest: a
+		// non-negative stop would count from the start instead.
+		if start < 0 && stop >= 0 {
+			stop = -1
+		}
+	}
+
+	var rows []map[string]interface{}
+	switch keyType {
+	case RedisTypeNone:
+		return nil, nil
+	case RedisTypeString:
+		val, err := c.client.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return nil, nil
+		} else if err != nil {
+			return nil, wrap(err)
+		}
+		rows = append(rows, map[string]interface{}{"value": val})
+	case RedisTypeHash:
+		fields, err := c.client.HGetAll(ctx, key).Result()
+		if err != nil {
+			return nil, wrap(err)
+		}
+		row := make(map[string]interface{}, len(fields)+1)
+		for k, v := range fields {
+			row[k] = v
+		}
+		rows = append(rows, row)
+	case RedisTypeList:
+		values, err := c.client.LRange(ctx, key, start, stop).Result()
+		if err != nil {
+			return nil, wrap(err)
+		}
+		if start < 0 {
+			n, err := c.client.LLen(ctx, key).Result()
+			if err != nil {
+				return nil, wrap(err)
+			}
+			// LRANGE clamps an offset before the start of the list to its first element.
+			if start += n; start < 0 {
+				start = 0
+			}
+		}
+		for i, v := range values {
+			rows = append(rows, map[string]interface{}{"index": start + int64(i), "value": v})
+		}
+	case RedisTypeSet:
+		members, err := c.client.SMembers(ctx, key).Result()
+		if err != nil {
+			return nil, wrap(err)
+		}
+		sort.Strings(members)
+		for _, m := range members {
+			rows = append(rows, map[string]interface{}{"member": m})
+		}
+	case RedisTypeZSet:
+		var members []redis.Z
+		switch {
+		case opts.Min != "" || opts.Max != "":
+			by := &redis.ZRangeBy{Min: orDefault(opts.Min, "-inf"), Max: orDefault(opts.Max, "+inf"), Offset: opts.Offset, Count: opts.Count}
+			if by.Count == 0 && by.Offset != 0 {
+				// A LIMIT with a count of zero returns no members; -1 reads to the end.
+				by.Count = -1
+			}
+			if opts.Reverse {
+				members, err = c.client.ZRevRangeByScoreWithScores(ctx, key, by).Result()
+			} else {
+				members, err = c.client.ZRangeByScoreWithScores(ctx, key, by).Result()
+			}
+		case opts.Reverse:
+			members, err = c.client.ZRevRangeWithScores(ctx, key, start, stop).Result()
+		default:
+			members, err = c.client.ZRangeWithScores(ctx, key, start, stop).Result()
+		}
+		if err != nil {
+			return nil, wrap(err)
+		}
+		for _, m := range members {
+			rows = append(rows, map[string]interface{}{"member": m.Member, "score": m.Score})
+		}
+	case RedisTypeStream:
+		first, last := orDefault(opts.Min, "-"), orDefault(opts.Max, "+")
+		var entries []redis.XMessage
+		switch {
+		case opts.Reverse && opts.Count > 0:
+			entries, err = c.client.XRevRangeN(ctx, key, last, first, opts.Count).Result()
+		case opts.Reverse:
+			entries, err = c.client.XRevRange(ctx, key, last, first).Result()
+		case opts.Count > 0:
+			entries, err = c.client.XRangeN(ctx, key, first, last, opts.Count).Result()
+		default:
+			entries, err = c.client.XRange(ctx, key, first, last).Result()
+		}
+		if err != nil {
+			return nil, wrap(err)
+		}
+		for _, entry := range entries {
+			rows = append(rows, redisStreamRow(entry))
+		}
+	case RedisTypeJSON:
+		path := opts.Path
+		if path == "" {
+			path = "$"
+		}
+		val, err := c.client.Do(ctx, "JSON.GET", key, path).Text()
+		if err == redis.Nil {
+			return nil, nil
+		} else if err != nil {
+			return nil, wrap(err)
+		}
+		rows, err = redisJSONRows(val, path)
+		if err != nil {
+			return nil, wrap(err)
+		}
+	default:
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("reading %s keys is not supported", keyType), nil)
+	}
+
+	for _, row := range rows {
+		row[RedisKeyColumn] = key
+	}
+	return rows, nil
+}
+
+// orDefault returns s, or def if s is empty.
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// redisJSONRows converts a JSON.GET reply into rows. A JSONPath starting with $ replies with
+// an array of every match, while a legacy path replies with the single value it selects.
+func redisJSONRows(reply, path string) ([]map[string]interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(reply), &value); err != nil {
+		return nil, err
+	}
+
+	matches := []interface{}{value}
+	if strings.HasPrefix(path, "$") {
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected reply for JSONPath %s", path)
+		}
+		matches = list
+	}
+
+	rows := make([]map[string]interface{}, 0, len(matches))
+	for _, m := range matches {
+		if obj, ok := m.(map[string]interface{}); ok {
+			rows = append(rows, obj)
+		} else {
+			rows = append(rows, map[string]interface{}{"value": m})
+		}
+	}
+	return rows, nil
+}
+
+// Do executes a command and returns its reply: a string, an int64, nil, or a slice of replies.
+//
+// Example:
+//
+//	members, err := connector.Do(ctx, "ZRANGE", "leaderboard", 0, 9)
+func (c *RedisConnector) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	if c.client == nil {
+		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+	}
+
+	val, err := c.client.Do(ctx, args...).Result()
 	if err == redis.Nil {
-		return nil, nil // Key does not exist
+		return nil, nil
 	} else if err != nil {
-		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to execute query", err)
+		return nil, errors.NewError(errors.ErrorTypeExecution, "failed to execute command", err)
 	}
-
-	return []map[string]interface{}{{"value": val}}, nil
+	return val, nil
 }
 
-// Execute executes a command and returns the number of affected keys.
+// Execute executes a command and returns the count it reports.
+//
+// Commands with an integer reply return that integer, which is the number of keys, fields or
+// members added or removed for commands such as DEL, HSET, SADD and ZADD, and the new length
+// for LPUSH and RPUSH. Commands with an array reply return the number of elements, commands
+// that reply OK or with a value return 1, and a nil reply returns 0. Use Do for the reply itself.
 func (c *RedisConnector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
+	val, err := c.Do(ctx, append([]interface{}{command}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	return redisReplyCount(val), nil
+}
+
+// ExecutePipeline sends commands in a single round trip and returns the count Execute would
+// report for each. Unlike a transaction, the commands are not atomic, and in cluster mode
+// they may touch keys on different nodes. Every command runs even if an earlier one fails,
+// and the first failure is returned.
+//
+// Example:
+//
+//	counts, err := connector.ExecutePipeline(ctx, [][]interface{}{
+//	    {"DEL", "session:1"},
+//	    {"DEL", "session:2"},
+//	})
+func (c *RedisConnector) ExecutePipeline(ctx context.Context, commands [][]interface{}) ([]int64, error) {
 	if c.client == nil {
-		return 0, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
 	}
 
-	cmd := c.client.Do(ctx, append([]interface{}{command}, args...)...)
-	if cmd.Err() != nil {
-		return 0, errors.NewError(errors.ErrorTypeExecution, "failed to execute command", cmd.Err())
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.Cmd, len(commands))
+	for i, args := range commands {
+		cmds[i] = pipe.Do(ctx, args...)
+	}
+	// The error of each command is checked below, where nil replies are told apart from failures.
+	_, _ = pipe.Exec(ctx)
+
+	counts := make([]int64, len(cmds))
+	for i, cmd := range cmds {
+		val, err := cmd.Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeExecution, fmt.Sprintf("failed to execute command %d of pipeline", i+1), err)
+		}
+		counts[i] = redisReplyCount(val)
 	}
+	return counts, nil
+}
 
-	// For simplicity, we're returning 1 if the command was successful.
-	// In a real-world scenario, you might want to interpret the result based on the specific command.
-	return 1, nil
+// redisReplyCount returns the count that Execute reports for a reply.
+func redisReplyCount(reply interface{}) int64 {
+	switch v := reply.(type) {
+	case nil:
+		return 0
+	case int64:
+		return v
+	case []interface{}:
+		return int64(len(v))
+	default:
+		return 1
+	}
 }
 
 // Ping checks if the database connection is still alive.
@@ -91,6 +635,9 @@ func (c *RedisConnector) Ping(ctx context.Context) error {
 }
 
 // Transaction starts a new database transaction and returns a TransactionConnector.
+// Commands are queued and sent in a MULTI/EXEC block on Commit. In cluster mode, every key
+// in a transaction must hash to the same slot, which can be ensured with hash tags such as
+// "{user:1}:profile" and "{user:1}:sessions".
 func (c *RedisConnector) Transaction(ctx context.Context) (TransactionConnector, error) {
 	if c.client == nil {
 		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
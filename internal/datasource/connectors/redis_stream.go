@@ -0,0 +1,372 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisSubscriptionMode selects what a Redis subscription consumes.
+type RedisSubscriptionMode string
+
+const (
+	// RedisSubscribeStream reads entries from a stream, optionally as part of a consumer group.
+	RedisSubscribeStream RedisSubscriptionMode = "stream"
+	// RedisSubscribeChannel receives messages published to a channel.
+	RedisSubscribeChannel RedisSubscriptionMode = "channel"
+	// RedisSubscribePattern receives messages published to every channel matching a glob pattern.
+	RedisSubscribePattern RedisSubscriptionMode = "pattern"
+)
+
+// Columns added to the rows of stream entries and Pub/Sub messages.
+const (
+	// RedisIDColumn holds the ID of a stream entry.
+	RedisIDColumn = "_id"
+	// RedisChannelColumn holds the channel a message was published to.
+	RedisChannelColumn = "_channel"
+)
+
+const (
+	// defaultRedisStreamCount is the number of entries requested by each stream read.
+	defaultRedisStreamCount = 100
+	// defaultRedisStreamBlock is how long each stream read waits for new entries.
+	defaultRedisStreamBlock = time.Second
+)
+
+// RedisSubscribeOptions configures a RedisConnector subscription.
+type RedisSubscribeOptions struct {
+	// Mode selects streams, channels or channel patterns. Defaults to RedisSubscribeStream.
+	Mode RedisSubscriptionMode
+	// Group is the consumer group used to read a stream. The group is created if it does not
+	// exist. Without a group, the subscription reads the whole stream on its own.
+	Group string
+	// Consumer is the name of this consumer within the group. Defaults to the host name and
+	// process ID.
+	Consumer string
+	// StartID is where reading begins: when a new group is created, or for reads without a
+	// group. "$" (the default) starts after the last entry and "0" at the first one. The
+	// Offset of a delivered event can be used to resume after it.
+	StartID string
+	// AutoAck acknowledges each entry once it has been delivered on the Events channel.
+	// Otherwise entries must be acknowledged with Ack after they have been processed.
+	AutoAck bool
+	// ClaimMinIdle enables reclaiming entries that another consumer in the group has left
+	// pending for at least this long, such as after that consumer crashed.
+	ClaimMinIdle time.Duration
+	// ClaimInterval is how often pending entries are checked for reclaiming. Defaults to ClaimMinIdle.
+	ClaimInterval time.Duration
+	// Count is the number of entries requested by each read. Defaults to 100.
+	Count int64
+	// Block is how long each read waits for new entries. Defaults to one second.
+	Block time.Duration
+	// BufferSize is the capacity of the Events channel.
+	BufferSize int
+}
+
+// Subscribe consumes a stream, a channel or a channel pattern, selected by the Mode of an
+// optional RedisSubscribeOptions argument, and delivers each entry or message as an event.
+//
+// Stream entries are delivered with their fields as the event data, plus the entry ID in the
+// "_id" column, which is also the event Offset. With a consumer group, the subscription first
+// delivers the entries that were already pending for this consumer, then new entries, and
+// entries that stay pending on other consumers for ClaimMinIdle are claimed and delivered again.
+//
+// Pub/Sub messages that hold a JSON object are delivered with its properties as the event
+// data, and other messages in the "message" column; the channel is in the "_channel" column.
+// Pub/Sub does not store messages, so only messages published while subscribed are received.
+//
+// Example:
+//
+//	sub, err := connector.Subscribe(ctx, "orders", RedisSubscribeOptions{Group: "dashboard", ClaimMinIdle: time.Minute})
+//	if err != nil {
+//	    log.Fatalf("Failed to subscribe: %v", err)
+//	}
+//	defer sub.Close()
+//	for event := range sub.Events() {
+//	    process(event.Data)
+//	    connector.Ack(ctx, "orders", "dashboard", event.Offset)
+//	}
+func (c *RedisConnector) Subscribe(ctx context.Context, topic string, args ...interface{}) (Subscription, error) {
+	if c.client == nil {
+		return nil, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+	}
+
+	var opts RedisSubscribeOptions
+	if len(args) > 0 {
+		switch v := args[0].(type) {
+		case RedisSubscribeOptions:
+			opts = v
+		case *RedisSubscribeOptions:
+			opts = *v
+		default:
+			return nil, errors.NewError(errors.ErrorTypeConfiguration, "invalid Redis subscribe options", nil)
+		}
+	}
+	if opts.Count <= 0 {
+		opts.Count = defaultRedisStreamCount
+	}
+	if opts.Block <= 0 {
+		opts.Block = defaultRedisStreamBlock
+	}
+	if opts.StartID == "" {
+		opts.StartID = "$"
+	}
+	if opts.ClaimInterval <= 0 {
+		opts.ClaimInterval = opts.ClaimMinIdle
+	}
+	if opts.Consumer == "" {
+		host, _ := os.Hostname()
+		opts.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+
+	switch opts.Mode {
+	case "", RedisSubscribeStream:
+		return c.subscribeStream(ctx, topic, opts)
+	case RedisSubscribeChannel, RedisSubscribePattern:
+		return c.subscribePubSub(ctx, topic, opts)
+	default:
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, fmt.Sprintf("unknown Redis subscription mode %q", opts.Mode), nil)
+	}
+}
+
+// Ack acknowledges stream entries that were delivered to a consumer group, so that they are
+// no longer pending. It returns the number of entries acknowledged.
+func (c *RedisConnector) Ack(ctx context.Context, stream, group string, ids ...string) (int64, error) {
+	if c.client == nil {
+		return 0, errors.NewError(errors.ErrorTypeDatabaseConnection, errors.ErrorMessages[errors.ErrorTypeDatabaseConnection], nil)
+	}
+	n, err := c.client.XAck(ctx, stream, group, ids...).Result()
+	if err != nil {
+		return 0, errors.NewError(errors.ErrorTypeExecution, "failed to acknowledge stream entries", err)
+	}
+	return n, nil
+}
+
+// subscribeStream prepares the group or start position, then reads the stream in the background.
+func (c *RedisConnector) subscribeStream(ctx context.Context, stream string, opts RedisSubscribeOptions) (Subscription, error) {
+	lastID := opts.StartID
+	if opts.Group != "" {
+		err := c.client.XGroupCreateMkStream(ctx, stream, opts.Group, opts.StartID).Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return nil, errors.NewError(errors.ErrorTypeQuery, "failed to create consumer group", err)
+		}
+	} else if lastID == "$" {
+		// Each read continues from the last entry seen, so "$" is resolved once; reading "$"
+		// again would skip entries added between reads.
+		entries, err := c.client.XRevRangeN(ctx, stream, "+", "-", 1).Result()
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeQuery, "failed to read stream", err)
+		}
+		lastID = "0-0"
+		if len(entries) > 0 {
+			lastID = entries[0].ID
+		}
+	}
+
+	sub, subCtx := newSubscription(ctx, opts.BufferSize)
+	go func() {
+		sub.finish(subCtx, c.consumeStream(subCtx, sub, stream, lastID, opts))
+	}()
+	return sub, nil
+}
+
+// consumeStream delivers stream entries until ctx is done or a read fails.
+func (c *RedisConnector) consumeStream(ctx context.Context, sub *subscription, stream, lastID string, opts RedisSubscribeOptions) error {
+	// deliver sends messages to the consumer and reports whether the subscription should go on.
+	deliver := func(messages []redis.XMessage) (bool, error) {
+		for _, msg := range messages {
+			if !sub.send(ctx, redisStreamEvent(stream, msg)) {
+				return false, nil
+			}
+			if opts.Group != "" && opts.AutoAck {
+				// The entry has been handed over, so it is acknowledged even if the
+				// subscription is being closed.
+				if err := c.client.XAck(context.WithoutCancel(ctx), stream, opts.Group, msg.ID).Err(); err != nil {
+					return false, errors.NewError(errors.ErrorTypeExecution, "failed to acknowledge stream entry", err)
+				}
+			}
+		}
+		return true, nil
+	}
+
+	// A consumer that restarts first reads its own pending entries, which were delivered
+	// before but never acknowledged, and switches to new entries once there are none left.
+	pendingID := "0"
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		if opts.Group != "" && opts.ClaimMinIdle > 0 && time.Since(lastClaim) >= opts.ClaimInterval {
+			lastClaim = time.Now()
+			claimed, err := c.claimPending(ctx, stream, opts)
+			if err != nil {
+				return err
+			}
+			if ok, err := deliver(claimed); !ok {
+				return err
+			}
+		}
+
+		var streams []redis.XStream
+		var err error
+		switch {
+		case opts.Group != "" && pendingID != "":
+			streams, err = c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group: opts.Group, Consumer: opts.Consumer, Streams: []string{stream, pendingID}, Count: opts.Count,
+			}).Result()
+		case opts.Group != "":
+			streams, err = c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group: opts.Group, Consumer: opts.Consumer, Streams: []string{stream, ">"}, Count: opts.Count, Block: opts.Block,
+			}).Result()
+		default:
+			streams, err = c.client.XRead(ctx, &redis.XReadArgs{
+				Streams: []string{stream, lastID}, Count: opts.Count, Block: opts.Block,
+			}).Result()
+		}
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return errors.NewError(errors.ErrorTypeQuery, "failed to read stream", err)
+		}
+
+		var messages []redis.XMessage
+		for _, s := range streams {
+			messages = append(messages, s.Messages...)
+		}
+		if pendingID != "" && opts.Group != "" {
+			if len(messages) == 0 {
+				pendingID = ""
+			} else {
+				pendingID = messages[len(messages)-1].ID
+			}
+		}
+		if len(messages) > 0 {
+			lastID = messages[len(messages)-1].ID
+		}
+		if ok, err := deliver(messages); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimPending claims the entries that other consumers of the group have left pending for at
+// least opts.ClaimMinIdle. It uses XPENDING and XCLAIM, which unlike XAUTOCLAIM are available
+// on every server version with streams.
+func (c *RedisConnector) claimPending(ctx context.Context, stream string, opts RedisSubscribeOptions) ([]redis.XMessage, error) {
+	pending, err := c.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream, Group: opts.Group, Start: "-", End: "+", Count: opts.Count,
+	}).Result()
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to list pending stream entries", err)
+	}
+
+	var ids []string
+	for _, p := range pending {
+		if p.Consumer != opts.Consumer && p.Idle >= opts.ClaimMinIdle {
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// XCLAIM checks the idle time again, so an entry acknowledged or claimed by another
+	// consumer in the meantime is skipped.
+	messages, err := c.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream: stream, Group: opts.Group, Consumer: opts.Consumer, MinIdle: opts.ClaimMinIdle, Messages: ids,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to claim pending stream entries", err)
+	}
+	return messages, nil
+}
+
+// subscribePubSub subscribes to a channel or pattern and relays its messages in the background.
+func (c *RedisConnector) subscribePubSub(ctx context.Context, topic string, opts RedisSubscribeOptions) (Subscription, error) {
+	var pubsub *redis.PubSub
+	if opts.Mode == RedisSubscribePattern {
+		pubsub = c.client.PSubscribe(ctx, topic)
+	} else {
+		pubsub = c.client.Subscribe(ctx, topic)
+	}
+	// Wait for the confirmation, so that messages published after Subscribe returns are received.
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, errors.NewError(errors.ErrorTypeQuery, "failed to subscribe", err)
+	}
+
+	sub, subCtx := newSubscription(ctx, opts.BufferSize)
+	go func() {
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-subCtx.Done():
+				sub.finish(subCtx, nil)
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					sub.finish(subCtx, errors.NewError(errors.ErrorTypeConnection, "Redis subscription closed", nil))
+					return
+				}
+				if !sub.send(subCtx, redisMessageEvent(msg)) {
+					sub.finish(subCtx, nil)
+					return
+				}
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// redisStreamEvent converts a stream entry into an event.
+func redisStreamEvent(stream string, msg redis.XMessage) Event {
+	return Event{
+		Source: stream,
+		Data:   redisStreamRow(msg),
+		Offset: msg.ID,
+		Time:   redisStreamTime(msg.ID),
+	}
+}
+
+// redisStreamRow returns the fields of a stream entry and its ID as a row.
+func redisStreamRow(msg redis.XMessage) map[string]interface{} {
+	row := make(map[string]interface{}, len(msg.Values)+1)
+	for k, v := range msg.Values {
+		row[k] = v
+	}
+	row[RedisIDColumn] = msg.ID
+	return row
+}
+
+// redisStreamTime returns the time encoded in the first part of a stream entry ID, which is
+// the Unix time in milliseconds when the entry was added.
+func redisStreamTime(id string) time.Time {
+	ms, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	return time.UnixMilli(ms)
+}
+
+// redisMessageEvent converts a Pub/Sub message into an event.
+func redisMessageEvent(msg *redis.Message) Event {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(msg.Payload), &data); err != nil || data == nil {
+		data = map[string]interface{}{"message": msg.Payload}
+	}
+	data[RedisChannelColumn] = msg.Channel
+	return Event{
+		Source: msg.Channel,
+		Data:   data,
+		Time:   time.Now(),
+	}
+}
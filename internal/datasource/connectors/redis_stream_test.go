@@ -0,0 +1,146 @@
+package connectors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisConnectorQueryStream(t *testing.T) {
+	ctx := context.Background()
+	connector, server := newTestRedisConnector(t, nil)
+
+	server.XAdd("events", "1-0", []string{"kind", "login"})
+	server.XAdd("events", "2-0", []string{"kind", "logout"})
+	server.XAdd("events", "3-0", []string{"kind", "login"})
+
+	rows, err := connector.Query(ctx, "events", RedisQueryOptions{Min: "2-0"})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"_key": "events", "_id": "2-0", "kind": "logout"},
+		{"_key": "events", "_id": "3-0", "kind": "login"},
+	}, rows)
+
+	rows, err = connector.Query(ctx, "events", RedisQueryOptions{Reverse: true, Count: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"_key": "events", "_id": "3-0", "kind": "login"}}, rows)
+}
+
+func TestRedisConnectorSubscribeStream(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("WithoutGroup", func(t *testing.T) {
+		connector, server := newTestRedisConnector(t, nil)
+		server.XAdd("events", "1-0", []string{"n", "old"})
+
+		sub, err := connector.Subscribe(ctx, "events", RedisSubscribeOptions{Block: 20 * time.Millisecond})
+		require.NoError(t, err)
+		defer sub.Close()
+
+		server.XAdd("events", "1700000000000-0", []string{"n", "new"})
+		event := nextEvent(t, sub)
+		assert.Equal(t, "events", event.Source)
+		assert.Equal(t, "1700000000000-0", event.Offset)
+		assert.Equal(t, map[string]interface{}{"_id": "1700000000000-0", "n": "new"}, event.Data)
+		assert.Equal(t, time.UnixMilli(1700000000000), event.Time)
+
+		// Resuming from a delivered offset continues after it.
+		server.XAdd("events", "1700000000001-0", []string{"n", "next"})
+		resumed, err := connector.Subscribe(ctx, "events", RedisSubscribeOptions{StartID: event.Offset, Block: 20 * time.Millisecond})
+		require.NoError(t, err)
+		defer resumed.Close()
+		assert.Equal(t, "next", nextEvent(t, resumed).Data["n"])
+	})
+
+	t.Run("GroupRedeliversPending", func(t *testing.T) {
+		connector, server := newTestRedisConnector(t, nil)
+		opts := RedisSubscribeOptions{Group: "dash", Consumer: "c1", StartID: "0", Block: 20 * time.Millisecond}
+		server.XAdd("events", "1-0", []string{"n", "1"})
+		server.XAdd("events", "2-0", []string{"n", "2"})
+
+		sub, err := connector.Subscribe(ctx, "events", opts)
+		require.NoError(t, err)
+		assert.Equal(t, "1-0", nextEvent(t, sub).Offset)
+		assert.Equal(t, "2-0", nextEvent(t, sub).Offset)
+		n, err := connector.Ack(ctx, "events", "dash", "1-0")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		require.NoError(t, sub.Close())
+
+		// After a restart the unacknowledged entry is delivered again before new entries.
+		sub, err = connector.Subscribe(ctx, "events", opts)
+		require.NoError(t, err)
+		defer sub.Close()
+		assert.Equal(t, "2-0", nextEvent(t, sub).Offset)
+		server.XAdd("events", "3-0", []string{"n", "3"})
+		assert.Equal(t, "3-0", nextEvent(t, sub).Offset)
+	})
+
+	t.Run("AutoAck", func(t *testing.T) {
+		connector, server := newTestRedisConnector(t, nil)
+		server.XAdd("events", "1-0", []string{"n", "1"})
+
+		sub, err := connector.Subscribe(ctx, "events", RedisSubscribeOptions{Group: "dash", StartID: "0", AutoAck: true, Block: 20 * time.Millisecond})
+		require.NoError(t, err)
+		assert.Equal(t, "1-0", nextEvent(t, sub).Offset)
+		require.NoError(t, sub.Close())
+
+		n, err := connector.Ack(ctx, "events", "dash", "1-0")
+		require.NoError(t, err)
+		assert.Zero(t, n, "entry should already be acknowledged")
+	})
+
+	t.Run("ClaimsIdleEntries", func(t *testing.T) {
+		connector, server := newTestRedisConnector(t, nil)
+		server.XAdd("events", "1-0", []string{"n", "1"})
+
+		crashed, err := connector.Subscribe(ctx, "events", RedisSubscribeOptions{Group: "dash", Consumer: "crashed", StartID: "0", Block: 20 * time.Millisecond})
+		require.NoError(t, err)
+		assert.Equal(t, "1-0", nextEvent(t, crashed).Offset)
+		require.NoError(t, crashed.Close())
+
+		sub, err := connector.Subscribe(ctx, "events", RedisSubscribeOptions{
+			Group: "dash", Consumer: "healthy", ClaimMinIdle: 50 * time.Millisecond, ClaimInterval: 10 * time.Millisecond, Block: 20 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		defer sub.Close()
+		event := nextEvent(t, sub)
+		assert.Equal(t, "1-0", event.Offset)
+		assert.Equal(t, "1", event.Data["n"])
+	})
+}
+
+func TestRedisConnectorSubscribePubSub(t *testing.T) {
+	ctx := context.Background()
+	connector, server := newTestRedisConnector(t, nil)
+
+	sub, err := connector.Subscribe(ctx, "alerts", RedisSubscribeOptions{Mode: RedisSubscribeChannel})
+	require.NoError(t, err)
+	defer sub.Close()
+	patterned, err := connector.Subscribe(ctx, "metrics.*", RedisSubscribeOptions{Mode: RedisSubscribePattern})
+	require.NoError(t, err)
+	defer patterned.Close()
+
+	server.Publish("alerts", `{"level":"high","host":"db1"}`)
+	server.Publish("metrics.cpu", "0.93")
+
+	event := nextEvent(t, sub)
+	assert.Equal(t, "alerts", event.Source)
+	assert.Equal(t, map[string]interface{}{"_channel": "alerts", "level": "high", "host": "db1"}, event.Data)
+
+	event = nextEvent(t, patterned)
+	assert.Equal(t, map[string]interface{}{"_channel": "metrics.cpu", "message": "0.93"}, event.Data)
+
+	require.NoError(t, sub.Close())
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	assert.NoError(t, sub.Err())
+
+	_, err = connector.Subscribe(ctx, "alerts", RedisSubscribeOptions{Mode: "queue"})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+}
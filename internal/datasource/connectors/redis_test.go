@@ -0,0 +1,311 @@
+package connectors
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedisConnector(t *testing.T, options map[string]interface{}) (*RedisConnector, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	port, err := strconv.Atoi(server.Port())
+	require.NoError(t, err)
+
+	connector := NewRedisConnector(&Config{Host: server.Host(), Port: port, Options: options})
+	require.NoError(t, connector.Connect(context.Background()))
+	t.Cleanup(func() { connector.Close(context.Background()) })
+	return connector, server
+}
+
+func TestRedisConnectorQueryTypes(t *testing.T) {
+	ctx := context.Background()
+	connector, server := newTestRedisConnector(t, nil)
+
+	server.Set("greeting", "hello")
+	server.HSet("user:1", "name", "Ada", "role", "admin")
+	server.RPush("queue", "a", "b", "c")
+	server.SAdd("tags", "red", "blue")
+	server.ZAdd("scores", 10, "ada")
+	server.ZAdd("scores", 30, "bob")
+	server.ZAdd("scores", 20, "cy")
+
+	tests := []struct {
+		name string
+		key  string
+		opts RedisQueryOptions
+		want []map[string]interface{}
+	}{
+		{"string", "greeting", RedisQueryOptions{}, []map[string]interface{}{
+			{"_key": "greeting", "value": "hello"},
+		}},
+		{"hash", "user:1", RedisQueryOptions{}, []map[string]interface{}{
+			{"_key": "user:1", "name": "Ada", "role": "admin"},
+		}},
+		{"list", "queue", RedisQueryOptions{}, []map[string]interface{}{
+			{"_key": "queue", "index": int64(0), "value": "a"},
+			{"_key": "queue", "index": int64(1), "value": "b"},
+			{"_key": "queue", "index": int64(2), "value": "c"},
+		}},
+		{"list range from end", "queue", RedisQueryOptions{Offset: -2, Count: 1}, []map[string]interface{}{
+			{"_key": "queue", "index": int64(1), "value": "b"},
+		}},
+		{"list range past end", "queue", RedisQueryOptions{Offset: -2, Count: 5}, []map[string]interface{}{
+			{"_key": "queue", "index": int64(1), "value": "b"},
+			{"_key": "queue", "index": int64(2), "value": "c"},
+		}},
+		{"list range before start", "queue", RedisQueryOptions{Offset: -5, Count: 3}, []map[string]interface{}{
+			{"_key": "queue", "index": int64(0), "value": "a"},
+		}},
+		{"set", "tags", RedisQueryOptions{}, []map[string]interface{}{
+			{"_key": "tags", "member": "blue"},
+			{"_key": "tags", "member": "red"},
+		}},
+		{"zset", "scores", RedisQueryOptions{Count: 2}, []map[string]interface{}{
+			{"_key": "scores", "member": "ada", "score": float64(10)},
+			{"_key": "scores", "member": "cy", "score": float64(20)},
+		}},
+		{"zset reversed", "scores", RedisQueryOptions{Reverse: true, Count: 1}, []map[string]interface{}{
+			{"_key": "scores", "member": "bob", "score": float64(30)},
+		}},
+		{"zset range past end", "scores", RedisQueryOptions{Offset: -1, Count: 5}, []map[string]interface{}{
+			{"_key": "scores", "member": "bob", "score": float64(30)},
+		}},
+		{"zset by score", "scores", RedisQueryOptions{Min: "(10", Max: "30"}, []map[string]interface{}{
+			{"_key": "scores", "member": "cy", "score": float64(20)},
+			{"_key": "scores", "member": "bob", "score": float64(30)},
+		}},
+		{"zset by score after offset", "scores", RedisQueryOptions{Min: "10", Offset: 1}, []map[string]interface{}{
+			{"_key": "scores", "member": "cy", "score": float64(20)},
+			{"_key": "scores", "member": "bob", "score": float64(30)},
+		}},
+		{"missing", "nothing", RedisQueryOptions{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := connector.Query(ctx, tt.key, tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rows)
+		})
+	}
+}
+
+func TestRedisConnectorScan(t *testing.T) {
+	ctx := context.Background()
+	connector, server := newTestRedisConnector(t, map[string]interface{}{"scan_count": "2"})
+
+	for i := 1; i <= 5; i++ {
+		server.HSet("user:"+strconv.Itoa(i), "id", strconv.Itoa(i))
+	}
+	server.Set("user:count", "5")
+	server.Set("other", "x")
+
+	keys, err := connector.Keys(ctx, "user:*", RedisQueryOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user:1", "user:2", "user:3", "user:4", "user:5", "user:count"}, keys)
+
+	keys, err = connector.Keys(ctx, "user:*", RedisQueryOptions{Type: RedisTypeString})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user:count"}, keys)
+
+	keys, err = connector.Keys(ctx, "user:*", RedisQueryOptions{MaxKeys: 3, ScanCount: 100})
+	require.NoError(t, err)
+	assert.Len(t, keys, 3)
+
+	rows, err := connector.Query(ctx, "user:[12]")
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"_key": "user:1", "id": "1"},
+		{"_key": "user:2", "id": "2"},
+	}, rows)
+
+	err = NewRedisConnector(&Config{Host: server.Host(), Options: map[string]interface{}{"scan_count": "0"}}).Connect(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConfiguration))
+}
+
+func TestRedisConnectorExecute(t *testing.T) {
+	ctx := context.Background()
+	connector, server := newTestRedisConnector(t, nil)
+
+	tests := []struct {
+		command string
+		args    []interface{}
+		want    int64
+	}{
+		{"SET", []interface{}{"a", "1"}, 1},
+		{"HSET", []interface{}{"h", "f1", "1", "f2", "2"}, 2},
+		{"HSET", []interface{}{"h", "f1", "3"}, 0},
+		{"RPUSH", []interface{}{"l", "x", "y"}, 2},
+		{"SADD", []interface{}{"s", "m1", "m2", "m1"}, 2},
+		{"ZADD", []interface{}{"z", 1, "m"}, 1},
+		{"KEYS", []interface{}{"*"}, 5},
+		{"GET", []interface{}{"missing"}, 0},
+		{"DEL", []interface{}{"a", "h", "missing"}, 2},
+	}
+	for _, tt := range tests {
+		n, err := connector.Execute(ctx, tt.command, tt.args...)
+		require.NoError(t, err, tt.command)
+		assert.Equal(t, tt.want, n, "%s %v", tt.command, tt.args)
+	}
+	assert.False(t, server.Exists("a"))
+
+	reply, err := connector.Do(ctx, "LRANGE", "l", 0, -1)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"x", "y"}, reply)
+
+	_, err = connector.Execute(ctx, "HSET", "l", "f", "v")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeExecution))
+}
+
+func TestRedisJSONRows(t *testing.T) {
+	rows, err := redisJSONRows(`[{"name":"Ada","tags":["x"]},3]`, "$")
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"name": "Ada", "tags": []interface{}{"x"}},
+		{"value": float64(3)},
+	}, rows)
+
+	rows, err = redisJSONRows(`"Ada"`, ".name")
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"value": "Ada"}}, rows)
+
+	_, err = redisJSONRows(`{"name":"Ada"}`, "$.name")
+	assert.Error(t, err)
+}
+
+func TestRedisConnectorModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		errType errors.ErrorType
+	}{
+		{"Unknown mode", Config{Host: "localhost", Options: map[string]interface{}{"mode": "ring"}}, errors.ErrorTypeConfiguration},
+		{"Standalone with several hosts", Config{Host: "a,b"}, errors.ErrorTypeConfiguration},
+		{"Sentinel without master", Config{Host: "a,b", Options: map[string]interface{}{"mode": "sentinel"}}, errors.ErrorTypeConfiguration},
+		{"Cluster with database", Config{Host: "a", RedisDB: 2, Options: map[string]interface{}{"mode": "cluster"}}, errors.ErrorTypeConfiguration},
+		{"No host", Config{}, errors.ErrorTypeConfiguration},
+		{"Certificate without key", Config{Host: "a", Options: map[string]interface{}{"tls": true, "tls_cert_file": "client.pem"}}, errors.ErrorTypeConfiguration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			_, err := NewRedisConnector(&config).newClient()
+			assert.True(t, errors.IsErrorType(err, tt.errType), "got %v", err)
+		})
+	}
+
+	t.Run("Sentinel", func(t *testing.T) {
+		connector := NewRedisConnector(&Config{
+			Host:     "s1, s2:26380",
+			Username: "app",
+			Password: "secret",
+			RedisDB:  1,
+			Options:  map[string]interface{}{"mode": "sentinel", "master_name": "mymaster", "tls": "true"},
+		})
+		client, err := connector.newClient()
+		require.NoError(t, err)
+		defer client.Close()
+		options := client.(*redis.Client).Options()
+		assert.Equal(t, "app", options.Username)
+		assert.Equal(t, 1, options.DB)
+		assert.NotNil(t, options.TLSConfig)
+	})
+}
+
+func TestRedisConnectorCluster(t *testing.T) {
+	ctx := context.Background()
+	connector, server := newTestRedisConnector(t, map[string]interface{}{"mode": "cluster"})
+	_, ok := connector.client.(*redis.ClusterClient)
+	require.True(t, ok)
+
+	server.HSet("user:1", "name", "Ada")
+	server.HSet("user:2", "name", "Bob")
+	keys, err := connector.Keys(ctx, "user:*", RedisQueryOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user:1", "user:2"}, keys)
+
+	counts, err := connector.ExecutePipeline(ctx, [][]interface{}{{"DEL", "user:1"}, {"GET", "missing"}, {"SADD", "tags", "a", "b"}})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 0, 2}, counts)
+
+	tx, err := connector.Transaction(ctx)
+	require.NoError(t, err)
+	_, err = tx.Execute(ctx, "SET", "{user:2}:seen", "1")
+	require.NoError(t, err)
+	_, err = tx.Execute(ctx, "INCR", "{user:2}:visits")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+	visits, err := server.Get("{user:2}:visits")
+	require.NoError(t, err)
+	assert.Equal(t, "1", visits)
+}
+
+func TestRedisConnectorTLSAndACL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	serverTLS, caFile := newTestTLSConfig(t, dir)
+
+	server, err := miniredis.RunTLS(serverTLS)
+	require.NoError(t, err)
+	defer server.Close()
+	server.RequireUserAuth("dashboard", "s3cret")
+	port, err := strconv.Atoi(server.Port())
+	require.NoError(t, err)
+
+	connector := NewRedisConnector(&Config{
+		Host:     server.Host(),
+		Port:     port,
+		Username: "dashboard",
+		Password: "s3cret",
+		Options:  map[string]interface{}{"tls": true, "tls_ca_file": caFile},
+	})
+	require.NoError(t, connector.Connect(ctx))
+	defer connector.Close(ctx)
+	n, err := connector.Execute(ctx, "SET", "k", "v")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+// newTestTLSConfig creates a self-signed certificate for 127.0.0.1, writes it to a CA file in
+// dir, and returns a server configuration that presents it.
+func newTestTLSConfig(t *testing.T, dir string) (*tls.Config, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "datavinci-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, caFile
+}
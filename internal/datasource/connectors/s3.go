@@ -0,0 +1,265 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"pkg/common/errors"
+	"pkg/common/retry"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// defaultS3Endpoint is used when no BaseURL is configured.
+const defaultS3Endpoint = "https://s3.amazonaws.com"
+
+// S3ListOptions configures how Query lists a bucket or prefix.
+type S3ListOptions struct {
+	// Recursive lists every object under the prefix instead of grouping
+	// keys at the next "/" into prefix rows.
+	Recursive bool
+}
+
+// S3Connector implements the Connector interface for Amazon S3 and S3-compatible object stores.
+// Buckets and prefixes are exposed as collections, object metadata as rows, and data
+// objects are read with the same parsers as FileConnector.
+type S3Connector struct {
+	client *minio.Client
+	config *Config
+}
+
+// NewS3Connector creates a new S3Connector with the given configuration.
+//
+// The config parameter should include:
+//   - BaseURL: The endpoint of the object store, e.g. "http://localhost:9000". Defaults to AWS S3.
+//   - Username: The access key ID
+//   - Password: The secret access key
+//   - Region: The region of the object store, if it requires one
+//   - Database: An optional default bucket; when set, queries are keys within it
+//
+// Example:
+//
+//	config := &Config{
+//	    BaseURL:  "http://localhost:9000",
+//	    Username: "minioadmin",
+//	    Password: "minioadmin",
+//	    Database: "exports",
+//	}
+//	connector := NewS3Connector(config)
+func NewS3Connector(config *Config) *S3Connector {
+	return &S3Connector{config: config}
+}
+
+// Connect creates the object store client and verifies that it can be reached.
+func (c *S3Connector) Connect(ctx context.Context) error {
+	baseURL := c.config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultS3Endpoint
+	}
+	endpoint, err := url.Parse(baseURL)
+	if err != nil || endpoint.Host == "" {
+		return errors.NewError(errors.ErrorTypeConfiguration, "invalid S3 endpoint", err)
+	}
+
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(c.config.Username, c.config.Password, ""),
+		Secure: endpoint.Scheme == "https",
+		Region: c.config.Region,
+	})
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeConfiguration, "failed to create S3 client", err)
+	}
+
+	c.client = client
+	err = retry.Retry(ctx, func() error {
+		return c.Ping(ctx)
+	}, retry.DefaultConfig())
+	if err != nil {
+		c.client = nil
+		return err
+	}
+
+	return nil
+}
+
+// Close releases the client. Object store requests are stateless, so there is no connection to close.
+func (c *S3Connector) Close(ctx context.Context) error {
+	if c.client == nil {
+		return errors.NewError(errors.ErrorTypeConnection, "connection already closed", nil)
+	}
+	c.client = nil
+	return nil
+}
+
+// Query lists buckets, lists objects, or reads an object, depending on the query path.
+//
+//   - "" lists the buckets, or the default bucket's top level if one is configured.
+//   - "bucket" or "bucket/prefix/" lists the objects and prefixes under the prefix. Each object
+//     row holds its bucket, key, size, last_modified, etag, content_type and storage_class.
+//   - "bucket/path/data.csv" reads the object and parses it as CSV, JSON, NDJSON or Parquet
+//     based on its extension.
+//
+// When Config.Database names a default bucket, the bucket is omitted from the query path.
+// An S3ListOptions argument makes listings recursive.
+//
+// Example:
+//
+//	ctx := context.Background()
+//	objects, err := connector.Query(ctx, "exports/2024/", S3ListOptions{Recursive: true})
+//	if err != nil {
+//	    log.Printf("Listing failed: %v", err)
+//	}
+//	rows, err := connector.Query(ctx, "exports/2024/orders.parquet")
+func (c *S3Connector) Query(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	if c.client == nil {
+		return nil, errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+
+	var opts S3ListOptions
+	if len(args) > 0 {
+		switch v := args[0].(type) {
+		case S3ListOptions:
+			opts = v
+		case *S3ListOptions:
+			opts = *v
+		default:
+			return nil, errors.NewError(errors.ErrorTypeQuery, "invalid S3 list options", nil)
+		}
+	}
+
+	bucket, key := c.splitPath(query)
+	if bucket == "" {
+		return c.listBuckets(ctx)
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		return c.listObjects(ctx, bucket, key, opts.Recursive)
+	}
+	return c.readObject(ctx, bucket, key)
+}
+
+// Execute is not supported for the S3 connector.
+func (c *S3Connector) Execute(ctx context.Context, command string, args ...interface{}) (int64, error) {
+	return 0, errors.NewError(errors.ErrorTypeUnsupported, "execute operation is not supported for S3 connector", nil)
+}
+
+// Ping checks that the object store is reachable, and that the default bucket exists if one is configured.
+func (c *S3Connector) Ping(ctx context.Context) error {
+	if c.client == nil {
+		return errors.NewError(errors.ErrorTypeConnection, errors.ErrorMessages[errors.ErrorTypeConnection], nil)
+	}
+
+	if c.config.Database == "" {
+		if _, err := c.client.ListBuckets(ctx); err != nil {
+			return wrapS3Error(err, errors.ErrorTypeConnection, "failed to reach object store")
+		}
+		return nil
+	}
+
+	exists, err := c.client.BucketExists(ctx, c.config.Database)
+	if err != nil {
+		return wrapS3Error(err, errors.ErrorTypeConnection, "failed to reach object store")
+	}
+	if !exists {
+		return errors.NewError(errors.ErrorTypeNotFound, fmt.Sprintf("bucket %s does not exist", c.config.Database), nil)
+	}
+	return nil
+}
+
+// Transaction is not supported for the S3 connector.
+func (c *S3Connector) Transaction(ctx context.Context) (TransactionConnector, error) {
+	return nil, errors.NewError(errors.ErrorTypeUnsupported, "transactions are not supported for S3 connector", nil)
+}
+
+// splitPath splits a query path into a bucket and a key, using the default bucket if configured.
+func (c *S3Connector) splitPath(query string) (string, string) {
+	query = strings.TrimPrefix(query, "/")
+	if c.config.Database != "" {
+		return c.config.Database, query
+	}
+	bucket, key, _ := strings.Cut(query, "/")
+	return bucket, key
+}
+
+// listBuckets returns one row per bucket.
+func (c *S3Connector) listBuckets(ctx context.Context) ([]map[string]interface{}, error) {
+	buckets, err := c.client.ListBuckets(ctx)
+	if err != nil {
+		return nil, wrapS3Error(err, errors.ErrorTypeQuery, "failed to list buckets")
+	}
+
+	results := make([]map[string]interface{}, 0, len(buckets))
+	for _, b := range buckets {
+		results = append(results, map[string]interface{}{
+			"bucket":        b.Name,
+			"creation_date": b.CreationDate,
+		})
+	}
+	return results, nil
+}
+
+// listObjects returns one row per object or common prefix under prefix.
+func (c *S3Connector) listObjects(ctx context.Context, bucket, prefix string, recursive bool) ([]map[string]interface{}, error) {
+	results := []map[string]interface{}{}
+	for obj := range c.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: recursive}) {
+		if obj.Err != nil {
+			return nil, wrapS3Error(obj.Err, errors.ErrorTypeQuery, "failed to list objects")
+		}
+
+		if strings.HasSuffix(obj.Key, "/") && obj.ETag == "" {
+			results = append(results, map[string]interface{}{
+				"bucket": bucket,
+				"key":    obj.Key,
+				"type":   "prefix",
+			})
+			continue
+		}
+
+		results = append(results, map[string]interface{}{
+			"bucket":        bucket,
+			"key":           obj.Key,
+			"type":          "object",
+			"size":          obj.Size,
+			"last_modified": obj.LastModified,
+			"etag":          strings.Trim(obj.ETag, `"`),
+			"content_type":  obj.ContentType,
+			"storage_class": obj.StorageClass,
+		})
+	}
+	return results, nil
+}
+
+// readObject downloads an object and decodes it according to its extension.
+func (c *S3Connector) readObject(ctx context.Context, bucket, key string) ([]map[string]interface{}, error) {
+	format, err := fileFormatOf(path.Base(key))
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := c.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, wrapS3Error(err, errors.ErrorTypeQuery, "failed to get object")
+	}
+	defer obj.Close()
+
+	// GetObject is lazy; Stat surfaces missing objects before decoding starts.
+	if _, err := obj.Stat(); err != nil {
+		return nil, wrapS3Error(err, errors.ErrorTypeQuery, "failed to get object")
+	}
+
+	return decodeRows(format, obj)
+}
+
+// wrapS3Error maps object store error codes to DataVinci error types.
+func wrapS3Error(err error, errType errors.ErrorType, message string) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchBucket", "NoSuchKey":
+		errType = errors.ErrorTypeNotFound
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		errType = errors.ErrorTypePermission
+	}
+	return errors.NewError(errType, message, err)
+}
@@ -0,0 +1,280 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is a minimal in-memory stand-in for an S3-compatible object store.
+// It serves path-style ListBuckets, HeadBucket, ListObjectsV2 and GetObject requests.
+type fakeS3 struct {
+	buckets  map[string]map[string][]byte
+	modified time.Time
+}
+
+func newFakeS3(t *testing.T, buckets map[string]map[string][]byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(&fakeS3{buckets: buckets, modified: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)})
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		f.writeError(w, http.StatusForbidden, "InvalidAccessKeyId")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		f.listBuckets(w)
+		return
+	}
+
+	objects, ok := f.buckets[bucket]
+	if !ok {
+		f.writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case key == "" && r.URL.Query().Get("list-type") == "2":
+		f.listObjects(w, bucket, objects, r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter"))
+	case key != "":
+		data, ok := objects[key]
+		if !ok {
+			f.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", `"`+etag(data)+`"`)
+		w.Header().Set("Last-Modified", f.modified.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if r.Method != http.MethodHead {
+			w.Write(data)
+		}
+	default:
+		f.writeError(w, http.StatusBadRequest, "InvalidRequest")
+	}
+}
+
+func (f *fakeS3) listBuckets(w http.ResponseWriter) {
+	type bucket struct {
+		Name         string
+		CreationDate time.Time
+	}
+	var result struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		Buckets []bucket `xml:"Buckets>Bucket"`
+	}
+	for name := range f.buckets {
+		result.Buckets = append(result.Buckets, bucket{Name: name, CreationDate: f.modified})
+	}
+	sort.Slice(result.Buckets, func(i, j int) bool { return result.Buckets[i].Name < result.Buckets[j].Name })
+	writeXML(w, result)
+}
+
+func (f *fakeS3) listObjects(w http.ResponseWriter, bucket string, objects map[string][]byte, prefix, delimiter string) {
+	type content struct {
+		Key          string
+		LastModified time.Time
+		ETag         string
+		Size         int64
+		StorageClass string
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	var result struct {
+		XMLName        xml.Name       `xml:"ListBucketResult"`
+		Name           string         `xml:"Name"`
+		Prefix         string         `xml:"Prefix"`
+		KeyCount       int            `xml:"KeyCount"`
+		MaxKeys        int            `xml:"MaxKeys"`
+		IsTruncated    bool           `xml:"IsTruncated"`
+		Contents       []content      `xml:"Contents"`
+		CommonPrefixes []commonPrefix `xml:"CommonPrefixes"`
+	}
+	result.Name, result.Prefix, result.MaxKeys = bucket, prefix, 1000
+
+	keys := make([]string, 0, len(objects))
+	for k := range objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	seen := map[string]bool{}
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if idx := strings.Index(k[len(prefix):], delimiter); idx >= 0 {
+				p := k[:len(prefix)+idx+1]
+				if !seen[p] {
+					seen[p] = true
+					result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: p})
+				}
+				continue
+			}
+		}
+		result.Contents = append(result.Contents, content{
+			Key:          k,
+			LastModified: f.modified,
+			ETag:         `"` + etag(objects[k]) + `"`,
+			Size:         int64(len(objects[k])),
+			StorageClass: "STANDARD",
+		})
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	writeXML(w, result)
+}
+
+func (f *fakeS3) writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(v)
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func parquetFile(t *testing.T) []byte {
+	t.Helper()
+	type order struct {
+		ID     int64   `parquet:"id"`
+		Amount float64 `parquet:"amount"`
+	}
+	var buf bytes.Buffer
+	require.NoError(t, parquet.Write(&buf, []order{{ID: 1, Amount: 9.5}, {ID: 2, Amount: 20}}))
+	return buf.Bytes()
+}
+
+func newTestS3Connector(t *testing.T, bucket string) *S3Connector {
+	t.Helper()
+	server := newFakeS3(t, map[string]map[string][]byte{
+		"exports": {
+			"2024/orders.csv":     []byte("id,amount\n1,9.5\n2,20\n"),
+			"2024/orders.json":    []byte(`[{"id":1,"amount":9.5}]`),
+			"2024/orders.ndjson":  []byte("{\"id\":1}\n{\"id\":2}\n"),
+			"2024/orders.parquet": parquetFile(t),
+			"2024/q1/summary.csv": []byte("total\n29.5\n"),
+			"readme.txt":          []byte("hello"),
+		},
+		"logs": {},
+	})
+
+	connector := NewS3Connector(&Config{
+		BaseURL:  server.URL,
+		Username: "access",
+		Password: "secret",
+		Region:   "us-east-1",
+		Database: bucket,
+	})
+	require.NoError(t, connector.Connect(context.Background()))
+	return connector
+}
+
+func TestS3ConnectorListing(t *testing.T) {
+	ctx := context.Background()
+	connector := newTestS3Connector(t, "")
+
+	buckets, err := connector.Query(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, buckets, 2)
+	assert.Equal(t, "exports", buckets[0]["bucket"])
+
+	rows, err := connector.Query(ctx, "exports/2024/")
+	require.NoError(t, err)
+	byKey := map[string]map[string]interface{}{}
+	for _, row := range rows {
+		byKey[row["key"].(string)] = row
+	}
+	require.Len(t, byKey, 5)
+	assert.Equal(t, "prefix", byKey["2024/q1/"]["type"])
+
+	csvRow := byKey["2024/orders.csv"]
+	assert.Equal(t, "object", csvRow["type"])
+	assert.Equal(t, int64(21), csvRow["size"])
+	assert.Equal(t, etag([]byte("id,amount\n1,9.5\n2,20\n")), csvRow["etag"])
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), csvRow["last_modified"].(time.Time).UTC())
+
+	rows, err = connector.Query(ctx, "exports/2024/", S3ListOptions{Recursive: true})
+	require.NoError(t, err)
+	assert.Len(t, rows, 5, "recursive listings contain objects only")
+}
+
+func TestS3ConnectorReadObjects(t *testing.T) {
+	ctx := context.Background()
+	connector := newTestS3Connector(t, "exports")
+
+	tests := []struct {
+		key  string
+		rows int
+	}{
+		{"2024/orders.csv", 2},
+		{"2024/orders.json", 1},
+		{"2024/orders.ndjson", 2},
+		{"2024/orders.parquet", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			rows, err := connector.Query(ctx, tt.key)
+			require.NoError(t, err)
+			assert.Len(t, rows, tt.rows)
+		})
+	}
+
+	rows, err := connector.Query(ctx, "2024/orders.parquet")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, rows[1]["id"])
+	assert.EqualValues(t, 20, rows[1]["amount"])
+
+	_, err = connector.Query(ctx, "readme.txt")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+
+	_, err = connector.Query(ctx, "2024/missing.csv")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+}
+
+func TestS3ConnectorErrors(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeS3(t, map[string]map[string][]byte{"exports": {}})
+
+	connector := NewS3Connector(&Config{BaseURL: server.URL, Username: "wrong", Password: "secret", Region: "us-east-1"})
+	err := connector.Connect(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypePermission))
+
+	connector = NewS3Connector(&Config{BaseURL: server.URL, Username: "access", Password: "secret", Region: "us-east-1", Database: "missing"})
+	err = connector.Connect(ctx)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+
+	_, err = connector.Query(ctx, "")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeConnection))
+}
@@ -5,11 +5,13 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sync"
 	"time"
 
 	"pkg/common/errors"
 	"pkg/common/retry"
 
+	"github.com/jackc/pglogrepl"
 	_ "github.com/lib/pq"
 )
 
@@ -17,11 +19,19 @@ import (
 type SQLConnector struct {
 	db     *sql.DB
 	config *Config
+
+	// lsns holds the positions of replication subscriptions, once one has started.
+	lsns   *checkpointStore
+	lsnsMu sync.Mutex
+	// replicate opens a logical replication stream; tests replace it with an in-memory double.
+	replicate func(ctx context.Context, opts PostgresReplicationOptions, start pglogrepl.LSN) (pgReplicationStream, error)
 }
 
 // NewSQLConnector creates a new SQLConnector with the given configuration.
 func NewSQLConnector(config *Config) *SQLConnector {
-	return &SQLConnector{config: config}
+	c := &SQLConnector{config: config}
+	c.replicate = c.startReplication
+	return c
 }
 
 // Connect establishes a connection to the SQL database.
@@ -68,6 +78,11 @@ func (c *SQLConnector) Connect(ctx context.Context) error {
 	return nil
 }
 
+// Driver returns the name of the configured SQL driver, such as "postgres".
+func (c *SQLConnector) Driver() string {
+	return c.config.Driver
+}
+
 // Close closes the connection to the SQL database.
 func (c *SQLConnector) Close(ctx context.Context) error {
 	if c.db == nil {
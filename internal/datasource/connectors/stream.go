@@ -0,0 +1,39 @@
+package connectors
+
+import (
+	"context"
+	"io"
+)
+
+// RowIterator reads query results in blocks, so that large results never have to be
+// held in memory at once.
+type RowIterator interface {
+	// Next returns the next block of rows. It returns io.EOF after the last block.
+	Next(ctx context.Context) ([]map[string]interface{}, error)
+
+	// Close releases the resources held by the iterator. It is safe to call more than once.
+	Close() error
+}
+
+// Streamer is implemented by connectors that can stream the results of a query.
+type Streamer interface {
+	// Stream executes a query and returns an iterator over its results.
+	Stream(ctx context.Context, query string, args ...interface{}) (RowIterator, error)
+}
+
+// readAllRows drains an iterator and closes it.
+func readAllRows(ctx context.Context, it RowIterator) ([]map[string]interface{}, error) {
+	defer it.Close()
+
+	results := []map[string]interface{}{}
+	for {
+		rows, err := it.Next(ctx)
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rows...)
+	}
+}
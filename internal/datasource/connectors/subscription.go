@@ -0,0 +1,110 @@
+package connectors
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Event is a single record pushed by a streaming data source.
+type Event struct {
+	// Source identifies where the event came from, such as a file path or channel name.
+	Source string
+	// Data holds the record as a row.
+	Data map[string]interface{}
+	// Offset is the source-specific position of the event, usable to resume after it.
+	Offset string
+	// Time is when the event occurred, or when it was read if the source has no timestamp.
+	Time time.Time
+}
+
+// Subscription is a live feed of events from a data source.
+type Subscription interface {
+	// Events returns the channel on which events are delivered.
+	// The channel is closed when the subscription ends.
+	Events() <-chan Event
+
+	// Err returns the error that ended the subscription, or nil if it was closed normally.
+	// It should be called after the Events channel has been closed.
+	Err() error
+
+	// Close stops the subscription and waits for it to release its resources.
+	Close() error
+}
+
+// Subscriber is implemented by connectors that can push data as it arrives.
+type Subscriber interface {
+	// Subscribe starts a subscription to the given topic, whose meaning depends on the connector.
+	Subscribe(ctx context.Context, topic string, args ...interface{}) (Subscription, error)
+}
+
+// defaultSubscriptionBuffer is the Events channel capacity used when none is configured.
+const defaultSubscriptionBuffer = 100
+
+// subscription is the Subscription implementation shared by the connectors.
+// A producer goroutine calls send for every event and finish once when it stops.
+type subscription struct {
+	events chan Event
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+	err    error
+}
+
+// newSubscription creates a subscription and the context its producer should run under.
+// The context is cancelled when the subscription is closed.
+func newSubscription(ctx context.Context, bufferSize int) (*subscription, context.Context) {
+	if bufferSize <= 0 {
+		bufferSize = defaultSubscriptionBuffer
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &subscription{
+		events: make(chan Event, bufferSize),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}, ctx
+}
+
+// Events returns the channel on which events are delivered.
+func (s *subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Err returns the error that ended the subscription, if any.
+func (s *subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the producer and waits for it to finish.
+func (s *subscription) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// send delivers an event, blocking until the consumer receives it or ctx is done.
+// It reports whether the event was delivered.
+func (s *subscription) send(ctx context.Context, event Event) bool {
+	select {
+	case s.events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// finish records why the producer stopped and closes the Events channel.
+// Errors caused by the subscription being closed are not reported.
+func (s *subscription) finish(ctx context.Context, err error) {
+	s.mu.Lock()
+	if err != nil && ctx.Err() == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+
+	s.cancel()
+	close(s.events)
+	close(s.done)
+}
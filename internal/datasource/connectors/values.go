@@ -0,0 +1,54 @@
+package connectors
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// plainValue converts a value scanned by a database driver into a plain value that can be
+// encoded as JSON. Driver types with a canonical text form, such as UUIDs, decimals, big
+// integers and IP addresses, become strings; maps become map[string]interface{} with string
+// keys; slices, arrays and sets become []interface{}; and nil pointers become nil.
+func plainValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case time.Time, []byte, string, bool:
+		return val
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+		result := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := plainValue(iter.Key().Interface())
+			result[fmt.Sprintf("%v", key)] = plainValue(iter.Value().Interface())
+		}
+		return result
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		result := make([]interface{}, rv.Len())
+		for i := range result {
+			result[i] = plainValue(rv.Index(i).Interface())
+		}
+		return result
+	case reflect.Ptr:
+		return plainValue(rv.Elem().Interface())
+	}
+	return v
+}
@@ -20,13 +20,20 @@ import (
 const _ = grpc.SupportPackageIsVersion8
 
 const (
-	DataSourceService_Connect_FullMethodName         = "/datasource.DataSourceService/Connect"
-	DataSourceService_Disconnect_FullMethodName      = "/datasource.DataSourceService/Disconnect"
-	DataSourceService_ExecuteQuery_FullMethodName    = "/datasource.DataSourceService/ExecuteQuery"
-	DataSourceService_ExecuteCommand_FullMethodName  = "/datasource.DataSourceService/ExecuteCommand"
-	DataSourceService_GetConnectors_FullMethodName   = "/datasource.DataSourceService/GetConnectors"
-	DataSourceService_AddConnector_FullMethodName    = "/datasource.DataSourceService/AddConnector"
-	DataSourceService_RemoveConnector_FullMethodName = "/datasource.DataSourceService/RemoveConnector"
+	DataSourceService_Connect_FullMethodName           = "/datasource.DataSourceService/Connect"
+	DataSourceService_Disconnect_FullMethodName        = "/datasource.DataSourceService/Disconnect"
+	DataSourceService_ExecuteQuery_FullMethodName      = "/datasource.DataSourceService/ExecuteQuery"
+	DataSourceService_ExecuteCommand_FullMethodName    = "/datasource.DataSourceService/ExecuteCommand"
+	DataSourceService_GetConnectors_FullMethodName     = "/datasource.DataSourceService/GetConnectors"
+	DataSourceService_AddConnector_FullMethodName      = "/datasource.DataSourceService/AddConnector"
+	DataSourceService_RemoveConnector_FullMethodName   = "/datasource.DataSourceService/RemoveConnector"
+	DataSourceService_SaveQuery_FullMethodName         = "/datasource.DataSourceService/SaveQuery"
+	DataSourceService_GetSavedQuery_FullMethodName     = "/datasource.DataSourceService/GetSavedQuery"
+	DataSourceService_ListSavedQueries_FullMethodName  = "/datasource.DataSourceService/ListSavedQueries"
+	DataSourceService_DeleteSavedQuery_FullMethodName  = "/datasource.DataSourceService/DeleteSavedQuery"
+	DataSourceService_ExecuteSavedQuery_FullMethodName = "/datasource.DataSourceService/ExecuteSavedQuery"
+	DataSourceService_GetUsageStats_FullMethodName     = "/datasource.DataSourceService/GetUsageStats"
+	DataSourceService_GetSlowQueries_FullMethodName    = "/datasource.DataSourceService/GetSlowQueries"
 )
 
 // DataSourceServiceClient is the client API for DataSourceService service.
@@ -40,6 +47,13 @@ type DataSourceServiceClient interface {
 	GetConnectors(ctx context.Context, in *GetConnectorsRequest, opts ...grpc.CallOption) (*GetConnectorsResponse, error)
 	AddConnector(ctx context.Context, in *AddConnectorRequest, opts ...grpc.CallOption) (*AddConnectorResponse, error)
 	RemoveConnector(ctx context.Context, in *RemoveConnectorRequest, opts ...grpc.CallOption) (*RemoveConnectorResponse, error)
+	SaveQuery(ctx context.Context, in *SaveQueryRequest, opts ...grpc.CallOption) (*SaveQueryResponse, error)
+	GetSavedQuery(ctx context.Context, in *GetSavedQueryRequest, opts ...grpc.CallOption) (*GetSavedQueryResponse, error)
+	ListSavedQueries(ctx context.Context, in *ListSavedQueriesRequest, opts ...grpc.CallOption) (*ListSavedQueriesResponse, error)
+	DeleteSavedQuery(ctx context.Context, in *DeleteSavedQueryRequest, opts ...grpc.CallOption) (*DeleteSavedQueryResponse, error)
+	ExecuteSavedQuery(ctx context.Context, in *ExecuteSavedQueryRequest, opts ...grpc.CallOption) (*QueryResponse, error)
+	GetUsageStats(ctx context.Context, in *UsageStatsRequest, opts ...grpc.CallOption) (*UsageStatsResponse, error)
+	GetSlowQueries(ctx context.Context, in *SlowQueriesRequest, opts ...grpc.CallOption) (*SlowQueriesResponse, error)
 }
 
 type dataSourceServiceClient struct {
@@ -120,6 +134,76 @@ func (c *dataSourceServiceClient) RemoveConnector(ctx context.Context, in *Remov
 	return out, nil
 }
 
+func (c *dataSourceServiceClient) SaveQuery(ctx context.Context, in *SaveQueryRequest, opts ...grpc.CallOption) (*SaveQueryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SaveQueryResponse)
+	err := c.cc.Invoke(ctx, DataSourceService_SaveQuery_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataSourceServiceClient) GetSavedQuery(ctx context.Context, in *GetSavedQueryRequest, opts ...grpc.CallOption) (*GetSavedQueryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetSavedQueryResponse)
+	err := c.cc.Invoke(ctx, DataSourceService_GetSavedQuery_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataSourceServiceClient) ListSavedQueries(ctx context.Context, in *ListSavedQueriesRequest, opts ...grpc.CallOption) (*ListSavedQueriesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSavedQueriesResponse)
+	err := c.cc.Invoke(ctx, DataSourceService_ListSavedQueries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataSourceServiceClient) DeleteSavedQuery(ctx context.Context, in *DeleteSavedQueryRequest, opts ...grpc.CallOption) (*DeleteSavedQueryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteSavedQueryResponse)
+	err := c.cc.Invoke(ctx, DataSourceService_DeleteSavedQuery_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataSourceServiceClient) ExecuteSavedQuery(ctx context.Context, in *ExecuteSavedQueryRequest, opts ...grpc.CallOption) (*QueryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryResponse)
+	err := c.cc.Invoke(ctx, DataSourceService_ExecuteSavedQuery_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataSourceServiceClient) GetUsageStats(ctx context.Context, in *UsageStatsRequest, opts ...grpc.CallOption) (*UsageStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UsageStatsResponse)
+	err := c.cc.Invoke(ctx, DataSourceService_GetUsageStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataSourceServiceClient) GetSlowQueries(ctx context.Context, in *SlowQueriesRequest, opts ...grpc.CallOption) (*SlowQueriesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SlowQueriesResponse)
+	err := c.cc.Invoke(ctx, DataSourceService_GetSlowQueries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // DataSourceServiceServer is the server API for DataSourceService service.
 // All implementations must embed UnimplementedDataSourceServiceServer
 // for forward compatibility
@@ -131,6 +215,13 @@ type DataSourceServiceServer interface {
 	GetConnectors(context.Context, *GetConnectorsRequest) (*GetConnectorsResponse, error)
 	AddConnector(context.Context, *AddConnectorRequest) (*AddConnectorResponse, error)
 	RemoveConnector(context.Context, *RemoveConnectorRequest) (*RemoveConnectorResponse, error)
+	SaveQuery(context.Context, *SaveQueryRequest) (*SaveQueryResponse, error)
+	GetSavedQuery(context.Context, *GetSavedQueryRequest) (*GetSavedQueryResponse, error)
+	ListSavedQueries(context.Context, *ListSavedQueriesRequest) (*ListSavedQueriesResponse, error)
+	DeleteSavedQuery(context.Context, *DeleteSavedQueryRequest) (*DeleteSavedQueryResponse, error)
+	ExecuteSavedQuery(context.Context, *ExecuteSavedQueryRequest) (*QueryResponse, error)
+	GetUsageStats(context.Context, *UsageStatsRequest) (*UsageStatsResponse, error)
+	GetSlowQueries(context.Context, *SlowQueriesRequest) (*SlowQueriesResponse, error)
 	mustEmbedUnimplementedDataSourceServiceServer()
 }
 
@@ -159,6 +250,27 @@ func (UnimplementedDataSourceServiceServer) AddConnector(context.Context, *AddCo
 func (UnimplementedDataSourceServiceServer) RemoveConnector(context.Context, *RemoveConnectorRequest) (*RemoveConnectorResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RemoveConnector not implemented")
 }
+func (UnimplementedDataSourceServiceServer) SaveQuery(context.Context, *SaveQueryRequest) (*SaveQueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SaveQuery not implemented")
+}
+func (UnimplementedDataSourceServiceServer) GetSavedQuery(context.Context, *GetSavedQueryRequest) (*GetSavedQueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSavedQuery not implemented")
+}
+func (UnimplementedDataSourceServiceServer) ListSavedQueries(context.Context, *ListSavedQueriesRequest) (*ListSavedQueriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSavedQueries not implemented")
+}
+func (UnimplementedDataSourceServiceServer) DeleteSavedQuery(context.Context, *DeleteSavedQueryRequest) (*DeleteSavedQueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSavedQuery not implemented")
+}
+func (UnimplementedDataSourceServiceServer) ExecuteSavedQuery(context.Context, *ExecuteSavedQueryRequest) (*QueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExecuteSavedQuery not implemented")
+}
+func (UnimplementedDataSourceServiceServer) GetUsageStats(context.Context, *UsageStatsRequest) (*UsageStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUsageStats not implemented")
+}
+func (UnimplementedDataSourceServiceServer) GetSlowQueries(context.Context, *SlowQueriesRequest) (*SlowQueriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSlowQueries not implemented")
+}
 func (UnimplementedDataSourceServiceServer) mustEmbedUnimplementedDataSourceServiceServer() {}
 
 // UnsafeDataSourceServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -298,6 +410,132 @@ func _DataSourceService_RemoveConnector_Handler(srv interface{}, ctx context.Con
 	return interceptor(ctx, in, info, handler)
 }
 
+func _DataSourceService_SaveQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SaveQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataSourceServiceServer).SaveQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataSourceService_SaveQuery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataSourceServiceServer).SaveQuery(ctx, req.(*SaveQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataSourceService_GetSavedQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSavedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataSourceServiceServer).GetSavedQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataSourceService_GetSavedQuery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataSourceServiceServer).GetSavedQuery(ctx, req.(*GetSavedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataSourceService_ListSavedQueries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSavedQueriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataSourceServiceServer).ListSavedQueries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataSourceService_ListSavedQueries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataSourceServiceServer).ListSavedQueries(ctx, req.(*ListSavedQueriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataSourceService_DeleteSavedQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteSavedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataSourceServiceServer).DeleteSavedQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataSourceService_DeleteSavedQuery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataSourceServiceServer).DeleteSavedQuery(ctx, req.(*DeleteSavedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataSourceService_ExecuteSavedQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecuteSavedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataSourceServiceServer).ExecuteSavedQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataSourceService_ExecuteSavedQuery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataSourceServiceServer).ExecuteSavedQuery(ctx, req.(*ExecuteSavedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataSourceService_GetUsageStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UsageStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataSourceServiceServer).GetUsageStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataSourceService_GetUsageStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataSourceServiceServer).GetUsageStats(ctx, req.(*UsageStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataSourceService_GetSlowQueries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SlowQueriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataSourceServiceServer).GetSlowQueries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataSourceService_GetSlowQueries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataSourceServiceServer).GetSlowQueries(ctx, req.(*SlowQueriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // DataSourceService_ServiceDesc is the grpc.ServiceDesc for DataSourceService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -333,6 +571,34 @@ var DataSourceService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RemoveConnector",
 			Handler:    _DataSourceService_RemoveConnector_Handler,
 		},
+		{
+			MethodName: "SaveQuery",
+			Handler:    _DataSourceService_SaveQuery_Handler,
+		},
+		{
+			MethodName: "GetSavedQuery",
+			Handler:    _DataSourceService_GetSavedQuery_Handler,
+		},
+		{
+			MethodName: "ListSavedQueries",
+			Handler:    _DataSourceService_ListSavedQueries_Handler,
+		},
+		{
+			MethodName: "DeleteSavedQuery",
+			Handler:    _DataSourceService_DeleteSavedQuery_Handler,
+		},
+		{
+			MethodName: "ExecuteSavedQuery",
+			Handler:    _DataSourceService_ExecuteSavedQuery_Handler,
+		},
+		{
+			MethodName: "GetUsageStats",
+			Handler:    _DataSourceService_GetUsageStats_Handler,
+		},
+		{
+			MethodName: "GetSlowQueries",
+			Handler:    _DataSourceService_GetSlowQueries_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "connector.proto",
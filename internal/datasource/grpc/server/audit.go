@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"datasource/audit"
+	"datasource/grpc"
+	"datasource/managers/query"
+)
+
+// GetUsageStats sums audited queries and commands per connector or per user. Callers
+// without an auditor role only see their own events.
+func (s *DataSourceServer) GetUsageStats(ctx context.Context, req *grpc.UsageStatsRequest) (*grpc.UsageStatsResponse, error) {
+	reader, err := s.auditReader()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := auditFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if filter, err = s.authorizeAudit(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	groupBy := audit.GroupBy(req.GroupBy)
+	switch groupBy {
+	case "":
+		groupBy = audit.ByConnector
+	case audit.ByConnector, audit.ByUser:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid group_by %q: must be connector or user", req.GroupBy)
+	}
+
+	stats, err := audit.UsageStats(ctx, reader, filter, groupBy)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read audit log: %v", err)
+	}
+
+	resp := &grpc.UsageStatsResponse{}
+	for _, u := range stats {
+		resp.Stats = append(resp.Stats, &grpc.UsageStats{
+			Key:             u.Key,
+			Queries:         u.Queries,
+			Errors:          u.Errors,
+			Rows:            u.Rows,
+			Bytes:           u.Bytes,
+			TotalDurationMs: u.TotalDuration.Milliseconds(),
+			AvgDurationMs:   u.AvgDuration.Milliseconds(),
+			MaxDurationMs:   u.MaxDuration.Milliseconds(),
+		})
+	}
+	return resp, nil
+}
+
+// GetSlowQueries returns the audited queries and commands that took at least the threshold,
+// slowest first. Callers without an auditor role only see their own events.
+func (s *DataSourceServer) GetSlowQueries(ctx context.Context, req *grpc.SlowQueriesRequest) (*grpc.SlowQueriesResponse, error) {
+	reader, err := s.auditReader()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := auditFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if filter, err = s.authorizeAudit(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	threshold := time.Duration(req.ThresholdMs) * time.Millisecond
+	events, err := audit.SlowQueries(ctx, reader, filter, threshold, int(req.Limit))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read audit log: %v", err)
+	}
+
+	resp := &grpc.SlowQueriesResponse{}
+	for _, event := range events {
+		resp.Events = append(resp.Events, auditEventToProto(event))
+	}
+	return resp, nil
+}
+
+// begin identifies the caller of a request on a connector: the returned context runs
+// queries for the caller, under the connector's policies, and the event audits the request.
+func (s *DataSourceServer) begin(ctx context.Context, method, connectorName string) (context.Context, *audit.Event) {
+	caller := s.identity(ctx)
+	ctx = query.WithPrincipal(ctx, query.Principal{User: caller.User, Roles: caller.Roles, Attributes: caller.Attributes})
+
+	if s.audit == nil {
+		return ctx, &audit.Event{Method: method, Connector: connectorName}
+	}
+	event := s.audit.Start(caller, method)
+	event.Connector = connectorName
+	return ctx, event
+}
+
+// finishQueryAudit records the rows and error of a query request and writes its event.
+func (s *DataSourceServer) finishQueryAudit(ctx context.Context, event *audit.Event, resp *grpc.QueryResponse, err error) {
+	if resp != nil {
+		event.Rows = int64(len(resp.Rows))
+		for _, row := range resp.Rows {
+			event.Bytes += int64(len(row))
+		}
+	}
+	s.finishAudit(ctx, event, err)
+}
+
+// finishAudit records the error of a request and writes its event.
+func (s *DataSourceServer) finishAudit(ctx context.Context, event *audit.Event, err error) {
+	if s.audit == nil {
+		return
+	}
+	if err != nil {
+		event.Error = status.Convert(err).Message()
+	}
+	// The event is written even when the request was canceled or timed out.
+	s.audit.Finish(context.WithoutCancel(ctx), event)
+}
+
+// normalizeQuery encodes a parsed query as JSON, with its keys in a fixed order, so that the
+// same query is audited the same way whether it was given as JSON or as query text.
+func normalizeQuery(q interface{}) string {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// authorizeAudit limits a report's filter to the events the caller may read: every event for
+// auditors, and otherwise the caller's own. Anonymous callers are refused once requests are
+// authenticated.
+func (s *DataSourceServer) authorizeAudit(ctx context.Context, filter audit.Filter) (audit.Filter, error) {
+	if !s.authenticated {
+		return filter, nil
+	}
+	caller := s.identity(ctx)
+	for _, role := range caller.Roles {
+		for _, auditor := range s.auditorRoles {
+			if role == auditor {
+				return filter, nil
+			}
+		}
+	}
+	if caller.User == "" {
+		return filter, status.Errorf(codes.PermissionDenied, "audit reports require a known caller")
+	}
+	if filter.User != "" && filter.User != caller.User {
+		return filter, status.Errorf(codes.PermissionDenied, "only auditors may read the events of other users")
+	}
+	filter.User = caller.User
+	return filter, nil
+}
+
+// auditReader returns the audit log to report from.
+func (s *DataSourceServer) auditReader() (audit.Reader, error) {
+	if s.audit == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "audit log is not enabled")
+	}
+	reader, ok := s.audit.Reader()
+	if !ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "audit sink does not support reading events")
+	}
+	return reader, nil
+}
+
+// auditFilter converts a filter with RFC 3339 times into an audit.Filter.
+func auditFilter(pb *grpc.AuditFilter) (audit.Filter, error) {
+	var filter audit.Filter
+	if pb == nil {
+		return filter, nil
+	}
+	filter.User = pb.User
+	filter.Connector = pb.ConnectorName
+
+	var err error
+	if pb.Since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, pb.Since); err != nil {
+			return filter, status.Errorf(codes.InvalidArgument, "invalid since: %v", err)
+		}
+	}
+	if pb.Until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, pb.Until); err != nil {
+			return filter, status.Errorf(codes.InvalidArgument, "invalid until: %v", err)
+		}
+	}
+	return filter, nil
+}
+
+func auditEventToProto(event audit.Event) *grpc.AuditEvent {
+	return &grpc.AuditEvent{
+		Time:          event.Time.Format(time.RFC3339Nano),
+		User:          event.User,
+		Roles:         event.Roles,
+		Method:        event.Method,
+		ConnectorName: event.Connector,
+		Query:         event.Query,
+		Args:          event.Args,
+		DryRun:        event.DryRun,
+		DurationMs:    event.Duration.Milliseconds(),
+		Rows:          event.Rows,
+		Bytes:         event.Bytes,
+		Error:         event.Error,
+	}
+}
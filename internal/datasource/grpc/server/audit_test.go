@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"datasource/audit"
+	"datasource/grpc"
+	manager "datasource/managers"
+)
+
+// newAuditedServer returns a server whose audit log holds events, and that names callers
+// from the claims in their context when authenticated is set.
+func newAuditedServer(t *testing.T, authenticated bool, events ...audit.Event) *DataSourceServer {
+	t.Helper()
+	sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.log"))
+	require.NoError(t, err)
+	for _, event := range events {
+		require.NoError(t, sink.Write(context.Background(), event))
+	}
+	logger := audit.NewLogger(sink)
+	t.Cleanup(func() { logger.Close() })
+
+	options := Options{Audit: logger}
+	if authenticated {
+		options.Identity = audit.ClaimsIdentity(Claims)
+	}
+	return NewDataSourceServer(manager.NewConnectorManager(), options)
+}
+
+// withClaims returns a context carrying token claims, as the auth interceptor stores them.
+func withClaims(claims map[string]interface{}) context.Context {
+	return context.WithValue(context.Background(), claimsKey{}, claims)
+}
+
+func TestAuditReportsAuthorization(t *testing.T) {
+	now := time.Now()
+	events := []audit.Event{
+		{Time: now, User: "alice", Method: "ExecuteQuery", Connector: "shop", Query: "SELECT 1", Duration: 2 * time.Second},
+		{Time: now, User: "bob", Method: "ExecuteQuery", Connector: "crm", Query: "SELECT 2", Duration: 3 * time.Second},
+	}
+	s := newAuditedServer(t, true, events...)
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		filter *grpc.AuditFilter
+		want   []string
+		code   codes.Code
+	}{
+		{"Auditor reads every user", withClaims(map[string]interface{}{"sub": "carol", "roles": []interface{}{"auditor"}}), nil, []string{"alice", "bob"}, codes.OK},
+		{"Admin reads another user", withClaims(map[string]interface{}{"sub": "carol", "role": "admin"}), &grpc.AuditFilter{User: "bob"}, []string{"bob"}, codes.OK},
+		{"User reads own events", withClaims(map[string]interface{}{"sub": "alice"}), nil, []string{"alice"}, codes.OK},
+		{"User names themselves", withClaims(map[string]interface{}{"sub": "alice"}), &grpc.AuditFilter{User: "alice"}, []string{"alice"}, codes.OK},
+		{"User reads another user", withClaims(map[string]interface{}{"sub": "alice"}), &grpc.AuditFilter{User: "bob"}, nil, codes.PermissionDenied},
+		{"Anonymous caller", context.Background(), nil, nil, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := s.GetUsageStats(tt.ctx, &grpc.UsageStatsRequest{Filter: tt.filter, GroupBy: "user"})
+			slow, slowErr := s.GetSlowQueries(tt.ctx, &grpc.SlowQueriesRequest{Filter: tt.filter, ThresholdMs: 1000})
+			if tt.code != codes.OK {
+				assert.Equal(t, tt.code, status.Code(err), "%v", err)
+				assert.Equal(t, tt.code, status.Code(slowErr), "%v", slowErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, slowErr)
+
+			var users []string
+			for _, u := range stats.Stats {
+				users = append(users, u.Key)
+			}
+			assert.ElementsMatch(t, tt.want, users)
+			users = nil
+			for _, e := range slow.Events {
+				users = append(users, e.User)
+			}
+			assert.ElementsMatch(t, tt.want, users)
+		})
+	}
+
+	// Without authentication there is no caller to limit reports to.
+	s = newAuditedServer(t, false, events...)
+	slow, err := s.GetSlowQueries(context.Background(), &grpc.SlowQueriesRequest{ThresholdMs: 1000})
+	require.NoError(t, err)
+	assert.Len(t, slow.Events, 2)
+}
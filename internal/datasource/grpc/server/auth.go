@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type claimsKey struct{}
+
+// AuthInterceptor returns a unary interceptor that requires each request to carry an
+// expiring JWT, signed with secret using HMAC, in its "authorization" metadata as "Bearer <token>". The
+// token's claims are stored in the request context, where Claims reads them.
+//
+// Example:
+//
+//	s := grpc.NewServer(grpc.UnaryInterceptor(server.AuthInterceptor(secret)))
+//	srv := server.NewDataSourceServer(manager, server.Options{Identity: audit.ClaimsIdentity(server.Claims)})
+func AuthInterceptor(secret []byte) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "missing authorization")
+		}
+		token, ok := strings.CutPrefix(values[0], "Bearer ")
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+		}
+		claims, err := parseToken(token, secret)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+		}
+		return handler(context.WithValue(ctx, claimsKey{}, claims), req)
+	}
+}
+
+// Claims returns the claims of the token that AuthInterceptor accepted for the request of ctx.
+func Claims(ctx context.Context) (map[string]interface{}, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(map[string]interface{})
+	return claims, ok
+}
+
+// parseToken verifies the signature and expiry of a JWT, which must have an exp claim, and
+// returns its claims.
+func parseToken(token string, secret []byte) (map[string]interface{}, error) {
+	parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || !parsed.Valid {
+		return nil, fmt.Errorf("invalid claims")
+	}
+	// Parse only checks the expiry of tokens that have one; tokens that never expire are
+	// refused.
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, fmt.Errorf("token has no expiry")
+	}
+	return claims, nil
+}
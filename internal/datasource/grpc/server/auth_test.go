@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testSecret = []byte("test-secret")
+
+func signToken(t *testing.T, secret []byte, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	require.NoError(t, err)
+	return token
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	interceptor := AuthInterceptor(testSecret)
+	call := func(authorization string) (map[string]interface{}, error) {
+		ctx := context.Background()
+		if authorization != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", authorization))
+		}
+		var claims map[string]interface{}
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			claims, _ = Claims(ctx)
+			return nil, nil
+		})
+		return claims, err
+	}
+
+	expires := time.Now().Add(time.Hour).Unix()
+	claims, err := call("Bearer " + signToken(t, testSecret, jwt.MapClaims{"sub": "ada", "exp": expires}))
+	require.NoError(t, err)
+	assert.Equal(t, "ada", claims["sub"])
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{"Missing", ""},
+		{"Not a bearer token", "Basic abc"},
+		{"Wrong secret", "Bearer " + signToken(t, []byte("other"), jwt.MapClaims{"sub": "ada", "exp": expires})},
+		{"Expired", "Bearer " + signToken(t, testSecret, jwt.MapClaims{"sub": "ada", "exp": time.Now().Add(-time.Minute).Unix()})},
+		{"No expiry", "Bearer " + signToken(t, testSecret, jwt.MapClaims{"sub": "ada"})},
+		{"Unsigned", "Bearer " + func() string {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "ada", "exp": expires}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			require.NoError(t, err)
+			return token
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := call(tt.authorization)
+			assert.Equal(t, codes.Unauthenticated, status.Code(err), "%v", err)
+		})
+	}
+}
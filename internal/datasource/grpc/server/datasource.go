@@ -5,23 +5,80 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"datasource/audit"
 	"datasource/connectors"
 	"datasource/grpc"
 	manager "datasource/managers"
 	"datasource/managers/query"
+	"pkg/common/errors"
 )
 
 type DataSourceServer struct {
 	grpc.UnimplementedDataSourceServiceServer
-	manager *manager.ConnectorManager
+	manager      *manager.ConnectorManager
+	federation   *query.FederatedExecutor
+	savedQueries *query.SavedQueryCatalog
+	audit        *audit.Logger
+	policies     *query.PolicySet
+	identity     audit.IdentityFunc
+	// authenticated is set when requests name their caller, and usage reports are then
+	// limited by the caller's roles.
+	authenticated bool
+	auditorRoles  []string
 }
 
-func NewDataSourceServer(manager *manager.ConnectorManager) *DataSourceServer {
-	return &DataSourceServer{manager: manager}
+// Options configures a DataSourceServer.
+type Options struct {
+	// SavedQueries holds saved queries. Without it, queries are saved in memory and lost when
+	// the server stops.
+	SavedQueries *query.SavedQueryCatalog
+	// Audit records queries and commands, unless it is nil.
+	Audit *audit.Logger
+	// Policies restrict what callers see of each connector.
+	Policies *query.PolicySet
+	// Identity names the caller of each request, for the audit log and policies. Without
+	// it, every caller is anonymous and has no roles.
+	Identity audit.IdentityFunc
+	// AuditorRoles may read the usage and slow query reports of every caller; other callers
+	// only see their own events. Defaults to "admin" and "auditor". Without Identity, every
+	// caller sees every event.
+	AuditorRoles []string
+}
+
+// defaultAuditorRoles are the roles that read every caller's events by default.
+var defaultAuditorRoles = []string{"admin", "auditor"}
+
+// NewDataSourceServer creates a server for the connectors of manager.
+func NewDataSourceServer(manager *manager.ConnectorManager, options Options) *DataSourceServer {
+	identity := options.Identity
+	authenticated := identity != nil
+	if identity == nil {
+		identity = func(context.Context) audit.Identity { return audit.Identity{} }
+	}
+	auditorRoles := options.AuditorRoles
+	if auditorRoles == nil {
+		auditorRoles = defaultAuditorRoles
+	}
+	savedQueries := options.SavedQueries
+	if savedQueries == nil {
+		// An in-memory catalog cannot fail to open.
+		savedQueries, _ = query.NewSavedQueryCatalog("")
+	}
+	return &DataSourceServer{
+		manager:       manager,
+		federation:    query.NewFederatedExecutor(manager, query.FederationOptions{Policies: options.Policies}),
+		savedQueries:  savedQueries,
+		audit:         options.Audit,
+		policies:      options.Policies,
+		identity:      identity,
+		authenticated: authenticated,
+		auditorRoles:  auditorRoles,
+	}
 }
 
 func (s *DataSourceServer) Connect(ctx context.Context, req *grpc.ConnectRequest) (*grpc.ConnectResponse, error) {
@@ -62,30 +119,146 @@ func (s *DataSourceServer) Disconnect(ctx context.Context, req *grpc.DisconnectR
 	return &grpc.DisconnectResponse{Success: true}, nil
 }
 
-func (s *DataSourceServer) ExecuteQuery(ctx context.Context, req *grpc.QueryRequest) (*grpc.QueryResponse, error) {
+// ExecuteQuery runs a query, given as JSON or as query text, on a connector. A request
+// without a connector name holds a federated query, which reads from the connectors named
+// by its sources. A dry run returns the explanation of the query, the native query and the
+// source's plan, or the plan of a federated query, instead of its rows. Queries run under
+// the connector's policies for the caller, and every request is recorded in the audit log.
+func (s *DataSourceServer) ExecuteQuery(ctx context.Context, req *grpc.QueryRequest) (resp *grpc.QueryResponse, err error) {
+	ctx, event := s.begin(ctx, "ExecuteQuery", req.ConnectorName)
+	event.Query, event.DryRun = req.Query, req.DryRun
+	defer func() { s.finishQueryAudit(ctx, event, resp, err) }()
+
+	if req.ConnectorName == "" {
+		return s.executeFederatedQuery(ctx, req, event)
+	}
 	log.Printf("Received ExecuteQuery request for connector: %s", req.ConnectorName)
 
-	connector, err := s.manager.GetConnector(req.ConnectorName)
+	q, err := parseQuery(req.Query)
 	if err != nil {
-		log.Printf("Error getting connector %s: %v", req.ConnectorName, err)
+		log.Printf("Error parsing query: %v", err)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid query: %v", err)
+	}
+	event.Query = normalizeQuery(q)
+	return s.runQuery(ctx, req.ConnectorName, q, req.DryRun)
+}
+
+// runQuery executes a query on a connector, or explains it for a dry run.
+func (s *DataSourceServer) runQuery(ctx context.Context, connectorName string, q query.Query, dryRun bool) (*grpc.QueryResponse, error) {
+	connector, err := s.manager.GetConnector(connectorName)
+	if err != nil {
+		log.Printf("Error getting connector %s: %v", connectorName, err)
 		return nil, status.Errorf(codes.NotFound, "connector not found: %v", err)
 	}
 
-	executor := query.NewQueryExecutor(connector)
+	executor := query.NewQueryExecutor(connector).WithPolicies(s.policies.For(connectorName))
 
-	var q query.Query
-	err = json.Unmarshal([]byte(req.Query), &q)
-	if err != nil {
-		log.Printf("Error unmarshalling query: %v", err)
-		return nil, status.Errorf(codes.InvalidArgument, "invalid query: %v", err)
+	if dryRun {
+		explanation, err := executor.Explain(ctx, q)
+		if err != nil {
+			log.Printf("Error explaining query: %v", err)
+			if errors.IsErrorType(err, errors.ErrorTypePermission) {
+				return nil, status.Errorf(codes.PermissionDenied, "query denied: %v", err)
+			}
+			if errors.IsErrorType(err, errors.ErrorTypeValidation) || errors.IsErrorType(err, errors.ErrorTypeUnsupported) {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid query: %v", err)
+			}
+			return nil, status.Errorf(codes.Internal, "query explain failed: %v", err)
+		}
+		return explainResponse(explanation)
 	}
 
 	results, err := executor.Execute(ctx, q)
 	if err != nil {
 		log.Printf("Error executing query: %v", err)
+		if errors.IsErrorType(err, errors.ErrorTypePermission) {
+			return nil, status.Errorf(codes.PermissionDenied, "query denied: %v", err)
+		}
 		return nil, status.Errorf(codes.Internal, "query execution failed: %v", err)
 	}
 
+	rows, err := marshalRows(results)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Successfully executed query on %s, returned %d rows", connectorName, len(rows))
+	return &grpc.QueryResponse{Rows: rows}, nil
+}
+
+// parseQuery reads a query given either as a JSON query.Query or as query text, such as
+// "SELECT a, sum(b) FROM orders GROUP BY a".
+func parseQuery(text string) (query.Query, error) {
+	if strings.HasPrefix(strings.TrimSpace(text), "{") {
+		var q query.Query
+		err := json.Unmarshal([]byte(text), &q)
+		return q, err
+	}
+	return query.Parse(text)
+}
+
+func (s *DataSourceServer) executeFederatedQuery(ctx context.Context, req *grpc.QueryRequest, event *audit.Event) (*grpc.QueryResponse, error) {
+	log.Printf("Received federated ExecuteQuery request")
+
+	var fq query.FederatedQuery
+	if err := json.Unmarshal([]byte(req.Query), &fq); err != nil {
+		log.Printf("Error unmarshalling federated query: %v", err)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid federated query: %v", err)
+	}
+	event.Query = normalizeQuery(fq)
+
+	if req.DryRun {
+		plan, err := s.federation.Plan(fq)
+		if err != nil {
+			log.Printf("Error planning federated query: %v", err)
+			return nil, federatedStatus(err)
+		}
+		return explainResponse(plan)
+	}
+
+	results, err := s.federation.Execute(ctx, fq)
+	if err != nil {
+		log.Printf("Error executing federated query: %v", err)
+		return nil, federatedStatus(err)
+	}
+
+	rows, err := marshalRows(results)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Successfully executed federated query on %d sources, returned %d rows", len(fq.Sources), len(rows))
+	return &grpc.QueryResponse{Rows: rows}, nil
+}
+
+// federatedStatus converts a federated query error into a gRPC status.
+func federatedStatus(err error) error {
+	switch {
+	case errors.IsErrorType(err, errors.ErrorTypeValidation):
+		return status.Errorf(codes.InvalidArgument, "invalid federated query: %v", err)
+	case errors.IsErrorType(err, errors.ErrorTypeNotFound):
+		return status.Errorf(codes.NotFound, "connector not found: %v", err)
+	case errors.IsErrorType(err, errors.ErrorTypePermission):
+		return status.Errorf(codes.PermissionDenied, "federated query denied: %v", err)
+	case errors.IsErrorType(err, errors.ErrorTypeResourceExhausted):
+		return status.Errorf(codes.ResourceExhausted, "federated query failed: %v", err)
+	}
+	return status.Errorf(codes.Internal, "federated query failed: %v", err)
+}
+
+// explainResponse encodes the explanation of a dry run, a query.Explanation or a federated
+// plan, as JSON for a QueryResponse.
+func explainResponse(explanation interface{}) (*grpc.QueryResponse, error) {
+	data, err := json.Marshal(explanation)
+	if err != nil {
+		log.Printf("Error marshalling explanation: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to marshal explanation: %v", err)
+	}
+	return &grpc.QueryResponse{Explanation: data}, nil
+}
+
+// marshalRows encodes result rows as JSON for a QueryResponse.
+func marshalRows(results []map[string]interface{}) ([][]byte, error) {
 	var rows [][]byte
 	for _, result := range results {
 		rowBytes, err := json.Marshal(result)
@@ -95,14 +268,29 @@ func (s *DataSourceServer) ExecuteQuery(ctx context.Context, req *grpc.QueryRequ
 		}
 		rows = append(rows, rowBytes)
 	}
-
-	log.Printf("Successfully executed query on %s, returned %d rows", req.ConnectorName, len(rows))
-	return &grpc.QueryResponse{Rows: rows}, nil
+	return rows, nil
 }
 
-func (s *DataSourceServer) ExecuteCommand(ctx context.Context, req *grpc.CommandRequest) (*grpc.CommandResponse, error) {
+// ExecuteCommand runs a native command on a connector, recording it in the audit log.
+// Commands cannot be checked against policies, so they are refused to callers that any of
+// the connector's policies apply to.
+func (s *DataSourceServer) ExecuteCommand(ctx context.Context, req *grpc.CommandRequest) (resp *grpc.CommandResponse, err error) {
+	ctx, event := s.begin(ctx, "ExecuteCommand", req.ConnectorName)
+	event.Query, event.Args = req.Command, req.Args
+	defer func() {
+		if resp != nil {
+			event.Rows = resp.AffectedRows
+		}
+		s.finishAudit(ctx, event, err)
+	}()
+
 	log.Printf("Received ExecuteCommand request for connector: %s", req.ConnectorName)
 
+	if principal, _ := query.PrincipalFromContext(ctx); s.policies.Restricts(req.ConnectorName, principal) {
+		log.Printf("Refused command on %s: connector has policies for the caller", req.ConnectorName)
+		return nil, status.Errorf(codes.PermissionDenied, "commands are not allowed on connector %s under its policies", req.ConnectorName)
+	}
+
 	connector, err := s.manager.GetConnector(req.ConnectorName)
 	if err != nil {
 		log.Printf("Error getting connector %s: %v", req.ConnectorName, err)
@@ -127,9 +315,19 @@ func (s *DataSourceServer) ExecuteCommand(ctx context.Context, req *grpc.Command
 // 	return &grpc.GetConnectorsResponse{ConnectorNames: connectorNames}, nil
 // }
 
-func (s *DataSourceServer) AddConnector(ctx context.Context, req *grpc.AddConnectorRequest) (*grpc.AddConnectorResponse, error) {
+// AddConnector registers a connector. It is refused to callers that any policy applies to,
+// as they could register a restricted database under a name without policies.
+func (s *DataSourceServer) AddConnector(ctx context.Context, req *grpc.AddConnectorRequest) (resp *grpc.AddConnectorResponse, err error) {
+	ctx, event := s.begin(ctx, "AddConnector", req.Name)
+	defer func() { s.finishAudit(ctx, event, err) }()
+
 	log.Printf("Received AddConnector request for connector: %s", req.Name)
 
+	if principal, _ := query.PrincipalFromContext(ctx); s.policies.RestrictsAny(principal) {
+		log.Printf("Refused to add connector %s: the caller is under policies", req.Name)
+		return nil, status.Errorf(codes.PermissionDenied, "connectors cannot be added by callers under policies")
+	}
+
 	config := &connectors.Config{
 		Type:     req.Config.Type,
 		Host:     req.Config.Host,
@@ -146,7 +344,7 @@ func (s *DataSourceServer) AddConnector(ctx context.Context, req *grpc.AddConnec
 		config.Options[k] = v
 	}
 
-	err := s.manager.AddConnector(req.Name, config)
+	err = s.manager.AddConnector(req.Name, config)
 	if err != nil {
 		log.Printf("Error adding connector %s: %v", req.Name, err)
 		return &grpc.AddConnectorResponse{Success: false, Error: err.Error()}, nil
@@ -156,10 +354,20 @@ func (s *DataSourceServer) AddConnector(ctx context.Context, req *grpc.AddConnec
 	return &grpc.AddConnectorResponse{Success: true}, nil
 }
 
-func (s *DataSourceServer) RemoveConnector(ctx context.Context, req *grpc.RemoveConnectorRequest) (*grpc.RemoveConnectorResponse, error) {
+// RemoveConnector unregisters a connector. Like AddConnector, it is refused to callers that
+// any policy applies to.
+func (s *DataSourceServer) RemoveConnector(ctx context.Context, req *grpc.RemoveConnectorRequest) (resp *grpc.RemoveConnectorResponse, err error) {
+	ctx, event := s.begin(ctx, "RemoveConnector", req.Name)
+	defer func() { s.finishAudit(ctx, event, err) }()
+
 	log.Printf("Received RemoveConnector request for connector: %s", req.Name)
 
-	err := s.manager.RemoveConnector(req.Name)
+	if principal, _ := query.PrincipalFromContext(ctx); s.policies.RestrictsAny(principal) {
+		log.Printf("Refused to remove connector %s: the caller is under policies", req.Name)
+		return nil, status.Errorf(codes.PermissionDenied, "connectors cannot be removed by callers under policies")
+	}
+
+	err = s.manager.RemoveConnector(req.Name)
 	if err != nil {
 		log.Printf("Error removing connector %s: %v", req.Name, err)
 		return &grpc.RemoveConnectorResponse{Success: false, Error: err.Error()}, nil
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	googlegrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"datasource/audit"
+	"datasource/connectors"
+	"datasource/grpc"
+	manager "datasource/managers"
+	"datasource/managers/query"
+)
+
+const ordersQuery = `{"type": "SELECT", "collection": "orders.json", "fields": ["id"], "order_by": [{"field": "id"}]}`
+
+// newTestServer returns a server for a "shop" file connector holding orders.json, whose
+// callers are named by the claims in their context and whose analysts only see paid orders.
+// The returned sink holds the server's audit log.
+func newTestServer(t *testing.T) (*DataSourceServer, *audit.FileSink) {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orders.json"), []byte(`[
+		{"id": 1, "status": "paid", "total": 30},
+		{"id": 2, "status": "refunded", "total": 8},
+		{"id": 3, "status": "paid", "total": 5}
+	]`), 0o644))
+	connectorManager := manager.NewConnectorManager()
+	require.NoError(t, connectorManager.AddConnector("shop", &connectors.Config{Type: "file", BasePath: dir}))
+
+	policies, err := query.NewPolicySet(map[string][]query.Policy{
+		"shop": {{Name: "paid-only", Roles: []string{"analyst"}, Conditions: map[string]interface{}{"status": "paid"}}},
+	})
+	require.NoError(t, err)
+
+	sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.log"))
+	require.NoError(t, err)
+	logger := audit.NewLogger(sink)
+	t.Cleanup(func() { logger.Close() })
+
+	return NewDataSourceServer(connectorManager, Options{
+		Audit:    logger,
+		Policies: policies,
+		Identity: audit.ClaimsIdentity(Claims),
+	}), sink
+}
+
+// auditEvents reads every event of the audit log.
+func auditEvents(t *testing.T, sink *audit.FileSink) []audit.Event {
+	t.Helper()
+	events, err := sink.Events(context.Background(), audit.Filter{})
+	require.NoError(t, err)
+	return events
+}
+
+// rowIDs decodes the ids of a query response's rows.
+func rowIDs(t *testing.T, resp *grpc.QueryResponse) []float64 {
+	t.Helper()
+	var ids []float64
+	for _, data := range resp.Rows {
+		var row map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &row))
+		ids = append(ids, row["id"].(float64))
+	}
+	return ids
+}
+
+var (
+	analyst = map[string]interface{}{"sub": "alice", "roles": []interface{}{"analyst"}}
+	admin   = map[string]interface{}{"sub": "root", "role": "admin"}
+)
+
+func TestExecuteQueryAudit(t *testing.T) {
+	s, sink := newTestServer(t)
+
+	resp, err := s.ExecuteQuery(withClaims(admin), &grpc.QueryRequest{ConnectorName: "shop", Query: ordersQuery})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 2, 3}, rowIDs(t, resp))
+
+	// The analyst's query runs under the connector's policies.
+	resp, err = s.ExecuteQuery(withClaims(analyst), &grpc.QueryRequest{ConnectorName: "shop", Query: ordersQuery})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 3}, rowIDs(t, resp))
+
+	_, err = s.ExecuteQuery(withClaims(analyst), &grpc.QueryRequest{ConnectorName: "missing", Query: ordersQuery})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	events := auditEvents(t, sink)
+	require.Len(t, events, 3)
+	assert.Equal(t, "root", events[0].User)
+	assert.Equal(t, []string{"admin"}, events[0].Roles)
+	assert.Equal(t, "ExecuteQuery", events[0].Method)
+	assert.Equal(t, "shop", events[0].Connector)
+	assert.Contains(t, events[0].Query, `"collection":"orders.json"`)
+	assert.Equal(t, int64(3), events[0].Rows)
+	assert.Equal(t, "alice", events[1].User)
+	assert.Equal(t, int64(2), events[1].Rows)
+	assert.Empty(t, events[1].Error)
+	assert.Equal(t, "missing", events[2].Connector)
+	assert.Contains(t, events[2].Error, "connector not found")
+
+	// The reports read the events the requests wrote.
+	stats, err := s.GetUsageStats(withClaims(admin), &grpc.UsageStatsRequest{GroupBy: "user"})
+	require.NoError(t, err)
+	usage := map[string][2]int64{}
+	for _, u := range stats.Stats {
+		usage[u.Key] = [2]int64{u.Queries, u.Errors}
+	}
+	assert.Equal(t, map[string][2]int64{"root": {1, 0}, "alice": {2, 1}}, usage)
+
+	slow, err := s.GetSlowQueries(withClaims(analyst), &grpc.SlowQueriesRequest{})
+	require.NoError(t, err)
+	require.Len(t, slow.Events, 2)
+	for _, e := range slow.Events {
+		assert.Equal(t, "alice", e.User)
+	}
+}
+
+func TestIdentityFromAuthInterceptor(t *testing.T) {
+	s, sink := newTestServer(t)
+	interceptor := AuthInterceptor(testSecret)
+
+	token := signToken(t, testSecret, map[string]interface{}{"sub": "alice", "roles": []string{"analyst"}, "exp": 4102444800})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	resp, err := interceptor(ctx, &grpc.QueryRequest{ConnectorName: "shop", Query: ordersQuery}, &googlegrpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return s.ExecuteQuery(ctx, req.(*grpc.QueryRequest))
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 3}, rowIDs(t, resp.(*grpc.QueryResponse)))
+
+	events := auditEvents(t, sink)
+	require.Len(t, events, 1)
+	assert.Equal(t, "alice", events[0].User)
+	assert.Equal(t, []string{"analyst"}, events[0].Roles)
+}
+
+func TestAdministrationRefusedUnderPolicies(t *testing.T) {
+	s, sink := newTestServer(t)
+	ctx := withClaims(analyst)
+
+	_, err := s.ExecuteCommand(ctx, &grpc.CommandRequest{ConnectorName: "shop", Command: connectors.FileCommandInsert})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "%v", err)
+	_, err = s.AddConnector(ctx, &grpc.AddConnectorRequest{Name: "shop-raw", Config: &grpc.ConnectorConfig{Type: "file"}})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "%v", err)
+	_, err = s.RemoveConnector(ctx, &grpc.RemoveConnectorRequest{Name: "shop"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "%v", err)
+
+	_, err = s.manager.GetConnector("shop")
+	require.NoError(t, err, "the connector is still registered")
+	_, err = s.manager.GetConnector("shop-raw")
+	assert.Error(t, err, "no connector was added")
+
+	events := auditEvents(t, sink)
+	require.Len(t, events, 3)
+	for i, method := range []string{"ExecuteCommand", "AddConnector", "RemoveConnector"} {
+		assert.Equal(t, method, events[i].Method)
+		assert.Equal(t, "alice", events[i].User)
+		assert.NotEmpty(t, events[i].Error)
+	}
+
+	// Callers that no policy applies to administer connectors.
+	ctx = withClaims(admin)
+	added, err := s.AddConnector(ctx, &grpc.AddConnectorRequest{Name: "shop-raw", Config: &grpc.ConnectorConfig{Type: "file"}})
+	require.NoError(t, err)
+	assert.True(t, added.Success)
+	removed, err := s.RemoveConnector(ctx, &grpc.RemoveConnectorRequest{Name: "shop-raw"})
+	require.NoError(t, err)
+	assert.True(t, removed.Success)
+	_, err = s.ExecuteCommand(ctx, &grpc.CommandRequest{ConnectorName: "shop", Command: "truncate"})
+	assert.Equal(t, codes.Internal, status.Code(err), "the command reaches the connector")
+	assert.Len(t, auditEvents(t, sink), 6)
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"datasource/grpc"
+	"datasource/managers/query"
+	"pkg/common/errors"
+)
+
+// SaveQuery stores a query as the next version of its name. Saved queries run for every
+// caller, so they cannot be changed by callers that any policy applies to.
+func (s *DataSourceServer) SaveQuery(ctx context.Context, req *grpc.SaveQueryRequest) (resp *grpc.SaveQueryResponse, err error) {
+	if req.Query == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "saved query is required")
+	}
+	ctx, event := s.begin(ctx, "SaveQuery", req.Query.ConnectorName)
+	event.Query = req.Query.Name
+	defer func() { s.finishAudit(ctx, event, err) }()
+
+	log.Printf("Received SaveQuery request for saved query: %s", req.Query.Name)
+
+	if principal, _ := query.PrincipalFromContext(ctx); s.policies.RestrictsAny(principal) {
+		log.Printf("Refused to save query %s: the caller is under policies", req.Query.Name)
+		return nil, status.Errorf(codes.PermissionDenied, "saved queries cannot be changed by callers under policies")
+	}
+
+	sq, err := savedQueryFromProto(req.Query)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid saved query: %v", err)
+	}
+	saved, err := s.savedQueries.Save(sq)
+	if err != nil {
+		log.Printf("Error saving query %s: %v", sq.Name, err)
+		return nil, savedQueryStatus(err)
+	}
+
+	log.Printf("Successfully saved query %s version %d", saved.Name, saved.Version)
+	return &grpc.SaveQueryResponse{Query: savedQueryToProto(saved)}, nil
+}
+
+// GetSavedQuery returns a version of a saved query, or its latest version if none is given.
+func (s *DataSourceServer) GetSavedQuery(ctx context.Context, req *grpc.GetSavedQueryRequest) (*grpc.GetSavedQueryResponse, error) {
+	sq, err := s.savedQueries.Get(req.Name, int(req.Version))
+	if err != nil {
+		return nil, savedQueryStatus(err)
+	}
+	return &grpc.GetSavedQueryResponse{Query: savedQueryToProto(sq)}, nil
+}
+
+// ListSavedQueries returns the latest version of every saved query or, when the request
+// names a saved query, all of its versions.
+func (s *DataSourceServer) ListSavedQueries(ctx context.Context, req *grpc.ListSavedQueriesRequest) (*grpc.ListSavedQueriesResponse, error) {
+	queries := s.savedQueries.List()
+	if req.Name != "" {
+		var err error
+		if queries, err = s.savedQueries.Versions(req.Name); err != nil {
+			return nil, savedQueryStatus(err)
+		}
+	}
+
+	resp := &grpc.ListSavedQueriesResponse{}
+	for _, sq := range queries {
+		resp.Queries = append(resp.Queries, savedQueryToProto(sq))
+	}
+	return resp, nil
+}
+
+// DeleteSavedQuery removes a saved query with all its versions. Like SaveQuery, it is refused
+// to callers that any policy applies to.
+func (s *DataSourceServer) DeleteSavedQuery(ctx context.Context, req *grpc.DeleteSavedQueryRequest) (resp *grpc.DeleteSavedQueryResponse, err error) {
+	ctx, event := s.begin(ctx, "DeleteSavedQuery", "")
+	event.Query = req.Name
+	defer func() { s.finishAudit(ctx, event, err) }()
+
+	log.Printf("Received DeleteSavedQuery request for saved query: %s", req.Name)
+
+	if principal, _ := query.PrincipalFromContext(ctx); s.policies.RestrictsAny(principal) {
+		log.Printf("Refused to delete saved query %s: the caller is under policies", req.Name)
+		return nil, status.Errorf(codes.PermissionDenied, "saved queries cannot be deleted by callers under policies")
+	}
+
+	if err := s.savedQueries.Delete(req.Name); err != nil {
+		log.Printf("Error deleting saved query %s: %v", req.Name, err)
+		return &grpc.DeleteSavedQueryResponse{Success: false, Error: err.Error()}, nil
+	}
+
+	log.Printf("Successfully deleted saved query: %s", req.Name)
+	return &grpc.DeleteSavedQueryResponse{Success: true}, nil
+}
+
+// ExecuteSavedQuery binds parameters, given as a JSON object, to a saved query and runs it on
+// the saved query's connector, as ExecuteQuery would. The bound query is recorded in the
+// audit log.
+func (s *DataSourceServer) ExecuteSavedQuery(ctx context.Context, req *grpc.ExecuteSavedQueryRequest) (resp *grpc.QueryResponse, err error) {
+	ctx, event := s.begin(ctx, "ExecuteSavedQuery", "")
+	event.Query, event.DryRun = req.Name, req.DryRun
+	defer func() { s.finishQueryAudit(ctx, event, resp, err) }()
+
+	log.Printf("Received ExecuteSavedQuery request for saved query: %s", req.Name)
+
+	sq, err := s.savedQueries.Get(req.Name, int(req.Version))
+	if err != nil {
+		return nil, savedQueryStatus(err)
+	}
+	event.Connector = sq.Connector
+
+	var params map[string]interface{}
+	if req.Parameters != "" {
+		if err := decodeJSON(req.Parameters, &params); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid parameters: %v", err)
+		}
+	}
+	q, err := sq.Bind(params)
+	if err != nil {
+		log.Printf("Error binding parameters of %s: %v", req.Name, err)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parameters: %v", err)
+	}
+	event.Query = normalizeQuery(q)
+	return s.runQuery(ctx, sq.Connector, q, req.DryRun)
+}
+
+// savedQueryStatus converts a saved query error into a gRPC status.
+func savedQueryStatus(err error) error {
+	switch {
+	case errors.IsErrorType(err, errors.ErrorTypeValidation):
+		return status.Errorf(codes.InvalidArgument, "invalid saved query: %v", err)
+	case errors.IsErrorType(err, errors.ErrorTypeNotFound):
+		return status.Errorf(codes.NotFound, "saved query not found: %v", err)
+	}
+	return status.Errorf(codes.Internal, "saved query failed: %v", err)
+}
+
+// decodeJSON decodes a JSON value, keeping numbers as json.Number so that large integers
+// are bound exactly.
+func decodeJSON(text string, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(text)))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func savedQueryFromProto(pb *grpc.SavedQuery) (query.SavedQuery, error) {
+	sq := query.SavedQuery{
+		Name:        pb.Name,
+		Connector:   pb.ConnectorName,
+		Query:       pb.Query,
+		Description: pb.Description,
+	}
+	for _, p := range pb.Parameters {
+		param := query.Parameter{Name: p.Name, Type: query.ParamType(p.Type), Items: query.ParamType(p.Items)}
+		// Defaults are JSON values, such as "\"paid\"", 10 or ["a", "b"].
+		if p.Default != "" {
+			if err := decodeJSON(p.Default, &param.Default); err != nil {
+				return sq, errors.NewError(errors.ErrorTypeValidation, "invalid default for parameter "+p.Name, err)
+			}
+		}
+		sq.Parameters = append(sq.Parameters, param)
+	}
+	return sq, nil
+}
+
+func savedQueryToProto(sq query.SavedQuery) *grpc.SavedQuery {
+	pb := &grpc.SavedQuery{
+		Name:          sq.Name,
+		Version:       int32(sq.Version),
+		ConnectorName: sq.Connector,
+		Query:         sq.Query,
+		Description:   sq.Description,
+		CreatedAt:     sq.CreatedAt.Format(time.RFC3339),
+	}
+	for _, p := range sq.Parameters {
+		param := &grpc.QueryParameter{Name: p.Name, Type: string(p.Type), Items: string(p.Items)}
+		if p.Default != nil {
+			if data, err := json.Marshal(p.Default); err == nil {
+				param.Default = string(data)
+			}
+		}
+		pb.Parameters = append(pb.Parameters, param)
+	}
+	return pb
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"datasource/grpc"
+)
+
+func ordersByStatus() *grpc.SavedQuery {
+	return &grpc.SavedQuery{
+		Name:          "orders-by-status",
+		ConnectorName: "shop",
+		Query:         `{"type": "SELECT", "collection": "orders.json", "fields": ["id"], "conditions": {"status": {"$param": "status"}}, "order_by": [{"field": "id"}]}`,
+		Parameters:    []*grpc.QueryParameter{{Name: "status", Type: "string"}},
+	}
+}
+
+func TestSavedQueriesRefusedUnderPolicies(t *testing.T) {
+	s, sink := newTestServer(t)
+
+	_, err := s.SaveQuery(withClaims(analyst), &grpc.SaveQueryRequest{Query: ordersByStatus()})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "%v", err)
+	_, err = s.GetSavedQuery(withClaims(admin), &grpc.GetSavedQueryRequest{Name: "orders-by-status"})
+	assert.Equal(t, codes.NotFound, status.Code(err), "nothing was saved")
+
+	saved, err := s.SaveQuery(withClaims(admin), &grpc.SaveQueryRequest{Query: ordersByStatus()})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), saved.Query.Version)
+
+	_, err = s.DeleteSavedQuery(withClaims(analyst), &grpc.DeleteSavedQueryRequest{Name: "orders-by-status"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "%v", err)
+	deleted, err := s.DeleteSavedQuery(withClaims(admin), &grpc.DeleteSavedQueryRequest{Name: "orders-by-status"})
+	require.NoError(t, err)
+	assert.True(t, deleted.Success)
+
+	events := auditEvents(t, sink)
+	require.Len(t, events, 4)
+	for i, want := range []struct{ method, user string }{
+		{"SaveQuery", "alice"}, {"SaveQuery", "root"}, {"DeleteSavedQuery", "alice"}, {"DeleteSavedQuery", "root"},
+	} {
+		assert.Equal(t, want.method, events[i].Method)
+		assert.Equal(t, want.user, events[i].User)
+		assert.Equal(t, "orders-by-status", events[i].Query)
+		assert.Equal(t, want.user == "alice", events[i].Error != "", "%+v", events[i])
+	}
+}
+
+func TestExecuteSavedQuery(t *testing.T) {
+	s, sink := newTestServer(t)
+	_, err := s.SaveQuery(withClaims(admin), &grpc.SaveQueryRequest{Query: ordersByStatus()})
+	require.NoError(t, err)
+
+	resp, err := s.ExecuteSavedQuery(withClaims(admin), &grpc.ExecuteSavedQueryRequest{Name: "orders-by-status", Parameters: `{"status": "refunded"}`})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{2}, rowIDs(t, resp))
+
+	// Saved queries run under the policies of the caller.
+	resp, err = s.ExecuteSavedQuery(withClaims(analyst), &grpc.ExecuteSavedQueryRequest{Name: "orders-by-status", Parameters: `{"status": "refunded"}`})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Rows)
+
+	_, err = s.ExecuteSavedQuery(withClaims(admin), &grpc.ExecuteSavedQueryRequest{Name: "orders-by-status", Parameters: `{}`})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "%v", err)
+	_, err = s.ExecuteSavedQuery(withClaims(admin), &grpc.ExecuteSavedQueryRequest{Name: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err), "%v", err)
+
+	events := auditEvents(t, sink)
+	require.Len(t, events, 5)
+	run := events[1]
+	assert.Equal(t, "ExecuteSavedQuery", run.Method)
+	assert.Equal(t, "shop", run.Connector)
+	assert.Contains(t, run.Query, `"status":"refunded"`, "the bound query is recorded")
+	assert.Equal(t, int64(1), run.Rows)
+	assert.Equal(t, "alice", events[2].User)
+	assert.Zero(t, events[2].Rows)
+	assert.NotEmpty(t, events[3].Error)
+	assert.Equal(t, "missing", events[4].Query)
+	assert.NotEmpty(t, events[4].Error)
+}
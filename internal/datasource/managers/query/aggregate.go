@@ -0,0 +1,214 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/common/errors"
+)
+
+// validateAggregation checks that an aggregation can be computed in memory.
+func validateAggregation(agg Aggregation) error {
+	switch agg.Function {
+	case Count:
+		return nil
+	case Sum, Avg, Min, Max:
+		if agg.Field == "" || agg.Field == "*" {
+			return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("%s requires a field", agg.Function), nil)
+		}
+		return nil
+	default:
+		return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("unsupported aggregate function %s", agg.Function), nil)
+	}
+}
+
+// aggregateState accumulates one aggregation over the rows of a group.
+type aggregateState struct {
+	count int64
+	sum   float64
+	// numbers counts the values added to sum.
+	numbers int64
+	min     interface{}
+	max     interface{}
+}
+
+func (s *aggregateState) add(agg Aggregation, row map[string]interface{}) {
+	if agg.Field == "" || agg.Field == "*" {
+		s.count++
+		return
+	}
+	v, ok := row[agg.Field]
+	if !ok || v == nil {
+		return
+	}
+	s.count++
+	if f, ok := toFloat(v); ok {
+		s.sum += f
+		s.numbers++
+	}
+	if cmp, ok := compareValues(v, s.min); s.min == nil || ok && cmp < 0 {
+		s.min = v
+	}
+	if cmp, ok := compareValues(v, s.max); s.max == nil || ok && cmp > 0 {
+		s.max = v
+	}
+}
+
+func (s *aggregateState) result(agg Aggregation) interface{} {
+	switch agg.Function {
+	case Count:
+		return s.count
+	case Sum:
+		if s.numbers == 0 {
+			return nil
+		}
+		return s.sum
+	case Avg:
+		if s.numbers == 0 {
+			return nil
+		}
+		return s.sum / float64(s.numbers)
+	case Min:
+		return s.min
+	default:
+		return s.max
+	}
+}
+
+// aggregateGroup is the state of one group.
+type aggregateGroup struct {
+	values map[string]interface{}
+	states []aggregateState
+}
+
+// aggregateRows groups the rows passed to the returned add function by the groupBy
+// columns, and computes the aggregations of each group, as SQL would: without groupBy all
+// rows form one group, which exists even if there are no rows. Groups are kept in memory
+// and returned in the order they were first seen; adding a group that does not fit in the
+// budget fails.
+func aggregateRows(groupBy []string, aggs []Aggregation, budget *memoryBudget) (add func(row map[string]interface{}) error, results func() []map[string]interface{}) {
+	groups := make(map[string]*aggregateGroup)
+	var order []*aggregateGroup
+	var reserved int64
+
+	add = func(row map[string]interface{}) error {
+		var key strings.Builder
+		for _, field := range groupBy {
+			key.WriteString(valueKey(row[field]))
+			key.WriteByte(0)
+		}
+		group, ok := groups[key.String()]
+		if !ok {
+			group = &aggregateGroup{values: make(map[string]interface{}, len(groupBy)), states: make([]aggregateState, len(aggs))}
+			for _, field := range groupBy {
+				group.values[field] = row[field]
+			}
+			size := rowSize(group.values) + int64(64*len(aggs))
+			if !budget.reserve(size) {
+				return errors.NewError(errors.ErrorTypeResourceExhausted, "too many groups to aggregate within the memory limit", nil)
+			}
+			reserved += size
+			groups[key.String()] = group
+			order = append(order, group)
+		}
+		for i, agg := range aggs {
+			group.states[i].add(agg, row)
+		}
+		return nil
+	}
+
+	results = func() []map[string]interface{} {
+		defer budget.release(reserved)
+		if len(order) == 0 && len(groupBy) == 0 {
+			order = append(order, &aggregateGroup{values: map[string]interface{}{}, states: make([]aggregateState, len(aggs))})
+		}
+		rows := make([]map[string]interface{}, len(order))
+		for i, group := range order {
+			row := make(map[string]interface{}, len(groupBy)+len(aggs))
+			for k, v := range group.values {
+				row[k] = v
+			}
+			for j, agg := range aggs {
+				row[agg.Name()] = group.states[j].result(agg)
+			}
+			rows[i] = row
+		}
+		return rows
+	}
+	return add, results
+}
+
+// valueKey returns a string that is equal for values that conditions consider equal, for
+// use as a hash key: numbers, and strings holding numbers, by their numeric value, and
+// times by their instant. Nil has its own key.
+func valueKey(v interface{}) string {
+	if v == nil {
+		return "z"
+	}
+	if n, ok := numberKey(v); ok {
+		return "n" + n
+	}
+	if t, ok := toTime(v); ok {
+		return "t" + t.UTC().Format(time.RFC3339Nano)
+	}
+	return "s" + fmt.Sprint(v)
+}
+
+// numberKey formats a number for valueKey. Integers are formatted exactly, as floats cannot
+// tell large ones apart, and integral floats as the same integer, so that 1 and 1.0 share a
+// key.
+func numberKey(v interface{}) (string, bool) {
+	switch n := v.(type) {
+	case int:
+		return strconv.FormatInt(int64(n), 10), true
+	case int8:
+		return strconv.FormatInt(int64(n), 10), true
+	case int16:
+		return strconv.FormatInt(int64(n), 10), true
+	case int32:
+		return strconv.FormatInt(int64(n), 10), true
+	case int64:
+		return strconv.FormatInt(n, 10), true
+	case uint:
+		return strconv.FormatUint(uint64(n), 10), true
+	case uint8:
+		return strconv.FormatUint(uint64(n), 10), true
+	case uint16:
+		return strconv.FormatUint(uint64(n), 10), true
+	case uint32:
+		return strconv.FormatUint(uint64(n), 10), true
+	case uint64:
+		return strconv.FormatUint(n, 10), true
+	case json.Number:
+		if s, ok := integerKey(string(n)); ok {
+			return s, true
+		}
+	case string:
+		if s, ok := integerKey(n); ok {
+			return s, true
+		}
+	}
+	f, ok := toFloat(v)
+	if !ok {
+		return "", false
+	}
+	if f == math.Trunc(f) && math.Abs(f) < math.MaxInt64 {
+		return strconv.FormatInt(int64(f), 10), true
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64), true
+}
+
+// integerKey formats a string holding an integer as numberKey formats the integer.
+func integerKey(s string) (string, bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return strconv.FormatInt(i, 10), true
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return strconv.FormatUint(u, 10), true
+	}
+	return "", false
+}
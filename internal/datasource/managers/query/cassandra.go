@@ -0,0 +1,320 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"datasource/connectors"
+	"pkg/common/errors"
+)
+
+// buildCQLQuery translates a query into a CQL statement with ? placeholders.
+//
+// Cassandra can only serve a filter efficiently when it restricts the partition key, a prefix
+// of the clustering columns, or one secondary index. Queries that need a full scan to filter
+// are rejected with a validation error, unless allowFiltering is set, in which case ALLOW
+// FILTERING is appended. Ordering and grouping are only possible on clustering and primary
+// key columns, and CQL has no OFFSET, so paging state must be used instead.
+func buildCQLQuery(query Query, table *connectors.CassandraTable, allowFiltering bool) (string, []interface{}, error) {
+	columns := map[string]bool{}
+	for _, col := range table.Columns {
+		columns[col] = true
+	}
+	checkColumn := func(col string) error {
+		if !columns[col] {
+			return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("unknown column %s in table %s", col, table.Name), nil)
+		}
+		return nil
+	}
+
+	conditions, err := parseConditions(query.Conditions)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, c := range conditions {
+		if err := checkColumn(c.Field); err != nil {
+			return "", nil, err
+		}
+		switch c.Op {
+		case OpEq, OpIn, OpGt, OpGte, OpLt, OpLte:
+		default:
+			return "", nil, errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("operator %s is not supported by Cassandra", c.Op), nil)
+		}
+	}
+
+	var cql strings.Builder
+	var args []interface{}
+	tableName := table.Name
+	if table.Keyspace != "" {
+		tableName = table.Keyspace + "." + table.Name
+	}
+
+	switch query.Type {
+	case Select:
+		if query.TimeBucket != nil {
+			return "", nil, errors.NewError(errors.ErrorTypeUnsupported, "time buckets are not supported by Cassandra", nil)
+		}
+		if query.Offset > 0 {
+			return "", nil, errors.NewError(errors.ErrorTypeUnsupported, "offset is not supported by Cassandra; use paging state instead", nil)
+		}
+
+		selectList := append([]string(nil), query.Fields...)
+		if len(selectList) == 0 && len(query.Aggregations) > 0 {
+			selectList = append(selectList, query.GroupBy...)
+		}
+		for _, col := range selectList {
+			if err := checkColumn(col); err != nil {
+				return "", nil, err
+			}
+		}
+		for _, agg := range query.Aggregations {
+			expr, err := cqlAggregate(agg, checkColumn)
+			if err != nil {
+				return "", nil, err
+			}
+			selectList = append(selectList, expr)
+		}
+
+		cql.WriteString("SELECT ")
+		if len(selectList) > 0 {
+			cql.WriteString(strings.Join(selectList, ", "))
+		} else {
+			cql.WriteString("*")
+		}
+		cql.WriteString(" FROM ")
+		cql.WriteString(tableName)
+	case Insert:
+		if len(query.Data) == 0 {
+			return "", nil, errors.NewError(errors.ErrorTypeValidation, "insert requires data", nil)
+		}
+		keys := sortedKeys(query.Data)
+		placeholders := make([]string, len(keys))
+		for i, k := range keys {
+			if err := checkColumn(k); err != nil {
+				return "", nil, err
+			}
+			placeholders[i] = "?"
+			args = append(args, query.Data[k])
+		}
+		cql.WriteString(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, strings.Join(keys, ", "), strings.Join(placeholders, ", ")))
+		return cql.String(), args, nil
+	case Update:
+		if len(query.Data) == 0 {
+			return "", nil, errors.NewError(errors.ErrorTypeValidation, "update requires data", nil)
+		}
+		var sets []string
+		for _, k := range sortedKeys(query.Data) {
+			if err := checkColumn(k); err != nil {
+				return "", nil, err
+			}
+			sets = append(sets, k+" = ?")
+			args = append(args, query.Data[k])
+		}
+		cql.WriteString(fmt.Sprintf("UPDATE %s SET %s", tableName, strings.Join(sets, ", ")))
+	case Delete:
+		cql.WriteString("DELETE FROM ")
+		cql.WriteString(tableName)
+	default:
+		return "", nil, errors.NewError(errors.ErrorTypeUnsupported, "unsupported query type for Cassandra", nil)
+	}
+
+	if query.Type != Select && len(conditions) == 0 {
+		return "", nil, errors.NewError(errors.ErrorTypeValidation, "update and delete require the primary key in conditions", nil)
+	}
+
+	if len(conditions) > 0 {
+		var where []string
+		for _, c := range conditions {
+			switch c.Op {
+			case OpIn:
+				list := c.Value.([]interface{})
+				placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(list)), ", ")
+				where = append(where, fmt.Sprintf("%s IN (%s)", c.Field, placeholders))
+				args = append(args, list...)
+			default:
+				where = append(where, fmt.Sprintf("%s %s ?", c.Field, sqlOperators[c.Op]))
+				args = append(args, c.Value)
+			}
+		}
+		cql.WriteString(" WHERE ")
+		cql.WriteString(strings.Join(where, " AND "))
+	}
+
+	if query.Type != Select {
+		return cql.String(), args, nil
+	}
+
+	partitionRestricted := restrictsPartitionKey(conditions, table)
+
+	if len(query.GroupBy) > 0 {
+		if err := checkPrimaryKeyPrefix(query.GroupBy, table); err != nil {
+			return "", nil, err
+		}
+		cql.WriteString(" GROUP BY ")
+		cql.WriteString(strings.Join(query.GroupBy, ", "))
+	}
+
+	if len(query.OrderBy) > 0 {
+		if !partitionRestricted {
+			return "", nil, errors.NewError(errors.ErrorTypeValidation, "ORDER BY requires the partition key to be restricted by equality", nil)
+		}
+		var order []string
+		for i, o := range query.OrderBy {
+			if i >= len(table.ClusteringColumns) || table.ClusteringColumns[i] != o.Field {
+				return "", nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("ORDER BY must follow the clustering columns; %s is out of order", o.Field), nil)
+			}
+			direction := "ASC"
+			if o.Desc {
+				direction = "DESC"
+			}
+			order = append(order, o.Field+" "+direction)
+		}
+		cql.WriteString(" ORDER BY ")
+		cql.WriteString(strings.Join(order, ", "))
+	}
+
+	if query.Limit > 0 {
+		cql.WriteString(fmt.Sprintf(" LIMIT %d", query.Limit))
+	}
+
+	if needsFiltering(conditions, table) {
+		if !allowFiltering {
+			return "", nil, errors.NewError(errors.ErrorTypeValidation,
+				"query would require ALLOW FILTERING; restrict the partition key or enable the allow_filtering option", nil)
+		}
+		cql.WriteString(" ALLOW FILTERING")
+	}
+
+	return cql.String(), args, nil
+}
+
+// cqlAggregate returns the select expression for an aggregation.
+func cqlAggregate(agg Aggregation, checkColumn func(string) error) (string, error) {
+	switch agg.Function {
+	case Count, Sum, Avg, Min, Max:
+	default:
+		return "", errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("unsupported aggregate function %s", agg.Function), nil)
+	}
+	field := agg.Field
+	if field == "" || field == "*" {
+		if agg.Function != Count {
+			return "", errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("%s requires a field", agg.Function), nil)
+		}
+		field = "*"
+	} else if err := checkColumn(field); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s(%s) AS %s", agg.Function, field, agg.Name()), nil
+}
+
+// restrictsPartitionKey reports whether every partition key column is restricted by = or IN.
+func restrictsPartitionKey(conditions []condition, table *connectors.CassandraTable) bool {
+	for _, col := range table.PartitionKey {
+		found := false
+		for _, c := range conditions {
+			if c.Field == col && (c.Op == OpEq || c.Op == OpIn) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// needsFiltering reports whether Cassandra would refuse the restrictions without ALLOW FILTERING.
+// It follows the rules Cassandra applies to the primary key and secondary indexes, and errs on
+// the side of requiring filtering for combinations it does not model.
+func needsFiltering(conditions []condition, table *connectors.CassandraTable) bool {
+	if len(conditions) == 0 {
+		return false
+	}
+
+	ops := map[string][]Operator{}
+	for _, c := range conditions {
+		ops[c.Field] = append(ops[c.Field], c.Op)
+	}
+	isEquality := func(col string) bool {
+		for _, op := range ops[col] {
+			if op != OpEq && op != OpIn {
+				return false
+			}
+		}
+		return len(ops[col]) > 0
+	}
+
+	partitionRestricted := 0
+	for _, col := range table.PartitionKey {
+		if len(ops[col]) == 0 {
+			continue
+		}
+		if !isEquality(col) {
+			return true
+		}
+		partitionRestricted++
+	}
+	if partitionRestricted > 0 && partitionRestricted < len(table.PartitionKey) {
+		return true
+	}
+	partitionFull := partitionRestricted == len(table.PartitionKey)
+
+	clusteringRestricted := false
+	stopped := false
+	for _, col := range table.ClusteringColumns {
+		if len(ops[col]) == 0 {
+			stopped = true
+			continue
+		}
+		if stopped {
+			// A clustering column is restricted after an unrestricted or range-restricted one.
+			return true
+		}
+		clusteringRestricted = true
+		if !isEquality(col) {
+			stopped = true
+		}
+	}
+	if clusteringRestricted && !partitionFull {
+		return true
+	}
+
+	keys := map[string]bool{}
+	for _, col := range table.PartitionKey {
+		keys[col] = true
+	}
+	for _, col := range table.ClusteringColumns {
+		keys[col] = true
+	}
+	indexed := map[string]bool{}
+	for _, col := range table.Indexed {
+		indexed[col] = true
+	}
+
+	indexRestrictions := 0
+	for col, colOps := range ops {
+		if keys[col] {
+			continue
+		}
+		if !indexed[col] || len(colOps) != 1 || colOps[0] != OpEq {
+			return true
+		}
+		indexRestrictions++
+	}
+	return indexRestrictions > 1 || (indexRestrictions == 1 && clusteringRestricted)
+}
+
+// checkPrimaryKeyPrefix verifies that columns are the partition key followed by a prefix
+// of the clustering columns, as CQL requires for GROUP BY.
+func checkPrimaryKeyPrefix(columns []string, table *connectors.CassandraTable) error {
+	key := append(append([]string(nil), table.PartitionKey...), table.ClusteringColumns...)
+	if len(columns) < len(table.PartitionKey) || len(columns) > len(key) {
+		return errors.NewError(errors.ErrorTypeValidation, "GROUP BY must start with the full partition key", nil)
+	}
+	for i, col := range columns {
+		if key[i] != col {
+			return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("GROUP BY must follow the primary key; %s is out of order", col), nil)
+		}
+	}
+	return nil
+}
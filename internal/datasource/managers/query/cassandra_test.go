@@ -0,0 +1,147 @@
+package query
+
+import (
+	"testing"
+
+	"datasource/connectors"
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var readingsTable = &connectors.CassandraTable{
+	Keyspace:          "telemetry",
+	Name:              "readings",
+	PartitionKey:      []string{"sensor_id", "day"},
+	ClusteringColumns: []string{"ts", "seq"},
+	Columns:           []string{"day", "sensor_id", "seq", "site", "ts", "value"},
+	Indexed:           []string{"site"},
+}
+
+func TestBuildCQLQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    Query
+		wantCQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:    "Full scan",
+			query:   Query{Type: Select, Collection: "readings", Limit: 10},
+			wantCQL: "SELECT * FROM telemetry.readings LIMIT 10",
+		},
+		{
+			name: "Partition and clustering range",
+			query: Query{
+				Type:   Select,
+				Fields: []string{"ts", "value"},
+				Conditions: map[string]interface{}{
+					"sensor_id": "s1",
+					"day":       map[string]interface{}{"$in": []interface{}{"2024-05-01", "2024-05-02"}},
+					"ts":        map[string]interface{}{"$gte": 100},
+				},
+				OrderBy: []OrderBy{{Field: "ts", Desc: true}},
+			},
+			wantCQL:  "SELECT ts, value FROM telemetry.readings WHERE day IN (?, ?) AND sensor_id = ? AND ts >= ? ORDER BY ts DESC",
+			wantArgs: []interface{}{"2024-05-01", "2024-05-02", "s1", 100},
+		},
+		{
+			name:     "Secondary index",
+			query:    Query{Type: Select, Conditions: map[string]interface{}{"site": "eu-1"}},
+			wantCQL:  "SELECT * FROM telemetry.readings WHERE site = ?",
+			wantArgs: []interface{}{"eu-1"},
+		},
+		{
+			name: "Grouped aggregation",
+			query: Query{
+				Type:         Select,
+				Conditions:   map[string]interface{}{"sensor_id": "s1", "day": "2024-05-01"},
+				GroupBy:      []string{"sensor_id", "day", "ts"},
+				Aggregations: []Aggregation{{Function: Count}, {Function: Max, Field: "value"}},
+			},
+			wantCQL:  "SELECT sensor_id, day, ts, count(*) AS count, max(value) AS max_value FROM telemetry.readings WHERE day = ? AND sensor_id = ? GROUP BY sensor_id, day, ts",
+			wantArgs: []interface{}{"2024-05-01", "s1"},
+		},
+		{
+			name:     "Insert",
+			query:    Query{Type: Insert, Data: map[string]interface{}{"sensor_id": "s1", "day": "2024-05-01", "value": 1.5}},
+			wantCQL:  "INSERT INTO telemetry.readings (day, sensor_id, value) VALUES (?, ?, ?)",
+			wantArgs: []interface{}{"2024-05-01", "s1", 1.5},
+		},
+		{
+			name: "Update",
+			query: Query{
+				Type:       Update,
+				Data:       map[string]interface{}{"value": 2},
+				Conditions: map[string]interface{}{"sensor_id": "s1", "day": "2024-05-01", "ts": 100, "seq": 1},
+			},
+			wantCQL:  "UPDATE telemetry.readings SET value = ? WHERE day = ? AND sensor_id = ? AND seq = ? AND ts = ?",
+			wantArgs: []interface{}{2, "2024-05-01", "s1", 1, 100},
+		},
+		{
+			name:     "Delete",
+			query:    Query{Type: Delete, Conditions: map[string]interface{}{"sensor_id": "s1", "day": "2024-05-01"}},
+			wantCQL:  "DELETE FROM telemetry.readings WHERE day = ? AND sensor_id = ?",
+			wantArgs: []interface{}{"2024-05-01", "s1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cql, args, err := buildCQLQuery(tt.query, readingsTable, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCQL, cql)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
+
+func TestBuildCQLQueryAllowFiltering(t *testing.T) {
+	filtering := []map[string]interface{}{
+		{"value": 1},
+		{"sensor_id": "s1"},
+		{"ts": 100},
+		{"sensor_id": "s1", "day": "2024-05-01", "seq": 1},
+		{"sensor_id": "s1", "day": "2024-05-01", "ts": map[string]interface{}{"$gt": 1}, "seq": 1},
+		{"sensor_id": map[string]interface{}{"$gt": "s1"}, "day": "2024-05-01"},
+		{"site": map[string]interface{}{"$gt": "eu"}},
+		{"site": "eu-1", "value": 1},
+	}
+	for _, conditions := range filtering {
+		query := Query{Type: Select, Conditions: conditions}
+
+		_, _, err := buildCQLQuery(query, readingsTable, false)
+		assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation), "%v: %v", conditions, err)
+
+		cql, _, err := buildCQLQuery(query, readingsTable, true)
+		require.NoError(t, err)
+		assert.Contains(t, cql, " ALLOW FILTERING")
+	}
+
+	cql, _, err := buildCQLQuery(Query{Type: Select, Conditions: map[string]interface{}{"sensor_id": "s1", "day": "d"}}, readingsTable, true)
+	require.NoError(t, err)
+	assert.NotContains(t, cql, "ALLOW FILTERING", "only added when needed")
+}
+
+func TestBuildCQLQueryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   Query
+		errType errors.ErrorType
+	}{
+		{"Unknown column", Query{Type: Select, Fields: []string{"nope"}}, errors.ErrorTypeValidation},
+		{"Unsupported operator", Query{Type: Select, Conditions: map[string]interface{}{"site": map[string]interface{}{"$ne": "eu"}}}, errors.ErrorTypeUnsupported},
+		{"Offset", Query{Type: Select, Offset: 10}, errors.ErrorTypeUnsupported},
+		{"Order without partition", Query{Type: Select, OrderBy: []OrderBy{{Field: "ts"}}}, errors.ErrorTypeValidation},
+		{"Order on regular column", Query{Type: Select, Conditions: map[string]interface{}{"sensor_id": "s1", "day": "d"}, OrderBy: []OrderBy{{Field: "value"}}}, errors.ErrorTypeValidation},
+		{"Group by out of order", Query{Type: Select, GroupBy: []string{"day", "sensor_id"}}, errors.ErrorTypeValidation},
+		{"Delete without conditions", Query{Type: Delete}, errors.ErrorTypeValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := buildCQLQuery(tt.query, readingsTable, true)
+			assert.True(t, errors.IsErrorType(err, tt.errType), "%v", err)
+		})
+	}
+}
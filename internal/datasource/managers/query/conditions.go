@@ -0,0 +1,429 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/common/errors"
+)
+
+// Operator is a comparison used in query conditions.
+// Conditions use the MongoDB operator syntax, so they can be passed to MongoDB unchanged:
+//
+//	{"age": {"$gte": 18}, "status": {"$in": ["active", "trial"]}, "name": "Ada"}
+//
+// A plain value is an equality condition.
+type Operator string
+
+const (
+	OpEq     Operator = "$eq"
+	OpNe     Operator = "$ne"
+	OpGt     Operator = "$gt"
+	OpGte    Operator = "$gte"
+	OpLt     Operator = "$lt"
+	OpLte    Operator = "$lte"
+	OpIn     Operator = "$in"
+	OpNin    Operator = "$nin"
+	OpExists Operator = "$exists"
+	OpRegex  Operator = "$regex"
+	// OpLike matches a SQL LIKE pattern, where % matches any characters and _ one character.
+	OpLike Operator = "$like"
+)
+
+// Logical operators combine condition maps, as in {"$or": [{"a": 1}, {"b": 2}]}. SQL and
+// MongoDB sources and conditions evaluated in memory may use them; other sources refuse them.
+const (
+	OpAnd Operator = "$and"
+	OpOr  Operator = "$or"
+	OpNor Operator = "$nor"
+)
+
+// isLogicalOperator reports whether a conditions key combines condition maps.
+func isLogicalOperator(key string) bool {
+	switch Operator(key) {
+	case OpAnd, OpOr, OpNor:
+		return true
+	}
+	return false
+}
+
+// condition is a single field comparison parsed from Query.Conditions.
+type condition struct {
+	Field string
+	Op    Operator
+	Value interface{}
+}
+
+// parseConditions flattens a conditions map into field comparisons, ordered by field
+// and operator so that translated queries are deterministic. Logical operators are refused;
+// parseRowFilter parses conditions that may use them.
+func parseConditions(conditions map[string]interface{}) ([]condition, error) {
+	fields := make([]string, 0, len(conditions))
+	for field := range conditions {
+		if isLogicalOperator(field) {
+			return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("logical operator %s is not supported for this source", field), nil)
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var result []condition
+	for _, field := range fields {
+		value := conditions[field]
+		ops, ok := value.(map[string]interface{})
+		if !ok || !isOperatorMap(ops) {
+			result = append(result, condition{Field: field, Op: OpEq, Value: value})
+			continue
+		}
+
+		names := make([]string, 0, len(ops))
+		for name := range ops {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			op := Operator(name)
+			operand := ops[name]
+			switch op {
+			case OpEq, OpNe, OpGt, OpGte, OpLt, OpLte:
+			case OpIn, OpNin:
+				list, ok := toList(operand)
+				if !ok {
+					return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("%s on %s requires a list", op, field), nil)
+				}
+				operand = list
+			case OpExists:
+				if _, ok := operand.(bool); !ok {
+					return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("%s on %s requires a boolean", op, field), nil)
+				}
+			case OpRegex, OpLike:
+				if _, ok := operand.(string); !ok {
+					return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("%s on %s requires a string", op, field), nil)
+				}
+			default:
+				return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("unsupported operator %s on %s", name, field), nil)
+			}
+			result = append(result, condition{Field: field, Op: op, Value: operand})
+		}
+	}
+
+	return result, nil
+}
+
+// rowFilter is a conditions map parsed for evaluation in memory: its field comparisons,
+// which must all hold, and its logical operators.
+type rowFilter struct {
+	conditions []condition
+	logical    []logicalFilter
+}
+
+// logicalFilter combines the filters of a logical operator.
+type logicalFilter struct {
+	op      Operator
+	filters []*rowFilter
+}
+
+// parseRowFilter parses a conditions map that may use logical operators.
+func parseRowFilter(conditions map[string]interface{}) (*rowFilter, error) {
+	fields := make(map[string]interface{}, len(conditions))
+	f := &rowFilter{}
+	for _, key := range sortedKeys(conditions) {
+		if !isLogicalOperator(key) {
+			fields[key] = conditions[key]
+			continue
+		}
+		maps, err := logicalOperands(key, conditions[key])
+		if err != nil {
+			return nil, err
+		}
+		lf := logicalFilter{op: Operator(key)}
+		for _, m := range maps {
+			sub, err := parseRowFilter(m)
+			if err != nil {
+				return nil, err
+			}
+			lf.filters = append(lf.filters, sub)
+		}
+		f.logical = append(f.logical, lf)
+	}
+	var err error
+	if f.conditions, err = parseConditions(fields); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// logicalOperands returns the condition maps a logical operator combines.
+func logicalOperands(op string, v interface{}) ([]map[string]interface{}, error) {
+	invalid := errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("%s requires a non-empty list of condition maps", op), nil)
+	var maps []map[string]interface{}
+	switch list := v.(type) {
+	case []map[string]interface{}:
+		maps = list
+	case []interface{}:
+		for _, item := range list {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, invalid
+			}
+			maps = append(maps, m)
+		}
+	}
+	if len(maps) == 0 {
+		return nil, invalid
+	}
+	return maps, nil
+}
+
+// conditionFields calls fn with every field a conditions map compares, including those
+// inside logical operators.
+func conditionFields(conditions map[string]interface{}, fn func(field string) error) error {
+	for _, key := range sortedKeys(conditions) {
+		if !isLogicalOperator(key) {
+			if err := fn(key); err != nil {
+				return err
+			}
+			continue
+		}
+		maps, err := logicalOperands(key, conditions[key])
+		if err != nil {
+			return err
+		}
+		for _, m := range maps {
+			if err := conditionFields(m, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matches reports whether row satisfies the filter. A nil filter matches every row.
+func (f *rowFilter) matches(row map[string]interface{}) bool {
+	if f == nil {
+		return true
+	}
+	if !matchesConditions(row, f.conditions) {
+		return false
+	}
+	for _, lf := range f.logical {
+		matched := 0
+		for _, sub := range lf.filters {
+			if sub.matches(row) {
+				matched++
+			}
+		}
+		switch lf.op {
+		case OpAnd:
+			if matched < len(lf.filters) {
+				return false
+			}
+		case OpOr:
+			if matched == 0 {
+				return false
+			}
+		case OpNor:
+			if matched > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// likeToRegex converts a LIKE pattern to an anchored regular expression.
+func likeToRegex(pattern string) string {
+	var re strings.Builder
+	re.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			re.WriteString(".*")
+		case '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re.WriteString("$")
+	return re.String()
+}
+
+// isOperatorMap reports whether every key of m is an operator, as opposed to m
+// being a literal document value.
+func isOperatorMap(m map[string]interface{}) bool {
+	if len(m) == 0 {
+		return false
+	}
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// toList converts the operand of $in and $nin to a slice.
+func toList(v interface{}) ([]interface{}, bool) {
+	switch list := v.(type) {
+	case []interface{}:
+		return list, true
+	case []string:
+		result := make([]interface{}, len(list))
+		for i, s := range list {
+			result[i] = s
+		}
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
+// matches evaluates the condition against a row held in memory. Values of different
+// types are compared as numbers when both convert to one, and otherwise by their string
+// form, so that a numeric condition matches a CSV column.
+func (c condition) matches(row map[string]interface{}) bool {
+	got, ok := row[c.Field]
+	switch c.Op {
+	case OpExists:
+		return ok == c.Value.(bool)
+	case OpNe:
+		return !ok || !valuesEqual(got, c.Value)
+	case OpNin:
+		return !ok || !containsValue(c.Value.([]interface{}), got)
+	}
+	if !ok {
+		return false
+	}
+
+	switch c.Op {
+	case OpEq:
+		return valuesEqual(got, c.Value)
+	case OpIn:
+		return containsValue(c.Value.([]interface{}), got)
+	case OpRegex:
+		re, err := regexp.Compile(c.Value.(string))
+		return err == nil && re.MatchString(fmt.Sprintf("%v", got))
+	case OpLike:
+		re, err := regexp.Compile(likeToRegex(c.Value.(string)))
+		return err == nil && re.MatchString(fmt.Sprintf("%v", got))
+	case OpGt, OpGte, OpLt, OpLte:
+		cmp, ok := compareValues(got, c.Value)
+		if !ok {
+			return false
+		}
+		switch c.Op {
+		case OpGt:
+			return cmp > 0
+		case OpGte:
+			return cmp >= 0
+		case OpLt:
+			return cmp < 0
+		default:
+			return cmp <= 0
+		}
+	}
+	return false
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp == 0
+	}
+	return fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b)
+}
+
+func containsValue(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if valuesEqual(v, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareValues orders two values as numbers, times or strings. It reports false
+// when the values cannot be ordered against each other.
+func compareValues(a, b interface{}) (int, bool) {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	if x, ok := toTime(a); ok {
+		if y, ok := toTime(b); ok {
+			return x.Compare(y), true
+		}
+	}
+	x, xok := a.(string)
+	y, yok := b.(string)
+	if xok && yok {
+		return strings.Compare(x, y), true
+	}
+	return 0, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		return parsed, err == nil
+	default:
+		return time.Time{}, false
+	}
+}
@@ -0,0 +1,188 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/common/errors"
+)
+
+// dialect holds the parts of SQL that differ between databases.
+type dialect interface {
+	// Placeholder returns the bind parameter for the n-th argument, counting from 1.
+	Placeholder(n int) string
+	// Limit returns the clause that applies a limit and offset, either of which may be zero.
+	Limit(limit, offset int) string
+	// TimeBucket returns an expression that truncates field to the start of its interval.
+	TimeBucket(field string, interval time.Duration) (string, error)
+	// Regex returns a condition that matches field against the pattern in placeholder.
+	Regex(field, placeholder string) (string, error)
+	// QuoteIdent quotes a name, such as a column, escaping the quotes it holds.
+	QuoteIdent(name string) string
+}
+
+// dialectFor returns the dialect of an SQL driver name.
+func dialectFor(driver string) dialect {
+	switch driver {
+	case "postgres":
+		return postgresDialect{}
+	case "mysql":
+		return mysqlDialect{}
+	case "sqlite":
+		return sqliteDialect{}
+	case "clickhouse":
+		return clickhouseDialect{}
+	default:
+		return genericDialect{}
+	}
+}
+
+// genericDialect is ANSI-style SQL with ? placeholders.
+type genericDialect struct{}
+
+func (genericDialect) Placeholder(n int) string { return "?" }
+
+func (genericDialect) Limit(limit, offset int) string {
+	var clause string
+	if limit > 0 {
+		clause = fmt.Sprintf(" LIMIT %d", limit)
+	}
+	if offset > 0 {
+		clause += fmt.Sprintf(" OFFSET %d", offset)
+	}
+	return clause
+}
+
+func (genericDialect) TimeBucket(field string, interval time.Duration) (string, error) {
+	return "", errors.NewError(errors.ErrorTypeUnsupported, "time buckets are not supported for this SQL driver", nil)
+}
+
+func (genericDialect) Regex(field, placeholder string) (string, error) {
+	return "", errors.NewError(errors.ErrorTypeUnsupported, "regular expressions are not supported for this SQL driver", nil)
+}
+
+func (genericDialect) QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteBackticks quotes a name as MySQL and ClickHouse do.
+func quoteBackticks(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+type postgresDialect struct{ genericDialect }
+
+func (postgresDialect) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func (postgresDialect) TimeBucket(field string, interval time.Duration) (string, error) {
+	s := int64(interval / time.Second)
+	return fmt.Sprintf("to_timestamp(floor(extract(epoch from %s) / %d) * %d)", field, s, s), nil
+}
+
+func (postgresDialect) Regex(field, placeholder string) (string, error) {
+	return field + " ~ " + placeholder, nil
+}
+
+type mysqlDialect struct{ genericDialect }
+
+func (mysqlDialect) TimeBucket(field string, interval time.Duration) (string, error) {
+	s := int64(interval / time.Second)
+	return fmt.Sprintf("FROM_UNIXTIME(FLOOR(UNIX_TIMESTAMP(%s) / %d) * %d)", field, s, s), nil
+}
+
+func (mysqlDialect) Regex(field, placeholder string) (string, error) {
+	return field + " REGEXP " + placeholder, nil
+}
+
+func (mysqlDialect) QuoteIdent(name string) string { return quoteBackticks(name) }
+
+type sqliteDialect struct{ genericDialect }
+
+func (sqliteDialect) TimeBucket(field string, interval time.Duration) (string, error) {
+	s := int64(interval / time.Second)
+	return fmt.Sprintf("datetime(CAST(strftime('%%s', %s) AS INTEGER) / %d * %d, 'unixepoch')", field, s, s), nil
+}
+
+// clickhouseDialect uses LIMIT offset, limit and ClickHouse's interval functions.
+type clickhouseDialect struct{ genericDialect }
+
+func (clickhouseDialect) Limit(limit, offset int) string {
+	switch {
+	case limit > 0 && offset > 0:
+		return fmt.Sprintf(" LIMIT %d, %d", offset, limit)
+	case limit > 0:
+		return fmt.Sprintf(" LIMIT %d", limit)
+	case offset > 0:
+		return fmt.Sprintf(" OFFSET %d", offset)
+	}
+	return ""
+}
+
+func (clickhouseDialect) TimeBucket(field string, interval time.Duration) (string, error) {
+	return fmt.Sprintf("toStartOfInterval(%s, INTERVAL %d second)", field, int64(interval/time.Second)), nil
+}
+
+func (clickhouseDialect) Regex(field, placeholder string) (string, error) {
+	return fmt.Sprintf("match(%s, %s)", field, placeholder), nil
+}
+
+func (clickhouseDialect) QuoteIdent(name string) string { return quoteBackticks(name) }
+
+// plainName matches the names that SQL statements use as written.
+var plainName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedWords are the SQL keywords that cannot name a column unless quoted.
+var reservedWords = map[string]bool{
+	"ALL": true, "ALTER": true, "AND": true, "ANY": true, "AS": true, "ASC": true,
+	"BETWEEN": true, "BY": true, "CASE": true, "CAST": true, "CHECK": true, "COLUMN": true,
+	"CONSTRAINT": true, "CREATE": true, "CROSS": true, "DEFAULT": true, "DELETE": true,
+	"DESC": true, "DISTINCT": true, "DROP": true, "ELSE": true, "END": true, "EXISTS": true,
+	"FALSE": true, "FETCH": true, "FOR": true, "FOREIGN": true, "FROM": true, "FULL": true,
+	"GRANT": true, "GROUP": true, "HAVING": true, "IN": true, "INDEX": true, "INNER": true,
+	"INSERT": true, "INTERVAL": true, "INTO": true, "IS": true, "JOIN": true, "KEY": true,
+	"LEFT": true, "LIKE": true, "LIMIT": true, "NATURAL": true, "NOT": true, "NULL": true,
+	"OFFSET": true, "ON": true, "OR": true, "ORDER": true, "OUTER": true, "PRIMARY": true,
+	"REFERENCES": true, "REGEXP": true, "RIGHT": true, "SELECT": true, "SET": true,
+	"SOME": true, "TABLE": true, "THEN": true, "TO": true, "TRUE": true, "UNION": true,
+	"UNIQUE": true, "UPDATE": true, "USER": true, "USING": true, "VALUES": true, "WHEN": true,
+	"WHERE": true, "WITH": true,
+}
+
+// sqlIdent returns a name as it is written in an SQL statement. Each dot-separated part, as
+// in schema.table, is written as is if it is a plain name, and quoted otherwise, so that
+// reserved words and names with spaces work and no name can change the statement.
+func sqlIdent(d dialect, name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if !plainName.MatchString(part) || reservedWords[strings.ToUpper(part)] {
+			parts[i] = d.QuoteIdent(part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// parseInterval parses a bucket interval: a Go duration such as "30s", "5m" or "1h",
+// or a whole number of days such as "1d". Intervals must be whole seconds.
+func parseInterval(s string) (time.Duration, error) {
+	var interval time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("invalid interval %s", s), err)
+		}
+		interval = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("invalid interval %s", s), err)
+		}
+		interval = d
+	}
+	if interval < time.Second || interval%time.Second != 0 {
+		return 0, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("interval %s must be a positive whole number of seconds", s), nil)
+	}
+	return interval, nil
+}
@@ -0,0 +1,211 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"pkg/common/errors"
+)
+
+// defaultElasticsearchBuckets is the number of terms buckets requested per group-by
+// level when the query sets no limit. Elasticsearch itself defaults to ten.
+const defaultElasticsearchBuckets = 10000
+
+// buildElasticsearchQuery translates a query into an Elasticsearch search request body.
+//
+// Conditions become filters in a bool query, Fields select _source fields, and OrderBy,
+// Limit and Offset map to sort, size and from. Aggregations are requested as metric
+// aggregations, nested under one terms aggregation per GroupBy field and, outermost, a
+// date_histogram for the TimeBucket, and no hits are returned. Each aggregation is named
+// after its result column so that the connector can flatten the buckets back into rows.
+func buildElasticsearchQuery(query Query) (map[string]interface{}, error) {
+	conditions, err := parseConditions(query.Conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	search := map[string]interface{}{
+		"query": elasticsearchBoolQuery(conditions),
+	}
+
+	if len(query.GroupBy) == 0 && len(query.Aggregations) == 0 && query.TimeBucket == nil {
+		if len(query.Fields) > 0 {
+			search["_source"] = query.Fields
+		}
+		if len(query.OrderBy) > 0 {
+			sort := make([]interface{}, len(query.OrderBy))
+			for i, o := range query.OrderBy {
+				sort[i] = map[string]interface{}{o.Field: map[string]interface{}{"order": sortOrder(o.Desc)}}
+			}
+			search["sort"] = sort
+		}
+		if query.Limit > 0 {
+			search["size"] = query.Limit
+		}
+		if query.Offset > 0 {
+			search["from"] = query.Offset
+		}
+		return search, nil
+	}
+
+	if query.Offset > 0 {
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, "offset is not supported for Elasticsearch aggregations", nil)
+	}
+
+	metrics := map[string]interface{}{}
+	for _, agg := range query.Aggregations {
+		metric, err := elasticsearchMetric(agg)
+		if err != nil {
+			return nil, err
+		}
+		metrics[agg.Name()] = metric
+	}
+
+	aggs := metrics
+	for i := len(query.GroupBy) - 1; i >= 0; i-- {
+		field := query.GroupBy[i]
+		size := defaultElasticsearchBuckets
+		if query.Limit > 0 && i == 0 {
+			size = query.Limit
+		}
+		terms := map[string]interface{}{"field": field, "size": size}
+
+		var order []interface{}
+		for _, o := range query.OrderBy {
+			switch {
+			case o.Field == field:
+				order = append(order, map[string]interface{}{"_key": sortOrder(o.Desc)})
+			case i == len(query.GroupBy)-1 && metrics[o.Field] != nil:
+				order = append(order, map[string]interface{}{o.Field: sortOrder(o.Desc)})
+			}
+		}
+		if len(order) > 0 {
+			terms["order"] = order
+		}
+
+		bucket := map[string]interface{}{"terms": terms}
+		if len(aggs) > 0 {
+			bucket["aggs"] = aggs
+		}
+		aggs = map[string]interface{}{field: bucket}
+	}
+
+	if query.TimeBucket != nil {
+		interval, err := parseInterval(query.TimeBucket.Interval)
+		if err != nil {
+			return nil, err
+		}
+		histogram := map[string]interface{}{
+			"field":          query.TimeBucket.Field,
+			"fixed_interval": fmt.Sprintf("%ds", int64(interval/time.Second)),
+		}
+		for _, o := range query.OrderBy {
+			if o.Field == query.TimeBucket.Name() {
+				histogram["order"] = map[string]interface{}{"_key": sortOrder(o.Desc)}
+			}
+		}
+		bucket := map[string]interface{}{"date_histogram": histogram}
+		if len(aggs) > 0 {
+			bucket["aggs"] = aggs
+		}
+		aggs = map[string]interface{}{query.TimeBucket.Name(): bucket}
+	}
+
+	search["size"] = 0
+	search["aggs"] = aggs
+	return search, nil
+}
+
+// elasticsearchBoolQuery builds a filter-only bool query, or match_all if there are no conditions.
+func elasticsearchBoolQuery(conditions []condition) map[string]interface{} {
+	if len(conditions) == 0 {
+		return map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+
+	var filter, mustNot []interface{}
+	for _, c := range conditions {
+		switch c.Op {
+		case OpEq:
+			filter = append(filter, map[string]interface{}{"term": map[string]interface{}{c.Field: c.Value}})
+		case OpNe:
+			mustNot = append(mustNot, map[string]interface{}{"term": map[string]interface{}{c.Field: c.Value}})
+		case OpGt, OpGte, OpLt, OpLte:
+			filter = append(filter, map[string]interface{}{"range": map[string]interface{}{
+				c.Field: map[string]interface{}{string(c.Op[1:]): c.Value},
+			}})
+		case OpIn:
+			filter = append(filter, map[string]interface{}{"terms": map[string]interface{}{c.Field: c.Value}})
+		case OpNin:
+			mustNot = append(mustNot, map[string]interface{}{"terms": map[string]interface{}{c.Field: c.Value}})
+		case OpExists:
+			exists := map[string]interface{}{"exists": map[string]interface{}{"field": c.Field}}
+			if c.Value.(bool) {
+				filter = append(filter, exists)
+			} else {
+				mustNot = append(mustNot, exists)
+			}
+		case OpRegex:
+			filter = append(filter, map[string]interface{}{"regexp": map[string]interface{}{c.Field: c.Value}})
+		case OpLike:
+			filter = append(filter, map[string]interface{}{"wildcard": map[string]interface{}{c.Field: likeToWildcard(c.Value.(string))}})
+		}
+	}
+
+	boolQuery := map[string]interface{}{}
+	if len(filter) > 0 {
+		boolQuery["filter"] = filter
+	}
+	if len(mustNot) > 0 {
+		boolQuery["must_not"] = mustNot
+	}
+	return map[string]interface{}{"bool": boolQuery}
+}
+
+// elasticsearchMetric returns the aggregation that computes agg.
+// Counting rows uses a match_all filter aggregation, whose doc_count is the row count.
+func elasticsearchMetric(agg Aggregation) (map[string]interface{}, error) {
+	if agg.Function == Count && (agg.Field == "" || agg.Field == "*") {
+		return map[string]interface{}{"filter": map[string]interface{}{"match_all": map[string]interface{}{}}}, nil
+	}
+	if agg.Field == "" {
+		return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("%s requires a field", agg.Function), nil)
+	}
+
+	var name string
+	switch agg.Function {
+	case Count:
+		name = "value_count"
+	case Sum, Avg, Min, Max:
+		name = string(agg.Function)
+	default:
+		return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("unsupported aggregate function %s", agg.Function), nil)
+	}
+	return map[string]interface{}{name: map[string]interface{}{"field": agg.Field}}, nil
+}
+
+func sortOrder(desc bool) string {
+	if desc {
+		return "desc"
+	}
+	return "asc"
+}
+
+// likeToWildcard converts a LIKE pattern to an Elasticsearch wildcard pattern.
+func likeToWildcard(pattern string) string {
+	var w strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			w.WriteByte('*')
+		case '_':
+			w.WriteByte('?')
+		case '*', '?', '\\':
+			w.WriteByte('\\')
+			w.WriteRune(r)
+		default:
+			w.WriteRune(r)
+		}
+	}
+	return w.String()
+}
@@ -0,0 +1,134 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildElasticsearchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{
+			name:  "Match all",
+			query: Query{Type: Select, Collection: "orders"},
+			want:  `{"query": {"match_all": {}}}`,
+		},
+		{
+			name: "Filters, fields, sort and paging",
+			query: Query{
+				Type:   Select,
+				Fields: []string{"id", "amount"},
+				Conditions: map[string]interface{}{
+					"status":  "paid",
+					"amount":  map[string]interface{}{"$gte": 10, "$lt": 100},
+					"region":  map[string]interface{}{"$nin": []interface{}{"us"}},
+					"deleted": map[string]interface{}{"$exists": false},
+				},
+				OrderBy: []OrderBy{{Field: "amount", Desc: true}},
+				Limit:   20,
+				Offset:  40,
+			},
+			want: `{
+				"query": {"bool": {
+					"filter": [
+						{"range": {"amount": {"gte": 10}}},
+						{"range": {"amount": {"lt": 100}}},
+						{"term": {"status": "paid"}}
+					],
+					"must_not": [
+						{"exists": {"field": "deleted"}},
+						{"terms": {"region": ["us"]}}
+					]
+				}},
+				"_source": ["id", "amount"],
+				"sort": [{"amount": {"order": "desc"}}],
+				"size": 20,
+				"from": 40
+			}`,
+		},
+		{
+			name: "Grouped aggregations",
+			query: Query{
+				Type:         Select,
+				GroupBy:      []string{"region", "status"},
+				Aggregations: []Aggregation{{Function: Sum, Field: "amount"}, {Function: Count}},
+				OrderBy:      []OrderBy{{Field: "sum_amount", Desc: true}, {Field: "region"}},
+				Limit:        5,
+			},
+			want: `{
+				"query": {"match_all": {}},
+				"size": 0,
+				"aggs": {"region": {
+					"terms": {"field": "region", "size": 5, "order": [{"_key": "asc"}]},
+					"aggs": {"status": {
+						"terms": {"field": "status", "size": 10000, "order": [{"sum_amount": "desc"}]},
+						"aggs": {
+							"sum_amount": {"sum": {"field": "amount"}},
+							"count": {"filter": {"match_all": {}}}
+						}
+					}}
+				}}
+			}`,
+		},
+		{
+			name: "Time bucket",
+			query: Query{
+				Type:         Select,
+				TimeBucket:   &TimeBucket{Field: "@timestamp", Interval: "1h"},
+				Aggregations: []Aggregation{{Function: Max, Field: "latency"}},
+				OrderBy:      []OrderBy{{Field: "bucket", Desc: true}},
+			},
+			want: `{
+				"query": {"match_all": {}},
+				"size": 0,
+				"aggs": {"bucket": {
+					"date_histogram": {"field": "@timestamp", "fixed_interval": "3600s", "order": {"_key": "desc"}},
+					"aggs": {"max_latency": {"max": {"field": "latency"}}}
+				}}
+			}`,
+		},
+		{
+			name:  "Ungrouped aggregations",
+			query: Query{Type: Select, Aggregations: []Aggregation{{Function: Avg, Field: "amount", Alias: "mean"}, {Function: Count, Field: "id"}}},
+			want: `{
+				"query": {"match_all": {}},
+				"size": 0,
+				"aggs": {"mean": {"avg": {"field": "amount"}}, "count_id": {"value_count": {"field": "id"}}}
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			search, err := buildElasticsearchQuery(tt.query)
+			require.NoError(t, err)
+			got, err := json.Marshal(search)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestBuildElasticsearchQueryErrors(t *testing.T) {
+	tests := []Query{
+		{Conditions: map[string]interface{}{"a": map[string]interface{}{"$in": "x"}}},
+		{Aggregations: []Aggregation{{Function: Sum}}},
+		{Aggregations: []Aggregation{{Function: "median", Field: "a"}}},
+		{Conditions: map[string]interface{}{"$or": []interface{}{map[string]interface{}{"a": 1}}}},
+	}
+	for _, q := range tests {
+		_, err := buildElasticsearchQuery(q)
+		assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation), "%+v: %v", q, err)
+	}
+
+	_, err := buildElasticsearchQuery(Query{GroupBy: []string{"a"}, Offset: 10})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+}
@@ -0,0 +1,313 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"datasource/connectors"
+	"pkg/common/errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Explanation describes how a query would run on a connector, without running it.
+type Explanation struct {
+	// Source is the kind of backend, such as "postgres", "mongodb" or "file".
+	Source string `json:"source"`
+	// Native is the query that the executor sends to the source: SQL or CQL text with its
+	// args, a Mongo command, Redis commands, a search request or the path that is read.
+	Native map[string]interface{} `json:"native"`
+	// InMemory is set when the source returns whole collections, and the executor applies
+	// the conditions, ordering, offset, limit and field selection itself.
+	InMemory bool `json:"in_memory,omitempty"`
+	// Plan is the source's execution plan, for sources that report one: Postgres
+	// EXPLAIN (FORMAT JSON) output and the MongoDB query planner's report.
+	Plan interface{} `json:"plan,omitempty"`
+	// Cost is the planner's estimated total cost, where the plan holds one.
+	Cost *float64 `json:"cost,omitempty"`
+	// Policies are the policies applied to the query for the caller. Their conditions are
+	// part of the native query, and their columns are dropped or masked in the results.
+	Policies []AppliedPolicy `json:"policies,omitempty"`
+}
+
+// Explain translates a query as Execute would and returns the native query, with the
+// source's plan where it can report one. Nothing is written: sources are only read to
+// translate the query, such as the types of Redis keys and the schema of Cassandra tables,
+// and to plan it. Policies are enforced as Execute would, and listed in the explanation.
+//
+// Example:
+//
+//	explanation, err := executor.Explain(ctx, query.Query{
+//	    Type:       query.Select,
+//	    Collection: "orders",
+//	    Conditions: map[string]interface{}{"status": "paid"},
+//	})
+//	if err != nil {
+//	    log.Printf("Explain failed: %v", err)
+//	}
+//	log.Printf("Runs %v with plan %v", explanation.Native["sql"], explanation.Plan)
+func (qe *QueryExecutor) Explain(ctx context.Context, query Query) (*Explanation, error) {
+	query, enforced, err := qe.enforce(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	explanation, err := qe.explain(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if enforced != nil {
+		explanation.Policies = enforced.applied
+	}
+	return explanation, nil
+}
+
+func (qe *QueryExecutor) explain(ctx context.Context, query Query) (*Explanation, error) {
+	switch c := qe.connector.(type) {
+	case *connectors.SQLConnector:
+		return qe.explainSQL(ctx, c, query)
+	case *connectors.MongoConnector:
+		return qe.explainMongo(ctx, c, query)
+	case *connectors.RedisConnector:
+		return qe.explainRedis(ctx, c, query)
+	case *connectors.FileConnector:
+		if query.Type != Select && query.Type != Insert {
+			return nil, errors.NewError(errors.ErrorTypeUnsupported, "only SELECT and INSERT queries are supported for file connector", nil)
+		}
+		path, err := c.Path(query.Collection)
+		if err != nil {
+			return nil, err
+		}
+		if query.Type == Insert {
+			return &Explanation{Source: "file", Native: map[string]interface{}{"command": connectors.FileCommandInsert, "path": path, "rows": []map[string]interface{}{query.Data}}}, nil
+		}
+		if err := validateInMemory(query); err != nil {
+			return nil, err
+		}
+		return &Explanation{Source: "file", Native: map[string]interface{}{"path": path}, InMemory: true}, nil
+	case *connectors.S3Connector:
+		if query.Type != Select {
+			return nil, errors.NewError(errors.ErrorTypeUnsupported, "only SELECT queries are supported for S3 connector", nil)
+		}
+		if err := validateInMemory(query); err != nil {
+			return nil, err
+		}
+		return &Explanation{Source: "s3", Native: map[string]interface{}{"path": query.Collection}, InMemory: true}, nil
+	case *connectors.APIConnector:
+		switch query.Type {
+		case Select:
+			if err := validateInMemory(query); err != nil {
+				return nil, err
+			}
+			return &Explanation{Source: "api", Native: map[string]interface{}{"method": http.MethodGet, "path": query.Collection}, InMemory: true}, nil
+		case Insert:
+			return &Explanation{Source: "api", Native: map[string]interface{}{"method": http.MethodPost, "path": query.Collection, "body": query.Data}}, nil
+		default:
+			return nil, errors.NewError(errors.ErrorTypeUnsupported, "only SELECT and INSERT queries are supported for API connector", nil)
+		}
+	case *connectors.ElasticsearchConnector:
+		if query.Type != Select {
+			return nil, errors.NewError(errors.ErrorTypeUnsupported, "only SELECT queries are supported for Elasticsearch connector", nil)
+		}
+		var body interface{} = query.Raw
+		if len(query.Raw) == 0 {
+			search, err := buildElasticsearchQuery(query)
+			if err != nil {
+				return nil, err
+			}
+			body = search
+		}
+		return &Explanation{Source: "elasticsearch", Native: map[string]interface{}{"index": query.Collection, "body": body}}, nil
+	case *connectors.CassandraConnector:
+		table, err := c.Table(ctx, query.Collection)
+		if err != nil {
+			return nil, err
+		}
+		cql, args, err := buildCQLQuery(query, table, c.AllowFiltering())
+		if err != nil {
+			return nil, err
+		}
+		return &Explanation{Source: "cassandra", Native: map[string]interface{}{"cql": cql, "args": args}}, nil
+	case *connectors.ClickHouseConnector:
+		switch query.Type {
+		case Select, Delete:
+			sqlQuery, args, err := buildSQLQuery(query, clickhouseDialect{})
+			if err != nil {
+				return nil, err
+			}
+			return &Explanation{Source: "clickhouse", Native: map[string]interface{}{"sql": sqlQuery, "args": args}}, nil
+		case Insert:
+			return &Explanation{Source: "clickhouse", Native: map[string]interface{}{"table": query.Collection, "rows": []map[string]interface{}{query.Data}}}, nil
+		default:
+			return nil, errors.NewError(errors.ErrorTypeUnsupported, "only SELECT, INSERT and DELETE queries are supported for ClickHouse connector", nil)
+		}
+	default:
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, "unsupported connector type", nil)
+	}
+}
+
+// validateInMemory checks that the executor can apply a query to rows read in full, as
+// filterRows would.
+func validateInMemory(query Query) error {
+	_, err := filterRows(nil, query)
+	return err
+}
+
+func (qe *QueryExecutor) explainSQL(ctx context.Context, connector *connectors.SQLConnector, query Query) (*Explanation, error) {
+	sqlQuery, args, err := buildSQLQuery(query, dialectFor(connector.Driver()))
+	if err != nil {
+		return nil, err
+	}
+	explanation := &Explanation{Source: connector.Driver(), Native: map[string]interface{}{"sql": sqlQuery, "args": args}}
+	if connector.Driver() != "postgres" {
+		return explanation, nil
+	}
+
+	// Without ANALYZE the statement is planned but not run, so writes are safe to explain.
+	rows, err := connector.Query(ctx, "EXPLAIN (FORMAT JSON) "+sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	if explanation.Plan, explanation.Cost, err = postgresPlan(rows); err != nil {
+		return nil, err
+	}
+	return explanation, nil
+}
+
+// postgresPlan decodes the result of EXPLAIN (FORMAT JSON), a single row holding a JSON
+// array with one plan, and returns the plan and its total cost.
+func postgresPlan(rows []map[string]interface{}) (interface{}, *float64, error) {
+	if len(rows) != 1 {
+		return nil, nil, errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("EXPLAIN returned %d rows, want 1", len(rows)), nil)
+	}
+	var data []byte
+	for _, v := range rows[0] {
+		switch v := v.(type) {
+		case []byte:
+			data = v
+		case string:
+			data = []byte(v)
+		}
+	}
+	var plans []map[string]interface{}
+	if err := json.Unmarshal(data, &plans); err != nil || len(plans) == 0 {
+		return nil, nil, errors.NewError(errors.ErrorTypeQuery, "failed to decode EXPLAIN output", err)
+	}
+
+	plan := plans[0]
+	if root, ok := plan["Plan"].(map[string]interface{}); ok {
+		if cost, ok := root["Total Cost"].(float64); ok {
+			return plan, &cost, nil
+		}
+	}
+	return plan, nil, nil
+}
+
+func (qe *QueryExecutor) explainMongo(ctx context.Context, connector *connectors.MongoConnector, query Query) (*Explanation, error) {
+	filter, err := mongoFilter(query.Conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	var command bson.D
+	native := map[string]interface{}{"collection": query.Collection}
+	switch query.Type {
+	case Select:
+		pipeline, ok, err := buildMongoPipeline(query, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			native["command"] = "aggregate"
+			native["pipeline"] = pipeline
+			command = bson.D{{Key: "aggregate", Value: query.Collection}, {Key: "pipeline", Value: pipeline}, {Key: "cursor", Value: bson.D{}}}
+			break
+		}
+		native["command"] = "find"
+		native["filter"] = filter
+		command = bson.D{{Key: "find", Value: query.Collection}, {Key: "filter", Value: filter}}
+	case Insert:
+		// Inserts have no plan.
+		native["command"] = "insert"
+		native["document"] = query.Data
+		return &Explanation{Source: "mongodb", Native: native}, nil
+	case Update:
+		update := map[string]interface{}{"$set": query.Data}
+		native["command"] = "update"
+		native["filter"] = filter
+		native["update"] = update
+		command = bson.D{
+			{Key: "update", Value: query.Collection},
+			{Key: "updates", Value: bson.A{bson.D{{Key: "q", Value: filter}, {Key: "u", Value: update}, {Key: "multi", Value: true}}}},
+		}
+	case Delete:
+		native["command"] = "delete"
+		native["filter"] = filter
+		command = bson.D{
+			{Key: "delete", Value: query.Collection},
+			{Key: "deletes", Value: bson.A{bson.D{{Key: "q", Value: filter}, {Key: "limit", Value: 0}}}},
+		}
+	default:
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, "unsupported query type for MongoDB", nil)
+	}
+
+	plan, err := connector.Explain(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	return &Explanation{Source: "mongodb", Native: native, Plan: plan}, nil
+}
+
+func (qe *QueryExecutor) explainRedis(ctx context.Context, connector *connectors.RedisConnector, query Query) (*Explanation, error) {
+	switch query.Type {
+	case Select:
+		if err := validateInMemory(query); err != nil {
+			return nil, err
+		}
+		// Each key that a pattern matches is read by the command for its type.
+		if connectors.IsRedisPattern(query.Collection) {
+			return &Explanation{Source: "redis", Native: map[string]interface{}{"commands": []redisCommand{{"SCAN", 0, "MATCH", query.Collection}}}, InMemory: true}, nil
+		}
+		keyType, err := connector.Type(ctx, query.Collection)
+		if err != nil {
+			return nil, err
+		}
+		var cmds []redisCommand
+		if cmd := redisReadCommand(query.Collection, keyType); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+		return &Explanation{Source: "redis", Native: map[string]interface{}{"commands": cmds}, InMemory: true}, nil
+	case Insert, Update, Delete:
+		cmds, _, err := redisWriteCommands(ctx, connector, query)
+		if err != nil {
+			return nil, err
+		}
+		return &Explanation{Source: "redis", Native: map[string]interface{}{"commands": cmds}}, nil
+	default:
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, "unsupported query type for Redis", nil)
+	}
+}
+
+// redisReadCommand returns the command that RedisConnector.Query reads a key of the given type
+// with, or nil for a key that does not exist or has a type it cannot read.
+func redisReadCommand(key, keyType string) redisCommand {
+	switch keyType {
+	case connectors.RedisTypeString:
+		return redisCommand{"GET", key}
+	case connectors.RedisTypeHash:
+		return redisCommand{"HGETALL", key}
+	case connectors.RedisTypeList:
+		return redisCommand{"LRANGE", key, 0, -1}
+	case connectors.RedisTypeSet:
+		return redisCommand{"SMEMBERS", key}
+	case connectors.RedisTypeZSet:
+		return redisCommand{"ZRANGE", key, 0, -1, "WITHSCORES"}
+	case connectors.RedisTypeStream:
+		return redisCommand{"XRANGE", key, "-", "+"}
+	case connectors.RedisTypeJSON:
+		return redisCommand{"JSON.GET", key, "$"}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,98 @@
+package query
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"datasource/connectors"
+	"pkg/common/errors"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainSQL(t *testing.T) {
+	executor := NewQueryExecutor(connectors.NewSQLConnector(&connectors.Config{Driver: "mysql"}))
+	explanation, err := executor.Explain(context.Background(), Query{
+		Type:       Update,
+		Collection: "users",
+		Data:       map[string]interface{}{"role": "admin"},
+		Conditions: map[string]interface{}{"id": 7},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &Explanation{
+		Source: "mysql",
+		Native: map[string]interface{}{"sql": "UPDATE users SET role = ? WHERE id = ?", "args": []interface{}{"admin", 7}},
+	}, explanation)
+}
+
+func TestPostgresPlan(t *testing.T) {
+	plan, cost, err := postgresPlan([]map[string]interface{}{{
+		"QUERY PLAN": []byte(`[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "users", "Startup Cost": 0.00, "Total Cost": 35.5, "Plan Rows": 9}}]`),
+	}})
+	require.NoError(t, err)
+	require.NotNil(t, cost)
+	assert.Equal(t, 35.5, *cost)
+	assert.Equal(t, "Seq Scan", plan.(map[string]interface{})["Plan"].(map[string]interface{})["Node Type"])
+
+	_, _, err = postgresPlan([]map[string]interface{}{{"QUERY PLAN": "Seq Scan on users"}})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeQuery))
+}
+
+func TestExplainFile(t *testing.T) {
+	source := newTestFederation(t)["shop"]
+	executor := NewQueryExecutor(source)
+
+	explanation, err := executor.Explain(context.Background(), Query{Type: Select, Collection: "orders.json", Conditions: map[string]interface{}{"status": "paid"}})
+	require.NoError(t, err)
+	assert.True(t, explanation.InMemory)
+	path := explanation.Native["path"].(string)
+	assert.True(t, filepath.IsAbs(path))
+	assert.Equal(t, "orders.json", filepath.Base(path))
+
+	_, err = executor.Explain(context.Background(), Query{Type: Select, Collection: "../orders.json"})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypePermission))
+	_, err = executor.Explain(context.Background(), Query{Type: Select, Collection: "orders.json", GroupBy: []string{"status"}, Aggregations: []Aggregation{{Function: Count}}})
+	require.NoError(t, err)
+	_, err = executor.Explain(context.Background(), Query{Type: Select, Collection: "orders.json", TimeBucket: &TimeBucket{Field: "ts", Interval: "1h"}})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+}
+
+func TestExplainRedis(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	port, err := strconv.Atoi(server.Port())
+	require.NoError(t, err)
+	connector := connectors.NewRedisConnector(&connectors.Config{Host: server.Host(), Port: port})
+	require.NoError(t, connector.Connect(ctx))
+	defer connector.Close(ctx)
+	executor := NewQueryExecutor(connector)
+
+	server.HSet("user:1", "name", "Ada")
+	server.SAdd("tags", "red", "green", "blue")
+
+	explanation, err := executor.Explain(ctx, Query{Type: Select, Collection: "user:1"})
+	require.NoError(t, err)
+	assert.Equal(t, &Explanation{Source: "redis", Native: map[string]interface{}{"commands": []redisCommand{{"HGETALL", "user:1"}}}, InMemory: true}, explanation)
+
+	explanation, err = executor.Explain(ctx, Query{Type: Select, Collection: "user:*"})
+	require.NoError(t, err)
+	assert.Equal(t, []redisCommand{{"SCAN", 0, "MATCH", "user:*"}}, explanation.Native["commands"])
+
+	explanation, err = executor.Explain(ctx, Query{Type: Delete, Collection: "tags", Conditions: map[string]interface{}{"member": "red"}})
+	require.NoError(t, err)
+	assert.Equal(t, []redisCommand{{"SREM", "tags", "red"}}, explanation.Native["commands"])
+
+	explanation, err = executor.Explain(ctx, Query{Type: Update, Collection: "user:1", Data: map[string]interface{}{"name": "Grace"}})
+	require.NoError(t, err)
+	assert.Equal(t, []redisCommand{{"HSET", "user:1", "name", "Grace"}}, explanation.Native["commands"])
+
+	// Nothing was written.
+	assert.Equal(t, "Ada", server.HGet("user:1", "name"))
+	members, err := server.Members("tags")
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+}
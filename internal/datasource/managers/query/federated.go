@@ -0,0 +1,779 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"datasource/connectors"
+	"pkg/common/errors"
+)
+
+// FederatedSourceColumn holds the alias of the source of each row of a union.
+const FederatedSourceColumn = "_source"
+
+// defaultFederatedMemoryLimit bounds the memory of a federated query's intermediate results
+// when no limit is configured.
+const defaultFederatedMemoryLimit = 256 << 20
+
+// joinPartitions is the number of partitions a join whose rows do not fit in memory is split
+// into, and maxJoinDepth how many times a partition may be split again.
+const (
+	joinPartitions = 16
+	maxJoinDepth   = 3
+)
+
+// JoinType selects which rows a join keeps.
+type JoinType string
+
+const (
+	// InnerJoin keeps the rows that match on both sides.
+	InnerJoin JoinType = "inner"
+	// LeftJoin also keeps the rows of the left side that match nothing.
+	LeftJoin JoinType = "left"
+)
+
+// FederatedQuery reads from several connectors and combines their rows in process.
+//
+// The sources are either joined, each in turn to the rows joined so far, or, with Union,
+// concatenated. In a join, fields are named by the source alias and the field, such as
+// "orders.total", and every row holds the fields of all its sources. In a union, fields
+// keep their names and FederatedSourceColumn holds the source of each row.
+//
+// Conditions on a single source are pushed down to it, except on the right side of a left
+// join, and so are the fields the query needs. The remaining conditions, the grouping and
+// aggregations, the ordering and the limit are applied to the combined rows. Conditions may
+// be combined with $and, $or and $nor, which are always applied to the combined rows.
+//
+// Sources that stream their results, such as ClickHouse, are read block by block, so that
+// only MemoryLimit bytes of their rows are held in memory.
+//
+// Example:
+//
+//	{
+//	  "sources": [
+//	    {"alias": "orders", "connector": "shop_db", "collection": "orders"},
+//	    {"alias": "customers", "connector": "crm", "collection": "profiles"}
+//	  ],
+//	  "joins": [{"source": "customers", "on": [{"left": "orders.customer_id", "right": "customers._id"}]}],
+//	  "conditions": {"orders.status": "paid"},
+//	  "group_by": ["customers.country"],
+//	  "aggregations": [{"function": "sum", "field": "orders.total", "alias": "revenue"}],
+//	  "order_by": [{"field": "revenue", "desc": true}]
+//	}
+type FederatedQuery struct {
+	Sources      []FederatedSource      `json:"sources"`
+	Joins        []Join                 `json:"joins,omitempty"`
+	Union        bool                   `json:"union,omitempty"`
+	Fields       []string               `json:"fields,omitempty"`
+	Conditions   map[string]interface{} `json:"conditions,omitempty"`
+	GroupBy      []string               `json:"group_by,omitempty"`
+	Aggregations []Aggregation          `json:"aggregations,omitempty"`
+	OrderBy      []OrderBy              `json:"order_by,omitempty"`
+	Limit        int                    `json:"limit,omitempty"`
+	Offset       int                    `json:"offset,omitempty"`
+}
+
+// FederatedSource is a collection read through a named connector.
+type FederatedSource struct {
+	// Alias names the source in field names and joins. It defaults to the connector name.
+	Alias      string `json:"alias,omitempty"`
+	Connector  string `json:"connector"`
+	Collection string `json:"collection"`
+	// Conditions are applied by the source, on its own unqualified field names.
+	Conditions map[string]interface{} `json:"conditions,omitempty"`
+	// Raw is a native query sent to the source as is, as in Query.Raw.
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+// Join joins a source to the rows joined so far.
+type Join struct {
+	// Source is the alias of the joined source.
+	Source string `json:"source"`
+	// Type defaults to InnerJoin.
+	Type JoinType `json:"type,omitempty"`
+	// On lists the fields that must be equal. Left is a field of a source joined earlier,
+	// and Right a field of the joined source.
+	On []JoinOn `json:"on"`
+}
+
+// JoinOn is a pair of fields a join matches on.
+type JoinOn struct {
+	Left  string `json:"left"`
+	Right string `json:"right"`
+}
+
+// FederatedPlan is how a federated query is run: the query sent to each source, after
+// pushdown, and the conditions left to apply to the combined rows.
+type FederatedPlan struct {
+	Sources []PlannedSource `json:"sources"`
+	// Conditions are applied after the sources are combined.
+	Conditions map[string]interface{} `json:"conditions,omitempty"`
+}
+
+// PlannedSource is the query sent to one source.
+type PlannedSource struct {
+	Alias     string `json:"alias"`
+	Connector string `json:"connector"`
+	Query     Query  `json:"query"`
+	// Policies are the policies of the source's connector. Which of them apply depends on
+	// the caller, so their conditions are not part of Query.
+	Policies []string `json:"policies,omitempty"`
+}
+
+// ConnectorResolver looks up connectors by name. *manager.ConnectorManager implements it.
+type ConnectorResolver interface {
+	GetConnector(name string) (connectors.Connector, error)
+}
+
+// FederationOptions configures a FederatedExecutor.
+type FederationOptions struct {
+	// MemoryLimit bounds, in bytes, the rows each query holds in memory; larger intermediate
+	// results are spilled to disk. Defaults to 256 MiB.
+	MemoryLimit int64
+	// SpillDir is the directory of spill files. Defaults to the system temporary directory.
+	SpillDir string
+	// Policies are enforced on the query sent to each source, as QueryExecutor enforces them.
+	Policies *PolicySet
+}
+
+// FederatedExecutor runs federated queries across the connectors of a resolver.
+type FederatedExecutor struct {
+	resolver ConnectorResolver
+	options  FederationOptions
+}
+
+// NewFederatedExecutor creates a new FederatedExecutor
+func NewFederatedExecutor(resolver ConnectorResolver, options FederationOptions) *FederatedExecutor {
+	if options.MemoryLimit <= 0 {
+		options.MemoryLimit = defaultFederatedMemoryLimit
+	}
+	if options.SpillDir == "" {
+		options.SpillDir = os.TempDir()
+	}
+	return &FederatedExecutor{resolver: resolver, options: options}
+}
+
+// fieldRef is a field of a source.
+type fieldRef struct {
+	alias string
+	field string
+}
+
+// federatedPlan is a validated federated query and its plan.
+type federatedPlan struct {
+	FederatedPlan
+	query FederatedQuery
+	// joins holds the join keys of each join, by source.
+	joins []plannedJoin
+}
+
+type plannedJoin struct {
+	source   int
+	joinType JoinType
+	left     []string
+	right    []string
+}
+
+// Plan validates a federated query and returns the queries it sends to each source.
+func (e *FederatedExecutor) Plan(fq FederatedQuery) (*FederatedPlan, error) {
+	plan, err := planFederated(fq)
+	if err != nil {
+		return nil, err
+	}
+	for i, src := range plan.Sources {
+		plan.Sources[i].Policies = policyNames(e.options.Policies.For(src.Connector))
+	}
+	return &plan.FederatedPlan, nil
+}
+
+func planFederated(fq FederatedQuery) (*federatedPlan, error) {
+	if len(fq.Sources) == 0 {
+		return nil, errors.NewError(errors.ErrorTypeValidation, "a federated query requires at least one source", nil)
+	}
+	if fq.Union && len(fq.Joins) > 0 {
+		return nil, errors.NewError(errors.ErrorTypeValidation, "a federated query cannot both join and union its sources", nil)
+	}
+	for _, agg := range fq.Aggregations {
+		if err := validateAggregation(agg); err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &federatedPlan{query: fq}
+	aliases := make(map[string]int, len(fq.Sources))
+	for i, src := range fq.Sources {
+		if src.Connector == "" {
+			return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("source %d has no connector", i), nil)
+		}
+		alias := src.Alias
+		if alias == "" {
+			alias = src.Connector
+		}
+		if strings.Contains(alias, ".") {
+			return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("source alias %s contains a dot", alias), nil)
+		}
+		if _, ok := aliases[alias]; ok {
+			return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("duplicate source alias %s", alias), nil)
+		}
+		aliases[alias] = i
+		conditions := make(map[string]interface{}, len(src.Conditions))
+		for k, v := range src.Conditions {
+			conditions[k] = v
+		}
+		plan.Sources = append(plan.Sources, PlannedSource{
+			Alias:     alias,
+			Connector: src.Connector,
+			Query:     Query{Type: Select, Collection: src.Collection, Conditions: conditions, Raw: src.Raw},
+		})
+	}
+
+	if fq.Union {
+		return planUnion(plan)
+	}
+
+	// resolve splits a qualified field into its source and field.
+	resolve := func(name string) (fieldRef, error) {
+		alias, field, ok := strings.Cut(name, ".")
+		if _, known := aliases[alias]; !ok || !known || field == "" {
+			return fieldRef{}, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("field %s must be qualified by a source alias, as in alias.field", name), nil)
+		}
+		return fieldRef{alias: alias, field: field}, nil
+	}
+
+	// Sources on the right of a left join keep their rows, so filtering them early would
+	// change the result.
+	pushable := map[string]bool{plan.Sources[0].Alias: true}
+	joined := map[string]bool{plan.Sources[0].Alias: true}
+	needed := make(map[string]map[string]bool)
+	need := func(ref fieldRef) {
+		if needed[ref.alias] == nil {
+			needed[ref.alias] = make(map[string]bool)
+		}
+		needed[ref.alias][ref.field] = true
+	}
+
+	for _, join := range fq.Joins {
+		i, ok := aliases[join.Source]
+		if !ok {
+			return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("join of unknown source %s", join.Source), nil)
+		}
+		if joined[join.Source] {
+			return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("source %s is joined twice", join.Source), nil)
+		}
+		if len(join.On) == 0 {
+			return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("join of %s has no fields to match", join.Source), nil)
+		}
+		joinType := join.Type
+		switch joinType {
+		case "":
+			joinType = InnerJoin
+		case InnerJoin, LeftJoin:
+		default:
+			return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("unsupported join type %s", join.Type), nil)
+		}
+
+		pj := plannedJoin{source: i, joinType: joinType}
+		for _, on := range join.On {
+			left, err := resolve(on.Left)
+			if err != nil {
+				return nil, err
+			}
+			if !joined[left.alias] || left.alias == join.Source {
+				return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("%s must be a field of a source joined before %s", on.Left, join.Source), nil)
+			}
+			right := fieldRef{alias: join.Source, field: on.Right}
+			if alias, field, ok := strings.Cut(on.Right, "."); ok && alias == join.Source {
+				right.field = field
+			}
+			need(left)
+			need(right)
+			pj.left = append(pj.left, on.Left)
+			pj.right = append(pj.right, right.alias+"."+right.field)
+		}
+		plan.joins = append(plan.joins, pj)
+		joined[join.Source] = true
+		pushable[join.Source] = joinType == InnerJoin
+	}
+	if len(joined) != len(fq.Sources) {
+		return nil, errors.NewError(errors.ErrorTypeValidation, "every source after the first must be joined", nil)
+	}
+
+	for name, value := range fq.Conditions {
+		if isLogicalOperator(name) {
+			// A logical operator may combine fields of several sources, so it is applied
+			// to the combined rows.
+			err := conditionFields(map[string]interface{}{name: value}, func(field string) error {
+				ref, err := resolve(field)
+				if err != nil {
+					return err
+				}
+				need(ref)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			if plan.Conditions == nil {
+				plan.Conditions = make(map[string]interface{})
+			}
+			plan.Conditions[name] = value
+			continue
+		}
+		ref, err := resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		src := &plan.Sources[aliases[ref.alias]]
+		if _, taken := src.Query.Conditions[ref.field]; pushable[ref.alias] && !taken {
+			src.Query.Conditions[ref.field] = value
+			continue
+		}
+		if plan.Conditions == nil {
+			plan.Conditions = make(map[string]interface{})
+		}
+		plan.Conditions[name] = value
+		need(ref)
+	}
+	if _, err := parseRowFilter(plan.Conditions); err != nil {
+		return nil, err
+	}
+
+	projected := len(fq.Fields) > 0 || len(fq.GroupBy) > 0 || len(fq.Aggregations) > 0
+	outputs := make(map[string]bool)
+	for _, agg := range fq.Aggregations {
+		outputs[agg.Name()] = true
+		if agg.Field != "" && agg.Field != "*" {
+			ref, err := resolve(agg.Field)
+			if err != nil {
+				return nil, err
+			}
+			need(ref)
+		}
+	}
+	for _, name := range append(append([]string(nil), fq.Fields...), fq.GroupBy...) {
+		if outputs[name] {
+			continue
+		}
+		ref, err := resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		need(ref)
+	}
+	for _, o := range fq.OrderBy {
+		if outputs[o.Field] {
+			continue
+		}
+		ref, err := resolve(o.Field)
+		if err != nil {
+			return nil, err
+		}
+		need(ref)
+	}
+
+	for i := range plan.Sources {
+		src := &plan.Sources[i]
+		if projected {
+			src.Query.Fields = sortedSet(needed[src.Alias])
+		}
+		if len(src.Query.Conditions) == 0 {
+			src.Query.Conditions = nil
+		}
+	}
+	// A lone source can also sort and limit its rows.
+	if len(fq.Sources) == 1 && len(plan.Conditions) == 0 && len(fq.GroupBy) == 0 && len(fq.Aggregations) == 0 && fq.Limit > 0 {
+		src := &plan.Sources[0]
+		src.Query.Limit = fq.Limit + fq.Offset
+		for _, o := range fq.OrderBy {
+			src.Query.OrderBy = append(src.Query.OrderBy, OrderBy{Field: strings.TrimPrefix(o.Field, src.Alias+"."), Desc: o.Desc})
+		}
+	}
+	return plan, nil
+}
+
+// planUnion pushes every condition and needed field down to all the sources of a union,
+// except conditions on FederatedSourceColumn and logical operators, which are applied to
+// the combined rows.
+func planUnion(plan *federatedPlan) (*federatedPlan, error) {
+	fq := plan.query
+	if _, err := parseRowFilter(fq.Conditions); err != nil {
+		return nil, err
+	}
+	post := make(map[string]interface{})
+	for k, v := range fq.Conditions {
+		if k == FederatedSourceColumn || isLogicalOperator(k) {
+			post[k] = v
+		}
+	}
+
+	outputs := make(map[string]bool)
+	needed := make(map[string]bool)
+	for _, agg := range fq.Aggregations {
+		outputs[agg.Name()] = true
+		if agg.Field != "" && agg.Field != "*" {
+			needed[agg.Field] = true
+		}
+	}
+	for _, name := range append(append([]string(nil), fq.Fields...), fq.GroupBy...) {
+		needed[name] = true
+	}
+	for _, o := range fq.OrderBy {
+		if !outputs[o.Field] {
+			needed[o.Field] = true
+		}
+	}
+	projected := len(fq.Fields) > 0 || len(fq.GroupBy) > 0 || len(fq.Aggregations) > 0
+	if projected {
+		conditionFields(post, func(field string) error {
+			needed[field] = true
+			return nil
+		})
+	}
+	delete(needed, FederatedSourceColumn)
+
+	for i := range plan.Sources {
+		src := &plan.Sources[i]
+		for k, v := range fq.Conditions {
+			if _, ok := post[k]; ok {
+				continue
+			}
+			if _, taken := src.Query.Conditions[k]; taken {
+				return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("condition on %s conflicts with a condition of source %s", k, src.Alias), nil)
+			}
+			src.Query.Conditions[k] = v
+		}
+		if len(src.Query.Conditions) == 0 {
+			src.Query.Conditions = nil
+		}
+		if projected {
+			src.Query.Fields = sortedSet(needed)
+		}
+		// Conditions on the source column keep or drop whole sources, so they do not stop
+		// a limit from being pushed down, but logical operators filter rows.
+		if len(fq.OrderBy) == 0 && len(fq.GroupBy) == 0 && len(fq.Aggregations) == 0 && fq.Limit > 0 && !filtersRows(post) {
+			src.Query.Limit = fq.Limit + fq.Offset
+		}
+	}
+	if len(post) > 0 {
+		plan.Conditions = post
+	}
+	return plan, nil
+}
+
+// filtersRows reports whether conditions on the combined rows of a union may drop some of
+// the rows of a source.
+func filtersRows(post map[string]interface{}) bool {
+	for k := range post {
+		if k != FederatedSourceColumn {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedSet returns the members of set in sorted order.
+func sortedSet(set map[string]bool) []string {
+	members := make([]string, 0, len(set))
+	for k := range set {
+		members = append(members, k)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Execute runs a federated query: it reads each source with its pushed-down query, combines
+// the rows, and applies the rest of the query to them.
+func (e *FederatedExecutor) Execute(ctx context.Context, fq FederatedQuery) ([]map[string]interface{}, error) {
+	plan, err := planFederated(fq)
+	if err != nil {
+		return nil, err
+	}
+	run := &federatedRun{budget: &memoryBudget{limit: e.options.MemoryLimit}, dir: e.options.SpillDir}
+	defer run.close()
+
+	sources := make([]*rowSpool, len(plan.Sources))
+	for i, src := range plan.Sources {
+		connector, err := e.resolver.GetConnector(src.Connector)
+		if err != nil {
+			return nil, err
+		}
+		it, err := NewQueryExecutor(connector).WithPolicies(e.options.Policies.For(src.Connector)).Stream(ctx, src.Query)
+		if errors.IsErrorType(err, errors.ErrorTypePermission) {
+			return nil, errors.NewError(errors.ErrorTypePermission, fmt.Sprintf("source %s is restricted", src.Alias), err)
+		}
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("failed to query source %s", src.Alias), err)
+		}
+
+		if fq.Union && i > 0 {
+			sources[i] = sources[0]
+		} else {
+			sources[i] = run.spool()
+		}
+		err = spoolSource(ctx, it, sources[i], func(row map[string]interface{}) map[string]interface{} {
+			out := make(map[string]interface{}, len(row)+1)
+			if fq.Union {
+				for k, v := range row {
+					out[k] = v
+				}
+				out[FederatedSourceColumn] = src.Alias
+			} else {
+				for k, v := range row {
+					out[src.Alias+"."+k] = v
+				}
+			}
+			return out
+		})
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeQuery, fmt.Sprintf("failed to query source %s", src.Alias), err)
+		}
+	}
+
+	combined := sources[0]
+	for _, join := range plan.joins {
+		joined, err := run.join(ctx, combined, sources[join.source], join, 0)
+		if err != nil {
+			return nil, err
+		}
+		combined.close()
+		sources[join.source].close()
+		combined = joined
+	}
+
+	filter, err := parseRowFilter(plan.Conditions)
+	if err != nil {
+		return nil, err
+	}
+	filtered := run.spool()
+	if len(fq.GroupBy) > 0 || len(fq.Aggregations) > 0 {
+		add, results := aggregateRows(fq.GroupBy, fq.Aggregations, run.budget)
+		err := combined.each(func(row map[string]interface{}) error {
+			if !filter.matches(row) {
+				return nil
+			}
+			return add(row)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range results() {
+			if err := filtered.add(row); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		err := combined.each(func(row map[string]interface{}) error {
+			if err := ctx.Err(); err != nil {
+				return errors.NewError(errors.ErrorTypeTimeout, "federated query canceled", err)
+			}
+			if !filter.matches(row) {
+				return nil
+			}
+			return filtered.add(row)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var fields []string
+	if len(fq.Fields) > 0 {
+		fields = append(fields, fq.Fields...)
+		for _, agg := range fq.Aggregations {
+			fields = append(fields, agg.Name())
+		}
+	}
+	var results []map[string]interface{}
+	skipped := 0
+	errDone := fmt.Errorf("limit reached")
+	emit := func(row map[string]interface{}) error {
+		if skipped < fq.Offset {
+			skipped++
+			return nil
+		}
+		if fq.Limit > 0 && len(results) >= fq.Limit {
+			return errDone
+		}
+		if fields != nil {
+			projected := make(map[string]interface{}, len(fields))
+			for _, field := range fields {
+				if v, ok := row[field]; ok {
+					projected[field] = v
+				}
+			}
+			row = projected
+		}
+		results = append(results, row)
+		return nil
+	}
+	if len(fq.OrderBy) > 0 {
+		err = sortedEach(filtered, fq.OrderBy, emit)
+	} else {
+		err = filtered.each(emit)
+	}
+	if err != nil && err != errDone {
+		return nil, err
+	}
+	return results, nil
+}
+
+// spoolSource adds the rows of a source to a spool as they are read, converted by fn, so that
+// sources that stream their results are bounded by the memory limit. It closes the iterator.
+func spoolSource(ctx context.Context, it connectors.RowIterator, spool *rowSpool, fn func(map[string]interface{}) map[string]interface{}) error {
+	defer it.Close()
+	for {
+		rows, err := it.Next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := spool.add(fn(row)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// federatedRun holds the intermediate results of a federated query.
+type federatedRun struct {
+	budget *memoryBudget
+	dir    string
+	spools []*rowSpool
+}
+
+func (r *federatedRun) spool() *rowSpool {
+	s := newRowSpool(r.budget, r.dir)
+	r.spools = append(r.spools, s)
+	return s
+}
+
+func (r *federatedRun) close() {
+	for _, s := range r.spools {
+		s.close()
+	}
+}
+
+// join hash joins right to left. If right does not fit in memory, both sides are split into
+// partitions by the hash of their keys, and the partitions are joined pairwise; a partition
+// that still does not fit is split again, up to maxJoinDepth times.
+func (r *federatedRun) join(ctx context.Context, left, right *rowSpool, join plannedJoin, depth int) (*rowSpool, error) {
+	out := r.spool()
+	emitUnmatched := func(row map[string]interface{}) error {
+		if join.joinType == LeftJoin {
+			return out.add(row)
+		}
+		return nil
+	}
+
+	if !right.spilled() {
+		table := make(map[string][]map[string]interface{})
+		err := right.each(func(row map[string]interface{}) error {
+			if key, ok := joinKey(row, join.right); ok {
+				table[key] = append(table[key], row)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = left.each(func(row map[string]interface{}) error {
+			if err := ctx.Err(); err != nil {
+				return errors.NewError(errors.ErrorTypeTimeout, "federated query canceled", err)
+			}
+			key, ok := joinKey(row, join.left)
+			matches := table[key]
+			if !ok || len(matches) == 0 {
+				return emitUnmatched(row)
+			}
+			for _, match := range matches {
+				joined := make(map[string]interface{}, len(row)+len(match))
+				for k, v := range row {
+					joined[k] = v
+				}
+				for k, v := range match {
+					joined[k] = v
+				}
+				if err := out.add(joined); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return out, err
+	}
+
+	if depth >= maxJoinDepth {
+		return nil, errors.NewError(errors.ErrorTypeResourceExhausted, "join keys are too skewed to join within the memory limit", nil)
+	}
+	partition := func(s *rowSpool, keys []string, unmatched func(map[string]interface{}) error) ([]*rowSpool, error) {
+		parts := make([]*rowSpool, joinPartitions)
+		for i := range parts {
+			parts[i] = r.spool()
+			if err := parts[i].spill(); err != nil {
+				return nil, err
+			}
+		}
+		err := s.each(func(row map[string]interface{}) error {
+			key, ok := joinKey(row, keys)
+			if !ok {
+				return unmatched(row)
+			}
+			h := fnv.New32a()
+			h.Write([]byte{byte(depth)})
+			h.Write([]byte(key))
+			return parts[h.Sum32()%joinPartitions].add(row)
+		})
+		return parts, err
+	}
+	rightParts, err := partition(right, join.right, func(map[string]interface{}) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+	leftParts, err := partition(left, join.left, emitUnmatched)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rightParts {
+		// Reload the right partition, so that it is held in memory if it fits.
+		build := r.spool()
+		if err := rightParts[i].each(build.add); err != nil {
+			return nil, err
+		}
+		rightParts[i].close()
+		joined, err := r.join(ctx, leftParts[i], build, join, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		build.close()
+		leftParts[i].close()
+		if err := joined.each(out.add); err != nil {
+			return nil, err
+		}
+		joined.close()
+	}
+	return out, nil
+}
+
+// joinKey returns the hash key of the join fields of a row, and false if any is null.
+func joinKey(row map[string]interface{}, fields []string) (string, bool) {
+	var key strings.Builder
+	for _, field := range fields {
+		v := row[field]
+		if v == nil {
+			return "", false
+		}
+		key.WriteString(valueKey(v))
+		key.WriteByte(0)
+	}
+	return key.String(), true
+}
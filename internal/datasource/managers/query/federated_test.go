@@ -0,0 +1,322 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"datasource/connectors"
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testResolver resolves connectors from a map.
+type testResolver map[string]connectors.Connector
+
+func (r testResolver) GetConnector(name string) (connectors.Connector, error) {
+	c, ok := r[name]
+	if !ok {
+		return nil, errors.NewError(errors.ErrorTypeNotFound, fmt.Sprintf("connector '%s' not found", name), nil)
+	}
+	return c, nil
+}
+
+// newFileSource returns a file connector whose base path holds the given files.
+func newFileSource(t *testing.T, files map[string]string) connectors.Connector {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	connector := connectors.NewFileConnector(&connectors.Config{BasePath: dir})
+	require.NoError(t, connector.Connect(context.Background()))
+	return connector
+}
+
+func newTestFederation(t *testing.T) testResolver {
+	return testResolver{
+		"shop": newFileSource(t, map[string]string{"orders.json": `[
+			{"id": 1, "customer_id": "c1", "status": "paid", "total": 30},
+			{"id": 2, "customer_id": "c2", "status": "paid", "total": 12.5},
+			{"id": 3, "customer_id": "c1", "status": "refunded", "total": 8},
+			{"id": 4, "customer_id": "c3", "status": "paid", "total": 5},
+			{"id": 5, "customer_id": null, "status": "paid", "total": 1}
+		]`}),
+		"crm": newFileSource(t, map[string]string{"customers.csv": "id,name,country\nc1,Ada,NG\nc2,Grace,GH\nc9,Linus,FI\n"}),
+		"legacy": newFileSource(t, map[string]string{"orders.json": `[
+			{"id": 100, "customer_id": "c2", "status": "paid", "total": 40}
+		]`}),
+	}
+}
+
+// asJSON re-encodes rows, so that rows read back from spill files compare equal to rows that
+// stayed in memory.
+func asJSON(t *testing.T, rows []map[string]interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(rows)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func revenueByCountry() FederatedQuery {
+	return FederatedQuery{
+		Sources: []FederatedSource{
+			{Alias: "orders", Connector: "shop", Collection: "orders.json"},
+			{Alias: "customers", Connector: "crm", Collection: "customers.csv"},
+		},
+		Joins:        []Join{{Source: "customers", On: []JoinOn{{Left: "orders.customer_id", Right: "id"}}}},
+		Conditions:   map[string]interface{}{"orders.status": "paid", "customers.country": map[string]interface{}{"$ne": "FI"}},
+		GroupBy:      []string{"customers.country"},
+		Aggregations: []Aggregation{{Function: Sum, Field: "orders.total", Alias: "revenue"}, {Function: Count}},
+		OrderBy:      []OrderBy{{Field: "revenue", Desc: true}},
+	}
+}
+
+func TestFederatedJoinAggregation(t *testing.T) {
+	executor := NewFederatedExecutor(newTestFederation(t), FederationOptions{})
+
+	plan, err := executor.Plan(revenueByCountry())
+	require.NoError(t, err)
+	assert.Equal(t, Query{
+		Type:       Select,
+		Collection: "orders.json",
+		Fields:     []string{"customer_id", "total"},
+		Conditions: map[string]interface{}{"status": "paid"},
+	}, plan.Sources[0].Query)
+	assert.Equal(t, Query{
+		Type:       Select,
+		Collection: "customers.csv",
+		Fields:     []string{"country", "id"},
+		Conditions: map[string]interface{}{"country": map[string]interface{}{"$ne": "FI"}},
+	}, plan.Sources[1].Query)
+	assert.Empty(t, plan.Conditions)
+
+	rows, err := executor.Execute(context.Background(), revenueByCountry())
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"customers.country": "NG", "revenue": 30.0, "count": int64(1)},
+		{"customers.country": "GH", "revenue": 12.5, "count": int64(1)},
+	}, rows)
+}
+
+func TestFederatedLeftJoin(t *testing.T) {
+	executor := NewFederatedExecutor(newTestFederation(t), FederationOptions{})
+	fq := FederatedQuery{
+		Sources: []FederatedSource{
+			{Alias: "orders", Connector: "shop", Collection: "orders.json"},
+			{Alias: "customers", Connector: "crm", Collection: "customers.csv"},
+		},
+		Joins:      []Join{{Source: "customers", Type: LeftJoin, On: []JoinOn{{Left: "orders.customer_id", Right: "customers.id"}}}},
+		Conditions: map[string]interface{}{"customers.name": map[string]interface{}{"$exists": false}},
+		Fields:     []string{"orders.id", "customers.name"},
+		OrderBy:    []OrderBy{{Field: "orders.id"}},
+	}
+
+	// Conditions on the right side of a left join are applied after the join.
+	plan, err := executor.Plan(fq)
+	require.NoError(t, err)
+	assert.Nil(t, plan.Sources[1].Query.Conditions)
+	assert.Equal(t, fq.Conditions, plan.Conditions)
+
+	rows, err := executor.Execute(context.Background(), fq)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"orders.id": 4.0}, {"orders.id": 5.0}}, rows)
+}
+
+func TestFederatedUnion(t *testing.T) {
+	executor := NewFederatedExecutor(newTestFederation(t), FederationOptions{})
+	fq := FederatedQuery{
+		Sources: []FederatedSource{
+			{Connector: "shop", Collection: "orders.json"},
+			{Connector: "legacy", Collection: "orders.json"},
+		},
+		Union:      true,
+		Conditions: map[string]interface{}{"customer_id": "c2"},
+		Fields:     []string{"id", FederatedSourceColumn},
+		Limit:      5,
+	}
+
+	plan, err := executor.Plan(fq)
+	require.NoError(t, err)
+	for _, src := range plan.Sources {
+		assert.Equal(t, map[string]interface{}{"customer_id": "c2"}, src.Query.Conditions)
+		assert.Equal(t, []string{"id"}, src.Query.Fields)
+		assert.Equal(t, 5, src.Query.Limit)
+	}
+
+	rows, err := executor.Execute(context.Background(), fq)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"id": 2.0, "_source": "shop"},
+		{"id": 100.0, "_source": "legacy"},
+	}, rows)
+}
+
+func TestFederatedLogicalConditions(t *testing.T) {
+	executor := NewFederatedExecutor(newTestFederation(t), FederationOptions{})
+	either := []interface{}{
+		map[string]interface{}{"orders.total": map[string]interface{}{"$gte": 20}},
+		map[string]interface{}{"customers.country": "GH"},
+	}
+	fq := FederatedQuery{
+		Sources: []FederatedSource{
+			{Alias: "orders", Connector: "shop", Collection: "orders.json"},
+			{Alias: "customers", Connector: "crm", Collection: "customers.csv"},
+		},
+		Joins:      []Join{{Source: "customers", On: []JoinOn{{Left: "orders.customer_id", Right: "id"}}}},
+		Conditions: map[string]interface{}{"$or": either},
+		Fields:     []string{"orders.id"},
+		OrderBy:    []OrderBy{{Field: "orders.id"}},
+	}
+
+	// A condition across sources is applied after the join, and its fields are read.
+	plan, err := executor.Plan(fq)
+	require.NoError(t, err)
+	assert.Equal(t, fq.Conditions, plan.Conditions)
+	assert.Equal(t, []string{"customer_id", "id", "total"}, plan.Sources[0].Query.Fields)
+	assert.Equal(t, []string{"country", "id"}, plan.Sources[1].Query.Fields)
+
+	rows, err := executor.Execute(context.Background(), fq)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"orders.id": 1.0}, {"orders.id": 2.0}}, rows)
+
+	union := FederatedQuery{
+		Sources: []FederatedSource{
+			{Connector: "shop", Collection: "orders.json"},
+			{Connector: "legacy", Collection: "orders.json"},
+		},
+		Union: true,
+		Conditions: map[string]interface{}{"$nor": []interface{}{
+			map[string]interface{}{"status": "refunded"},
+			map[string]interface{}{"total": map[string]interface{}{"$gte": 10}},
+		}},
+		Fields: []string{"id"},
+		Limit:  5,
+	}
+	plan, err = executor.Plan(union)
+	require.NoError(t, err)
+	for _, src := range plan.Sources {
+		assert.Nil(t, src.Query.Conditions)
+		assert.Equal(t, []string{"id", "status", "total"}, src.Query.Fields)
+		assert.Zero(t, src.Query.Limit)
+	}
+	rows, err = executor.Execute(context.Background(), union)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"id": 4.0}, {"id": 5.0}}, rows)
+}
+
+func TestFederatedJoinIntegerKeys(t *testing.T) {
+	// Above 2^53, neighbouring integers are the same float.
+	resolver := testResolver{
+		"accounts": newFileSource(t, map[string]string{"accounts.csv": "id,name\n9007199254740993,odd\n9007199254740992,even\n"}),
+		"ledger":   newFileSource(t, map[string]string{"entries.csv": "account,amount\n9007199254740993,7\n"}),
+	}
+	fq := FederatedQuery{
+		Sources: []FederatedSource{
+			{Alias: "e", Connector: "ledger", Collection: "entries.csv"},
+			{Alias: "a", Connector: "accounts", Collection: "accounts.csv"},
+		},
+		Joins:  []Join{{Source: "a", On: []JoinOn{{Left: "e.account", Right: "id"}}}},
+		Fields: []string{"a.name"},
+	}
+	rows, err := NewFederatedExecutor(resolver, FederationOptions{}).Execute(context.Background(), fq)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"a.name": "odd"}}, rows)
+
+	assert.NotEqual(t, valueKey(int64(1<<53)), valueKey(int64(1<<53+1)))
+	assert.NotEqual(t, valueKey(uint64(1<<63)), valueKey(uint64(1<<63+1)))
+	for _, v := range []interface{}{1.0, int32(1), json.Number("1"), "1", uint8(1)} {
+		assert.Equal(t, valueKey(1), valueKey(v), "%T", v)
+	}
+	assert.Equal(t, valueKey(2.5), valueKey(json.Number("2.5")))
+}
+
+func TestFederatedSpill(t *testing.T) {
+	resolver := newTestFederation(t)
+	fq := FederatedQuery{
+		Sources: []FederatedSource{
+			{Alias: "orders", Connector: "shop", Collection: "orders.json"},
+			{Alias: "customers", Connector: "crm", Collection: "customers.csv"},
+		},
+		Joins:   []Join{{Source: "customers", On: []JoinOn{{Left: "orders.customer_id", Right: "id"}}}},
+		OrderBy: []OrderBy{{Field: "customers.name"}, {Field: "orders.total", Desc: true}},
+		Offset:  1,
+	}
+	inMemory, err := NewFederatedExecutor(resolver, FederationOptions{}).Execute(context.Background(), fq)
+	require.NoError(t, err)
+	require.Len(t, inMemory, 2)
+
+	// With a budget of a few rows, sources, joins and sorts spill to disk.
+	spillDir := t.TempDir()
+	spilled, err := NewFederatedExecutor(resolver, FederationOptions{MemoryLimit: 600, SpillDir: spillDir}).Execute(context.Background(), fq)
+	require.NoError(t, err)
+	assert.JSONEq(t, asJSON(t, inMemory), asJSON(t, spilled))
+	entries, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "spill files are removed")
+
+	// Groups are not spilled.
+	_, err = NewFederatedExecutor(resolver, FederationOptions{MemoryLimit: 1, SpillDir: spillDir}).Execute(context.Background(), revenueByCountry())
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeResourceExhausted), "%v", err)
+}
+
+func TestSortedEachMergesRuns(t *testing.T) {
+	budget := &memoryBudget{limit: 1000}
+	spool := newRowSpool(budget, t.TempDir())
+	defer spool.close()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, spool.add(map[string]interface{}{"n": (i * 37) % 100, "i": i}))
+	}
+	require.True(t, spool.spilled())
+
+	var got []int
+	err := sortedEach(spool, []OrderBy{{Field: "n", Desc: true}}, func(row map[string]interface{}) error {
+		n, err := row["n"].(json.Number).Int64()
+		got = append(got, int(n))
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 100)
+	for i, n := range got {
+		assert.Equal(t, 99-i, n)
+	}
+	assert.Zero(t, budget.used)
+}
+
+func TestFederatedQueryValidation(t *testing.T) {
+	executor := NewFederatedExecutor(newTestFederation(t), FederationOptions{})
+	orders := FederatedSource{Alias: "orders", Connector: "shop", Collection: "orders.json"}
+	customers := FederatedSource{Alias: "customers", Connector: "crm", Collection: "customers.csv"}
+	on := []JoinOn{{Left: "orders.customer_id", Right: "id"}}
+
+	tests := []struct {
+		name string
+		fq   FederatedQuery
+	}{
+		{"No sources", FederatedQuery{}},
+		{"Duplicate alias", FederatedQuery{Sources: []FederatedSource{orders, orders}, Joins: []Join{{Source: "orders", On: on}}}},
+		{"Unjoined source", FederatedQuery{Sources: []FederatedSource{orders, customers}}},
+		{"Unqualified field", FederatedQuery{Sources: []FederatedSource{orders}, Fields: []string{"total"}}},
+		{"Join on later source", FederatedQuery{Sources: []FederatedSource{orders, customers}, Joins: []Join{{Source: "customers", On: []JoinOn{{Left: "customers.id", Right: "id"}}}}}},
+		{"Unknown join type", FederatedQuery{Sources: []FederatedSource{orders, customers}, Joins: []Join{{Source: "customers", Type: "outer", On: on}}}},
+		{"Join and union", FederatedQuery{Sources: []FederatedSource{orders, customers}, Union: true, Joins: []Join{{Source: "customers", On: on}}}},
+		{"Sum without field", FederatedQuery{Sources: []FederatedSource{orders}, Aggregations: []Aggregation{{Function: Sum}}}},
+		{"Or without a list", FederatedQuery{Sources: []FederatedSource{orders}, Conditions: map[string]interface{}{"$or": map[string]interface{}{"orders.id": 1}}}},
+		{"Or with unqualified field", FederatedQuery{Sources: []FederatedSource{orders}, Conditions: map[string]interface{}{"$or": []interface{}{map[string]interface{}{"id": 1}}}}},
+		{"Unsupported operator in or", FederatedQuery{Sources: []FederatedSource{orders}, Conditions: map[string]interface{}{"$or": []interface{}{map[string]interface{}{"orders.id": map[string]interface{}{"$near": 1}}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executor.Execute(context.Background(), tt.fq)
+			assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation), "%v", err)
+		})
+	}
+
+	_, err := executor.Execute(context.Background(), FederatedQuery{Sources: []FederatedSource{{Connector: "missing"}}})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+}
@@ -0,0 +1,125 @@
+package query
+
+import (
+	"math"
+	"sort"
+
+	"pkg/common/errors"
+)
+
+// filterRows applies a query's conditions, grouping and aggregations, ordering, offset,
+// limit and field selection to rows that were read in full, for connectors whose sources
+// cannot filter themselves.
+func filterRows(rows []map[string]interface{}, query Query) ([]map[string]interface{}, error) {
+	if query.TimeBucket != nil {
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, "time buckets are not supported for this connector", nil)
+	}
+	for _, agg := range query.Aggregations {
+		if err := validateAggregation(agg); err != nil {
+			return nil, err
+		}
+	}
+
+	filter, err := parseRowFilter(query.Conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []map[string]interface{}
+	for _, row := range rows {
+		if filter.matches(row) {
+			results = append(results, row)
+		}
+	}
+
+	fields := query.Fields
+	if len(query.GroupBy) > 0 || len(query.Aggregations) > 0 {
+		// The rows are already in memory, so their groups are not bounded.
+		add, groups := aggregateRows(query.GroupBy, query.Aggregations, &memoryBudget{limit: math.MaxInt64})
+		for _, row := range results {
+			if err := add(row); err != nil {
+				return nil, err
+			}
+		}
+		results = groups()
+		if len(fields) > 0 {
+			fields = append([]string(nil), fields...)
+			for _, agg := range query.Aggregations {
+				fields = append(fields, agg.Name())
+			}
+		}
+	}
+
+	if len(query.OrderBy) > 0 {
+		sortRows(results, query.OrderBy)
+	}
+
+	if query.Offset > 0 {
+		if query.Offset >= len(results) {
+			return nil, nil
+		}
+		results = results[query.Offset:]
+	}
+	if query.Limit > 0 && query.Limit < len(results) {
+		results = results[:query.Limit]
+	}
+
+	if len(fields) > 0 {
+		for i, row := range results {
+			projected := make(map[string]interface{}, len(fields))
+			for _, field := range fields {
+				if v, ok := row[field]; ok {
+					projected[field] = v
+				}
+			}
+			results[i] = projected
+		}
+	}
+
+	return results, nil
+}
+
+// matchesConditions reports whether row satisfies every condition.
+func matchesConditions(row map[string]interface{}, conditions []condition) bool {
+	for _, c := range conditions {
+		if !c.matches(row) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortRows orders rows by the given keys. Missing values sort first, and values
+// that cannot be compared keep their relative order.
+func sortRows(rows []map[string]interface{}, orderBy []OrderBy) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return compareRows(rows[i], rows[j], orderBy) < 0
+	})
+}
+
+// compareRows orders two rows by the given keys, as sortRows does.
+func compareRows(a, b map[string]interface{}, orderBy []OrderBy) int {
+	for _, o := range orderBy {
+		x, xok := a[o.Field]
+		y, yok := b[o.Field]
+		var cmp int
+		switch {
+		case !xok && !yok:
+			continue
+		case !xok:
+			cmp = -1
+		case !yok:
+			cmp = 1
+		default:
+			cmp, _ = compareValues(x, y)
+		}
+		if cmp == 0 {
+			continue
+		}
+		if o.Desc {
+			return -cmp
+		}
+		return cmp
+	}
+	return 0
+}
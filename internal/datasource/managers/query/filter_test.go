@@ -0,0 +1,124 @@
+package query
+
+import (
+	"testing"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterRows(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"key": "a.csv", "size": int64(10), "type": "object"},
+		{"key": "b.csv", "size": int64(20), "type": "object"},
+		{"key": "c/", "type": "prefix"},
+		{"key": "d.csv", "size": int64(20), "type": "object"},
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []map[string]interface{}
+	}{
+		{
+			name:  "No filters",
+			query: Query{},
+			want:  rows,
+		},
+		{
+			name:  "Conditions compare across types",
+			query: Query{Conditions: map[string]interface{}{"size": 20}},
+			want:  []map[string]interface{}{rows[1], rows[3]},
+		},
+		{
+			name:  "Operators",
+			query: Query{Conditions: map[string]interface{}{"size": map[string]interface{}{"$gte": 15, "$lt": "25"}}},
+			want:  []map[string]interface{}{rows[1], rows[3]},
+		},
+		{
+			name:  "Set membership and existence",
+			query: Query{Conditions: map[string]interface{}{"key": map[string]interface{}{"$nin": []interface{}{"a.csv"}}, "size": map[string]interface{}{"$exists": false}}},
+			want:  []map[string]interface{}{rows[2]},
+		},
+		{
+			name:  "Regex",
+			query: Query{Conditions: map[string]interface{}{"key": map[string]interface{}{"$regex": `^[ab]\.`}}},
+			want:  []map[string]interface{}{rows[0], rows[1]},
+		},
+		{
+			name:  "Like",
+			query: Query{Conditions: map[string]interface{}{"key": map[string]interface{}{"$like": "_.csv"}}},
+			want:  []map[string]interface{}{rows[0], rows[1], rows[3]},
+		},
+		{
+			name: "Logical operators",
+			query: Query{Conditions: map[string]interface{}{
+				"type": "object",
+				"$or":  []interface{}{map[string]interface{}{"key": "a.csv"}, map[string]interface{}{"size": 20}},
+				"$nor": []interface{}{map[string]interface{}{"key": "d.csv"}},
+			}},
+			want: []map[string]interface{}{rows[0], rows[1]},
+		},
+		{
+			name: "Group by",
+			query: Query{
+				GroupBy:      []string{"type"},
+				Aggregations: []Aggregation{{Function: Count}, {Function: Sum, Field: "size"}},
+				OrderBy:      []OrderBy{{Field: "count", Desc: true}},
+			},
+			want: []map[string]interface{}{
+				{"type": "object", "count": int64(3), "sum_size": 50.0},
+				{"type": "prefix", "count": int64(1), "sum_size": nil},
+			},
+		},
+		{
+			name:  "Aggregate all rows",
+			query: Query{Conditions: map[string]interface{}{"type": "object"}, Aggregations: []Aggregation{{Function: Max, Field: "key", Alias: "last"}}},
+			want:  []map[string]interface{}{{"last": "d.csv"}},
+		},
+		{
+			name:  "Group fields and aggregations",
+			query: Query{Fields: []string{"type"}, GroupBy: []string{"type", "size"}, Aggregations: []Aggregation{{Function: Count}}, Limit: 1},
+			want:  []map[string]interface{}{{"type": "object", "count": int64(1)}},
+		},
+		{
+			name:  "Order by",
+			query: Query{OrderBy: []OrderBy{{Field: "size", Desc: true}, {Field: "key", Desc: true}}},
+			want:  []map[string]interface{}{rows[3], rows[1], rows[0], rows[2]},
+		},
+		{
+			name:  "Offset and limit",
+			query: Query{Conditions: map[string]interface{}{"type": "object"}, Offset: 1, Limit: 1},
+			want:  []map[string]interface{}{rows[1]},
+		},
+		{
+			name:  "Offset past the end",
+			query: Query{Offset: 10},
+			want:  nil,
+		},
+		{
+			name:  "Field selection",
+			query: Query{Fields: []string{"key"}, Limit: 1},
+			want:  []map[string]interface{}{{"key": "a.csv"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := filterRows(append([]map[string]interface{}(nil), rows...), tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := filterRows(rows, Query{Conditions: map[string]interface{}{"size": map[string]interface{}{"$near": 1}}})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation))
+
+	_, err = filterRows(rows, Query{TimeBucket: &TimeBucket{Field: "ts", Interval: "1h"}})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+
+	_, err = filterRows(rows, Query{Aggregations: []Aggregation{{Function: Avg}}})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation))
+}
@@ -0,0 +1,188 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"pkg/common/errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// mongoFilter returns the MongoDB filter of a query's conditions. Conditions already use
+// MongoDB's operators, except $like, which becomes an anchored $regex, also within logical
+// operators.
+func mongoFilter(conditions map[string]interface{}) (map[string]interface{}, error) {
+	filter := make(map[string]interface{}, len(conditions))
+	for field, value := range conditions {
+		if isLogicalOperator(field) {
+			maps, err := logicalOperands(field, value)
+			if err != nil {
+				return nil, err
+			}
+			translated := make([]interface{}, len(maps))
+			for i, m := range maps {
+				if translated[i], err = mongoFilter(m); err != nil {
+					return nil, err
+				}
+			}
+			filter[field] = translated
+			continue
+		}
+		ops, ok := value.(map[string]interface{})
+		if !ok || !isOperatorMap(ops) {
+			filter[field] = value
+			continue
+		}
+		pattern, ok := ops[string(OpLike)]
+		if !ok {
+			filter[field] = value
+			continue
+		}
+		s, isString := pattern.(string)
+		if !isString {
+			return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("%s on %s requires a string", OpLike, field), nil)
+		}
+		if _, ok := ops[string(OpRegex)]; ok {
+			return nil, errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("%s and %s cannot both be used on %s in MongoDB", OpLike, OpRegex, field), nil)
+		}
+		translated := make(map[string]interface{}, len(ops))
+		for op, operand := range ops {
+			translated[op] = operand
+		}
+		delete(translated, string(OpLike))
+		translated[string(OpRegex)] = likeToRegex(s)
+		filter[field] = translated
+	}
+	return filter, nil
+}
+
+// buildMongoPipeline translates a select query into an aggregation pipeline. It reports
+// false for queries that a find with the filter alone answers.
+//
+// The filter is matched first. Aggregations are computed by a $group stage, keyed by the
+// GroupBy fields, whose results are flattened back into rows with one column per group field
+// and aggregation. OrderBy, Offset and Limit then map to $sort, $skip and $limit, and Fields
+// to a final $project.
+func buildMongoPipeline(query Query, filter map[string]interface{}) ([]interface{}, bool, error) {
+	if query.TimeBucket != nil {
+		return nil, false, errors.NewError(errors.ErrorTypeUnsupported, "time buckets are not supported for MongoDB", nil)
+	}
+	grouped := len(query.GroupBy) > 0 || len(query.Aggregations) > 0
+	if !grouped && len(query.Fields) == 0 && len(query.OrderBy) == 0 && query.Limit == 0 && query.Offset == 0 {
+		return nil, false, nil
+	}
+
+	var pipeline []interface{}
+	if len(filter) > 0 {
+		pipeline = append(pipeline, map[string]interface{}{"$match": filter})
+	}
+
+	if grouped {
+		// Group keys are numbered, as field names with dots cannot name them.
+		var id interface{}
+		project := map[string]interface{}{"_id": 0}
+		selected := make(map[string]bool, len(query.Fields))
+		for _, f := range query.Fields {
+			selected[f] = true
+		}
+		if len(query.GroupBy) > 0 {
+			keys := make(map[string]interface{}, len(query.GroupBy))
+			for i, field := range query.GroupBy {
+				key := fmt.Sprintf("g%d", i)
+				keys[key] = "$" + field
+				if len(selected) == 0 || selected[field] {
+					project[field] = "$_id." + key
+				}
+			}
+			id = keys
+		}
+		group := map[string]interface{}{"_id": id}
+		for _, agg := range query.Aggregations {
+			accumulator, err := mongoAccumulator(agg)
+			if err != nil {
+				return nil, false, err
+			}
+			group[agg.Name()] = accumulator
+			project[agg.Name()] = 1
+		}
+		pipeline = append(pipeline, map[string]interface{}{"$group": group}, map[string]interface{}{"$project": project})
+	}
+
+	if len(query.OrderBy) > 0 {
+		pipeline = append(pipeline, map[string]interface{}{"$sort": mongoSort(query.OrderBy)})
+	}
+	if query.Offset > 0 {
+		pipeline = append(pipeline, map[string]interface{}{"$skip": query.Offset})
+	}
+	if query.Limit > 0 {
+		pipeline = append(pipeline, map[string]interface{}{"$limit": query.Limit})
+	}
+
+	if !grouped && len(query.Fields) > 0 {
+		project := map[string]interface{}{"_id": 0}
+		for _, field := range query.Fields {
+			project[field] = 1
+		}
+		pipeline = append(pipeline, map[string]interface{}{"$project": project})
+	}
+	return pipeline, true, nil
+}
+
+// mongoAccumulator returns the $group accumulator that computes agg.
+func mongoAccumulator(agg Aggregation) (map[string]interface{}, error) {
+	if err := validateAggregation(agg); err != nil {
+		return nil, err
+	}
+	field := "$" + agg.Field
+	switch agg.Function {
+	case Count:
+		if agg.Field == "" || agg.Field == "*" {
+			return map[string]interface{}{"$sum": 1}, nil
+		}
+		// As in SQL, null and missing values are not counted.
+		return map[string]interface{}{"$sum": map[string]interface{}{"$cond": []interface{}{
+			map[string]interface{}{"$gt": []interface{}{field, nil}}, 1, 0,
+		}}}, nil
+	default:
+		return map[string]interface{}{"$" + string(agg.Function): field}, nil
+	}
+}
+
+// mongoSort is the value of a $sort stage. It keeps the order of its fields when encoded as
+// BSON for the server, and as JSON for explanations.
+type mongoSort []OrderBy
+
+func (s mongoSort) doc() bson.D {
+	doc := make(bson.D, len(s))
+	for i, o := range s {
+		dir := 1
+		if o.Desc {
+			dir = -1
+		}
+		doc[i] = bson.E{Key: o.Field, Value: dir}
+	}
+	return doc
+}
+
+func (s mongoSort) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(s.doc())
+}
+
+func (s mongoSort) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, e := range s.doc() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%s:%d", key, e.Value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
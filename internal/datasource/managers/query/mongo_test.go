@@ -0,0 +1,124 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMongoFilter(t *testing.T) {
+	filter, err := mongoFilter(map[string]interface{}{
+		"msg":    map[string]interface{}{"$like": "a.b%", "$ne": "x"},
+		"status": "ok",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"msg":    map[string]interface{}{"$regex": `(?s)^a\.b.*$`, "$ne": "x"},
+		"status": "ok",
+	}, filter)
+
+	filter, err = mongoFilter(map[string]interface{}{"$or": []interface{}{map[string]interface{}{"msg": map[string]interface{}{"$like": "a_"}}}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"$or": []interface{}{map[string]interface{}{"msg": map[string]interface{}{"$regex": `(?s)^a.$`}}},
+	}, filter)
+
+	_, err = mongoFilter(map[string]interface{}{"msg": map[string]interface{}{"$like": "a%", "$regex": "b"}})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+}
+
+func TestBuildMongoPipeline(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{
+			name:  "Find",
+			query: Query{Type: Select, Collection: "orders"},
+		},
+		{
+			name: "Fields, sort and paging",
+			query: Query{
+				Type:       Select,
+				Conditions: map[string]interface{}{"status": "paid"},
+				Fields:     []string{"id", "amount"},
+				OrderBy:    []OrderBy{{Field: "amount", Desc: true}, {Field: "id"}},
+				Limit:      20,
+				Offset:     40,
+			},
+			want: `[
+				{"$match": {"status": "paid"}},
+				{"$sort": {"amount": -1, "id": 1}},
+				{"$skip": 40},
+				{"$limit": 20},
+				{"$project": {"_id": 0, "id": 1, "amount": 1}}
+			]`,
+		},
+		{
+			name: "Grouped aggregations",
+			query: Query{
+				Type:    Select,
+				GroupBy: []string{"region"},
+				Aggregations: []Aggregation{
+					{Function: Count},
+					{Function: Count, Field: "email"},
+					{Function: Avg, Field: "amount", Alias: "avg_amount"},
+				},
+				OrderBy: []OrderBy{{Field: "avg_amount", Desc: true}},
+				Limit:   5,
+			},
+			want: `[
+				{"$group": {
+					"_id": {"g0": "$region"},
+					"count": {"$sum": 1},
+					"count_email": {"$sum": {"$cond": [{"$gt": ["$email", null]}, 1, 0]}},
+					"avg_amount": {"$avg": "$amount"}
+				}},
+				{"$project": {"_id": 0, "region": "$_id.g0", "count": 1, "count_email": 1, "avg_amount": 1}},
+				{"$sort": {"avg_amount": -1}},
+				{"$limit": 5}
+			]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := mongoFilter(tt.query.Conditions)
+			require.NoError(t, err)
+			pipeline, ok, err := buildMongoPipeline(tt.query, filter)
+			require.NoError(t, err)
+			if tt.want == "" {
+				assert.False(t, ok)
+				return
+			}
+			assert.True(t, ok)
+			got, err := json.Marshal(pipeline)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+
+	_, _, err := buildMongoPipeline(Query{Type: Select, TimeBucket: &TimeBucket{Field: "ts", Interval: "1h"}}, nil)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+}
+
+func TestMongoSortKeepsOrder(t *testing.T) {
+	sort := mongoSort{{Field: "b", Desc: true}, {Field: "a"}}
+
+	data, err := json.Marshal(sort)
+	require.NoError(t, err)
+	assert.Equal(t, `{"b":-1,"a":1}`, string(data))
+
+	raw, err := bson.Marshal(map[string]interface{}{"$sort": sort})
+	require.NoError(t, err)
+	var decoded struct {
+		Sort bson.D `bson:"$sort"`
+	}
+	require.NoError(t, bson.Unmarshal(raw, &decoded))
+	assert.Equal(t, bson.D{{Key: "b", Value: int32(-1)}, {Key: "a", Value: int32(1)}}, decoded.Sort)
+}
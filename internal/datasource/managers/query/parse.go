@@ -0,0 +1,832 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"pkg/common/errors"
+)
+
+// SyntaxError reports where query text could not be parsed. Line and Column count from 1,
+// and Offset is the byte offset in the text.
+type SyntaxError struct {
+	Message string
+	Offset  int
+	Line    int
+	Column  int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// Parse parses a query written in a small SQL-like language into a Query, so that the same
+// text can run against any connector:
+//
+//	SELECT a, sum(b) AS total FROM orders WHERE c > 5 AND d IN ('x', 'y') GROUP BY a ORDER BY 2 DESC LIMIT 10
+//	SELECT time_bucket(ts, '5m') AS minute, count(*) FROM events GROUP BY minute
+//	INSERT INTO users (name, age) VALUES ('Ada', 36)
+//	UPDATE users SET name = 'Ada' WHERE id = 1
+//	DELETE FROM users WHERE email IS NULL
+//
+// Conditions are comparisons of a field with a literal, joined by AND: =, != or <>, <, <=,
+// >, >=, [NOT] IN (...), IS [NOT] NULL, LIKE with % and _ wildcards, and ~ or REGEXP for
+// regular expressions. The aggregate functions are count, sum, avg, min and max. ORDER BY
+// and GROUP BY accept fields, aliases and 1-based positions in the select list. Keywords
+// are case-insensitive, strings are single-quoted, and identifiers may be double-quoted or
+// backquoted; SQL sources quote them again in their own dialect unless they are plain
+// names. Collection names may hold dots, slashes, colons and wildcards, as in
+// "logs/app.csv" or users:*.
+//
+// Errors are Validation errors wrapping a *SyntaxError that holds the position.
+func Parse(text string) (Query, error) {
+	return parse(text, false)
+}
+
+// parse parses query text. With params set, values may be parameters written :name, which
+// are parsed into Params.
+func parse(text string, params bool) (Query, error) {
+	tokens, err := lex(text)
+	if err != nil {
+		return Query{}, errors.NewError(errors.ErrorTypeValidation, "invalid query text", err)
+	}
+	p := &parser{text: text, tokens: tokens, params: params}
+	q, err := p.statement()
+	if err != nil {
+		return Query{}, errors.NewError(errors.ErrorTypeValidation, "invalid query text", err)
+	}
+	return q, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenSymbol
+	tokenParam
+)
+
+type token struct {
+	kind tokenKind
+	// text is the identifier, the symbol, the unquoted string, the number as written or the
+	// name of the parameter.
+	text string
+	// quoted is set for quoted identifiers, which are never keywords.
+	quoted bool
+	offset int
+}
+
+// String describes the token in error messages.
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return "'" + t.text + "'"
+	case tokenParam:
+		return ":" + t.text
+	default:
+		return strconv.Quote(t.text)
+	}
+}
+
+// syntaxError returns a SyntaxError at offset in text.
+func syntaxError(text string, offset int, format string, args ...interface{}) *SyntaxError {
+	line, column := 1, 1
+	for _, r := range text[:offset] {
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return &SyntaxError{Message: fmt.Sprintf(format, args...), Offset: offset, Line: line, Column: column}
+}
+
+// isIdentStart and isIdentPart match the characters of unquoted identifiers. Besides
+// letters, digits and underscores, identifiers may hold characters that appear in
+// collection names, such as file paths and key patterns.
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || strings.ContainsRune(".$/:-*?", r)
+}
+
+// lex splits text into tokens.
+func lex(text string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '-' && strings.HasPrefix(text[i:], "--"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case isIdentStart(r):
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if !isIdentPart(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: text[start:i], offset: start})
+		case r == ':' && i+1 < len(text) && isIdentStart(rune(text[i+1])):
+			i++
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokenParam, text: text[start+1 : i], offset: start})
+		case unicode.IsDigit(r) || (r == '-' || r == '.') && i+1 < len(text) && unicode.IsDigit(rune(text[i+1])):
+			i++
+			for i < len(text) && (unicode.IsDigit(rune(text[i])) || strings.ContainsRune(".eE", rune(text[i])) ||
+				(text[i] == '-' || text[i] == '+') && (text[i-1] == 'e' || text[i-1] == 'E')) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text[start:i], offset: start})
+		case r == '\'' || r == '"' || r == '`':
+			var value strings.Builder
+			i++
+			for {
+				if i >= len(text) {
+					return nil, syntaxError(text, start, "unterminated %s", map[rune]string{'\'': "string", '"': "identifier", '`': "identifier"}[r])
+				}
+				if rune(text[i]) == r {
+					// A doubled quote stands for itself.
+					if i+1 < len(text) && rune(text[i+1]) == r {
+						value.WriteRune(r)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				value.WriteByte(text[i])
+				i++
+			}
+			if r == '\'' {
+				tokens = append(tokens, token{kind: tokenString, text: value.String(), offset: start})
+			} else {
+				tokens = append(tokens, token{kind: tokenIdent, text: value.String(), quoted: true, offset: start})
+			}
+		default:
+			symbol := string(r)
+			for _, s := range []string{"<=", ">=", "<>", "!="} {
+				if strings.HasPrefix(text[i:], s) {
+					symbol = s
+				}
+			}
+			if !strings.Contains("(),*=<>;~", symbol) && len(symbol) == 1 {
+				return nil, syntaxError(text, start, "unexpected character %q", r)
+			}
+			i += len(symbol)
+			tokens = append(tokens, token{kind: tokenSymbol, text: symbol, offset: start})
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, offset: len(text)}), nil
+}
+
+// keywords cannot be used as unquoted identifiers.
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true, "NOT": true,
+	"GROUP": true, "BY": true, "ORDER": true, "ASC": true, "DESC": true, "LIMIT": true,
+	"OFFSET": true, "AS": true, "IN": true, "IS": true, "NULL": true, "LIKE": true,
+	"REGEXP": true, "TRUE": true, "FALSE": true, "INSERT": true, "INTO": true,
+	"VALUES": true, "UPDATE": true, "SET": true, "DELETE": true,
+}
+
+// selectItem is an entry of a select list.
+type selectItem struct {
+	field       string
+	aggregation *Aggregation
+	bucket      *TimeBucket
+	offset      int
+}
+
+// name returns the result column of the item.
+func (it selectItem) name() string {
+	switch {
+	case it.aggregation != nil:
+		return it.aggregation.Name()
+	case it.bucket != nil:
+		return it.bucket.Name()
+	}
+	return it.field
+}
+
+type parser struct {
+	text   string
+	tokens []token
+	pos    int
+	// params allows parameters in place of values.
+	params bool
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorAt(t token, format string, args ...interface{}) error {
+	return syntaxError(p.text, t.offset, format, args...)
+}
+
+// isKeyword reports whether t is the keyword kw.
+func isKeyword(t token, kw string) bool {
+	return t.kind == tokenIdent && !t.quoted && strings.EqualFold(t.text, kw)
+}
+
+// accept consumes the next token if it is the keyword or symbol s.
+func (p *parser) accept(s string) bool {
+	t := p.peek()
+	if isKeyword(t, s) || t.kind == tokenSymbol && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorAt(p.peek(), "expected %s, found %s", s, p.peek())
+	}
+	return nil
+}
+
+// identifier consumes an identifier that is not a keyword.
+func (p *parser) identifier(what string) (string, error) {
+	t := p.peek()
+	if t.kind != tokenIdent || !t.quoted && keywords[strings.ToUpper(t.text)] {
+		return "", p.errorAt(t, "expected %s, found %s", what, t)
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *parser) statement() (Query, error) {
+	var q Query
+	var err error
+	t := p.peek()
+	switch {
+	case isKeyword(t, "SELECT"):
+		q, err = p.selectStatement()
+	case isKeyword(t, "INSERT"):
+		q, err = p.insertStatement()
+	case isKeyword(t, "UPDATE"):
+		q, err = p.updateStatement()
+	case isKeyword(t, "DELETE"):
+		q, err = p.deleteStatement()
+	default:
+		return q, p.errorAt(t, "expected SELECT, INSERT, UPDATE or DELETE, found %s", t)
+	}
+	if err != nil {
+		return q, err
+	}
+	p.accept(";")
+	if t := p.peek(); t.kind != tokenEOF {
+		return q, p.errorAt(t, "unexpected %s", t)
+	}
+	return q, nil
+}
+
+func (p *parser) selectStatement() (Query, error) {
+	q := Query{Type: Select}
+	p.next()
+
+	var items []selectItem
+	if p.accept("*") {
+		if t := p.peek(); t.kind == tokenSymbol && t.text == "," {
+			return q, p.errorAt(t, "* cannot be combined with other fields")
+		}
+	} else {
+		for {
+			item, err := p.selectItem()
+			if err != nil {
+				return q, err
+			}
+			items = append(items, item)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expect("FROM"); err != nil {
+		return q, err
+	}
+	var err error
+	if q.Collection, err = p.identifier("a collection"); err != nil {
+		return q, err
+	}
+	if q.Conditions, err = p.where(); err != nil {
+		return q, err
+	}
+
+	var groupBy []selectItem
+	if p.accept("GROUP") {
+		if err := p.expect("BY"); err != nil {
+			return q, err
+		}
+		for {
+			item, err := p.reference(items, false)
+			if err != nil {
+				return q, err
+			}
+			groupBy = append(groupBy, item)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if p.accept("ORDER") {
+		if err := p.expect("BY"); err != nil {
+			return q, err
+		}
+		for {
+			item, err := p.reference(items, true)
+			if err != nil {
+				return q, err
+			}
+			o := OrderBy{Field: item.name()}
+			if p.accept("DESC") {
+				o.Desc = true
+			} else {
+				p.accept("ASC")
+			}
+			q.OrderBy = append(q.OrderBy, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if p.accept("LIMIT") {
+		if q.Limit, err = p.count(); err != nil {
+			return q, err
+		}
+	}
+	if p.accept("OFFSET") {
+		if q.Offset, err = p.count(); err != nil {
+			return q, err
+		}
+	}
+
+	grouped := make(map[string]bool)
+	for _, item := range groupBy {
+		if item.bucket != nil {
+			continue
+		}
+		q.GroupBy = append(q.GroupBy, item.field)
+		grouped[item.field] = true
+	}
+	for _, item := range items {
+		switch {
+		case item.aggregation != nil:
+			q.Aggregations = append(q.Aggregations, *item.aggregation)
+		case item.bucket != nil:
+			if q.TimeBucket != nil {
+				return q, p.errorAt(token{offset: item.offset}, "only one time_bucket is allowed")
+			}
+			q.TimeBucket = item.bucket
+		default:
+			q.Fields = append(q.Fields, item.field)
+		}
+	}
+	if len(q.Aggregations) > 0 || len(groupBy) > 0 || q.TimeBucket != nil {
+		for _, item := range items {
+			if item.aggregation == nil && item.bucket == nil && !grouped[item.field] {
+				return q, p.errorAt(token{offset: item.offset}, "%s must appear in GROUP BY or be aggregated", item.field)
+			}
+		}
+	}
+	return q, nil
+}
+
+// selectItem parses a field or a function call, with an optional alias.
+func (p *parser) selectItem() (selectItem, error) {
+	start := p.peek()
+	item, err := p.expression()
+	if err != nil {
+		return item, err
+	}
+
+	alias := ""
+	if p.accept("AS") {
+		if alias, err = p.identifier("an alias"); err != nil {
+			return item, err
+		}
+	} else if t := p.peek(); t.kind == tokenIdent && (t.quoted || !keywords[strings.ToUpper(t.text)]) {
+		alias = p.next().text
+	}
+	if alias != "" {
+		switch {
+		case item.aggregation != nil:
+			item.aggregation.Alias = alias
+		case item.bucket != nil:
+			item.bucket.Alias = alias
+		default:
+			return item, p.errorAt(start, "fields cannot be renamed; only aggregations and time buckets take an alias")
+		}
+	}
+	return item, nil
+}
+
+// expression parses a field, an aggregate function or time_bucket.
+func (p *parser) expression() (selectItem, error) {
+	start := p.peek()
+	name, err := p.identifier("a field or function")
+	if err != nil {
+		return selectItem{}, err
+	}
+	item := selectItem{field: name, offset: start.offset}
+	if !p.accept("(") {
+		return item, nil
+	}
+
+	function := strings.ToLower(name)
+	if function == "time_bucket" {
+		field, err := p.identifier("a field")
+		if err != nil {
+			return item, err
+		}
+		if err := p.expect(","); err != nil {
+			return item, err
+		}
+		interval := p.next()
+		if interval.kind != tokenString {
+			return item, p.errorAt(interval, "expected an interval such as '5m', found %s", interval)
+		}
+		if _, err := parseInterval(interval.text); err != nil {
+			return item, p.errorAt(interval, "invalid interval '%s'; use a duration such as '30s', '5m' or '1h', or days such as '1d'", interval.text)
+		}
+		item.bucket = &TimeBucket{Field: field, Interval: interval.text}
+		return item, p.expect(")")
+	}
+
+	switch AggregateFunction(function) {
+	case Count, Sum, Avg, Min, Max:
+	default:
+		return item, p.errorAt(start, "unknown function %s", name)
+	}
+	agg := &Aggregation{Function: AggregateFunction(function)}
+	if t := p.peek(); t.kind == tokenSymbol && t.text == "*" {
+		if agg.Function != Count {
+			return item, p.errorAt(t, "%s requires a field", function)
+		}
+		p.next()
+	} else if agg.Field, err = p.identifier("a field"); err != nil {
+		return item, err
+	}
+	item.aggregation = agg
+	return item, p.expect(")")
+}
+
+// reference parses a GROUP BY or ORDER BY entry: a position in the select list, an alias,
+// a field or, in ORDER BY, an aggregate of the select list.
+func (p *parser) reference(items []selectItem, aggregates bool) (selectItem, error) {
+	t := p.peek()
+	if t.kind == tokenNumber {
+		n, err := strconv.Atoi(t.text)
+		if err != nil || n < 1 || n > len(items) {
+			return selectItem{}, p.errorAt(t, "position %s is not in the select list", t.text)
+		}
+		p.next()
+		item := items[n-1]
+		if item.aggregation != nil && !aggregates {
+			return selectItem{}, p.errorAt(t, "cannot group by aggregate %s", item.name())
+		}
+		return item, nil
+	}
+
+	ref, err := p.expression()
+	if err != nil {
+		return ref, err
+	}
+	for _, item := range items {
+		switch {
+		case ref.aggregation != nil && item.aggregation != nil:
+			if ref.aggregation.Function == item.aggregation.Function && ref.aggregation.Field == item.aggregation.Field {
+				return item, nil
+			}
+		case ref.bucket != nil && item.bucket != nil:
+			if *ref.bucket == (TimeBucket{Field: item.bucket.Field, Interval: item.bucket.Interval}) {
+				return item, nil
+			}
+		case ref.aggregation == nil && ref.bucket == nil:
+			if (item.aggregation != nil || item.bucket != nil) && item.name() == ref.field {
+				if item.aggregation != nil && !aggregates {
+					return selectItem{}, p.errorAt(t, "cannot group by aggregate %s", ref.field)
+				}
+				return item, nil
+			}
+		}
+	}
+	switch {
+	case ref.aggregation != nil && !aggregates:
+		return selectItem{}, p.errorAt(t, "cannot group by an aggregate")
+	case ref.aggregation != nil, ref.bucket != nil:
+		return selectItem{}, p.errorAt(t, "%s is not in the select list", p.text[t.offset:p.peek().offset])
+	}
+	return ref, nil
+}
+
+// count parses a LIMIT or OFFSET value.
+func (p *parser) count() (int, error) {
+	t := p.next()
+	n, err := strconv.Atoi(t.text)
+	if t.kind != tokenNumber || err != nil || n < 0 {
+		return 0, p.errorAt(t, "expected a non-negative integer, found %s", t)
+	}
+	return n, nil
+}
+
+// where parses an optional WHERE clause into conditions.
+func (p *parser) where() (map[string]interface{}, error) {
+	if !p.accept("WHERE") {
+		return nil, nil
+	}
+	ops := make(map[string]map[string]interface{})
+	for {
+		field, err := p.identifier("a field")
+		if err != nil {
+			return nil, err
+		}
+		opToken := p.peek()
+		op, value, err := p.predicate()
+		if err != nil {
+			return nil, err
+		}
+		if ops[field] == nil {
+			ops[field] = make(map[string]interface{})
+		}
+		if _, ok := ops[field][string(op)]; ok {
+			return nil, p.errorAt(opToken, "duplicate %s condition on %s", op, field)
+		}
+		ops[field][string(op)] = value
+
+		if t := p.peek(); isKeyword(t, "OR") {
+			return nil, p.errorAt(t, "OR is not supported; conditions can only be combined with AND")
+		}
+		if !p.accept("AND") {
+			break
+		}
+	}
+
+	conditions := make(map[string]interface{}, len(ops))
+	for field, m := range ops {
+		if v, ok := m[string(OpEq)]; ok && len(m) == 1 {
+			conditions[field] = v
+		} else {
+			conditions[field] = m
+		}
+	}
+	return conditions, nil
+}
+
+// comparisons maps comparison symbols to operators.
+var comparisons = map[string]Operator{
+	"=": OpEq, "!=": OpNe, "<>": OpNe, "<": OpLt, "<=": OpLte, ">": OpGt, ">=": OpGte, "~": OpRegex,
+}
+
+// predicate parses the part of a condition after the field.
+func (p *parser) predicate() (Operator, interface{}, error) {
+	t := p.next()
+	if op, ok := comparisons[t.text]; ok && t.kind == tokenSymbol {
+		v, err := p.literal()
+		if err != nil {
+			return "", nil, err
+		}
+		if op == OpRegex {
+			if _, ok := v.(string); !ok && !isParam(v) {
+				return "", nil, p.errorAt(p.tokens[p.pos-1], "a regular expression must be a string")
+			}
+		}
+		if v == nil && op != OpEq && op != OpNe {
+			return "", nil, p.errorAt(p.tokens[p.pos-1], "NULL can only be compared with IS NULL or IS NOT NULL")
+		}
+		return op, v, nil
+	}
+
+	switch {
+	case isKeyword(t, "IS"):
+		op := OpEq
+		if p.accept("NOT") {
+			op = OpNe
+		}
+		return op, nil, p.expect("NULL")
+	case isKeyword(t, "NOT"):
+		if in := p.peek(); !isKeyword(in, "IN") {
+			return "", nil, p.errorAt(in, "expected IN after NOT, found %s", in)
+		}
+		p.next()
+		list, err := p.listOrParam()
+		return OpNin, list, err
+	case isKeyword(t, "IN"):
+		list, err := p.listOrParam()
+		return OpIn, list, err
+	case isKeyword(t, "LIKE"):
+		if p.peek().kind == tokenParam {
+			v, err := p.literal()
+			return OpLike, v, err
+		}
+		pattern := p.next()
+		if pattern.kind != tokenString {
+			return "", nil, p.errorAt(pattern, "expected a pattern string, found %s", pattern)
+		}
+		return OpLike, pattern.text, nil
+	case isKeyword(t, "REGEXP"):
+		if p.peek().kind == tokenParam {
+			v, err := p.literal()
+			return OpRegex, v, err
+		}
+		pattern := p.next()
+		if pattern.kind != tokenString {
+			return "", nil, p.errorAt(pattern, "expected a regular expression string, found %s", pattern)
+		}
+		return OpRegex, pattern.text, nil
+	}
+	return "", nil, p.errorAt(t, "expected a comparison, IN, IS, LIKE or REGEXP, found %s", t)
+}
+
+// listOrParam parses the operand of IN: a list, or a parameter that holds one.
+func (p *parser) listOrParam() (interface{}, error) {
+	if p.peek().kind == tokenParam {
+		return p.literal()
+	}
+	list, err := p.list()
+	return list, err
+}
+
+// list parses a parenthesized list of literals.
+func (p *parser) list() ([]interface{}, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var values []interface{}
+	if p.accept(")") {
+		return values, nil
+	}
+	for {
+		v, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return values, p.expect(")")
+}
+
+// literal parses a string, a number, TRUE, FALSE, NULL or, when allowed, a parameter.
+// Integers are int64 and other numbers float64.
+func (p *parser) literal() (interface{}, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokenParam:
+		if !p.params {
+			return nil, p.errorAt(t, "parameter %s can only be used in saved queries", t)
+		}
+		return Param{Name: t.text}, nil
+	case t.kind == tokenString:
+		return t.text, nil
+	case t.kind == tokenNumber:
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return n, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorAt(t, "invalid number %s", t.text)
+		}
+		return f, nil
+	case isKeyword(t, "TRUE"):
+		return true, nil
+	case isKeyword(t, "FALSE"):
+		return false, nil
+	case isKeyword(t, "NULL"):
+		return nil, nil
+	}
+	return nil, p.errorAt(t, "expected a value, found %s", t)
+}
+
+func (p *parser) insertStatement() (Query, error) {
+	q := Query{Type: Insert}
+	p.next()
+	if err := p.expect("INTO"); err != nil {
+		return q, err
+	}
+	var err error
+	if q.Collection, err = p.identifier("a collection"); err != nil {
+		return q, err
+	}
+
+	if err := p.expect("("); err != nil {
+		return q, err
+	}
+	var columns []token
+	for {
+		t := p.peek()
+		if _, err := p.identifier("a field"); err != nil {
+			return q, err
+		}
+		columns = append(columns, t)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return q, err
+	}
+	if err := p.expect("VALUES"); err != nil {
+		return q, err
+	}
+	valuesToken := p.peek()
+	values, err := p.list()
+	if err != nil {
+		return q, err
+	}
+	if len(values) != len(columns) {
+		return q, p.errorAt(valuesToken, "%d values for %d fields", len(values), len(columns))
+	}
+
+	q.Data = make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		if _, ok := q.Data[column.text]; ok {
+			return q, p.errorAt(column, "duplicate field %s", column.text)
+		}
+		q.Data[column.text] = values[i]
+	}
+	return q, nil
+}
+
+func (p *parser) updateStatement() (Query, error) {
+	q := Query{Type: Update}
+	p.next()
+	var err error
+	if q.Collection, err = p.identifier("a collection"); err != nil {
+		return q, err
+	}
+	if err := p.expect("SET"); err != nil {
+		return q, err
+	}
+	q.Data = make(map[string]interface{})
+	for {
+		t := p.peek()
+		field, err := p.identifier("a field")
+		if err != nil {
+			return q, err
+		}
+		if _, ok := q.Data[field]; ok {
+			return q, p.errorAt(t, "duplicate field %s", field)
+		}
+		if err := p.expect("="); err != nil {
+			return q, err
+		}
+		if q.Data[field], err = p.literal(); err != nil {
+			return q, err
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	q.Conditions, err = p.where()
+	return q, err
+}
+
+func (p *parser) deleteStatement() (Query, error) {
+	q := Query{Type: Delete}
+	p.next()
+	if err := p.expect("FROM"); err != nil {
+		return q, err
+	}
+	var err error
+	if q.Collection, err = p.identifier("a collection"); err != nil {
+		return q, err
+	}
+	q.Conditions, err = p.where()
+	return q, err
+}
@@ -0,0 +1,168 @@
+package query
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want Query
+	}{
+		{
+			name: "Aggregation",
+			text: "SELECT a, sum(b) FROM orders WHERE c > 5 GROUP BY a ORDER BY 2 DESC LIMIT 10",
+			want: Query{
+				Type:         Select,
+				Collection:   "orders",
+				Fields:       []string{"a"},
+				Conditions:   map[string]interface{}{"c": map[string]interface{}{"$gt": int64(5)}},
+				GroupBy:      []string{"a"},
+				Aggregations: []Aggregation{{Function: Sum, Field: "b"}},
+				OrderBy:      []OrderBy{{Field: "sum_b", Desc: true}},
+				Limit:        10,
+			},
+		},
+		{
+			name: "Conditions",
+			text: `select * from "logs/app.csv" where level in ('warn', 'error') and code not in (1, 2.5)
+				and msg like 'disk%full_' and host ~ '^web' and user is not null and deleted is null
+				and ok = true and age >= -3 and age < 1e2 and name = 'O''Brien' offset 5;`,
+			want: Query{
+				Type:       Select,
+				Collection: "logs/app.csv",
+				Conditions: map[string]interface{}{
+					"level":   map[string]interface{}{"$in": []interface{}{"warn", "error"}},
+					"code":    map[string]interface{}{"$nin": []interface{}{int64(1), 2.5}},
+					"msg":     map[string]interface{}{"$like": "disk%full_"},
+					"host":    map[string]interface{}{"$regex": "^web"},
+					"user":    map[string]interface{}{"$ne": nil},
+					"deleted": nil,
+					"ok":      true,
+					"age":     map[string]interface{}{"$gte": int64(-3), "$lt": 100.0},
+					"name":    "O'Brien",
+				},
+				Offset: 5,
+			},
+		},
+		{
+			name: "Quoted identifiers",
+			text: `SELECT "order", "a b", "1; DROP TABLE users; --" FROM t WHERE "x y" = 1`,
+			want: Query{
+				Type:       Select,
+				Collection: "t",
+				Fields:     []string{"order", "a b", "1; DROP TABLE users; --"},
+				Conditions: map[string]interface{}{"x y": int64(1)},
+			},
+		},
+		{
+			name: "Time bucket and aliases",
+			text: "SELECT time_bucket(ts, '5m') AS minute, country, count(*) n, avg(latency) AS latency FROM events:* " +
+				"GROUP BY minute, country ORDER BY minute, count(*) DESC, latency",
+			want: Query{
+				Type:         Select,
+				Collection:   "events:*",
+				Fields:       []string{"country"},
+				GroupBy:      []string{"country"},
+				Aggregations: []Aggregation{{Function: Count, Alias: "n"}, {Function: Avg, Field: "latency", Alias: "latency"}},
+				TimeBucket:   &TimeBucket{Field: "ts", Interval: "5m", Alias: "minute"},
+				OrderBy:      []OrderBy{{Field: "minute"}, {Field: "n", Desc: true}, {Field: "latency"}},
+			},
+		},
+		{
+			name: "Insert",
+			text: "INSERT INTO users (name, age, admin) VALUES ('Ada', 36, FALSE)",
+			want: Query{Type: Insert, Collection: "users", Data: map[string]interface{}{"name": "Ada", "age": int64(36), "admin": false}},
+		},
+		{
+			name: "Update",
+			text: "UPDATE users SET name = 'Ada', age = NULL WHERE id = 1",
+			want: Query{
+				Type:       Update,
+				Collection: "users",
+				Data:       map[string]interface{}{"name": "Ada", "age": nil},
+				Conditions: map[string]interface{}{"id": int64(1)},
+			},
+		},
+		{
+			name: "Delete",
+			text: "-- drop stale sessions\nDELETE FROM sessions WHERE expires <= '2024-01-01'",
+			want: Query{
+				Type:       Delete,
+				Collection: "sessions",
+				Conditions: map[string]interface{}{"expires": map[string]interface{}{"$lte": "2024-01-01"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.text)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, q)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		text    string
+		line    int
+		column  int
+		message string
+	}{
+		{"SELEC * FROM t", 1, 1, `expected SELECT, INSERT, UPDATE or DELETE, found "SELEC"`},
+		{"SELECT * FROM t WHERE a = 1 OR b = 2", 1, 29, "OR is not supported; conditions can only be combined with AND"},
+		{"SELECT a, count(*) FROM t", 1, 8, "a must appear in GROUP BY or be aggregated"},
+		{"SELECT *\nFROM t\nWHERE name = 'x", 3, 14, "unterminated string"},
+		{"SELECT * FROM t LIMIT -1", 1, 23, `expected a non-negative integer, found "-1"`},
+		{"SELECT median(a) FROM t", 1, 8, "unknown function median"},
+		{"SELECT a FROM t ORDER BY 2", 1, 26, "position 2 is not in the select list"},
+		{"SELECT a AS b FROM t", 1, 8, "fields cannot be renamed; only aggregations and time buckets take an alias"},
+		{"SELECT * FROM t WHERE a > 1 AND a > 2", 1, 35, "duplicate $gt condition on a"},
+		{"SELECT * FROM t WHERE a < NULL", 1, 27, "NULL can only be compared with IS NULL or IS NOT NULL"},
+		{"SELECT time_bucket(ts, '5 minutes') FROM t", 1, 24, "invalid interval '5 minutes'; use a duration such as '30s', '5m' or '1h', or days such as '1d'"},
+		{"INSERT INTO t (a, b) VALUES (1)", 1, 29, "1 values for 2 fields"},
+		{"DELETE FROM t WHERE a = 1 extra", 1, 27, `unexpected "extra"`},
+		{"SELECT * FROM t WHERE é = 1 # ", 1, 29, "unexpected character '#'"},
+		{"SELECT * FROM", 1, 14, "expected a collection, found end of query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			_, err := Parse(tt.text)
+			require.Error(t, err)
+			assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation))
+
+			var syntaxErr *SyntaxError
+			require.True(t, stderrors.As(err, &syntaxErr), "%v", err)
+			assert.Equal(t, tt.message, syntaxErr.Message)
+			assert.Equal(t, tt.line, syntaxErr.Line, "line")
+			assert.Equal(t, tt.column, syntaxErr.Column, "column")
+		})
+	}
+}
+
+func TestParsedQueryRunsAgainstConnectors(t *testing.T) {
+	q, err := Parse("SELECT id, total FROM orders.json WHERE status = 'paid' AND total >= 5 ORDER BY total DESC LIMIT 2")
+	require.NoError(t, err)
+
+	sql, args, err := buildSQLQuery(q, dialectFor("postgres"))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT id, total FROM orders.json WHERE status = $1 AND total >= $2 ORDER BY total DESC LIMIT 2", sql)
+	assert.Equal(t, []interface{}{"paid", int64(5)}, args)
+
+	source := newTestFederation(t)["shop"]
+	rows, err := NewQueryExecutor(source).Execute(context.Background(), q)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"id": 1.0, "total": 30.0},
+		{"id": 2.0, "total": 12.5},
+	}, rows)
+}
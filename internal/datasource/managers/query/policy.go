@@ -0,0 +1,646 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"pkg/common/errors"
+)
+
+// Principal is the caller a query runs for, as policies see it.
+type Principal struct {
+	User  string
+	Roles []string
+	// Attributes are values of the caller, such as the claims of its token, that policy
+	// conditions refer to as parameters.
+	Attributes map[string]interface{}
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context that runs queries for principal.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal set with WithPrincipal. Queries on a context
+// without one run for a caller with no roles.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// hasRole reports whether the principal has any of roles.
+func (p Principal) hasRole(roles []string) bool {
+	for _, role := range roles {
+		for _, r := range p.Roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// attribute returns the value a policy parameter is bound to: an attribute of the
+// principal or, for "user", its user.
+func (p Principal) attribute(name string) (interface{}, bool) {
+	if v, ok := p.Attributes[name]; ok && v != nil {
+		return v, true
+	}
+	if name == "user" && p.User != "" {
+		return p.User, true
+	}
+	return nil, false
+}
+
+// ColumnAction is what a policy does to a column.
+type ColumnAction string
+
+const (
+	// DropColumn removes the column from results. Queries may not select, filter, sort,
+	// group or aggregate on it, or write it.
+	DropColumn ColumnAction = "drop"
+	// MaskColumn replaces the values of the column in results. Queries may select it, but
+	// not filter, sort, group or aggregate on it, or write it.
+	MaskColumn ColumnAction = "mask"
+)
+
+// defaultMask replaces the values of masked columns without a mask of their own.
+const defaultMask = "****"
+
+// ColumnRule restricts a top-level field of a collection's rows.
+type ColumnRule struct {
+	Column string       `json:"column"`
+	Action ColumnAction `json:"action"`
+	// Mask replaces the values of a masked column. Defaults to "****".
+	Mask interface{} `json:"mask,omitempty"`
+}
+
+// Policy restricts what callers see of a connector: it adds mandatory conditions to their
+// queries and drops or masks columns of the rows they read. A policy applies to callers
+// with any of its roles, or to every caller if it has none, unless they have one of its
+// exempt roles. Conditions may hold parameters, {"$param": "name"}, which are bound to the
+// caller's attributes; a caller without the attribute is denied. Queries that a policy
+// applies to may only name plain fields, and columns and collections match regardless of
+// case.
+//
+// Example, as JSON:
+//
+//	{"name": "sales-region", "collections": ["orders"], "roles": ["sales"],
+//	 "conditions": {"region": {"$param": "region"}}}
+//	{"name": "salary", "exempt_roles": ["finance"],
+//	 "columns": [{"column": "salary", "action": "drop"}]}
+type Policy struct {
+	Name string `json:"name"`
+	// Collections are the collections the policy applies to; it applies to all of them
+	// when empty.
+	Collections []string               `json:"collections,omitempty"`
+	Roles       []string               `json:"roles,omitempty"`
+	ExemptRoles []string               `json:"exempt_roles,omitempty"`
+	Conditions  map[string]interface{} `json:"conditions,omitempty"`
+	Columns     []ColumnRule           `json:"columns,omitempty"`
+}
+
+// AppliedPolicy is a policy as it was applied to a query, for the explain output.
+type AppliedPolicy struct {
+	Name string `json:"name"`
+	// Conditions are the policy's conditions with the caller's attributes bound.
+	Conditions map[string]interface{} `json:"conditions,omitempty"`
+	Dropped    []string               `json:"dropped,omitempty"`
+	Masked     []string               `json:"masked,omitempty"`
+}
+
+// appliesTo reports whether the policy restricts the principal's queries on a collection.
+// An empty collection stands for any collection.
+func (p Policy) appliesTo(collection string, principal Principal) bool {
+	if principal.hasRole(p.ExemptRoles) {
+		return false
+	}
+	if len(p.Roles) > 0 && !principal.hasRole(p.Roles) {
+		return false
+	}
+	if len(p.Collections) == 0 || collection == "" {
+		return true
+	}
+	for _, c := range p.Collections {
+		if strings.EqualFold(c, collection) {
+			return true
+		}
+	}
+	return false
+}
+
+// bind returns the policy's conditions with their parameters bound to the principal's
+// attributes.
+func (p Policy) bind(principal Principal) (map[string]interface{}, error) {
+	if len(p.Conditions) == 0 {
+		return nil, nil
+	}
+	q := Query{Conditions: copyConditions(p.Conditions)}
+	err := replaceParams(&q, func(param Param, list bool) (interface{}, error) {
+		v, ok := principal.attribute(param.Name)
+		if !ok {
+			return nil, errors.NewError(errors.ErrorTypePermission, fmt.Sprintf("policy %s requires the caller's %s", p.Name, param.Name), nil)
+		}
+		if list {
+			items, ok := toList(v)
+			if !ok {
+				items = []interface{}{v}
+			}
+			return items, nil
+		}
+		return v, nil
+	})
+	return q.Conditions, err
+}
+
+func (p Policy) validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.NewError(errors.ErrorTypeValidation, "policy name is required", nil)
+	}
+	if len(p.Conditions) == 0 && len(p.Columns) == 0 {
+		return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("policy %s has no conditions or columns", p.Name), nil)
+	}
+
+	// Bind every parameter to a placeholder to check the conditions parse.
+	q := Query{Conditions: copyConditions(p.Conditions)}
+	err := replaceParams(&q, func(_ Param, list bool) (interface{}, error) {
+		if list {
+			return []interface{}{""}, nil
+		}
+		return "", nil
+	})
+	if err == nil {
+		_, err = parseConditions(q.Conditions)
+	}
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("invalid conditions in policy %s", p.Name), err)
+	}
+
+	for _, col := range p.Columns {
+		if col.Column == "" {
+			return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("column rule without a column in policy %s", p.Name), nil)
+		}
+		// Rules drop and mask top-level fields, which restrict the fields within them.
+		if strings.Contains(col.Column, ".") {
+			return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("column %s in policy %s is not a top-level column", col.Column, p.Name), nil)
+		}
+		if col.Action != DropColumn && col.Action != MaskColumn {
+			return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("unknown action %q for column %s in policy %s", col.Action, col.Column, p.Name), nil)
+		}
+	}
+	return nil
+}
+
+// PolicySet holds the policies of each connector.
+type PolicySet struct {
+	policies map[string][]Policy
+}
+
+// NewPolicySet validates the policies of each connector, keyed by connector name.
+func NewPolicySet(policies map[string][]Policy) (*PolicySet, error) {
+	for connector, list := range policies {
+		for _, p := range list {
+			if err := p.validate(); err != nil {
+				return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("invalid policy for connector %s", connector), err)
+			}
+		}
+	}
+	return &PolicySet{policies: policies}, nil
+}
+
+// LoadPolicySet reads the policies of each connector from a JSON file that maps connector
+// names to lists of policies. An empty path returns a set without policies.
+func LoadPolicySet(path string) (*PolicySet, error) {
+	if path == "" {
+		return &PolicySet{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "failed to read policies", err)
+	}
+	var policies map[string][]Policy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeConfiguration, "failed to parse policies", err)
+	}
+	return NewPolicySet(policies)
+}
+
+// For returns the policies of a connector.
+func (s *PolicySet) For(connector string) []Policy {
+	if s == nil {
+		return nil
+	}
+	return s.policies[connector]
+}
+
+// Restricts reports whether any policy of a connector applies to the principal, on any
+// collection. Native commands cannot be checked against policies, so they are refused on
+// such connectors.
+func (s *PolicySet) Restricts(connector string, principal Principal) bool {
+	for _, p := range s.For(connector) {
+		if p.appliesTo("", principal) {
+			return true
+		}
+	}
+	return false
+}
+
+// RestrictsAny reports whether any policy of any connector applies to the principal.
+// Connectors cannot be added or removed by such callers, as a connector added under a new
+// name would reach the same data without its policies.
+func (s *PolicySet) RestrictsAny(principal Principal) bool {
+	if s == nil {
+		return false
+	}
+	for connector := range s.policies {
+		if s.Restricts(connector, principal) {
+			return true
+		}
+	}
+	return false
+}
+
+// enforcement is the effect of the policies that apply to a query on its results.
+type enforcement struct {
+	applied []AppliedPolicy
+	// dropped and masked map restricted columns, in lower case, to the policy that restricts
+	// them.
+	dropped map[string]string
+	masked  map[string]string
+	masks   map[string]interface{}
+}
+
+// WithPolicies returns the executor with policies enforced on every query it runs or
+// explains, for the principal of the query's context.
+func (qe *QueryExecutor) WithPolicies(policies []Policy) *QueryExecutor {
+	qe.policies = policies
+	return qe
+}
+
+// enforce rewrites a query to satisfy the policies that apply to it: their conditions are
+// added to the query's, and queries that would read or write restricted columns, or that
+// would write rows outside the policies' conditions, are refused. The returned enforcement
+// is nil when no policy applies.
+func (qe *QueryExecutor) enforce(ctx context.Context, query Query) (Query, *enforcement, error) {
+	if len(qe.policies) == 0 {
+		return query, nil, nil
+	}
+	principal, _ := PrincipalFromContext(ctx)
+
+	e := &enforcement{dropped: map[string]string{}, masked: map[string]string{}, masks: map[string]interface{}{}}
+	conditions := copyConditions(query.Conditions)
+	var mandatory []condition
+	for _, p := range qe.policies {
+		if !p.appliesTo(query.Collection, principal) {
+			continue
+		}
+		if len(query.Raw) > 0 {
+			return Query{}, nil, errors.NewError(errors.ErrorTypePermission, fmt.Sprintf("raw queries are not allowed on %s under policy %s", query.Collection, p.Name), nil)
+		}
+
+		bound, err := p.bind(principal)
+		if err != nil {
+			return Query{}, nil, err
+		}
+		parsed, err := parseConditions(bound)
+		if err != nil {
+			return Query{}, nil, errors.NewError(errors.ErrorTypePermission, fmt.Sprintf("policy %s does not bind to the caller", p.Name), err)
+		}
+		mandatory = append(mandatory, parsed...)
+		for _, field := range sortedKeys(bound) {
+			merged, err := mergeCondition(conditions[field], bound[field])
+			if err != nil {
+				return Query{}, nil, errors.NewError(errors.ErrorTypePermission, fmt.Sprintf("condition on %s conflicts with policy %s", field, p.Name), err)
+			}
+			conditions[field] = merged
+		}
+
+		applied := AppliedPolicy{Name: p.Name, Conditions: bound}
+		for _, col := range p.Columns {
+			switch col.Action {
+			case DropColumn:
+				e.dropped[strings.ToLower(col.Column)] = p.Name
+				applied.Dropped = append(applied.Dropped, col.Column)
+			case MaskColumn:
+				column := strings.ToLower(col.Column)
+				e.masked[column] = p.Name
+				e.masks[column] = col.Mask
+				if col.Mask == nil {
+					e.masks[column] = defaultMask
+				}
+				applied.Masked = append(applied.Masked, col.Column)
+			}
+		}
+		e.applied = append(e.applied, applied)
+	}
+	if len(e.applied) == 0 {
+		return query, nil, nil
+	}
+	for col := range e.dropped {
+		delete(e.masked, col)
+		delete(e.masks, col)
+	}
+
+	if err := checkNames(query); err != nil {
+		return Query{}, nil, err
+	}
+	if err := e.check(query); err != nil {
+		return Query{}, nil, err
+	}
+
+	switch query.Type {
+	case Insert:
+		// Inserted rows must fall within the policies' conditions.
+		if !matchesConditions(query.Data, mandatory) {
+			return Query{}, nil, errors.NewError(errors.ErrorTypePermission, "inserted row is outside the rows the caller may write", nil)
+		}
+		return query, e, nil
+	case Update:
+		// Updated rows must stay within them. Fields are matched regardless of case, as
+		// most databases match column names.
+		for _, c := range mandatory {
+			for field, v := range query.Data {
+				if strings.EqualFold(field, c.Field) && !c.matches(map[string]interface{}{c.Field: v}) {
+					return Query{}, nil, errors.NewError(errors.ErrorTypePermission, fmt.Sprintf("update of %s moves rows outside the rows the caller may write", field), nil)
+				}
+			}
+		}
+	}
+	if len(conditions) > 0 {
+		query.Conditions = conditions
+	}
+	return query, e, nil
+}
+
+// check refuses a query that reads or writes restricted columns other than by selecting a
+// masked column.
+func (e *enforcement) check(query Query) error {
+	refuse := func(use, field string, masked bool) error {
+		if policy, col, ok := e.restricted(field, masked); ok {
+			return errors.NewError(errors.ErrorTypePermission, fmt.Sprintf("cannot %s column %s: restricted by policy %s", use, col, policy), nil)
+		}
+		return nil
+	}
+
+	for _, field := range query.Fields {
+		if err := refuse("select", field, false); err != nil {
+			return err
+		}
+	}
+	if err := conditionFields(query.Conditions, func(field string) error {
+		return refuse("filter on", field, true)
+	}); err != nil {
+		return err
+	}
+	for _, o := range query.OrderBy {
+		if err := refuse("sort on", o.Field, true); err != nil {
+			return err
+		}
+	}
+	for _, field := range query.GroupBy {
+		if err := refuse("group on", field, true); err != nil {
+			return err
+		}
+	}
+	for _, agg := range query.Aggregations {
+		if err := refuse("aggregate", agg.Field, true); err != nil {
+			return err
+		}
+	}
+	if query.TimeBucket != nil {
+		if err := refuse("group on", query.TimeBucket.Field, true); err != nil {
+			return err
+		}
+	}
+	for _, field := range sortedKeys(query.Data) {
+		if err := refuse("write", field, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restricted returns the policy and column that restrict a field: a dropped column or,
+// when masked is set, a masked one. Fields within a restricted column, such as
+// "address.city" within "address", are restricted with it. Fields match columns
+// regardless of case.
+func (e *enforcement) restricted(field string, masked bool) (string, string, bool) {
+	field = strings.ToLower(field)
+	for {
+		if policy, ok := e.dropped[field]; ok {
+			return policy, field, true
+		}
+		if policy, ok := e.masked[field]; ok && masked {
+			return policy, field, true
+		}
+		i := strings.LastIndex(field, ".")
+		if i < 0 {
+			return "", "", false
+		}
+		field = field[:i]
+	}
+}
+
+// apply drops and masks the restricted columns of result rows.
+func (e *enforcement) apply(rows []map[string]interface{}) []map[string]interface{} {
+	if e == nil {
+		return rows
+	}
+	for _, row := range rows {
+		for col := range row {
+			column := strings.ToLower(col)
+			if _, ok := e.dropped[column]; ok {
+				delete(row, col)
+			} else if mask, ok := e.masks[column]; ok {
+				row[col] = mask
+			}
+		}
+	}
+	return rows
+}
+
+// identifierPattern matches the names that queries under policies may use: identifiers,
+// joined by dots for nested fields.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// checkNames refuses a query under policies that names anything other than a plain field,
+// such as an expression, an alias or a MongoDB operator like $where, or whose conditions
+// use operators that are not known. Policies could not tell which columns such a query
+// reads.
+func checkNames(query Query) error {
+	refuse := func(use, name string) error {
+		if identifierPattern.MatchString(name) {
+			return nil
+		}
+		return errors.NewError(errors.ErrorTypePermission, fmt.Sprintf("%s %q is not a plain field name, as queries under policies require", use, name), nil)
+	}
+
+	for _, field := range query.Fields {
+		if field == "*" {
+			continue
+		}
+		if err := refuse("field", field); err != nil {
+			return err
+		}
+	}
+	if err := conditionFields(query.Conditions, func(field string) error {
+		return refuse("condition on", field)
+	}); err != nil {
+		return errors.NewError(errors.ErrorTypePermission, "conditions are not allowed under policies", err)
+	}
+	if _, err := parseRowFilter(query.Conditions); err != nil {
+		return errors.NewError(errors.ErrorTypePermission, "conditions are not allowed under policies", err)
+	}
+	for _, o := range query.OrderBy {
+		if err := refuse("order by", o.Field); err != nil {
+			return err
+		}
+	}
+	for _, field := range query.GroupBy {
+		if err := refuse("group by", field); err != nil {
+			return err
+		}
+	}
+	for _, agg := range query.Aggregations {
+		if agg.Field != "" && agg.Field != "*" {
+			if err := refuse("aggregate of", agg.Field); err != nil {
+				return err
+			}
+		}
+		if agg.Alias != "" {
+			if err := refuse("alias", agg.Alias); err != nil {
+				return err
+			}
+		}
+	}
+	if b := query.TimeBucket; b != nil {
+		if err := refuse("time bucket of", b.Field); err != nil {
+			return err
+		}
+		if b.Alias != "" {
+			if err := refuse("alias", b.Alias); err != nil {
+				return err
+			}
+		}
+	}
+	written := make(map[string]string, len(query.Data))
+	for _, field := range sortedKeys(query.Data) {
+		if err := refuse("write of", field); err != nil {
+			return err
+		}
+		if other, ok := written[strings.ToLower(field)]; ok {
+			return errors.NewError(errors.ErrorTypePermission, fmt.Sprintf("fields %s and %s differ only in case", other, field), nil)
+		}
+		written[strings.ToLower(field)] = field
+	}
+	return nil
+}
+
+// mergeCondition combines the conditions a query and a policy put on one field into a
+// condition that holds when both do. It fails when they cannot be combined, such as two
+// different regular expressions.
+func mergeCondition(existing, required interface{}) (interface{}, error) {
+	if existing == nil {
+		return required, nil
+	}
+	merged := operatorMap(existing)
+	for op, operand := range operatorMap(required) {
+		current, ok := merged[op]
+		if !ok || valuesEqual(current, operand) {
+			merged[op] = operand
+			continue
+		}
+		switch Operator(op) {
+		case OpEq, OpExists:
+			// No value satisfies both.
+			return map[string]interface{}{string(OpIn): []interface{}{}}, nil
+		case OpIn:
+			a, aok := toList(current)
+			b, bok := toList(operand)
+			if !aok || !bok {
+				return nil, errors.NewError(errors.ErrorTypeValidation, "$in requires a list", nil)
+			}
+			both := []interface{}{}
+			for _, v := range a {
+				if containsValue(b, v) {
+					both = append(both, v)
+				}
+			}
+			merged[op] = both
+		case OpNin:
+			a, aok := toList(current)
+			b, bok := toList(operand)
+			if !aok || !bok {
+				return nil, errors.NewError(errors.ErrorTypeValidation, "$nin requires a list", nil)
+			}
+			merged[op] = append(append([]interface{}{}, a...), b...)
+		case OpNe:
+			// Two different values are excluded with $nin.
+			excluded, _ := toList(merged[string(OpNin)])
+			delete(merged, op)
+			merged[string(OpNin)] = append(append([]interface{}{}, excluded...), current, operand)
+		case OpGt, OpGte, OpLt, OpLte:
+			cmp, ok := compareValues(current, operand)
+			if !ok {
+				return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("cannot compare %v and %v", current, operand), nil)
+			}
+			lower := Operator(op) == OpGt || Operator(op) == OpGte
+			if (lower && cmp < 0) || (!lower && cmp > 0) {
+				merged[op] = operand
+			}
+		default:
+			return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("cannot combine two %s conditions", op), nil)
+		}
+	}
+	return merged, nil
+}
+
+// operatorMap returns a copy of a condition value as a map of operators, with a plain
+// value as $eq.
+func operatorMap(v interface{}) map[string]interface{} {
+	if ops, ok := v.(map[string]interface{}); ok && isOperatorMap(ops) {
+		result := make(map[string]interface{}, len(ops))
+		for op, operand := range ops {
+			result[op] = operand
+		}
+		return result
+	}
+	return map[string]interface{}{string(OpEq): v}
+}
+
+// copyConditions copies a conditions map and its operator maps and lists, so that binding
+// or merging them leaves the original unchanged.
+func copyConditions(conditions map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(conditions))
+	for field, v := range conditions {
+		if ops, ok := v.(map[string]interface{}); ok && isOperatorMap(ops) {
+			copied := make(map[string]interface{}, len(ops))
+			for op, operand := range ops {
+				if items, ok := operand.([]interface{}); ok {
+					operand = append([]interface{}(nil), items...)
+				}
+				copied[op] = operand
+			}
+			v = copied
+		}
+		result[field] = v
+	}
+	return result
+}
+
+// policyNames returns the names of policies, sorted.
+func policyNames(policies []Policy) []string {
+	var names []string
+	for _, p := range policies {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	return names
+}
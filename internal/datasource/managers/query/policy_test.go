@@ -0,0 +1,246 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"datasource/connectors"
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPolicies() []Policy {
+	return []Policy{
+		{
+			Name:        "sales-region",
+			Collections: []string{"employees.json", "employees"},
+			Roles:       []string{"sales"},
+			Conditions:  map[string]interface{}{"region": map[string]interface{}{"$param": "region"}},
+		},
+		{
+			Name:        "salary",
+			ExemptRoles: []string{"finance"},
+			Columns:     []ColumnRule{{Column: "salary", Action: DropColumn}},
+		},
+		{
+			Name:        "contact",
+			ExemptRoles: []string{"finance"},
+			Columns:     []ColumnRule{{Column: "phone", Action: MaskColumn}},
+		},
+	}
+}
+
+func newEmployeesSource(t *testing.T) connectors.Connector {
+	return newFileSource(t, map[string]string{"employees.json": `[
+		{"id": 1, "name": "Ada", "region": "west", "salary": 120, "phone": "555-0101"},
+		{"id": 2, "name": "Grace", "region": "east", "salary": 110, "phone": "555-0102"},
+		{"id": 3, "name": "Linus", "region": "west", "salary": 90, "phone": "555-0103"}
+	]`})
+}
+
+func TestPolicyExecute(t *testing.T) {
+	executor := NewQueryExecutor(newEmployeesSource(t)).WithPolicies(testPolicies())
+	q := Query{Type: Select, Collection: "employees.json", OrderBy: []OrderBy{{Field: "id"}}}
+
+	rep := WithPrincipal(context.Background(), Principal{User: "sam", Roles: []string{"sales"}, Attributes: map[string]interface{}{"region": "west"}})
+	rows, err := executor.Execute(rep, q)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"id": 1.0, "name": "Ada", "region": "west", "phone": "****"},
+		{"id": 3.0, "name": "Linus", "region": "west", "phone": "****"},
+	}, rows)
+
+	// The rep's own conditions are combined with the policy's.
+	filtered := q
+	filtered.Conditions = map[string]interface{}{"region": "east"}
+	rows, err = executor.Execute(rep, filtered)
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+	assert.Equal(t, map[string]interface{}{"region": "east"}, filtered.Conditions)
+
+	finance := WithPrincipal(context.Background(), Principal{User: "fay", Roles: []string{"finance"}})
+	rows, err = executor.Execute(finance, q)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, 110.0, rows[1]["salary"])
+	assert.Equal(t, "555-0102", rows[1]["phone"])
+
+	// Queries without a principal run for a caller with no roles.
+	rows, err = executor.Execute(context.Background(), Query{Type: Select, Collection: "employees.json", Fields: []string{"name", "phone"}, OrderBy: []OrderBy{{Field: "id"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"name": "Ada", "phone": "****"},
+		{"name": "Grace", "phone": "****"},
+		{"name": "Linus", "phone": "****"},
+	}, rows)
+}
+
+func TestPolicyDenied(t *testing.T) {
+	executor := NewQueryExecutor(newEmployeesSource(t)).WithPolicies(testPolicies())
+	rep := WithPrincipal(context.Background(), Principal{Roles: []string{"sales"}, Attributes: map[string]interface{}{"region": "west"}})
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		query Query
+	}{
+		{"Select dropped column", rep, Query{Type: Select, Collection: "employees.json", Fields: []string{"name", "salary"}}},
+		{"Filter on dropped column", rep, Query{Type: Select, Collection: "employees.json", Conditions: map[string]interface{}{"salary": map[string]interface{}{"$gt": 100}}}},
+		{"Filter on masked column", rep, Query{Type: Select, Collection: "employees.json", Conditions: map[string]interface{}{"phone": "555-0101"}}},
+		{"Sort on masked column", rep, Query{Type: Select, Collection: "employees.json", OrderBy: []OrderBy{{Field: "phone"}}}},
+		{"Aggregate dropped column", rep, Query{Type: Select, Collection: "employees.json", Aggregations: []Aggregation{{Function: Avg, Field: "salary"}}}},
+		{"Raw query", rep, Query{Type: Select, Collection: "employees.json", Raw: json.RawMessage(`{}`)}},
+		{"Missing attribute", WithPrincipal(context.Background(), Principal{Roles: []string{"sales"}}), Query{Type: Select, Collection: "employees.json"}},
+		{"Expression as condition", rep, Query{Type: Select, Collection: "employees.json", Conditions: map[string]interface{}{"1=1 OR region": "x"}}},
+		{"Alias as field", rep, Query{Type: Select, Collection: "employees.json", Fields: []string{"salary AS pay"}}},
+		{"Dropped column in another case", rep, Query{Type: Select, Collection: "employees.json", Fields: []string{"SALARY"}}},
+		{"Expression as aggregation", rep, Query{Type: Select, Collection: "employees.json", Aggregations: []Aggregation{{Function: Sum, Field: "salary+0"}}}},
+		{"Expression as alias", rep, Query{Type: Select, Collection: "employees.json", Aggregations: []Aggregation{{Function: Count, Alias: "n, salary"}}}},
+		{"MongoDB operator", rep, Query{Type: Select, Collection: "employees.json", Conditions: map[string]interface{}{"$where": "this.salary > 100"}}},
+		{"Unknown operator", rep, Query{Type: Select, Collection: "employees.json", Conditions: map[string]interface{}{"name": map[string]interface{}{"$expr": 1}}}},
+		{"Dropped column within $or", rep, Query{Type: Select, Collection: "employees.json", Conditions: map[string]interface{}{"$or": []interface{}{map[string]interface{}{"salary": 120}}}}},
+		{"Collection in another case", WithPrincipal(context.Background(), Principal{Roles: []string{"sales"}}), Query{Type: Select, Collection: "EMPLOYEES"}},
+		{"Update moving rows in another case", rep, Query{Type: Update, Collection: "employees.json", Data: map[string]interface{}{"REGION": "east"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executor.Execute(tt.ctx, tt.query)
+			assert.True(t, errors.IsErrorType(err, errors.ErrorTypePermission), "%v", err)
+		})
+	}
+}
+
+func TestPolicyExplain(t *testing.T) {
+	// Reps of several regions see all of them.
+	policies := testPolicies()
+	policies[0].Conditions = map[string]interface{}{"region": map[string]interface{}{"$in": map[string]interface{}{"$param": "region"}}}
+	executor := NewQueryExecutor(connectors.NewSQLConnector(&connectors.Config{Driver: "mysql"})).WithPolicies(policies)
+	rep := WithPrincipal(context.Background(), Principal{Roles: []string{"sales"}, Attributes: map[string]interface{}{"region": []interface{}{"west", "north"}}})
+
+	explanation, err := executor.Explain(rep, Query{
+		Type:       Update,
+		Collection: "employees",
+		Data:       map[string]interface{}{"name": "Ada L."},
+		Conditions: map[string]interface{}{"id": 1},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &Explanation{
+		Source: "mysql",
+		Native: map[string]interface{}{
+			"sql":  "UPDATE employees SET name = ? WHERE id = ? AND region IN (?, ?)",
+			"args": []interface{}{"Ada L.", 1, "west", "north"},
+		},
+		Policies: []AppliedPolicy{
+			{Name: "sales-region", Conditions: map[string]interface{}{"region": map[string]interface{}{"$in": []interface{}{"west", "north"}}}},
+			{Name: "salary", Dropped: []string{"salary"}},
+			{Name: "contact", Masked: []string{"phone"}},
+		},
+	}, explanation)
+
+	// Writes may not move rows out of the caller's region, or add rows outside it.
+	_, err = executor.Explain(rep, Query{Type: Update, Collection: "employees", Data: map[string]interface{}{"region": "east"}})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypePermission), "%v", err)
+	_, err = executor.Explain(rep, Query{Type: Insert, Collection: "employees", Data: map[string]interface{}{"name": "Bo", "region": "east"}})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypePermission), "%v", err)
+	_, err = executor.Explain(rep, Query{Type: Insert, Collection: "employees", Data: map[string]interface{}{"name": "Bo", "region": "north"}})
+	require.NoError(t, err)
+	_, err = executor.Explain(rep, Query{Type: Insert, Collection: "employees", Data: map[string]interface{}{"name": "Bo", "region": "north", "salary": 1}})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypePermission), "%v", err)
+
+	// Policies of other collections do not apply.
+	explanation, err = executor.Explain(rep, Query{Type: Select, Collection: "teams"})
+	require.NoError(t, err)
+	require.Len(t, explanation.Policies, 2)
+	assert.Equal(t, "salary", explanation.Policies[0].Name)
+}
+
+func TestMergeCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing interface{}
+		required interface{}
+		expect   interface{}
+	}{
+		{"No existing condition", nil, "west", "west"},
+		{"Same value", "west", "west", map[string]interface{}{"$eq": "west"}},
+		{"Different values", "east", "west", map[string]interface{}{"$in": []interface{}{}}},
+		{"Other operators", map[string]interface{}{"$ne": "north"}, "west", map[string]interface{}{"$ne": "north", "$eq": "west"}},
+		{"In lists", map[string]interface{}{"$in": []interface{}{"a", "b"}}, map[string]interface{}{"$in": []interface{}{"b", "c"}}, map[string]interface{}{"$in": []interface{}{"b"}}},
+		{"Not in lists", map[string]interface{}{"$nin": []interface{}{"a"}}, map[string]interface{}{"$nin": []interface{}{"b"}}, map[string]interface{}{"$nin": []interface{}{"a", "b"}}},
+		{"Not equal", map[string]interface{}{"$ne": "a"}, map[string]interface{}{"$ne": "b"}, map[string]interface{}{"$nin": []interface{}{"a", "b"}}},
+		{"Lower bounds", map[string]interface{}{"$gte": 10}, map[string]interface{}{"$gte": 20}, map[string]interface{}{"$gte": 20}},
+		{"Upper bounds", map[string]interface{}{"$lt": 10}, map[string]interface{}{"$lt": 20}, map[string]interface{}{"$lt": 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := mergeCondition(tt.existing, tt.required)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, merged)
+		})
+	}
+
+	_, err := mergeCondition(map[string]interface{}{"$regex": "^w"}, map[string]interface{}{"$regex": "t$"})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation), "%v", err)
+}
+
+func TestPolicySet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	data, err := json.Marshal(map[string][]Policy{"hr": testPolicies()})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	set, err := LoadPolicySet(path)
+	require.NoError(t, err)
+	assert.Len(t, set.For("hr"), 3)
+	assert.Empty(t, set.For("shop"))
+	assert.True(t, set.Restricts("hr", Principal{Roles: []string{"sales"}}))
+	assert.False(t, set.Restricts("hr", Principal{Roles: []string{"finance"}}))
+	assert.False(t, set.Restricts("shop", Principal{}))
+	assert.True(t, set.RestrictsAny(Principal{}))
+	assert.False(t, set.RestrictsAny(Principal{Roles: []string{"finance"}}))
+
+	set, err = LoadPolicySet("")
+	require.NoError(t, err)
+	assert.Empty(t, set.For("hr"))
+
+	invalid := []Policy{
+		{Conditions: map[string]interface{}{"region": "west"}},
+		{Name: "empty"},
+		{Name: "bad-operator", Conditions: map[string]interface{}{"region": map[string]interface{}{"$near": 1}}},
+		{Name: "bad-action", Columns: []ColumnRule{{Column: "salary", Action: "hide"}}},
+		{Name: "nested-column", Columns: []ColumnRule{{Column: "address.street", Action: DropColumn}}},
+		{Name: "logical", Conditions: map[string]interface{}{"$or": []interface{}{map[string]interface{}{"region": "west"}}}},
+	}
+	for _, p := range invalid {
+		_, err := NewPolicySet(map[string][]Policy{"hr": {p}})
+		assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation), "%s: %v", p.Name, err)
+	}
+}
+
+func TestFederatedPolicies(t *testing.T) {
+	policies, err := NewPolicySet(map[string][]Policy{"hr": testPolicies()})
+	require.NoError(t, err)
+	executor := NewFederatedExecutor(testResolver{"hr": newEmployeesSource(t)}, FederationOptions{Policies: policies})
+	rep := WithPrincipal(context.Background(), Principal{Roles: []string{"sales"}, Attributes: map[string]interface{}{"region": "east"}})
+
+	fq := FederatedQuery{
+		Sources: []FederatedSource{{Alias: "e", Connector: "hr", Collection: "employees.json"}},
+		Fields:  []string{"e.name"},
+	}
+	rows, err := executor.Execute(rep, fq)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"e.name": "Grace"}}, rows)
+
+	plan, err := executor.Plan(fq)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"contact", "salary", "sales-region"}, plan.Sources[0].Policies)
+
+	fq.Fields = []string{"e.name", "e.salary"}
+	_, err = executor.Execute(rep, fq)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypePermission), "%v", err)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 
 	"datasource/connectors"
@@ -20,20 +22,83 @@ const (
 	Delete QueryType = "DELETE"
 )
 
+// AggregateFunction represents an aggregate computed over a field
+type AggregateFunction string
+
+const (
+	Count AggregateFunction = "count"
+	Sum   AggregateFunction = "sum"
+	Avg   AggregateFunction = "avg"
+	Min   AggregateFunction = "min"
+	Max   AggregateFunction = "max"
+)
+
 // Query represents a unified query structure
 type Query struct {
-	Type       QueryType              `json:"type"`
-	Collection string                 `json:"collection"`
-	Fields     []string               `json:"fields,omitempty"`
-	Conditions map[string]interface{} `json:"conditions,omitempty"`
-	Data       map[string]interface{} `json:"data,omitempty"`
-	Limit      int                    `json:"limit,omitempty"`
-	Offset     int                    `json:"offset,omitempty"`
+	Type         QueryType              `json:"type"`
+	Collection   string                 `json:"collection"`
+	Fields       []string               `json:"fields,omitempty"`
+	Conditions   map[string]interface{} `json:"conditions,omitempty"`
+	Data         map[string]interface{} `json:"data,omitempty"`
+	Limit        int                    `json:"limit,omitempty"`
+	Offset       int                    `json:"offset,omitempty"`
+	OrderBy      []OrderBy              `json:"order_by,omitempty"`
+	GroupBy      []string               `json:"group_by,omitempty"`
+	Aggregations []Aggregation          `json:"aggregations,omitempty"`
+	TimeBucket   *TimeBucket            `json:"time_bucket,omitempty"`
+	// Raw is a query in the backend's native language, such as Elasticsearch search DSL.
+	// When set it is sent as is and the structured fields other than Collection are ignored.
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+// OrderBy sorts results by a field or an aggregation alias
+type OrderBy struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// Aggregation computes an aggregate over a field, per group when GroupBy is set
+type Aggregation struct {
+	Function AggregateFunction `json:"function"`
+	// Field is the aggregated field. It may be empty for Count, which then counts rows.
+	Field string `json:"field,omitempty"`
+	// Alias names the result column. It defaults to Name().
+	Alias string `json:"alias,omitempty"`
+}
+
+// TimeBucket groups rows into fixed intervals of a timestamp field
+type TimeBucket struct {
+	Field string `json:"field"`
+	// Interval is a duration such as "30s", "5m" or "1h", or a number of days such as "1d".
+	Interval string `json:"interval"`
+	// Alias names the result column. It defaults to "bucket".
+	Alias string `json:"alias,omitempty"`
+}
+
+// Name returns the result column of the time bucket.
+func (b TimeBucket) Name() string {
+	if b.Alias != "" {
+		return b.Alias
+	}
+	return "bucket"
+}
+
+// Name returns the result column of the aggregation: its alias, or the function
+// and field joined by an underscore, such as "sum_amount" or "count".
+func (a Aggregation) Name() string {
+	if a.Alias != "" {
+		return a.Alias
+	}
+	if a.Field == "" || a.Field == "*" {
+		return string(a.Function)
+	}
+	return string(a.Function) + "_" + a.Field
 }
 
 // QueryExecutor handles query execution across different connector types
 type QueryExecutor struct {
 	connector connectors.Connector
+	policies  []Policy
 }
 
 // NewQueryExecutor creates a new QueryExecutor
@@ -41,8 +106,82 @@ func NewQueryExecutor(connector connectors.Connector) *QueryExecutor {
 	return &QueryExecutor{connector: connector}
 }
 
-// Execute executes the given query on the appropriate connector
+// Execute executes the given query on the appropriate connector. The executor's policies
+// are enforced for the principal of ctx: their conditions are added to the query, and their
+// columns are dropped or masked in the results.
 func (qe *QueryExecutor) Execute(ctx context.Context, query Query) ([]map[string]interface{}, error) {
+	query, enforced, err := qe.enforce(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := qe.execute(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return enforced.apply(rows), nil
+}
+
+// Stream executes a query as Execute does, and returns an iterator over its rows. The rows of
+// connectors that stream results, such as ClickHouse, are read block by block as the
+// iterator is consumed; those of other connectors are read in full and returned as one block.
+func (qe *QueryExecutor) Stream(ctx context.Context, query Query) (connectors.RowIterator, error) {
+	query, enforced, err := qe.enforce(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	it, err := qe.stream(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &enforcedRows{RowIterator: it, enforced: enforced}, nil
+}
+
+func (qe *QueryExecutor) stream(ctx context.Context, query Query) (connectors.RowIterator, error) {
+	if c, ok := qe.connector.(*connectors.ClickHouseConnector); ok && query.Type == Select {
+		sqlQuery, args, err := buildSQLQuery(query, clickhouseDialect{})
+		if err != nil {
+			return nil, err
+		}
+		return c.Stream(ctx, sqlQuery, args...)
+	}
+	rows, err := qe.execute(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &rowBlock{rows: rows}, nil
+}
+
+// rowBlock is a RowIterator over rows already read.
+type rowBlock struct {
+	rows []map[string]interface{}
+	done bool
+}
+
+func (b *rowBlock) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	if b.done {
+		return nil, io.EOF
+	}
+	b.done = true
+	return b.rows, nil
+}
+
+func (b *rowBlock) Close() error { return nil }
+
+// enforcedRows drops and masks the policy columns of each block of rows.
+type enforcedRows struct {
+	connectors.RowIterator
+	enforced *enforcement
+}
+
+func (r *enforcedRows) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	rows, err := r.RowIterator.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.enforced.apply(rows), nil
+}
+
+func (qe *QueryExecutor) execute(ctx context.Context, query Query) ([]map[string]interface{}, error) {
 	switch c := qe.connector.(type) {
 	case *connectors.SQLConnector:
 		return qe.executeSQL(ctx, c, query)
@@ -52,13 +191,26 @@ func (qe *QueryExecutor) Execute(ctx context.Context, query Query) ([]map[string
 		return qe.executeRedis(ctx, c, query)
 	case *connectors.FileConnector:
 		return qe.executeFile(ctx, c, query)
+	case *connectors.S3Connector:
+		return qe.executeS3(ctx, c, query)
+	case *connectors.ElasticsearchConnector:
+		return qe.executeElasticsearch(ctx, c, query)
+	case *connectors.CassandraConnector:
+		return qe.executeCassandra(ctx, c, query)
+	case *connectors.ClickHouseConnector:
+		return qe.executeClickHouse(ctx, c, query)
+	case *connectors.APIConnector:
+		return qe.executeAPI(ctx, c, query)
 	default:
 		return nil, errors.NewError(errors.ErrorTypeUnsupported, "unsupported connector type", nil)
 	}
 }
 
 func (qe *QueryExecutor) executeSQL(ctx context.Context, connector *connectors.SQLConnector, query Query) ([]map[string]interface{}, error) {
-	sqlQuery, args := buildSQLQuery(query)
+	sqlQuery, args, err := buildSQLQuery(query, dialectFor(connector.Driver()))
+	if err != nil {
+		return nil, err
+	}
 	if query.Type == Select {
 		return connector.Query(ctx, sqlQuery, args...)
 	}
@@ -70,9 +222,20 @@ func (qe *QueryExecutor) executeSQL(ctx context.Context, connector *connectors.S
 }
 
 func (qe *QueryExecutor) executeMongo(ctx context.Context, connector *connectors.MongoConnector, query Query) ([]map[string]interface{}, error) {
+	filter, err := mongoFilter(query.Conditions)
+	if err != nil {
+		return nil, err
+	}
 	switch query.Type {
 	case Select:
-		filterJSON, err := json.Marshal(query.Conditions)
+		pipeline, ok, err := buildMongoPipeline(query, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return connector.Aggregate(ctx, query.Collection, pipeline)
+		}
+		filterJSON, err := json.Marshal(filter)
 		if err != nil {
 			return nil, errors.NewError(errors.ErrorTypeQuery, "failed to marshal query conditions", err)
 		}
@@ -84,13 +247,13 @@ func (qe *QueryExecutor) executeMongo(ctx context.Context, connector *connectors
 		}
 		return []map[string]interface{}{{"affected_documents": affected}}, nil
 	case Update:
-		affected, err := connector.Execute(ctx, "update", query.Collection, query.Conditions, query.Data)
+		affected, err := connector.Execute(ctx, "update", query.Collection, filter, query.Data)
 		if err != nil {
 			return nil, err
 		}
 		return []map[string]interface{}{{"affected_documents": affected}}, nil
 	case Delete:
-		affected, err := connector.Execute(ctx, "delete", query.Collection, query.Conditions)
+		affected, err := connector.Execute(ctx, "delete", query.Collection, filter)
 		if err != nil {
 			return nil, err
 		}
@@ -103,59 +266,279 @@ func (qe *QueryExecutor) executeMongo(ctx context.Context, connector *connectors
 func (qe *QueryExecutor) executeRedis(ctx context.Context, connector *connectors.RedisConnector, query Query) ([]map[string]interface{}, error) {
 	switch query.Type {
 	case Select:
-		return connector.Query(ctx, query.Collection)
-	case Insert, Update:
-		value, err := json.Marshal(query.Data)
+		rows, err := connector.Query(ctx, query.Collection)
 		if err != nil {
-			return nil, errors.NewError(errors.ErrorTypeQuery, "failed to marshal Redis data", err)
+			return nil, err
 		}
-		affected, err := connector.Execute(ctx, "SET", query.Collection, string(value))
+		return filterRows(rows, query)
+	case Insert, Update, Delete:
+		cmds, column, err := redisWriteCommands(ctx, connector, query)
 		if err != nil {
 			return nil, err
 		}
-		return []map[string]interface{}{{"affected_keys": affected}}, nil
-	case Delete:
-		affected, err := connector.Execute(ctx, "DEL", query.Collection)
+		affected, err := executeRedisCommands(ctx, connector, cmds)
 		if err != nil {
 			return nil, err
 		}
-		return []map[string]interface{}{{"affected_keys": affected}}, nil
+		return []map[string]interface{}{{column: affected}}, nil
 	default:
 		return nil, errors.NewError(errors.ErrorTypeUnsupported, "unsupported query type for Redis", nil)
 	}
 }
 
+// redisWriteCommands returns the commands that run an insert, update or delete, and the name
+// of the result column for the sum of their replies. It only reads from Redis: the types of
+// the keys, and the rows that a delete with conditions removes.
+func redisWriteCommands(ctx context.Context, connector *connectors.RedisConnector, query Query) ([]redisCommand, string, error) {
+	if query.Type != Delete {
+		keyType, err := connector.Type(ctx, query.Collection)
+		if err != nil {
+			return nil, "", err
+		}
+		return buildRedisWrite(query, keyType)
+	}
+
+	if len(query.Conditions) == 0 {
+		keys := []string{query.Collection}
+		if connectors.IsRedisPattern(query.Collection) {
+			var err error
+			if keys, err = connector.Keys(ctx, query.Collection, connectors.RedisQueryOptions{}); err != nil {
+				return nil, "", err
+			}
+		}
+		// Each key is deleted by its own command, as a cluster rejects commands whose
+		// keys are in different slots.
+		cmds := make([]redisCommand, len(keys))
+		for i, k := range keys {
+			cmds[i] = redisCommand{"DEL", k}
+		}
+		return cmds, "affected_keys", nil
+	}
+
+	rows, err := connector.Query(ctx, query.Collection)
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err = filterRows(rows, Query{Conditions: query.Conditions})
+	if err != nil {
+		return nil, "", err
+	}
+	types := map[string]string{}
+	for _, row := range rows {
+		key, _ := row[connectors.RedisKeyColumn].(string)
+		if _, ok := types[key]; !ok {
+			if types[key], err = connector.Type(ctx, key); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	return buildRedisDelete(rows, types), "affected_rows", nil
+}
+
+// executeRedisCommands sends commands in one pipeline and returns the sum of their counts.
+func executeRedisCommands(ctx context.Context, connector *connectors.RedisConnector, cmds []redisCommand) (int64, error) {
+	if len(cmds) == 0 {
+		return 0, nil
+	}
+	commands := make([][]interface{}, len(cmds))
+	for i, cmd := range cmds {
+		commands[i] = cmd
+	}
+	counts, err := connector.ExecutePipeline(ctx, commands)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total, nil
+}
+
 func (qe *QueryExecutor) executeFile(ctx context.Context, connector *connectors.FileConnector, query Query) ([]map[string]interface{}, error) {
+	switch query.Type {
+	case Select:
+		rows, err := connector.Query(ctx, query.Collection)
+		if err != nil {
+			return nil, err
+		}
+		return filterRows(rows, query)
+	case Insert:
+		affected, err := connector.Execute(ctx, connectors.FileCommandInsert, query.Collection, query.Data)
+		if err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{{"affected_rows": affected}}, nil
+	default:
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, "only SELECT and INSERT queries are supported for file connector", nil)
+	}
+}
+
+func (qe *QueryExecutor) executeS3(ctx context.Context, connector *connectors.S3Connector, query Query) ([]map[string]interface{}, error) {
+	if query.Type != Select {
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, "only SELECT queries are supported for S3 connector", nil)
+	}
+	rows, err := connector.Query(ctx, query.Collection)
+	if err != nil {
+		return nil, err
+	}
+	return filterRows(rows, query)
+}
+
+// executeAPI reads the records at the collection's path and filters them in memory, or posts
+// the data of an insert to it.
+func (qe *QueryExecutor) executeAPI(ctx context.Context, connector *connectors.APIConnector, query Query) ([]map[string]interface{}, error) {
+	switch query.Type {
+	case Select:
+		rows, err := connector.Query(ctx, query.Collection)
+		if err != nil {
+			return nil, err
+		}
+		return filterRows(rows, query)
+	case Insert:
+		affected, err := connector.Execute(ctx, query.Collection, query.Data)
+		if err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{{"affected_rows": affected}}, nil
+	default:
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, "only SELECT and INSERT queries are supported for API connector", nil)
+	}
+}
+
+func (qe *QueryExecutor) executeElasticsearch(ctx context.Context, connector *connectors.ElasticsearchConnector, query Query) ([]map[string]interface{}, error) {
 	if query.Type != Select {
-		return nil, errors.NewError(errors.ErrorTypeUnsupported, "only SELECT queries are supported for file connector", nil)
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, "only SELECT queries are supported for Elasticsearch connector", nil)
+	}
+
+	body := []byte(query.Raw)
+	if len(body) == 0 {
+		search, err := buildElasticsearchQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		body, err = json.Marshal(search)
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeQuery, "failed to marshal search request", err)
+		}
+	}
+	return connector.Query(ctx, string(body), query.Collection)
+}
+
+func (qe *QueryExecutor) executeCassandra(ctx context.Context, connector *connectors.CassandraConnector, query Query) ([]map[string]interface{}, error) {
+	table, err := connector.Table(ctx, query.Collection)
+	if err != nil {
+		return nil, err
+	}
+	cql, args, err := buildCQLQuery(query, table, connector.AllowFiltering())
+	if err != nil {
+		return nil, err
+	}
+	if query.Type == Select {
+		return connector.Query(ctx, cql, args...)
+	}
+	if _, err := connector.Execute(ctx, cql, args...); err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{{"applied": true}}, nil
+}
+
+func (qe *QueryExecutor) executeClickHouse(ctx context.Context, connector *connectors.ClickHouseConnector, query Query) ([]map[string]interface{}, error) {
+	switch query.Type {
+	case Select:
+		sqlQuery, args, err := buildSQLQuery(query, clickhouseDialect{})
+		if err != nil {
+			return nil, err
+		}
+		return connector.Query(ctx, sqlQuery, args...)
+	case Insert:
+		affected, err := connector.InsertBatch(ctx, query.Collection, []map[string]interface{}{query.Data})
+		if err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{{"affected_rows": affected}}, nil
+	case Delete:
+		sqlQuery, args, err := buildSQLQuery(query, clickhouseDialect{})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := connector.Execute(ctx, sqlQuery, args...); err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{{"applied": true}}, nil
+	default:
+		return nil, errors.NewError(errors.ErrorTypeUnsupported, "only SELECT, INSERT and DELETE queries are supported for ClickHouse connector", nil)
 	}
-	return connector.Query(ctx, query.Collection)
 }
 
-func buildSQLQuery(query Query) (string, []interface{}) {
+// buildSQLQuery translates a query into SQL for the given dialect, with bind parameters
+// for every value.
+func buildSQLQuery(query Query, d dialect) (string, []interface{}, error) {
 	var sqlQuery strings.Builder
 	var args []interface{}
+	bind := func(v interface{}) string {
+		args = append(args, v)
+		return d.Placeholder(len(args))
+	}
 
+	var groupBy []string
 	switch query.Type {
 	case Select:
+		var bucket string
+		if query.TimeBucket != nil {
+			interval, err := parseInterval(query.TimeBucket.Interval)
+			if err != nil {
+				return "", nil, err
+			}
+			if bucket, err = d.TimeBucket(sqlIdent(d, query.TimeBucket.Field), interval); err != nil {
+				return "", nil, err
+			}
+			groupBy = append(groupBy, bucket)
+		}
+		for _, field := range query.GroupBy {
+			groupBy = append(groupBy, sqlIdent(d, field))
+		}
+
+		var selectList []string
+		for _, field := range query.Fields {
+			if field != "*" {
+				field = sqlIdent(d, field)
+			}
+			selectList = append(selectList, field)
+		}
+		if len(selectList) == 0 && len(query.Aggregations) > 0 {
+			for _, field := range query.GroupBy {
+				selectList = append(selectList, sqlIdent(d, field))
+			}
+		}
+		if bucket != "" {
+			selectList = append([]string{bucket + " AS " + sqlIdent(d, query.TimeBucket.Name())}, selectList...)
+		}
+		for _, agg := range query.Aggregations {
+			expr, err := sqlAggregate(agg, d)
+			if err != nil {
+				return "", nil, err
+			}
+			selectList = append(selectList, expr)
+		}
+
 		sqlQuery.WriteString("SELECT ")
-		if len(query.Fields) > 0 {
-			sqlQuery.WriteString(strings.Join(query.Fields, ", "))
+		if len(selectList) > 0 {
+			sqlQuery.WriteString(strings.Join(selectList, ", "))
 		} else {
 			sqlQuery.WriteString("*")
 		}
 		sqlQuery.WriteString(" FROM ")
-		sqlQuery.WriteString(query.Collection)
+		sqlQuery.WriteString(sqlIdent(d, query.Collection))
 	case Insert:
 		sqlQuery.WriteString("INSERT INTO ")
-		sqlQuery.WriteString(query.Collection)
+		sqlQuery.WriteString(sqlIdent(d, query.Collection))
 		sqlQuery.WriteString(" (")
 		var columns []string
 		var values []string
-		for k, v := range query.Data {
-			columns = append(columns, k)
-			values = append(values, "?")
-			args = append(args, v)
+		for _, k := range sortedKeys(query.Data) {
+			columns = append(columns, sqlIdent(d, k))
+			values = append(values, bind(query.Data[k]))
 		}
 		sqlQuery.WriteString(strings.Join(columns, ", "))
 		sqlQuery.WriteString(") VALUES (")
@@ -163,37 +546,179 @@ func buildSQLQuery(query Query) (string, []interface{}) {
 		sqlQuery.WriteString(")")
 	case Update:
 		sqlQuery.WriteString("UPDATE ")
-		sqlQuery.WriteString(query.Collection)
+		sqlQuery.WriteString(sqlIdent(d, query.Collection))
 		sqlQuery.WriteString(" SET ")
 		var sets []string
-		for k, v := range query.Data {
-			sets = append(sets, k+" = ?")
-			args = append(args, v)
+		for _, k := range sortedKeys(query.Data) {
+			sets = append(sets, sqlIdent(d, k)+" = "+bind(query.Data[k]))
 		}
 		sqlQuery.WriteString(strings.Join(sets, ", "))
 	case Delete:
 		sqlQuery.WriteString("DELETE FROM ")
-		sqlQuery.WriteString(query.Collection)
+		sqlQuery.WriteString(sqlIdent(d, query.Collection))
+	default:
+		return "", nil, errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("unsupported query type %s", query.Type), nil)
 	}
 
 	if len(query.Conditions) > 0 && (query.Type == Select || query.Type == Update || query.Type == Delete) {
-		sqlQuery.WriteString(" WHERE ")
-		var conditions []string
-		for k, v := range query.Conditions {
-			conditions = append(conditions, k+" = ?")
-			args = append(args, v)
+		filter, err := parseRowFilter(query.Conditions)
+		if err != nil {
+			return "", nil, err
+		}
+		where, err := sqlFilter(filter, d, bind)
+		if err != nil {
+			return "", nil, err
 		}
-		sqlQuery.WriteString(strings.Join(conditions, " AND "))
+		sqlQuery.WriteString(" WHERE ")
+		sqlQuery.WriteString(strings.Join(where, " AND "))
 	}
 
 	if query.Type == Select {
-		if query.Limit > 0 {
-			sqlQuery.WriteString(fmt.Sprintf(" LIMIT %d", query.Limit))
+		if len(groupBy) > 0 {
+			sqlQuery.WriteString(" GROUP BY ")
+			sqlQuery.WriteString(strings.Join(groupBy, ", "))
+		}
+		if len(query.OrderBy) > 0 {
+			var order []string
+			for _, o := range query.OrderBy {
+				if o.Desc {
+					order = append(order, sqlIdent(d, o.Field)+" DESC")
+				} else {
+					order = append(order, sqlIdent(d, o.Field)+" ASC")
+				}
+			}
+			sqlQuery.WriteString(" ORDER BY ")
+			sqlQuery.WriteString(strings.Join(order, ", "))
+		}
+		sqlQuery.WriteString(d.Limit(query.Limit, query.Offset))
+	}
+
+	return sqlQuery.String(), args, nil
+}
+
+// sqlFilter returns the clauses that a filter's rows satisfy, to be joined by AND. Logical
+// operators become parenthesised groups: OR for $or, AND for $and and NOT (... OR ...)
+// for $nor.
+func sqlFilter(f *rowFilter, d dialect, bind func(interface{}) string) ([]string, error) {
+	var clauses []string
+	for _, c := range f.conditions {
+		clause, err := sqlCondition(c, d, bind)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	for _, lf := range f.logical {
+		var groups []string
+		for _, sub := range lf.filters {
+			parts, err := sqlFilter(sub, d, bind)
+			if err != nil {
+				return nil, err
+			}
+			switch len(parts) {
+			case 0:
+				groups = append(groups, "1 = 1")
+			case 1:
+				groups = append(groups, parts[0])
+			default:
+				groups = append(groups, "("+strings.Join(parts, " AND ")+")")
+			}
+		}
+		switch lf.op {
+		case OpAnd:
+			clauses = append(clauses, groups...)
+		case OpOr:
+			clauses = append(clauses, "("+strings.Join(groups, " OR ")+")")
+		case OpNor:
+			clauses = append(clauses, "NOT ("+strings.Join(groups, " OR ")+")")
+		}
+	}
+	return clauses, nil
+}
+
+// sqlCondition returns the WHERE clause for a single condition.
+func sqlCondition(c condition, d dialect, bind func(interface{}) string) (string, error) {
+	field := sqlIdent(d, c.Field)
+	switch c.Op {
+	case OpEq:
+		if c.Value == nil {
+			return field + " IS NULL", nil
+		}
+	case OpNe:
+		if c.Value == nil {
+			return field + " IS NOT NULL", nil
+		}
+	case OpIn, OpNin:
+		list := c.Value.([]interface{})
+		if len(list) == 0 {
+			// Nothing is in an empty list.
+			if c.Op == OpIn {
+				return "1 = 0", nil
+			}
+			return "1 = 1", nil
+		}
+		placeholders := make([]string, len(list))
+		for i, v := range list {
+			placeholders[i] = bind(v)
 		}
-		if query.Offset > 0 {
-			sqlQuery.WriteString(fmt.Sprintf(" OFFSET %d", query.Offset))
+		keyword := " IN ("
+		if c.Op == OpNin {
+			keyword = " NOT IN ("
 		}
+		return field + keyword + strings.Join(placeholders, ", ") + ")", nil
+	case OpExists:
+		if c.Value.(bool) {
+			return field + " IS NOT NULL", nil
+		}
+		return field + " IS NULL", nil
+	case OpRegex:
+		return d.Regex(field, bind(c.Value))
+	case OpLike:
+		return field + " LIKE " + bind(c.Value), nil
+	}
+
+	op := sqlOperators[c.Op]
+	if c.Op == OpNe {
+		op = "<>"
 	}
+	return field + " " + op + " " + bind(c.Value), nil
+}
 
-	return sqlQuery.String(), args
+// sqlAggregate returns the select expression for an aggregation.
+func sqlAggregate(agg Aggregation, d dialect) (string, error) {
+	var fn string
+	switch agg.Function {
+	case Count, Sum, Avg, Min, Max:
+		fn = strings.ToUpper(string(agg.Function))
+	default:
+		return "", errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("unsupported aggregate function %s", agg.Function), nil)
+	}
+	field := agg.Field
+	if field == "" || field == "*" {
+		if agg.Function != Count {
+			return "", errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("%s requires a field", agg.Function), nil)
+		}
+		return fmt.Sprintf("%s(*) AS %s", fn, sqlIdent(d, agg.Name())), nil
+	}
+	return fmt.Sprintf("%s(%s) AS %s", fn, sqlIdent(d, field), sqlIdent(d, agg.Name())), nil
+}
+
+// sqlOperators maps comparison operators to their CQL and SQL form.
+var sqlOperators = map[Operator]string{
+	OpEq:  "=",
+	OpNe:  "!=",
+	OpGt:  ">",
+	OpGte: ">=",
+	OpLt:  "<",
+	OpLte: "<=",
+}
+
+// sortedKeys returns the keys of m in sorted order, so generated statements are deterministic.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,222 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"datasource/connectors"
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildSQLQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		driver   string
+		query    Query
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:    "Select all",
+			driver:  "mysql",
+			query:   Query{Type: Select, Collection: "users", Limit: 10, Offset: 20},
+			wantSQL: "SELECT * FROM users LIMIT 10 OFFSET 20",
+		},
+		{
+			name:   "Like on SQLite",
+			driver: "sqlite3",
+			query: Query{
+				Type:       Select,
+				Collection: "logs",
+				Conditions: map[string]interface{}{"msg": map[string]interface{}{"$like": "disk%full"}},
+			},
+			wantSQL:  "SELECT * FROM logs WHERE msg LIKE ?",
+			wantArgs: []interface{}{"disk%full"},
+		},
+		{
+			name:   "Logical operators",
+			driver: "postgres",
+			query: Query{
+				Type:       Select,
+				Collection: "users",
+				Conditions: map[string]interface{}{
+					"active": true,
+					"$or": []interface{}{
+						map[string]interface{}{"role": "admin"},
+						map[string]interface{}{"age": map[string]interface{}{"$gte": 18}, "country": "NG"},
+					},
+					"$nor": []interface{}{map[string]interface{}{"banned": true}, map[string]interface{}{"deleted": nil}},
+					"$and": []interface{}{map[string]interface{}{"name": map[string]interface{}{"$like": "A%"}}},
+				},
+			},
+			wantSQL:  "SELECT * FROM users WHERE active = $1 AND name LIKE $2 AND NOT (banned = $3 OR deleted IS NULL) AND (role = $4 OR (age >= $5 AND country = $6))",
+			wantArgs: []interface{}{true, "A%", true, "admin", 18, "NG"},
+		},
+		{
+			name:   "Postgres placeholders and operators",
+			driver: "postgres",
+			query: Query{
+				Type:       Select,
+				Collection: "users",
+				Fields:     []string{"id", "name"},
+				Conditions: map[string]interface{}{
+					"age":     map[string]interface{}{"$gte": 18, "$lt": 65},
+					"country": map[string]interface{}{"$in": []interface{}{"NG", "GH"}},
+					"email":   map[string]interface{}{"$regex": "@example\\.com$"},
+					"deleted": nil,
+					"status":  map[string]interface{}{"$ne": "banned"},
+				},
+				OrderBy: []OrderBy{{Field: "name"}, {Field: "id", Desc: true}},
+			},
+			wantSQL:  "SELECT id, name FROM users WHERE age >= $1 AND age < $2 AND country IN ($3, $4) AND deleted IS NULL AND email ~ $5 AND status <> $6 ORDER BY name ASC, id DESC",
+			wantArgs: []interface{}{18, 65, "NG", "GH", "@example\\.com$", "banned"},
+		},
+		{
+			name:   "Aggregation with time bucket",
+			driver: "clickhouse",
+			query: Query{
+				Type:         Select,
+				Collection:   "events",
+				Conditions:   map[string]interface{}{"kind": "click"},
+				GroupBy:      []string{"country"},
+				Aggregations: []Aggregation{{Function: Count}, {Function: Sum, Field: "value", Alias: "total"}},
+				TimeBucket:   &TimeBucket{Field: "ts", Interval: "5m"},
+				OrderBy:      []OrderBy{{Field: "bucket"}},
+				Limit:        100,
+				Offset:       200,
+			},
+			wantSQL:  "SELECT toStartOfInterval(ts, INTERVAL 300 second) AS bucket, country, COUNT(*) AS count, SUM(value) AS total FROM events WHERE kind = ? GROUP BY toStartOfInterval(ts, INTERVAL 300 second), country ORDER BY bucket ASC LIMIT 200, 100",
+			wantArgs: []interface{}{"click"},
+		},
+		{
+			name:    "Postgres time bucket",
+			driver:  "postgres",
+			query:   Query{Type: Select, Collection: "events", TimeBucket: &TimeBucket{Field: "ts", Interval: "1d", Alias: "day"}, Aggregations: []Aggregation{{Function: Count}}},
+			wantSQL: "SELECT to_timestamp(floor(extract(epoch from ts) / 86400) * 86400) AS day, COUNT(*) AS count FROM events GROUP BY to_timestamp(floor(extract(epoch from ts) / 86400) * 86400)",
+		},
+		{
+			name:     "Insert",
+			driver:   "postgres",
+			query:    Query{Type: Insert, Collection: "users", Data: map[string]interface{}{"name": "Ada", "age": 36}},
+			wantSQL:  "INSERT INTO users (age, name) VALUES ($1, $2)",
+			wantArgs: []interface{}{36, "Ada"},
+		},
+		{
+			name:     "Update",
+			driver:   "sqlite",
+			query:    Query{Type: Update, Collection: "users", Data: map[string]interface{}{"name": "Ada"}, Conditions: map[string]interface{}{"id": 1}},
+			wantSQL:  "UPDATE users SET name = ? WHERE id = ?",
+			wantArgs: []interface{}{"Ada", 1},
+		},
+		{
+			name:     "Delete",
+			driver:   "postgres",
+			query:    Query{Type: Delete, Collection: "users", Conditions: map[string]interface{}{"id": map[string]interface{}{"$nin": []interface{}{1, 2}}, "email": map[string]interface{}{"$exists": false}}},
+			wantSQL:  "DELETE FROM users WHERE email IS NULL AND id NOT IN ($1, $2)",
+			wantArgs: []interface{}{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := buildSQLQuery(tt.query, dialectFor(tt.driver))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSQL, sql)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
+
+func TestBuildSQLQueryQuotesIdentifiers(t *testing.T) {
+	q, err := Parse(`SELECT "order", "a b", "1; DROP TABLE users; --" FROM t WHERE "x y" = 1 ORDER BY "order"`)
+	require.NoError(t, err)
+
+	sql, args, err := buildSQLQuery(q, dialectFor("postgres"))
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "order", "a b", "1; DROP TABLE users; --" FROM t WHERE "x y" = $1 ORDER BY "order" ASC`, sql)
+	assert.Equal(t, []interface{}{int64(1)}, args)
+
+	sql, _, err = buildSQLQuery(q, dialectFor("mysql"))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT `order`, `a b`, `1; DROP TABLE users; --` FROM t WHERE `x y` = ? ORDER BY `order` ASC", sql)
+
+	// Quotes within names are escaped, and each part of a dotted name is quoted on its own.
+	sql, _, err = buildSQLQuery(Query{
+		Type:       Insert,
+		Collection: "public.user",
+		Data:       map[string]interface{}{`a"b`: 1},
+	}, dialectFor("postgres"))
+	require.NoError(t, err)
+	assert.Equal(t, `INSERT INTO public."user" ("a""b") VALUES ($1)`, sql)
+
+	sql, _, err = buildSQLQuery(Query{
+		Type:         Select,
+		Collection:   "events",
+		GroupBy:      []string{"group"},
+		Aggregations: []Aggregation{{Function: Sum, Field: "x`y", Alias: "total; --"}},
+	}, dialectFor("clickhouse"))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT `group`, SUM(`x``y`) AS `total; --` FROM events GROUP BY `group`", sql)
+}
+
+func TestBuildSQLQueryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  string
+		query   Query
+		errType errors.ErrorType
+	}{
+		{"Regex without support", "sqlite", Query{Type: Select, Conditions: map[string]interface{}{"a": map[string]interface{}{"$regex": "x"}}}, errors.ErrorTypeUnsupported},
+		{"Time bucket without support", "", Query{Type: Select, TimeBucket: &TimeBucket{Field: "ts", Interval: "1h"}}, errors.ErrorTypeUnsupported},
+		{"Invalid interval", "postgres", Query{Type: Select, TimeBucket: &TimeBucket{Field: "ts", Interval: "500ms"}}, errors.ErrorTypeValidation},
+		{"Sum without field", "postgres", Query{Type: Select, Aggregations: []Aggregation{{Function: Sum}}}, errors.ErrorTypeValidation},
+		{"Unknown type", "postgres", Query{Type: "MERGE"}, errors.ErrorTypeUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := buildSQLQuery(tt.query, dialectFor(tt.driver))
+			assert.True(t, errors.IsErrorType(err, tt.errType), "%v", err)
+		})
+	}
+}
+
+func TestQueryExecutorAPI(t *testing.T) {
+	var posted map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&posted))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		assert.Equal(t, "/users", r.URL.Path)
+		w.Write([]byte(`[{"name": "ada", "age": 36}, {"name": "alan", "age": 41}, {"name": "grace", "age": 85}]`))
+	}))
+	defer server.Close()
+	connector := connectors.NewAPIConnector(&connectors.Config{BaseURL: server.URL, TimeoutSeconds: 5})
+	require.NoError(t, connector.Connect(context.Background()))
+	executor := NewQueryExecutor(connector)
+
+	rows, err := executor.Execute(context.Background(), Query{
+		Type:       Select,
+		Collection: "/users",
+		Fields:     []string{"name"},
+		Conditions: map[string]interface{}{"name": map[string]interface{}{"$like": "a%"}},
+		OrderBy:    []OrderBy{{Field: "age", Desc: true}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"name": "alan"}, {"name": "ada"}}, rows)
+
+	rows, err = executor.Execute(context.Background(), Query{Type: Insert, Collection: "/users", Data: map[string]interface{}{"name": "edsger"}})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"affected_rows": int64(1)}}, rows)
+	assert.Equal(t, map[string]interface{}{"name": "edsger"}, posted)
+
+	_, err = executor.Execute(context.Background(), Query{Type: Delete, Collection: "/users"})
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeUnsupported))
+}
@@ -0,0 +1,161 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"datasource/connectors"
+	"pkg/common/errors"
+)
+
+// redisCommand is a Redis command and its arguments.
+type redisCommand []interface{}
+
+// buildRedisWrite returns the commands that store query.Data in a key of the given type, and
+// the name of the result column for the sum of their replies.
+//
+// Writes follow the shape of the rows that RedisConnector.Query returns for the type, so a row
+// that was read can be written back: strings store Data as a JSON document, hashes set a field
+// per column, lists append Data["value"], sets add Data["member"], sorted sets add
+// Data["member"] with Data["score"], streams add an entry with a field per column, and
+// RedisJSON keys replace the document on insert and set one path per column on update. A key
+// that does not exist is written as a string.
+func buildRedisWrite(query Query, keyType string) ([]redisCommand, string, error) {
+	if len(query.Data) == 0 {
+		return nil, "", errors.NewError(errors.ErrorTypeValidation, "Redis writes require data", nil)
+	}
+	if len(query.Conditions) > 0 {
+		return nil, "", errors.NewError(errors.ErrorTypeUnsupported, "conditions are not supported for Redis inserts and updates", nil)
+	}
+	if connectors.IsRedisPattern(query.Collection) {
+		return nil, "", errors.NewError(errors.ErrorTypeValidation, "Redis writes require a single key, not a pattern", nil)
+	}
+	key := query.Collection
+
+	required := func(field string) (interface{}, error) {
+		v, ok := query.Data[field]
+		if !ok {
+			return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("writing to a Redis %s requires %q in data", keyType, field), nil)
+		}
+		return redisArg(v)
+	}
+
+	switch keyType {
+	case connectors.RedisTypeNone, connectors.RedisTypeString:
+		value, err := json.Marshal(query.Data)
+		if err != nil {
+			return nil, "", errors.NewError(errors.ErrorTypeQuery, "failed to marshal Redis data", err)
+		}
+		return []redisCommand{{"SET", key, string(value)}}, "affected_keys", nil
+	case connectors.RedisTypeHash:
+		cmd := redisCommand{"HSET", key}
+		for _, field := range sortedKeys(query.Data) {
+			value, err := redisArg(query.Data[field])
+			if err != nil {
+				return nil, "", err
+			}
+			cmd = append(cmd, field, value)
+		}
+		return []redisCommand{cmd}, "affected_fields", nil
+	case connectors.RedisTypeList:
+		value, err := required("value")
+		if err != nil {
+			return nil, "", err
+		}
+		return []redisCommand{{"RPUSH", key, value}}, "length", nil
+	case connectors.RedisTypeSet:
+		member, err := required("member")
+		if err != nil {
+			return nil, "", err
+		}
+		return []redisCommand{{"SADD", key, member}}, "affected_rows", nil
+	case connectors.RedisTypeZSet:
+		member, err := required("member")
+		if err != nil {
+			return nil, "", err
+		}
+		score, ok := toFloat(query.Data["score"])
+		if !ok {
+			return nil, "", errors.NewError(errors.ErrorTypeValidation, "writing to a Redis zset requires a numeric \"score\" in data", nil)
+		}
+		// CH counts members whose score changed as well as new members.
+		return []redisCommand{{"ZADD", key, "CH", score, member}}, "affected_rows", nil
+	case connectors.RedisTypeStream:
+		if query.Type != Insert {
+			return nil, "", errors.NewError(errors.ErrorTypeUnsupported, "stream entries cannot be updated", nil)
+		}
+		cmd := redisCommand{"XADD", key, "*"}
+		for _, field := range sortedKeys(query.Data) {
+			value, err := redisArg(query.Data[field])
+			if err != nil {
+				return nil, "", err
+			}
+			cmd = append(cmd, field, value)
+		}
+		return []redisCommand{cmd}, "affected_rows", nil
+	case connectors.RedisTypeJSON:
+		if query.Type == Insert {
+			doc, err := json.Marshal(query.Data)
+			if err != nil {
+				return nil, "", errors.NewError(errors.ErrorTypeQuery, "failed to marshal Redis data", err)
+			}
+			return []redisCommand{{"JSON.SET", key, "$", string(doc)}}, "affected_keys", nil
+		}
+		var cmds []redisCommand
+		for _, field := range sortedKeys(query.Data) {
+			name, _ := json.Marshal(field)
+			value, err := json.Marshal(query.Data[field])
+			if err != nil {
+				return nil, "", errors.NewError(errors.ErrorTypeQuery, "failed to marshal Redis data", err)
+			}
+			cmds = append(cmds, redisCommand{"JSON.SET", key, fmt.Sprintf("$[%s]", name), string(value)})
+		}
+		return cmds, "affected_fields", nil
+	default:
+		return nil, "", errors.NewError(errors.ErrorTypeUnsupported, fmt.Sprintf("writing to Redis %s keys is not supported", keyType), nil)
+	}
+}
+
+// buildRedisDelete returns the commands that remove rows read by RedisConnector.Query. List
+// elements, set and sorted set members, and stream entries are removed from their key, and the
+// keys of any other row are deleted. types maps each key to its type.
+func buildRedisDelete(rows []map[string]interface{}, types map[string]string) []redisCommand {
+	var cmds []redisCommand
+	deleted := map[string]bool{}
+	for _, row := range rows {
+		key, _ := row[connectors.RedisKeyColumn].(string)
+		switch types[key] {
+		case connectors.RedisTypeList:
+			cmds = append(cmds, redisCommand{"LREM", key, 1, row["value"]})
+		case connectors.RedisTypeSet:
+			cmds = append(cmds, redisCommand{"SREM", key, row["member"]})
+		case connectors.RedisTypeZSet:
+			cmds = append(cmds, redisCommand{"ZREM", key, row["member"]})
+		case connectors.RedisTypeStream:
+			cmds = append(cmds, redisCommand{"XDEL", key, row[connectors.RedisIDColumn]})
+		default:
+			if !deleted[key] {
+				deleted[key] = true
+				cmds = append(cmds, redisCommand{"DEL", key})
+			}
+		}
+	}
+	return cmds
+}
+
+// redisArg converts a value into a command argument. Scalars are passed as they are, and maps
+// and slices are encoded as JSON.
+func redisArg(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case nil:
+		return "", nil
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, errors.NewError(errors.ErrorTypeQuery, "failed to marshal Redis value", err)
+		}
+		return string(b), nil
+	default:
+		return v, nil
+	}
+}
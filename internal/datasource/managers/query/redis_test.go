@@ -0,0 +1,149 @@
+package query
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"datasource/connectors"
+	"pkg/common/errors"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildRedisWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      Query
+		keyType    string
+		wantCmds   []redisCommand
+		wantColumn string
+	}{
+		{
+			name:       "New key",
+			query:      Query{Type: Insert, Collection: "user:1", Data: map[string]interface{}{"name": "Ada"}},
+			keyType:    connectors.RedisTypeNone,
+			wantCmds:   []redisCommand{{"SET", "user:1", `{"name":"Ada"}`}},
+			wantColumn: "affected_keys",
+		},
+		{
+			name:       "Hash",
+			query:      Query{Type: Update, Collection: "user:1", Data: map[string]interface{}{"role": "admin", "age": 36, "tags": []interface{}{"x"}}},
+			keyType:    connectors.RedisTypeHash,
+			wantCmds:   []redisCommand{{"HSET", "user:1", "age", 36, "role", "admin", "tags", `["x"]`}},
+			wantColumn: "affected_fields",
+		},
+		{
+			name:       "List",
+			query:      Query{Type: Insert, Collection: "queue", Data: map[string]interface{}{"value": "job"}},
+			keyType:    connectors.RedisTypeList,
+			wantCmds:   []redisCommand{{"RPUSH", "queue", "job"}},
+			wantColumn: "length",
+		},
+		{
+			name:       "Set",
+			query:      Query{Type: Insert, Collection: "tags", Data: map[string]interface{}{"member": "red"}},
+			keyType:    connectors.RedisTypeSet,
+			wantCmds:   []redisCommand{{"SADD", "tags", "red"}},
+			wantColumn: "affected_rows",
+		},
+		{
+			name:       "Sorted set",
+			query:      Query{Type: Update, Collection: "scores", Data: map[string]interface{}{"member": "ada", "score": "12.5"}},
+			keyType:    connectors.RedisTypeZSet,
+			wantCmds:   []redisCommand{{"ZADD", "scores", "CH", 12.5, "ada"}},
+			wantColumn: "affected_rows",
+		},
+		{
+			name:       "Stream",
+			query:      Query{Type: Insert, Collection: "events", Data: map[string]interface{}{"kind": "login", "user": 7}},
+			keyType:    connectors.RedisTypeStream,
+			wantCmds:   []redisCommand{{"XADD", "events", "*", "kind", "login", "user", 7}},
+			wantColumn: "affected_rows",
+		},
+		{
+			name:       "JSON insert",
+			query:      Query{Type: Insert, Collection: "doc", Data: map[string]interface{}{"a": 1}},
+			keyType:    connectors.RedisTypeJSON,
+			wantCmds:   []redisCommand{{"JSON.SET", "doc", "$", `{"a":1}`}},
+			wantColumn: "affected_keys",
+		},
+		{
+			name:       "JSON update",
+			query:      Query{Type: Update, Collection: "doc", Data: map[string]interface{}{"a": 1, "b.c": "x"}},
+			keyType:    connectors.RedisTypeJSON,
+			wantCmds:   []redisCommand{{"JSON.SET", "doc", `$["a"]`, "1"}, {"JSON.SET", "doc", `$["b.c"]`, `"x"`}},
+			wantColumn: "affected_fields",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmds, column, err := buildRedisWrite(tt.query, tt.keyType)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCmds, cmds)
+			assert.Equal(t, tt.wantColumn, column)
+		})
+	}
+}
+
+func TestBuildRedisWriteErrors(t *testing.T) {
+	data := map[string]interface{}{"value": 1}
+	tests := []struct {
+		name    string
+		query   Query
+		keyType string
+		errType errors.ErrorType
+	}{
+		{"No data", Query{Type: Insert, Collection: "k"}, connectors.RedisTypeString, errors.ErrorTypeValidation},
+		{"Pattern", Query{Type: Insert, Collection: "k:*", Data: data}, connectors.RedisTypeNone, errors.ErrorTypeValidation},
+		{"Conditions", Query{Type: Update, Collection: "k", Data: data, Conditions: map[string]interface{}{"a": 1}}, connectors.RedisTypeHash, errors.ErrorTypeUnsupported},
+		{"Set without member", Query{Type: Insert, Collection: "k", Data: data}, connectors.RedisTypeSet, errors.ErrorTypeValidation},
+		{"Sorted set without score", Query{Type: Insert, Collection: "k", Data: map[string]interface{}{"member": "m"}}, connectors.RedisTypeZSet, errors.ErrorTypeValidation},
+		{"Stream update", Query{Type: Update, Collection: "k", Data: data}, connectors.RedisTypeStream, errors.ErrorTypeUnsupported},
+		{"Unknown type", Query{Type: Insert, Collection: "k", Data: data}, "vectorset", errors.ErrorTypeUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := buildRedisWrite(tt.query, tt.keyType)
+			assert.True(t, errors.IsErrorType(err, tt.errType), "got %v", err)
+		})
+	}
+}
+
+func TestExecuteRedis(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	port, err := strconv.Atoi(server.Port())
+	require.NoError(t, err)
+	connector := connectors.NewRedisConnector(&connectors.Config{Host: server.Host(), Port: port})
+	require.NoError(t, connector.Connect(ctx))
+	defer connector.Close(ctx)
+	executor := NewQueryExecutor(connector)
+
+	server.HSet("user:1", "name", "Ada", "role", "admin")
+	server.HSet("user:2", "name", "Bob", "role", "viewer")
+	server.SAdd("tags", "red", "green", "blue")
+
+	rows, err := executor.Execute(ctx, Query{Type: Select, Collection: "user:*", Conditions: map[string]interface{}{"role": "admin"}, Fields: []string{"name"}})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"name": "Ada"}}, rows)
+
+	rows, err = executor.Execute(ctx, Query{Type: Update, Collection: "user:2", Data: map[string]interface{}{"role": "admin", "team": "core"}})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"affected_fields": int64(1)}}, rows)
+	assert.Equal(t, "admin", server.HGet("user:2", "role"))
+
+	rows, err = executor.Execute(ctx, Query{Type: Delete, Collection: "tags", Conditions: map[string]interface{}{"member": map[string]interface{}{"$in": []interface{}{"red", "blue"}}}})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"affected_rows": int64(2)}}, rows)
+	members, err := server.Members("tags")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"green"}, members)
+
+	rows, err = executor.Execute(ctx, Query{Type: Delete, Collection: "user:*"})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"affected_keys": int64(2)}}, rows)
+	assert.False(t, server.Exists("user:1"))
+}
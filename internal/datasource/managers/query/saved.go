@@ -0,0 +1,537 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/common/errors"
+)
+
+// ParamType is the type of a saved query parameter.
+type ParamType string
+
+const (
+	ParamString ParamType = "string"
+	ParamNumber ParamType = "number"
+	// ParamDate values are RFC 3339 timestamps or dates such as "2024-05-01", and are bound
+	// as time.Time.
+	ParamDate ParamType = "date"
+	// ParamList values are lists, bound as the operand of IN and NOT IN.
+	ParamList ParamType = "list"
+)
+
+// Param stands for a saved query parameter in place of a value. Parameters are written
+// :name in query text and {"$param": "name"} in JSON queries, and may be used as the value
+// of a condition or of a written field; list parameters are the operand of IN and NOT IN.
+type Param struct {
+	Name string
+}
+
+// MarshalJSON encodes the parameter as it is written in JSON queries.
+func (p Param) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"$param": p.Name})
+}
+
+func isParam(v interface{}) bool {
+	_, ok := v.(Param)
+	return ok
+}
+
+// Parameter declares a parameter of a saved query.
+type Parameter struct {
+	Name string    `json:"name"`
+	Type ParamType `json:"type"`
+	// Items is the type of the elements of a list. When it is empty, lists may hold any
+	// strings, numbers and booleans.
+	Items ParamType `json:"items,omitempty"`
+	// Default is bound when no value is given. A parameter without a default is required.
+	Default interface{} `json:"default,omitempty"`
+}
+
+// SavedQuery is a named query bound to a connector, with parameters in place of some of its
+// values. Saving a query under an existing name adds a version; earlier versions are kept.
+type SavedQuery struct {
+	Name string `json:"name"`
+	// Version is assigned when the query is saved, starting at 1.
+	Version   int    `json:"version"`
+	Connector string `json:"connector"`
+	// Query is a Query as JSON, or query text as accepted by Parse.
+	Query       string      `json:"query"`
+	Parameters  []Parameter `json:"parameters,omitempty"`
+	Description string      `json:"description,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// Bind returns the query with its parameters replaced by the given values, or by their
+// defaults. Values are checked against the parameter types and passed to the connector as
+// values, never spliced into query text: SQL connectors receive them as bind parameters.
+//
+// Example:
+//
+//	q, err := saved.Bind(map[string]interface{}{
+//	    "since":    "2024-05-01",
+//	    "statuses": []interface{}{"paid", "refunded"},
+//	})
+//	if err != nil {
+//	    log.Printf("Invalid parameters: %v", err)
+//	}
+//	rows, err := query.NewQueryExecutor(connector).Execute(ctx, q)
+func (sq SavedQuery) Bind(values map[string]interface{}) (Query, error) {
+	for name := range values {
+		if sq.parameter(name) == nil {
+			return Query{}, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("unknown parameter %s", name), nil)
+		}
+	}
+
+	bound := make(map[string]interface{}, len(sq.Parameters))
+	for _, p := range sq.Parameters {
+		v, ok := values[p.Name]
+		if !ok || v == nil {
+			if p.Default == nil {
+				return Query{}, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("parameter %s is required", p.Name), nil)
+			}
+			v = p.Default
+		}
+		value, err := p.coerce(v)
+		if err != nil {
+			return Query{}, err
+		}
+		bound[p.Name] = value
+	}
+
+	q, err := parseTemplate(sq.Query)
+	if err != nil {
+		return Query{}, err
+	}
+	err = replaceParams(&q, func(p Param, _ bool) (interface{}, error) {
+		return bound[p.Name], nil
+	})
+	return q, err
+}
+
+// parameter returns the declared parameter with the given name, or nil.
+func (sq SavedQuery) parameter(name string) *Parameter {
+	for i := range sq.Parameters {
+		if sq.Parameters[i].Name == name {
+			return &sq.Parameters[i]
+		}
+	}
+	return nil
+}
+
+// validate checks a saved query before it is stored: its parameters are well formed, and
+// the query parses and uses every declared parameter, and only those, where a value of its
+// type belongs.
+func (sq SavedQuery) validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf(format, args...), nil)
+	}
+	if strings.TrimSpace(sq.Name) == "" {
+		return invalid("saved query name is required")
+	}
+	if sq.Connector == "" {
+		return invalid("saved query %s requires a connector", sq.Name)
+	}
+
+	for i, p := range sq.Parameters {
+		if p.Name == "" {
+			return invalid("parameter %d has no name", i+1)
+		}
+		if sq.parameter(p.Name) != &sq.Parameters[i] {
+			return invalid("duplicate parameter %s", p.Name)
+		}
+		switch p.Type {
+		case ParamString, ParamNumber, ParamDate:
+			if p.Items != "" {
+				return invalid("parameter %s: only lists have an item type", p.Name)
+			}
+		case ParamList:
+			switch p.Items {
+			case "", ParamString, ParamNumber, ParamDate:
+			default:
+				return invalid("parameter %s: unsupported item type %q", p.Name, p.Items)
+			}
+		default:
+			return invalid("parameter %s: unsupported type %q; use string, number, date or list", p.Name, p.Type)
+		}
+		if p.Default != nil {
+			if _, err := p.coerce(p.Default); err != nil {
+				return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("invalid default for parameter %s", p.Name), err)
+			}
+		}
+	}
+
+	q, err := parseTemplate(sq.Query)
+	if err != nil {
+		return err
+	}
+	used := make(map[string]bool)
+	err = replaceParams(&q, func(ref Param, list bool) (interface{}, error) {
+		p := sq.parameter(ref.Name)
+		switch {
+		case p == nil:
+			return nil, invalid("parameter %s is not declared", ref.Name)
+		case list && p.Type != ParamList:
+			return nil, invalid("parameter %s is the operand of IN, so it must be a list", ref.Name)
+		case !list && p.Type == ParamList:
+			return nil, invalid("list parameter %s can only be the operand of IN or NOT IN", ref.Name)
+		}
+		used[ref.Name] = true
+		return ref, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range sq.Parameters {
+		if !used[p.Name] {
+			return invalid("parameter %s is not used by the query", p.Name)
+		}
+	}
+	return nil
+}
+
+// coerce checks a value against the parameter's type and converts it to the value that
+// is bound: strings, int64 or float64 numbers, time.Time dates, and []interface{} lists.
+func (p Parameter) coerce(v interface{}) (interface{}, error) {
+	if p.Type != ParamList {
+		return coerceParam(p.Name, p.Type, v)
+	}
+
+	var list []interface{}
+	switch v := v.(type) {
+	case []interface{}:
+		list = v
+	case []string:
+		for _, s := range v {
+			list = append(list, s)
+		}
+	default:
+		return nil, errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("parameter %s must be a list, got %T", p.Name, v), nil)
+	}
+	values := make([]interface{}, len(list))
+	for i, item := range list {
+		var err error
+		switch p.Items {
+		case "":
+			switch item := item.(type) {
+			case json.Number:
+				values[i], err = coerceParam(p.Name, ParamNumber, item)
+			case string, bool, float64, int, int64:
+				values[i] = item
+			default:
+				err = errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("parameter %s: list items must be strings, numbers or booleans, got %T", p.Name, item), nil)
+			}
+		default:
+			values[i], err = coerceParam(p.Name, p.Items, item)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// coerceParam converts a scalar value to the given type.
+func coerceParam(name string, t ParamType, v interface{}) (interface{}, error) {
+	invalid := func() error {
+		return errors.NewError(errors.ErrorTypeValidation, fmt.Sprintf("parameter %s must be a %s, got %v", name, t, v), nil)
+	}
+	switch t {
+	case ParamString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, invalid()
+		}
+		return s, nil
+	case ParamNumber:
+		var text string
+		switch v := v.(type) {
+		case int:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), nil
+			}
+			return v, nil
+		case json.Number:
+			text = v.String()
+		case string:
+			text = strings.TrimSpace(v)
+		default:
+			return nil, invalid()
+		}
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n, nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, invalid()
+		}
+		return f, nil
+	case ParamDate:
+		switch v := v.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t, nil
+			}
+			if t, err := time.Parse("2006-01-02", v); err == nil {
+				return t, nil
+			}
+		}
+		return nil, invalid()
+	}
+	return nil, invalid()
+}
+
+// parseTemplate parses the query of a saved query, with parameters in place of values.
+func parseTemplate(text string) (Query, error) {
+	if !strings.HasPrefix(strings.TrimSpace(text), "{") {
+		return parse(text, true)
+	}
+	var q Query
+	if err := json.Unmarshal([]byte(text), &q); err != nil {
+		return Query{}, errors.NewError(errors.ErrorTypeValidation, "invalid query JSON", err)
+	}
+	err := replaceParams(&q, nil)
+	return q, err
+}
+
+// replaceParams replaces the parameters among the values of a query's conditions and data
+// with the results of fn, which is told whether the parameter stands for a list. JSON
+// parameters, {"$param": "name"}, are converted to Params first; with a nil fn, that is all
+// it does.
+func replaceParams(q *Query, fn func(p Param, list bool) (interface{}, error)) error {
+	replace := func(v interface{}, list bool) (interface{}, error) {
+		if m, ok := v.(map[string]interface{}); ok && len(m) == 1 {
+			if name, ok := m["$param"].(string); ok {
+				v = Param{Name: name}
+			}
+		}
+		p, ok := v.(Param)
+		if !ok || fn == nil {
+			return v, nil
+		}
+		return fn(p, list)
+	}
+
+	var err error
+	for field, v := range q.Data {
+		if q.Data[field], err = replace(v, false); err != nil {
+			return err
+		}
+	}
+	for field, v := range q.Conditions {
+		if ops, ok := v.(map[string]interface{}); ok && isOperatorMap(ops) && ops["$param"] == nil {
+			for op, operand := range ops {
+				if items, ok := operand.([]interface{}); ok {
+					for i, item := range items {
+						if items[i], err = replace(item, false); err != nil {
+							return err
+						}
+					}
+					continue
+				}
+				list := Operator(op) == OpIn || Operator(op) == OpNin
+				if ops[op], err = replace(operand, list); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if q.Conditions[field], err = replace(v, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// savedQueriesFile is the file format of a SavedQueryCatalog: the versions of each saved
+// query, oldest first.
+type savedQueriesFile map[string][]SavedQuery
+
+// SavedQueryCatalog stores saved queries and their versions. Queries are kept in a single
+// JSON file that is replaced atomically on every change; a catalog without a path keeps
+// them in memory only.
+type SavedQueryCatalog struct {
+	path    string
+	mu      sync.RWMutex
+	queries savedQueriesFile
+	now     func() time.Time
+}
+
+// NewSavedQueryCatalog opens the catalog stored at path, which is created on the first save.
+// An empty path returns an in-memory catalog.
+func NewSavedQueryCatalog(path string) (*SavedQueryCatalog, error) {
+	c := &SavedQueryCatalog{path: path, queries: make(savedQueriesFile), now: time.Now}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeFileConnection, "failed to read saved queries", err)
+	}
+	if err := json.Unmarshal(data, &c.queries); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeDataIntegrity, "failed to parse saved queries", err)
+	}
+	return c, nil
+}
+
+// Save validates a query and stores it as the next version of its name. The stored query,
+// with its version and creation time, is returned.
+func (c *SavedQueryCatalog) Save(sq SavedQuery) (SavedQuery, error) {
+	if err := sq.validate(); err != nil {
+		return SavedQuery{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	versions := c.queries[sq.Name]
+	sq.Version = len(versions) + 1
+	if len(versions) > 0 {
+		sq.Version = versions[len(versions)-1].Version + 1
+	}
+	sq.CreatedAt = c.now().UTC()
+	c.queries[sq.Name] = append(versions, sq)
+	if err := c.write(); err != nil {
+		c.queries[sq.Name] = versions
+		return SavedQuery{}, err
+	}
+	return sq, nil
+}
+
+// Get returns a version of a saved query, or its latest version if version is 0.
+func (c *SavedQueryCatalog) Get(name string, version int) (SavedQuery, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	versions := c.queries[name]
+	if len(versions) == 0 {
+		return SavedQuery{}, errors.NewError(errors.ErrorTypeNotFound, fmt.Sprintf("saved query '%s' not found", name), nil)
+	}
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, sq := range versions {
+		if sq.Version == version {
+			return sq, nil
+		}
+	}
+	return SavedQuery{}, errors.NewError(errors.ErrorTypeNotFound, fmt.Sprintf("version %d of saved query '%s' not found", version, name), nil)
+}
+
+// List returns the latest version of every saved query, ordered by name.
+func (c *SavedQueryCatalog) List() []SavedQuery {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.queries))
+	for name := range c.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	queries := make([]SavedQuery, len(names))
+	for i, name := range names {
+		versions := c.queries[name]
+		queries[i] = versions[len(versions)-1]
+	}
+	return queries
+}
+
+// Versions returns every version of a saved query, oldest first.
+func (c *SavedQueryCatalog) Versions(name string) ([]SavedQuery, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	versions := c.queries[name]
+	if len(versions) == 0 {
+		return nil, errors.NewError(errors.ErrorTypeNotFound, fmt.Sprintf("saved query '%s' not found", name), nil)
+	}
+	return append([]SavedQuery(nil), versions...), nil
+}
+
+// Delete removes a saved query with all its versions.
+func (c *SavedQueryCatalog) Delete(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	versions, ok := c.queries[name]
+	if !ok {
+		return errors.NewError(errors.ErrorTypeNotFound, fmt.Sprintf("saved query '%s' not found", name), nil)
+	}
+	delete(c.queries, name)
+	if err := c.write(); err != nil {
+		c.queries[name] = versions
+		return err
+	}
+	return nil
+}
+
+// write replaces the catalog file. The caller holds c.mu.
+func (c *SavedQueryCatalog) write() error {
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.queries, "", "  ")
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeDataIntegrity, "failed to encode saved queries", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return errors.NewError(errors.ErrorTypeFileConnection, "failed to create saved queries directory", err)
+	}
+	// A temporary file of its own keeps catalogs of other processes sharing the directory
+	// from renaming a file this one is still writing, and syncing it before the rename keeps
+	// a crash from leaving an empty catalog.
+	dir := filepath.Dir(c.path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeFileConnection, "failed to create saved queries file", err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.NewError(errors.ErrorTypeFileConnection, "failed to write saved queries", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		os.Remove(tmp.Name())
+		return errors.NewError(errors.ErrorTypeFileConnection, "failed to replace saved queries", err)
+	}
+	// The rename is durable once the directory is synced.
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeFileConnection, "failed to sync saved queries directory", err)
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeFileConnection, "failed to sync saved queries directory", err)
+	}
+	return nil
+}
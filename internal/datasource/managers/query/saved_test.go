@@ -0,0 +1,182 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pkg/common/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ordersByStatus() SavedQuery {
+	return SavedQuery{
+		Name:      "orders-by-status",
+		Connector: "shop",
+		Query:     "SELECT id, total FROM orders WHERE status IN :statuses AND total >= :min_total AND created_at >= :since ORDER BY id",
+		Parameters: []Parameter{
+			{Name: "statuses", Type: ParamList, Items: ParamString, Default: []interface{}{"paid"}},
+			{Name: "min_total", Type: ParamNumber, Default: 0},
+			{Name: "since", Type: ParamDate},
+		},
+	}
+}
+
+func TestSavedQueryBind(t *testing.T) {
+	sq := ordersByStatus()
+	require.NoError(t, sq.validate())
+
+	q, err := sq.Bind(map[string]interface{}{
+		"statuses":  []interface{}{"paid", "x' OR '1'='1"},
+		"min_total": json.Number("12.5"),
+		"since":     "2024-05-01",
+	})
+	require.NoError(t, err)
+	sql, args, err := buildSQLQuery(q, dialectFor("postgres"))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT id, total FROM orders WHERE created_at >= $1 AND status IN ($2, $3) AND total >= $4 ORDER BY id ASC", sql)
+	assert.Equal(t, []interface{}{time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), "paid", "x' OR '1'='1", 12.5}, args)
+
+	// Defaults fill in missing values.
+	q, err = sq.Bind(map[string]interface{}{"since": "2024-05-01T10:00:00Z"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"status":     map[string]interface{}{"$in": []interface{}{"paid"}},
+		"total":      map[string]interface{}{"$gte": int64(0)},
+		"created_at": map[string]interface{}{"$gte": time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+	}, q.Conditions)
+
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+	}{
+		{"Missing required", map[string]interface{}{}},
+		{"Unknown parameter", map[string]interface{}{"since": "2024-05-01", "limit": 5}},
+		{"Invalid date", map[string]interface{}{"since": "yesterday"}},
+		{"Invalid number", map[string]interface{}{"since": "2024-05-01", "min_total": "ten"}},
+		{"Scalar for list", map[string]interface{}{"since": "2024-05-01", "statuses": "paid"}},
+		{"Invalid list item", map[string]interface{}{"since": "2024-05-01", "statuses": []interface{}{1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := sq.Bind(tt.values)
+			assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation), "%v", err)
+		})
+	}
+}
+
+func TestSavedQueryJSON(t *testing.T) {
+	sq := SavedQuery{
+		Name:      "paid-orders",
+		Connector: "shop",
+		Query: `{"type": "SELECT", "collection": "orders.json", "fields": ["id"],
+			"conditions": {"status": {"$param": "status"}, "customer_id": {"$in": {"$param": "customers"}}},
+			"order_by": [{"field": "id"}]}`,
+		Parameters: []Parameter{
+			{Name: "status", Type: ParamString},
+			{Name: "customers", Type: ParamList},
+		},
+	}
+	require.NoError(t, sq.validate())
+
+	q, err := sq.Bind(map[string]interface{}{"status": "paid", "customers": []interface{}{"c1", "c2"}})
+	require.NoError(t, err)
+	rows, err := NewQueryExecutor(newTestFederation(t)["shop"]).Execute(context.Background(), q)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"id": 1.0}, {"id": 2.0}}, rows)
+}
+
+func TestSavedQueryValidation(t *testing.T) {
+	base := func(mutate func(sq *SavedQuery)) SavedQuery {
+		sq := ordersByStatus()
+		mutate(&sq)
+		return sq
+	}
+	tests := []struct {
+		name string
+		sq   SavedQuery
+	}{
+		{"No name", base(func(sq *SavedQuery) { sq.Name = " " })},
+		{"No connector", base(func(sq *SavedQuery) { sq.Connector = "" })},
+		{"Unknown type", base(func(sq *SavedQuery) { sq.Parameters[1].Type = "money" })},
+		{"Duplicate parameter", base(func(sq *SavedQuery) { sq.Parameters = append(sq.Parameters, sq.Parameters[2]) })},
+		{"Invalid default", base(func(sq *SavedQuery) { sq.Parameters[0].Default = []interface{}{1} })},
+		{"Undeclared parameter", base(func(sq *SavedQuery) { sq.Parameters = sq.Parameters[:2] })},
+		{"Unused parameter", base(func(sq *SavedQuery) {
+			sq.Parameters = append(sq.Parameters, Parameter{Name: "extra", Type: ParamString})
+		})},
+		{"Scalar for IN", base(func(sq *SavedQuery) {
+			sq.Parameters[0].Type, sq.Parameters[0].Items, sq.Parameters[0].Default = ParamString, "", nil
+		})},
+		{"List outside IN", base(func(sq *SavedQuery) { sq.Parameters[1] = Parameter{Name: "min_total", Type: ParamList} })},
+		{"Syntax error", base(func(sq *SavedQuery) { sq.Query = "SELECT * FROM orders WHERE total >= :" })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sq.validate()
+			assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation), "%v", err)
+		})
+	}
+
+	// Parameters are only accepted in saved queries.
+	_, err := Parse("SELECT * FROM orders WHERE status = :status")
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation))
+}
+
+func TestSavedQueryCatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "saved-queries.json")
+	catalog, err := NewSavedQueryCatalog(path)
+	require.NoError(t, err)
+
+	v1, err := catalog.Save(ordersByStatus())
+	require.NoError(t, err)
+	assert.Equal(t, 1, v1.Version)
+	assert.False(t, v1.CreatedAt.IsZero())
+
+	next := ordersByStatus()
+	next.Description = "Orders above a total"
+	v2, err := catalog.Save(next)
+	require.NoError(t, err)
+	assert.Equal(t, 2, v2.Version)
+
+	// Writes replace the file through a temporary file that is not left behind.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "saved-queries.json", entries[0].Name())
+
+	invalid := ordersByStatus()
+	invalid.Parameters = nil
+	_, err = catalog.Save(invalid)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeValidation))
+
+	// The catalog is reloaded from its file.
+	catalog, err = NewSavedQueryCatalog(path)
+	require.NoError(t, err)
+	latest, err := catalog.Get("orders-by-status", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "Orders above a total", latest.Description)
+	first, err := catalog.Get("orders-by-status", 1)
+	require.NoError(t, err)
+	assert.Empty(t, first.Description)
+	versions, err := catalog.Versions("orders-by-status")
+	require.NoError(t, err)
+	assert.Len(t, versions, 2)
+	assert.Len(t, catalog.List(), 1)
+
+	// Defaults read back from the file still bind.
+	_, err = latest.Bind(map[string]interface{}{"since": "2024-05-01"})
+	require.NoError(t, err)
+
+	_, err = catalog.Get("orders-by-status", 3)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+	require.NoError(t, catalog.Delete("orders-by-status"))
+	_, err = catalog.Get("orders-by-status", 0)
+	assert.True(t, errors.IsErrorType(err, errors.ErrorTypeNotFound))
+	assert.True(t, errors.IsErrorType(catalog.Delete("orders-by-status"), errors.ErrorTypeNotFound))
+}
@@ -0,0 +1,341 @@
+package query
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"pkg/common/errors"
+)
+
+// memoryBudget bounds the memory held by the rows of one query's intermediate results.
+type memoryBudget struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+}
+
+// reserve takes n bytes from the budget, and reports false if they are not available.
+func (b *memoryBudget) reserve(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used+n > b.limit {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+}
+
+// rowSpool holds an intermediate result. Rows are kept in memory while the budget allows,
+// then all of them are written to a temporary file as JSON lines. Rows read back from a file
+// hold JSON values: numbers are json.Numbers and times are RFC 3339 strings, which
+// conditions, ordering and aggregations handle as they would the original values.
+type rowSpool struct {
+	budget   *memoryBudget
+	dir      string
+	rows     []map[string]interface{}
+	reserved int64
+	file     *os.File
+	writer   *bufio.Writer
+	encoder  *json.Encoder
+	count    int
+}
+
+func newRowSpool(budget *memoryBudget, dir string) *rowSpool {
+	return &rowSpool{budget: budget, dir: dir}
+}
+
+// add appends a row, spilling the spool to disk if the row does not fit in the budget.
+func (s *rowSpool) add(row map[string]interface{}) error {
+	s.count++
+	if s.file == nil {
+		size := rowSize(row)
+		if s.budget.reserve(size) {
+			s.rows = append(s.rows, row)
+			s.reserved += size
+			return nil
+		}
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	if err := s.encoder.Encode(row); err != nil {
+		return errors.NewError(errors.ErrorTypeExecution, "failed to write spilled rows", err)
+	}
+	return nil
+}
+
+// spill moves the spool's rows to a temporary file, and releases their memory.
+func (s *rowSpool) spill() error {
+	if s.file != nil {
+		return nil
+	}
+	file, err := os.CreateTemp(s.dir, "datavinci-spool-*.jsonl")
+	if err != nil {
+		return errors.NewError(errors.ErrorTypeExecution, "failed to create spill file", err)
+	}
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	s.encoder = json.NewEncoder(s.writer)
+	for _, row := range s.rows {
+		if err := s.encoder.Encode(row); err != nil {
+			return errors.NewError(errors.ErrorTypeExecution, "failed to write spilled rows", err)
+		}
+	}
+	s.rows = nil
+	s.budget.release(s.reserved)
+	s.reserved = 0
+	return nil
+}
+
+func (s *rowSpool) spilled() bool {
+	return s.file != nil
+}
+
+// each calls fn with every row in the order they were added, stopping at the first error.
+func (s *rowSpool) each(fn func(row map[string]interface{}) error) error {
+	if s.file == nil {
+		for _, row := range s.rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	reader, err := s.reader()
+	if err != nil {
+		return err
+	}
+	defer reader.close()
+	for {
+		row, err := reader.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// reader opens the spill file for reading from its start.
+func (s *rowSpool) reader() (*spoolReader, error) {
+	if err := s.writer.Flush(); err != nil {
+		return nil, errors.NewError(errors.ErrorTypeExecution, "failed to write spilled rows", err)
+	}
+	file, err := os.Open(s.file.Name())
+	if err != nil {
+		return nil, errors.NewError(errors.ErrorTypeExecution, "failed to read spilled rows", err)
+	}
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	decoder.UseNumber()
+	return &spoolReader{file: file, decoder: decoder}, nil
+}
+
+// close releases the spool's memory and removes its file.
+func (s *rowSpool) close() {
+	s.budget.release(s.reserved)
+	s.rows, s.reserved = nil, 0
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.file.Name())
+		s.file = nil
+	}
+}
+
+// spoolReader reads the rows of a spill file.
+type spoolReader struct {
+	file    *os.File
+	decoder *json.Decoder
+}
+
+// next returns the next row, or io.EOF after the last one.
+func (r *spoolReader) next() (map[string]interface{}, error) {
+	var row map[string]interface{}
+	if err := r.decoder.Decode(&row); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, errors.NewError(errors.ErrorTypeExecution, "failed to read spilled rows", err)
+	}
+	return row, nil
+}
+
+func (r *spoolReader) close() {
+	r.file.Close()
+}
+
+// sortedEach calls fn with the rows of s in the given order. Rows that fit in memory are
+// sorted in place; otherwise sorted runs are written to disk and merged.
+func sortedEach(s *rowSpool, orderBy []OrderBy, fn func(row map[string]interface{}) error) error {
+	if !s.spilled() {
+		sortRows(s.rows, orderBy)
+		return s.each(fn)
+	}
+
+	var runs []*rowSpool
+	defer func() {
+		for _, run := range runs {
+			run.close()
+		}
+	}()
+	var chunk []map[string]interface{}
+	var reserved int64
+	flush := func() error {
+		sortRows(chunk, orderBy)
+		run := newRowSpool(s.budget, s.dir)
+		runs = append(runs, run)
+		if err := run.spill(); err != nil {
+			return err
+		}
+		for _, row := range chunk {
+			if err := run.add(row); err != nil {
+				return err
+			}
+		}
+		s.budget.release(reserved)
+		chunk, reserved = nil, 0
+		return nil
+	}
+	err := s.each(func(row map[string]interface{}) error {
+		size := rowSize(row)
+		if !s.budget.reserve(size) {
+			if len(chunk) > 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			// A run holds at least one row, even if the budget is spent elsewhere.
+			if !s.budget.reserve(size) {
+				chunk = append(chunk, row)
+				return flush()
+			}
+		}
+		chunk = append(chunk, row)
+		reserved += size
+		return nil
+	})
+	if err == nil && len(chunk) > 0 {
+		err = flush()
+	}
+	if err != nil {
+		s.budget.release(reserved)
+		return err
+	}
+
+	merge := &runMerge{orderBy: orderBy}
+	defer func() {
+		for _, head := range merge.heads {
+			head.reader.close()
+		}
+	}()
+	for i, run := range runs {
+		reader, err := run.reader()
+		if err != nil {
+			return err
+		}
+		row, err := reader.next()
+		if err == io.EOF {
+			reader.close()
+			continue
+		}
+		if err != nil {
+			reader.close()
+			return err
+		}
+		merge.heads = append(merge.heads, &runHead{row: row, reader: reader, run: i})
+	}
+	heap.Init(merge)
+	for merge.Len() > 0 {
+		head := merge.heads[0]
+		if err := fn(head.row); err != nil {
+			return err
+		}
+		row, err := head.reader.next()
+		switch {
+		case err == io.EOF:
+			head.reader.close()
+			heap.Pop(merge)
+		case err != nil:
+			return err
+		default:
+			head.row = row
+			heap.Fix(merge, 0)
+		}
+	}
+	return nil
+}
+
+// runHead is the next row of a sorted run.
+type runHead struct {
+	row    map[string]interface{}
+	reader *spoolReader
+	run    int
+}
+
+// runMerge is a heap of sorted runs ordered by their next rows. Equal rows come from the
+// earliest run first, so the merge is stable.
+type runMerge struct {
+	heads   []*runHead
+	orderBy []OrderBy
+}
+
+func (m *runMerge) Len() int { return len(m.heads) }
+
+func (m *runMerge) Less(i, j int) bool {
+	if cmp := compareRows(m.heads[i].row, m.heads[j].row, m.orderBy); cmp != 0 {
+		return cmp < 0
+	}
+	return m.heads[i].run < m.heads[j].run
+}
+
+func (m *runMerge) Swap(i, j int) { m.heads[i], m.heads[j] = m.heads[j], m.heads[i] }
+
+func (m *runMerge) Push(x interface{}) { m.heads = append(m.heads, x.(*runHead)) }
+
+func (m *runMerge) Pop() interface{} {
+	last := m.heads[len(m.heads)-1]
+	m.heads = m.heads[:len(m.heads)-1]
+	return last
+}
+
+// rowSize estimates the memory held by a row.
+func rowSize(row map[string]interface{}) int64 {
+	size := int64(48)
+	for k, v := range row {
+		size += int64(16+len(k)) + valueSize(v)
+	}
+	return size
+}
+
+func valueSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case string:
+		return int64(16 + len(v))
+	case []byte:
+		return int64(24 + len(v))
+	case map[string]interface{}:
+		return rowSize(v)
+	case []interface{}:
+		size := int64(24)
+		for _, e := range v {
+			size += valueSize(e)
+		}
+		return size
+	default:
+		return 16
+	}
+}
@@ -25,6 +25,11 @@ type Config struct {
 	NonRetryableErrors []func(error) bool
 }
 
+// RetryAfterContextKey is the error context key with which a failed attempt asks to wait at
+// least a given time before the next one, as a duration string such as "2s". It is used for
+// responses like HTTP 429 with a Retry-After header.
+const RetryAfterContextKey = "retry_after"
+
 // DefaultConfig returns a default retry configuration.
 // It sets up sensible defaults for retry attempts, backoff durations,
 // and includes common retryable and non-retryable error checks.
@@ -52,7 +57,9 @@ func DefaultConfig() *Config {
 // is canceled.
 //
 // If the function returns a non-retryable error, Retry will return immediately without
-// further attempts.
+// further attempts. If the error carries a RetryAfterContextKey context value longer than
+// the current backoff, Retry waits for that long instead, up to MaxBackoff and the time
+// left before the context's deadline.
 func Retry(ctx context.Context, fn func() error, config *Config) error {
 	var err error
 	attempt := 0
@@ -72,10 +79,15 @@ func Retry(ctx context.Context, fn func() error, config *Config) error {
 			return err
 		}
 
+		wait := backoff
+		if after := retryAfter(err); after > wait {
+			wait = capRetryAfter(ctx, after, config.MaxBackoff)
+		}
+
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(backoff):
+		case <-time.After(wait):
 			attempt++
 			backoff = calculateNextBackoff(backoff, config)
 		}
@@ -84,6 +96,36 @@ func Retry(ctx context.Context, fn func() error, config *Config) error {
 	return errors.NewError(errors.ErrorTypeUnknown, "max retry attempts reached", err)
 }
 
+// retryAfter returns the wait requested by err through RetryAfterContextKey, or zero.
+func retryAfter(err error) time.Duration {
+	value, ok := errors.GetErrorContext(err)[RetryAfterContextKey]
+	if !ok {
+		return 0
+	}
+	d, parseErr := time.ParseDuration(value)
+	if parseErr != nil {
+		return 0
+	}
+	return d
+}
+
+// capRetryAfter limits a requested wait to maxBackoff, if set, and to the time left before
+// the deadline of ctx, so that a server cannot hold a caller for longer than it allows.
+func capRetryAfter(ctx context.Context, wait, maxBackoff time.Duration) time.Duration {
+	if maxBackoff > 0 && wait > maxBackoff {
+		wait = maxBackoff
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < wait {
+			wait = left
+		}
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
 // isRetryableError checks if the given error is retryable based on the provided list of check functions.
 func isRetryableError(err error, retryableErrors []func(error) bool) bool {
 	for _, isRetryable := range retryableErrors {
@@ -84,3 +84,57 @@ func TestRetry(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	config := DefaultConfig()
+	config.InitialBackoff = time.Millisecond
+
+	calls := 0
+	start := time.Now()
+	err := Retry(context.Background(), func() error {
+		calls++
+		if calls == 1 {
+			err := errors.NewError(errors.ErrorTypeConnection, "rate limited", nil)
+			return errors.AddErrorContext(err, RetryAfterContextKey, "200ms")
+		}
+		return nil
+	}, config)
+
+	if err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Retry() waited %v, want at least 200ms", elapsed)
+	}
+}
+
+func TestRetryCapsRetryAfter(t *testing.T) {
+	rateLimited := func() error {
+		err := errors.NewError(errors.ErrorTypeConnection, "rate limited", nil)
+		return errors.AddErrorContext(err, RetryAfterContextKey, "1h")
+	}
+
+	config := DefaultConfig()
+	config.InitialBackoff = time.Millisecond
+	config.MaxBackoff = 50 * time.Millisecond
+	config.MaxAttempts = 2
+
+	start := time.Now()
+	err := Retry(context.Background(), rateLimited, config)
+	if err == nil {
+		t.Fatal("Retry() error = nil, want max attempts error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Retry() waited %v, want at most MaxBackoff per attempt", elapsed)
+	}
+
+	// The wait also ends at the context's deadline.
+	config.MaxBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	Retry(ctx, rateLimited, config)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Retry() waited %v past the context deadline", elapsed)
+	}
+}